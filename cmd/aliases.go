@@ -0,0 +1,102 @@
+package cmd
+
+import (
+	stderrors "errors"
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/emilkje/cwc/pkg/config"
+)
+
+var errUnterminatedQuote = stderrors.New("unterminated quote")
+
+// ExpandAlias replaces the first of args with the arguments it stands for
+// if it names an alias from the config file, and makes root run with them.
+// Like git aliases, the first argument is the only one expanded, aliases
+// can't refer to other aliases and commands take precedence over them.
+func ExpandAlias(root *cobra.Command, args []string) error {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		return nil
+	}
+
+	cfg, err := config.LoadConfigOrDefault()
+	if err != nil {
+		return nil //nolint:nilerr // the command reports the broken config file
+	}
+
+	alias, ok := cfg.Aliases[args[0]]
+	if !ok || isCommand(root, args[0]) {
+		return nil
+	}
+
+	expanded, err := splitArgs(alias)
+	if err != nil {
+		return fmt.Errorf("error expanding alias %q: %w", args[0], err)
+	}
+
+	root.SetArgs(append(expanded, args[1:]...))
+
+	return nil
+}
+
+func isCommand(root *cobra.Command, name string) bool {
+	for _, command := range root.Commands() {
+		if command.Name() == name || command.HasAlias(name) {
+			return true
+		}
+	}
+
+	return name == "help" || name == "completion"
+}
+
+// splitArgs splits an alias into arguments at white space, like a shell
+// would: quotes keep white space in an argument and a backslash escapes the
+// next character outside single quotes.
+func splitArgs(s string) ([]string, error) {
+	var (
+		args    []string
+		current strings.Builder
+		inArg   bool
+		quote   rune
+		escaped bool
+	)
+
+	for _, r := range s {
+		switch {
+		case escaped:
+			current.WriteRune(r)
+			escaped = false
+		case r == '\\' && quote != '\'':
+			escaped, inArg = true, true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				current.WriteRune(r)
+			}
+		case r == '"' || r == '\'':
+			quote, inArg = r, true
+		case r == ' ' || r == '\t' || r == '\n':
+			if inArg {
+				args = append(args, current.String())
+				current.Reset()
+				inArg = false
+			}
+		default:
+			current.WriteRune(r)
+			inArg = true
+		}
+	}
+
+	if quote != 0 || escaped {
+		return nil, errUnterminatedQuote
+	}
+
+	if inArg {
+		args = append(args, current.String())
+	}
+
+	return args, nil
+}
@@ -0,0 +1,70 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/emilkje/cwc/pkg/annotations"
+	"github.com/emilkje/cwc/pkg/pathmatcher"
+)
+
+// Output formats of the commands that report findings.
+const (
+	formatText              = "text"
+	formatGitHubAnnotations = "github-annotations"
+)
+
+// addFormatFlag adds --format to a command that reports findings.
+func addFormatFlag(cmd *cobra.Command, format *string) {
+	cmd.Flags().StringVar(format, "format", formatText,
+		"how to print the findings: "+formatText+", or "+formatGitHubAnnotations+" to annotate them in GitHub Actions")
+}
+
+func validateFormat(format string) error {
+	if format != formatText && format != formatGitHubAnnotations {
+		return fmt.Errorf("unknown format %q, use %s or %s", format, formatText, formatGitHubAnnotations)
+	}
+
+	return nil
+}
+
+// printAnnotation prints the annotation of a finding in a file, named
+// relative to the working directory. Files outside the repository annotate
+// the run as a whole.
+func printAnnotation(annotation *annotations.Annotation) {
+	annotation.File = repositoryPath(annotation.File)
+	if annotation.File == "" {
+		annotation.Line, annotation.EndLine, annotation.Column = 0, 0, 0
+	}
+
+	fmt.Println(annotation.String()) //nolint:forbidigo
+}
+
+// repositoryPath returns the path relative to the root of the repository,
+// as annotations name files, or "" if it is outside the repository.
+func repositoryPath(path string) string {
+	if path == "" {
+		return ""
+	}
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		return ""
+	}
+
+	abs := path
+	if !filepath.IsAbs(abs) {
+		abs = filepath.Join(cwd, path)
+	}
+
+	rel, err := filepath.Rel(pathmatcher.FindRepositoryRoot(cwd), abs)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return ""
+	}
+
+	return filepath.ToSlash(rel)
+}
@@ -0,0 +1,390 @@
+package cmd
+
+import (
+	stderrors "errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/emilkje/cwc/pkg/backup"
+	"github.com/emilkje/cwc/pkg/config"
+	"github.com/emilkje/cwc/pkg/edits"
+	"github.com/emilkje/cwc/pkg/errors"
+	"github.com/emilkje/cwc/pkg/filetree"
+	"github.com/emilkje/cwc/pkg/formatter"
+	"github.com/emilkje/cwc/pkg/pathmatcher"
+	"github.com/emilkje/cwc/pkg/ui"
+)
+
+const newFilePermissions = 0o644
+
+// plannedEdit is a change to a single file, computed before anything is
+// written so that a patch that doesn't apply leaves every file untouched.
+type plannedEdit struct {
+	patch     edits.FilePatch
+	target    string
+	content   string
+	oldTarget string // set when the file is renamed or deleted
+	// original is the content the patch applies to, empty for new files.
+	original   string
+	outOfScope bool
+}
+
+func applyCommand(s *chatSession, arg string) bool {
+	if s.conversation == nil || s.conversation.LastReply() == "" {
+		ui.PrintMessage("there is no response to apply yet\n", ui.MessageTypeWarning)
+		return true
+	}
+
+	planned, err := planEdits(s.conversation.LastReply(), s.files)
+	if err != nil {
+		ui.PrintMessage(fmt.Sprintf("not applying the changes: %s\n", err), ui.MessageTypeError)
+		return true
+	}
+
+	if len(planned) == 0 {
+		ui.PrintMessage("the last response contains no diff to apply\n", ui.MessageTypeWarning)
+		return true
+	}
+
+	switch arg {
+	case "":
+	case "-p", "--patch":
+		planned = reviewHunks(planned)
+	default:
+		ui.PrintMessage(fmt.Sprintf("unknown argument %q, use /apply or /apply -p\n", arg), ui.MessageTypeWarning)
+		return true
+	}
+
+	if len(planned) == 0 || !confirmEdits(planned, "") {
+		ui.PrintMessage("nothing was changed\n", ui.MessageTypeInfo)
+		return true
+	}
+
+	if err := writeEdits(planned); err != nil {
+		ui.PrintMessage(err.Error()+"\n", ui.MessageTypeError)
+		return true
+	}
+
+	s.reloadFiles(planned)
+	ui.PrintMessage(fmt.Sprintf("applied changes to %d files\n", len(planned)), ui.MessageTypeSuccess)
+	s.commitEdits(planned)
+	s.verify()
+
+	return true
+}
+
+// confirmEdits lists the planned edits and asks before files outside the
+// context are written to. A question, if given, is asked otherwise.
+func confirmEdits(planned []plannedEdit, question string) bool {
+	var summary, outOfScope strings.Builder
+
+	for _, edit := range planned {
+		added, removed := edit.patch.Stats()
+		fmt.Fprintf(&summary, "  %s %s (+%d -%d)\n", editKind(&edit.patch), edit.patch.Path(), added, removed)
+
+		if edit.outOfScope {
+			fmt.Fprintf(&outOfScope, "  %s\n", edit.patch.Path())
+		}
+	}
+
+	ui.PrintMessage(summary.String(), ui.MessageTypeNotice)
+
+	if outOfScope.Len() > 0 {
+		ui.PrintMessage("These files are not part of the context:\n"+outOfScope.String(), ui.MessageTypeWarning)
+
+		return ui.AskYesNo("Apply the changes to them anyway?", false)
+	}
+
+	return question == "" || ui.AskYesNo(question, true)
+}
+
+// writeEdits writes the planned edits and formats the written files. The
+// files are backed up first, for cwc undo, and restored when an edit fails.
+func writeEdits(planned []plannedEdit) error {
+	paths := editPaths(planned)
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		return fmt.Errorf("error getting current directory: %w", err)
+	}
+
+	snapshot, err := backup.Take(pathmatcher.FindRepositoryRoot(cwd), paths)
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	for _, edit := range planned {
+		if err := writeEdit(&edit); err != nil {
+			if restoreErr := snapshot.Restore(); restoreErr != nil {
+				return fmt.Errorf("error applying %s: %w", edit.patch.Path(), stderrors.Join(err, restoreErr))
+			}
+
+			return fmt.Errorf("error applying %s, no files were changed: %w", edit.patch.Path(), err)
+		}
+	}
+
+	formatEdits(planned)
+	saveBackup(snapshot)
+
+	return nil
+}
+
+// resolveEditFormat returns the format the model is asked to write edits in:
+// the one given with --edit-format, else the one the config file sets for
+// the model, else its editFormat, else unified diffs.
+func resolveEditFormat(flag string) (string, error) {
+	format := flag
+
+	if format == "" {
+		userConfig, err := config.LoadConfigOrDefault()
+		if err != nil {
+			return "", fmt.Errorf("error reading config: %w", err)
+		}
+
+		format = userConfig.EditFormats[userConfig.ModelDeployment]
+		if format == "" {
+			format = userConfig.EditFormat
+		}
+	}
+
+	if format == "" {
+		return edits.FormatDiff, nil
+	}
+
+	if !edits.ValidFormat(format) {
+		return "", fmt.Errorf("unknown edit format %q, use %s", format, strings.Join(edits.Formats(), " or "))
+	}
+
+	return format, nil
+}
+
+// editPaths returns the paths the edits write to or remove.
+func editPaths(planned []plannedEdit) []string {
+	paths := make([]string, 0, len(planned))
+
+	for _, edit := range planned {
+		for _, path := range []string{edit.target, edit.oldTarget} {
+			if path != "" {
+				paths = append(paths, path)
+			}
+		}
+	}
+
+	return paths
+}
+
+// saveBackup keeps the copies of the files from before the edits, for cwc
+// undo. The edits stay when they can't be kept.
+func saveBackup(snapshot *backup.Backup) {
+	snapshot.RecordWritten()
+
+	dir, err := config.BackupsDir()
+	if err == nil {
+		err = backup.NewStore(dir).Save(snapshot)
+	}
+
+	if err != nil {
+		slog.Warn("could not back up the changed files, they can't be undone", "error", err)
+	}
+}
+
+// formatEdits runs the formatters of the repository on the written files. A
+// formatter that fails leaves its files as written, and so do formatters of
+// the repository config the user doesn't trust.
+func formatEdits(planned []plannedEdit) {
+	paths := make([]string, 0, len(planned))
+
+	for _, edit := range planned {
+		if edit.target != "" {
+			paths = append(paths, edit.target)
+		}
+	}
+
+	if len(paths) == 0 {
+		return
+	}
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		return
+	}
+
+	root := pathmatcher.FindRepositoryRoot(cwd)
+
+	repoConfig, err := config.LoadRepoConfig(root)
+	if err != nil {
+		slog.Warn("not formatting the written files", "error", err)
+		return
+	}
+
+	for _, command := range repoConfig.Formatters {
+		if command == "" {
+			continue
+		}
+
+		if err := confirmRepoCommands(root, repoConfig); err != nil {
+			slog.Warn("not formatting the written files", "error", err)
+			return
+		}
+
+		break
+	}
+
+	f, err := formatter.New(repoConfig.Formatters, root)
+	if err != nil {
+		slog.Warn("not formatting the written files", "error", err)
+		return
+	}
+
+	formatted, err := f.Format(paths)
+	if err != nil {
+		slog.Warn("could not format the written files", "error", err)
+	}
+
+	slog.Debug("formatted the written files", "files", len(formatted))
+}
+
+// planEdits parses the diffs in the reply and applies them in memory, with
+// the files of the context in scope. Paths that must never be written to
+// fail the whole plan.
+func planEdits(reply string, files []filetree.File) ([]plannedEdit, error) {
+	patches, err := edits.Parse(reply)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing the diff: %w", err)
+	}
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		return nil, fmt.Errorf("error getting current directory: %w", err)
+	}
+
+	paths := make([]string, 0, len(files))
+	for _, file := range files {
+		paths = append(paths, file.Path)
+	}
+
+	scope, err := edits.NewScope(pathmatcher.FindRepositoryRoot(cwd), paths)
+	if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+
+	planned := make([]plannedEdit, 0, len(patches))
+
+	for _, patch := range patches {
+		edit := plannedEdit{patch: patch}
+
+		var content []byte
+
+		if patch.OldPath != "" {
+			if edit.oldTarget, err = resolveEditPath(scope, patch.OldPath, &edit); err != nil {
+				return nil, err
+			}
+
+			if content, err = os.ReadFile(edit.oldTarget); err != nil { // #nosec
+				return nil, fmt.Errorf("error reading %s: %w", patch.OldPath, err)
+			}
+		}
+
+		if patch.NewPath != "" {
+			if edit.target, err = resolveEditPath(scope, patch.NewPath, &edit); err != nil {
+				return nil, err
+			}
+
+			if edit.target == edit.oldTarget {
+				edit.oldTarget = ""
+			} else if _, err := os.Lstat(edit.target); err == nil {
+				return nil, fmt.Errorf("%s already exists", patch.NewPath)
+			}
+		}
+
+		edit.original = string(content)
+
+		if edit.content, err = edits.Apply(string(content), &patch); err != nil {
+			return nil, err //nolint:wrapcheck
+		}
+
+		planned = append(planned, edit)
+	}
+
+	return planned, nil
+}
+
+func resolveEditPath(scope *edits.Scope, path string, edit *plannedEdit) (string, error) {
+	target, err := scope.Resolve(path)
+	if errors.IsOutOfScopeError(err) {
+		edit.outOfScope = true
+		return target, nil
+	}
+
+	return target, err //nolint:wrapcheck
+}
+
+func writeEdit(edit *plannedEdit) error {
+	if edit.target != "" {
+		mode := os.FileMode(newFilePermissions)
+		if info, err := os.Stat(edit.target); err == nil {
+			mode = info.Mode().Perm()
+		} else if info, err := os.Stat(edit.oldTarget); edit.oldTarget != "" && err == nil {
+			mode = info.Mode().Perm()
+		}
+
+		if err := os.MkdirAll(filepath.Dir(edit.target), os.ModePerm); err != nil {
+			return fmt.Errorf("error creating directory: %w", err)
+		}
+
+		if err := os.WriteFile(edit.target, []byte(edit.content), mode); err != nil {
+			return fmt.Errorf("error writing file: %w", err)
+		}
+	}
+
+	if edit.oldTarget != "" {
+		if err := os.Remove(edit.oldTarget); err != nil {
+			return fmt.Errorf("error removing file: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func editKind(patch *edits.FilePatch) string {
+	switch {
+	case patch.OldPath == "":
+		return "A"
+	case patch.NewPath == "":
+		return "D"
+	case patch.OldPath != patch.NewPath:
+		return "R"
+	default:
+		return "M"
+	}
+}
+
+// reloadFiles updates the context with the edited files, so the next turn
+// sees their new contents.
+func (s *chatSession) reloadFiles(planned []plannedEdit) {
+	files := slices.Clone(s.files)
+
+	for _, edit := range planned {
+		i := slices.IndexFunc(files, func(f filetree.File) bool {
+			return f.Path == filepath.Clean(edit.patch.OldPath) || f.Path == filepath.Clean(edit.patch.NewPath)
+		})
+		if i < 0 {
+			continue
+		}
+
+		if edit.patch.NewPath == "" {
+			files = slices.Delete(files, i, i+1)
+			continue
+		}
+
+		if file, err := filetree.LoadFile(edit.patch.NewPath); err == nil {
+			files[i] = *file
+		}
+	}
+
+	s.setFiles(files)
+}
@@ -0,0 +1,102 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/emilkje/cwc/pkg/audit"
+	"github.com/emilkje/cwc/pkg/config"
+	"github.com/emilkje/cwc/pkg/filetree"
+)
+
+// startAudit opens the audit log if it is enabled. Failing to do so is an
+// error rather than a warning, as requests must not be sent unrecorded.
+func startAudit(cfg *config.Config) error {
+	if cfg.Audit == nil || !cfg.Audit.Enabled {
+		return nil
+	}
+
+	path, err := cfg.Audit.LogPath()
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	var key []byte
+	if cfg.Audit.Encrypt && cfg.Audit.FullContent {
+		if key, err = config.EncryptionKey(); err != nil {
+			return err //nolint:wrapcheck
+		}
+	}
+
+	if err := audit.Start(path, cfg.Audit.FullContent, key); err != nil {
+		return fmt.Errorf("error starting audit log: %w", err)
+	}
+
+	cobra.OnFinalize(func() {
+		_ = audit.Stop()
+	})
+
+	return nil
+}
+
+// auditFiles records the files in the context with the following requests.
+func auditFiles(files []filetree.File) {
+	paths := make([]string, 0, len(files))
+	for _, file := range files {
+		paths = append(paths, file.Path)
+	}
+
+	audit.SetFiles(paths)
+}
+
+func createAuditCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "audit",
+		Short: "Read the audit log",
+	}
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "decrypt [file]",
+		Short: "Print the audit log with the request bodies encrypted by audit.encrypt decrypted",
+		Long: "Decrypt prints the audit log, the configured one unless another file is given, with the request\n" +
+			"bodies decrypted using the key in the keyring.",
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			path := ""
+			if len(args) > 0 {
+				path = args[0]
+			} else {
+				cfg, err := config.LoadConfigOrDefault()
+				if err != nil {
+					return fmt.Errorf("error reading config: %w", err)
+				}
+
+				auditConfig := cfg.Audit
+				if auditConfig == nil {
+					auditConfig = &config.AuditConfig{}
+				}
+
+				if path, err = auditConfig.LogPath(); err != nil {
+					return err //nolint:wrapcheck
+				}
+			}
+
+			file, err := os.Open(path)
+			if err != nil {
+				return err //nolint:wrapcheck
+			}
+			defer file.Close()
+
+			key, err := config.EncryptionKey()
+			if err != nil {
+				return err //nolint:wrapcheck
+			}
+
+			return audit.Decrypt(cmd.OutOrStdout(), file, key) //nolint:wrapcheck
+		},
+	})
+
+	return cmd
+}
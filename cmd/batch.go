@@ -0,0 +1,228 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync/atomic"
+
+	"github.com/spf13/cobra"
+
+	"github.com/emilkje/cwc/pkg/batch"
+	"github.com/emilkje/cwc/pkg/chat"
+	"github.com/emilkje/cwc/pkg/config"
+	"github.com/emilkje/cwc/pkg/providers"
+	"github.com/emilkje/cwc/pkg/ui"
+)
+
+// defaultBatchConcurrency is how many prompts are sent at once by default.
+const defaultBatchConcurrency = 4
+
+func createBatchCmd() *cobra.Command {
+	var (
+		includeFlag              string
+		excludeFlag              string
+		pathsFlag                []string
+		langFlag                 []string
+		ignoreFilesFlag          []string
+		filesFlag                []string
+		ownedByFlag              []string
+		changedSinceFlag         string
+		withDepsFlag             bool
+		workspaceFlag            string
+		excludeFromGitignoreFlag bool
+		excludeGitDirFlag        bool
+		includeThirdPartyFlag    bool
+		outputFlag               string
+		concurrencyFlag          int
+	)
+
+	cmd := &cobra.Command{
+		Use:   "batch <prompts.jsonl>",
+		Short: "Answer many prompts from a JSON lines file",
+		Long: "Batch sends each prompt of a JSON lines file with the files selected by the flags as context, and\n" +
+			"writes a line of JSON per answer to --output, in the order they complete. A line of the prompts file\n" +
+			"is an object with a prompt, an optional id copied to the result, and optional include, exclude,\n" +
+			"paths and files fields which replace the flags of the same names for that prompt. A prompt that\n" +
+			"fails is reported with an error in its result and doesn't stop the others.",
+		Example: "  cwc batch prompts.jsonl --output results.jsonl\n" +
+			"  cwc batch prompts.jsonl --concurrency 8 -i '\\.go$' > results.jsonl\n\n" +
+			"  # prompts.jsonl\n" +
+			"  {\"id\": \"config\", \"prompt\": \"Summarize this package\", \"paths\": [\"pkg/config\"]}\n" +
+			"  {\"id\": \"chat\", \"prompt\": \"Summarize this package\", \"paths\": [\"pkg/chat\"]}",
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			input, err := os.Open(args[0])
+			if err != nil {
+				return fmt.Errorf("error opening prompts: %w", err)
+			}
+			defer input.Close()
+
+			requests, err := batch.Read(input)
+			if err != nil {
+				return err //nolint:wrapcheck
+			}
+
+			output := io.Writer(os.Stdout)
+
+			if outputFlag != "" {
+				file, err := os.Create(outputFlag)
+				if err != nil {
+					return fmt.Errorf("error creating %s: %w", outputFlag, err)
+				}
+				defer file.Close()
+
+				output = file
+			}
+
+			return runBatch(requests, &chatOptions{
+				includeFlag:              includeFlag,
+				excludeFlag:              excludeFlag,
+				pathsFlag:                pathsFlag,
+				langFlag:                 langFlag,
+				ignoreFilesFlag:          ignoreFilesFlag,
+				filesFlag:                filesFlag,
+				ownedByFlag:              ownedByFlag,
+				changedSinceFlag:         changedSinceFlag,
+				withDepsFlag:             withDepsFlag,
+				workspaceFlag:            workspaceFlag,
+				excludeFromGitignoreFlag: excludeFromGitignoreFlag,
+				excludeGitDirFlag:        excludeGitDirFlag,
+				includeThirdPartyFlag:    includeThirdPartyFlag,
+			}, output, concurrencyFlag)
+		},
+	}
+
+	initFlags(cmd, &flags{
+		includeFlag:              &includeFlag,
+		excludeFlag:              &excludeFlag,
+		pathsFlag:                &pathsFlag,
+		langFlag:                 &langFlag,
+		ignoreFilesFlag:          &ignoreFilesFlag,
+		filesFlag:                &filesFlag,
+		ownedByFlag:              &ownedByFlag,
+		changedSinceFlag:         &changedSinceFlag,
+		withDepsFlag:             &withDepsFlag,
+		workspaceFlag:            &workspaceFlag,
+		excludeFromGitignoreFlag: &excludeFromGitignoreFlag,
+		excludeGitDirFlag:        &excludeGitDirFlag,
+		includeThirdPartyFlag:    &includeThirdPartyFlag,
+	})
+
+	cmd.Flags().StringVarP(&outputFlag, "output", "o", "", "the JSON lines file to write the results to, or stdout")
+	cmd.Flags().IntVar(&concurrencyFlag, "concurrency", defaultBatchConcurrency, "how many prompts to send at once")
+
+	return cmd
+}
+
+// runBatch gathers the context of each distinct selection of files once,
+// then answers the requests and writes the results as JSON lines.
+func runBatch(requests []batch.Request, base *chatOptions, output io.Writer, concurrency int) error {
+	userConfig, err := config.LoadConfigOrDefault()
+	if err != nil {
+		return fmt.Errorf("error reading config: %w", err)
+	}
+
+	filter, err := newContextFilter(userConfig)
+	if err != nil {
+		return err
+	}
+
+	contexts := make(map[string]string)
+
+	for _, request := range requests {
+		key := batchContextKey(request)
+		if _, ok := contexts[key]; ok {
+			continue
+		}
+
+		opts := *base
+
+		if request.Include != "" {
+			opts.includeFlag = request.Include
+		}
+
+		if request.Exclude != "" {
+			opts.excludeFlag = request.Exclude
+		}
+
+		if len(request.Paths) > 0 {
+			opts.pathsFlag = request.Paths
+		}
+
+		if len(request.Files) > 0 {
+			opts.filesFlag = request.Files
+		}
+
+		files, _, err := gatherContext(&opts)
+		if err != nil {
+			return fmt.Errorf("line %d: %w", request.Line, err)
+		}
+
+		contexts[key] = chat.SystemMessage(createSystemMessageFromFiles(files, filter))
+	}
+
+	clientConfig, err := newClientConfig()
+	if err != nil {
+		return err
+	}
+
+	provider := providers.New(clientConfig)
+	encoder := json.NewEncoder(output)
+	// the results may go to the terminal as well, where the progress would
+	// garble them
+	progress := ui.NewProgressLine()
+	if output == io.Writer(os.Stdout) {
+		progress = nil
+	}
+
+	var done, failed atomic.Int32
+
+	var writeErr error
+
+	batch.Run(requests, concurrency, func(request batch.Request) (string, error) {
+		prompt, summary := filter.redactPrompt(request.Prompt)
+		if summary != "" {
+			ui.PrintMessage(fmt.Sprintf("warning: redacted %s in the prompt of %s\n", summary, request.ID),
+				ui.MessageTypeWarning)
+		}
+
+		return collectReply(chat.NewSession(provider, contexts[batchContextKey(request)]), prompt)
+	}, func(result batch.Result) {
+		if result.Error != "" {
+			failed.Add(1)
+		}
+
+		if err := encoder.Encode(result); err != nil && writeErr == nil {
+			writeErr = fmt.Errorf("error writing results: %w", err)
+		}
+
+		if progress != nil {
+			progress.Update(fmt.Sprintf("answered %d/%d prompts", done.Add(1), len(requests)))
+		}
+	})
+
+	if progress != nil {
+		progress.Done()
+	}
+
+	if writeErr != nil {
+		return writeErr
+	}
+
+	if n := failed.Load(); n > 0 {
+		ui.PrintMessage(fmt.Sprintf("warning: %d of %d prompts failed, see their errors in the results\n", n, len(requests)),
+			ui.MessageTypeWarning)
+	}
+
+	return nil
+}
+
+// batchContextKey tells apart the selections of files of the requests.
+func batchContextKey(request batch.Request) string {
+	return strings.Join([]string{
+		request.Include, request.Exclude, strings.Join(request.Paths, "\x00"), strings.Join(request.Files, "\x00"),
+	}, "\x01")
+}
@@ -0,0 +1,119 @@
+package cmd
+
+import (
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/emilkje/cwc/pkg/bestof"
+	"github.com/emilkje/cwc/pkg/chat"
+	"github.com/emilkje/cwc/pkg/ui"
+)
+
+// bestOfOptions configures askBestOf.
+type bestOfOptions struct {
+	// n is the number of responses asked for.
+	n int
+	// clean tidies each response before it is judged, if given.
+	clean func(string) string
+	// problems lists what is wrong with a response, if given. Responses
+	// with problems are only picked when all of them have some.
+	problems func(string) []string
+	// choose lets the user pick the response rather than the heuristic.
+	choose bool
+}
+
+// askBestOf sends the prompt in n new sessions at once and returns one of
+// the responses: the one the user chooses, or the one agreeing most with
+// the others, see bestof.Pick.
+func askBestOf(newSession func() *chat.Session, prompt string, opts *bestOfOptions) (string, error) {
+	spinner := ui.NewSpinner(fmt.Sprintf("writing %d candidates", opts.n))
+	spinner.Start()
+
+	candidates := make([]string, opts.n)
+	errs := make([]error, opts.n)
+
+	var wg sync.WaitGroup
+
+	for i := range candidates {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			reply, err := collectReply(newSession(), prompt)
+			if opts.clean != nil {
+				reply = opts.clean(reply)
+			}
+
+			candidates[i], errs[i] = reply, err
+		}()
+	}
+
+	wg.Wait()
+	spinner.Stop()
+
+	var replies []string
+
+	for i, err := range errs {
+		if err != nil {
+			slog.Warn("candidate failed", "candidate", i+1, "error", err)
+			continue
+		}
+
+		replies = append(replies, candidates[i])
+	}
+
+	if len(replies) == 0 {
+		return "", errs[0]
+	}
+
+	var valid func(string) bool
+	if opts.problems != nil {
+		valid = func(reply string) bool { return len(opts.problems(reply)) == 0 }
+	}
+
+	suggested := bestof.Pick(replies, valid)
+
+	if !opts.choose || len(replies) == 1 {
+		return replies[suggested], nil
+	}
+
+	return chooseCandidate(replies, suggested, opts.problems), nil
+}
+
+// chooseCandidate prints the candidates and asks the user to pick one,
+// defaulting to the suggested one.
+func chooseCandidate(candidates []string, suggested int, problems func(string) []string) string {
+	for i, candidate := range candidates {
+		label := fmt.Sprintf("\n[%d]", i+1)
+		if i == suggested {
+			label += " suggested"
+		}
+
+		ui.PrintMessage(label+"\n", ui.MessageTypeInfo)
+		ui.PrintMessage(strings.TrimRight(candidate, "\n")+"\n", ui.MessageTypeNotice)
+
+		if problems != nil {
+			if found := problems(candidate); len(found) > 0 {
+				ui.PrintMessage(fmt.Sprintf("breaks the rules: %s\n", strings.Join(found, "; ")), ui.MessageTypeWarning)
+			}
+		}
+	}
+
+	for {
+		ui.PrintMessage(fmt.Sprintf("\nUse which candidate? [1-%d, enter for %d] ", len(candidates), suggested+1),
+			ui.MessageTypeInfo)
+
+		answer := ui.ReadUserInput()
+		if answer == "" {
+			return candidates[suggested]
+		}
+
+		if choice, err := strconv.Atoi(answer); err == nil && choice >= 1 && choice <= len(candidates) {
+			return candidates[choice-1]
+		}
+	}
+}
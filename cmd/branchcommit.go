@@ -0,0 +1,178 @@
+package cmd
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/emilkje/cwc/pkg/changes"
+	"github.com/emilkje/cwc/pkg/commitmsg"
+	"github.com/emilkje/cwc/pkg/pathmatcher"
+	"github.com/emilkje/cwc/pkg/sessions"
+	"github.com/emilkje/cwc/pkg/ui"
+)
+
+// branchPrefix is the prefix of the branches edits are committed to.
+const branchPrefix = "cwc/"
+
+// branchCommitter commits the edits applied in a chat to a branch named after
+// the task, see --commit-branch. The current branch, the index and the
+// working tree are left as they are.
+type branchCommitter struct {
+	// task is the first message of the chat, which names the branch.
+	task       string
+	branch     *changes.Branch
+	root       string
+	convention *commitmsg.Convention
+	subjects   []string
+}
+
+func newBranchCommitter() (*branchCommitter, error) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return nil, fmt.Errorf("error getting current directory: %w", err)
+	}
+
+	subjects := changes.Subjects(historySubjects)
+
+	convention, err := detectConvention("auto", subjects)
+	if err != nil {
+		return nil, err
+	}
+
+	return &branchCommitter{root: pathmatcher.FindRepositoryRoot(cwd), convention: convention, subjects: subjects}, nil
+}
+
+// setTask names the branch after the message unless it is named already.
+func (c *branchCommitter) setTask(message string) {
+	if c.task == "" {
+		c.task = message
+	}
+}
+
+// commit commits the files at the paths as they are now, with a message
+// written by the model, creating the branch on the first commit.
+func (c *branchCommitter) commit(paths []string) error {
+	if c.branch == nil {
+		slug := sessions.Slug(sessions.HeuristicTitle(c.task))
+		if slug == "" {
+			slug = "changes"
+		}
+
+		branch, err := changes.NewBranch(branchPrefix + slug)
+		if err != nil {
+			return err //nolint:wrapcheck
+		}
+
+		c.branch = branch
+	}
+
+	tree, diff, err := c.branch.Stage(paths)
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	if strings.TrimSpace(diff) == "" {
+		return nil
+	}
+
+	relative := c.relativePaths(paths)
+	prompt := commitmsg.Prompt(c.convention, c.subjects, commitmsg.InferType(relative),
+		commitmsg.InferScope(relative, c.convention))
+
+	message, err := c.writeMessage(diff, prompt)
+	if err != nil {
+		slog.Warn("could not write a commit message", "error", err)
+
+		message = "Update " + strings.Join(relative, ", ") + "\n"
+	}
+
+	if err := c.branch.Commit(tree, message); err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	ui.PrintMessage(fmt.Sprintf("committed to %s: %s\n", c.branch.Name, strings.SplitN(message, "\n", 2)[0]), //nolint:gomnd
+		ui.MessageTypeSuccess)
+
+	return nil
+}
+
+// finish adds a commit summarizing the commits of the branch, if there are
+// any, and tells how to review them.
+func (c *branchCommitter) finish() {
+	if c.branch == nil || !c.branch.Committed() {
+		return
+	}
+
+	commits, err := c.branch.Subjects()
+	if err == nil && len(commits) > 1 {
+		err = c.summarize(commits)
+	}
+
+	if err != nil {
+		slog.Warn("could not write the summary commit", "error", err)
+	}
+
+	ui.PrintMessage(fmt.Sprintf("the changes are committed to %s, review them with git log -p %s..%s\n",
+		c.branch.Name, c.branch.Base[:min(len(c.branch.Base), 12)], c.branch.Name), ui.MessageTypeNotice) //nolint:gomnd
+}
+
+// summarize commits a message summing up the commits of the branch, without
+// changes of its own.
+func (c *branchCommitter) summarize(commits []string) error {
+	diff, err := c.branch.Diff()
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	message, err := c.writeMessage(diff, commitmsg.SummaryPrompt(c.convention, c.subjects, commits))
+	if err != nil {
+		return err
+	}
+
+	return c.branch.Commit("", message) //nolint:wrapcheck
+}
+
+func (c *branchCommitter) writeMessage(diff, prompt string) (string, error) {
+	newSession, err := newStagedSessions("The staged changes:\n\n```diff\n" + diff + "```")
+	if err != nil {
+		return "", err
+	}
+
+	return askCommitMessage(newSession(), prompt, func(message string) []string {
+		return commitmsg.Lint(message, c.convention)
+	})
+}
+
+// relativePaths returns the paths relative to the root of the repository,
+// as the scope of a message is inferred from them.
+func (c *branchCommitter) relativePaths(paths []string) []string {
+	relative := make([]string, 0, len(paths))
+
+	for _, path := range paths {
+		if abs, err := filepath.Abs(path); err == nil {
+			if rel, err := filepath.Rel(c.root, abs); err == nil {
+				path = rel
+			}
+		}
+
+		relative = append(relative, filepath.ToSlash(path))
+	}
+
+	return relative
+}
+
+// commitEdits commits the written edits to the branch of the chat, if
+// --commit-branch is given. The edits stay written when they can't be
+// committed.
+func (s *chatSession) commitEdits(planned []plannedEdit) {
+	if s.committer == nil {
+		return
+	}
+
+	if err := s.committer.commit(editPaths(planned)); err != nil {
+		ui.PrintMessage(fmt.Sprintf("the changes were not committed: %s\n", err), ui.MessageTypeWarning)
+	}
+}
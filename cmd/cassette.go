@@ -0,0 +1,39 @@
+package cmd
+
+import (
+	stderrors "errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/spf13/cobra"
+
+	"github.com/emilkje/cwc/pkg/cassette"
+)
+
+// startCassette records the requests to the provider to a cassette, or
+// replays them from one, if either was asked for. The recorded cassette is
+// written when the command completes.
+func startCassette(recordPath, replayPath string) error {
+	switch {
+	case recordPath != "" && replayPath != "":
+		return stderrors.New("--record and --replay can't be used together")
+	case recordPath != "":
+		if err := cassette.Record(recordPath); err != nil {
+			return fmt.Errorf("error starting recording: %w", err)
+		}
+	case replayPath != "":
+		if err := cassette.Replay(replayPath); err != nil {
+			return fmt.Errorf("error starting replay: %w", err)
+		}
+	default:
+		return nil
+	}
+
+	cobra.OnFinalize(func() {
+		if err := cassette.Stop(); err != nil {
+			slog.Warn("could not write the cassette", "error", err)
+		}
+	})
+
+	return nil
+}
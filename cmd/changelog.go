@@ -0,0 +1,193 @@
+package cmd
+
+import (
+	stderrors "errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/emilkje/cwc/pkg/changelog"
+	"github.com/emilkje/cwc/pkg/changes"
+	"github.com/emilkje/cwc/pkg/chat"
+	"github.com/emilkje/cwc/pkg/config"
+	"github.com/emilkje/cwc/pkg/providers"
+	"github.com/emilkje/cwc/pkg/ui"
+)
+
+const defaultChangelogPath = "CHANGELOG.md"
+
+func createChangelogCmd() *cobra.Command {
+	var (
+		fromFlag    string
+		toFlag      string
+		versionFlag string
+		fileFlag    string
+		prependFlag bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "changelog",
+		Short: "Write changelog entries from the git history",
+		Long: "Changelog reads the commits between --from and --to, following merged pull requests as a whole, and\n" +
+			"asks the model to write changelog entries grouped under Added, Changed, Fixed, Removed and Security.\n" +
+			"The entries are printed, and with --prepend added to the top of --file once confirmed. Unreleased\n" +
+			"entries replace those already in the changelog.",
+		Example: "  cwc changelog --from v0.3.0 --to HEAD\n" +
+			"  cwc changelog --to v0.4.0 --prepend",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			release, err := newRelease(fromFlag, toFlag, versionFlag)
+			if err != nil {
+				return err
+			}
+
+			entries, err := askAboutCommits(release, changelogPrompt())
+			if err != nil {
+				return err
+			}
+
+			section := changelog.Section(release.version, release.date, entries)
+
+			fmt.Print(section) //nolint:forbidigo
+
+			if !prependFlag {
+				return nil
+			}
+
+			return prependChangelog(fileFlag, section)
+		},
+	}
+
+	cmd.Flags().StringVar(&fromFlag, "from", "", "the ref to start from, the latest tag before --to by default")
+	cmd.Flags().StringVar(&toFlag, "to", "HEAD", "the ref to end at")
+	cmd.Flags().StringVar(&versionFlag, "version", "",
+		"the version of the release, the tag at --to by default, or "+changelog.Unreleased)
+	cmd.Flags().StringVar(&fileFlag, "file", defaultChangelogPath, "the changelog to prepend the entries to")
+	cmd.Flags().BoolVar(&prependFlag, "prepend", false, "prepend the entries to the changelog after a preview")
+
+	return cmd
+}
+
+// release is the range of commits a changelog or release notes are written
+// for.
+type release struct {
+	from, to string
+	// version is the tag at to, unless given, or changelog.Unreleased.
+	version string
+	// date is the date of the tagged commit, or today.
+	date    time.Time
+	commits []changes.Commit
+}
+
+// newRelease reads the commits between from, the latest tag before to by
+// default, and to.
+func newRelease(from, to, version string) (*release, error) {
+	if from == "" {
+		tag, err := changes.LatestTag(to)
+		if err != nil {
+			return nil, fmt.Errorf("no tag before %s, use --from to set where to start", to)
+		}
+
+		from = tag
+	}
+
+	commits, err := changes.Log(from, to)
+	if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+
+	if len(commits) == 0 {
+		return nil, fmt.Errorf("no commits between %s and %s", from, to)
+	}
+
+	r := &release{from: from, to: to, version: version, date: time.Now(), commits: commits}
+
+	if version == "" {
+		r.version = changelog.Unreleased
+
+		if tag := changes.TagAt(to); tag != "" {
+			r.version = tag
+
+			if r.date, err = changes.CommitDate(to); err != nil {
+				return nil, err //nolint:wrapcheck
+			}
+		}
+	}
+
+	return r, nil
+}
+
+// askAboutCommits sends the commits of the release to the model, passing
+// them through the context filter, and returns its reply to the prompt.
+func askAboutCommits(r *release, prompt string) (string, error) {
+	userConfig, err := config.LoadConfigOrDefault()
+	if err != nil {
+		return "", fmt.Errorf("error reading config: %w", err)
+	}
+
+	filter, err := newContextFilter(userConfig)
+	if err != nil {
+		return "", err
+	}
+
+	history, ok := filter.apply("the commit messages", changelog.Commits(r.commits))
+	if !ok {
+		return "", stderrors.New("not sending the commit messages as they contain secrets")
+	}
+
+	clientConfig, err := newClientConfig()
+	if err != nil {
+		return "", err
+	}
+
+	systemMessage := chat.SystemMessage(fmt.Sprintf("Commits from %s to %s, newest first:\n\n%s", r.from, r.to, history))
+
+	spinner := ui.NewSpinner(ui.T("chat.thinking"))
+	spinner.Start()
+
+	reply, err := collectReply(chat.NewSession(providers.New(clientConfig), systemMessage), prompt)
+
+	spinner.Stop()
+
+	return reply, err
+}
+
+func changelogPrompt() string {
+	headings := make([]string, len(changelog.Categories))
+	for i, category := range changelog.Categories {
+		headings[i] = "### " + category
+	}
+
+	return "Write the changelog entries for these commits in the Keep a Changelog format. Group them under " +
+		strings.Join(headings, ", ") + ", in that order, leaving out empty groups. Write one bullet per " +
+		"user-facing change, in the past tense, and end it with the pull request number like (#123) when there " +
+		"is one. Merge commits that are part of the same change, and leave out changes that don't affect " +
+		"users, such as refactoring, tests, CI and dependency bumps, unless they fix a security issue. " +
+		"Reply with the groups only, without a release heading or code fences."
+}
+
+// prependChangelog adds the section to the top of the changelog, creating
+// it if need be, once the user confirms.
+func prependChangelog(path, section string) error {
+	existing, err := os.ReadFile(path) // #nosec
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("error reading %s: %w", path, err)
+	}
+
+	if !ui.AskYesNo(fmt.Sprintf("Prepend these entries to %s?", path), false) {
+		return nil
+	}
+
+	updated := changelog.Prepend(string(existing), section)
+
+	if err := os.WriteFile(path, []byte(updated), 0o644); err != nil { //nolint:gomnd,gosec
+		return fmt.Errorf("error writing %s: %w", path, err)
+	}
+
+	ui.PrintMessage(fmt.Sprintf("entries added to %s\n", path), ui.MessageTypeSuccess)
+
+	return nil
+}
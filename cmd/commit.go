@@ -0,0 +1,411 @@
+package cmd
+
+import (
+	stderrors "errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/emilkje/cwc/pkg/changes"
+	"github.com/emilkje/cwc/pkg/chat"
+	"github.com/emilkje/cwc/pkg/commitmsg"
+	"github.com/emilkje/cwc/pkg/config"
+	"github.com/emilkje/cwc/pkg/pathmatcher"
+	"github.com/emilkje/cwc/pkg/providers"
+	"github.com/emilkje/cwc/pkg/ui"
+)
+
+const (
+	// historySubjects is how many recent subjects the convention is
+	// detected from.
+	historySubjects = 50
+	// commitAttempts is how often a message is asked for when it breaks the
+	// rules.
+	commitAttempts = 3
+	// maxStagedDiff bounds how much of the staged diff is sent.
+	maxStagedDiff = 48000
+)
+
+var errNothingStaged = stderrors.New("nothing is staged, stage the changes to commit with git add")
+
+func createCommitCmd() *cobra.Command {
+	var (
+		conventionalFlag string
+		printFlag        bool
+		splitFlag        bool
+		nFlag            int
+	)
+
+	cmd := &cobra.Command{
+		Use:   "commit",
+		Short: "Write a commit message for the staged changes and commit them",
+		Long: "Commit sends the staged diff to the model and asks for a commit message in the style of the recent\n" +
+			"history. When the history follows Conventional Commits, or the repository configures commitlint, the\n" +
+			"type and scope are inferred from the changed paths and the scopes used before, and the message is\n" +
+			"checked against commitlint's conventional rules, asking again when it breaks them. The message is\n" +
+			"committed once confirmed, or printed with --print.\n\n" +
+			"With --split, the model groups the staged hunks into commits of a single concern each, with a\n" +
+			"message for each. Once confirmed, the commits are created one after the other by staging their hunks,\n" +
+			"leaving the working tree as it is.\n\n" +
+			"With --n, several messages are written at once and offered to choose from, the one agreeing most\n" +
+			"with the others suggested. With --print, that one is printed.",
+		Example: "  git add -p && cwc commit\n" +
+			"  cwc commit --conventional never --print\n" +
+			"  git add -A && cwc commit --split\n" +
+			"  cwc commit --n 3",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			subjects := changes.Subjects(historySubjects)
+
+			convention, err := detectConvention(conventionalFlag, subjects)
+			if err != nil {
+				return err
+			}
+
+			if splitFlag {
+				return splitCommits(convention, subjects, printFlag)
+			}
+
+			message, err := writeCommitMessage(convention, subjects, nFlag, !printFlag)
+			if err != nil {
+				return err
+			}
+
+			if printFlag {
+				fmt.Print(message) //nolint:forbidigo
+				return nil
+			}
+
+			ui.PrintMessage("\n"+message+"\n", ui.MessageTypeNotice)
+
+			if !ui.AskYesNo("Commit with this message?", true) {
+				ui.PrintMessage("nothing was committed\n", ui.MessageTypeInfo)
+				return nil
+			}
+
+			return changes.CommitStaged(message) //nolint:wrapcheck
+		},
+	}
+
+	cmd.Flags().StringVar(&conventionalFlag, "conventional", "auto",
+		"whether to follow Conventional Commits: auto, detected from the history, always or never")
+	cmd.Flags().BoolVar(&printFlag, "print", false, "print the message instead of committing")
+	cmd.Flags().BoolVar(&splitFlag, "split", false, "split the staged changes into commits of a single concern each")
+	cmd.Flags().IntVar(&nFlag, "n", 1, "write this many messages to choose from")
+
+	return cmd
+}
+
+// detectConvention returns the convention of the repository, unless forced
+// by --conventional.
+func detectConvention(mode string, subjects []string) (*commitmsg.Convention, error) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return nil, fmt.Errorf("error getting current directory: %w", err)
+	}
+
+	convention := commitmsg.Detect(subjects, commitmsg.UsesCommitlint(pathmatcher.FindRepositoryRoot(cwd)))
+
+	switch mode {
+	case "auto":
+	case "always":
+		convention.Conventional = true
+	case "never":
+		convention.Conventional = false
+	default:
+		return nil, fmt.Errorf("unknown value %q for --conventional, use auto, always or never", mode)
+	}
+
+	return convention, nil
+}
+
+// writeCommitMessage asks for the message of the staged changes in the style
+// of the subjects, asking again with the rules it breaks until it passes.
+// With n above 1, it picks from n messages, letting the user choose if
+// choose is set.
+func writeCommitMessage(convention *commitmsg.Convention, subjects []string, n int, choose bool) (string, error) {
+	paths, err := changes.Staged()
+	if err != nil {
+		return "", err //nolint:wrapcheck
+	}
+
+	if len(paths) == 0 {
+		return "", errNothingStaged
+	}
+
+	diff, err := changes.StagedDiff()
+	if err != nil {
+		return "", err //nolint:wrapcheck
+	}
+
+	newSession, err := newStagedSessions("The staged changes:\n\n```diff\n" + diff + "```")
+	if err != nil {
+		return "", err
+	}
+
+	prompt := commitmsg.Prompt(convention, subjects, commitmsg.InferType(paths), commitmsg.InferScope(paths, convention))
+
+	lint := func(message string) []string { return commitmsg.Lint(message, convention) }
+
+	if n > 1 {
+		message, err := askBestOf(newSession, prompt, &bestOfOptions{
+			n:        n,
+			clean:    commitmsg.Clean,
+			problems: lint,
+			choose:   choose,
+		})
+		if err != nil {
+			return "", err
+		}
+
+		// a message chosen by the user is taken as is, otherwise one breaking
+		// the rules means all of them do, so ask again as below
+		if choose || len(lint(message)) == 0 {
+			return message, nil
+		}
+	}
+
+	return askCommitMessage(newSession(), prompt, lint)
+}
+
+// askCommitMessage asks for a commit message, asking again with the rules it
+// breaks until it passes.
+func askCommitMessage(session *chat.Session, prompt string, lint func(string) []string) (string, error) {
+	var problems []string
+
+	for attempt := 1; attempt <= commitAttempts; attempt++ {
+		reply, err := askWithSpinner(session, prompt)
+		if err != nil {
+			return "", err
+		}
+
+		message := commitmsg.Clean(reply)
+
+		if problems = lint(message); len(problems) == 0 {
+			return message, nil
+		}
+
+		ui.PrintMessage(fmt.Sprintf("the message breaks the rules: %s\n", strings.Join(problems, "; ")),
+			ui.MessageTypeWarning)
+
+		prompt = "The message breaks these rules:\n- " + strings.Join(problems, "\n- ") +
+			"\n\nWrite it again following them, and reply with the message only."
+	}
+
+	return "", fmt.Errorf("no message following the rules after %d attempts: %s", commitAttempts, strings.Join(problems, "; "))
+}
+
+// newStagedSession starts a session with the staged changes as its context,
+// passed through the context filter.
+func newStagedSession(staged string) (*chat.Session, error) {
+	newSession, err := newStagedSessions(staged)
+	if err != nil {
+		return nil, err
+	}
+
+	return newSession(), nil
+}
+
+// newStagedSessions returns a function starting sessions with the staged
+// changes as their context, for asking the same question more than once.
+func newStagedSessions(staged string) (func() *chat.Session, error) {
+	if len(staged) > maxStagedDiff {
+		staged = staged[:maxStagedDiff] + "\n[truncated]\n"
+	}
+
+	userConfig, err := config.LoadConfigOrDefault()
+	if err != nil {
+		return nil, fmt.Errorf("error reading config: %w", err)
+	}
+
+	filter, err := newContextFilter(userConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	staged, ok := filter.apply("the staged diff", staged)
+	if !ok {
+		return nil, stderrors.New("not sending the staged diff as it contains secrets")
+	}
+
+	clientConfig, err := newClientConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	provider := providers.New(clientConfig)
+
+	return func() *chat.Session {
+		return chat.NewSession(provider, chat.SystemMessage(staged))
+	}, nil
+}
+
+func askWithSpinner(session *chat.Session, prompt string) (string, error) {
+	spinner := ui.NewSpinner(ui.T("chat.thinking"))
+	spinner.Start()
+
+	reply, err := collectReply(session, prompt)
+
+	spinner.Stop()
+
+	return reply, err
+}
+
+// splitCommits asks how to split the staged hunks into commits and creates
+// them once confirmed.
+func splitCommits(convention *commitmsg.Convention, subjects []string, printOnly bool) error {
+	patch, err := changes.StagedPatch()
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	hunks := commitmsg.ParseHunks(patch)
+	if len(hunks) == 0 {
+		return errNothingStaged
+	}
+
+	var described strings.Builder
+
+	described.WriteString("The staged changes, split into hunks:\n\n```diff\n")
+
+	for i := range hunks {
+		described.WriteString(hunks[i].String())
+	}
+
+	described.WriteString("```")
+
+	session, err := newStagedSession(described.String())
+	if err != nil {
+		return err
+	}
+
+	commits, err := planSplit(session, convention, subjects, len(hunks))
+	if err != nil {
+		return err
+	}
+
+	var plan strings.Builder
+
+	for i, commit := range commits {
+		header, _, _ := strings.Cut(commit.Message, "\n")
+		fmt.Fprintf(&plan, "%d. %s\n", i+1, header)
+
+		for _, id := range commit.Hunks {
+			fmt.Fprintf(&plan, "     [%d] %s\n", id, hunks[id-1].Path)
+		}
+	}
+
+	if printOnly {
+		for i, commit := range commits {
+			if i > 0 {
+				fmt.Println() //nolint:forbidigo
+			}
+
+			fmt.Printf("# hunks %v\n%s", commit.Hunks, commit.Message) //nolint:forbidigo
+		}
+
+		return nil
+	}
+
+	ui.PrintMessage("\n"+plan.String()+"\n", ui.MessageTypeNotice)
+
+	if !ui.AskYesNo(fmt.Sprintf("Create these %d commits?", len(commits)), true) {
+		ui.PrintMessage("nothing was committed\n", ui.MessageTypeInfo)
+		return nil
+	}
+
+	return createSplitCommits(hunks, commits)
+}
+
+// planSplit asks for the split, asking again with what is wrong with it
+// until every hunk is in a commit and the messages follow the rules.
+func planSplit(session *chat.Session, convention *commitmsg.Convention, subjects []string, hunks int) (
+	[]commitmsg.SplitCommit, error,
+) {
+	prompt := commitmsg.SplitPrompt(convention, subjects)
+
+	var problems []string
+
+	for attempt := 1; attempt <= commitAttempts; attempt++ {
+		reply, err := askWithSpinner(session, prompt)
+		if err != nil {
+			return nil, err
+		}
+
+		commits, err := commitmsg.ParseSplit(reply, hunks)
+
+		problems = nil
+
+		if err != nil {
+			problems = append(problems, err.Error())
+		}
+
+		for i, commit := range commits {
+			for _, problem := range commitmsg.Lint(commit.Message, convention) {
+				problems = append(problems, fmt.Sprintf("commit %d: %s", i+1, problem))
+			}
+		}
+
+		if len(problems) == 0 {
+			return commits, nil
+		}
+
+		ui.PrintMessage(fmt.Sprintf("the split breaks the rules: %s\n", strings.Join(problems, "; ")),
+			ui.MessageTypeWarning)
+
+		prompt = "The split breaks these rules:\n- " + strings.Join(problems, "\n- ") +
+			"\n\nSplit the hunks again following them, and reply with the JSON array only."
+	}
+
+	return nil, fmt.Errorf("no split following the rules after %d attempts: %s", commitAttempts, strings.Join(problems, "; "))
+}
+
+// createSplitCommits empties the index and creates the commits one by one,
+// staging their hunks. If one fails, the hunks of the rest are staged again.
+func createSplitCommits(hunks []commitmsg.Hunk, commits []commitmsg.SplitCommit) error {
+	if err := changes.Unstage(); err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	for i, commit := range commits {
+		selected := make([]commitmsg.Hunk, 0, len(commit.Hunks))
+		for _, id := range commit.Hunks {
+			selected = append(selected, hunks[id-1])
+		}
+
+		err := changes.Stage(commitmsg.Patch(selected))
+		if err == nil {
+			err = changes.CommitStaged(commit.Message)
+		}
+
+		if err != nil {
+			var rest []commitmsg.Hunk
+			for _, later := range commits[i:] {
+				for _, id := range later.Hunks {
+					rest = append(rest, hunks[id-1])
+				}
+			}
+
+			if restoreErr := restageHunks(rest); restoreErr != nil {
+				slog.Warn("could not restage the remaining changes, stage them again with git add", "error", restoreErr)
+			}
+
+			return fmt.Errorf("created %d of %d commits, the rest of the changes are staged: %w", i, len(commits), err)
+		}
+	}
+
+	ui.PrintMessage(fmt.Sprintf("created %d commits\n", len(commits)), ui.MessageTypeSuccess)
+
+	return nil
+}
+
+func restageHunks(hunks []commitmsg.Hunk) error {
+	if err := changes.Unstage(); err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	return changes.Stage(commitmsg.Patch(hunks)) //nolint:wrapcheck
+}
@@ -0,0 +1,177 @@
+package cmd
+
+import (
+	stderrors "errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/emilkje/cwc/pkg/annotations"
+	"github.com/emilkje/cwc/pkg/config"
+	"github.com/emilkje/cwc/pkg/pathmatcher"
+	"github.com/emilkje/cwc/pkg/ui"
+)
+
+func createConfigCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "config",
+		Short: "Validate the configuration files or print their schema",
+	}
+
+	cmd.AddCommand(createConfigValidateCmd())
+	cmd.AddCommand(createConfigSchemaCmd())
+
+	return cmd
+}
+
+func createConfigValidateCmd() *cobra.Command {
+	var formatFlag string
+
+	cmd := &cobra.Command{
+		Use:   "validate [file...]",
+		Short: "Report unknown keys, type errors and deprecated fields in the configuration files",
+		Long: `Validate checks cwc.json and the .cwc/config.yaml of the current repository
+against their schemas, or the given files, which are told apart by their extension.
+Problems are reported with their line and column, or as GitHub Actions
+annotations with --format github-annotations.`,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := validateFormat(formatFlag); err != nil {
+				return err
+			}
+
+			files := args
+			if len(files) == 0 {
+				defaults, err := defaultConfigFiles()
+				if err != nil {
+					return err
+				}
+
+				files = defaults
+			}
+
+			total := 0
+
+			for _, file := range files {
+				count, err := validateConfigFile(file, formatFlag)
+				if err != nil {
+					return err
+				}
+
+				total += count
+			}
+
+			if total == 1 {
+				return stderrors.New("found 1 problem")
+			}
+
+			if total > 1 {
+				return fmt.Errorf("found %d problems", total)
+			}
+
+			ui.PrintMessage("the configuration is valid\n", ui.MessageTypeSuccess)
+
+			return nil
+		},
+	}
+
+	addFormatFlag(cmd, &formatFlag)
+
+	return cmd
+}
+
+func createConfigSchemaCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:       "schema [user|repo]",
+		Short:     "Print the JSON Schema of cwc.json or .cwc/config.yaml for editor autocompletion",
+		Args:      cobra.MaximumNArgs(1),
+		ValidArgs: []string{"user", "repo"},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			schema := config.UserConfigSchema
+			if len(args) > 0 {
+				switch args[0] {
+				case "user":
+				case "repo":
+					schema = config.RepoConfigSchema
+				default:
+					return fmt.Errorf("unknown schema %q, use user or repo", args[0])
+				}
+			}
+
+			_, err := cmd.OutOrStdout().Write(schema)
+
+			return err //nolint:wrapcheck
+		},
+	}
+}
+
+// defaultConfigFiles returns the configuration files that exist: cwc.json and
+// the configuration of the current repository.
+func defaultConfigFiles() ([]string, error) {
+	userPath, err := config.UserConfigPath()
+	if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		return nil, fmt.Errorf("error getting current directory: %w", err)
+	}
+
+	repoPath := filepath.Join(pathmatcher.FindRepositoryRoot(cwd), config.RepoConfigPath)
+
+	var files []string
+
+	for _, path := range []string{userPath, repoPath} {
+		if _, err := os.Stat(path); err == nil {
+			files = append(files, path)
+		}
+	}
+
+	if len(files) == 0 {
+		return nil, stderrors.New("there are no configuration files to validate")
+	}
+
+	return files, nil
+}
+
+// validateConfigFile prints the problems in the file in the format and
+// returns their number.
+func validateConfigFile(path, format string) (int, error) {
+	data, err := os.ReadFile(path) // #nosec
+	if err != nil {
+		return 0, fmt.Errorf("error reading %s: %w", path, err)
+	}
+
+	validate := config.ValidateUserConfig
+	if ext := strings.ToLower(filepath.Ext(path)); ext == ".yaml" || ext == ".yml" {
+		validate = config.ValidateRepoConfig
+	}
+
+	problems, err := validate(data)
+	if err != nil {
+		return 0, err //nolint:wrapcheck
+	}
+
+	for _, problem := range problems {
+		if format == formatGitHubAnnotations {
+			printAnnotation(&annotations.Annotation{
+				Level:   annotations.Error,
+				File:    path,
+				Line:    problem.Line,
+				Column:  problem.Column,
+				Title:   "cwc config validate",
+				Message: problem.Message,
+			})
+
+			continue
+		}
+
+		ui.PrintMessage(fmt.Sprintf("%s:%s\n", path, problem), ui.MessageTypeError)
+	}
+
+	return len(problems), nil
+}
@@ -4,17 +4,33 @@ import (
 	stderrors "errors"
 	"fmt"
 	"io"
+	"log/slog"
 	"os"
+	"path/filepath"
+	"slices"
+	"sort"
 	"strings"
+	"time"
 
+	"github.com/mattn/go-runewidth"
 	"github.com/sashabaranov/go-openai"
 	"github.com/spf13/cobra"
 
+	"github.com/emilkje/cwc/pkg/changes"
 	"github.com/emilkje/cwc/pkg/chat"
 	"github.com/emilkje/cwc/pkg/config"
+	"github.com/emilkje/cwc/pkg/datasample"
 	"github.com/emilkje/cwc/pkg/errors"
 	"github.com/emilkje/cwc/pkg/filetree"
+	"github.com/emilkje/cwc/pkg/highlight"
+	"github.com/emilkje/cwc/pkg/hooks"
+	"github.com/emilkje/cwc/pkg/interpolate"
+	"github.com/emilkje/cwc/pkg/languages"
 	"github.com/emilkje/cwc/pkg/pathmatcher"
+	"github.com/emilkje/cwc/pkg/perf"
+	"github.com/emilkje/cwc/pkg/providers"
+	"github.com/emilkje/cwc/pkg/repomap"
+	"github.com/emilkje/cwc/pkg/tui"
 	"github.com/emilkje/cwc/pkg/ui"
 )
 
@@ -27,9 +43,10 @@ It allows for specification of paths to include or exclude files from the chat c
 Features at a glance:
 
 - Regex-based file inclusion and exclusion patterns
-- .gitignore integration for ignoring files
+- .gitignore and .hgignore integration for ignoring files
 - Option to specify directories for inclusion scope
 - Interactive file selection and confirmation
+- Optional full-screen chat interface (--tui)
 - Reading from standard input for a non-interactive session
 
 The command can also receive context from standard input, useful for piping the output from another command as input.
@@ -51,8 +68,40 @@ func CreateRootCommand() *cobra.Command {
 		includeFlag              string
 		excludeFlag              string
 		pathsFlag                []string
+		langFlag                 []string
+		ignoreFilesFlag          []string
+		filesFlag                []string
+		ownedByFlag              []string
+		changedSinceFlag         string
+		withDepsFlag             bool
+		workspaceFlag            string
 		excludeFromGitignoreFlag bool
 		excludeGitDirFlag        bool
+		includeThirdPartyFlag    bool
+		tuiFlag                  bool
+		noColorFlag              bool
+		preferences              preferenceFlags
+		userConfig               *config.Config
+		profilePerfFlag          string
+		offlineFlag              bool
+		recordFlag               string
+		replayFlag               string
+		sampling                 samplingFlags
+		mapFlag                  bool
+		ragFlag                  bool
+		ragChunksFlag            int
+		rerankFlag               string
+		strategyFlag             string
+		nFlag                    int
+		prefillFlag              string
+		outputFlag               string
+		outputCodeOnlyFlag       string
+		writeFilesFlag           bool
+		verifyFlag               string
+		commitBranchFlag         bool
+		editFormatFlag           string
+		dryRunFlag               string
+		logOptions               logFlags
 	)
 
 	loginCmd := createLoginCmd()
@@ -63,7 +112,42 @@ func CreateRootCommand() *cobra.Command {
 		Short: "starts a new chat session",
 		Long:  longDescription,
 		Args:  cobra.MaximumNArgs(1),
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			if noColorFlag {
+				ui.DisableColors()
+			}
+
+			if err := startLogging(cmd, logOptions); err != nil {
+				return err
+			}
+
+			userConfig = applyUserPreferences(preferences)
+
+			if offlineFlag {
+				config.SetOffline(userConfig.LocalEndpoints)
+			}
+
+			if profilePerfFlag != "" {
+				startProfiling(profilePerfFlag)
+			}
+
+			if err := startCassette(recordFlag, replayFlag); err != nil {
+				return err
+			}
+
+			startTelemetry(cmd, userConfig)
+
+			return startAudit(userConfig)
+		},
 		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := validDryRunFormat(dryRunFlag); err != nil {
+				return err
+			}
+
+			if dryRunFlag != "" {
+				config.SetDryRun()
+			}
+
 			if isPiped(os.Stdin) {
 				// stdin is not a terminal, typically piped from another command
 				if len(args) == 0 {
@@ -78,15 +162,158 @@ func CreateRootCommand() *cobra.Command {
 				}
 				systemContext = string(inputBytes)
 
-				return nonInteractive(systemContext, args[0])
+				filter, err := newContextFilter(userConfig)
+				if err != nil {
+					return err
+				}
+
+				systemContext, ok := filter.apply("the piped input", systemContext)
+				if !ok {
+					return stderrors.New("not sending the piped input as it contains secrets")
+				}
+
+				hookRunner, err := newRepoHooks()
+				if err != nil {
+					return err
+				}
+
+				// stdin is taken, so commands can't be confirmed
+				prompt, err := hookRunner.PreSend(expandPrompt(args[0], nil, false))
+				if err != nil {
+					return err //nolint:wrapcheck
+				}
+
+				prompt, summary := filter.redactPrompt(prompt)
+				if summary != "" {
+					ui.PrintMessage(fmt.Sprintf("warning: redacted %s in the prompt\n", summary), ui.MessageTypeWarning)
+				}
+
+				return nonInteractive(systemContext, prompt, &chatOptions{
+					params:         samplingParameters(cmd, &sampling, userConfig),
+					tools:          pluginTools(userConfig, filter),
+					hooks:          hookRunner,
+					logProbsFile:   sampling.logProbs,
+					bestOf:         nFlag,
+					prefill:        unescapeFlag(prefillFlag),
+					output:         outputFlag,
+					outputCodeOnly: outputCodeOnlyFlag,
+					recorder:       newSessionRecorder(userConfig),
+					dryRun:         dryRunFlag,
+				})
+			}
+
+			filter, err := newContextFilter(userConfig)
+			if err != nil {
+				return err
+			}
+
+			if mapFlag {
+				filter.repoMap = true
+			}
+
+			hookRunner, err := newRepoHooks()
+			if err != nil {
+				return err
+			}
+
+			verify, err := newVerifier(verifyFlag)
+			if err != nil {
+				return err
+			}
+
+			editFormat, err := resolveEditFormat(editFormatFlag)
+			if err != nil {
+				return err
+			}
+
+			var committer *branchCommitter
+			if commitBranchFlag {
+				if committer, err = newBranchCommitter(); err != nil {
+					return err
+				}
+			}
+
+			if (outputFlag != "" || outputCodeOnlyFlag != "") && strategyFlag != strategyMapReduce {
+				return stderrors.New("--output and --output-code-only require a piped prompt or --strategy map-reduce")
+			}
+
+			if dryRunFlag != "" {
+				if len(args) == 0 {
+					return &errors.NoPromptProvidedError{Message: "--dry-run requires a prompt"}
+				}
+
+				// both send requests of their own before the prompt is sent
+				if ragFlag || strategyFlag == strategyMapReduce {
+					return stderrors.New("--dry-run can't be combined with --rag or --strategy map-reduce")
+				}
+			}
+
+			switch strategyFlag {
+			case strategySingle:
+			case strategyMapReduce:
+				if len(args) == 0 {
+					return &errors.NoPromptProvidedError{Message: "--strategy map-reduce requires a prompt"}
+				}
+			default:
+				return fmt.Errorf("unknown strategy %q, use %q or %q", strategyFlag, strategySingle, strategyMapReduce)
+			}
+
+			var ragQuery string
+
+			if ragFlag {
+				if len(args) == 0 {
+					return &errors.NoPromptProvidedError{Message: "--rag requires a prompt to retrieve context for"}
+				}
+
+				ragQuery = args[0]
+			}
+
+			rerank := userConfig.Rerank
+			if cmd.Flags().Changed("rerank") {
+				var override config.RerankConfig
+				if rerank != nil {
+					override = *rerank
+				}
+
+				override.Method = rerankFlag
+				rerank = &override
 			}
 
 			gatherOpts := &chatOptions{
 				includeFlag:              includeFlag,
 				excludeFlag:              excludeFlag,
 				pathsFlag:                pathsFlag,
+				langFlag:                 langFlag,
+				ignoreFilesFlag:          ignoreFilesFlag,
+				filesFlag:                filesFlag,
+				ownedByFlag:              ownedByFlag,
+				changedSinceFlag:         changedSinceFlag,
+				withDepsFlag:             withDepsFlag,
+				workspaceFlag:            workspaceFlag,
 				excludeFromGitignoreFlag: excludeFromGitignoreFlag,
 				excludeGitDirFlag:        excludeGitDirFlag,
+				includeThirdPartyFlag:    includeThirdPartyFlag,
+				tuiFlag:                  tuiFlag,
+				showStats:                userConfig.ShowStats,
+				filter:                   filter,
+				params:                   samplingParameters(cmd, &sampling, userConfig),
+				tools:                    pluginTools(userConfig, filter),
+				hooks:                    hookRunner,
+				stableOrder:              sampling.deterministic,
+				ragQuery:                 ragQuery,
+				ragChunks:                ragChunksFlag,
+				rerank:                   rerank,
+				strategy:                 strategyFlag,
+				logProbsFile:             sampling.logProbs,
+				prefill:                  unescapeFlag(prefillFlag),
+				output:                   outputFlag,
+				outputCodeOnly:           outputCodeOnlyFlag,
+				writeFiles:               writeFilesFlag,
+				verifier:                 verify,
+				editFormat:               editFormat,
+				committer:                committer,
+				recorder:                 newSessionRecorder(userConfig),
+				dryRun:                   dryRunFlag,
 			}
 
 			return interactiveChat(cmd, args, gatherOpts, loginCmd)
@@ -97,12 +324,122 @@ func CreateRootCommand() *cobra.Command {
 		includeFlag:              &includeFlag,
 		excludeFlag:              &excludeFlag,
 		pathsFlag:                &pathsFlag,
+		langFlag:                 &langFlag,
+		ignoreFilesFlag:          &ignoreFilesFlag,
+		filesFlag:                &filesFlag,
+		ownedByFlag:              &ownedByFlag,
+		changedSinceFlag:         &changedSinceFlag,
+		withDepsFlag:             &withDepsFlag,
+		workspaceFlag:            &workspaceFlag,
 		excludeFromGitignoreFlag: &excludeFromGitignoreFlag,
 		excludeGitDirFlag:        &excludeGitDirFlag,
+		includeThirdPartyFlag:    &includeThirdPartyFlag,
+		tuiFlag:                  &tuiFlag,
 	})
 
+	cmd.Flags().BoolVar(&sampling.deterministic, "deterministic", false,
+		"Make responses as reproducible as possible: temperature 0, a fixed seed and files in a stable order")
+	cmd.Flags().IntVar(&sampling.seed, "seed", chat.DeterministicSeed,
+		"Ask the model to sample deterministically with the given seed")
+	cmd.Flags().StringVar(&sampling.logProbs, "logprobs", "",
+		"Ask for the log probabilities of the tokens of each response and append them, with the prompt and the "+
+			"response, as a line of JSON to the given file. Responses are then received in full rather than streamed")
+	cmd.Flags().IntVar(&sampling.topLogProbs, "top-logprobs", 0,
+		"The number of most likely alternatives, up to 5, recorded for each token with --logprobs")
+	cmd.Flags().StringVar(&prefillFlag, "prefill", "",
+		"Begin every response with the given text and have the model continue from it, e.g. '```diff' for "+
+			"answers that are a diff only. Escapes such as \\n are interpreted")
+	cmd.Flags().StringVar(&outputFlag, "output", "",
+		"With a piped prompt, also write the answer to the given file")
+	cmd.Flags().StringVar(&outputCodeOnlyFlag, "output-code-only", "",
+		"With a piped prompt, write the code of the fenced blocks of the answer to the given file")
+	cmd.Flags().BoolVar(&writeFilesFlag, "write-files", false,
+		"After each response, offer to write its code blocks annotated with a path, such as ```go title=main.go, "+
+			"to their files. /write does the same on demand")
+	cmd.Flags().StringVar(&verifyFlag, "verify", "",
+		"Run the given shell command, such as 'go build ./...', after edits are applied and send its output to "+
+			"the model for a fix when it fails. Defaults to verify.command in .cwc/config.yaml")
+	cmd.Flags().StringVar(&editFormatFlag, "edit-format", "",
+		"How fixes are asked for when --verify fails: diff for unified diffs or search-replace for blocks of the "+
+			"lines to replace and their replacement. Defaults to the format set for the model in the config file. "+
+			"/apply takes either")
+	cmd.Flags().BoolVar(&commitBranchFlag, "commit-branch", false,
+		"Commit the edits applied in the chat to a new branch, cwc/<task>, named after the first message, with "+
+			"messages written by the model and a final commit summarizing them. The current branch, the index and "+
+			"the working tree are left as they are")
+	cmd.Flags().StringVar(&dryRunFlag, "dry-run", "",
+		"Print the request the prompt would send, with the system message, the context, the prompt, the "+
+			"deployment and the parameters, and exit without sending it. Use --dry-run=json for JSON, or "+
+			"--dry-run=request.json to write the JSON to a file")
+	cmd.Flags().Lookup("dry-run").NoOptDefVal = dryRunText
+	cmd.Flags().IntVar(&nFlag, "n", 1,
+		"With a piped prompt, ask for this many responses at once and print the one agreeing most with the others, "+
+			"to even out the variance of short generations")
+	cmd.Flags().StringArrayVar(&sampling.stop, "stop", nil,
+		"Stop generating at the given sequence, which is left out of the response. Can be repeated, up to "+
+			"4 times. Overrides stop in the config file")
+	cmd.Flags().BoolVar(&mapFlag, "map", false,
+		"Include an overview of the repository in the context: its directories, and its files ranked by "+
+			"importance with their exported symbols, see cwc map")
+
+	cmd.Flags().BoolVar(&ragFlag, "rag", false,
+		"Include only the files holding the chunks of the index most relevant to the prompt, found by "+
+			"combining semantic and keyword search, see cwc index")
+	cmd.Flags().IntVar(&ragChunksFlag, "rag-chunks", defaultRAGChunks, "The number of chunks retrieved with --rag")
+	cmd.Flags().StringVar(&rerankFlag, "rerank", "",
+		"Reorder the chunks retrieved with --rag by a closer reading before the best are kept: llm, cross-encoder "+
+			"or off. Overrides rerank.method in the config file")
+
+	cmd.Flags().StringVar(&strategyFlag, "strategy", strategySingle,
+		"How the prompt is answered: single sends every file in one request, map-reduce asks about each part "+
+			"of the files that fits the context window and then combines the partial answers, for questions about "+
+			"the whole of a repository too large for any window")
+
+	cmd.PersistentFlags().BoolVar(&noColorFlag, "no-color", false,
+		"Disable colored output. Colors are also disabled when NO_COLOR is set or stdout is not a terminal")
+	cmd.PersistentFlags().BoolVar(&preferences.ascii, "ascii", false,
+		"Replace emoji and other unicode glyphs with ASCII, e.g. 'You:' and 'AI:' instead of 👤 and 🤖")
+	cmd.PersistentFlags().DurationVar(&preferences.notifyAfter, "notify-after", 0,
+		"Notify when a response takes longer than the given duration, e.g. 30s. "+
+			"The terminal bell is used unless another method is configured")
+
+	cmd.PersistentFlags().StringVar(&preferences.language, "ui-lang", "",
+		"The language of the messages, e.g. nb or de. Defaults to the language of the environment")
+
+	cmd.PersistentFlags().BoolVar(&offlineFlag, "offline", false,
+		"Refuse all network connections except to loopback addresses and localEndpoints from the config file")
+
+	cmd.PersistentFlags().StringVar(&recordFlag, "record", "",
+		"Record the requests to the provider and their responses to the given file, with API keys and other secrets "+
+			"scrubbed, to replay them later with --replay")
+	cmd.PersistentFlags().StringVar(&replayFlag, "replay", "",
+		"Answer the requests to the provider from a file written with --record instead of the network")
+
+	addLogFlags(cmd, &logOptions)
+
+	cmd.PersistentFlags().StringVar(&profilePerfFlag, "profile-perf", "",
+		"Write CPU and heap profiles, an execution trace and a timing breakdown to the given directory")
+	_ = cmd.PersistentFlags().MarkHidden("profile-perf")
+
 	cmd.AddCommand(loginCmd)
 	cmd.AddCommand(logoutCmd)
+	cmd.AddCommand(createIndexCmd())
+	cmd.AddCommand(createMapCmd())
+	cmd.AddCommand(createDiagramCmd())
+	cmd.AddCommand(createSummarizeCmd())
+	cmd.AddCommand(createBatchCmd())
+	cmd.AddCommand(createSessionsCmd())
+	cmd.AddCommand(createAuditCmd())
+	cmd.AddCommand(createUndoCmd())
+	cmd.AddCommand(createChangelogCmd())
+	cmd.AddCommand(createReleaseNotesCmd())
+	cmd.AddCommand(createFixCmd())
+	cmd.AddCommand(createExplainErrorCmd())
+	cmd.AddCommand(createLintTriageCmd())
+	cmd.AddCommand(createCommitCmd())
+	cmd.AddCommand(createSemverCmd())
+	cmd.AddCommand(createWhyCmd())
+	cmd.AddCommand(createConfigCmd())
 
 	return cmd
 }
@@ -111,17 +448,40 @@ type flags struct {
 	includeFlag              *string
 	excludeFlag              *string
 	pathsFlag                *[]string
+	langFlag                 *[]string
+	ignoreFilesFlag          *[]string
+	filesFlag                *[]string
+	ownedByFlag              *[]string
+	changedSinceFlag         *string
+	withDepsFlag             *bool
+	workspaceFlag            *string
 	excludeFromGitignoreFlag *bool
 	excludeGitDirFlag        *bool
+	includeThirdPartyFlag    *bool
+	tuiFlag                  *bool
 }
 
 func initFlags(cmd *cobra.Command, flags *flags) {
 	cmd.Flags().StringVarP(flags.includeFlag, "include", "i", ".*", "a regular expression to match files to include")
 	cmd.Flags().StringVarP(flags.excludeFlag, "exclude", "x", "", "a regular expression to match files to exclude")
 	cmd.Flags().StringSliceVarP(flags.pathsFlag, "paths", "p", []string{"."}, "a list of paths to search for files")
+	cmd.Flags().StringSliceVar(flags.langFlag, "lang", nil, "a list of languages to include files of")
 	cmd.Flags().BoolVarP(flags.excludeFromGitignoreFlag,
 		"exclude-from-gitignore", "e", true, "exclude files from .gitignore")
 	cmd.Flags().BoolVarP(flags.excludeGitDirFlag, "exclude-git-dir", "g", true, "exclude the .git directory")
+	cmd.Flags().BoolVar(flags.includeThirdPartyFlag, "include-third-party", false, "include vendored third-party code")
+	cmd.Flags().StringSliceVar(flags.ignoreFilesFlag, "ignore-file", nil, "exclude files from the given ignore files")
+	cmd.Flags().StringSliceVarP(flags.filesFlag, "file", "f", nil, "a list of files to include")
+	cmd.Flags().StringSliceVar(flags.ownedByFlag, "owned-by", nil, "a list of CODEOWNERS owners to include files of")
+	cmd.Flags().StringVar(flags.changedSinceFlag, "changed-since", "", "include only files changed since a git ref or date")
+	cmd.Flags().BoolVar(flags.withDepsFlag, "with-deps", false, "include the direct dependencies of changed files")
+	cmd.Flags().StringVar(flags.workspaceFlag, "workspace", "", "a package of the monorepo workspace to include")
+
+	if flags.tuiFlag != nil {
+		cmd.Flags().BoolVar(flags.tuiFlag, "tui", false, "use the full-screen chat interface")
+		cmd.Flag("tui").
+			Usage = "Use the full-screen chat interface with a scrollable transcript and a context sidebar"
+	}
 
 	cmd.Flag("include").
 		Usage = "Specify a regex pattern to include files. " +
@@ -131,10 +491,56 @@ func initFlags(cmd *cobra.Command, flags *flags) {
 	cmd.Flag("paths").
 		Usage = "Specify a list of paths to search for files. For example, " +
 		"to search in the 'cmd' and 'pkg' directories, use --paths cmd,pkg"
+	cmd.Flag("lang").
+		Usage = "Specify a list of languages to include files of, by name or alias. Files without an extension, " +
+		"like Makefile and Dockerfile, are detected by name. For example, use --lang go,typescript"
 	cmd.Flag("exclude-from-gitignore").
-		Usage = "Exclude files from .gitignore. If set to false, files mentioned in .gitignore will not be excluded"
+		Usage = "Exclude files from .gitignore, or .hgignore in Mercurial repositories. Outside a repository, " +
+		"dependency and build directories like node_modules are excluded too. " +
+		"If set to false, none of these files will be excluded"
 	cmd.Flag("exclude-git-dir").
 		Usage = "Exclude the .git directory. If set to false, the .git directory will not be excluded"
+	cmd.Flag("include-third-party").
+		Usage = "Include the code of others copied into the repository, which is excluded by default: directories " +
+		"like vendor and third_party, git submodules and directories with a license other than the repository's"
+	cmd.Flag("file").
+		Usage = "Specify files to include regardless of the other filters, such as a design doc. " +
+		"The text of PDF and DOCX files is extracted. For example, use --file docs/spec.pdf"
+	cmd.Flag("owned-by").
+		Usage = "Specify a list of owners from CODEOWNERS to include the files of, such as a team or a user. " +
+		"For example, use --owned-by @org/backend"
+	cmd.Flag("changed-since").
+		Usage = "Include only the files changed since a git tag, branch, commit or date, including uncommitted " +
+		"and untracked files. For example, use --changed-since v1.2.0 or --changed-since 2024-05-01"
+	cmd.Flag("with-deps").
+		Usage = "With --changed-since, also include the files the changed files import directly, " +
+		"such as the packages of a Go module or relative imports in TypeScript and Python"
+	cmd.Flag("workspace").
+		Usage = "Include only a package of the workspace, and the packages of the workspace it depends on, " +
+		"instead of --paths. Workspaces are read from go.work, pnpm-workspace.yaml, package.json, Cargo.toml " +
+		"and Bazel. For example, use --workspace @acme/api"
+	cmd.Flag("ignore-file").
+		Usage = "Exclude files matched by the given ignore files, written like .gitignore. " +
+		"For example, use --ignore-file .dockerignore,.npmignore"
+}
+
+// startProfiling records profiles and timings into dir until the command
+// finishes. Failing to do so is reported but doesn't stop the command.
+func startProfiling(dir string) {
+	if err := perf.Start(dir); err != nil {
+		slog.Warn("could not start profiling", "error", err)
+		return
+	}
+
+	cobra.OnFinalize(func() {
+		dir, err := perf.Stop()
+		if err != nil {
+			slog.Warn("could not write profiles", "error", err)
+			return
+		}
+
+		ui.PrintMessage(fmt.Sprintf("profiles written to %s\n", dir), ui.MessageTypeNotice)
+	})
 }
 
 func isPiped(file *os.File) bool {
@@ -159,8 +565,8 @@ func interactiveChat(c *cobra.Command, args []string, gatherOpts *chatOptions, l
 		}
 
 		// prompt the user to sign in to refresh the config
-		if !ui.AskYesNo("do you want to login now?", true) {
-			ui.PrintMessage("see ya later!", ui.MessageTypeInfo)
+		if !ui.AskYesNo(ui.T("login.ask"), true) {
+			ui.PrintMessage(ui.T("chat.goodbye"), ui.MessageTypeInfo)
 			return nil
 		}
 
@@ -169,20 +575,45 @@ func interactiveChat(c *cobra.Command, args []string, gatherOpts *chatOptions, l
 		if err != nil {
 			return fmt.Errorf("error logging in: %w", err)
 		}
+
+		cfg, err = config.NewFromConfigFile()
+		if err != nil {
+			return fmt.Errorf("error reading config: %w", err)
+		}
 	}
 
-	client := openai.NewClientWithConfig(cfg)
+	// nothing is sent in a dry run
+	if gatherOpts.dryRun == "" {
+		if err := confirmEgress(cfg.BaseURL); err != nil {
+			return err
+		}
+	}
+
+	provider := providers.New(cfg)
 
 	files, rootNode, err := gatherContext(gatherOpts)
 	if err != nil {
 		return err
 	}
 
+	if kept, err := gatherOpts.hooks.PreContext(files); err != nil {
+		return err //nolint:wrapcheck
+	} else if len(kept) != len(files) {
+		files, rootNode = kept, filetree.NewFileTree(kept)
+	}
+
+	if gatherOpts.ragQuery != "" {
+		files, rootNode, err = retrieveFiles(files, gatherOpts, provider)
+		if err != nil {
+			return err
+		}
+	}
+
 	if len(files) == 0 {
-		ui.PrintMessage("No files found matching the given criteria.\n", ui.MessageTypeWarning)
+		ui.PrintMessage(ui.T("chat.no-files")+"\n", ui.MessageTypeWarning)
 
-		if !ui.AskYesNo("Do you wish to proceed?", false) {
-			ui.PrintMessage("See ya later!", ui.MessageTypeInfo)
+		if !ui.AskYesNo(ui.T("chat.proceed"), false) {
+			ui.PrintMessage(ui.T("chat.goodbye"), ui.MessageTypeInfo)
 			return nil
 		}
 
@@ -191,169 +622,538 @@ func interactiveChat(c *cobra.Command, args []string, gatherOpts *chatOptions, l
 
 	fileTree := filetree.GenerateFileTree(rootNode, "", true)
 	// confirm with the user that the files are correct
-	ui.PrintMessage("The following files will be used as context:\n", ui.MessageTypeInfo)
+	ui.PrintMessage(ui.T("chat.context-files")+"\n", ui.MessageTypeInfo)
 	ui.PrintMessage(fileTree, ui.MessageTypeInfo)
+	ui.PrintMessage(estimatePrompt(cfg, files, args, gatherOpts)+"\n", ui.MessageTypeInfo)
 
-	// warn the user of files larger than 100kb
+	// warn the user of files larger than 100kb, except for data files, which
+	// are sampled
 	for _, file := range files {
-		if len(file.Data) > warnFileSizeThreshold {
-			largeFileMsg := fmt.Sprintf(
-				"warning: %s is very large (%d bytes) and will degrade performance.\n",
-				file.Path, len(file.Data))
+		if file.Size > warnFileSizeThreshold && !datasample.Applies(file.Path, file.Size, gatherOpts.filter.dataSampleOptions()) {
+			largeFileMsg := ui.T("chat.large-file", file.Path, file.Size) + "\n"
 
 			ui.PrintMessage(largeFileMsg, ui.MessageTypeWarning)
 		}
 	}
 
 	// confirm with the user that the files are correct
-	if !ui.AskYesNo("Do you wish to proceed?", true) {
-		ui.PrintMessage("See ya later!", ui.MessageTypeInfo)
+	if gatherOpts.dryRun == "" && !ui.AskYesNo(ui.T("chat.proceed"), true) {
+		ui.PrintMessage(ui.T("chat.goodbye"), ui.MessageTypeInfo)
 		return nil
 	}
 
-	contextStr := "File tree:\n\n"
-	contextStr += "```\n" + fileTree + "```\n\n"
-	contextStr += "File contents:\n\n"
+	if gatherOpts.strategy == strategyMapReduce {
+		return answerMapReduce(provider, files, args[0], gatherOpts)
+	}
 
-	for _, file := range files {
-		// find extension by splitting on ".". if no extension, use
-		contextStr += fmt.Sprintf("./%s\n```%s\n%s\n```\n\n", file.Path, file.Type, file.Data)
+	if gatherOpts.tuiFlag && gatherOpts.dryRun == "" {
+		var initialMessage string
+		if len(args) > 0 {
+			initialMessage = args[0]
+		}
+
+		systemMessage := createSystemMessageFromFiles(files, gatherOpts.filter)
+
+		return tui.Run(&tui.Options{
+			Provider:       provider,
+			SystemMessage:  systemMessage,
+			Files:          files,
+			InitialMessage: initialMessage,
+			ShowStats:      gatherOpts.showStats,
+			Parameters:     gatherOpts.params,
+			Prefill:        gatherOpts.prefill,
+			ErrorGuidance:  errorGuidance,
+			ContextTrimmer: newContextTrimmer(&files, gatherOpts.filter),
+			Tools:          gatherOpts.tools,
+			PreSend: func(text string) (string, error) {
+				// the terminal belongs to the interface, so commands can't be
+				// confirmed and messages that fail to expand are sent as written
+				if expanded, err := interpolate.Expand(text, promptOptions(files, false)); err == nil {
+					text = expanded
+				}
+
+				return gatherOpts.hooks.PreSend(text) //nolint:wrapcheck
+			},
+			PostResponse: func(prompt, response string) error {
+				// the interface doesn't tell when the context shrinks, so
+				// every turn is recorded with the initial context
+				gatherOpts.recorder.record(systemMessage, prompt, response, nil)
+
+				return gatherOpts.hooks.PostResponse(prompt, response) //nolint:wrapcheck
+			},
+			RedactPrompt: func(text string) string {
+				redacted, _ := gatherOpts.filter.redactPrompt(text)
+				return redacted
+			},
+		})
 	}
 
-	systemMessage := createSystemMessageFromContext(contextStr)
+	session := newChatSession(provider, files, gatherOpts)
 
-	ui.PrintMessage("Type '/exit' to end the chat.\n", ui.MessageTypeNotice)
+	if gatherOpts.dryRun != "" {
+		return session.dryRun(cfg, args[0])
+	}
+
+	ui.PrintMessage(ui.T("chat.welcome")+"\n", ui.MessageTypeNotice)
+
+	return session.run(args)
+}
+
+// estimatePrompt describes the size of the first request, and its cost
+// where the price of the deployment is known, for the user to weigh before
+// proceeding. Sampled data files are left out, as their samples are small.
+func estimatePrompt(cfg openai.ClientConfig, files []filetree.File, args []string, opts *chatOptions) string {
+	tokens := 0
+
+	for _, file := range files {
+		if !datasample.Applies(file.Path, file.Size, opts.filter.dataSampleOptions()) {
+			tokens += chat.EstimateTokensForSize(file.Size)
+		}
+	}
 
-	var initialUserMessage string
 	if len(args) > 0 {
-		initialUserMessage = args[0]
-		ui.PrintMessage(fmt.Sprintf("👤: %s\n", initialUserMessage), ui.MessageTypeInfo)
-	} else {
-		ui.PrintMessage("👤: ", ui.MessageTypeInfo)
-		initialUserMessage = ui.ReadUserInput()
+		tokens += chat.EstimateTokens(args[0])
 	}
 
-	if initialUserMessage == "/exit" {
-		return nil
+	model := opts.params.Model
+	if model == "" {
+		model = openai.GPT4TurboPreview
 	}
 
-	chatInstance := chat.NewChat(client, systemMessage, printMessageChunk)
-	conversation := chatInstance.BeginConversation(initialUserMessage)
+	if cfg.AzureModelMapperFunc != nil {
+		model = cfg.AzureModelMapperFunc(model)
+	}
 
-	for {
-		conversation.WaitMyTurn()
-		ui.PrintMessage("👤: ", ui.MessageTypeInfo)
+	if cost, ok := chat.PromptCost(model, tokens); ok {
+		return ui.T("chat.estimate-cost", chat.GroupThousands(tokens), cost, model)
+	}
 
-		userMessage := ui.ReadUserInput()
+	return ui.T("chat.estimate", chat.GroupThousands(tokens))
+}
 
-		if userMessage == "/exit" {
-			break
-		}
+// unescapeFlag interprets the escapes \n, \t and \\ in a flag value, which
+// shells pass on as written.
+func unescapeFlag(value string) string {
+	return strings.NewReplacer(`\\`, `\`, `\n`, "\n", `\t`, "\t").Replace(value)
+}
 
-		conversation.Reply(userMessage)
+// samplingFlags are the flags pinning sampling parameters.
+type samplingFlags struct {
+	deterministic bool
+	seed          int
+	stop          []string
+	// logProbs is the file the log probabilities are appended to.
+	logProbs    string
+	topLogProbs int
+}
+
+// samplingParameters returns the parameters pinned by the flags, or the stop
+// sequences of the config file.
+func samplingParameters(cmd *cobra.Command, flags *samplingFlags, cfg *config.Config) chat.Parameters {
+	var params chat.Parameters
+
+	if flags.deterministic {
+		params = chat.DeterministicParameters()
 	}
 
-	return nil
+	if cmd.Flags().Changed("seed") {
+		params.Seed = &flags.seed
+	}
+
+	if cmd.Flags().Changed("stop") {
+		params.Stop = flags.stop
+	} else {
+		params.Stop = cfg.Stop
+	}
+
+	if flags.logProbs != "" {
+		params.LogProbs = true
+		params.TopLogProbs = min(max(flags.topLogProbs, 0), maxTopLogProbs)
+	}
+
+	return params
+}
+
+// chunkPrinter prints the streamed response, highlighting fenced code blocks
+// when the terminal supports it and wrapping prose to the terminal width. A
+// spinner is shown from the moment a turn begins until the first part of the
+// answer arrives.
+type chunkPrinter struct {
+	highlighter *highlight.Writer
+	spinner     *ui.Spinner
+	waiting     bool
+	started     time.Time
+	// showStats prints a footer with the usage of each response.
+	showStats bool
+	totals    chat.TurnStats
+}
+
+func newChunkPrinter(showStats bool) *chunkPrinter {
+	return &chunkPrinter{
+		highlighter: highlight.NewWriter(os.Stdout, highlight.Supported(os.Stdout)),
+		spinner:     ui.NewSpinner(ui.T("chat.thinking")),
+		showStats:   showStats,
+	}
 }
 
-func printMessageChunk(chunk *chat.ConversationChunk) {
+// BeginTurn should be called right before a message is sent to the model.
+func (p *chunkPrinter) BeginTurn() {
+	// the terminal may have been resized since the previous turn
+	p.highlighter.SetWidth(ui.TerminalWidth())
+	p.waiting = true
+	p.started = time.Now()
+	p.spinner.Start()
+}
+
+func (p *chunkPrinter) HandleChunk(chunk *chat.ConversationChunk) {
 	if chunk.IsInitialChunk {
-		ui.PrintMessage("🤖: ", ui.MessageTypeInfo)
 		return
 	}
 
+	if chunk.Notice != "" {
+		// the request is retried, so keep waiting for the answer
+		p.spinner.Stop()
+		ui.PrintMessage(ui.T("chat.note", chunk.Notice)+"\n", ui.MessageTypeNotice)
+		p.spinner.Start()
+
+		return
+	}
+
+	if p.waiting {
+		p.spinner.Stop()
+		p.waiting = false
+
+		prompt := ui.ToASCII(ui.CurrentTheme().AssistantGlyph + ": ")
+		ui.PrintMessage(prompt, ui.MessageTypeInfo)
+		p.highlighter.Advance(runewidth.StringWidth(prompt))
+	}
+
 	if chunk.IsErrorChunk {
+		_ = p.highlighter.Flush()
 		ui.PrintMessage(chunk.Content, ui.MessageTypeError)
+
+		if guidance := errorGuidance(chunk.Err); guidance != "" {
+			ui.PrintMessage("\n"+guidance, ui.MessageTypeNotice)
+		}
 	}
 
 	if chunk.IsFinalChunk {
+		_ = p.highlighter.Flush()
 		ui.PrintMessage("\n", ui.MessageTypeInfo)
+
+		if chunk.Stats != nil {
+			p.totals.Add(*chunk.Stats)
+
+			if p.showStats {
+				ui.PrintMessage(chunk.Stats.String()+"\n", ui.MessageTypeDim)
+			}
+		}
+
+		ui.NotifyIfSlow(p.started, "the response is ready")
 	}
 
-	ui.PrintMessage(chunk.Content, ui.MessageTypeInfo)
+	if !chunk.IsErrorChunk {
+		_, _ = p.highlighter.Write([]byte(chunk.Content))
+	}
 }
 
-func nonInteractive(systemMessage string, prompt string) error {
-	cfg, err := config.NewFromConfigFile()
+func nonInteractive(systemMessage string, prompt string, opts *chatOptions) error {
+	newConfig := newClientConfig
+	if opts.dryRun != "" {
+		newConfig = dryRunConfig
+	}
+
+	cfg, err := newConfig()
 	if err != nil {
-		return fmt.Errorf("error reading config: %w", err)
+		return err
+	}
+
+	provider := providers.New(cfg)
+
+	highlighter := highlight.NewWriter(os.Stdout, highlight.Supported(os.Stdout))
+	highlighter.SetWidth(ui.TerminalWidth())
+
+	newSession := func() *chat.Session {
+		session := chat.NewSession(provider, systemMessage)
+		session.SetParameters(opts.params)
+		session.SetTools(opts.tools)
+		session.SetPrefill(opts.prefill)
+
+		return session
+	}
+
+	if opts.dryRun != "" {
+		return printRequest(cfg, provider, newSession().Request(prompt), opts.dryRun)
 	}
 
-	client := openai.NewClientWithConfig(cfg)
+	if opts.bestOf > 1 {
+		reply, err := askBestOf(newSession, prompt, &bestOfOptions{n: opts.bestOf})
+		if err != nil {
+			return err
+		}
+
+		_, _ = highlighter.Write([]byte(reply))
+		_ = highlighter.Flush()
+
+		if err := writeAnswer(reply, opts); err != nil {
+			return err
+		}
+
+		opts.recorder.record(systemMessage, prompt, reply, nil)
 
-	onChunk := func(chunk *chat.ConversationChunk) {
-		ui.PrintMessage(chunk.Content, ui.MessageTypeInfo)
+		return opts.hooks.PostResponse(prompt, reply) //nolint:wrapcheck
 	}
-	chatInstance := chat.NewChat(client, systemMessage, onChunk)
-	conversation := chatInstance.BeginConversation(prompt)
 
-	conversation.WaitMyTurn()
+	session := newSession()
+
+	var reply strings.Builder
+
+	for event := range session.Send(prompt) {
+		switch event.Type {
+		case chat.EventNotice:
+			ui.PrintMessage(ui.T("chat.note", event.Content)+"\n", ui.MessageTypeNotice)
+		case chat.EventDelta:
+			reply.WriteString(event.Content)
+			_, _ = highlighter.Write([]byte(event.Content))
+		case chat.EventError:
+			_, _ = highlighter.Write([]byte(event.Content))
+
+			if guidance := errorGuidance(event.Err); guidance != "" {
+				_, _ = highlighter.Write([]byte("\n" + guidance))
+			}
+
+			_ = highlighter.Flush()
+		case chat.EventDone:
+			_ = highlighter.Flush()
+
+			if err := writeAnswer(reply.String(), opts); err != nil {
+				return err
+			}
+
+			opts.recorder.record(systemMessage, prompt, reply.String(), event.Stats)
+
+			if opts.logProbsFile != "" {
+				err := appendLogProbs(opts.logProbsFile, prompt, reply.String(), event.Stats, event.LogProbs)
+				if err != nil {
+					slog.Warn("could not write log probabilities", "file", opts.logProbsFile, "error", err)
+				}
+			}
+
+			if err := opts.hooks.PostResponse(prompt, reply.String()); err != nil {
+				return err //nolint:wrapcheck
+			}
+		case chat.EventStart:
+		}
+	}
 
 	return nil
 }
 
-func createSystemMessageFromContext(context string) string {
-	var systemMessage strings.Builder
+// createSystemMessageFromFiles renders the given files into a system message,
+// passing their contents through the filter so nothing sensitive ends up in
+// it, and records them in the audit log.
+func createSystemMessageFromFiles(files []filetree.File, filter *contextFilter) string {
+	auditFiles(files)
+
+	builder := chat.ContextBuilder{
+		Filter: filter.apply,
+		OnReadError: func(path string, err error) {
+			slog.Warn("could not read file", "path", path, "error", err)
+		},
+		StripNotebookOutputs: filter != nil && filter.stripNotebookOutputs,
+		DataSample:           filter.dataSampleOptions(),
+	}
 
-	systemMessage.WriteString("You are a helpful coding assistant. ")
-	systemMessage.WriteString("Below you will find relevant context to answer the user's question.\n\n")
-	systemMessage.WriteString("Context:\n")
-	systemMessage.WriteString(context)
-	systemMessage.WriteString("\n\n")
-	systemMessage.WriteString("Please follow the users instructions, you can do this!")
+	if filter != nil && filter.repoMap {
+		builder.RepoMap = buildRepoMap(files, repomap.DefaultTokens)
+	}
 
-	return systemMessage.String()
+	return builder.Build(files)
 }
 
 type chatOptions struct {
 	includeFlag              string
 	excludeFlag              string
 	pathsFlag                []string
+	langFlag                 []string
+	ignoreFilesFlag          []string
+	filesFlag                []string
+	ownedByFlag              []string
+	changedSinceFlag         string
+	withDepsFlag             bool
+	workspaceFlag            string
 	excludeFromGitignoreFlag bool
 	excludeGitDirFlag        bool
+	includeThirdPartyFlag    bool
+	tuiFlag                  bool
+	showStats                bool
+	filter                   *contextFilter
+	params                   chat.Parameters
+	// tools are offered to the model, see pluginTools.
+	tools []chat.Tool
+	hooks *hooks.Runner
+	// stableOrder sorts the files by path, so the context doesn't depend on
+	// the order of --paths.
+	stableOrder bool
+	// ragQuery narrows the files to those relevant to it, see retrieveFiles.
+	ragQuery  string
+	ragChunks int
+	rerank    *config.RerankConfig
+	// strategy is how the prompt is answered, see --strategy.
+	strategy string
+	// logProbsFile is where the log probabilities of the responses are
+	// appended, see --logprobs.
+	logProbsFile string
+	// bestOf is the number of responses to pick from, see --n.
+	bestOf int
+	// prefill begins every response, see --prefill.
+	prefill string
+	// output and outputCodeOnly are where the answer of a non-interactive
+	// prompt is written, see writeAnswer.
+	output         string
+	outputCodeOnly string
+	// writeFiles offers to write the annotated code blocks of each response,
+	// see --write-files.
+	writeFiles bool
+	// verifier checks the edits written in a chat, see --verify.
+	verifier *verifier
+	// editFormat is how edits are asked for, see --edit-format.
+	editFormat string
+	// committer commits the edits written in a chat to a branch, see
+	// --commit-branch.
+	committer *branchCommitter
+	// recorder saves the turns to the history of sessions.
+	recorder *sessionRecorder
+	// dryRun is the format the request is printed in instead of being sent,
+	// see --dry-run.
+	dryRun string
 }
 
-func gatherContext(opts *chatOptions) ([]filetree.File, *filetree.FileNode, error) {
-	includeFlag := opts.includeFlag
-	excludeFlag := opts.excludeFlag
-	pathsFlag := opts.pathsFlag
-	excludeFromGitignoreFlag := opts.excludeFromGitignoreFlag
-	excludeGitDirFlag := opts.excludeGitDirFlag
-
+// filterMatchers returns the matchers of the files the flags leave out of
+// the context wherever they are found: --exclude, the ignore files and the
+// .git directory.
+func filterMatchers(opts *chatOptions) ([]pathmatcher.PathMatcher, error) {
 	var excludeMatchers []pathmatcher.PathMatcher
 
 	// add exclude flag to excludeMatchers
-	if excludeFlag != "" {
-		excludeMatcher, err := pathmatcher.NewRegexPathMatcher(excludeFlag)
+	if opts.excludeFlag != "" {
+		excludeMatcher, err := pathmatcher.NewRegexPathMatcher(opts.excludeFlag)
 		if err != nil {
-			return nil, nil, fmt.Errorf("error creating exclude matcher: %w", err)
+			return nil, fmt.Errorf("error creating exclude matcher: %w", err)
 		}
 
 		excludeMatchers = append(excludeMatchers, excludeMatcher)
 	}
 
-	if excludeFromGitignoreFlag {
-		gitignoreMatcher, err := pathmatcher.NewGitignorePathMatcher()
+	if opts.excludeFromGitignoreFlag {
+		gitignoreMatcher, err := pathmatcher.NewVCSIgnorePathMatcher()
 		if err != nil {
-			if errors.IsGitNotInstalledError(err) {
-				ui.PrintMessage("warning: git not found in PATH, skipping .gitignore\n", ui.MessageTypeWarning)
-			} else {
-				return nil, nil, fmt.Errorf("error creating gitignore matcher: %w", err)
-			}
+			return nil, fmt.Errorf("error creating gitignore matcher: %w", err)
 		}
 
 		excludeMatchers = append(excludeMatchers, gitignoreMatcher)
 	}
 
-	if excludeGitDirFlag {
+	if len(opts.ignoreFilesFlag) > 0 {
+		ignoreFileMatcher, err := pathmatcher.NewIgnoreFilePathMatcher(opts.ignoreFilesFlag...)
+		if err != nil {
+			return nil, fmt.Errorf("error creating ignore file matcher: %w", err)
+		}
+
+		excludeMatchers = append(excludeMatchers, ignoreFileMatcher)
+	}
+
+	if opts.excludeGitDirFlag {
 		gitDirMatcher, err := pathmatcher.NewRegexPathMatcher(`^.*\.git$`)
 		if err != nil {
-			return nil, nil, fmt.Errorf("error creating git directory matcher: %w", err)
+			return nil, fmt.Errorf("error creating git directory matcher: %w", err)
 		}
 
 		excludeMatchers = append(excludeMatchers, gitDirMatcher)
 	}
 
+	return excludeMatchers, nil
+}
+
+func gatherContext(opts *chatOptions) ([]filetree.File, *filetree.FileNode, error) {
+	defer perf.Track("gather-files")()
+
+	includeFlag := opts.includeFlag
+	pathsFlag := opts.pathsFlag
+
+	excludeMatchers, err := filterMatchers(opts)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	codeowners, err := pathmatcher.LoadCodeowners()
+	if err != nil {
+		return nil, nil, fmt.Errorf("error reading CODEOWNERS: %w", err)
+	}
+
+	if len(opts.ownedByFlag) > 0 {
+		if codeowners == nil {
+			return nil, nil, stderrors.New("--owned-by requires a CODEOWNERS file")
+		}
+
+		excludeMatchers = append(excludeMatchers, pathmatcher.NewOwnerPathMatcher(codeowners, opts.ownedByFlag...))
+	}
+
+	if opts.changedSinceFlag != "" {
+		changed, err := changes.Since(opts.changedSinceFlag)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error finding changed files: %w", err)
+		}
+
+		if opts.withDepsFlag {
+			changed = append(changed, changes.Dependencies(changed)...)
+		}
+
+		excludeMatchers = append(excludeMatchers, pathmatcher.NewUnlistedPathMatcher(changed))
+	} else if opts.withDepsFlag {
+		return nil, nil, stderrors.New("--with-deps requires --changed-since")
+	}
+
+	if opts.workspaceFlag != "" {
+		dirs, nested, err := workspaceScope(opts.workspaceFlag)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		pathsFlag = dirs
+
+		if len(nested) > 0 {
+			nestedMatcher, err := pathmatcher.NewRegexPathMatcher(dirsPattern(nested))
+			if err != nil {
+				return nil, nil, fmt.Errorf("error creating workspace matcher: %w", err)
+			}
+
+			excludeMatchers = append(excludeMatchers, nestedMatcher)
+		}
+	}
+
+	// nothing is sent in a dry run
+	if opts.dryRun == "" {
+		dirs := slices.Clone(pathsFlag)
+		for _, path := range opts.filesFlag {
+			dirs = append(dirs, filepath.Dir(path))
+		}
+
+		if err := confirmDirectories(dirs); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	var thirdParty *pathmatcher.ThirdPartyPathMatcher
+
+	if !opts.includeThirdPartyFlag {
+		if thirdParty, err = pathmatcher.NewThirdPartyPathMatcher(pathsFlag); err != nil {
+			return nil, nil, fmt.Errorf("error creating third-party matcher: %w", err)
+		}
+
+		excludeMatchers = append(excludeMatchers, thirdParty)
+	}
+
 	excludeMatcher := pathmatcher.NewCompoundPathMatcher(excludeMatchers...)
 
 	// includeMatcher
@@ -362,14 +1162,60 @@ func gatherContext(opts *chatOptions) ([]filetree.File, *filetree.FileNode, erro
 		return nil, nil, fmt.Errorf("error creating include matcher: %w", err)
 	}
 
+	langs, err := languages.Resolve(opts.langFlag)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error parsing --lang: %w", err)
+	}
+
+	progress := ui.NewProgressLine()
+	defer progress.Done()
+
 	files, rootNode, err := filetree.GatherFiles(&filetree.FileGatherOptions{
 		IncludeMatcher: includeMatcher,
 		ExcludeMatcher: excludeMatcher,
 		PathScopes:     pathsFlag,
+		Languages:      langs,
+		OnProgress: func(p filetree.GatherProgress) {
+			progress.Update(fmt.Sprintf("gathering files: %d scanned, %d included, %d skipped (%s)",
+				p.Scanned, p.Included, p.Skipped, ui.FormatBytes(p.Bytes)))
+		},
 	})
 	if err != nil {
 		return nil, nil, fmt.Errorf("error gathering files: %w", err)
 	}
 
+	for _, path := range opts.filesFlag {
+		file, err := filetree.LoadFile(path)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error including %s: %w", path, err)
+		}
+
+		if !slices.ContainsFunc(files, func(f filetree.File) bool { return f.Path == file.Path }) {
+			files = append(files, *file)
+		}
+	}
+
+	// show who maintains what in the file tree
+	for i := range files {
+		files[i].Owners = codeowners.Owners(files[i].Path)
+	}
+
+	if len(opts.filesFlag) > 0 || codeowners != nil {
+		rootNode = filetree.NewFileTree(files)
+	}
+
+	if opts.stableOrder {
+		sort.SliceStable(files, func(i, j int) bool {
+			return files[i].Path < files[j].Path
+		})
+	}
+
+	if thirdParty != nil && len(thirdParty.Dirs()) > 0 {
+		slog.Info("excluded third-party code, --include-third-party includes it",
+			"dirs", strings.Join(thirdParty.Dirs(), ", "))
+	}
+
+	slog.Debug("gathered files", "count", len(files))
+
 	return files, rootNode, nil
 }
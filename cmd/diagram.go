@@ -0,0 +1,318 @@
+package cmd
+
+import (
+	stderrors "errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/emilkje/cwc/pkg/chat"
+	"github.com/emilkje/cwc/pkg/config"
+	"github.com/emilkje/cwc/pkg/filetree"
+	"github.com/emilkje/cwc/pkg/mermaid"
+	"github.com/emilkje/cwc/pkg/providers"
+	"github.com/emilkje/cwc/pkg/repomap"
+	"github.com/emilkje/cwc/pkg/ui"
+)
+
+const (
+	diagramComponent = "component"
+	diagramSequence  = "sequence"
+	diagramClass     = "class"
+
+	// diagramAttempts is how many times the model is asked for a diagram
+	// that passes validation.
+	diagramAttempts = 3
+	diagramTokens   = 4096
+)
+
+// diagramTypes maps the --type values to the Mermaid diagram type asked for.
+var diagramTypes = map[string]string{ //nolint:gochecknoglobals
+	diagramComponent: mermaid.Flowchart,
+	diagramSequence:  mermaid.Sequence,
+	diagramClass:     mermaid.Class,
+}
+
+func createDiagramCmd() *cobra.Command { //nolint:funlen
+	var (
+		includeFlag              string
+		excludeFlag              string
+		pathsFlag                []string
+		langFlag                 []string
+		ignoreFilesFlag          []string
+		filesFlag                []string
+		ownedByFlag              []string
+		changedSinceFlag         string
+		withDepsFlag             bool
+		workspaceFlag            string
+		excludeFromGitignoreFlag bool
+		excludeGitDirFlag        bool
+		includeThirdPartyFlag    bool
+		focusFlag                []string
+		typeFlag                 string
+		outputFlag               string
+		tokensFlag               int
+	)
+
+	cmd := &cobra.Command{
+		Use:   "diagram [description]",
+		Short: "Draw an architecture diagram of the repository in Mermaid",
+		Long: "Diagram gives the model an outline of the files below --focus, with their exported symbols and the\n" +
+			"files they use, and asks it for a Mermaid component, sequence or class diagram of that subsystem.\n" +
+			"The diagram is checked for syntax errors, which the model is asked to fix, before it is written to\n" +
+			"--output, as a .mmd file or, for .md files, as a fenced block. An optional description tells the\n" +
+			"model what to show, such as the flow of a request.",
+		Example: "  cwc diagram --focus pkg/config\n" +
+			"  cwc diagram --focus pkg/chat --type sequence \"sending a message\" -o docs/chat.md",
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			kind, ok := diagramTypes[typeFlag]
+			if !ok {
+				return fmt.Errorf("unknown diagram type %q, use %s, %s or %s",
+					typeFlag, diagramComponent, diagramSequence, diagramClass)
+			}
+
+			files, _, err := gatherContext(&chatOptions{
+				includeFlag:              includeFlag,
+				excludeFlag:              excludeFlag,
+				pathsFlag:                pathsFlag,
+				langFlag:                 langFlag,
+				ignoreFilesFlag:          ignoreFilesFlag,
+				filesFlag:                filesFlag,
+				ownedByFlag:              ownedByFlag,
+				changedSinceFlag:         changedSinceFlag,
+				withDepsFlag:             withDepsFlag,
+				workspaceFlag:            workspaceFlag,
+				excludeFromGitignoreFlag: excludeFromGitignoreFlag,
+				excludeGitDirFlag:        excludeGitDirFlag,
+				includeThirdPartyFlag:    includeThirdPartyFlag,
+			})
+			if err != nil {
+				return err
+			}
+
+			var description string
+			if len(args) > 0 {
+				description = args[0]
+			}
+
+			output := outputFlag
+			if output == "" {
+				output = defaultDiagramPath(focusFlag)
+			}
+
+			return drawDiagram(files, focusFlag, kind, description, output, tokensFlag)
+		},
+	}
+
+	initFlags(cmd, &flags{
+		includeFlag:              &includeFlag,
+		excludeFlag:              &excludeFlag,
+		pathsFlag:                &pathsFlag,
+		langFlag:                 &langFlag,
+		ignoreFilesFlag:          &ignoreFilesFlag,
+		filesFlag:                &filesFlag,
+		ownedByFlag:              &ownedByFlag,
+		changedSinceFlag:         &changedSinceFlag,
+		withDepsFlag:             &withDepsFlag,
+		workspaceFlag:            &workspaceFlag,
+		excludeFromGitignoreFlag: &excludeFromGitignoreFlag,
+		excludeGitDirFlag:        &excludeGitDirFlag,
+		includeThirdPartyFlag:    &includeThirdPartyFlag,
+	})
+
+	cmd.Flags().StringSliceVar(&focusFlag, "focus", nil, "the directories or files of the subsystem to draw")
+	cmd.Flag("focus").Usage = "Specify the directories or files of the subsystem to draw. The rest of the " +
+		"repository is only used to show what the subsystem depends on. For example, use --focus pkg/config"
+	cmd.Flags().StringVar(&typeFlag, "type", diagramComponent, "the type of diagram: component, sequence or class")
+	cmd.Flags().StringVarP(&outputFlag, "output", "o", "",
+		"the file to write the diagram to, .mmd or .md. Defaults to the name of the focus, such as config.mmd")
+	cmd.Flags().IntVar(&tokensFlag, "tokens", diagramTokens, "the approximate size of the outline in tokens")
+
+	return cmd
+}
+
+// defaultDiagramPath names the diagram after the focus, or architecture.mmd
+// for the whole repository.
+func defaultDiagramPath(focus []string) string {
+	if len(focus) == 1 {
+		if name := filepath.Base(filepath.Clean(focus[0])); name != "." && name != string(filepath.Separator) {
+			return strings.TrimSuffix(name, filepath.Ext(name)) + ".mmd"
+		}
+	}
+
+	return "architecture.mmd"
+}
+
+func drawDiagram(files []filetree.File, focus []string, kind, description, output string, maxTokens int) error {
+	paths := make([]string, len(files))
+	for i, file := range files {
+		paths[i] = file.Path
+	}
+
+	outline := repomap.Build(paths).Outline(focus, maxTokens)
+	if strings.TrimSpace(outline) == "" {
+		return fmt.Errorf("no files to draw below %s", strings.Join(focus, ", "))
+	}
+
+	userConfig, err := config.LoadConfigOrDefault()
+	if err != nil {
+		return fmt.Errorf("error reading config: %w", err)
+	}
+
+	filter, err := newContextFilter(userConfig)
+	if err != nil {
+		return err
+	}
+
+	outline, ok := filter.apply("the repository outline", outline)
+	if !ok {
+		return stderrors.New("not sending the repository outline as it contains secrets")
+	}
+
+	clientConfig, err := newClientConfig()
+	if err != nil {
+		return err
+	}
+
+	auditFiles(files)
+
+	session := chat.NewSession(providers.New(clientConfig), diagramSystemMessage(outline))
+	prompt := diagramPrompt(focus, kind, description)
+
+	for attempt := 1; ; attempt++ {
+		spinner := ui.NewSpinner(ui.T("chat.thinking"))
+		spinner.Start()
+
+		reply, err := collectReply(session, prompt)
+
+		spinner.Stop()
+
+		if err != nil {
+			return err
+		}
+
+		diagram, err := mermaid.Extract(reply)
+		if err == nil {
+			err = mermaid.Validate(diagram)
+		}
+
+		if err == nil && mermaid.Type(diagram) != kind {
+			err = fmt.Errorf("expected a %s, got a %s", kind, mermaid.Type(diagram))
+		}
+
+		if err == nil {
+			return writeDiagram(output, diagram)
+		}
+
+		if attempt == diagramAttempts {
+			return fmt.Errorf("the model did not produce a valid diagram: %w", err)
+		}
+
+		ui.PrintMessage(fmt.Sprintf("the diagram is invalid, asking for a fix: %s\n", err), ui.MessageTypeNotice)
+
+		prompt = "The diagram is not valid Mermaid:\n" + err.Error() +
+			"\n\nReply with the corrected diagram in a single ```mermaid block."
+	}
+}
+
+func diagramSystemMessage(outline string) string {
+	return "You are a software architect documenting a code base. Below is an outline of its files: " +
+		"the exported symbols of each file, how many files use it and which files it uses.\n\n" +
+		"```\n" + outline + "```\n"
+}
+
+func diagramPrompt(focus []string, kind, description string) string {
+	subject := "the repository"
+	if len(focus) > 0 {
+		subject = strings.Join(focus, ", ")
+	}
+
+	var prompt strings.Builder
+
+	switch kind {
+	case mermaid.Sequence:
+		fmt.Fprintf(&prompt, "Draw a Mermaid sequenceDiagram of the main interactions in %s.", subject)
+	case mermaid.Class:
+		fmt.Fprintf(&prompt, "Draw a Mermaid classDiagram of the main types in %s and their relationships.", subject)
+	default:
+		fmt.Fprintf(&prompt, "Draw a Mermaid flowchart of the components of %s and how they depend on each "+
+			"other and on the rest of the repository. Group the components of a package in a subgraph.", subject)
+	}
+
+	if description != "" {
+		prompt.WriteString(" Focus on " + description + ".")
+	}
+
+	prompt.WriteString(" Use the names of the symbols in the outline, quote labels containing punctuation, " +
+		"and keep it to the 10 to 25 most important elements. Reply with the diagram only, in a single " +
+		"```mermaid block.")
+
+	return prompt.String()
+}
+
+// collectReply sends the prompt and returns the whole reply.
+func collectReply(session *chat.Session, prompt string) (string, error) {
+	var (
+		reply strings.Builder
+		err   error
+	)
+
+	for event := range session.Send(prompt) {
+		switch event.Type {
+		case chat.EventDelta:
+			reply.WriteString(event.Content)
+		case chat.EventError:
+			err = event.Err
+		case chat.EventStart, chat.EventNotice, chat.EventDone:
+		}
+	}
+
+	if err != nil {
+		if guidance := errorGuidance(err); guidance != "" {
+			ui.PrintMessage(guidance+"\n", ui.MessageTypeNotice)
+		}
+
+		return "", err //nolint:wrapcheck
+	}
+
+	return reply.String(), nil
+}
+
+// writeDiagram writes the diagram as is, or as a fenced block to markdown
+// files.
+func writeDiagram(path, diagram string) error {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".md", ".markdown":
+		diagram = "```mermaid\n" + diagram + "```\n"
+	}
+
+	return writeGenerated(path, diagram, "diagram")
+}
+
+// writeGenerated writes generated content, creating the directory if need
+// be. An existing file is only replaced if the user agrees, otherwise the
+// content is printed instead.
+func writeGenerated(path, content, what string) error {
+	if _, err := os.Stat(path); err == nil {
+		if !ui.AskYesNo(fmt.Sprintf("%s exists, overwrite it?", path), false) {
+			fmt.Print(content) //nolint:forbidigo
+			return nil
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil { //nolint:gomnd,gosec
+		return fmt.Errorf("error creating directory for %s: %w", what, err)
+	}
+
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil { //nolint:gomnd,gosec
+		return fmt.Errorf("error writing %s: %w", what, err)
+	}
+
+	ui.PrintMessage(fmt.Sprintf("%s written to %s\n", what, path), ui.MessageTypeSuccess)
+
+	return nil
+}
@@ -0,0 +1,169 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/sashabaranov/go-openai"
+
+	"github.com/emilkje/cwc/pkg/config"
+	"github.com/emilkje/cwc/pkg/providers"
+	"github.com/emilkje/cwc/pkg/ui"
+)
+
+// The formats --dry-run prints the request in. A value ending in .json is a
+// file the request is written to as JSON instead, keeping it apart from the
+// other output.
+const (
+	dryRunText = "text"
+	dryRunJSON = "json"
+)
+
+// dryRun is the request a dry run prints instead of sending, with where it
+// would have gone.
+type dryRun struct {
+	Provider   string                       `json:"provider"`
+	Endpoint   string                       `json:"endpoint"`
+	Deployment string                       `json:"deployment"`
+	Request    openai.ChatCompletionRequest `json:"request"`
+}
+
+func validDryRunFormat(format string) error {
+	if format != "" && format != dryRunText && format != dryRunJSON && !isDryRunFile(format) {
+		return fmt.Errorf("unknown --dry-run format %q, use %q, %q or the path of a .json file", format, dryRunText,
+			dryRunJSON)
+	}
+
+	return nil
+}
+
+func isDryRunFile(format string) bool {
+	return strings.HasSuffix(format, ".json")
+}
+
+// dryRunConfig reads the client configuration without confirming the
+// endpoint, as nothing is sent to it.
+func dryRunConfig() (openai.ClientConfig, error) {
+	cfg, err := config.NewFromConfigFile()
+	if err != nil {
+		return openai.ClientConfig{}, fmt.Errorf("error reading config: %w", err)
+	}
+
+	return cfg, nil
+}
+
+// printRequest prints the request to standard output in the format, or
+// writes it to the file the format names, with the endpoint and deployment
+// it would be sent to.
+func printRequest(cfg openai.ClientConfig, provider providers.Provider, req openai.ChatCompletionRequest,
+	format string,
+) error {
+	run := dryRun{
+		Provider:   provider.Name(),
+		Endpoint:   cfg.BaseURL,
+		Deployment: req.Model,
+		Request:    req,
+	}
+
+	if cfg.AzureModelMapperFunc != nil {
+		run.Deployment = cfg.AzureModelMapperFunc(req.Model)
+	}
+
+	if isDryRunFile(format) {
+		data, err := encodeDryRun(&run)
+		if err != nil {
+			return err
+		}
+
+		if err := os.WriteFile(format, data, 0o600); err != nil {
+			return fmt.Errorf("error writing the request: %w", err)
+		}
+
+		ui.PrintMessage(fmt.Sprintf("wrote the request to %s\n", format), ui.MessageTypeInfo)
+
+		return nil
+	}
+
+	if format == dryRunJSON {
+		data, err := encodeDryRun(&run)
+		if err != nil {
+			return err
+		}
+
+		if _, err := os.Stdout.Write(data); err != nil {
+			return fmt.Errorf("error writing the request: %w", err)
+		}
+
+		return nil
+	}
+
+	_, err := fmt.Fprint(os.Stdout, formatDryRun(&run))
+	if err != nil {
+		return fmt.Errorf("error writing the request: %w", err)
+	}
+
+	return nil
+}
+
+func encodeDryRun(run *dryRun) ([]byte, error) {
+	var data bytes.Buffer
+
+	encoder := json.NewEncoder(&data)
+	encoder.SetIndent("", "  ")
+	encoder.SetEscapeHTML(false)
+
+	if err := encoder.Encode(run); err != nil {
+		return nil, fmt.Errorf("error encoding the request: %w", err)
+	}
+
+	return data.Bytes(), nil
+}
+
+// formatDryRun lays out the request for reading: where it goes and with
+// which parameters, then each message in full.
+func formatDryRun(run *dryRun) string {
+	var text strings.Builder
+
+	req := run.Request
+
+	fmt.Fprintf(&text, "provider:    %s\n", run.Provider)
+	fmt.Fprintf(&text, "endpoint:    %s\n", run.Endpoint)
+	fmt.Fprintf(&text, "deployment:  %s\n", run.Deployment)
+
+	if req.Temperature != 0 {
+		fmt.Fprintf(&text, "temperature: %g\n", req.Temperature)
+	}
+
+	if req.Seed != nil {
+		fmt.Fprintf(&text, "seed:        %d\n", *req.Seed)
+	}
+
+	if len(req.Stop) > 0 {
+		fmt.Fprintf(&text, "stop:        %q\n", req.Stop)
+	}
+
+	if req.LogProbs {
+		fmt.Fprintf(&text, "logprobs:    top %d\n", req.TopLogProbs)
+	}
+
+	if len(req.Tools) > 0 {
+		names := make([]string, 0, len(req.Tools))
+		for _, tool := range req.Tools {
+			if tool.Function != nil {
+				names = append(names, tool.Function.Name)
+			}
+		}
+
+		fmt.Fprintf(&text, "tools:       %s\n", strings.Join(names, ", "))
+	}
+
+	for _, message := range req.Messages {
+		fmt.Fprintf(&text, "\n----- %s (%d characters) -----\n%s\n", message.Role, len(message.Content),
+			message.Content)
+	}
+
+	return text.String()
+}
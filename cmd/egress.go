@@ -0,0 +1,107 @@
+package cmd
+
+import (
+	stderrors "errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/sashabaranov/go-openai"
+	"golang.org/x/term"
+
+	"github.com/emilkje/cwc/pkg/cassette"
+	"github.com/emilkje/cwc/pkg/config"
+	"github.com/emilkje/cwc/pkg/ui"
+)
+
+// newClientConfig reads the client configuration and makes sure the user
+// agreed to send code to its endpoint before any request is made.
+func newClientConfig() (openai.ClientConfig, error) {
+	clientConfig, err := config.NewFromConfigFile()
+	if err != nil {
+		return openai.ClientConfig{}, fmt.Errorf("error reading config: %w", err)
+	}
+
+	if err := confirmEgress(clientConfig.BaseURL); err != nil {
+		return openai.ClientConfig{}, err
+	}
+
+	return clientConfig, nil
+}
+
+// confirmEgress fails fast if the endpoint can't be reached in offline mode.
+// Otherwise it shows where data is about to be sent and asks for
+// confirmation if the endpoint is not on the allow-list. Without an
+// allow-list, the confirmation is remembered per endpoint, so the user is only
+// asked the first time an endpoint is used. Nothing is sent while a cassette
+// is replayed, so there is nothing to confirm.
+func confirmEgress(endpoint string) error {
+	if cassette.Replaying() {
+		return nil
+	}
+
+	if err := config.CheckOffline(endpoint); err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	cfg, err := config.LoadConfigOrDefault()
+	if err != nil {
+		return fmt.Errorf("error reading config: %w", err)
+	}
+
+	origin, err := config.EndpointOrigin(endpoint)
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	if cfg.EndpointAllowed(origin) {
+		return nil
+	}
+
+	remember := len(cfg.AllowedEndpoints) == 0
+
+	if remember {
+		confirmed, err := config.EndpointConfirmed(origin)
+		if err != nil {
+			return err //nolint:wrapcheck
+		}
+
+		if confirmed {
+			return nil
+		}
+	}
+
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		return fmt.Errorf("not sending data to %s as it has not been confirmed, "+
+			"run cwc in a terminal once to confirm it or add it to allowedEndpoints in the config file", origin)
+	}
+
+	var details strings.Builder
+
+	if remember {
+		details.WriteString("cwc has not sent data to this endpoint before.\n")
+	} else {
+		details.WriteString("This endpoint is not in allowedEndpoints in the config file.\n")
+	}
+
+	fmt.Fprintf(&details, "Your code and messages will be sent to:\n  endpoint: %s\n  origin:   %s\n", endpoint, origin)
+
+	if !strings.HasPrefix(origin, "https://") {
+		details.WriteString("The connection is not encrypted.\n")
+	}
+
+	ui.PrintMessage(details.String(), ui.MessageTypeWarning)
+
+	if !ui.AskYesNo("Send data to this endpoint?", false) {
+		return stderrors.New("aborted: the endpoint was not confirmed")
+	}
+
+	if remember {
+		if err := config.ConfirmEndpoint(origin); err != nil {
+			slog.Warn("could not remember the endpoint", "endpoint", origin, "error", err)
+		}
+	}
+
+	return nil
+}
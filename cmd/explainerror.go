@@ -0,0 +1,154 @@
+package cmd
+
+import (
+	stderrors "errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/emilkje/cwc/pkg/audit"
+	"github.com/emilkje/cwc/pkg/changes"
+	"github.com/emilkje/cwc/pkg/config"
+	"github.com/emilkje/cwc/pkg/diagnostics"
+	"github.com/emilkje/cwc/pkg/languages"
+	"github.com/emilkje/cwc/pkg/ui"
+)
+
+func createExplainErrorCmd() *cobra.Command {
+	var (
+		linesFlag      int
+		maxRegionsFlag int
+	)
+
+	cmd := &cobra.Command{
+		Use:   "explain-error [file]",
+		Short: "Explain the root cause of a panic, stack trace or error output",
+		Long: "Explain-error reads a panic, stack trace or error output from the file given, or from stdin, finds the\n" +
+			"files and lines of the repository it points to, and sends the output with the lines around them to the\n" +
+			"model, which explains the likely root cause and suggests a fix. Frames outside the repository, such\n" +
+			"as those of the standard library and dependencies, are left out.",
+		Example: "  go test ./... 2>&1 | cwc explain-error\n" +
+			"  cwc explain-error crash.log --lines 40",
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var (
+				input []byte
+				err   error
+			)
+
+			switch {
+			case len(args) == 1:
+				input, err = os.ReadFile(args[0]) // #nosec
+			case isPiped(os.Stdin):
+				input, err = io.ReadAll(os.Stdin)
+			default:
+				return stderrors.New("pass the file with the stack trace, or pipe it to cwc explain-error")
+			}
+
+			if err != nil {
+				return fmt.Errorf("error reading the stack trace: %w", err)
+			}
+
+			trace := strings.TrimSpace(string(input))
+			if trace == "" {
+				return stderrors.New("the stack trace is empty")
+			}
+
+			return explainError(trace, linesFlag, maxRegionsFlag)
+		},
+	}
+
+	cmd.Flags().IntVar(&linesFlag, "lines", 15, "the lines to include before and after each location")          //nolint:gomnd
+	cmd.Flags().IntVar(&maxRegionsFlag, "max-regions", 12, "the most regions of code to send, innermost first") //nolint:gomnd
+
+	return cmd
+}
+
+func explainError(trace string, radius, maxRegions int) error {
+	userConfig, err := config.LoadConfigOrDefault()
+	if err != nil {
+		return fmt.Errorf("error reading config: %w", err)
+	}
+
+	filter, err := newContextFilter(userConfig)
+	if err != nil {
+		return err
+	}
+
+	known, _ := changes.Files()
+
+	locations := diagnostics.Parse(trace, known)
+	if len(locations) == 0 {
+		ui.PrintMessage("warning: the stack trace names no files in the repository, explaining it on its own\n",
+			ui.MessageTypeWarning)
+	}
+
+	regions, err := diagnostics.Regions(locations, radius)
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	// stack traces list the innermost frame, closest to the cause, first
+	if maxRegions > 0 && len(regions) > maxRegions {
+		regions = regions[:maxRegions]
+	}
+
+	if len(trace) > maxFixInput {
+		trace = trace[:maxFixInput] + "\n[output truncated]"
+	}
+
+	trace, ok := filter.apply("the stack trace", trace)
+	if !ok {
+		return stderrors.New("not sending the stack trace as it contains secrets")
+	}
+
+	var excerpts strings.Builder
+
+	paths := make([]string, 0, len(regions))
+
+	for i := range regions {
+		region := &regions[i]
+
+		source := fmt.Sprintf("%s:%d-%d", region.Path, region.Start, region.End)
+
+		code, ok := filter.apply(source, region.Format())
+		if !ok {
+			continue
+		}
+
+		var label string
+		if name, ok := languages.Detect(region.Path); ok {
+			label = languages.FenceLabel(name)
+		}
+
+		fmt.Fprintf(&excerpts, "%s, lines %d to %d:\n```%s\n%s```\n\n", region.Path, region.Start, region.End, label, code)
+
+		paths = append(paths, source)
+	}
+
+	audit.SetFiles(diagnostics.Files(locations))
+
+	if len(paths) > 0 {
+		ui.PrintMessage(fmt.Sprintf("sending %s\n", strings.Join(paths, ", ")), ui.MessageTypeInfo)
+	}
+
+	hookRunner, err := newRepoHooks()
+	if err != nil {
+		return err
+	}
+
+	systemMessage := "The code of the repository the stack trace points to, with line numbers. The lines named " +
+		"in the trace are marked with >.\n\n" + excerpts.String()
+
+	return nonInteractive(systemMessage, explainErrorPrompt(trace), &chatOptions{hooks: hookRunner})
+}
+
+func explainErrorPrompt(trace string) string {
+	return "Explain the likely root cause of this error, using the code in the context. Follow the trace from " +
+		"where it failed back to where the bad state came from, naming the files, lines and values involved, " +
+		"and say how sure you are when the code leaves it open. Then suggest a fix, with the code to change, " +
+		"and how to check it.\n\n```\n" + trace + "\n```"
+}
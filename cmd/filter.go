@@ -0,0 +1,212 @@
+package cmd
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/emilkje/cwc/pkg/config"
+	"github.com/emilkje/cwc/pkg/datasample"
+	"github.com/emilkje/cwc/pkg/redact"
+	"github.com/emilkje/cwc/pkg/ui"
+)
+
+const (
+	secretsRedact = "redact"
+	secretsBlock  = "block"
+	secretsOff    = "off"
+
+	injectionWarn       = "warn"
+	injectionNeutralize = "neutralize"
+	injectionBlock      = "block"
+	injectionOff        = "off"
+)
+
+// contextFilter removes sensitive data from everything sent to the model.
+type contextFilter struct {
+	secrets      *redact.Redactor
+	blockSecrets bool
+	pii          *redact.Redactor
+	// injection finds text aimed at the model, which is masked if
+	// neutralizeInjection is set and withheld if blockInjection is set.
+	injection           *redact.Redactor
+	neutralizeInjection bool
+	blockInjection      bool
+	// stripNotebookOutputs leaves the outputs of notebook cells out of the
+	// context.
+	stripNotebookOutputs bool
+	// dataSample controls which data files are included as a sample.
+	dataSample *datasample.Options
+	// repoMap includes an overview of the repository in the context.
+	repoMap bool
+	// warned holds the warnings printed, which are printed once rather
+	// than every time the system message is rebuilt from the files.
+	warned   map[string]bool
+	warnedMu sync.Mutex
+}
+
+func newContextFilter(cfg *config.Config) (*contextFilter, error) {
+	filter := &contextFilter{stripNotebookOutputs: cfg.StripNotebookOutputs, repoMap: cfg.RepoMap}
+
+	if cfg.DataSample != nil {
+		filter.dataSample = &datasample.Options{
+			ThresholdBytes: cfg.DataSample.ThresholdBytes,
+			Rows:           cfg.DataSample.Rows,
+		}
+	}
+
+	switch cfg.Secrets {
+	case "", secretsRedact:
+		filter.secrets = redact.NewSecretRedactor()
+	case secretsBlock:
+		filter.secrets = redact.NewSecretRedactor()
+		filter.blockSecrets = true
+	case secretsOff:
+	default:
+		return nil, fmt.Errorf("unknown secrets mode %q, use %q, %q or %q",
+			cfg.Secrets, secretsRedact, secretsBlock, secretsOff)
+	}
+
+	switch cfg.PromptInjection {
+	case "", injectionWarn:
+		filter.injection = redact.NewInjectionRedactor()
+	case injectionNeutralize:
+		filter.injection = redact.NewInjectionRedactor()
+		filter.neutralizeInjection = true
+	case injectionBlock:
+		filter.injection = redact.NewInjectionRedactor()
+		filter.blockInjection = true
+	case injectionOff:
+	default:
+		return nil, fmt.Errorf("unknown promptInjection mode %q, use %q, %q, %q or %q", cfg.PromptInjection,
+			injectionWarn, injectionNeutralize, injectionBlock, injectionOff)
+	}
+
+	if cfg.PII != nil && cfg.PII.Enabled {
+		pii, err := redact.NewPIIRedactor(cfg.PII.Patterns)
+		if err != nil {
+			return nil, fmt.Errorf("error in pii config: %w", err)
+		}
+
+		filter.pii = pii
+	}
+
+	return filter, nil
+}
+
+// dataSampleOptions returns the options for sampling data files, nil
+// meaning the defaults.
+func (f *contextFilter) dataSampleOptions() *datasample.Options {
+	if f == nil {
+		return nil
+	}
+
+	return f.dataSample
+}
+
+// apply filters text originating from source, such as a file path, and
+// warns about anything that was found. It returns false if the text must be
+// withheld entirely.
+func (f *contextFilter) apply(source, text string) (string, bool) {
+	if f == nil {
+		return text, true
+	}
+
+	redacted, secrets := f.secrets.Redact(text)
+	if len(secrets) > 0 && f.blockSecrets {
+		f.warn(fmt.Sprintf("warning: withheld %s, it contains %s\n",
+			source, redact.Summarize(secrets, "secret")))
+
+		return "", false
+	}
+
+	redacted, pii := f.pii.Redact(redacted)
+
+	if summary := summarizeFindings(secrets, pii); summary != "" {
+		f.warn(fmt.Sprintf("warning: redacted %s in %s\n", summary, source))
+	}
+
+	return f.checkInjection(source, redacted)
+}
+
+// checkInjection warns about text in the content from source that looks
+// aimed at the model, and masks it or withholds the content if configured
+// to. It returns false if the content must be withheld.
+func (f *contextFilter) checkInjection(source, text string) (string, bool) {
+	neutralized, findings := f.injection.Redact(text)
+	if len(findings) == 0 {
+		return text, true
+	}
+
+	summary := redact.Summarize(findings, "possible prompt injection")
+	lines := make([]string, 0, len(findings))
+
+	for _, finding := range findings {
+		lines = append(lines, strconv.Itoa(finding.Line))
+	}
+
+	switch {
+	case f.blockInjection:
+		f.warn(fmt.Sprintf("warning: withheld %s, it contains %s on line %s\n",
+			source, summary, strings.Join(lines, ", ")))
+
+		return "", false
+	case f.neutralizeInjection:
+		f.warn(fmt.Sprintf("warning: masked %s in %s on line %s\n", summary, source, strings.Join(lines, ", ")))
+
+		return neutralized, true
+	}
+
+	f.warn(fmt.Sprintf("warning: %s contains %s on line %s, check it before the model acts on it\n",
+		source, summary, strings.Join(lines, ", ")))
+
+	return text, true
+}
+
+// warn prints a warning about filtered content unless it was printed
+// before.
+func (f *contextFilter) warn(message string) {
+	f.warnedMu.Lock()
+	defer f.warnedMu.Unlock()
+
+	if f.warned[message] {
+		return
+	}
+
+	if f.warned == nil {
+		f.warned = map[string]bool{}
+	}
+
+	f.warned[message] = true
+
+	ui.PrintMessage(message, ui.MessageTypeWarning)
+}
+
+// redactPrompt masks secrets and personal data in a message typed or pasted
+// by the user and returns a summary of what was masked, if anything. Unlike
+// files, messages are never withheld, as the user can see what they send.
+func (f *contextFilter) redactPrompt(text string) (string, string) {
+	if f == nil {
+		return text, ""
+	}
+
+	redacted, secrets := f.secrets.Redact(text)
+	redacted, pii := f.pii.Redact(redacted)
+
+	return redacted, summarizeFindings(secrets, pii)
+}
+
+func summarizeFindings(secrets, pii []redact.Finding) string {
+	var parts []string
+
+	if len(secrets) > 0 {
+		parts = append(parts, redact.Summarize(secrets, "secret"))
+	}
+
+	if len(pii) > 0 {
+		parts = append(parts, redact.Summarize(pii, "personal data value"))
+	}
+
+	return strings.Join(parts, " and ")
+}
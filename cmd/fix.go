@@ -0,0 +1,325 @@
+package cmd
+
+import (
+	stderrors "errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"runtime"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+
+	"github.com/emilkje/cwc/pkg/changes"
+	"github.com/emilkje/cwc/pkg/chat"
+	"github.com/emilkje/cwc/pkg/config"
+	"github.com/emilkje/cwc/pkg/diagnostics"
+	"github.com/emilkje/cwc/pkg/edits"
+	"github.com/emilkje/cwc/pkg/filetree"
+	"github.com/emilkje/cwc/pkg/providers"
+	"github.com/emilkje/cwc/pkg/ui"
+)
+
+const (
+	// maxFixInput is how much of the build output is sent, keeping the
+	// start, where the first errors are.
+	maxFixInput = 32000
+	// fixAttempts is how often a fix is asked for when the diff doesn't
+	// apply.
+	fixAttempts = 3
+)
+
+func createFixCmd() *cobra.Command {
+	var (
+		maxFilesFlag int
+		withDepsFlag bool
+		verifyFlag   string
+		formatFlag   string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "fix",
+		Short: "Turn compiler and test errors from stdin into a patch",
+		Long: "Fix reads the output of a build, test run or linter from stdin, finds the files and lines the errors\n" +
+			"point to, and sends the output with those files to the model, asking for a fix as a diff. The diff\n" +
+			"is shown and applied once confirmed, just like /apply in a chat. Errors in Go, TypeScript, Rust,\n" +
+			"C, Java, Kotlin and Python output are recognized.",
+		Example: "  go build ./... 2>&1 | cwc fix\n" +
+			"  go test ./pkg/... 2>&1 | cwc fix --with-deps\n" +
+			"  go build ./... 2>&1 | cwc fix --verify 'go build ./...'",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if !isPiped(os.Stdin) {
+				return stderrors.New("pipe the build output to cwc fix, like go build ./... 2>&1 | cwc fix")
+			}
+
+			input, err := io.ReadAll(os.Stdin)
+			if err != nil {
+				return fmt.Errorf("error reading from stdin: %w", err)
+			}
+
+			output := strings.TrimSpace(string(input))
+			if output == "" {
+				return stderrors.New("the input is empty, nothing to fix")
+			}
+
+			// confirming the fix needs the terminal, as stdin is taken
+			reopenTerminal()
+
+			files, err := implicatedFiles(output, maxFilesFlag, withDepsFlag)
+			if err != nil {
+				return err
+			}
+
+			verify, err := newVerifier(verifyFlag)
+			if err != nil {
+				return err
+			}
+
+			format, err := resolveEditFormat(formatFlag)
+			if err != nil {
+				return err
+			}
+
+			return fixErrors(output, files, maxFilesFlag, verify, format)
+		},
+	}
+
+	cmd.Flags().IntVar(&maxFilesFlag, "max-files", 20, "the most files to send, in the order the errors name them") //nolint:gomnd
+	cmd.Flags().BoolVar(&withDepsFlag, "with-deps", false, "include the files the implicated files import")
+	cmd.Flags().StringVar(&verifyFlag, "verify", "",
+		"run the given shell command after the fix is applied and ask for another fix while it fails, "+
+			"defaults to verify.command in .cwc/config.yaml")
+	cmd.Flags().StringVar(&formatFlag, "edit-format", "",
+		"how the fix is asked for, diff or search-replace, defaults to editFormat in the config file")
+
+	return cmd
+}
+
+// implicatedFiles loads the files the errors in the output point to.
+func implicatedFiles(output string, maxFiles int, withDeps bool) ([]filetree.File, error) {
+	// go test names files without their directory, so they are looked up
+	// among the files of the repository
+	known, _ := changes.Files()
+
+	paths := diagnostics.Files(diagnostics.Parse(output, known))
+	if len(paths) == 0 {
+		return nil, stderrors.New("no error locations found in the input")
+	}
+
+	if maxFiles > 0 && len(paths) > maxFiles {
+		ui.PrintMessage(fmt.Sprintf("warning: the errors name %d files, sending the first %d\n", len(paths), maxFiles),
+			ui.MessageTypeWarning)
+		paths = paths[:maxFiles]
+	}
+
+	if withDeps {
+		paths = append(paths, changes.Dependencies(paths)...)
+	}
+
+	files := make([]filetree.File, 0, len(paths))
+
+	for _, path := range paths {
+		file, err := filetree.LoadFile(path)
+		if err != nil {
+			slog.Warn("skipping file", "path", path, "error", err)
+			continue
+		}
+
+		files = append(files, *file)
+	}
+
+	if len(files) == 0 {
+		return nil, stderrors.New("none of the files named in the errors could be loaded")
+	}
+
+	return files, nil
+}
+
+// fixErrors asks for edits in the format fixing the errors, asking again with
+// the reason when they don't apply, and applies them once confirmed. With a
+// verifier, the fix is verified and what still fails is sent for another fix.
+func fixErrors(output string, files []filetree.File, maxFiles int, verify *verifier, format string) error {
+	userConfig, err := config.LoadConfigOrDefault()
+	if err != nil {
+		return fmt.Errorf("error reading config: %w", err)
+	}
+
+	filter, err := newContextFilter(userConfig)
+	if err != nil {
+		return err
+	}
+
+	if len(output) > maxFixInput {
+		output = output[:maxFixInput] + "\n[output truncated]"
+	}
+
+	output, ok := filter.apply("the build output", output)
+	if !ok {
+		return stderrors.New("not sending the build output as it contains secrets")
+	}
+
+	clientConfig, err := newClientConfig()
+	if err != nil {
+		return err
+	}
+
+	paths := make([]string, len(files))
+	for i, file := range files {
+		paths[i] = file.Path
+	}
+
+	ui.PrintMessage(fmt.Sprintf("sending %s\n", strings.Join(paths, ", ")), ui.MessageTypeInfo)
+
+	session := chat.NewSession(providers.New(clientConfig), chat.SystemMessage(createSystemMessageFromFiles(files, filter)))
+	prompt := fixPrompt(output, format)
+
+	for attempt := 1; ; attempt++ {
+		planned, err := proposeFix(session, prompt, files, format)
+		if err != nil {
+			return err
+		}
+
+		if !term.IsTerminal(int(os.Stdin.Fd())) {
+			ui.PrintMessage("not applying the fix as there is no terminal to confirm it in\n", ui.MessageTypeWarning)
+			return nil
+		}
+
+		if !confirmEdits(planned, "Apply the fix?") {
+			ui.PrintMessage("nothing was changed\n", ui.MessageTypeInfo)
+			return nil
+		}
+
+		if err := writeEdits(planned); err != nil {
+			return err
+		}
+
+		if verify == nil {
+			ui.PrintMessage(fmt.Sprintf("applied the fix to %d files, run the build again to check it\n", len(planned)),
+				ui.MessageTypeSuccess)
+
+			return nil
+		}
+
+		ui.PrintMessage(fmt.Sprintf("applied the fix to %d files\n", len(planned)), ui.MessageTypeSuccess)
+
+		output, ok := verify.run()
+		if ok {
+			ui.PrintMessage(fmt.Sprintf("%s succeeded\n", verify.command), ui.MessageTypeSuccess)
+			return nil
+		}
+
+		if attempt > verify.attempts {
+			return fmt.Errorf("%s still fails after %d attempts to fix it:\n%s", verify.command, verify.attempts, output)
+		}
+
+		ui.PrintMessage(fmt.Sprintf("%s failed:\n%s\n", verify.command, output), ui.MessageTypeWarning)
+
+		if output, ok = filter.apply("the build output", output); !ok {
+			return stderrors.New("not sending the build output as it contains secrets")
+		}
+
+		// the diff of the next fix is made against the files as they are now,
+		// and the new errors may point to other files
+		files = reloadFixFiles(files, output, maxFiles)
+		session.SetSystemMessage(createSystemMessageFromFiles(files, filter))
+		prompt = verifyPrompt(verify.command, output, format)
+	}
+}
+
+// proposeFix asks for edits and asks again with the reason when they don't
+// apply. The edits that apply are printed.
+func proposeFix(session *chat.Session, prompt string, files []filetree.File, format string) ([]plannedEdit, error) {
+	var (
+		reply   string
+		planned []plannedEdit
+		err     error
+	)
+
+	for attempt := 1; attempt <= fixAttempts; attempt++ {
+		spinner := ui.NewSpinner(ui.T("chat.thinking"))
+		spinner.Start()
+
+		reply, err = collectReply(session, prompt)
+
+		spinner.Stop()
+
+		if err != nil {
+			return nil, err
+		}
+
+		if planned, err = planEdits(reply, files); err == nil && len(planned) > 0 {
+			break
+		}
+
+		if err == nil {
+			err = stderrors.New("the reply contains no changes")
+		}
+
+		ui.PrintMessage(fmt.Sprintf("the fix doesn't apply: %s\n", err), ui.MessageTypeWarning)
+
+		prompt = fmt.Sprintf("The changes could not be applied: %s. Reply with the corrected changes %s.", err,
+			edits.Instruction(format))
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("no fix that applies after %d attempts: %w", fixAttempts, err)
+	}
+
+	ui.PrintMessage(reply+"\n", ui.MessageTypeInfo)
+
+	return planned, nil
+}
+
+// reloadFixFiles reads the files again after a fix, adding those the errors
+// in the output point to.
+func reloadFixFiles(files []filetree.File, output string, maxFiles int) []filetree.File {
+	reloaded := make([]filetree.File, 0, len(files))
+	seen := make(map[string]bool, len(files))
+
+	for _, file := range files {
+		if current, err := filetree.LoadFile(file.Path); err == nil {
+			reloaded = append(reloaded, *current)
+			seen[file.Path] = true
+		}
+	}
+
+	implicated, err := implicatedFiles(output, maxFiles, false)
+	if err != nil {
+		return reloaded
+	}
+
+	for _, file := range implicated {
+		if !seen[file.Path] {
+			reloaded = append(reloaded, file)
+		}
+	}
+
+	return reloaded
+}
+
+func fixPrompt(output, format string) string {
+	return "The build or test run failed with the output below. Find the cause of the errors in the files in the " +
+		"context and fix them with the smallest change that keeps the intent of the code; don't silence errors " +
+		"by deleting tests or code. Explain the cause in a sentence or two, then reply with the fix " +
+		edits.Instruction(format) + ".\n\n```\n" + output + "\n```"
+}
+
+// reopenTerminal points stdin at the terminal after piped input has been
+// read, so questions can still be answered. stdin is left as is when there
+// is no terminal.
+func reopenTerminal() {
+	name := "/dev/tty"
+	if runtime.GOOS == "windows" {
+		name = "CONIN$"
+	}
+
+	tty, err := os.Open(name)
+	if err != nil {
+		return
+	}
+
+	os.Stdin = tty
+}
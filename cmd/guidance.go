@@ -0,0 +1,35 @@
+package cmd
+
+import (
+	stderrors "errors"
+
+	"github.com/emilkje/cwc/pkg/errors"
+	"github.com/emilkje/cwc/pkg/ui"
+)
+
+// errorGuidance suggests what the user can do about an error, or returns ""
+// if there is nothing specific to suggest.
+func errorGuidance(err error) string {
+	var quotaErr errors.QuotaExceededError
+
+	switch {
+	case err == nil:
+		return ""
+	case errors.IsAuthError(err):
+		return ui.T("guidance.auth")
+	case stderrors.As(err, &quotaErr) && quotaErr.RateLimited:
+		return ui.T("guidance.rate-limited")
+	case stderrors.As(err, &quotaErr):
+		return ui.T("guidance.quota")
+	case errors.IsModelNotFoundError(err):
+		return ui.T("guidance.model-not-found")
+	case errors.IsContextLengthExceededError(err):
+		return ui.T("guidance.context-length")
+	case errors.IsOfflineError(err):
+		return ui.T("guidance.offline")
+	case errors.IsNetworkTimeoutError(err):
+		return ui.T("guidance.timeout")
+	}
+
+	return ""
+}
@@ -0,0 +1,34 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/emilkje/cwc/pkg/config"
+	"github.com/emilkje/cwc/pkg/hooks"
+	"github.com/emilkje/cwc/pkg/pathmatcher"
+)
+
+// newRepoHooks creates the runner for the hooks configured for the current
+// repository, once the user trusts them.
+func newRepoHooks() (*hooks.Runner, error) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return nil, fmt.Errorf("error getting current directory: %w", err)
+	}
+
+	root := pathmatcher.FindRepositoryRoot(cwd)
+
+	repoConfig, err := config.LoadRepoConfig(root)
+	if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+
+	if h := repoConfig.Hooks; h != nil && len(h.PreContext)+len(h.PreSend)+len(h.PostResponse) > 0 {
+		if err := confirmRepoCommands(root, repoConfig); err != nil {
+			return nil, err
+		}
+	}
+
+	return hooks.New(repoConfig.Hooks, root) //nolint:wrapcheck
+}
@@ -0,0 +1,452 @@
+package cmd
+
+import (
+	"context"
+	stderrors "errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+	"github.com/spf13/cobra"
+
+	"github.com/emilkje/cwc/pkg/chat"
+	"github.com/emilkje/cwc/pkg/config"
+	"github.com/emilkje/cwc/pkg/index"
+	"github.com/emilkje/cwc/pkg/pathmatcher"
+	"github.com/emilkje/cwc/pkg/ui"
+)
+
+// defaultWatchInterval is how often cwc index --watch checks for changes.
+const defaultWatchInterval = 5 * time.Second
+
+func createIndexCmd() *cobra.Command {
+	cmd := createIndexUpdateCmd("index", false)
+	cmd.Short = "Build or update the embedding index of the repository"
+	cmd.Long = "Index embeds the files of the repository in chunks and stores the result in " + index.DefaultPath + ",\n" +
+		"or on the index server configured in " + config.RepoConfigPath + ".\n" +
+		"Subsequent runs only embed the files that were added or changed and drop the ones that were deleted,\n" +
+		"so keeping the index up to date on a large repository is cheap.\n" +
+		"The embedding model deployment is set with embeddingDeployment in the config file, or another\n" +
+		"provider for it with cwc login embedding."
+
+	rebuildCmd := createIndexUpdateCmd("rebuild", true)
+	rebuildCmd.Short = "Discard the index and embed every file again"
+
+	cmd.AddCommand(createIndexStatusCmd())
+	cmd.AddCommand(rebuildCmd)
+	cmd.AddCommand(createIndexClearCmd())
+	cmd.AddCommand(createIndexGCCmd())
+	cmd.AddCommand(createIndexInstallHookCmd())
+
+	return cmd
+}
+
+// createIndexUpdateCmd creates a command updating the index with the files
+// selected by the filter flags, starting over if rebuild is set. Unless
+// rebuild is set, it can also be asked to with --rebuild.
+func createIndexUpdateCmd(use string, rebuild bool) *cobra.Command {
+	var (
+		includeFlag              string
+		excludeFlag              string
+		pathsFlag                []string
+		langFlag                 []string
+		ignoreFilesFlag          []string
+		filesFlag                []string
+		ownedByFlag              []string
+		changedSinceFlag         string
+		withDepsFlag             bool
+		workspaceFlag            string
+		excludeFromGitignoreFlag bool
+		excludeGitDirFlag        bool
+		includeThirdPartyFlag    bool
+		rebuildFlag              bool
+		watchFlag                bool
+		intervalFlag             time.Duration
+		metricsAddrFlag          string
+	)
+
+	cmd := &cobra.Command{
+		Use:  use,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			opts := &chatOptions{
+				includeFlag:              includeFlag,
+				excludeFlag:              excludeFlag,
+				pathsFlag:                pathsFlag,
+				langFlag:                 langFlag,
+				ignoreFilesFlag:          ignoreFilesFlag,
+				filesFlag:                filesFlag,
+				ownedByFlag:              ownedByFlag,
+				changedSinceFlag:         changedSinceFlag,
+				withDepsFlag:             withDepsFlag,
+				workspaceFlag:            workspaceFlag,
+				excludeFromGitignoreFlag: excludeFromGitignoreFlag,
+				excludeGitDirFlag:        excludeGitDirFlag,
+				includeThirdPartyFlag:    includeThirdPartyFlag,
+			}
+
+			if metricsAddrFlag != "" && !watchFlag {
+				return stderrors.New("--metrics-addr requires --watch")
+			}
+
+			if watchFlag {
+				if rebuild || rebuildFlag {
+					return stderrors.New("--watch can't be combined with a rebuild, rebuild the index first")
+				}
+
+				return watchIndex(opts, intervalFlag, metricsAddrFlag)
+			}
+
+			return updateIndex(opts, rebuild || rebuildFlag)
+		},
+	}
+
+	initFlags(cmd, &flags{
+		includeFlag:              &includeFlag,
+		excludeFlag:              &excludeFlag,
+		pathsFlag:                &pathsFlag,
+		langFlag:                 &langFlag,
+		ignoreFilesFlag:          &ignoreFilesFlag,
+		filesFlag:                &filesFlag,
+		ownedByFlag:              &ownedByFlag,
+		changedSinceFlag:         &changedSinceFlag,
+		withDepsFlag:             &withDepsFlag,
+		workspaceFlag:            &workspaceFlag,
+		excludeFromGitignoreFlag: &excludeFromGitignoreFlag,
+		excludeGitDirFlag:        &excludeGitDirFlag,
+		includeThirdPartyFlag:    &includeThirdPartyFlag,
+	})
+
+	if !rebuild {
+		cmd.Flags().BoolVar(&rebuildFlag, "rebuild", false, "discard the existing index")
+		cmd.Flag("rebuild").Usage = "Discard the existing index and embed every file again, same as cwc index rebuild"
+		cmd.Flags().BoolVar(&watchFlag, "watch", false,
+			"Keep running and update the index whenever files change, checking every --interval")
+		cmd.Flags().DurationVar(&intervalFlag, "interval", defaultWatchInterval, "How often --watch checks for changes")
+		cmd.Flags().StringVar(&metricsAddrFlag, "metrics-addr", "",
+			"With --watch, serve Prometheus metrics on /metrics at the given address, e.g. :9090")
+	}
+
+	return cmd
+}
+
+func createIndexStatusCmd() *cobra.Command {
+	var verboseFlag bool
+
+	cmd := &cobra.Command{
+		Use:   "status",
+		Short: "Show where the index is stored, its size and how far it is behind the working tree",
+		Long: "Status shows where the index is stored, the embedding model it was built with, the number of files\n" +
+			"and chunks embedded and the storage they take, and which indexed files changed or were deleted since\n" +
+			"they were indexed. Nothing is sent to the embedding provider.",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return printIndexStatus(verboseFlag)
+		},
+	}
+
+	cmd.Flags().BoolVarP(&verboseFlag, "verbose", "v", false, "list the changed and deleted files")
+
+	return cmd
+}
+
+func createIndexClearCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "clear",
+		Short: "Delete every embedding from the index",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := context.Background()
+
+			store, err := openIndexStore()
+			if err != nil {
+				return err
+			}
+
+			if err := store.Reset(ctx, ""); err != nil {
+				return fmt.Errorf("error clearing index: %w", err)
+			}
+
+			if err := store.Flush(ctx); err != nil {
+				return fmt.Errorf("error saving index: %w", err)
+			}
+
+			ui.PrintMessage(fmt.Sprintf("cleared the index at %s\n", store.Location()), ui.MessageTypeSuccess)
+
+			return nil
+		},
+	}
+}
+
+func createIndexGCCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "gc",
+		Short: "Drop the files that no longer exist from the index",
+		Long: "Gc drops the embeddings of files that were deleted since they were indexed, without embedding\n" +
+			"anything. Run cwc index to also embed the files that were added or changed.",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := context.Background()
+
+			store, err := openIndexStore()
+			if err != nil {
+				return err
+			}
+
+			pruned, pruneErr := index.Prune(ctx, store)
+
+			if err := store.Flush(ctx); err != nil {
+				return fmt.Errorf("error saving index: %w", err)
+			}
+
+			if pruneErr != nil {
+				return fmt.Errorf("error pruning index: %w", pruneErr)
+			}
+
+			ui.PrintMessage(fmt.Sprintf("dropped %d deleted files from the index\n", pruned), ui.MessageTypeSuccess)
+
+			return nil
+		},
+	}
+}
+
+func printIndexStatus(verbose bool) error {
+	store, err := openIndexStore()
+	if err != nil {
+		return err
+	}
+
+	status, err := index.Inspect(context.Background(), store)
+	if err != nil {
+		return fmt.Errorf("error reading index: %w", err)
+	}
+
+	model := status.Model
+	if model == "" {
+		model = "none, the index is empty"
+	}
+
+	var out strings.Builder
+
+	fmt.Fprintf(&out, "location: %s\n", status.Location)
+	fmt.Fprintf(&out, "model:    %s\n", model)
+	fmt.Fprintf(&out, "files:    %d (%d chunks)\n", status.Files, status.Chunks)
+	fmt.Fprintf(&out, "size:     %s\n", ui.FormatBytes(status.Size))
+
+	if len(status.Changed) == 0 && len(status.Deleted) == 0 {
+		out.WriteString("stale:    none, every indexed file is up to date\n")
+		ui.PrintMessage(out.String(), ui.MessageTypeInfo)
+
+		return nil
+	}
+
+	fmt.Fprintf(&out, "stale:    %d changed and %d deleted since they were indexed, run cwc index to update\n",
+		len(status.Changed), len(status.Deleted))
+
+	if verbose {
+		for _, path := range status.Changed {
+			fmt.Fprintf(&out, "  changed: %s\n", path)
+		}
+
+		for _, path := range status.Deleted {
+			fmt.Fprintf(&out, "  deleted: %s\n", path)
+		}
+	}
+
+	ui.PrintMessage(out.String(), ui.MessageTypeInfo)
+
+	return nil
+}
+
+func updateIndex(opts *chatOptions, rebuild bool) error {
+	embedder, err := newEmbedder()
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+
+	store, err := openIndexStore()
+	if err != nil {
+		return err
+	}
+
+	if rebuild {
+		if err := store.Reset(ctx, ""); err != nil {
+			return fmt.Errorf("error clearing index: %w", err)
+		}
+	}
+
+	stats, err := runIndexUpdate(ctx, opts, store, embedder)
+	if err != nil {
+		return err
+	}
+
+	ui.PrintMessage(formatUpdateStats(stats), ui.MessageTypeSuccess)
+
+	return nil
+}
+
+// watchIndex updates the index every interval until interrupted. Each round
+// only embeds what changed since the previous one, so an idle repository
+// costs nothing but a walk of its files. Failed rounds, such as when the
+// network is down, are reported and retried in the next round. The rounds
+// are counted in the metrics served on metricsAddr, if set.
+func watchIndex(opts *chatOptions, interval time.Duration, metricsAddr string) error {
+	embedder, err := newEmbedder()
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+
+	store, err := openIndexStore()
+	if err != nil {
+		return err
+	}
+
+	if metricsAddr != "" {
+		if err := serveMetrics(metricsAddr); err != nil {
+			return err
+		}
+	}
+
+	ui.PrintMessage(fmt.Sprintf("watching for changes every %s, press ctrl+c to stop\n", interval), ui.MessageTypeNotice)
+
+	for {
+		started := time.Now()
+		stats, err := runIndexUpdate(ctx, opts, store, embedder)
+		recordIndexMetrics(ctx, store, stats, err, time.Since(started))
+
+		switch {
+		case err != nil:
+			slog.Error("error updating index", "error", err)
+		case stats.Added+stats.Modified+stats.Deleted > 0:
+			ui.PrintMessage(time.Now().Format(time.TimeOnly)+": "+formatUpdateStats(stats), ui.MessageTypeSuccess)
+		}
+
+		time.Sleep(interval)
+	}
+}
+
+// runIndexUpdate brings the store in line with the files selected by opts
+// and saves it, also when the update fails part of the way.
+func runIndexUpdate(ctx context.Context, opts *chatOptions, store index.Store, embedder index.Embedder,
+) (*index.UpdateStats, error) {
+	files, _, err := gatherContext(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	auditFiles(files)
+
+	// only the files below the scanned paths are dropped when they are gone
+	scope := opts.pathsFlag
+	if opts.workspaceFlag != "" {
+		if scope, _, err = workspaceScope(opts.workspaceFlag); err != nil {
+			return nil, err
+		}
+	}
+
+	progress := ui.NewProgressLine()
+
+	stats, updateErr := index.Update(ctx, store, embedder, files, scope, func(done, total int) {
+		progress.Update(fmt.Sprintf("indexing files: %d/%d", done, total))
+	})
+
+	progress.Done()
+
+	// save whatever was indexed so an interrupted run doesn't start over
+	if err := store.Flush(ctx); err != nil {
+		return nil, fmt.Errorf("error saving index: %w", err)
+	}
+
+	if updateErr != nil {
+		updateErr = chat.ClassifyError(updateErr, embedder.Model())
+		if guidance := errorGuidance(updateErr); guidance != "" {
+			ui.PrintMessage(guidance+"\n", ui.MessageTypeNotice)
+		}
+
+		return nil, updateErr //nolint:wrapcheck
+	}
+
+	return stats, nil
+}
+
+func formatUpdateStats(stats *index.UpdateStats) string {
+	return fmt.Sprintf("index updated: %d added, %d modified, %d deleted, %d unchanged (%d chunks embedded)\n",
+		stats.Added, stats.Modified, stats.Deleted, stats.Unchanged, stats.Chunks)
+}
+
+// newEmbedder creates the embedder of the embedding provider in the config
+// file, which defaults to the chat provider, once the user agreed to send
+// code to it.
+func newEmbedder() (*index.OpenAIEmbedder, error) {
+	clientConfig, model, err := config.NewEmbeddingClientConfig()
+	if err != nil {
+		return nil, fmt.Errorf("error reading config: %w", err)
+	}
+
+	if err := confirmEgress(clientConfig.BaseURL); err != nil {
+		return nil, err
+	}
+
+	return index.NewOpenAIEmbedder(openai.NewClientWithConfig(clientConfig), model), nil
+}
+
+// openIndexStore opens the index store configured for the current
+// repository, the local index file unless another backend is configured.
+func openIndexStore() (index.Store, error) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return nil, fmt.Errorf("error getting current directory: %w", err)
+	}
+
+	root := pathmatcher.FindRepositoryRoot(cwd)
+
+	repoConfig, err := config.LoadRepoConfig(root)
+	if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+
+	indexConfig := repoConfig.Index
+	if indexConfig == nil {
+		indexConfig = &config.IndexConfig{}
+	}
+
+	switch indexConfig.Backend {
+	case "", "local":
+		store, err := index.OpenLocalStore(index.DefaultPath)
+		if err != nil {
+			return nil, fmt.Errorf("error loading index: %w", err)
+		}
+
+		return store, nil
+	case "qdrant":
+		if indexConfig.URL == "" {
+			return nil, stderrors.New("the qdrant index backend requires index.url in " + config.RepoConfigPath)
+		}
+
+		if err := confirmEgress(indexConfig.URL); err != nil {
+			return nil, err
+		}
+
+		collection := indexConfig.Collection
+		if collection == "" {
+			collection = filepath.Base(root)
+		}
+
+		var apiKey string
+		if indexConfig.APIKeyEnv != "" {
+			apiKey = os.Getenv(indexConfig.APIKeyEnv)
+		}
+
+		return index.NewQdrantStore(config.HTTPClient(), indexConfig.URL, collection, apiKey), nil
+	default:
+		return nil, fmt.Errorf("unknown index backend %q, use %q or %q", indexConfig.Backend, "local", "qdrant")
+	}
+}
@@ -0,0 +1,163 @@
+package cmd
+
+import (
+	stderrors "errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/emilkje/cwc/pkg/changes"
+	"github.com/emilkje/cwc/pkg/ui"
+)
+
+// indexHookMarker ends the line cwc adds to git hooks, so that it can be
+// found again without touching the rest of the hook.
+const indexHookMarker = "# added by cwc index install-hook"
+
+// indexHooks are the git hooks that run after the working tree changes.
+var indexHooks = []string{"post-commit", "post-merge", "post-checkout"} //nolint:gochecknoglobals
+
+func createIndexInstallHookCmd() *cobra.Command {
+	var uninstallFlag bool
+
+	cmd := &cobra.Command{
+		Use:   "install-hook [-- index flags]",
+		Short: "Update the index in the background after every commit, merge and checkout",
+		Long: "Install-hook adds a line to the post-commit, post-merge and post-checkout hooks of the repository\n" +
+			"that runs cwc index in the background, so chats with --rag query fresh content. Existing hooks are\n" +
+			"kept and the line is added to their end. Flags after -- are passed on to cwc index.",
+		Example: "  cwc index install-hook\n" +
+			"  cwc index install-hook -- --lang go,markdown\n" +
+			"  cwc index install-hook --uninstall",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			dir, err := changes.HooksDir()
+			if err != nil {
+				return err //nolint:wrapcheck
+			}
+
+			for _, name := range indexHooks {
+				path := filepath.Join(dir, name)
+
+				if uninstallFlag {
+					err = removeIndexHook(path)
+				} else {
+					err = addIndexHook(path, args)
+				}
+
+				if err != nil {
+					return fmt.Errorf("error updating the %s hook: %w", name, err)
+				}
+			}
+
+			if uninstallFlag {
+				ui.PrintMessage(fmt.Sprintf("removed cwc index from the hooks in %s\n", dir), ui.MessageTypeSuccess)
+			} else {
+				ui.PrintMessage(fmt.Sprintf("added cwc index to the %s hooks in %s\n",
+					strings.Join(indexHooks, ", "), dir), ui.MessageTypeSuccess)
+			}
+
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&uninstallFlag, "uninstall", false, "remove the line added to the hooks")
+
+	return cmd
+}
+
+// addIndexHook adds the line running cwc index to the hook at path,
+// replacing the one added before, and creates the hook if needed. The
+// update runs in the background so git isn't held up by it.
+func addIndexHook(path string, args []string) error {
+	quoted := make([]string, 0, len(args))
+	for _, arg := range args {
+		quoted = append(quoted, shellQuote(arg))
+	}
+
+	command := strings.TrimSpace("cwc index " + strings.Join(quoted, " "))
+	line := fmt.Sprintf("(%s >/dev/null 2>&1 &) %s", command, indexHookMarker)
+
+	lines, err := readHookLines(path)
+	if err != nil {
+		return err
+	}
+
+	if len(lines) == 0 {
+		lines = []string{"#!/bin/sh"}
+	}
+
+	lines = append(withoutIndexHook(lines), line)
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil { //nolint:gomnd
+		return fmt.Errorf("error creating hooks directory: %w", err)
+	}
+
+	return writeHook(path, lines)
+}
+
+// removeIndexHook removes the line added by addIndexHook, and the hook if
+// nothing else is left in it.
+func removeIndexHook(path string) error {
+	lines, err := readHookLines(path)
+	if err != nil || len(lines) == 0 {
+		return err
+	}
+
+	lines = withoutIndexHook(lines)
+
+	if len(lines) == 1 && strings.HasPrefix(lines[0], "#!") {
+		if err := os.Remove(path); err != nil {
+			return fmt.Errorf("error removing hook: %w", err)
+		}
+
+		return nil
+	}
+
+	return writeHook(path, lines)
+}
+
+func readHookLines(path string) ([]string, error) {
+	data, err := os.ReadFile(path) // #nosec
+	if err != nil {
+		if stderrors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+
+		return nil, fmt.Errorf("error reading hook: %w", err)
+	}
+
+	return strings.Split(strings.TrimRight(string(data), "\n"), "\n"), nil
+}
+
+func withoutIndexHook(lines []string) []string {
+	kept := lines[:0:0]
+
+	for _, line := range lines {
+		if !strings.HasSuffix(line, indexHookMarker) {
+			kept = append(kept, line)
+		}
+	}
+
+	return kept
+}
+
+func writeHook(path string, lines []string) error {
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0o755); err != nil { //nolint:gomnd,gosec
+		return fmt.Errorf("error writing hook: %w", err)
+	}
+
+	return nil
+}
+
+// shellQuote quotes an argument for sh unless it only holds characters
+// that are safe unquoted.
+func shellQuote(arg string) string {
+	if arg != "" && strings.Trim(arg, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_=.,/:@") == "" {
+		return arg
+	}
+
+	return "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+}
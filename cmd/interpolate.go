@@ -0,0 +1,42 @@
+package cmd
+
+import (
+	"fmt"
+	"log/slog"
+
+	"github.com/emilkje/cwc/pkg/filetree"
+	"github.com/emilkje/cwc/pkg/interpolate"
+	"github.com/emilkje/cwc/pkg/ui"
+)
+
+// expandPrompt evaluates the template expressions in a message. Commands run
+// by {{exec}} must be confirmed, which is only possible when confirm is set.
+// A message whose expressions can't be evaluated is sent as written, with a
+// warning, since it may as well be a question about templates.
+func expandPrompt(message string, files []filetree.File, confirm bool) string {
+	expanded, err := interpolate.Expand(message, promptOptions(files, confirm))
+	if err != nil {
+		slog.Warn("sending the message as written", "error", err)
+		return message
+	}
+
+	return expanded
+}
+
+func promptOptions(files []filetree.File, confirm bool) *interpolate.Options {
+	opts := &interpolate.Options{}
+
+	if len(files) > 0 {
+		opts.FileTree = func() string {
+			return filetree.GenerateFileTree(filetree.NewFileTree(files), "", true)
+		}
+	}
+
+	if confirm {
+		opts.Confirm = func(command string) bool {
+			return ui.AskYesNo(fmt.Sprintf("Run %q for the message?", command), false)
+		}
+	}
+
+	return opts
+}
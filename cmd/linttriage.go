@@ -0,0 +1,256 @@
+package cmd
+
+import (
+	stderrors "errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+
+	"github.com/emilkje/cwc/pkg/annotations"
+	"github.com/emilkje/cwc/pkg/chat"
+	"github.com/emilkje/cwc/pkg/config"
+	"github.com/emilkje/cwc/pkg/filetree"
+	"github.com/emilkje/cwc/pkg/linttriage"
+	"github.com/emilkje/cwc/pkg/providers"
+	"github.com/emilkje/cwc/pkg/ui"
+)
+
+func createLintTriageCmd() *cobra.Command {
+	var (
+		groupSizeFlag int
+		lintersFlag   []string
+		noApplyFlag   bool
+		formatFlag    string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "lint-triage",
+		Short: "Triage golangci-lint findings and propose fixes",
+		Long: "Lint-triage reads the JSON output of golangci-lint from stdin and groups the findings by linter. The\n" +
+			"model triages each group with the files of its findings in the context, telling real problems from\n" +
+			"false positives, and proposes a diff for each finding worth fixing, which is applied once confirmed.\n" +
+			"With --format github-annotations the findings to fix or ignore are printed as workflow commands\n" +
+			"instead, annotating them in the pull request when run in GitHub Actions.",
+		Example: "  golangci-lint run --out-format json | cwc lint-triage\n" +
+			"  golangci-lint run --out-format json | cwc lint-triage --linters errcheck,gosec --no-apply",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := validateFormat(formatFlag); err != nil {
+				return err
+			}
+
+			if !isPiped(os.Stdin) {
+				return stderrors.New("pipe the findings to cwc lint-triage, like golangci-lint run --out-format json | cwc lint-triage")
+			}
+
+			input, err := io.ReadAll(os.Stdin)
+			if err != nil {
+				return fmt.Errorf("error reading from stdin: %w", err)
+			}
+
+			findings, err := linttriage.Parse(input)
+			if err != nil {
+				return err //nolint:wrapcheck
+			}
+
+			if len(lintersFlag) > 0 {
+				findings = slices.DeleteFunc(findings, func(f linttriage.Finding) bool {
+					return !slices.Contains(lintersFlag, f.Linter)
+				})
+			}
+
+			if len(findings) == 0 {
+				ui.PrintMessage("no findings to triage\n", ui.MessageTypeSuccess)
+				return nil
+			}
+
+			annotate := formatFlag == formatGitHubAnnotations
+			if !annotate {
+				// confirming fixes needs the terminal, as stdin is taken
+				reopenTerminal()
+			}
+
+			return triageFindings(linttriage.GroupFindings(findings, groupSizeFlag), !noApplyFlag && !annotate, annotate)
+		},
+	}
+
+	cmd.Flags().IntVar(&groupSizeFlag, "group-size", 10, "the most findings to triage in a single request") //nolint:gomnd
+	cmd.Flags().StringSliceVar(&lintersFlag, "linters", nil, "only triage the findings of these linters")
+	cmd.Flags().BoolVar(&noApplyFlag, "no-apply", false, "show the proposed fixes without offering to apply them")
+	addFormatFlag(cmd, &formatFlag)
+
+	return cmd
+}
+
+// triageFindings asks the model about each group in turn, and offers to apply
+// the fix of each finding it deems real, or annotates the findings.
+func triageFindings(groups []linttriage.Group, apply, annotate bool) error {
+	userConfig, err := config.LoadConfigOrDefault()
+	if err != nil {
+		return fmt.Errorf("error reading config: %w", err)
+	}
+
+	filter, err := newContextFilter(userConfig)
+	if err != nil {
+		return err
+	}
+
+	clientConfig, err := newClientConfig()
+	if err != nil {
+		return err
+	}
+
+	provider := providers.New(clientConfig)
+
+	apply = apply && term.IsTerminal(int(os.Stdin.Fd()))
+
+	counts := make(map[string]int)
+
+	for i := range groups {
+		group := &groups[i]
+
+		if !annotate {
+			ui.PrintMessage(fmt.Sprintf("\n%s: %d findings\n", group.Linter, len(group.Findings)), ui.MessageTypeNotice)
+		}
+
+		files := loadFindingFiles(group.Paths())
+		if len(files) == 0 {
+			counts["skipped"] += len(group.Findings)
+			continue
+		}
+
+		session := chat.NewSession(provider, chat.SystemMessage(createSystemMessageFromFiles(files, filter)))
+
+		spinner := ui.NewSpinner(ui.T("chat.thinking"))
+		spinner.Start()
+
+		reply, err := collectReply(session, linttriage.Prompt(group))
+
+		spinner.Stop()
+
+		if err != nil {
+			return err
+		}
+
+		triages := linttriage.ParseReply(group, reply)
+		counts["skipped"] += len(group.Findings) - len(triages)
+
+		for _, triage := range triages {
+			if annotate {
+				counts[annotateFinding(&triage)]++
+				continue
+			}
+
+			counts[triageFinding(&triage, files, apply)]++
+		}
+	}
+
+	var summary []string
+
+	for _, outcome := range []struct{ key, label string }{
+		{"fixed", "fixed"},
+		{linttriage.Fix, "left to fix"},
+		{linttriage.FalsePositive, "false positives"},
+		{linttriage.Ignore, "ignored"},
+		{"skipped", "not triaged"},
+	} {
+		if counts[outcome.key] > 0 {
+			summary = append(summary, fmt.Sprintf("%d %s", counts[outcome.key], outcome.label))
+		}
+	}
+
+	ui.PrintMessage("\ntriaged: "+strings.Join(summary, ", ")+"\n", ui.MessageTypeSuccess)
+
+	return nil
+}
+
+// triageFinding shows the verdict on the finding and offers to apply its fix,
+// returning the outcome.
+func triageFinding(triage *linttriage.Triage, files []filetree.File, apply bool) string {
+	finding := &triage.Finding
+
+	ui.PrintMessage(fmt.Sprintf("\n%s:%d: %s (%s)\n", finding.Path, finding.Line, finding.Text, finding.Linter),
+		ui.MessageTypeNotice)
+	ui.PrintMessage(triage.Reply+"\n", ui.MessageTypeInfo)
+
+	if !slices.Contains([]string{linttriage.Fix, linttriage.FalsePositive, linttriage.Ignore}, triage.Verdict) {
+		return "skipped"
+	}
+
+	if triage.Verdict != linttriage.Fix || !apply {
+		return triage.Verdict
+	}
+
+	// the files are read again for each fix, so earlier fixes are seen
+	planned, err := planEdits(triage.Reply, files)
+	if err == nil && len(planned) == 0 {
+		err = stderrors.New("the reply contains no diff")
+	}
+
+	if err != nil {
+		ui.PrintMessage(fmt.Sprintf("not applying the fix: %s\n", err), ui.MessageTypeWarning)
+		return triage.Verdict
+	}
+
+	if !confirmEdits(planned, "Apply the fix?") {
+		return triage.Verdict
+	}
+
+	if err := writeEdits(planned); err != nil {
+		ui.PrintMessage(err.Error()+"\n", ui.MessageTypeError)
+		return triage.Verdict
+	}
+
+	return "fixed"
+}
+
+// annotateFinding prints the annotation of a finding to fix or ignore,
+// returning the outcome. False positives are left out.
+func annotateFinding(triage *linttriage.Triage) string {
+	level := annotations.Notice
+
+	switch triage.Verdict {
+	case linttriage.Fix:
+		level = annotations.Warning
+	case linttriage.Ignore:
+	case linttriage.FalsePositive:
+		return triage.Verdict
+	default:
+		return "skipped"
+	}
+
+	finding := &triage.Finding
+
+	printAnnotation(&annotations.Annotation{
+		Level:   level,
+		File:    finding.Path,
+		Line:    finding.Line,
+		Column:  finding.Column,
+		Title:   fmt.Sprintf("%s (%s)", finding.Linter, triage.Verdict),
+		Message: finding.Text + "\n\n" + linttriage.Explanation(triage.Reply),
+	})
+
+	return triage.Verdict
+}
+
+func loadFindingFiles(paths []string) []filetree.File {
+	files := make([]filetree.File, 0, len(paths))
+
+	for _, path := range paths {
+		file, err := filetree.LoadFile(path)
+		if err != nil {
+			slog.Warn("skipping file", "path", path, "error", err)
+			continue
+		}
+
+		files = append(files, *file)
+	}
+
+	return files
+}
@@ -0,0 +1,56 @@
+package cmd
+
+import (
+	"fmt"
+	"log/slog"
+
+	"github.com/spf13/cobra"
+
+	"github.com/emilkje/cwc/pkg/config"
+	"github.com/emilkje/cwc/pkg/logging"
+)
+
+// defaultLogFile is the value of --log-file given without a file, which
+// selects cwc.log in the XDG state directory.
+const defaultLogFile = "default"
+
+// logFlags holds the command line flags of the operational logs.
+type logFlags struct {
+	level  string
+	format string
+	file   string
+}
+
+func addLogFlags(cmd *cobra.Command, flags *logFlags) {
+	cmd.PersistentFlags().StringVar(&flags.level, "log-level", "warn",
+		"The least severe operational messages printed to stderr and the log file: debug, info, warn or error")
+	cmd.PersistentFlags().StringVar(&flags.format, "log-format", logging.FormatText,
+		"The format of the operational messages: text or json")
+	cmd.PersistentFlags().StringVar(&flags.file, "log-file", "",
+		"Also append the operational messages to the given file, as --log-file=path, or to cwc.log in "+
+			"$XDG_STATE_HOME/cwc if no file is given")
+	cmd.PersistentFlags().Lookup("log-file").NoOptDefVal = defaultLogFile
+}
+
+// startLogging sets up the logger of the operational messages.
+func startLogging(cmd *cobra.Command, flags logFlags) error {
+	level, err := logging.ParseLevel(flags.level)
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	file := flags.file
+	if file == defaultLogFile {
+		if file, err = config.LogFilePath(); err != nil {
+			return fmt.Errorf("error locating the log file: %w", err)
+		}
+	}
+
+	if err := logging.Setup(logging.Options{Level: level, Format: flags.format, File: file}); err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	slog.Debug("running command", "command", cmd.CommandPath(), "logFile", file)
+
+	return nil
+}
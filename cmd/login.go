@@ -1,15 +1,30 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
 
 	"github.com/emilkje/cwc/pkg/config"
 	"github.com/emilkje/cwc/pkg/errors"
+	"github.com/emilkje/cwc/pkg/oauth"
+	"github.com/emilkje/cwc/pkg/providers"
 	"github.com/emilkje/cwc/pkg/ui"
 )
 
+const (
+	// listDeploymentsTimeout bounds the wait for the deployments of the
+	// endpoint while logging in.
+	listDeploymentsTimeout = 15 * time.Second
+	// signInTimeout bounds the wait for the user to sign in in the browser.
+	signInTimeout = 5 * time.Minute
+)
+
 var (
 	apiKeyFlag          string //nolint:gochecknoglobals
 	endpointFlag        string //nolint:gochecknoglobals
@@ -18,38 +33,69 @@ var (
 )
 
 func createLoginCmd() *cobra.Command {
+	var (
+		browserFlag bool
+		oauthFlags  config.OAuthConfig
+	)
+
 	cmd := &cobra.Command{
 		Use:   "login",
 		Short: "Authenticate with Azure OpenAI",
 		Long: "Login will prompt you to enter your Azure OpenAI API key " +
 			"and other relevant information required for authentication.\n" +
-			"Your credentials will be stored securely in your keyring and will never be exposed on the file system directly.",
+			"Your credentials will be stored securely in your keyring and will never be exposed on the file system directly.\n" +
+			"With --browser, you sign in with Microsoft Entra ID in the browser instead of entering an API key.",
 		RunE: func(cmd *cobra.Command, args []string) error {
 			// Prompt for other required authentication details (apiKey, endpoint, version, and deployment)
-			if apiKeyFlag == "" {
-				ui.PrintMessage("Enter the Azure OpenAI API Key: ", ui.MessageTypeInfo)
+			if apiKeyFlag == "" && !browserFlag {
+				ui.PrintMessage(ui.T("login.api-key"), ui.MessageTypeInfo)
 				apiKeyFlag = config.SanitizeInput(ui.ReadUserInput())
 			}
 
 			if endpointFlag == "" {
-				ui.PrintMessage("Enter the Azure OpenAI API Endpoint: ", ui.MessageTypeInfo)
+				ui.PrintMessage(ui.T("login.endpoint"), ui.MessageTypeInfo)
 				endpointFlag = config.SanitizeInput(ui.ReadUserInput())
 			}
 
 			if apiVersionFlag == "" {
-				ui.PrintMessage("Enter the Azure OpenAI API Version: ", ui.MessageTypeInfo)
+				ui.PrintMessage(ui.T("login.api-version"), ui.MessageTypeInfo)
 				apiVersionFlag = config.SanitizeInput(ui.ReadUserInput())
 			}
 
+			credential := providers.AzureCredential{APIKey: apiKeyFlag}
+			secret := apiKeyFlag
+
+			var signIn *config.OAuthConfig
+
+			if browserFlag {
+				token, err := signInInBrowser(&oauthFlags)
+				if err != nil {
+					return err
+				}
+
+				// the tokens take the place of the API key in the keyring
+				credential = providers.AzureCredential{AccessToken: token.AccessToken}
+				secret = token.Encode()
+				signIn = &oauthFlags
+			}
+
 			if modelDeploymentFlag == "" {
-				ui.PrintMessage("Enter the Azure OpenAI Model Deployment: ", ui.MessageTypeInfo)
-				modelDeploymentFlag = config.SanitizeInput(ui.ReadUserInput())
+				modelDeploymentFlag = askDeployment(endpointFlag, credential)
 			}
 
-			cfg := config.NewConfig(endpointFlag, apiVersionFlag, modelDeploymentFlag)
-			cfg.SetAPIKey(apiKeyFlag)
+			// keep any preferences from an existing configuration
+			cfg, err := config.LoadConfigOrDefault()
+			if err != nil {
+				cfg = config.NewConfig("", "", "")
+			}
+
+			cfg.Endpoint = endpointFlag
+			cfg.APIVersion = apiVersionFlag
+			cfg.ModelDeployment = modelDeploymentFlag
+			cfg.OAuth = signIn
+			cfg.SetAPIKey(secret)
 
-			err := config.SaveConfig(cfg)
+			err = config.SaveConfig(cfg)
 			if err != nil {
 				if validationErr, ok := errors.AsConfigValidationError(err); ok {
 					for _, e := range validationErr.Errors {
@@ -62,7 +108,7 @@ func createLoginCmd() *cobra.Command {
 				return fmt.Errorf("error saving configuration: %w", err)
 			}
 
-			ui.PrintMessage("config saved successfully\n", ui.MessageTypeSuccess)
+			ui.PrintMessage(ui.T("login.saved")+"\n", ui.MessageTypeSuccess)
 
 			return nil
 		},
@@ -72,6 +118,154 @@ func createLoginCmd() *cobra.Command {
 	cmd.Flags().StringVarP(&endpointFlag, "endpoint", "e", "", "Azure OpenAI API Endpoint")
 	cmd.Flags().StringVarP(&apiVersionFlag, "api-version", "v", "", "Azure OpenAI API Version")
 	cmd.Flags().StringVarP(&modelDeploymentFlag, "model-deployment", "m", "", "Azure OpenAI Model Deployment")
+	cmd.Flags().BoolVar(&browserFlag, "browser", false,
+		"Sign in with Microsoft Entra ID in the browser instead of entering an API key. The tokens are stored in "+
+			"the keyring and renewed as they expire")
+	cmd.Flags().StringVar(&oauthFlags.Tenant, "tenant", "",
+		"With --browser, the tenant to sign in to, a tenant ID or domain. Defaults to any work or school account")
+	cmd.Flags().StringVar(&oauthFlags.ClientID, "client-id", "",
+		"With --browser, the application signing in. Defaults to the Azure CLI")
+
+	cmd.AddCommand(createLoginEmbeddingCmd())
+
+	return cmd
+}
+
+// askDeployment lists the chat deployments of the endpoint for the user to
+// pick from, rather than typing the name from memory. If they can't be
+// listed, the name is typed as before.
+func askDeployment(endpoint string, credential providers.AzureCredential) string {
+	deployments, err := listDeployments(endpoint, credential)
+	if err != nil || len(deployments) == 0 {
+		if err != nil {
+			ui.PrintMessage(ui.T("login.list-failed", err)+"\n", ui.MessageTypeWarning)
+		}
+
+		ui.PrintMessage(ui.T("login.deployment"), ui.MessageTypeInfo)
+
+		return config.SanitizeInput(ui.ReadUserInput())
+	}
+
+	var list strings.Builder
+
+	list.WriteString(ui.T("login.deployments") + "\n")
+
+	for i, deployment := range deployments {
+		fmt.Fprintf(&list, "%3d) %s (%s)\n", i+1, deployment.Name, deployment.Model)
+	}
+
+	ui.PrintMessage(list.String(), ui.MessageTypeInfo)
+
+	for {
+		ui.PrintMessage(ui.T("login.choose-deployment"), ui.MessageTypeInfo)
+
+		answer := config.SanitizeInput(ui.ReadUserInput())
+
+		// the only deployment is taken without asking
+		if answer == "" && len(deployments) == 1 {
+			return deployments[0].Name
+		}
+
+		n, err := strconv.Atoi(answer)
+		if err != nil {
+			if answer != "" {
+				return answer
+			}
+
+			continue
+		}
+
+		if n >= 1 && n <= len(deployments) {
+			return deployments[n-1].Name
+		}
+	}
+}
+
+func listDeployments(endpoint string, credential providers.AzureCredential) ([]providers.Deployment, error) {
+	if err := confirmEgress(endpoint); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), listDeploymentsTimeout)
+	defer cancel()
+
+	deployments, err := providers.ListAzureDeployments(ctx, config.HTTPClient(), endpoint, credential)
+	if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+
+	return deployments, nil
+}
+
+// signInInBrowser has the user sign in with Microsoft Entra ID in the
+// browser, waiting for up to signInTimeout.
+func signInInBrowser(settings *config.OAuthConfig) (*oauth.Token, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), signInTimeout)
+	defer cancel()
+
+	token, err := oauth.Login(ctx, config.HTTPClient(), settings.Endpoint(), func(url string) {
+		// the address is printed too, for when no browser can be opened,
+		// such as over SSH
+		ui.PrintMessage(ui.T("login.browser", url)+"\n", ui.MessageTypeInfo)
+
+		if err := ui.OpenBrowser(url); err != nil {
+			slog.Debug("could not open the browser", "error", err)
+		}
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error signing in: %w", err)
+	}
+
+	return token, nil
+}
+
+func createLoginEmbeddingCmd() *cobra.Command {
+	var (
+		embedding config.EmbeddingConfig
+		apiKey    string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "embedding",
+		Short: "Configure the provider of the embedding model used by cwc index",
+		Long: "Embedding sets a provider for the embedding model used by cwc index other than the chat provider,\n" +
+			"such as a local Ollama server while chatting with Azure OpenAI. Its API key is stored in the keyring\n" +
+			"apart from the chat API key.\n\n" +
+			"Examples:\n\n" +
+			"  cwc login embedding --provider ollama --model nomic-embed-text\n" +
+			"  cwc login embedding --provider openai --model text-embedding-3-small",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if apiKey == "" && embedding.Provider != config.EmbeddingProviderOllama {
+				ui.PrintMessage("Enter the API key of the embedding provider: ", ui.MessageTypeInfo)
+				apiKey = config.SanitizeInput(ui.ReadUserInput())
+			}
+
+			err := config.SaveEmbeddingConfig(&embedding, apiKey)
+			if err != nil {
+				if validationErr, ok := errors.AsConfigValidationError(err); ok {
+					for _, e := range validationErr.Errors {
+						ui.PrintMessage(e+"\n", ui.MessageTypeError)
+					}
+
+					return nil // suppress the error
+				}
+
+				return fmt.Errorf("error saving configuration: %w", err)
+			}
+
+			ui.PrintMessage(ui.T("login.saved")+"\n", ui.MessageTypeSuccess)
+
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&embedding.Provider, "provider", "", "The provider: azure, openai or ollama")
+	cmd.Flags().StringVar(&embedding.Endpoint, "endpoint", "",
+		"The base URL of the API. Defaults to the public API for openai and http://localhost:11434/v1 for ollama")
+	cmd.Flags().StringVar(&embedding.APIVersion, "api-version", "", "The API version, required for azure")
+	cmd.Flags().StringVar(&embedding.Model, "model", "", "The embedding model, or on azure its deployment")
+	cmd.Flags().StringVarP(&apiKey, "api-key", "k", "", "The API key, if the provider needs one")
 
 	return cmd
 }
@@ -0,0 +1,57 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+
+	"github.com/emilkje/cwc/pkg/chat"
+)
+
+// maxTopLogProbs is the most alternatives the API returns per token.
+const maxTopLogProbs = 5
+
+// logProbsRecord is a line of the file given with --logprobs.
+type logProbsRecord struct {
+	Time     time.Time        `json:"time"`
+	Model    string           `json:"model,omitempty"`
+	Prompt   string           `json:"prompt"`
+	Response string           `json:"response"`
+	LogProbs []openai.LogProb `json:"logprobs"`
+}
+
+// appendLogProbs appends the response and the log probabilities of its
+// tokens as a line of JSON to the file at path.
+func appendLogProbs(path, prompt, response string, stats *chat.TurnStats, logProbs []openai.LogProb) error {
+	record := logProbsRecord{
+		Time:     time.Now().UTC(),
+		Prompt:   prompt,
+		Response: response,
+		LogProbs: logProbs,
+	}
+
+	if stats != nil {
+		record.Model = stats.Model
+	}
+
+	line, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("error encoding log probabilities: %w", err)
+	}
+
+	// the prompts may quote the code, so the file is kept private
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600) //nolint:gomnd
+	if err != nil {
+		return fmt.Errorf("error opening %s: %w", path, err)
+	}
+	defer file.Close()
+
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("error writing %s: %w", path, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,92 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/emilkje/cwc/pkg/filetree"
+	"github.com/emilkje/cwc/pkg/repomap"
+)
+
+func createMapCmd() *cobra.Command {
+	var (
+		includeFlag              string
+		excludeFlag              string
+		pathsFlag                []string
+		langFlag                 []string
+		ignoreFilesFlag          []string
+		filesFlag                []string
+		ownedByFlag              []string
+		changedSinceFlag         string
+		withDepsFlag             bool
+		workspaceFlag            string
+		excludeFromGitignoreFlag bool
+		excludeGitDirFlag        bool
+		includeThirdPartyFlag    bool
+		tokensFlag               int
+	)
+
+	cmd := &cobra.Command{
+		Use:   "map",
+		Short: "Print a compact overview of the repository",
+		Long: "Map prints the directories of the repository and its files ranked by how much the rest of the code\n" +
+			"refers to them, with their exported symbols and the files they use, in about --tokens tokens.\n" +
+			"Run cwc with --map, or set repoMap in the config file, to prepend it to the context.",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			files, _, err := gatherContext(&chatOptions{
+				includeFlag:              includeFlag,
+				excludeFlag:              excludeFlag,
+				pathsFlag:                pathsFlag,
+				langFlag:                 langFlag,
+				ignoreFilesFlag:          ignoreFilesFlag,
+				filesFlag:                filesFlag,
+				ownedByFlag:              ownedByFlag,
+				changedSinceFlag:         changedSinceFlag,
+				withDepsFlag:             withDepsFlag,
+				workspaceFlag:            workspaceFlag,
+				excludeFromGitignoreFlag: excludeFromGitignoreFlag,
+				excludeGitDirFlag:        excludeGitDirFlag,
+				includeThirdPartyFlag:    includeThirdPartyFlag,
+			})
+			if err != nil {
+				return err
+			}
+
+			_, err = fmt.Fprint(cmd.OutOrStdout(), buildRepoMap(files, tokensFlag))
+
+			return err //nolint:wrapcheck
+		},
+	}
+
+	initFlags(cmd, &flags{
+		includeFlag:              &includeFlag,
+		excludeFlag:              &excludeFlag,
+		pathsFlag:                &pathsFlag,
+		langFlag:                 &langFlag,
+		ignoreFilesFlag:          &ignoreFilesFlag,
+		filesFlag:                &filesFlag,
+		ownedByFlag:              &ownedByFlag,
+		changedSinceFlag:         &changedSinceFlag,
+		withDepsFlag:             &withDepsFlag,
+		workspaceFlag:            &workspaceFlag,
+		excludeFromGitignoreFlag: &excludeFromGitignoreFlag,
+		excludeGitDirFlag:        &excludeGitDirFlag,
+		includeThirdPartyFlag:    &includeThirdPartyFlag,
+	})
+
+	cmd.Flags().IntVar(&tokensFlag, "tokens", repomap.DefaultTokens, "the approximate size of the map in tokens")
+
+	return cmd
+}
+
+// buildRepoMap renders the map of the files in about maxTokens tokens.
+func buildRepoMap(files []filetree.File, maxTokens int) string {
+	paths := make([]string, len(files))
+	for i, file := range files {
+		paths[i] = file.Path
+	}
+
+	return repomap.Build(paths).Render(maxTokens)
+}
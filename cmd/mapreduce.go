@@ -0,0 +1,60 @@
+package cmd
+
+import (
+	"fmt"
+	"log/slog"
+
+	"github.com/emilkje/cwc/pkg/chat"
+	"github.com/emilkje/cwc/pkg/filetree"
+	"github.com/emilkje/cwc/pkg/mapreduce"
+	"github.com/emilkje/cwc/pkg/providers"
+	"github.com/emilkje/cwc/pkg/ui"
+)
+
+// The answering strategies of --strategy.
+const (
+	strategySingle    = "single"
+	strategyMapReduce = "map-reduce"
+)
+
+// answerMapReduce asks the question about each part of the files, then
+// streams an answer synthesized from the partial answers.
+func answerMapReduce(provider providers.Provider, files []filetree.File, question string, opts *chatOptions) error {
+	question, err := opts.hooks.PreSend(expandPrompt(question, files, true))
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	question, summary := opts.filter.redactPrompt(question)
+	if summary != "" {
+		ui.PrintMessage(fmt.Sprintf("warning: redacted %s in the prompt\n", summary), ui.MessageTypeWarning)
+	}
+
+	progress := ui.NewProgressLine()
+
+	partials, err := mapreduce.Collect(files, question, &mapreduce.Options{
+		Ask: func(systemMessage, prompt string) (string, error) {
+			session := chat.NewSession(provider, systemMessage)
+			session.SetParameters(opts.params)
+
+			return collectReply(session, prompt)
+		},
+		Render: func(part []filetree.File) string {
+			return createSystemMessageFromFiles(part, opts.filter)
+		},
+		OnProgress: func(done, total int) {
+			progress.Update(fmt.Sprintf("asking each part: %d/%d requests", done, total))
+		},
+		OnSkip: func(file filetree.File) {
+			slog.Warn("leaving out a file larger than a part", "path", file.Path)
+		},
+	})
+
+	progress.Done()
+
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	return nonInteractive(chat.SystemMessage(partials), mapreduce.SynthesisPrompt(question), opts)
+}
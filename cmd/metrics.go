@@ -0,0 +1,75 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/emilkje/cwc/pkg/index"
+	"github.com/emilkje/cwc/pkg/metrics"
+)
+
+// metricsReadTimeout bounds how long a scrape may take to send its request.
+const metricsReadTimeout = 10 * time.Second
+
+// serveMetrics serves the metrics on /metrics at addr in the background, for
+// as long as cwc runs.
+func serveMetrics(addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("error serving metrics: %w", err)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.Handler())
+
+	server := &http.Server{Handler: mux, ReadHeaderTimeout: metricsReadTimeout}
+
+	go func() {
+		if err := server.Serve(listener); err != nil {
+			slog.Error("stopped serving metrics", "error", err)
+		}
+	}()
+
+	slog.Info("serving metrics", "url", "http://"+listener.Addr().String()+"/metrics")
+
+	return nil
+}
+
+// recordIndexMetrics counts a round of updating the index and the files it
+// could reuse, and measures the size of the index after it.
+func recordIndexMetrics(ctx context.Context, store index.Store, stats *index.UpdateStats, err error,
+	duration time.Duration,
+) {
+	metrics.IndexUpdateDuration.Observe(duration.Seconds())
+
+	if err != nil {
+		metrics.IndexUpdates.Inc("error")
+		return
+	}
+
+	metrics.IndexUpdates.Inc("ok")
+	metrics.IndexCacheHits.Add(float64(stats.Unchanged))
+	metrics.IndexCacheMisses.Add(float64(stats.Added + stats.Modified))
+
+	files, err := store.Files(ctx)
+	if err != nil {
+		slog.Warn("could not measure the index", "error", err)
+		return
+	}
+
+	chunks := 0
+	for _, entry := range files {
+		chunks += len(entry.Chunks)
+	}
+
+	metrics.IndexFiles.Set(float64(len(files)))
+	metrics.IndexChunks.Set(float64(chunks))
+
+	if size, err := store.Size(ctx); err == nil {
+		metrics.IndexSize.Set(float64(size))
+	}
+}
@@ -0,0 +1,48 @@
+package cmd
+
+import (
+	stderrors "errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/emilkje/cwc/pkg/codeblock"
+)
+
+var errNoCodeBlock = stderrors.New("the answer contains no fenced code block for --output-code-only")
+
+// writeAnswer writes the answer to the file given with --output, and the
+// code of its fenced blocks to the one given with --output-code-only.
+// Existing files are replaced, like a redirect would.
+func writeAnswer(answer string, opts *chatOptions) error {
+	if opts.output != "" {
+		if err := writeOutputFile(opts.output, answer); err != nil {
+			return err
+		}
+	}
+
+	if opts.outputCodeOnly != "" {
+		code := codeblock.Code(answer)
+		if code == "" {
+			return errNoCodeBlock
+		}
+
+		if err := writeOutputFile(opts.outputCodeOnly, code); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func writeOutputFile(path, content string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil { //nolint:gomnd,gosec
+		return fmt.Errorf("error creating directory for %s: %w", path, err)
+	}
+
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil { //nolint:gomnd,gosec
+		return fmt.Errorf("error writing %s: %w", path, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,154 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/emilkje/cwc/pkg/chat"
+	"github.com/emilkje/cwc/pkg/config"
+	"github.com/emilkje/cwc/pkg/plugin"
+	"github.com/emilkje/cwc/pkg/sandbox"
+)
+
+// AddPluginCommands adds a subcommand for every plugin whose name isn't
+// taken by a built-in command. PATH is only searched for plugins when the
+// arguments don't already name a built-in command. The flags of cwc itself
+// are taken from the arguments of a plugin, the rest are passed to the
+// plugin as is.
+func AddPluginCommands(root *cobra.Command, args []string) {
+	if found, _, err := root.Find(args); err == nil && found != root {
+		return
+	}
+
+	cfg, err := config.LoadConfigOrDefault()
+	if err != nil {
+		return
+	}
+
+	for _, p := range plugin.Discover(cfg.Plugins) {
+		if isCommand(root, p.Name) {
+			continue
+		}
+
+		var pluginArgs []string
+
+		root.AddCommand(&cobra.Command{
+			Use:                p.Name,
+			Short:              fmt.Sprintf("runs the %s plugin (%s)", p.Name, p.Path),
+			DisableFlagParsing: true,
+			PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+				var err error
+				if pluginArgs, err = takeInheritedFlags(cmd, args); err != nil {
+					return err
+				}
+
+				if root.PersistentPreRunE == nil {
+					return nil
+				}
+
+				return root.PersistentPreRunE(cmd, pluginArgs)
+			},
+			RunE: func(cmd *cobra.Command, _ []string) error {
+				return p.Run(cmd.Context(), pluginArgs)
+			},
+		})
+	}
+}
+
+// takeInheritedFlags sets the flags the command inherits from the root
+// command, such as --offline, from the arguments, which cobra leaves
+// unparsed for plugins, and returns the other arguments. The arguments after
+// -- are all returned.
+func takeInheritedFlags(cmd *cobra.Command, args []string) ([]string, error) {
+	flags := cmd.InheritedFlags()
+	rest := make([]string, 0, len(args))
+
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			return append(rest, args[i+1:]...), nil
+		}
+
+		name, value, hasValue := strings.Cut(strings.TrimPrefix(arg, "--"), "=")
+
+		flag := flags.Lookup(name)
+		if !strings.HasPrefix(arg, "--") || flag == nil {
+			rest = append(rest, arg)
+			continue
+		}
+
+		if !hasValue {
+			switch {
+			case flag.NoOptDefVal != "":
+				value = flag.NoOptDefVal
+			case i+1 < len(args):
+				i++
+				value = args[i]
+			default:
+				return nil, fmt.Errorf("flag needs an argument: --%s", name)
+			}
+		}
+
+		if err := flags.Set(name, value); err != nil {
+			return nil, fmt.Errorf("invalid argument %q for --%s: %w", value, name, err)
+		}
+	}
+
+	return rest, nil
+}
+
+// pluginTools describes the plugins declared as tools in the config file.
+// Plugins that fail to describe themselves are left out with a warning. The
+// tools run in the sandbox of the repository and their output passes through
+// the filter before the model sees it.
+func pluginTools(cfg *config.Config, filter *contextFilter) []chat.Tool {
+	var (
+		tools []chat.Tool
+		box   *sandbox.Sandbox
+	)
+
+	for _, p := range plugin.Discover(cfg.Plugins) {
+		if !p.Tool {
+			continue
+		}
+
+		if box == nil {
+			var err error
+			if box, err = newRepoSandbox(); err != nil {
+				slog.Warn("not offering the tools", "error", err)
+				return nil
+			}
+		}
+
+		desc, err := p.Describe(context.Background())
+		if err != nil {
+			slog.Warn("not offering the tool", "tool", p.Name, "error", err)
+			continue
+		}
+
+		tools = append(tools, chat.Tool{
+			Name:        p.Name,
+			Description: desc.Description,
+			Parameters:  desc.Parameters,
+			Call: func(ctx context.Context, arguments string) (string, error) {
+				output, err := p.Call(ctx, box, arguments)
+				if err != nil {
+					return "", err //nolint:wrapcheck
+				}
+
+				output, ok := filter.apply("the output of the "+p.Name+" tool", output)
+				if !ok {
+					return "[output withheld as it contains secrets]", nil
+				}
+
+				return output, nil
+			},
+		})
+	}
+
+	return tools
+}
@@ -0,0 +1,177 @@
+package cmd
+
+import (
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/emilkje/cwc/pkg/config"
+	"github.com/emilkje/cwc/pkg/ui"
+)
+
+// preferenceFlags holds the command line flags that override preferences
+// from the config file.
+type preferenceFlags struct {
+	ascii       bool
+	notifyAfter time.Duration
+	language    string
+}
+
+// applyUserPreferences applies the presentation preferences from the config
+// file and the command line and returns the config for the preferences the
+// commands apply themselves. Problems are reported as warnings since they
+// should never prevent the user from chatting.
+func applyUserPreferences(flags preferenceFlags) *config.Config {
+	cfg, err := config.LoadConfigOrDefault()
+	if err != nil {
+		cfg = config.NewConfig("", "", "")
+	}
+
+	language := flags.language
+	if language == "" {
+		language = cfg.Language
+	}
+
+	// applied first so that the warnings below are in the selected language
+	if err := ui.SetLanguage(language); err != nil {
+		slog.Warn("could not set the language", "error", err)
+	}
+
+	if cfg.Theme != nil {
+		theme, err := themeFromConfig(cfg.Theme)
+		if err != nil {
+			slog.Warn("invalid theme configuration", "error", err)
+		} else {
+			ui.SetTheme(theme)
+		}
+	}
+
+	// applied after the theme so that ASCII labels replace the glyphs
+	ui.SetASCIIMode(flags.ascii || cfg.ASCII)
+
+	if cfg.KeyBindings != nil {
+		keys, err := keyMapFromConfig(cfg.KeyBindings)
+		if err != nil {
+			slog.Warn("invalid key bindings", "error", err)
+		} else {
+			ui.SetKeyMap(keys)
+		}
+	}
+
+	if err := applyNotification(cfg.Notification, flags.notifyAfter); err != nil {
+		slog.Warn("invalid notification configuration", "error", err)
+	}
+
+	return cfg
+}
+
+func applyNotification(cfg *config.NotificationConfig, notifyAfter time.Duration) error {
+	if cfg == nil {
+		cfg = &config.NotificationConfig{}
+	}
+
+	after := notifyAfter
+
+	if after == 0 && cfg.After != "" {
+		parsed, err := time.ParseDuration(cfg.After)
+		if err != nil {
+			return fmt.Errorf("error parsing notification delay: %w", err)
+		}
+
+		after = parsed
+	}
+
+	return ui.SetNotification(cfg.Method, after) //nolint:wrapcheck
+}
+
+func themeFromConfig(cfg *config.ThemeConfig) (ui.Theme, error) {
+	theme := ui.CurrentTheme()
+
+	if cfg.Name != "" {
+		builtin, ok := ui.BuiltinTheme(cfg.Name)
+		if !ok {
+			return theme, fmt.Errorf("unknown theme %q, available themes are %v", cfg.Name, ui.BuiltinThemeNames())
+		}
+
+		theme = builtin
+	}
+
+	colors := []struct {
+		spec   string
+		target *string
+	}{
+		{cfg.Info, &theme.Info},
+		{cfg.Warning, &theme.Warning},
+		{cfg.Error, &theme.Error},
+		{cfg.Notice, &theme.Notice},
+		{cfg.Success, &theme.Success},
+	}
+
+	for _, color := range colors {
+		if color.spec == "" {
+			continue
+		}
+
+		parsed, err := ui.ParseColor(color.spec)
+		if err != nil {
+			return theme, fmt.Errorf("error parsing theme color: %w", err)
+		}
+
+		*color.target = parsed
+	}
+
+	if cfg.UserGlyph != "" {
+		theme.UserGlyph = cfg.UserGlyph
+	}
+
+	if cfg.AssistantGlyph != "" {
+		theme.AssistantGlyph = cfg.AssistantGlyph
+	}
+
+	if cfg.CodeStyle != "" {
+		theme.CodeStyle = cfg.CodeStyle
+	}
+
+	return theme, nil
+}
+
+func keyMapFromConfig(cfg *config.KeyBindingsConfig) (ui.KeyMap, error) {
+	keys := ui.CurrentKeyMap()
+
+	if cfg.Preset != "" {
+		preset, ok := ui.BuiltinKeyMap(cfg.Preset)
+		if !ok {
+			return keys, fmt.Errorf("unknown key binding preset %q, available presets are %v", cfg.Preset, ui.BuiltinKeyMapNames())
+		}
+
+		keys = preset
+	}
+
+	actions := []struct {
+		names  []string
+		target *[]string
+	}{
+		{cfg.Submit, &keys.Submit},
+		{cfg.Newline, &keys.Newline},
+		{cfg.Cancel, &keys.Cancel},
+		{cfg.ScrollUp, &keys.ScrollUp},
+		{cfg.ScrollDown, &keys.ScrollDown},
+		{cfg.Editor, &keys.Editor},
+		{cfg.Sidebar, &keys.Sidebar},
+	}
+
+	for _, action := range actions {
+		if len(action.names) == 0 {
+			continue
+		}
+
+		parsed, err := ui.ParseKeys(action.names)
+		if err != nil {
+			return keys, fmt.Errorf("error parsing key bindings: %w", err)
+		}
+
+		*action.target = parsed
+	}
+
+	return keys, nil
+}
@@ -0,0 +1,103 @@
+package cmd
+
+import (
+	"context"
+	stderrors "errors"
+	"fmt"
+	"os"
+
+	"github.com/emilkje/cwc/pkg/chat"
+	"github.com/emilkje/cwc/pkg/config"
+	"github.com/emilkje/cwc/pkg/filetree"
+	"github.com/emilkje/cwc/pkg/index"
+	"github.com/emilkje/cwc/pkg/providers"
+	"github.com/emilkje/cwc/pkg/ui"
+)
+
+// defaultRAGChunks is the number of chunks retrieved for --rag.
+const defaultRAGChunks = 12
+
+// retrieveFiles narrows the gathered files to those holding the chunks of the
+// index most relevant to the query, the most relevant file first.
+func retrieveFiles(files []filetree.File, opts *chatOptions, provider providers.Provider,
+) ([]filetree.File, *filetree.FileNode, error) {
+	embedder, err := newEmbedder()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	store, err := openIndexStore()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	reranker, err := newReranker(opts.rerank, provider)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	matches, err := index.Retrieve(context.Background(), store, embedder, reranker, opts.ragQuery, opts.ragChunks)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error retrieving context: %w", err)
+	}
+
+	gathered := make(map[string]filetree.File, len(files))
+	for _, file := range files {
+		gathered[file.Path] = file
+	}
+
+	var retrieved []filetree.File
+
+	seen := make(map[string]bool)
+
+	for _, match := range matches {
+		file, ok := gathered[match.Path]
+		if !ok || seen[match.Path] {
+			continue
+		}
+
+		seen[match.Path] = true
+		retrieved = append(retrieved, file)
+	}
+
+	ui.PrintMessage(fmt.Sprintf("retrieved %d chunks from %d files\n", len(matches), len(retrieved)),
+		ui.MessageTypeNotice)
+
+	return retrieved, filetree.NewFileTree(retrieved), nil
+}
+
+// newReranker creates the reranker configured for --rag, or nil when
+// reranking is off.
+func newReranker(cfg *config.RerankConfig, provider providers.Provider) (index.Reranker, error) { //nolint:ireturn
+	if cfg == nil {
+		return nil, nil //nolint:nilnil
+	}
+
+	switch cfg.Method {
+	case "", "off":
+		return nil, nil //nolint:nilnil
+	case "llm":
+		return &index.LLMReranker{
+			Ask: func(systemMessage, prompt string) (string, error) {
+				return collectReply(chat.NewSession(provider, systemMessage), prompt)
+			},
+		}, nil
+	case "cross-encoder":
+		if cfg.Endpoint == "" {
+			return nil, stderrors.New("the cross-encoder reranker requires rerank.endpoint in the config file")
+		}
+
+		if err := confirmEgress(cfg.Endpoint); err != nil {
+			return nil, err
+		}
+
+		var apiKey string
+		if cfg.APIKeyEnv != "" {
+			apiKey = os.Getenv(cfg.APIKeyEnv)
+		}
+
+		return index.NewCrossEncoderReranker(config.HTTPClient(), cfg.Endpoint, cfg.Model, apiKey), nil
+	default:
+		return nil, fmt.Errorf("unknown rerank method %q, use %q, %q or %q", cfg.Method, "llm", "cross-encoder", "off")
+	}
+}
@@ -0,0 +1,105 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/emilkje/cwc/pkg/changelog"
+	"github.com/emilkje/cwc/pkg/releasenotes"
+)
+
+func createReleaseNotesCmd() *cobra.Command {
+	var (
+		fromFlag     string
+		toFlag       string
+		versionFlag  string
+		audienceFlag string
+		templateFlag string
+		outputFlag   string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "release-notes",
+		Short: "Write release notes for users or developers from the git history",
+		Long: "Release-notes reads the commits between --from and --to like changelog, and asks the model for notes\n" +
+			"written for --audience: users get the changes that affect them in plain language, devs get engineering\n" +
+			"notes including internal changes. The notes are laid out with a Go template, the built-in one of the\n" +
+			"audience unless --template is given, and printed or written to --output.",
+		Example: "  cwc release-notes --from v0.3.0 --audience users\n" +
+			"  cwc release-notes --to v0.4.0 --audience devs --template .github/notes.tmpl -o notes.md",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			audience, err := releasenotes.ParseAudience(audienceFlag)
+			if err != nil {
+				return err //nolint:wrapcheck
+			}
+
+			text := releasenotes.DefaultTemplate(audience)
+
+			if templateFlag != "" {
+				data, err := os.ReadFile(templateFlag) // #nosec
+				if err != nil {
+					return fmt.Errorf("error reading template: %w", err)
+				}
+
+				text = string(data)
+			}
+
+			tmpl, err := releasenotes.Parse(text)
+			if err != nil {
+				return err //nolint:wrapcheck
+			}
+
+			release, err := newRelease(fromFlag, toFlag, versionFlag)
+			if err != nil {
+				return err
+			}
+
+			notes, err := askAboutCommits(release, releasenotes.Prompt(audience))
+			if err != nil {
+				return err
+			}
+
+			var date string
+			if release.version != changelog.Unreleased {
+				date = release.date.Format(time.DateOnly)
+			}
+
+			rendered, err := releasenotes.Render(tmpl, releasenotes.NewData(
+				release.version, date, release.from, release.to, notes, release.commits))
+			if err != nil {
+				return err //nolint:wrapcheck
+			}
+
+			if outputFlag == "" {
+				fmt.Print(rendered) //nolint:forbidigo
+				return nil
+			}
+
+			return writeGenerated(outputFlag, rendered, "release notes")
+		},
+	}
+
+	audiences := make([]string, len(releasenotes.Audiences))
+	for i, audience := range releasenotes.Audiences {
+		audiences[i] = string(audience)
+	}
+
+	cmd.Flags().StringVar(&fromFlag, "from", "", "the ref to start from, the latest tag before --to by default")
+	cmd.Flags().StringVar(&toFlag, "to", "HEAD", "the ref to end at")
+	cmd.Flags().StringVar(&versionFlag, "version", "",
+		"the version of the release, the tag at --to by default, or "+changelog.Unreleased)
+	cmd.Flags().StringVar(&audienceFlag, "audience", string(releasenotes.Users),
+		"who the notes are for: "+strings.Join(audiences, " or "))
+	cmd.Flags().StringVar(&templateFlag, "template", "", "a Go template file to lay out the notes with")
+	cmd.Flag("template").Usage = "Specify a Go template file to lay out the notes with. It can use .Version, .Date, " +
+		".From, .To, .Notes, .Commits and .Contributors, and the join function. " +
+		"For example, {{.Version}}: {{.Notes}}"
+	cmd.Flags().StringVarP(&outputFlag, "output", "o", "", "the file to write the notes to")
+
+	return cmd
+}
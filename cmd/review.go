@@ -0,0 +1,236 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/emilkje/cwc/pkg/edits"
+	"github.com/emilkje/cwc/pkg/ui"
+)
+
+const hunkHelp = `y - apply this hunk
+n - skip this hunk
+a - apply this hunk and the rest of the file
+d - skip this hunk and the rest of the file
+e - edit this hunk
+q - skip this hunk and everything after it
+? - print help
+`
+
+// reviewHunks shows the hunks of the planned edits one by one, like git add
+// -p, and returns the edits with the hunks the user accepted, leaving out the
+// files none were accepted for. Renames and deletions are accepted or skipped
+// as a whole.
+func reviewHunks(planned []plannedEdit) []plannedEdit {
+	reviewed := make([]plannedEdit, 0, len(planned))
+	quit := false
+
+	for _, edit := range planned {
+		if quit {
+			break
+		}
+
+		if edit.oldTarget != "" {
+			question := "Delete " + edit.patch.OldPath
+			if edit.patch.NewPath != "" {
+				question = fmt.Sprintf("Rename %s to %s", edit.patch.OldPath, edit.patch.NewPath)
+			}
+
+			printHunks(&edit.patch, edit.patch.Hunks)
+
+			switch askHunk(question + " [y,n,q,?]? ") {
+			case "y":
+				reviewed = append(reviewed, edit)
+			case "q":
+				quit = true
+			}
+
+			continue
+		}
+
+		var accepted bool
+
+		if accepted, quit = reviewFileHunks(&edit); accepted {
+			reviewed = append(reviewed, edit)
+		}
+	}
+
+	return reviewed
+}
+
+// reviewFileHunks asks about each hunk of the edit and keeps those accepted,
+// applying them to the file as it was. It reports whether any were accepted
+// and whether the user quit.
+func reviewFileHunks(edit *plannedEdit) (bool, bool) {
+	hunks := edit.patch.Hunks
+	kept := make([]edits.Hunk, 0, len(hunks))
+	rest := ""
+
+	for i := 0; i < len(hunks); i++ {
+		answer := rest
+		if answer == "" {
+			printHunks(&edit.patch, hunks[i:i+1])
+			answer = askHunk(fmt.Sprintf("(%d/%d) Apply this hunk to %s [y,n,a,d,e,q,?]? ", i+1, len(hunks),
+				edit.patch.Path()))
+		}
+
+		switch answer {
+		case "y":
+			kept = append(kept, hunks[i])
+		case "a":
+			kept, rest = append(kept, hunks[i]), "y"
+		case "d":
+			rest = "n"
+		case "e":
+			hunk, err := editHunk(edit, kept, hunks[i])
+			if err != nil {
+				ui.PrintMessage(err.Error()+"\n", ui.MessageTypeWarning)
+				i--
+
+				continue
+			}
+
+			if hunk != nil {
+				kept = append(kept, *hunk)
+			}
+		case "q":
+			return keepHunks(edit, kept), true
+		case "n":
+		default:
+			ui.PrintMessage(hunkHelp, ui.MessageTypeNotice)
+			i--
+		}
+	}
+
+	return keepHunks(edit, kept), false
+}
+
+// keepHunks applies the kept hunks to the file as it was, reporting false if
+// there are none.
+func keepHunks(edit *plannedEdit, kept []edits.Hunk) bool {
+	if len(kept) == 0 {
+		return false
+	}
+
+	edit.patch.Hunks = kept
+
+	content, err := edits.Apply(edit.original, &edit.patch)
+	if err != nil {
+		// each hunk applied when it was accepted
+		ui.PrintMessage(fmt.Sprintf("not applying %s: %s\n", edit.patch.Path(), err), ui.MessageTypeError)
+		return false
+	}
+
+	edit.content = content
+
+	return true
+}
+
+// editHunk opens the hunk in the editor and returns it as edited, or nil if
+// all its lines were removed. The edited hunk must still apply after those
+// kept before it.
+func editHunk(edit *plannedEdit, kept []edits.Hunk, hunk edits.Hunk) (*edits.Hunk, error) {
+	// the help comes first, as the editor text is trimmed and the first line
+	// of the hunk would lose its prefix
+	text, err := ui.EditText("# Edit the hunk: remove a '-' line by making it a ' ' line, remove a '+' line by " +
+		"deleting it.\n# Lines starting with # are removed. Remove all lines to skip the hunk.\n" +
+		strings.Join(hunk.Lines, "\n") + "\n")
+	if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+
+	edited := edits.Hunk{OldStart: hunk.OldStart}
+
+	for _, line := range strings.Split(text, "\n") {
+		switch {
+		case strings.HasPrefix(line, "#"):
+		case line == "":
+			edited.Lines = append(edited.Lines, " ")
+		case line[0] == ' ' || line[0] == '-' || line[0] == '+':
+			edited.Lines = append(edited.Lines, line)
+		default:
+			return nil, fmt.Errorf("the edited hunk has a line without a ' ', '-' or '+' prefix: %q", line)
+		}
+	}
+
+	if strings.TrimSpace(strings.Join(edited.Lines, "")) == "" {
+		return nil, nil //nolint:nilnil
+	}
+
+	patch := edit.patch
+	patch.Hunks = append(append([]edits.Hunk{}, kept...), edited)
+
+	if _, err := edits.Apply(edit.original, &patch); err != nil {
+		return nil, fmt.Errorf("the edited hunk does not apply: %w", err)
+	}
+
+	return &edited, nil
+}
+
+func printHunks(patch *edits.FilePatch, hunks []edits.Hunk) {
+	var text strings.Builder
+
+	fmt.Fprintf(&text, "--- %s\n+++ %s\n", diffSide(patch.OldPath, "a/"), diffSide(patch.NewPath, "b/"))
+
+	for _, hunk := range hunks {
+		if hunk.OldStart > 0 {
+			fmt.Fprintf(&text, "@@ -%d @@\n", hunk.OldStart)
+		} else {
+			text.WriteString("@@\n")
+		}
+
+		text.WriteString(strings.Join(hunk.Lines, "\n") + "\n")
+	}
+
+	if ui.ColorsEnabled() {
+		fmt.Print(ui.RenderDiff(text.String(), true)) //nolint:forbidigo
+		return
+	}
+
+	fmt.Print(text.String()) //nolint:forbidigo
+}
+
+func diffSide(path, prefix string) string {
+	if path == "" {
+		return "/dev/null"
+	}
+
+	return prefix + path
+}
+
+// askHunk asks the question and returns the first letter of the answer, or
+// q when there is no more input.
+func askHunk(question string) string {
+	fmt.Print(question) //nolint:forbidigo
+
+	// read a byte at a time, as a buffered reader would take the answers to
+	// the next questions from piped input too
+	var (
+		line []byte
+		b    = make([]byte, 1)
+	)
+
+	for {
+		if n, err := os.Stdin.Read(b); n == 0 || err != nil {
+			if len(line) == 0 {
+				return "q"
+			}
+
+			break
+		}
+
+		if b[0] == '\n' {
+			break
+		}
+
+		line = append(line, b[0])
+	}
+
+	answer := strings.ToLower(strings.TrimSpace(string(line)))
+	if answer == "" {
+		return "?"
+	}
+
+	return answer[:1]
+}
@@ -0,0 +1,242 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/emilkje/cwc/pkg/changes"
+	"github.com/emilkje/cwc/pkg/semver"
+)
+
+// maxListedChanges bounds the API changes listed in the reasons and sent to
+// the model.
+const maxListedChanges = 40
+
+// semverReport is the recommendation, as printed with --json.
+type semverReport struct {
+	From       string   `json:"from"`
+	To         string   `json:"to"`
+	Current    string   `json:"current,omitempty"`
+	Next       string   `json:"next,omitempty"`
+	Bump       string   `json:"bump"`
+	Reasons    []string `json:"reasons"`
+	APIChanges []string `json:"apiChanges"`
+	Reasoning  string   `json:"reasoning,omitempty"`
+}
+
+func createSemverCmd() *cobra.Command {
+	var (
+		fromFlag    string
+		toFlag      string
+		jsonFlag    bool
+		noModelFlag bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "semver",
+		Short: "Recommend the next semantic version from the API changes and commits",
+		Long: "Semver compares the exported Go API at --from and --to, the identifiers of packages outside internal\n" +
+			"directories, and reads the commits between them. Removed or changed identifiers and breaking commits\n" +
+			"call for a major version, added identifiers and features for a minor one, and the rest for a patch.\n" +
+			"Before 1.0.0, breaking changes bump the minor version instead. The model then reviews the commits for\n" +
+			"breaking changes in behavior, which can raise the bump but never lower it, and explains it.\n" +
+			"With --json the recommendation is printed for release automation.",
+		Example: "  cwc semver --from v0.3.0\n" +
+			"  cwc semver --json --no-model | jq -r .next",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			report, err := recommendVersion(fromFlag, toFlag, !noModelFlag)
+			if err != nil {
+				return err
+			}
+
+			if jsonFlag {
+				encoder := json.NewEncoder(os.Stdout)
+				encoder.SetIndent("", "  ")
+
+				return encoder.Encode(report) //nolint:wrapcheck
+			}
+
+			printSemverReport(report)
+
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&fromFlag, "from", "", "the release to compare with, the latest tag before --to by default")
+	cmd.Flags().StringVar(&toFlag, "to", "HEAD", "the ref to release")
+	cmd.Flags().BoolVar(&jsonFlag, "json", false, "print the recommendation as JSON")
+	cmd.Flags().BoolVar(&noModelFlag, "no-model", false, "only analyze the API and the commit types, without the model")
+
+	return cmd
+}
+
+func recommendVersion(from, to string, useModel bool) (*semverReport, error) {
+	release, err := newRelease(from, to, "")
+	if err != nil {
+		return nil, err
+	}
+
+	apiChanges, err := compareAPI(release.from, release.to)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &semverReport{From: release.from, To: release.to, Reasons: []string{}, APIChanges: []string{}}
+
+	for i := range apiChanges {
+		report.APIChanges = append(report.APIChanges, apiChanges[i].String())
+	}
+
+	apiBump := semver.FromAPI(apiChanges)
+	commitBump, commitReasons := semver.FromCommits(release.commits)
+	bump := max(apiBump, commitBump)
+
+	report.Reasons = append(report.Reasons, apiReasons(apiChanges)...)
+	report.Reasons = append(report.Reasons, commitReasons...)
+
+	if useModel {
+		modelBump, reasoning, err := askForBump(release, apiChanges, bump)
+		if err != nil {
+			return nil, err
+		}
+
+		if modelBump > bump {
+			report.Reasons = append(report.Reasons, "the model found the changes call for a "+modelBump.String()+" release")
+			bump = modelBump
+		}
+
+		report.Reasoning = reasoning
+	}
+
+	if current, ok := semver.ParseVersion(release.from); ok {
+		if effective := current.Effective(bump); effective != bump {
+			report.Reasons = append(report.Reasons,
+				fmt.Sprintf("%s is before 1.0.0, so the %s changes make a %s release", current, bump, effective))
+			bump = effective
+		}
+
+		report.Current = current.String()
+		report.Next = current.Next(bump).String()
+	}
+
+	report.Bump = bump.String()
+
+	return report, nil
+}
+
+// compareAPI returns the changes to the exported Go API between the refs.
+func compareAPI(from, to string) ([]semver.Change, error) {
+	before, err := changes.FilesAt(from, semver.IsAPIFile)
+	if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+
+	after, err := changes.FilesAt(to, semver.IsAPIFile)
+	if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+
+	return semver.Compare(semver.ParseAPI(before), semver.ParseAPI(after)), nil
+}
+
+func apiReasons(apiChanges []semver.Change) []string {
+	var breaking, added []string
+
+	for i := range apiChanges {
+		if apiChanges[i].Breaking {
+			breaking = append(breaking, apiChanges[i].String())
+		} else {
+			added = append(added, apiChanges[i].String())
+		}
+	}
+
+	switch {
+	case len(breaking) > 0:
+		return []string{fmt.Sprintf("%d breaking API changes, such as %s", len(breaking), breaking[0])}
+	case len(added) > 0:
+		return []string{fmt.Sprintf("%d additions to the API, such as %s", len(added), added[0])}
+	}
+
+	return nil
+}
+
+// askForBump has the model review the commits and API changes, returning the
+// bump it finds and why.
+func askForBump(release *release, apiChanges []semver.Change, detected semver.Bump) (semver.Bump, string, error) {
+	var prompt strings.Builder
+
+	fmt.Fprintf(&prompt, "Recommend the semantic version bump, major, minor or patch, for releasing these commits. "+
+		"The analysis of the exported Go API and the commit types found a %s release. Look for what it misses, "+
+		"such as breaking changes in behavior, configuration, command line flags or file formats, and explain "+
+		"your recommendation in two to four sentences, naming the changes that decide it.\n\n", detected)
+
+	if len(apiChanges) == 0 {
+		prompt.WriteString("The exported Go API is unchanged.\n")
+	} else {
+		prompt.WriteString("Changes to the exported Go API:\n")
+
+		for i := range apiChanges[:min(len(apiChanges), maxListedChanges)] {
+			prompt.WriteString("- " + apiChanges[i].String() + "\n")
+		}
+	}
+
+	prompt.WriteString("\nReply with JSON only, like {\"bump\": \"minor\", \"reasoning\": \"...\"}.")
+
+	reply, err := askAboutCommits(release, prompt.String())
+	if err != nil {
+		return semver.None, "", err
+	}
+
+	var answer struct {
+		Bump      string `json:"bump"`
+		Reasoning string `json:"reasoning"`
+	}
+
+	start, end := strings.IndexByte(reply, '{'), strings.LastIndexByte(reply, '}')
+	if start < 0 || end < start || json.Unmarshal([]byte(reply[start:end+1]), &answer) != nil {
+		slog.Warn("could not read the recommendation of the model")
+		return semver.None, strings.TrimSpace(reply), nil
+	}
+
+	bump, _ := semver.ParseBump(answer.Bump)
+
+	return bump, strings.TrimSpace(answer.Reasoning), nil
+}
+
+func printSemverReport(report *semverReport) {
+	var out strings.Builder
+
+	if report.Next != "" {
+		fmt.Fprintf(&out, "%s release: %s -> %s\n", report.Bump, report.Current, report.Next)
+	} else {
+		fmt.Fprintf(&out, "%s release since %s\n", report.Bump, report.From)
+	}
+
+	for _, reason := range report.Reasons {
+		out.WriteString("  - " + reason + "\n")
+	}
+
+	if report.Reasoning != "" {
+		out.WriteString("\n" + report.Reasoning + "\n")
+	}
+
+	if len(report.APIChanges) > 0 {
+		out.WriteString("\nAPI changes:\n")
+
+		for _, change := range report.APIChanges[:min(len(report.APIChanges), maxListedChanges)] {
+			out.WriteString("  " + change + "\n")
+		}
+
+		if len(report.APIChanges) > maxListedChanges {
+			fmt.Fprintf(&out, "  and %d more\n", len(report.APIChanges)-maxListedChanges)
+		}
+	}
+
+	fmt.Print(out.String()) //nolint:forbidigo
+}
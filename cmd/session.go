@@ -0,0 +1,294 @@
+package cmd
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"strings"
+
+	"github.com/sashabaranov/go-openai"
+
+	"github.com/emilkje/cwc/pkg/chat"
+	"github.com/emilkje/cwc/pkg/filetree"
+	"github.com/emilkje/cwc/pkg/hooks"
+	"github.com/emilkje/cwc/pkg/providers"
+	"github.com/emilkje/cwc/pkg/ui"
+)
+
+// chatSession drives the interactive chat loop. It owns the files used as
+// context so that slash commands can change them between turns.
+type chatSession struct {
+	provider     providers.Provider
+	conversation *chat.Conversation
+	printer      *chunkPrinter
+	editor       *ui.LineEditor
+	files        []filetree.File
+	filter       *contextFilter
+	params       chat.Parameters
+	tools        []chat.Tool
+	hooks        *hooks.Runner
+	prefill      string
+	// autoWriteFiles offers to write the files of each response, see
+	// --write-files. offeredReply is the latest response offered.
+	autoWriteFiles bool
+	offeredReply   string
+	// verifier checks the written edits and has failures fixed, see --verify.
+	verifier *verifier
+	// editFormat is how edits are asked for, see --edit-format.
+	editFormat string
+	// committer commits the written edits to a branch, see --commit-branch.
+	committer *branchCommitter
+	// dryRunFormat is the format the first request is printed in instead of
+	// being sent, see --dry-run.
+	dryRunFormat string
+	// recorder saves each turn once answered, with the stats of the answer.
+	recorder *sessionRecorder
+	answered bool
+	stats    *chat.TurnStats
+	// pendingOutput holds the output of /shell commands until the next
+	// message is sent.
+	pendingOutput []string
+	// prompt and reply are the latest message and its response, for the
+	// post-response hooks.
+	prompt string
+	reply  strings.Builder
+	// logProbsFile is where the log probabilities of the responses are
+	// appended, see --logprobs.
+	logProbsFile string
+	// options are the flags the context was gathered with, whose filters
+	// /add applies too.
+	options *chatOptions
+}
+
+func newChatSession(provider providers.Provider, files []filetree.File, opts *chatOptions) *chatSession {
+	session := &chatSession{
+		provider:       provider,
+		printer:        newChunkPrinter(opts.showStats),
+		editor:         ui.NewLineEditor(),
+		files:          files,
+		filter:         opts.filter,
+		params:         opts.params,
+		tools:          opts.tools,
+		hooks:          opts.hooks,
+		logProbsFile:   opts.logProbsFile,
+		prefill:        opts.prefill,
+		autoWriteFiles: opts.writeFiles,
+		recorder:       opts.recorder,
+		verifier:       opts.verifier,
+		editFormat:     opts.editFormat,
+		committer:      opts.committer,
+		dryRunFormat:   opts.dryRun,
+		options:        opts,
+	}
+
+	session.editor.SetCompleter(session.complete)
+
+	return session
+}
+
+// run reads messages from the user until the chat ends. If args holds a
+// prompt it is sent as the first message.
+func (s *chatSession) run(args []string) error {
+	if s.committer != nil {
+		defer s.committer.finish()
+	}
+
+	if len(args) > 0 {
+		ui.PrintMessage(fmt.Sprintf("%s: %s\n", ui.CurrentTheme().UserGlyph, args[0]), ui.MessageTypeInfo)
+
+		if !s.handle(args[0]) {
+			return nil
+		}
+	}
+
+	for {
+		s.wait()
+		s.saveTurn()
+		s.offerFiles()
+
+		message, ok := s.readUserMessage()
+		if !ok || !s.handle(message) {
+			return nil
+		}
+	}
+}
+
+// handle executes a slash command or sends the message to the model, with
+// a leading // sending it starting with a single /. It returns false when
+// the chat should end.
+func (s *chatSession) handle(message string) bool {
+	if message == "" {
+		return true
+	}
+
+	if escaped, ok := strings.CutPrefix(message, "//"); ok {
+		message = "/" + escaped
+	} else if command, arg, ok := parseSlashCommand(message); ok {
+		return command.run(s, arg)
+	}
+
+	if s.committer != nil {
+		s.committer.setTask(message)
+	}
+
+	s.send(message)
+
+	return true
+}
+
+// readUserMessage prompts the user for the next message. It returns false
+// when the user presses Ctrl-C or Ctrl-D.
+func (s *chatSession) readUserMessage() (string, bool) {
+	message, err := s.editor.ReadLine(ui.CurrentTheme().UserGlyph + ": ")
+	if err != nil {
+		return "", false
+	}
+
+	return message, true
+}
+
+func (s *chatSession) send(message string) {
+	message, ok := s.prepare(message)
+	if !ok {
+		return
+	}
+
+	s.prompt = message
+	s.reply.Reset()
+	s.answered = false
+	s.printer.BeginTurn()
+
+	if s.conversation == nil {
+		s.conversation = s.newChat().BeginConversation(message)
+		return
+	}
+
+	s.conversation.Reply(message)
+}
+
+// prepare turns the message into the prompt sent: expanded, after the
+// output of /shell commands and the pre-send hooks, and redacted. It returns
+// false if a hook refused the message.
+func (s *chatSession) prepare(message string) (string, bool) {
+	message = expandPrompt(message, s.files, true)
+
+	if len(s.pendingOutput) > 0 {
+		message = strings.Join(s.pendingOutput, "\n") + "\n" + message
+		s.pendingOutput = nil
+	}
+
+	message, err := s.hooks.PreSend(message)
+	if err != nil {
+		ui.PrintMessage(fmt.Sprintf("not sending the message: %s\n", err), ui.MessageTypeError)
+		return "", false
+	}
+
+	message, summary := s.filter.redactPrompt(message)
+	if summary != "" {
+		ui.PrintMessage(fmt.Sprintf("warning: redacted %s in your message\n", summary), ui.MessageTypeWarning)
+	}
+
+	if s.autoWriteFiles {
+		message += writeFilesInstruction
+	}
+
+	return message, true
+}
+
+func (s *chatSession) newChat() *chat.Chat {
+	chatInstance := chat.NewChat(s.provider, createSystemMessageFromFiles(s.files, s.filter), s.handleChunk)
+	chatInstance.SetParameters(s.params)
+	chatInstance.SetContextTrimmer(newContextTrimmer(&s.files, s.filter))
+	chatInstance.SetTools(s.tools)
+	chatInstance.SetPrefill(s.prefill)
+
+	return chatInstance
+}
+
+// dryRun prints the request the message would begin the chat with, built as
+// send builds it, instead of sending it.
+func (s *chatSession) dryRun(cfg openai.ClientConfig, message string) error {
+	message, ok := s.prepare(message)
+	if !ok {
+		return nil
+	}
+
+	return printRequest(cfg, s.provider, s.newChat().Request(message), s.dryRunFormat)
+}
+
+// handleChunk prints the response and runs the post-response hooks once it
+// is complete.
+func (s *chatSession) handleChunk(chunk *chat.ConversationChunk) {
+	s.printer.HandleChunk(chunk)
+
+	if chunk.IsErrorChunk || chunk.Notice != "" {
+		return
+	}
+
+	s.reply.WriteString(chunk.Content)
+
+	if chunk.IsFinalChunk {
+		s.answered = true
+		s.stats = chunk.Stats
+
+		if s.logProbsFile != "" {
+			err := appendLogProbs(s.logProbsFile, s.prompt, s.reply.String(), chunk.Stats, chunk.LogProbs)
+			if err != nil {
+				slog.Warn("could not write log probabilities", "file", s.logProbsFile, "error", err)
+			}
+		}
+
+		if err := s.hooks.PostResponse(s.prompt, s.reply.String()); err != nil {
+			slog.Warn("post-response hook failed", "error", err)
+		}
+	}
+}
+
+// saveTurn records the latest turn in the history once, if it was answered.
+func (s *chatSession) saveTurn() {
+	if !s.answered || s.conversation == nil {
+		return
+	}
+
+	s.answered = false
+	s.recorder.record(s.conversation.SystemMessage(), s.prompt, s.reply.String(), s.stats)
+}
+
+// wait blocks until the response is complete. Ctrl-C cancels the response
+// rather than ending the chat.
+func (s *chatSession) wait() {
+	if s.conversation == nil {
+		return
+	}
+
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt)
+
+	defer signal.Stop(interrupts)
+
+	done := make(chan struct{})
+
+	go func() {
+		s.conversation.WaitMyTurn()
+		close(done)
+	}()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-interrupts:
+			s.conversation.Cancel()
+		}
+	}
+}
+
+// setFiles replaces the files used as context for the following turns.
+func (s *chatSession) setFiles(files []filetree.File) {
+	s.files = files
+
+	if s.conversation != nil {
+		s.conversation.SetSystemMessage(createSystemMessageFromFiles(files, s.filter))
+	}
+}
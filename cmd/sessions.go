@@ -0,0 +1,507 @@
+package cmd
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/emilkje/cwc/pkg/chat"
+	"github.com/emilkje/cwc/pkg/config"
+	"github.com/emilkje/cwc/pkg/providers"
+	"github.com/emilkje/cwc/pkg/sessions"
+	"github.com/emilkje/cwc/pkg/ui"
+)
+
+const (
+	// sessionTitleLength is the length of the title shown in lists.
+	sessionTitleLength = 60
+	// titleExcerptLength is the length of the prompt and the response sent
+	// to the title model.
+	titleExcerptLength = 1500
+	// titleTimeout bounds how long a turn waits for the title model.
+	titleTimeout = 10 * time.Second
+	titlePrompt  = "Write a title of at most six words for a conversation starting with the exchange below. " +
+		"Reply with the title only.\n\nPrompt:\n%s\n\nResponse:\n%s"
+	// zipMagic starts every zip file.
+	zipMagic = "PK\x03\x04"
+)
+
+// sessionRecorder saves the turns of a chat to the history as they complete.
+// A nil recorder records nothing.
+type sessionRecorder struct {
+	store   *sessions.Store
+	session *sessions.Session
+	// titleModel names the session after its first exchange, if set.
+	titleModel string
+}
+
+// newSessionRecorder starts a session in the history, or returns nil if the
+// history is disabled.
+func newSessionRecorder(cfg *config.Config) *sessionRecorder {
+	if cfg != nil && cfg.Sessions != nil && cfg.Sessions.Disabled {
+		return nil
+	}
+
+	store, err := openSessionStore()
+	if err != nil {
+		slog.Warn("the session is not saved", "error", err)
+		return nil
+	}
+
+	recorder := &sessionRecorder{store: store, session: sessions.New()}
+	if cfg != nil && cfg.Sessions != nil {
+		recorder.titleModel = cfg.Sessions.TitleModel
+	}
+
+	return recorder
+}
+
+// record saves a completed turn, with the model and system fingerprint of
+// the stats if there are any, naming the session after the first one.
+// Failing to save is only a warning.
+func (r *sessionRecorder) record(context, prompt, response string, stats *chat.TurnStats) {
+	if r == nil {
+		return
+	}
+
+	turn := sessions.Turn{Prompt: prompt, Response: response}
+	if stats != nil {
+		turn.Model = stats.Model
+		turn.SystemFingerprint = stats.SystemFingerprint
+	}
+
+	r.session.Add(context, turn)
+
+	if r.session.Name == "" && len(r.session.Turns) == 1 {
+		r.session.Name = titleSession(r.titleModel, prompt, response)
+	}
+
+	if err := r.store.Save(r.session); err != nil {
+		slog.Warn("could not save the session", "error", err)
+	}
+}
+
+// titleSession asks the title model for a title of a session starting with
+// the given exchange, and falls back to the first words of the prompt if it
+// isn't set or doesn't answer in time.
+func titleSession(titleModel, prompt, response string) string {
+	fallback := sessions.HeuristicTitle(prompt)
+	if titleModel == "" {
+		return fallback
+	}
+
+	clientConfig, err := config.NewFromConfigFile()
+	if err != nil {
+		return fallback
+	}
+
+	session := chat.NewSession(providers.New(clientConfig), "")
+	session.SetParameters(chat.Parameters{Model: titleModel})
+
+	titled := make(chan string, 1)
+
+	go func() {
+		reply, err := collectReply(session, fmt.Sprintf(titlePrompt,
+			truncateRunes(prompt, titleExcerptLength), truncateRunes(response, titleExcerptLength)))
+		if err != nil {
+			slog.Debug("could not title the session", "error", err)
+		}
+
+		titled <- sessions.CleanTitle(reply)
+	}()
+
+	select {
+	case title := <-titled:
+		if title != "" {
+			return title
+		}
+	case <-time.After(titleTimeout):
+		slog.Debug("the title model did not answer in time", "timeout", titleTimeout)
+	}
+
+	return fallback
+}
+
+func truncateRunes(text string, length int) string {
+	if runes := []rune(text); len(runes) > length {
+		return string(runes[:length]) + "…"
+	}
+
+	return text
+}
+
+// openSessionStore opens the history of sessions, encrypted with the key in
+// the keyring if sessions.encrypt is set in the config file.
+func openSessionStore() (*sessions.Store, error) {
+	dir, err := config.SessionsDir()
+	if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+
+	cfg, err := config.LoadConfigOrDefault()
+	if err != nil {
+		return nil, fmt.Errorf("error reading config: %w", err)
+	}
+
+	if cfg.Sessions == nil || !cfg.Sessions.Encrypt {
+		return sessions.NewStore(dir), nil
+	}
+
+	key, err := config.EncryptionKey()
+	if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+
+	return sessions.NewEncryptedStore(dir, key), nil
+}
+
+func createSessionsCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "sessions",
+		Short: "List, show, replay, export and import saved chat sessions",
+		Long: "Every chat is saved with its prompts, responses and the context they were sent with, unless\n" +
+			"sessions.disabled is set in the config file. Sessions are named by an ID starting with the time they\n" +
+			"began, and any unique prefix of it will do.",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return listSessions()
+		},
+	}
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "list",
+		Short: "List the saved sessions, the most recent first",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return listSessions()
+		},
+	})
+	cmd.AddCommand(createSessionsShowCmd())
+	cmd.AddCommand(createSessionsReplayCmd())
+	cmd.AddCommand(createSessionsExportCmd())
+	cmd.AddCommand(createSessionsImportCmd())
+	cmd.AddCommand(&cobra.Command{
+		Use:   "schema",
+		Short: "Print the JSON Schema of the sessions exported with --format json",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			_, err := cmd.OutOrStdout().Write(sessions.Schema)
+
+			return err //nolint:wrapcheck
+		},
+	})
+
+	return cmd
+}
+
+func listSessions() error {
+	store, err := openSessionStore()
+	if err != nil {
+		return err
+	}
+
+	list, err := store.List()
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	if len(list) == 0 {
+		ui.PrintMessage("no saved sessions\n", ui.MessageTypeInfo)
+		return nil
+	}
+
+	for _, s := range list {
+		model := s.Model()
+		if model == "" {
+			model = "-"
+		}
+
+		turns := "turns"
+		if len(s.Turns) == 1 {
+			turns = "turn"
+		}
+
+		ui.PrintMessage(fmt.Sprintf("%s  %3d %-5s  %-20s  %s\n", s.ID, len(s.Turns), turns, model,
+			s.Title(sessionTitleLength)), ui.MessageTypeInfo)
+	}
+
+	return nil
+}
+
+func createSessionsShowCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "show <id>",
+		Short: "Print the prompts and responses of a session",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			store, err := openSessionStore()
+			if err != nil {
+				return err
+			}
+
+			s, err := store.Load(args[0])
+			if err != nil {
+				return err //nolint:wrapcheck
+			}
+
+			if s.ReplayOf != "" {
+				ui.PrintMessage(fmt.Sprintf("replay of %s\n", s.ReplayOf), ui.MessageTypeDim)
+			}
+
+			for _, turn := range s.Turns {
+				ui.PrintMessage(fmt.Sprintf("\n%s: %s\n", ui.CurrentTheme().UserGlyph, turn.Prompt), ui.MessageTypeInfo)
+
+				label := ui.CurrentTheme().AssistantGlyph
+				if turn.Model != "" {
+					label += " (" + turn.Model + ")"
+				}
+
+				ui.PrintMessage(label+": ", ui.MessageTypeInfo)
+				ui.PrintMessage(strings.TrimRight(turn.Response, "\n")+"\n", ui.MessageTypeInfo)
+			}
+
+			return nil
+		},
+	}
+}
+
+func createSessionsReplayCmd() *cobra.Command {
+	var modelFlag string
+
+	cmd := &cobra.Command{
+		Use:   "replay <id>",
+		Short: "Send the prompts of a session again, to another model",
+		Long: "Replay sends the prompts of a saved session again, one after the other with the context each was\n" +
+			"sent with, and saves the responses as a new session. With --model, another model, or on Azure\n" +
+			"another deployment, answers, for comparing models on real work with cwc sessions show.",
+		Example: "  cwc sessions replay 20240501-101500 --model gpt-4o\n" +
+			"  cwc sessions show 20240501-101500 && cwc sessions show <new id>",
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			store, err := openSessionStore()
+			if err != nil {
+				return err
+			}
+
+			original, err := store.Load(args[0])
+			if err != nil {
+				return err //nolint:wrapcheck
+			}
+
+			return replaySession(store, original, modelFlag)
+		},
+	}
+
+	cmd.Flags().StringVar(&modelFlag, "model", "",
+		"The model, or on Azure the deployment, to answer with instead of the configured one")
+
+	return cmd
+}
+
+// replaySession sends the prompts of the session again and saves the
+// responses as a new session.
+func replaySession(store *sessions.Store, original *sessions.Session, model string) error {
+	if len(original.Turns) == 0 {
+		return fmt.Errorf("session %s has no turns to replay", original.ID)
+	}
+
+	clientConfig, err := newClientConfig()
+	if err != nil {
+		return err
+	}
+
+	session := chat.NewSession(providers.New(clientConfig), original.Context(0))
+	session.SetParameters(chat.Parameters{Model: model})
+
+	replay := sessions.New()
+	replay.ReplayOf = original.ID
+
+	replay.Name = original.Name
+	if replay.Name == "" {
+		replay.Name = sessions.HeuristicTitle(original.Turns[0].Prompt)
+	}
+
+	for i, turn := range original.Turns {
+		context := original.Context(i)
+		if i > 0 && turn.Context != "" {
+			session.SetSystemMessage(context)
+		}
+
+		ui.PrintMessage(fmt.Sprintf("\n%s: %s\n", ui.CurrentTheme().UserGlyph, turn.Prompt), ui.MessageTypeInfo)
+
+		response, err := askWithSpinner(session, turn.Prompt)
+		if err != nil {
+			return fmt.Errorf("error replaying turn %d: %w", i+1, err)
+		}
+
+		ui.PrintMessage(ui.CurrentTheme().AssistantGlyph+": ", ui.MessageTypeInfo)
+		ui.PrintMessage(strings.TrimRight(response, "\n")+"\n", ui.MessageTypeInfo)
+
+		replay.Add(context, sessions.Turn{Prompt: turn.Prompt, Response: response, Model: model})
+	}
+
+	if err := store.Save(replay); err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	ui.PrintMessage(fmt.Sprintf("\nsaved the replay as session %s\n", replay.ID), ui.MessageTypeSuccess)
+
+	return nil
+}
+
+func createSessionsExportCmd() *cobra.Command {
+	var (
+		formatFlag string
+		outputFlag string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "export [id...]",
+		Short: "Export sessions as JSON or in the ShareGPT format",
+		Long: "Export writes the given sessions, or all of them, to stdout or the file given with --output.\n" +
+			"--format json keeps everything cwc saves, as described by cwc sessions schema, and can be imported\n" +
+			"again. --format sharegpt writes a ShareGPT dataset, with a conversation per session, for other\n" +
+			"chat tools and for fine-tuning.",
+		Example: "  cwc sessions export --output sessions.json\n" +
+			"  cwc sessions export 20240501-101500 --format sharegpt > dataset.json",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			store, err := openSessionStore()
+			if err != nil {
+				return err
+			}
+
+			list, err := loadSessions(store, args)
+			if err != nil {
+				return err
+			}
+
+			var out strings.Builder
+			if err := sessions.Export(&out, list, formatFlag); err != nil {
+				return err //nolint:wrapcheck
+			}
+
+			if outputFlag == "" {
+				_, err := fmt.Fprint(cmd.OutOrStdout(), out.String())
+
+				return err //nolint:wrapcheck
+			}
+
+			if err := writeOutputFile(outputFlag, out.String()); err != nil {
+				return err
+			}
+
+			ui.PrintMessage(fmt.Sprintf("exported %d sessions to %s\n", len(list), outputFlag), ui.MessageTypeSuccess)
+
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&formatFlag, "format", sessions.FormatJSON,
+		"The format to export in: "+sessions.FormatJSON+" or "+sessions.FormatShareGPT)
+	cmd.Flags().StringVarP(&outputFlag, "output", "o", "", "Write the sessions to the given file instead of stdout")
+
+	return cmd
+}
+
+// loadSessions loads the sessions with the given IDs, or every session if
+// none are given.
+func loadSessions(store *sessions.Store, ids []string) ([]*sessions.Session, error) {
+	if len(ids) == 0 {
+		return store.List() //nolint:wrapcheck
+	}
+
+	list := make([]*sessions.Session, 0, len(ids))
+
+	for _, id := range ids {
+		s, err := store.Load(id)
+		if err != nil {
+			return nil, err //nolint:wrapcheck
+		}
+
+		list = append(list, s)
+	}
+
+	return list, nil
+}
+
+func createSessionsImportCmd() *cobra.Command {
+	var replaceFlag bool
+
+	cmd := &cobra.Command{
+		Use:   "import <file>",
+		Short: "Import sessions exported by cwc, a ShareGPT dataset or a ChatGPT or Claude data export",
+		Long: "Import adds the sessions in a file written by cwc sessions export, in either format, to the saved\n" +
+			"sessions. The zip files of the data exports of ChatGPT and Claude, or the conversations.json in\n" +
+			"them, are imported too, so that past discussions can be listed, read and replayed with cwc. The\n" +
+			"format is told from the content. Sessions that are already saved are skipped unless --replace is\n" +
+			"given, while conversations from a ShareGPT file always get new IDs.",
+		Example: "  cwc sessions import sessions.json\n" +
+			"  cwc sessions import chatgpt-export.zip",
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			store, err := openSessionStore()
+			if err != nil {
+				return err
+			}
+
+			list, err := importSessionsFile(args[0])
+			if err != nil {
+				return fmt.Errorf("error importing %s: %w", args[0], err)
+			}
+
+			imported, skipped := 0, 0
+
+			for _, s := range list {
+				if !replaceFlag && store.Exists(s.ID) {
+					skipped++
+					continue
+				}
+
+				if err := store.Save(s); err != nil {
+					return err //nolint:wrapcheck
+				}
+
+				imported++
+			}
+
+			message := fmt.Sprintf("imported %d sessions", imported)
+			if skipped > 0 {
+				message += fmt.Sprintf(", skipped %d already saved", skipped)
+			}
+
+			ui.PrintMessage(message+"\n", ui.MessageTypeSuccess)
+
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&replaceFlag, "replace", false, "Replace saved sessions with the same ID")
+
+	return cmd
+}
+
+// importSessionsFile reads the sessions in a file given to cwc sessions
+// import, which is either JSON or a zip archive holding it.
+func importSessionsFile(path string) ([]*sessions.Session, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+	defer file.Close()
+
+	magic := make([]byte, len(zipMagic))
+	if _, err := file.ReadAt(magic, 0); err == nil && string(magic) == zipMagic {
+		info, err := file.Stat()
+		if err != nil {
+			return nil, err //nolint:wrapcheck
+		}
+
+		return sessions.ImportArchive(file, info.Size()) //nolint:wrapcheck
+	}
+
+	return sessions.Import(file) //nolint:wrapcheck
+}
@@ -0,0 +1,79 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/emilkje/cwc/pkg/config"
+	"github.com/emilkje/cwc/pkg/pathmatcher"
+	"github.com/emilkje/cwc/pkg/sandbox"
+	"github.com/emilkje/cwc/pkg/ui"
+)
+
+// newRepoSandbox creates the sandbox configured in the config file, made
+// stricter by the settings of the current repository.
+func newRepoSandbox() (*sandbox.Sandbox, error) {
+	cfg, err := config.LoadConfigOrDefault()
+	if err != nil {
+		return nil, fmt.Errorf("error reading config: %w", err)
+	}
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		return nil, fmt.Errorf("error getting current directory: %w", err)
+	}
+
+	root := pathmatcher.FindRepositoryRoot(cwd)
+
+	repoConfig, err := config.LoadRepoConfig(root)
+	if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+
+	return sandbox.New(cfg.Sandbox, repoConfig.Sandbox, root) //nolint:wrapcheck
+}
+
+// shellCommand runs a command in the sandbox and attaches its output to the
+// next message. Arguments are split on whitespace and no shell is involved,
+// so pipes and redirections are passed to the command as is.
+func shellCommand(s *chatSession, arg string) bool {
+	argv := strings.Fields(arg)
+	if len(argv) == 0 {
+		ui.PrintMessage("usage: /shell <command>\n", ui.MessageTypeWarning)
+		return true
+	}
+
+	box, err := newRepoSandbox()
+	if err != nil {
+		ui.PrintMessage(fmt.Sprintf("error setting up the sandbox: %s\n", err), ui.MessageTypeError)
+		return true
+	}
+
+	ui.PrintMessage(fmt.Sprintf("running %s (%s)\n", argv[0], box.Describe()), ui.MessageTypeNotice)
+
+	result, err := box.Run(context.Background(), argv)
+	if err != nil {
+		ui.PrintMessage(fmt.Sprintf("could not run %s: %s\n", argv[0], err), ui.MessageTypeError)
+		return true
+	}
+
+	ui.PrintMessage(result.Output, ui.MessageTypeInfo)
+
+	status := fmt.Sprintf("exit code %d", result.ExitCode)
+	if result.TimedOut {
+		status = "timed out"
+	}
+
+	if result.Truncated {
+		status += ", output truncated"
+	}
+
+	ui.PrintMessage(fmt.Sprintf("%s, the output will be sent with your next message\n", status), ui.MessageTypeNotice)
+
+	s.pendingOutput = append(s.pendingOutput,
+		fmt.Sprintf("Output of `%s` (%s):\n```\n%s\n```\n", arg, status, strings.TrimRight(result.Output, "\n")))
+
+	return true
+}
@@ -0,0 +1,321 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/emilkje/cwc/pkg/filetree"
+	"github.com/emilkje/cwc/pkg/pathmatcher"
+	"github.com/emilkje/cwc/pkg/ui"
+)
+
+// slashCommand is a command that can be typed at the chat prompt instead of
+// a message to the model.
+type slashCommand struct {
+	name        string
+	usage       string
+	description string
+	// complete returns candidates for the argument typed so far, if the command takes one.
+	complete func(s *chatSession, arg string) []string
+	// run executes the command and returns false if the chat should end.
+	run func(s *chatSession, arg string) bool
+}
+
+func slashCommands() []*slashCommand {
+	return []*slashCommand{
+		{
+			name:        "/help",
+			usage:       "/help",
+			description: "list the available commands",
+			run: func(s *chatSession, _ string) bool {
+				printSlashHelp()
+				return true
+			},
+		},
+		{
+			name:        "/exit",
+			usage:       "/exit",
+			description: "end the chat",
+			run:         func(*chatSession, string) bool { return false },
+		},
+		{
+			name:        "/add",
+			usage:       "/add <path>",
+			description: "add a file to the context",
+			complete:    completeFilesystemPath,
+			run:         addFileCommand,
+		},
+		{
+			name:        "/drop",
+			usage:       "/drop <path>",
+			description: "remove a file from the context",
+			complete:    completeContextPath,
+			run:         dropFileCommand,
+		},
+		{
+			name:        "/stats",
+			usage:       "/stats",
+			description: "show the usage of the session and toggle the footer after each response",
+			run:         statsCommand,
+		},
+		{
+			name:        "/apply",
+			usage:       "/apply [-p]",
+			description: "apply the diffs in the last response to the files, -p to choose hunk by hunk",
+			run:         applyCommand,
+		},
+		{
+			name:        "/write",
+			usage:       "/write",
+			description: "write the code blocks of the last response annotated with a path to their files",
+			run:         writeFilesCommand,
+		},
+		{
+			name:        "/undo-apply",
+			usage:       "/undo-apply",
+			description: "restore the files changed by the last /apply or /write, --force if changed since",
+			run:         undoApplyCommand,
+		},
+		{
+			name:        "/shell",
+			usage:       "/shell <command>",
+			description: "run a command in the sandbox and send its output with the next message",
+			run:         shellCommand,
+		},
+	}
+}
+
+// parseSlashCommand splits a message into a command and its argument. It
+// reports false if the first word of the message isn't a command, so that
+// messages starting with a path such as /etc/hosts are sent as they are.
+func parseSlashCommand(message string) (*slashCommand, string, bool) {
+	if !strings.HasPrefix(message, "/") {
+		return nil, "", false
+	}
+
+	name, arg, _ := strings.Cut(message, " ")
+
+	for _, command := range slashCommands() {
+		if command.name == name {
+			return command, strings.TrimSpace(arg), true
+		}
+	}
+
+	return nil, "", false
+}
+
+func printSlashHelp() {
+	var help strings.Builder
+
+	for _, command := range slashCommands() {
+		fmt.Fprintf(&help, "  %-18s %s\n", command.usage, command.description)
+	}
+
+	help.WriteString("Start a message with // to send it starting with a single /.\n")
+
+	ui.PrintMessage(help.String(), ui.MessageTypeNotice)
+}
+
+// complete is the tab completion handler for the chat prompt. It completes
+// command names and, once a command has been typed, its argument.
+func (s *chatSession) complete(text string) ([]string, int) {
+	if !strings.HasPrefix(text, "/") {
+		return nil, 0
+	}
+
+	name, arg, hasArg := strings.Cut(text, " ")
+
+	if !hasArg {
+		var candidates []string
+
+		for _, command := range slashCommands() {
+			if strings.HasPrefix(command.name, name) {
+				candidates = append(candidates, command.name)
+			}
+		}
+
+		return candidates, 0
+	}
+
+	for _, command := range slashCommands() {
+		if command.name == name && command.complete != nil {
+			arg = strings.TrimLeft(arg, " ")
+
+			return command.complete(s, arg), len([]rune(text)) - len([]rune(arg))
+		}
+	}
+
+	return nil, 0
+}
+
+// completeFilesystemPath completes repository relative paths on disk.
+func completeFilesystemPath(_ *chatSession, arg string) []string {
+	dir, base := filepath.Split(arg)
+
+	listDir := dir
+	if listDir == "" {
+		listDir = "."
+	}
+
+	entries, err := os.ReadDir(listDir)
+	if err != nil {
+		return nil
+	}
+
+	var candidates []string
+
+	for _, entry := range entries {
+		if !strings.HasPrefix(entry.Name(), base) || (strings.HasPrefix(entry.Name(), ".") && base == "") {
+			continue
+		}
+
+		candidate := dir + entry.Name()
+		if entry.IsDir() {
+			candidate += "/"
+		}
+
+		candidates = append(candidates, candidate)
+	}
+
+	sort.Strings(candidates)
+
+	return candidates
+}
+
+// completeContextPath completes paths of the files currently in the context.
+func completeContextPath(s *chatSession, arg string) []string {
+	var candidates []string
+
+	for _, file := range s.files {
+		if strings.HasPrefix(file.Path, arg) {
+			candidates = append(candidates, file.Path)
+		}
+	}
+
+	return candidates
+}
+
+func addFileCommand(s *chatSession, arg string) bool {
+	if arg == "" {
+		ui.PrintMessage("usage: /add <path>\n", ui.MessageTypeWarning)
+		return true
+	}
+
+	excluded, err := s.excludedFromContext(arg)
+	if err != nil {
+		ui.PrintMessage(fmt.Sprintf("could not add %s: %s\n", arg, err), ui.MessageTypeError)
+		return true
+	}
+
+	if excluded {
+		ui.PrintMessage(fmt.Sprintf("%s is excluded from the context by the filters of the chat\n", arg),
+			ui.MessageTypeWarning)
+
+		return true
+	}
+
+	file, err := filetree.LoadFile(arg)
+	if err != nil {
+		ui.PrintMessage(fmt.Sprintf("could not add %s: %s\n", arg, err), ui.MessageTypeError)
+		return true
+	}
+
+	// files are replaced in place or appended rather than kept sorted, so
+	// that the start of the system message stays the same for prompt caching
+	files := slices.Clone(s.files)
+	if i := slices.IndexFunc(files, func(f filetree.File) bool { return f.Path == file.Path }); i >= 0 {
+		files[i] = *file
+	} else {
+		files = append(files, *file)
+	}
+
+	s.setFiles(files)
+	ui.PrintMessage(fmt.Sprintf("added %s to the context\n", file.Path), ui.MessageTypeSuccess)
+
+	return true
+}
+
+// excludedFromContext reports whether the filters the context was gathered
+// with leave the file out, so /add doesn't pull in what they exclude: the
+// --exclude pattern, the ignore files, the .git directory and third-party
+// code.
+func (s *chatSession) excludedFromContext(path string) (bool, error) {
+	matchers, err := filterMatchers(s.options)
+	if err != nil {
+		return false, err
+	}
+
+	if !s.options.includeThirdPartyFlag {
+		thirdParty, err := pathmatcher.NewThirdPartyPathMatcher(s.options.pathsFlag)
+		if err != nil {
+			return false, fmt.Errorf("error creating third-party matcher: %w", err)
+		}
+
+		matchers = append(matchers, thirdParty)
+	}
+
+	matcher := pathmatcher.NewCompoundPathMatcher(matchers...)
+
+	path = filepath.Clean(path)
+	if matcher.Match(path) {
+		return true, nil
+	}
+
+	for dir := filepath.Dir(path); dir != "." && dir != filepath.Dir(dir); dir = filepath.Dir(dir) {
+		if matcher.Match(dir) || matcher.MatchDir(dir) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func dropFileCommand(s *chatSession, arg string) bool {
+	if arg == "" {
+		ui.PrintMessage("usage: /drop <path>\n", ui.MessageTypeWarning)
+		return true
+	}
+
+	path := filepath.Clean(arg)
+
+	files := slices.DeleteFunc(slices.Clone(s.files), func(f filetree.File) bool {
+		return f.Path == path
+	})
+
+	if len(files) == len(s.files) {
+		ui.PrintMessage(fmt.Sprintf("%s is not part of the context\n", path), ui.MessageTypeWarning)
+		return true
+	}
+
+	s.setFiles(files)
+	ui.PrintMessage(fmt.Sprintf("dropped %s from the context\n", path), ui.MessageTypeSuccess)
+
+	return true
+}
+
+func statsCommand(s *chatSession, _ string) bool {
+	if totals := s.printer.totals; totals.Turns > 0 {
+		ui.PrintMessage(fmt.Sprintf("%d responses: %s\n", totals.Turns, totals.String()), ui.MessageTypeNotice)
+	} else {
+		ui.PrintMessage("no responses yet\n", ui.MessageTypeNotice)
+	}
+
+	if !s.params.IsZero() {
+		ui.PrintMessage(fmt.Sprintf("sampling parameters: %s\n", s.params), ui.MessageTypeNotice)
+	}
+
+	s.printer.showStats = !s.printer.showStats
+
+	state := "off"
+	if s.printer.showStats {
+		state = "on"
+	}
+
+	ui.PrintMessage(fmt.Sprintf("the footer after each response is now %s\n", state), ui.MessageTypeNotice)
+
+	return true
+}
@@ -0,0 +1,148 @@
+package cmd
+
+import (
+	"fmt"
+	"log/slog"
+
+	"github.com/spf13/cobra"
+
+	"github.com/emilkje/cwc/pkg/chat"
+	"github.com/emilkje/cwc/pkg/config"
+	"github.com/emilkje/cwc/pkg/filetree"
+	"github.com/emilkje/cwc/pkg/providers"
+	"github.com/emilkje/cwc/pkg/repomap"
+	"github.com/emilkje/cwc/pkg/summarize"
+	"github.com/emilkje/cwc/pkg/ui"
+)
+
+func createSummarizeCmd() *cobra.Command {
+	var (
+		includeFlag              string
+		excludeFlag              string
+		pathsFlag                []string
+		langFlag                 []string
+		ignoreFilesFlag          []string
+		filesFlag                []string
+		ownedByFlag              []string
+		changedSinceFlag         string
+		withDepsFlag             bool
+		workspaceFlag            string
+		excludeFromGitignoreFlag bool
+		excludeGitDirFlag        bool
+		includeThirdPartyFlag    bool
+		outputFlag               string
+		partTokensFlag           int
+	)
+
+	cmd := &cobra.Command{
+		Use:   "summarize",
+		Short: "Write an overview of the repository for onboarding",
+		Long: "Summarize splits the files of the repository into parts that fit the context window, has the model\n" +
+			"summarize each part, and combines the summaries into an overview of the purpose, entry points, key\n" +
+			"packages, build and test commands and notable patterns of the repository. The overview is printed,\n" +
+			"or written to --output, such as docs/ARCHITECTURE.md.",
+		Example: "  cwc summarize -o docs/ARCHITECTURE.md\n" +
+			"  cwc summarize --paths pkg --exclude _test\\.go$",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			files, _, err := gatherContext(&chatOptions{
+				includeFlag:              includeFlag,
+				excludeFlag:              excludeFlag,
+				pathsFlag:                pathsFlag,
+				langFlag:                 langFlag,
+				ignoreFilesFlag:          ignoreFilesFlag,
+				filesFlag:                filesFlag,
+				ownedByFlag:              ownedByFlag,
+				changedSinceFlag:         changedSinceFlag,
+				withDepsFlag:             withDepsFlag,
+				workspaceFlag:            workspaceFlag,
+				excludeFromGitignoreFlag: excludeFromGitignoreFlag,
+				excludeGitDirFlag:        excludeGitDirFlag,
+				includeThirdPartyFlag:    includeThirdPartyFlag,
+			})
+			if err != nil {
+				return err
+			}
+
+			overview, err := summarizeRepository(files, partTokensFlag)
+			if err != nil {
+				return err
+			}
+
+			if outputFlag == "" {
+				fmt.Print(overview) //nolint:forbidigo
+				return nil
+			}
+
+			return writeGenerated(outputFlag, overview, "overview")
+		},
+	}
+
+	initFlags(cmd, &flags{
+		includeFlag:              &includeFlag,
+		excludeFlag:              &excludeFlag,
+		pathsFlag:                &pathsFlag,
+		langFlag:                 &langFlag,
+		ignoreFilesFlag:          &ignoreFilesFlag,
+		filesFlag:                &filesFlag,
+		ownedByFlag:              &ownedByFlag,
+		changedSinceFlag:         &changedSinceFlag,
+		withDepsFlag:             &withDepsFlag,
+		workspaceFlag:            &workspaceFlag,
+		excludeFromGitignoreFlag: &excludeFromGitignoreFlag,
+		excludeGitDirFlag:        &excludeGitDirFlag,
+		includeThirdPartyFlag:    &includeThirdPartyFlag,
+	})
+
+	cmd.Flags().StringVarP(&outputFlag, "output", "o", "", "the file to write the overview to, such as docs/ARCHITECTURE.md")
+	cmd.Flags().IntVar(&partTokensFlag, "part-tokens", summarize.DefaultPartTokens,
+		"the approximate size in tokens of the parts the files are summarized in")
+
+	return cmd
+}
+
+func summarizeRepository(files []filetree.File, partTokens int) (string, error) {
+	userConfig, err := config.LoadConfigOrDefault()
+	if err != nil {
+		return "", fmt.Errorf("error reading config: %w", err)
+	}
+
+	filter, err := newContextFilter(userConfig)
+	if err != nil {
+		return "", err
+	}
+
+	// the map is given once, when the summaries are combined
+	filter.repoMap = false
+
+	clientConfig, err := newClientConfig()
+	if err != nil {
+		return "", err
+	}
+
+	provider := providers.New(clientConfig)
+	progress := ui.NewProgressLine()
+
+	repoMap, _ := filter.apply("the repository map", buildRepoMap(files, repomap.DefaultTokens))
+
+	overview, err := summarize.Summarize(files, &summarize.Options{
+		Ask: func(systemMessage, prompt string) (string, error) {
+			return collectReply(chat.NewSession(provider, systemMessage), prompt)
+		},
+		Render: func(part []filetree.File) string {
+			return createSystemMessageFromFiles(part, filter)
+		},
+		PartTokens: partTokens,
+		Map:        repoMap,
+		OnProgress: func(done, total int) {
+			progress.Update(fmt.Sprintf("summarizing: %d/%d requests", done, total))
+		},
+		OnSkip: func(file filetree.File) {
+			slog.Warn("leaving out a file larger than a part", "path", file.Path)
+		},
+	})
+
+	progress.Done()
+
+	return overview, err //nolint:wrapcheck
+}
@@ -0,0 +1,114 @@
+package cmd
+
+import (
+	"context"
+	"log/slog"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/emilkje/cwc/pkg/config"
+	"github.com/emilkje/cwc/pkg/telemetry"
+)
+
+const (
+	defaultServiceName = "cwc"
+	tracesPath         = "/v1/traces"
+	// telemetryShutdownTimeout bounds how long exiting waits for the spans.
+	telemetryShutdownTimeout = 5 * time.Second
+)
+
+// startTelemetry traces the command if an OpenTelemetry collector is
+// configured, in the config file or the standard environment variables, and
+// exports the spans when the command completes. A collector that can't be
+// reached only causes a warning.
+func startTelemetry(cmd *cobra.Command, cfg *config.Config) {
+	telemetryConfig, ok := resolveTelemetryConfig(cfg)
+	if !ok {
+		return
+	}
+
+	if err := config.CheckOffline(telemetryConfig.Endpoint); err != nil {
+		slog.Warn("not exporting traces", "error", err)
+		return
+	}
+
+	telemetry.Start(telemetryConfig, cmd.CommandPath())
+
+	cobra.OnFinalize(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), telemetryShutdownTimeout)
+		defer cancel()
+
+		if err := telemetry.Stop(ctx); err != nil {
+			slog.Warn("could not export traces", "error", err)
+		}
+	})
+}
+
+// resolveTelemetryConfig reads where traces are exported to, following the
+// OpenTelemetry conventions: OTEL_EXPORTER_OTLP_TRACES_ENDPOINT is used as
+// is, while the traces path is appended to a base endpoint.
+func resolveTelemetryConfig(cfg *config.Config) (telemetry.Config, bool) {
+	var fileConfig config.TelemetryConfig
+	if cfg != nil && cfg.Telemetry != nil {
+		fileConfig = *cfg.Telemetry
+	}
+
+	endpoint := os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT")
+	if endpoint == "" {
+		base := fileConfig.Endpoint
+		if base == "" {
+			base = os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT")
+		}
+
+		if base == "" {
+			return telemetry.Config{}, false
+		}
+
+		endpoint = strings.TrimSuffix(base, "/")
+		if !strings.HasSuffix(endpoint, tracesPath) {
+			endpoint += tracesPath
+		}
+	}
+
+	headers := parseOTLPHeaders(os.Getenv("OTEL_EXPORTER_OTLP_HEADERS"))
+	for key, value := range fileConfig.Headers {
+		headers[key] = value
+	}
+
+	serviceName := fileConfig.ServiceName
+	if serviceName == "" {
+		serviceName = os.Getenv("OTEL_SERVICE_NAME")
+	}
+
+	if serviceName == "" {
+		serviceName = defaultServiceName
+	}
+
+	return telemetry.Config{Endpoint: endpoint, Headers: headers, ServiceName: serviceName}, true
+}
+
+// parseOTLPHeaders parses headers in the format of
+// OTEL_EXPORTER_OTLP_HEADERS, e.g. "api-key=secret,tenant=acme", where the
+// values may be URL encoded.
+func parseOTLPHeaders(value string) map[string]string {
+	headers := make(map[string]string)
+
+	for _, pair := range strings.Split(value, ",") {
+		key, val, found := strings.Cut(pair, "=")
+		if !found || strings.TrimSpace(key) == "" {
+			continue
+		}
+
+		if unescaped, err := url.QueryUnescape(strings.TrimSpace(val)); err == nil {
+			val = unescaped
+		}
+
+		headers[strings.TrimSpace(key)] = strings.TrimSpace(val)
+	}
+
+	return headers
+}
@@ -0,0 +1,67 @@
+package cmd
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/emilkje/cwc/pkg/chat"
+	"github.com/emilkje/cwc/pkg/filetree"
+)
+
+// newContextTrimmer returns a trimmer that leaves one file out of the
+// context each time the request doesn't fit the context window. The files
+// are kept in *files, so the caller sees what is left.
+func newContextTrimmer(files *[]filetree.File, filter *contextFilter) chat.ContextTrimmer {
+	return func(userMessages []string) (string, string, bool) {
+		remaining, dropped, ok := dropLeastRelevantFile(*files, userMessages)
+		if !ok {
+			return "", "", false
+		}
+
+		*files = remaining
+
+		notice := fmt.Sprintf("left %s (~%d tokens) out of the context",
+			dropped.Path, chat.EstimateTokensForSize(dropped.Size))
+
+		return createSystemMessageFromFiles(remaining, filter), notice, true
+	}
+}
+
+// dropLeastRelevantFile removes the largest file that none of the messages
+// mention by path or name, or the largest file if all of them are mentioned.
+// The last file is never removed, since a context without files tells the
+// model nothing.
+func dropLeastRelevantFile(files []filetree.File, messages []string) ([]filetree.File, filetree.File, bool) {
+	if len(files) < 2 { //nolint:gomnd
+		return files, filetree.File{}, false
+	}
+
+	text := strings.Join(messages, "\n")
+	mentioned := func(file filetree.File) bool {
+		return strings.Contains(text, file.Path) || strings.Contains(text, filepath.Base(file.Path))
+	}
+
+	drop := -1
+
+	for _, preferUnmentioned := range []bool{true, false} {
+		for i, file := range files {
+			if preferUnmentioned && mentioned(file) {
+				continue
+			}
+
+			if drop < 0 || file.Size > files[drop].Size {
+				drop = i
+			}
+		}
+
+		if drop >= 0 {
+			break
+		}
+	}
+
+	dropped := files[drop]
+
+	return slices.Delete(slices.Clone(files), drop, drop+1), dropped, true
+}
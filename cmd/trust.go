@@ -0,0 +1,212 @@
+package cmd
+
+import (
+	stderrors "errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/term"
+
+	"github.com/emilkje/cwc/pkg/config"
+	"github.com/emilkje/cwc/pkg/pathmatcher"
+	"github.com/emilkje/cwc/pkg/ui"
+)
+
+// credentialDirs are the directories below the home directory that hold
+// keys, tokens and passwords.
+var credentialDirs = []string{ //nolint:gochecknoglobals
+	".ssh",
+	".aws",
+	".azure",
+	".gnupg",
+	".kube",
+	".docker",
+	".config",
+	".password-store",
+	".local/share/keyrings",
+}
+
+// confirmDirectories asks the user to trust the directories files are about
+// to be gathered from that are outside the repository, or sensitive, such as
+// the home directory or /etc, before anything in them is sent. Trusted
+// directories are remembered in the config file. Without a terminal to ask
+// in, untrusted directories are refused.
+func confirmDirectories(paths []string) error {
+	cfg, err := config.LoadConfigOrDefault()
+	if err != nil {
+		return fmt.Errorf("error reading config: %w", err)
+	}
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		return fmt.Errorf("error getting working directory: %w", err)
+	}
+
+	root := pathmatcher.FindRepositoryRoot(cwd)
+	if root == "" {
+		root = cwd
+	}
+
+	root = resolvePath(root)
+	home, _ := os.UserHomeDir()
+
+	if home != "" {
+		home = resolvePath(home)
+	}
+
+	for _, path := range paths {
+		dir := resolvePath(path)
+
+		reason, sensitive := untrustedReason(dir, root, home)
+		if reason == "" {
+			continue
+		}
+
+		// a sensitive directory is only trusted by name, not by trusting one
+		// above it
+		if entry, ok := cfg.TrustedDirectory(dir); ok && (!sensitive || entry == dir) {
+			continue
+		}
+
+		if err := confirmDirectory(dir, reason); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func confirmDirectory(dir, reason string) error {
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		return fmt.Errorf("not gathering files from %s as %s and it has not been trusted, "+
+			"run cwc in a terminal once to trust it or add it to trustedDirectories in the config file", dir, reason)
+	}
+
+	ui.PrintMessage(fmt.Sprintf("Files in %s are about to be gathered as context, but %s.\n", dir, reason),
+		ui.MessageTypeWarning)
+
+	if !ui.AskYesNo("Trust this directory?", false) {
+		return stderrors.New("aborted: the directory was not trusted")
+	}
+
+	if err := config.TrustDirectory(dir); err != nil {
+		slog.Warn("could not remember the directory", "dir", dir, "error", err)
+	}
+
+	return nil
+}
+
+// untrustedReason tells why gathering files from dir needs the user's
+// trust, or returns "" if it needn't, and whether dir is sensitive wherever
+// it is rather than just outside the repository.
+func untrustedReason(dir, root, home string) (string, bool) {
+	switch {
+	case filepath.Dir(dir) == dir:
+		return "it is the root of the file system", true
+	case home != "" && dir == home:
+		return "it is your home directory", true
+	case config.IsWithin(dir, "/etc"):
+		return "it holds the configuration of the system", true
+	}
+
+	if home != "" {
+		for _, credentials := range credentialDirs {
+			if config.IsWithin(dir, filepath.Join(home, credentials)) {
+				return "it holds credentials", true
+			}
+		}
+	}
+
+	if !config.IsWithin(dir, root) {
+		return "it is outside the repository", false
+	}
+
+	return "", false
+}
+
+// resolvePath returns the absolute path with symbolic links resolved, or as
+// far as it can be resolved.
+func resolvePath(path string) string {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return filepath.Clean(path)
+	}
+
+	if resolved, err := filepath.EvalSymlinks(abs); err == nil {
+		return resolved
+	}
+
+	return abs
+}
+
+// repoConfigAnswers remembers what the user answered about the commands of
+// a repository configuration during this run, by root and digest.
+var repoConfigAnswers = make(map[string]bool) //nolint:gochecknoglobals
+
+// confirmRepoCommands makes sure the user trusts the shell commands the
+// repository configuration at root runs, such as hooks, formatters and the
+// verify command, before any of them runs. Cloning a repository would
+// otherwise be enough to run its commands. The answer is remembered in the
+// config file until the repository configuration changes. Without a terminal
+// to ask in, untrusted commands are refused.
+func confirmRepoCommands(root string, repoConfig *config.RepoConfig) error {
+	commands := repoConfig.Commands()
+	if len(commands) == 0 {
+		return nil
+	}
+
+	root = resolvePath(root)
+	key := root + "\x00" + repoConfig.Digest()
+
+	if trusted, asked := repoConfigAnswers[key]; asked {
+		if !trusted {
+			return stderrors.New("the commands of the repository config were not trusted")
+		}
+
+		return nil
+	}
+
+	cfg, err := config.LoadConfigOrDefault()
+	if err != nil {
+		return fmt.Errorf("error reading config: %w", err)
+	}
+
+	if cfg.RepoConfigTrusted(root, repoConfig.Digest()) {
+		return nil
+	}
+
+	configPath := filepath.Join(root, config.RepoConfigPath)
+
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		return fmt.Errorf("not running the commands in %s as they have not been trusted, "+
+			"run cwc in a terminal once to trust them", configPath)
+	}
+
+	var details strings.Builder
+
+	fmt.Fprintf(&details, "%s runs these commands on your machine:\n", configPath)
+
+	for _, command := range commands {
+		fmt.Fprintf(&details, "  %s\n", command)
+	}
+
+	details.WriteString("Only trust them if you trust the repository.\n")
+
+	ui.PrintMessage(details.String(), ui.MessageTypeWarning)
+
+	trusted := ui.AskYesNo("Run these commands?", false)
+	repoConfigAnswers[key] = trusted
+
+	if !trusted {
+		return stderrors.New("aborted: the commands of the repository config were not trusted")
+	}
+
+	if err := config.TrustRepoConfig(root, repoConfig.Digest()); err != nil {
+		slog.Warn("could not remember the repository config", "path", configPath, "error", err)
+	}
+
+	return nil
+}
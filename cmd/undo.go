@@ -0,0 +1,110 @@
+package cmd
+
+import (
+	stderrors "errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/emilkje/cwc/pkg/backup"
+	"github.com/emilkje/cwc/pkg/config"
+	"github.com/emilkje/cwc/pkg/filetree"
+	"github.com/emilkje/cwc/pkg/pathmatcher"
+	"github.com/emilkje/cwc/pkg/ui"
+)
+
+func createUndoCmd() *cobra.Command {
+	var forceFlag bool
+
+	cmd := &cobra.Command{
+		Use:   "undo",
+		Short: "Undo the changes applied last in the current repository",
+		Long: "Undo restores the files changed by the latest /apply, /write, cwc fix or other command that\n" +
+			"edited files in the current repository, and removes the files it created. Running it again\n" +
+			"undoes the changes applied before, up to the 20 most recent. Files changed since the changes\n" +
+			"were applied are left alone unless --force is given.",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			restored, err := undoLastApply(forceFlag)
+			if err != nil {
+				return err
+			}
+
+			ui.PrintMessage(fmt.Sprintf("restored %s\n", strings.Join(restored, ", ")), ui.MessageTypeSuccess)
+
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&forceFlag, "force", false, "restore the files even if they were changed since")
+
+	return cmd
+}
+
+// undoLastApply restores the files of the latest backup of the current
+// repository and returns their paths, relative to the working directory.
+func undoLastApply(force bool) ([]string, error) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return nil, fmt.Errorf("error getting current directory: %w", err)
+	}
+
+	dir, err := config.BackupsDir()
+	if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+
+	restored, err := backup.NewStore(dir).Undo(pathmatcher.FindRepositoryRoot(cwd), force)
+	if stderrors.As(err, new(backup.ModifiedError)) {
+		return nil, fmt.Errorf("not undoing the changes, --force restores them anyway: %w", err)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("not undoing the changes: %w", err)
+	}
+
+	paths := make([]string, 0, len(restored.Files))
+
+	for _, file := range restored.Files {
+		path, err := filepath.Rel(cwd, file.Path)
+		if err != nil {
+			path = file.Path
+		}
+
+		paths = append(paths, path)
+	}
+
+	return paths, nil
+}
+
+func undoApplyCommand(s *chatSession, arg string) bool {
+	restored, err := undoLastApply(arg == "--force")
+	if err != nil {
+		ui.PrintMessage(err.Error()+"\n", ui.MessageTypeError)
+		return true
+	}
+
+	// the context is read again, leaving out the files the changes created
+	files := slices.Clone(s.files)
+
+	for i := len(files) - 1; i >= 0; i-- {
+		if !slices.Contains(restored, filepath.Clean(files[i].Path)) {
+			continue
+		}
+
+		if file, err := filetree.LoadFile(files[i].Path); err == nil {
+			files[i] = *file
+		} else {
+			files = slices.Delete(files, i, i+1)
+		}
+	}
+
+	s.setFiles(files)
+	ui.PrintMessage(fmt.Sprintf("restored %s\n", strings.Join(restored, ", ")), ui.MessageTypeSuccess)
+
+	return true
+}
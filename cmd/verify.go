@@ -0,0 +1,211 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	stderrors "errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/emilkje/cwc/pkg/config"
+	"github.com/emilkje/cwc/pkg/edits"
+	"github.com/emilkje/cwc/pkg/pathmatcher"
+	"github.com/emilkje/cwc/pkg/ui"
+)
+
+const (
+	// defaultVerifyAttempts is how often the model is asked to fix what the
+	// verify command reports before giving up.
+	defaultVerifyAttempts = 3
+	defaultVerifyTimeout  = 5 * time.Minute
+	// formatWholeFiles asks for whole files rather than edits, see
+	// --write-files.
+	formatWholeFiles = "whole-files"
+)
+
+// verifier runs the command that checks the edits written to the files,
+// such as go build ./..., see --verify.
+type verifier struct {
+	command  string
+	attempts int
+	timeout  time.Duration
+	root     string
+}
+
+// newVerifier creates the verifier for the command given with --verify, or
+// else the one in .cwc/config.yaml once the user trusts it. It returns nil if
+// there is neither.
+func newVerifier(command string) (*verifier, error) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return nil, fmt.Errorf("error getting current directory: %w", err)
+	}
+
+	root := pathmatcher.FindRepositoryRoot(cwd)
+
+	repoConfig, err := config.LoadRepoConfig(root)
+	if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+
+	cfg := repoConfig.Verify
+	if cfg == nil {
+		cfg = &config.VerifyConfig{}
+	}
+
+	// a command given with --verify is the user's own
+	fromRepo := command == ""
+	if fromRepo {
+		command = cfg.Command
+	}
+
+	if strings.TrimSpace(command) == "" {
+		return nil, nil //nolint:nilnil
+	}
+
+	if fromRepo {
+		if err := confirmRepoCommands(root, repoConfig); err != nil {
+			return nil, err
+		}
+	}
+
+	v := &verifier{command: command, attempts: defaultVerifyAttempts, timeout: defaultVerifyTimeout, root: root}
+
+	if cfg.Attempts > 0 {
+		v.attempts = cfg.Attempts
+	}
+
+	if cfg.Timeout != "" {
+		if v.timeout, err = time.ParseDuration(cfg.Timeout); err != nil || v.timeout <= 0 {
+			return nil, fmt.Errorf("invalid verify timeout %q", cfg.Timeout)
+		}
+	}
+
+	return v, nil
+}
+
+// run runs the command from the repository root and returns its output and
+// whether it succeeded. Output that doesn't fit a prompt keeps its start,
+// where the first errors are.
+func (v *verifier) run() (string, bool) {
+	spinner := ui.NewSpinner("running " + v.command)
+	spinner.Start()
+
+	defer spinner.Stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), v.timeout)
+	defer cancel()
+
+	var output bytes.Buffer
+
+	cmd := exec.CommandContext(ctx, "sh", "-c", v.command) // #nosec
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", v.command) // #nosec
+	}
+
+	cmd.Dir = v.root
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+
+	err := cmd.Run()
+
+	text := strings.TrimSpace(output.String())
+	if len(text) > maxFixInput {
+		text = text[:maxFixInput] + "\n[output truncated]"
+	}
+
+	switch {
+	case stderrors.Is(ctx.Err(), context.DeadlineExceeded):
+		return fmt.Sprintf("%s\n[the command did not finish within %s]", text, v.timeout), false
+	case err != nil && text == "":
+		return err.Error(), false
+	}
+
+	return text, err == nil
+}
+
+// verifyPrompt asks for a fix of what the verify command reports, as edits
+// in the format or, with --write-files, as whole files.
+func verifyPrompt(command, output, format string) string {
+	answer := edits.Instruction(format)
+	if format == formatWholeFiles {
+		answer = "by writing the whole of each file that changes"
+	}
+
+	return fmt.Sprintf("The changes were applied, but `%s` fails with the output below. Fix the cause with the "+
+		"smallest change that keeps the intent of the code; don't silence errors by deleting tests or code. "+
+		"Reply with the fix %s.\n\n```\n%s\n```", command, answer, output)
+}
+
+// verify runs the verify command after edits were written. When it fails,
+// its output is sent to the model, and the fix is applied once confirmed
+// and verified again, as often as the verifier allows.
+func (s *chatSession) verify() {
+	if s.verifier == nil {
+		return
+	}
+
+	for attempt := 1; ; attempt++ {
+		output, ok := s.verifier.run()
+		if ok {
+			ui.PrintMessage(fmt.Sprintf("%s succeeded\n", s.verifier.command), ui.MessageTypeSuccess)
+			return
+		}
+
+		ui.PrintMessage(fmt.Sprintf("%s failed:\n%s\n", s.verifier.command, output), ui.MessageTypeWarning)
+
+		if attempt > s.verifier.attempts {
+			ui.PrintMessage(fmt.Sprintf("giving up after %d attempts to fix it\n", s.verifier.attempts),
+				ui.MessageTypeError)
+
+			return
+		}
+
+		ui.PrintMessage(fmt.Sprintf("asking for a fix (attempt %d of %d)\n", attempt, s.verifier.attempts),
+			ui.MessageTypeNotice)
+
+		format := s.editFormat
+		if s.autoWriteFiles {
+			format = formatWholeFiles
+		}
+
+		s.send(verifyPrompt(s.verifier.command, output, format))
+		s.wait()
+		s.saveTurn()
+
+		reply := s.conversation.LastReply()
+		s.offeredReply = reply
+
+		plan, confirm := planEdits, func(planned []plannedEdit) bool { return confirmEdits(planned, "Apply the fix?") }
+		if s.autoWriteFiles {
+			plan, confirm = planWrites, confirmWrites
+		}
+
+		planned, err := plan(reply, s.files)
+		if err == nil && len(planned) == 0 {
+			err = stderrors.New("the response contains no changes")
+		}
+
+		if err != nil {
+			ui.PrintMessage(fmt.Sprintf("not applying the fix: %s\n", err), ui.MessageTypeError)
+			return
+		}
+
+		if !confirm(planned) {
+			ui.PrintMessage("nothing was changed\n", ui.MessageTypeInfo)
+			return
+		}
+
+		if err := writeEdits(planned); err != nil {
+			ui.PrintMessage(err.Error()+"\n", ui.MessageTypeError)
+			return
+		}
+
+		s.reloadFiles(planned)
+		s.commitEdits(planned)
+	}
+}
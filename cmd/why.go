@@ -0,0 +1,223 @@
+package cmd
+
+import (
+	stderrors "errors"
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/emilkje/cwc/pkg/audit"
+	"github.com/emilkje/cwc/pkg/changes"
+	"github.com/emilkje/cwc/pkg/config"
+	"github.com/emilkje/cwc/pkg/languages"
+)
+
+const (
+	// maxWhyCommits bounds the commits whose full messages are sent.
+	maxWhyCommits = 15
+	// maxLineHistory bounds how much of the history of the lines is sent.
+	maxLineHistory = 40000
+)
+
+var lineRangeRegexp = regexp.MustCompile(`^(\d+)(?:[-,](\d+))?$`) //nolint:gochecknoglobals
+
+func createWhyCmd() *cobra.Command {
+	var historyFlag int
+
+	cmd := &cobra.Command{
+		Use:   "why <file:line|file:start-end|file:function> [question]",
+		Short: "Explain the history behind a line, a range of lines or a function",
+		Long: "Why blames the lines, reads the messages of the commits that last changed them and the history of\n" +
+			"the region with git log -L, and asks the model to explain why the code is the way it is: what it was\n" +
+			"written for, how it changed and what constraints shaped it. A question narrows the explanation down.\n" +
+			"Functions are found by git, the first definition matching the name.",
+		Example: "  cwc why pkg/config/config.go:87\n" +
+			"  cwc why pkg/config/config.go:80-120 \"why is the file read twice?\"\n" +
+			"  cwc why pkg/config/config.go:LoadConfig",
+		Args: cobra.RangeArgs(1, 2), //nolint:gomnd
+		RunE: func(cmd *cobra.Command, args []string) error {
+			path, lineRange, err := parseWhyTarget(args[0])
+			if err != nil {
+				return err
+			}
+
+			var question string
+			if len(args) > 1 {
+				question = args[1]
+			}
+
+			return explainHistory(path, lineRange, question, historyFlag)
+		},
+	}
+
+	cmd.Flags().IntVar(&historyFlag, "history", 10, "the most commits of the history of the lines to send") //nolint:gomnd
+
+	return cmd
+}
+
+// parseWhyTarget splits file:87, file:80-95 and file:function into the path
+// and a range for git blame -L.
+func parseWhyTarget(target string) (string, string, error) {
+	i := strings.LastIndexByte(target, ':')
+	if i <= 0 || i == len(target)-1 {
+		return "", "", fmt.Errorf("%q names no line, range or function, use a target like file.go:87", target)
+	}
+
+	path, spec := target[:i], target[i+1:]
+
+	if info, err := os.Stat(path); err != nil || !info.Mode().IsRegular() {
+		return "", "", fmt.Errorf("%s is not a file", path)
+	}
+
+	if m := lineRangeRegexp.FindStringSubmatch(spec); m != nil {
+		end := m[2]
+		if end == "" {
+			end = m[1]
+		}
+
+		return path, m[1] + "," + end, nil
+	}
+
+	return path, ":" + spec, nil
+}
+
+func explainHistory(path, lineRange, question string, historyCommits int) error {
+	blame, err := changes.Blame(path, lineRange)
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	if len(blame) == 0 {
+		return fmt.Errorf("no lines in %s match %s", path, strings.TrimPrefix(lineRange, ":"))
+	}
+
+	// git log -L takes the range as found by blame, which also resolves
+	// functions
+	logRange := fmt.Sprintf("%d,%d", blame[0].Line, blame[len(blame)-1].Line)
+
+	history, err := changes.LineHistory(path, logRange, historyCommits)
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	if len(history) > maxLineHistory {
+		history = history[:maxLineHistory] + "\n[history truncated]\n"
+	}
+
+	userConfig, err := config.LoadConfigOrDefault()
+	if err != nil {
+		return fmt.Errorf("error reading config: %w", err)
+	}
+
+	filter, err := newContextFilter(userConfig)
+	if err != nil {
+		return err
+	}
+
+	var label string
+	if name, ok := languages.Detect(path); ok {
+		label = languages.FenceLabel(name)
+	}
+
+	var context strings.Builder
+
+	blamed, ok := filter.apply(path, formatBlame(blame))
+	if !ok {
+		return fmt.Errorf("not sending %s as it contains secrets", path)
+	}
+
+	fmt.Fprintf(&context, "%s, lines %d to %d, with the commit, date and author that last changed each line:\n```%s\n%s```\n\n",
+		path, blame[0].Line, blame[len(blame)-1].Line, label, blamed)
+
+	messages, ok := filter.apply("the commit messages", commitMessages(blame))
+	if !ok {
+		return stderrors.New("not sending the commit messages as they contain secrets")
+	}
+
+	if messages != "" {
+		context.WriteString("The messages of those commits:\n\n" + messages + "\n")
+	}
+
+	history, ok = filter.apply("the history of the lines", history)
+	if !ok {
+		return stderrors.New("not sending the history of the lines as it contains secrets")
+	}
+
+	context.WriteString("The history of the lines, newest first, from git log -L:\n\n```diff\n" + history + "```\n")
+
+	audit.SetFiles([]string{path})
+
+	hookRunner, err := newRepoHooks()
+	if err != nil {
+		return err
+	}
+
+	return nonInteractive(context.String(), whyPrompt(path, blame[0].Line, blame[len(blame)-1].Line, question),
+		&chatOptions{hooks: hookRunner})
+}
+
+func formatBlame(blame []changes.BlameLine) string {
+	var out strings.Builder
+
+	width := len(fmt.Sprint(blame[len(blame)-1].Line))
+
+	for i := range blame {
+		line := &blame[i]
+
+		origin := "uncommitted"
+		if line.Committed() {
+			origin = fmt.Sprintf("%s %s %s", line.Hash[:7], line.Time.Format(time.DateOnly), line.Author) //nolint:gomnd
+		}
+
+		fmt.Fprintf(&out, "%*d | %s | %s\n", width, line.Line, origin, line.Text)
+	}
+
+	return out.String()
+}
+
+// commitMessages returns the full messages of the commits that last changed
+// the lines, newest first.
+func commitMessages(blame []changes.BlameLine) string {
+	var commits []*changes.BlameLine
+
+	for i := range blame {
+		line := &blame[i]
+		if line.Committed() && !slices.ContainsFunc(commits, func(c *changes.BlameLine) bool { return c.Hash == line.Hash }) {
+			commits = append(commits, line)
+		}
+	}
+
+	slices.SortStableFunc(commits, func(a, b *changes.BlameLine) int { return b.Time.Compare(a.Time) })
+
+	var out strings.Builder
+
+	for _, commit := range commits[:min(len(commits), maxWhyCommits)] {
+		message, err := changes.CommitMessage(commit.Hash)
+		if err != nil {
+			message = commit.Summary
+		}
+
+		fmt.Fprintf(&out, "commit %s (%s, %s)\n%s\n\n", commit.Hash[:7], commit.Author, //nolint:gomnd
+			commit.Time.Format(time.DateOnly), message)
+	}
+
+	return out.String()
+}
+
+func whyPrompt(path string, start, end int, question string) string {
+	prompt := fmt.Sprintf("Explain why the code in %s, lines %d to %d, is the way it is, using the blame, the commit "+
+		"messages and the history in the context. Tell what it was written for, how and why it changed over time, "+
+		"and what constraints, bugs or decisions shaped it, citing the commits by their short hash. Say so when "+
+		"the history doesn't tell, rather than guessing.", path, start, end)
+
+	if question != "" {
+		prompt += "\n\nIn particular: " + question
+	}
+
+	return prompt
+}
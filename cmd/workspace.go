@@ -0,0 +1,49 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/emilkje/cwc/pkg/pathmatcher"
+	"github.com/emilkje/cwc/pkg/ui"
+	"github.com/emilkje/cwc/pkg/workspace"
+)
+
+// workspaceScope returns the directories of the named package of the
+// workspace and of the packages it depends on, and those of other packages
+// nested in them.
+func workspaceScope(name string) ([]string, []string, error) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return nil, nil, fmt.Errorf("error getting working directory: %w", err)
+	}
+
+	ws, err := workspace.Detect(pathmatcher.FindRepositoryRoot(cwd))
+	if err != nil {
+		return nil, nil, fmt.Errorf("error reading workspace: %w", err)
+	}
+
+	dirs, nested, err := ws.Scope(name)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error in --workspace: %w", err)
+	}
+
+	ui.PrintMessage(fmt.Sprintf("using the %s workspace in %s: %s\n",
+		ws.Kind, ws.Manifest, strings.Join(dirs, ", ")), ui.MessageTypeNotice)
+
+	return dirs, nested, nil
+}
+
+// dirsPattern is a regular expression matching everything in the
+// directories.
+func dirsPattern(dirs []string) string {
+	quoted := make([]string, len(dirs))
+	for i, dir := range dirs {
+		quoted[i] = regexp.QuoteMeta(filepath.Clean(dir))
+	}
+
+	return `^(?:` + strings.Join(quoted, "|") + `)(?:[/\\]|$)`
+}
@@ -0,0 +1,166 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/emilkje/cwc/pkg/codeblock"
+	"github.com/emilkje/cwc/pkg/edits"
+	"github.com/emilkje/cwc/pkg/filetree"
+	"github.com/emilkje/cwc/pkg/pathmatcher"
+	"github.com/emilkje/cwc/pkg/ui"
+)
+
+// writeFilesInstruction is added to the messages of a chat with
+// --write-files, so that the blocks name their files.
+const writeFilesInstruction = "\n\nWhen you write the full content of a file, put it in a fenced code block with " +
+	"its path from the repository root in the info string, e.g. ```go title=pkg/foo/foo.go."
+
+func writeFilesCommand(s *chatSession, _ string) bool {
+	if s.conversation == nil || s.conversation.LastReply() == "" {
+		ui.PrintMessage("there is no response to write files from yet\n", ui.MessageTypeWarning)
+		return true
+	}
+
+	if !s.writeFiles(s.conversation.LastReply()) {
+		ui.PrintMessage("the last response contains no code blocks annotated with a path, "+
+			"such as ```go title=main.go\n", ui.MessageTypeWarning)
+	}
+
+	return true
+}
+
+// offerFiles asks to write the files of the latest response once, for
+// --write-files.
+func (s *chatSession) offerFiles() {
+	if !s.autoWriteFiles || s.conversation == nil {
+		return
+	}
+
+	reply := s.conversation.LastReply()
+	if reply == "" || reply == s.offeredReply {
+		return
+	}
+
+	s.offeredReply = reply
+	s.writeFiles(reply)
+}
+
+// writeFiles writes the code blocks of the reply annotated with a path to
+// their files once confirmed. It reports false if there are none.
+func (s *chatSession) writeFiles(reply string) bool {
+	planned, err := planWrites(reply, s.files)
+	if err != nil {
+		ui.PrintMessage(fmt.Sprintf("not writing the files: %s\n", err), ui.MessageTypeError)
+		return true
+	}
+
+	if len(planned) == 0 {
+		return false
+	}
+
+	if !confirmWrites(planned) {
+		ui.PrintMessage("nothing was written\n", ui.MessageTypeInfo)
+		return true
+	}
+
+	if err := writeEdits(planned); err != nil {
+		ui.PrintMessage(err.Error()+"\n", ui.MessageTypeError)
+		return true
+	}
+
+	s.reloadFiles(planned)
+	ui.PrintMessage(fmt.Sprintf("wrote %d files\n", len(planned)), ui.MessageTypeSuccess)
+	s.commitEdits(planned)
+	s.verify()
+
+	return true
+}
+
+// planWrites turns the code blocks of the reply annotated with a path into
+// edits replacing the whole file, with the files of the context in scope.
+// When several blocks name the same file, the last one wins.
+func planWrites(reply string, files []filetree.File) ([]plannedEdit, error) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return nil, fmt.Errorf("error getting current directory: %w", err)
+	}
+
+	paths := make([]string, 0, len(files))
+	for _, file := range files {
+		paths = append(paths, file.Path)
+	}
+
+	scope, err := edits.NewScope(pathmatcher.FindRepositoryRoot(cwd), paths)
+	if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+
+	var planned []plannedEdit
+
+	index := make(map[string]int)
+
+	for _, block := range codeblock.Parse(reply) {
+		if block.Path() == "" {
+			continue
+		}
+
+		path := filepath.ToSlash(filepath.Clean(block.Path()))
+
+		edit := plannedEdit{patch: edits.FilePatch{NewPath: path}, content: block.Content}
+
+		if edit.target, err = resolveEditPath(scope, path, &edit); err != nil {
+			return nil, err
+		}
+
+		if _, err := os.Stat(edit.target); err == nil {
+			edit.patch.OldPath = path
+		} else {
+			// creating files is what the blocks are for, only replacing
+			// files outside the context needs a second look
+			edit.outOfScope = false
+		}
+
+		if i, ok := index[path]; ok {
+			planned[i] = edit
+			continue
+		}
+
+		index[path] = len(planned)
+		planned = append(planned, edit)
+	}
+
+	return planned, nil
+}
+
+// confirmWrites lists the files to write and asks before writing them,
+// warning about those outside the context.
+func confirmWrites(planned []plannedEdit) bool {
+	var summary, outOfScope strings.Builder
+
+	for _, edit := range planned {
+		lines := strings.Count(edit.content, "\n")
+
+		if edit.patch.OldPath == "" {
+			fmt.Fprintf(&summary, "  A %s (%d lines)\n", edit.patch.NewPath, lines)
+		} else {
+			fmt.Fprintf(&summary, "  M %s (replaced by %d lines)\n", edit.patch.NewPath, lines)
+		}
+
+		if edit.outOfScope {
+			fmt.Fprintf(&outOfScope, "  %s\n", edit.patch.NewPath)
+		}
+	}
+
+	ui.PrintMessage(summary.String(), ui.MessageTypeNotice)
+
+	if outOfScope.Len() > 0 {
+		ui.PrintMessage("These files are not part of the context:\n"+outOfScope.String(), ui.MessageTypeWarning)
+
+		return ui.AskYesNo("Write them anyway?", false)
+	}
+
+	return ui.AskYesNo(fmt.Sprintf("Write these %d files?", len(planned)), true)
+}
@@ -29,7 +29,7 @@ type Languages map[string]Language
 
 var languageTemplate = `// Code generated with lang-gen. DO NOT EDIT.
 
-package filetree
+package languages
 
 type Language struct {
 	Type               string   ` + "`yaml:\"type\"`" + `
@@ -106,7 +106,7 @@ func main() {
 	// so that we can embed the data in the binary
 
 	// create a file
-	file, err := os.Create("pkg/filetree/languages.go")
+	file, err := os.Create("pkg/languages/languages.go")
 	if err != nil {
 		log.Fatalf("error: %v", err)
 	}
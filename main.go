@@ -1,7 +1,6 @@
 package main
 
 import (
-	"fmt"
 	"os"
 
 	"github.com/emilkje/cwc/cmd"
@@ -12,10 +11,15 @@ import (
 
 func main() {
 	command := cmd.CreateRootCommand()
+	cmd.AddPluginCommands(command, os.Args[1:])
+
+	err := cmd.ExpandAlias(command, os.Args[1:])
+	if err == nil {
+		err = command.Execute()
+	}
 
-	err := command.Execute()
 	if err != nil {
-		ui.PrintMessage(fmt.Sprintf("Error: %s\n", err), ui.MessageTypeError)
+		ui.PrintMessage(ui.T("error", err)+"\n", ui.MessageTypeError)
 		os.Exit(1)
 	}
 }
@@ -0,0 +1,68 @@
+// Package annotations writes findings as GitHub Actions workflow commands,
+// which annotate the lines they point to in the checks and diff of a pull
+// request.
+package annotations
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Level is how an annotation is shown.
+type Level string
+
+// Levels of annotations, from the least to the most severe.
+const (
+	Notice  Level = "notice"
+	Warning Level = "warning"
+	Error   Level = "error"
+)
+
+// Annotation is a message about a range of lines in a file of the
+// repository. Without a file it annotates the workflow run as a whole.
+type Annotation struct {
+	Level Level
+	// File is relative to the root of the repository, with forward slashes.
+	File    string
+	Line    int
+	EndLine int
+	Column  int
+	Title   string
+	Message string
+}
+
+// String returns the workflow command, like
+// ::warning file=main.go,line=12::message.
+func (a *Annotation) String() string {
+	var properties []string
+
+	add := func(name, value string) {
+		if value != "" && value != "0" {
+			properties = append(properties, name+"="+escapeProperty(value))
+		}
+	}
+
+	add("file", a.File)
+	add("line", strconv.Itoa(a.Line))
+	add("endLine", strconv.Itoa(a.EndLine))
+	add("col", strconv.Itoa(a.Column))
+	add("title", a.Title)
+
+	command := "::" + string(a.Level)
+	if len(properties) > 0 {
+		command += " " + strings.Join(properties, ",")
+	}
+
+	return fmt.Sprintf("%s::%s", command, escapeData(a.Message))
+}
+
+// escapeData escapes the message the way the runner unescapes it, so
+// multi-line messages stay in a single command.
+func escapeData(s string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A").Replace(s)
+}
+
+func escapeProperty(s string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A", ":", "%3A", ",", "%2C").Replace(s)
+}
@@ -0,0 +1,277 @@
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/emilkje/cwc/pkg/encryption"
+)
+
+const (
+	logDirPermissions  = 0o700
+	logFilePermissions = 0o600
+	charsPerToken      = 4
+	// maxLineSize is the longest entry Decrypt reads, as the full request
+	// bodies can be large.
+	maxLineSize = 64 << 20
+)
+
+// Entry describes a single request sent to a provider.
+type Entry struct {
+	Time     time.Time `json:"time"`
+	Endpoint string    `json:"endpoint"`
+	Model    string    `json:"model,omitempty"`
+	// Files are the paths of the files in the context when the request was made.
+	Files []string `json:"files,omitempty"`
+	Bytes int      `json:"bytes"`
+	// EstimatedTokens is estimated from the length of the messages or inputs.
+	EstimatedTokens int    `json:"estimatedTokens"`
+	SHA256          string `json:"sha256"`
+	// Content is the full request body, only recorded if configured.
+	Content json.RawMessage `json:"content,omitempty"`
+}
+
+type logger struct {
+	sync.Mutex
+	file        *os.File
+	fullContent bool
+	key         []byte
+	files       []string
+}
+
+var active struct { //nolint:gochecknoglobals
+	sync.Mutex
+	logger *logger
+}
+
+// Start appends an entry to the log at path for every request sent through a
+// Transport, recording the full request bodies if fullContent is set and only
+// their hash otherwise. The bodies are encrypted with key if it is set, see
+// Decrypt, while the rest of the entries stay readable for auditing. Until
+// Start is called, nothing is recorded.
+func Start(path string, fullContent bool, key []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), logDirPermissions); err != nil {
+		return fmt.Errorf("error creating audit log directory: %w", err)
+	}
+
+	// the log is only ever appended to, never rewritten
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, logFilePermissions) // #nosec
+	if err != nil {
+		return fmt.Errorf("error opening audit log: %w", err)
+	}
+
+	active.Lock()
+	active.logger = &logger{file: file, fullContent: fullContent, key: key}
+	active.Unlock()
+
+	return nil
+}
+
+// Stop closes the log.
+func Stop() error {
+	active.Lock()
+	l := active.logger
+	active.logger = nil
+	active.Unlock()
+
+	if l == nil {
+		return nil
+	}
+
+	if err := l.file.Close(); err != nil {
+		return fmt.Errorf("error closing audit log: %w", err)
+	}
+
+	return nil
+}
+
+// SetFiles sets the paths of the files in the context, which are recorded
+// with every following request.
+func SetFiles(paths []string) {
+	if l := current(); l != nil {
+		l.Lock()
+		l.files = append([]string(nil), paths...)
+		l.Unlock()
+	}
+}
+
+func current() *logger {
+	active.Lock()
+	defer active.Unlock()
+
+	return active.logger
+}
+
+// Transport records the requests made through base, which is
+// http.DefaultTransport if nil.
+func Transport(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	return &transport{base: base}
+}
+
+type transport struct {
+	base http.RoundTripper
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	l := current()
+	if l == nil || req.Body == nil {
+		return t.base.RoundTrip(req) //nolint:wrapcheck
+	}
+
+	body, err := io.ReadAll(req.Body)
+	_ = req.Body.Close()
+
+	if err != nil {
+		return nil, fmt.Errorf("error reading request body: %w", err)
+	}
+
+	req.Body = io.NopCloser(bytes.NewReader(body))
+
+	// the entry is written before the request is sent, so nothing leaves
+	// the machine without being recorded
+	if err := l.write(newEntry(req, body, l.fullContent)); err != nil {
+		return nil, err
+	}
+
+	return t.base.RoundTrip(req) //nolint:wrapcheck
+}
+
+func newEntry(req *http.Request, body []byte, fullContent bool) Entry {
+	sum := sha256.Sum256(body)
+
+	// the request bodies of both chat completions and embeddings name the
+	// model, and carry the text as messages or inputs respectively
+	var payload struct {
+		Model    string `json:"model"`
+		Messages []struct {
+			Content string `json:"content"`
+		} `json:"messages"`
+		Input json.RawMessage `json:"input"`
+	}
+
+	_ = json.Unmarshal(body, &payload)
+
+	chars := 0
+	for _, message := range payload.Messages {
+		chars += len(message.Content)
+	}
+
+	var inputs []string
+	if json.Unmarshal(payload.Input, &inputs) != nil {
+		var input string
+		if json.Unmarshal(payload.Input, &input) == nil {
+			inputs = []string{input}
+		}
+	}
+
+	for _, input := range inputs {
+		chars += len(input)
+	}
+
+	entry := Entry{
+		Time:            time.Now().UTC(),
+		Endpoint:        req.URL.String(),
+		Model:           payload.Model,
+		Bytes:           len(body),
+		EstimatedTokens: (chars + charsPerToken - 1) / charsPerToken,
+		SHA256:          hex.EncodeToString(sum[:]),
+	}
+
+	if fullContent && json.Valid(body) {
+		entry.Content = body
+	}
+
+	return entry
+}
+
+func (l *logger) write(entry Entry) error {
+	l.Lock()
+	defer l.Unlock()
+
+	entry.Files = l.files
+
+	if entry.Content != nil && l.key != nil {
+		sealed, err := encryption.Seal(l.key, entry.Content)
+		if err != nil {
+			return fmt.Errorf("error encrypting audit entry: %w", err)
+		}
+
+		if entry.Content, err = json.Marshal(string(sealed)); err != nil {
+			return fmt.Errorf("error marshalling audit entry: %w", err)
+		}
+	}
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("error marshalling audit entry: %w", err)
+	}
+
+	if _, err := l.file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("error writing audit log: %w", err)
+	}
+
+	return nil
+}
+
+// Decrypt copies the log in r to w, with the request bodies encrypted by Start
+// decrypted with key. Lines that aren't entries are copied as they are.
+func Decrypt(w io.Writer, r io.Reader, key []byte) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, maxLineSize)
+
+	for scanner.Scan() {
+		line := scanner.Bytes()
+
+		var entry Entry
+		if err := json.Unmarshal(line, &entry); err == nil {
+			if decrypted, ok, err := decryptContent(entry.Content, key); err != nil {
+				return fmt.Errorf("error decrypting the entry of %s: %w", entry.Time.Format(time.RFC3339), err)
+			} else if ok {
+				entry.Content = decrypted
+
+				if line, err = json.Marshal(entry); err != nil {
+					return fmt.Errorf("error marshalling audit entry: %w", err)
+				}
+			}
+		}
+
+		if _, err := w.Write(append(line, '\n')); err != nil {
+			return fmt.Errorf("error writing audit log: %w", err)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("error reading audit log: %w", err)
+	}
+
+	return nil
+}
+
+// decryptContent decrypts the request body of an entry if it is encrypted.
+func decryptContent(content json.RawMessage, key []byte) (json.RawMessage, bool, error) {
+	var sealed string
+	if json.Unmarshal(content, &sealed) != nil || !encryption.IsSealed([]byte(sealed)) {
+		return nil, false, nil
+	}
+
+	body, err := encryption.Open(key, []byte(sealed))
+	if err != nil {
+		return nil, false, err //nolint:wrapcheck
+	}
+
+	return body, true, nil
+}
@@ -0,0 +1,304 @@
+// Package backup keeps copies of the files cwc is about to change, so that
+// the changes can be undone, even in a working tree with changes of its own.
+package backup
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	stderrors "errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// maxBackups is how many backups are kept, the oldest are removed.
+	maxBackups      = 20
+	fileExt         = ".json"
+	filePermissions = 0o600
+	dirPermissions  = 0o700
+)
+
+// ErrNothingToUndo is returned when there is no backup for the repository.
+var ErrNothingToUndo = stderrors.New("there are no applied changes to undo")
+
+// ModifiedError is returned when files were changed after the changes were
+// applied, so restoring them would lose work.
+type ModifiedError struct {
+	Paths []string
+}
+
+func (e ModifiedError) Error() string {
+	return "changed since the changes were applied: " + strings.Join(e.Paths, ", ")
+}
+
+// File is a file as it was before the changes.
+type File struct {
+	Path string `json:"path"`
+	// Existed is false for files the changes created.
+	Existed bool        `json:"existed"`
+	Mode    os.FileMode `json:"mode,omitempty"`
+	Content []byte      `json:"content,omitempty"`
+	// Written is the SHA-256 of the file after the changes, or empty if
+	// they removed it.
+	Written string `json:"written,omitempty"`
+}
+
+// Backup holds the files of the repository at Root that one application of
+// changes touched.
+type Backup struct {
+	ID      string    `json:"id"`
+	Created time.Time `json:"created"`
+	Root    string    `json:"root"`
+	Files   []File    `json:"files"`
+}
+
+// Take copies the files at the given paths, which need not exist yet.
+func Take(root string, paths []string) (*Backup, error) {
+	now := time.Now()
+	b := &Backup{ID: now.Format("20060102-150405.000000"), Created: now, Root: root}
+	seen := make(map[string]bool, len(paths))
+
+	for _, name := range paths {
+		path, err := filepath.Abs(name)
+		if err != nil {
+			return nil, fmt.Errorf("error resolving %s: %w", name, err)
+		}
+
+		if seen[path] {
+			continue
+		}
+
+		seen[path] = true
+		file := File{Path: path}
+
+		info, err := os.Stat(path)
+
+		switch {
+		case err == nil:
+			if file.Content, err = os.ReadFile(path); err != nil { // #nosec
+				return nil, fmt.Errorf("error backing up %s: %w", path, err)
+			}
+
+			file.Existed, file.Mode = true, info.Mode().Perm()
+		case !stderrors.Is(err, os.ErrNotExist):
+			return nil, fmt.Errorf("error backing up %s: %w", path, err)
+		}
+
+		b.Files = append(b.Files, file)
+	}
+
+	return b, nil
+}
+
+// RecordWritten notes what the files look like after the changes, to tell
+// later whether they were changed since.
+func (b *Backup) RecordWritten() {
+	for i := range b.Files {
+		b.Files[i].Written = fileHash(b.Files[i].Path)
+	}
+}
+
+// Modified returns the files changed since RecordWritten.
+func (b *Backup) Modified() []string {
+	var modified []string
+
+	for _, file := range b.Files {
+		if fileHash(file.Path) != file.Written {
+			modified = append(modified, file.Path)
+		}
+	}
+
+	return modified
+}
+
+// Restore puts the files back as they were, removing those the changes
+// created. Each file is replaced in one step, and if any of them fails the
+// files already restored are put back as they were before, so either all
+// files are restored or none are.
+func (b *Backup) Restore() error {
+	paths := make([]string, 0, len(b.Files))
+	for _, file := range b.Files {
+		paths = append(paths, file.Path)
+	}
+
+	current, err := Take(b.Root, paths)
+	if err != nil {
+		return fmt.Errorf("error restoring the files: %w", err)
+	}
+
+	for i, file := range b.Files {
+		err := restoreFile(&file)
+		if err == nil {
+			continue
+		}
+
+		errs := []error{err}
+
+		for j := i - 1; j >= 0; j-- {
+			if err := restoreFile(&current.Files[j]); err != nil {
+				errs = append(errs, fmt.Errorf("error rolling back: %w", err))
+			}
+		}
+
+		return stderrors.Join(errs...)
+	}
+
+	return nil
+}
+
+// restoreFile puts a file back as it was. The content is written to a
+// temporary file in the same directory first, which is then renamed over
+// the file, so the file is never left half written.
+func restoreFile(file *File) error {
+	if !file.Existed {
+		if err := os.Remove(file.Path); err != nil && !stderrors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("error removing %s: %w", file.Path, err)
+		}
+
+		return nil
+	}
+
+	dir := filepath.Dir(file.Path)
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return fmt.Errorf("error restoring %s: %w", file.Path, err)
+	}
+
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(file.Path)+".cwc-*")
+	if err != nil {
+		return fmt.Errorf("error restoring %s: %w", file.Path, err)
+	}
+
+	_, err = tmp.Write(file.Content)
+	if err == nil {
+		err = tmp.Chmod(file.Mode)
+	}
+
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err == nil {
+		err = os.Rename(tmp.Name(), file.Path)
+	}
+
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+		return fmt.Errorf("error restoring %s: %w", file.Path, err)
+	}
+
+	return nil
+}
+
+// fileHash returns the SHA-256 of the file, or "" if it doesn't exist.
+func fileHash(path string) string {
+	data, err := os.ReadFile(path) // #nosec
+	if err != nil {
+		return ""
+	}
+
+	sum := sha256.Sum256(data)
+
+	return hex.EncodeToString(sum[:])
+}
+
+// Store keeps the backups as files in a directory, for all repositories.
+type Store struct {
+	dir string
+}
+
+// NewStore creates a store keeping the backups in dir, which is created when
+// the first backup is saved.
+func NewStore(dir string) *Store {
+	return &Store{dir: dir}
+}
+
+// Save writes the backup and removes the oldest backups beyond the most
+// recent ones kept.
+func (st *Store) Save(b *Backup) error {
+	if err := os.MkdirAll(st.dir, dirPermissions); err != nil {
+		return fmt.Errorf("error creating backups directory: %w", err)
+	}
+
+	data, err := json.Marshal(b)
+	if err != nil {
+		return fmt.Errorf("error encoding backup: %w", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(st.dir, b.ID+fileExt), data, filePermissions); err != nil {
+		return fmt.Errorf("error writing backup: %w", err)
+	}
+
+	paths := st.paths()
+	for len(paths) > maxBackups {
+		_ = os.Remove(paths[0])
+		paths = paths[1:]
+	}
+
+	return nil
+}
+
+// Latest returns the most recent backup of the repository at root.
+func (st *Store) Latest(root string) (*Backup, error) {
+	paths := st.paths()
+
+	for i := len(paths) - 1; i >= 0; i-- {
+		data, err := os.ReadFile(paths[i]) // #nosec
+		if err != nil {
+			return nil, fmt.Errorf("error reading backup: %w", err)
+		}
+
+		var b Backup
+		if err := json.Unmarshal(data, &b); err != nil {
+			return nil, fmt.Errorf("error decoding %s: %w", filepath.Base(paths[i]), err)
+		}
+
+		if b.Root == root {
+			return &b, nil
+		}
+	}
+
+	return nil, ErrNothingToUndo
+}
+
+// Remove deletes the backup, once it is restored.
+func (st *Store) Remove(b *Backup) error {
+	if err := os.Remove(filepath.Join(st.dir, b.ID+fileExt)); err != nil {
+		return fmt.Errorf("error removing backup: %w", err)
+	}
+
+	return nil
+}
+
+// paths returns the files of the backups, the oldest first.
+func (st *Store) paths() []string {
+	paths, _ := filepath.Glob(filepath.Join(st.dir, "*"+fileExt))
+	sort.Strings(paths)
+
+	return paths
+}
+
+// Undo restores the most recent backup of the repository at root and removes
+// it, so that the next undo goes further back. The backup is kept if it
+// can't be restored. Unless force is set, it fails with a ModifiedError if
+// any of the files were changed since.
+func (st *Store) Undo(root string, force bool) (*Backup, error) {
+	b, err := st.Latest(root)
+	if err != nil {
+		return nil, err
+	}
+
+	if modified := b.Modified(); len(modified) > 0 && !force {
+		return nil, ModifiedError{Paths: modified}
+	}
+
+	if err := b.Restore(); err != nil {
+		return nil, err
+	}
+
+	return b, st.Remove(b)
+}
@@ -0,0 +1,122 @@
+// Package batch runs many prompts from a JSON lines file, each with a
+// context of its own if need be, and reports a result per prompt.
+package batch
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// maxLineSize bounds the length of a line of the prompts file.
+const maxLineSize = 1 << 20
+
+// Request is a line of the prompts file. The context fields are optional,
+// and replace the corresponding flags of cwc batch for the prompt.
+type Request struct {
+	// ID is copied to the result, to tell the results apart. It defaults to
+	// the line number.
+	ID      string   `json:"id,omitempty"`
+	Prompt  string   `json:"prompt"`
+	Include string   `json:"include,omitempty"`
+	Exclude string   `json:"exclude,omitempty"`
+	Paths   []string `json:"paths,omitempty"`
+	Files   []string `json:"files,omitempty"`
+	// Line is the 1-based line of the request in the prompts file.
+	Line int `json:"-"`
+}
+
+// Result is a line of the results file.
+type Result struct {
+	ID       string `json:"id"`
+	Line     int    `json:"line"`
+	Prompt   string `json:"prompt"`
+	Response string `json:"response,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// Read parses the prompts file. Blank lines and lines starting with # are
+// skipped.
+func Read(r io.Reader) ([]Request, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, bufio.MaxScanTokenSize), maxLineSize)
+
+	var requests []Request
+
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		var request Request
+		if err := json.Unmarshal([]byte(text), &request); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+
+		if strings.TrimSpace(request.Prompt) == "" {
+			return nil, fmt.Errorf("line %d: the prompt is missing", line)
+		}
+
+		request.Line = line
+		if request.ID == "" {
+			request.ID = strconv.Itoa(line)
+		}
+
+		requests = append(requests, request)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading prompts: %w", err)
+	}
+
+	return requests, nil
+}
+
+// Run answers the requests, at most concurrency at a time, and calls
+// onResult with each result as it completes. Calls to onResult are never
+// concurrent. A failed request is reported in its result and doesn't stop
+// the others.
+func Run(requests []Request, concurrency int, answer func(Request) (string, error), onResult func(Result)) {
+	concurrency = max(concurrency, 1)
+
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		pending = make(chan Request)
+	)
+
+	for range min(concurrency, len(requests)) {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for request := range pending {
+				result := Result{ID: request.ID, Line: request.Line, Prompt: request.Prompt}
+
+				response, err := answer(request)
+				if err != nil {
+					result.Error = err.Error()
+				} else {
+					result.Response = response
+				}
+
+				mu.Lock()
+				onResult(result)
+				mu.Unlock()
+			}
+		}()
+	}
+
+	for _, request := range requests {
+		pending <- request
+	}
+
+	close(pending)
+	wg.Wait()
+}
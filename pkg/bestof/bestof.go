@@ -0,0 +1,92 @@
+// Package bestof picks the best of several responses to the same prompt.
+// Without a judge model to ask, it relies on self-consistency: the response
+// sharing the most with the others is the least likely to be an outlier.
+package bestof
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Pick returns the index of the candidate that agrees most with the others.
+// If valid is given, candidates it rejects are only picked when it rejects
+// them all. Ties go to the shorter candidate, then to the earlier one. It
+// returns -1 when there are no candidates.
+func Pick(candidates []string, valid func(string) bool) int {
+	eligible := make([]bool, len(candidates))
+	anyValid := false
+
+	for i, candidate := range candidates {
+		eligible[i] = valid == nil || valid(candidate)
+		anyValid = anyValid || eligible[i]
+	}
+
+	words := make([]map[string]bool, len(candidates))
+	for i, candidate := range candidates {
+		words[i] = wordSet(candidate)
+	}
+
+	best, bestScore := -1, -1.0
+
+	for i, candidate := range candidates {
+		if anyValid && !eligible[i] {
+			continue
+		}
+
+		score := agreement(words, i)
+
+		better := score > bestScore ||
+			score == bestScore && len(strings.TrimSpace(candidate)) < len(strings.TrimSpace(candidates[best]))
+		if better {
+			best, bestScore = i, score
+		}
+	}
+
+	return best
+}
+
+// agreement is the mean Jaccard similarity of the words of the candidate at
+// index i to those of the other candidates, from 0 to 1.
+func agreement(words []map[string]bool, i int) float64 {
+	if len(words) < 2 { //nolint:gomnd
+		return 1
+	}
+
+	var total float64
+
+	for j := range words {
+		if j != i {
+			total += jaccard(words[i], words[j])
+		}
+	}
+
+	return total / float64(len(words)-1)
+}
+
+func jaccard(a, b map[string]bool) float64 {
+	if len(a) == 0 && len(b) == 0 {
+		return 1
+	}
+
+	shared := 0
+
+	for word := range a {
+		if b[word] {
+			shared++
+		}
+	}
+
+	return float64(shared) / float64(len(a)+len(b)-shared)
+}
+
+func wordSet(text string) map[string]bool {
+	words := make(map[string]bool)
+
+	for _, word := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		words[word] = true
+	}
+
+	return words
+}
@@ -0,0 +1,359 @@
+// Package cassette records the HTTP requests sent to providers and their
+// responses to a file, and replays them from it later without touching the
+// network. This makes runs of cwc reproducible, for integration tests of cwc
+// itself and for sharing the exact exchange behind a bug report. API keys and
+// other credentials are scrubbed before anything is written.
+package cassette
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/emilkje/cwc/pkg/redact"
+)
+
+const (
+	dirPermissions  = 0o700
+	filePermissions = 0o600
+	// scrubbed replaces the values of sensitive headers and query parameters.
+	scrubbed = "[REDACTED]"
+	version  = 1
+)
+
+// sensitiveHeaders are never written to a cassette with their values.
+var sensitiveHeaders = []string{ //nolint:gochecknoglobals
+	"Authorization",
+	"Api-Key",
+	"X-Api-Key",
+	"Proxy-Authorization",
+	"Cookie",
+	"Set-Cookie",
+	"Openai-Organization",
+}
+
+// sensitiveParams are query parameters holding credentials.
+var sensitiveParams = []string{"api-key", "key", "token", "sig", "code"} //nolint:gochecknoglobals
+
+// Cassette is the file format: the interactions in the order they happened.
+type Cassette struct {
+	Version      int            `json:"version"`
+	Recorded     time.Time      `json:"recorded"`
+	Interactions []*Interaction `json:"interactions"`
+}
+
+// Interaction is a request and the response to it.
+type Interaction struct {
+	Request  Request  `json:"request"`
+	Response Response `json:"response"`
+}
+
+type Request struct {
+	Method string      `json:"method"`
+	URL    string      `json:"url"`
+	Header http.Header `json:"header,omitempty"`
+	Body   string      `json:"body,omitempty"`
+}
+
+type Response struct {
+	Status int         `json:"status"`
+	Header http.Header `json:"header,omitempty"`
+	Body   string      `json:"body"`
+}
+
+type mode int
+
+const (
+	modeOff mode = iota
+	modeRecord
+	modeReplay
+)
+
+var active struct { //nolint:gochecknoglobals
+	sync.Mutex
+	mode     mode
+	path     string
+	cassette *Cassette
+	// used marks the interactions already replayed.
+	used []bool
+}
+
+// Record starts recording the requests sent through a Transport. The
+// cassette is written to path by Stop.
+func Record(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), dirPermissions); err != nil {
+		return fmt.Errorf("error creating cassette directory: %w", err)
+	}
+
+	active.Lock()
+	defer active.Unlock()
+
+	active.mode = modeRecord
+	active.path = path
+	active.cassette = &Cassette{Version: version, Recorded: time.Now().UTC()}
+
+	return nil
+}
+
+// Replay answers the requests sent through a Transport from the cassette at
+// path instead of the network.
+func Replay(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("error reading cassette: %w", err)
+	}
+
+	var cassette Cassette
+	if err := json.Unmarshal(data, &cassette); err != nil {
+		return fmt.Errorf("error parsing cassette %s: %w", path, err)
+	}
+
+	active.Lock()
+	defer active.Unlock()
+
+	active.mode = modeReplay
+	active.path = path
+	active.cassette = &cassette
+	active.used = make([]bool, len(cassette.Interactions))
+
+	return nil
+}
+
+// Replaying reports whether responses come from a cassette, in which case
+// nothing is sent over the network.
+func Replaying() bool {
+	active.Lock()
+	defer active.Unlock()
+
+	return active.mode == modeReplay
+}
+
+// Stop ends recording or replaying, writing the cassette if recording.
+func Stop() error {
+	active.Lock()
+	defer active.Unlock()
+
+	current, cassette, path := active.mode, active.cassette, active.path
+	active.mode = modeOff
+	active.cassette = nil
+	active.used = nil
+
+	if current != modeRecord {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(cassette, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error marshalling cassette: %w", err)
+	}
+
+	if err := os.WriteFile(path, append(data, '\n'), filePermissions); err != nil {
+		return fmt.Errorf("error writing cassette: %w", err)
+	}
+
+	return nil
+}
+
+// Transport records or replays the requests made through base, which is
+// http.DefaultTransport if nil. It passes requests through while neither
+// Record nor Replay has been called.
+func Transport(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	return &transport{base: base}
+}
+
+type transport struct {
+	base http.RoundTripper
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	active.Lock()
+	current := active.mode
+	active.Unlock()
+
+	if current == modeOff {
+		return t.base.RoundTrip(req) //nolint:wrapcheck
+	}
+
+	var body []byte
+
+	if req.Body != nil {
+		var err error
+
+		body, err = io.ReadAll(req.Body)
+		_ = req.Body.Close()
+
+		if err != nil {
+			return nil, fmt.Errorf("error reading request body: %w", err)
+		}
+
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	recorded := Request{
+		Method: req.Method,
+		URL:    scrubURL(req.URL),
+		Header: scrubHeader(req.Header),
+		Body:   scrubBody(body),
+	}
+
+	if current == modeReplay {
+		return replay(req, &recorded)
+	}
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+
+	// the response is recorded as it is read, so that streamed responses
+	// still arrive token by token
+	resp.Body = &recordingBody{
+		ReadCloser: resp.Body,
+		interaction: &Interaction{
+			Request:  recorded,
+			Response: Response{Status: resp.StatusCode, Header: scrubHeader(resp.Header)},
+		},
+	}
+
+	return resp, nil
+}
+
+// replay finds the first interaction not replayed yet with the same method,
+// path and body as the request, or failing that the same method and path,
+// so that a cassette still serves requests whose prompts changed slightly.
+func replay(req *http.Request, recorded *Request) (*http.Response, error) {
+	active.Lock()
+	defer active.Unlock()
+
+	match := -1
+
+	for i, interaction := range active.cassette.Interactions {
+		if active.used[i] || !samePath(&interaction.Request, recorded) {
+			continue
+		}
+
+		if interaction.Request.Body == recorded.Body {
+			match = i
+			break
+		}
+
+		if match < 0 {
+			match = i
+		}
+	}
+
+	if match < 0 {
+		return nil, fmt.Errorf("no recorded response in %s for %s %s", active.path, req.Method, req.URL.Path)
+	}
+
+	active.used[match] = true
+	recordedResp := active.cassette.Interactions[match].Response
+
+	// scrubbing may have changed the length of the body
+	header := recordedResp.Header.Clone()
+	if header != nil {
+		header.Del("Content-Length")
+	}
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", recordedResp.Status, http.StatusText(recordedResp.Status)),
+		StatusCode:    recordedResp.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(strings.NewReader(recordedResp.Body)),
+		ContentLength: int64(len(recordedResp.Body)),
+		Request:       req,
+	}, nil
+}
+
+func samePath(a, b *Request) bool {
+	if a.Method != b.Method {
+		return false
+	}
+
+	aURL, errA := url.Parse(a.URL)
+	bURL, errB := url.Parse(b.URL)
+
+	return errA == nil && errB == nil && aURL.Path == bURL.Path
+}
+
+// recordingBody adds the interaction to the cassette once the response has
+// been read and closed.
+type recordingBody struct {
+	io.ReadCloser
+	interaction *Interaction
+	buf         bytes.Buffer
+	once        sync.Once
+}
+
+func (b *recordingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.buf.Write(p[:n])
+
+	return n, err //nolint:wrapcheck
+}
+
+func (b *recordingBody) Close() error {
+	b.once.Do(func() {
+		b.interaction.Response.Body = scrubBody(b.buf.Bytes())
+
+		active.Lock()
+		defer active.Unlock()
+
+		if active.mode == modeRecord {
+			active.cassette.Interactions = append(active.cassette.Interactions, b.interaction)
+		}
+	})
+
+	return b.ReadCloser.Close() //nolint:wrapcheck
+}
+
+func scrubHeader(header http.Header) http.Header {
+	scrubbedHeader := header.Clone()
+
+	for _, name := range sensitiveHeaders {
+		if scrubbedHeader.Get(name) != "" {
+			scrubbedHeader.Set(name, scrubbed)
+		}
+	}
+
+	return scrubbedHeader
+}
+
+func scrubURL(u *url.URL) string {
+	scrubbedURL := *u
+	scrubbedURL.User = nil
+
+	query := scrubbedURL.Query()
+	for _, name := range sensitiveParams {
+		if query.Has(name) {
+			query.Set(name, scrubbed)
+		}
+	}
+
+	scrubbedURL.RawQuery = query.Encode()
+
+	return scrubbedURL.String()
+}
+
+// scrubBody redacts credentials from a request or response body, such as
+// keys in the files of the context.
+func scrubBody(body []byte) string {
+	text, _ := redact.NewSecretRedactor().Redact(string(body))
+
+	return text
+}
@@ -0,0 +1,142 @@
+// Package changelog renders commits for the model to write changelog entries
+// from, and adds the entries to a CHANGELOG.md in the Keep a Changelog
+// format, newest release first.
+package changelog
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/emilkje/cwc/pkg/changes"
+)
+
+// Categories are the headings the entries are grouped under, in order.
+var Categories = []string{"Added", "Changed", "Fixed", "Removed", "Security"} //nolint:gochecknoglobals
+
+// header starts a new changelog.
+const header = "# Changelog\n\nAll notable changes to this project are documented in this file.\n\n"
+
+// Commits lists the commits, one per line with their pull request and the
+// subjects of the commits they merge, along with the first paragraph of
+// their description.
+func Commits(commits []changes.Commit) string {
+	var out strings.Builder
+
+	for i := range commits {
+		commit := &commits[i]
+
+		fmt.Fprintf(&out, "- %s", commit.Title())
+
+		if commit.PR > 0 && !strings.Contains(commit.Title(), fmt.Sprintf("#%d", commit.PR)) {
+			fmt.Fprintf(&out, " (#%d)", commit.PR)
+		}
+
+		fmt.Fprintf(&out, " [%s, %s]\n", commit.Hash[:min(len(commit.Hash), 7)], commit.Author) //nolint:gomnd
+
+		if paragraph, _, _ := strings.Cut(commit.Body, "\n\n"); paragraph != "" && paragraph != commit.Title() {
+			out.WriteString("  " + strings.ReplaceAll(paragraph, "\n", "\n  ") + "\n")
+		}
+
+		for _, subject := range commit.Merged {
+			out.WriteString("  - " + subject + "\n")
+		}
+	}
+
+	return out.String()
+}
+
+// Unreleased is the heading of the changes since the last release.
+const Unreleased = "Unreleased"
+
+// Section returns the entries of a release under its heading, such as
+// "## [0.4.0] - 2024-05-01", or "## [Unreleased]". The entries are cleaned of
+// code fences and of headings other than the categories.
+func Section(version string, date time.Time, entries string) string {
+	var out strings.Builder
+
+	if version == Unreleased {
+		out.WriteString("## [" + Unreleased + "]\n")
+	} else {
+		fmt.Fprintf(&out, "## [%s] - %s\n", strings.TrimPrefix(version, "v"), date.Format(time.DateOnly))
+	}
+
+	for _, line := range strings.Split(strings.TrimSpace(entries), "\n") {
+		trimmed := strings.TrimSpace(line)
+
+		switch {
+		case strings.HasPrefix(trimmed, "```"):
+			continue
+		case strings.HasPrefix(trimmed, "#"):
+			heading, ok := category(strings.TrimSpace(strings.TrimLeft(trimmed, "#")))
+			if !ok {
+				continue
+			}
+
+			out.WriteString("\n### " + heading + "\n\n")
+		case trimmed == "":
+		default:
+			out.WriteString(strings.TrimRight(line, " \r") + "\n")
+		}
+	}
+
+	return out.String()
+}
+
+// category returns the category a heading names, spelled as in Categories.
+func category(heading string) (string, bool) {
+	for _, category := range Categories {
+		if strings.EqualFold(heading, category) {
+			return category, true
+		}
+	}
+
+	return "", false
+}
+
+// Prepend adds the section before the releases of an existing changelog,
+// below its title and introduction, or starts a new changelog with it. New
+// unreleased entries replace the ones already there.
+func Prepend(existing, section string) string {
+	if strings.TrimSpace(existing) == "" {
+		return header + section
+	}
+
+	releases := releaseOffsets(existing)
+	if len(releases) == 0 {
+		return strings.TrimRight(existing, "\n") + "\n\n" + section
+	}
+
+	before, after := existing[:releases[0]], existing[releases[0]:]
+
+	unreleased := "## [" + Unreleased + "]"
+	if strings.HasPrefix(section, unreleased) && strings.HasPrefix(after, unreleased) {
+		after = ""
+		if len(releases) > 1 {
+			after = existing[releases[1]:]
+		}
+	}
+
+	before = strings.TrimRight(before, "\n") + "\n\n"
+	if after == "" {
+		return before + section
+	}
+
+	return before + section + "\n" + after
+}
+
+// releaseOffsets returns the offsets of the release headings.
+func releaseOffsets(text string) []int {
+	var offsets []int
+
+	for offset := 0; offset < len(text); {
+		line, _, _ := strings.Cut(text[offset:], "\n")
+		if strings.HasPrefix(line, "## ") {
+			offsets = append(offsets, offset)
+		}
+
+		offset += len(line) + 1
+	}
+
+	return offsets
+}
@@ -0,0 +1,116 @@
+package changes
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// uncommitted is the hash git blame gives lines that aren't committed yet.
+const uncommitted = "0000000000000000000000000000000000000000"
+
+// BlameLine is a line of a file with the commit that last changed it.
+type BlameLine struct {
+	Hash    string
+	Author  string
+	Time    time.Time
+	Summary string
+	// Line is the number of the line in the file, counting from 1.
+	Line int
+	Text string
+}
+
+// Committed reports whether the line is committed.
+func (l *BlameLine) Committed() bool {
+	return l.Hash != uncommitted
+}
+
+// Blame returns the lines of the file in the range, which is either start,end
+// or :funcname to blame the function whose definition matches funcname, as
+// for git blame -L.
+func Blame(path, lineRange string) ([]BlameLine, error) {
+	output, err := git("blame", "--porcelain", "-L", lineRange, "--", path)
+	if err != nil {
+		return nil, fmt.Errorf("error blaming %s: %w", path, err)
+	}
+
+	type commitInfo struct {
+		author  string
+		time    time.Time
+		summary string
+	}
+
+	commits := make(map[string]*commitInfo)
+
+	var (
+		lines   []BlameLine
+		current *BlameLine
+	)
+
+	for _, line := range strings.Split(output, "\n") {
+		if current == nil {
+			// a header line: <hash> <original line> <final line> [<lines in group>]
+			fields := strings.Fields(line)
+			if len(fields) < 3 { //nolint:gomnd
+				continue
+			}
+
+			number, _ := strconv.Atoi(fields[2])
+			current = &BlameLine{Hash: fields[0], Line: number}
+
+			if commits[current.Hash] == nil {
+				commits[current.Hash] = &commitInfo{}
+			}
+
+			continue
+		}
+
+		info := commits[current.Hash]
+
+		key, value, _ := strings.Cut(line, " ")
+
+		switch {
+		case strings.HasPrefix(line, "\t"):
+			current.Text = line[1:]
+			lines = append(lines, *current)
+			current = nil
+		case key == "author":
+			info.author = value
+		case key == "author-time":
+			seconds, _ := strconv.ParseInt(value, 10, 64)
+			info.time = time.Unix(seconds, 0)
+		case key == "summary":
+			info.summary = value
+		}
+	}
+
+	for i := range lines {
+		info := commits[lines[i].Hash]
+		lines[i].Author, lines[i].Time, lines[i].Summary = info.author, info.time, info.summary
+	}
+
+	return lines, nil
+}
+
+// CommitMessage returns the full message of the commit.
+func CommitMessage(hash string) (string, error) {
+	message, err := git("show", "--no-patch", "--format=%B", hash)
+	if err != nil {
+		return "", fmt.Errorf("error reading commit %s: %w", hash, err)
+	}
+
+	return strings.TrimSpace(message), nil
+}
+
+// LineHistory returns the latest commits that changed the range of the file,
+// each with its message and the diff of the range, as git log -L shows them.
+func LineHistory(path, lineRange string, commits int) (string, error) {
+	history, err := git("log", "--no-color", fmt.Sprintf("-%d", commits), "--format=commit %h%nAuthor: %an%nDate: %as%n%n%B",
+		"-L", lineRange+":"+path)
+	if err != nil {
+		return "", fmt.Errorf("error reading the history of %s: %w", path, err)
+	}
+
+	return history, nil
+}
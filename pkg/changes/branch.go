@@ -0,0 +1,148 @@
+package changes
+
+import (
+	stderrors "errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Branch commits edits to a branch of their own without checking it out: the
+// current branch, its index and the working tree are left as they are, so the
+// commits can be reviewed and merged like any other branch.
+type Branch struct {
+	Name string
+	// Base is the commit the branch starts from and Tip its latest commit.
+	Base string
+	Tip  string
+}
+
+// NewBranch prepares a branch starting at HEAD, named name or, if that is
+// taken, name with a number appended. The branch is created by the first
+// commit.
+func NewBranch(name string) (*Branch, error) {
+	head, err := git("rev-parse", "--verify", "--quiet", "HEAD^{commit}")
+	if err != nil {
+		return nil, stderrors.New("committing to a branch requires a git repository with at least one commit")
+	}
+
+	b := &Branch{Base: strings.TrimSpace(head)}
+	b.Tip = b.Base
+
+	for i := 1; ; i++ {
+		b.Name = name
+		if i > 1 {
+			b.Name = fmt.Sprintf("%s-%d", name, i)
+		}
+
+		if _, err := git("check-ref-format", "--branch", b.Name); err != nil {
+			return nil, fmt.Errorf("invalid branch name %q: %w", b.Name, err)
+		}
+
+		if _, err := git("rev-parse", "--verify", "--quiet", "refs/heads/"+b.Name); err != nil {
+			return b, nil
+		}
+	}
+}
+
+// Stage returns the tree of the tip with the files at the paths as they are
+// in the working tree, those that no longer exist removed, and the diff of the
+// tree against the tip.
+func (b *Branch) Stage(paths []string) (string, string, error) {
+	dir, err := os.MkdirTemp("", "cwc-index-")
+	if err != nil {
+		return "", "", fmt.Errorf("error creating temporary index: %w", err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	env := []string{"GIT_INDEX_FILE=" + filepath.Join(dir, "index")}
+
+	if _, err := gitWithEnv(env, nil, "read-tree", b.Tip); err != nil {
+		return "", "", fmt.Errorf("error reading the tree of %s: %w", b.Name, err)
+	}
+
+	args := append([]string{"update-index", "--add", "--remove", "--"}, paths...)
+	if _, err := gitWithEnv(env, nil, args...); err != nil {
+		return "", "", fmt.Errorf("error staging the changes: %w", err)
+	}
+
+	tree, err := gitWithEnv(env, nil, "write-tree")
+	if err != nil {
+		return "", "", fmt.Errorf("error writing the tree: %w", err)
+	}
+
+	tree = strings.TrimSpace(tree)
+
+	diff, err := git("diff", "--no-color", "--no-ext-diff", b.Tip, tree)
+	if err != nil {
+		return "", "", fmt.Errorf("error reading the changes: %w", err)
+	}
+
+	return tree, diff, nil
+}
+
+// Commit adds a commit of the tree, as returned by Stage, to the branch. An
+// empty tree commits the tree of the tip again, for a commit that changes
+// nothing such as a summary.
+func (b *Branch) Commit(tree, message string) error {
+	if tree == "" {
+		tree = b.Tip + "^{tree}"
+	}
+
+	commit, err := gitWithInput(strings.NewReader(message), "commit-tree", tree, "-p", b.Tip, "-F", "-")
+	if err != nil {
+		return fmt.Errorf("error committing to %s: %w", b.Name, err)
+	}
+
+	commit = strings.TrimSpace(commit)
+
+	// the old value guards against the branch having moved meanwhile, an
+	// empty one against it having been created
+	old := b.Tip
+	if old == b.Base {
+		old = ""
+	}
+
+	if _, err := git("update-ref", "-m", "cwc: commit", "refs/heads/"+b.Name, commit, old); err != nil {
+		return fmt.Errorf("error updating %s: %w", b.Name, err)
+	}
+
+	b.Tip = commit
+
+	return nil
+}
+
+// Committed reports whether the branch has commits of its own.
+func (b *Branch) Committed() bool {
+	return b.Tip != b.Base
+}
+
+// Subjects returns the subjects of the commits on the branch, oldest first.
+func (b *Branch) Subjects() ([]string, error) {
+	output, err := git("log", "--reverse", "--format=%s", b.Base+".."+b.Tip)
+	if err != nil {
+		return nil, fmt.Errorf("error reading the commits of %s: %w", b.Name, err)
+	}
+
+	var subjects []string
+
+	for _, subject := range strings.Split(output, "\n") {
+		if subject = strings.TrimSpace(subject); subject != "" {
+			subjects = append(subjects, subject)
+		}
+	}
+
+	return subjects, nil
+}
+
+// Diff returns the diff of all the commits on the branch.
+func (b *Branch) Diff() (string, error) {
+	diff, err := git("diff", "--no-color", "--no-ext-diff", b.Base, b.Tip)
+	if err != nil {
+		return "", fmt.Errorf("error reading the changes of %s: %w", b.Name, err)
+	}
+
+	return diff, nil
+}
@@ -0,0 +1,164 @@
+// Package changes finds the files changed since a git ref or date, and the
+// files they directly depend on, for reviewing everything since a release.
+// It also reads the commits between two refs, for writing changelogs, and
+// the staged changes, for writing commit messages, and commits edits to a
+// branch of their own.
+package changes
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// gitTimeout bounds each git command.
+const gitTimeout = 30 * time.Second
+
+// emptyTree is the hash of git's empty tree, which every file is changed
+// against.
+const emptyTree = "4b825dc642cb6eb9a060e54bf8d69288fbee4904"
+
+// Since returns the files below the working directory that were added or
+// changed since since, which is a ref such as a tag or a branch, or a date
+// such as 2024-05-01. Uncommitted changes and untracked files count as
+// changed too; deleted files are left out. The paths are relative to the
+// working directory.
+func Since(since string) ([]string, error) {
+	base, err := resolveBase(since)
+	if err != nil {
+		return nil, err
+	}
+
+	changed, err := git("diff", "--name-only", "--relative", "--diff-filter=d", "-z", base, "--")
+	if err != nil {
+		return nil, fmt.Errorf("error listing changed files: %w", err)
+	}
+
+	untracked, err := git("ls-files", "--others", "--exclude-standard", "-z")
+	if err != nil {
+		return nil, fmt.Errorf("error listing untracked files: %w", err)
+	}
+
+	var paths []string
+
+	seen := make(map[string]bool)
+
+	for _, path := range append(splitNul(changed), splitNul(untracked)...) {
+		path = filepath.Clean(filepath.FromSlash(path))
+		if !seen[path] {
+			seen[path] = true
+			paths = append(paths, path)
+		}
+	}
+
+	return paths, nil
+}
+
+// Files returns the files below the working directory that git tracks or
+// would track, leaving out ignored files. The paths are relative to the
+// working directory.
+func Files() ([]string, error) {
+	out, err := git("ls-files", "--cached", "--others", "--exclude-standard", "-z")
+	if err != nil {
+		return nil, fmt.Errorf("error listing files: %w", err)
+	}
+
+	paths := splitNul(out)
+	for i, path := range paths {
+		paths[i] = filepath.Clean(filepath.FromSlash(path))
+	}
+
+	return paths, nil
+}
+
+// resolveBase returns the commit to compare with. A date resolves to the
+// last commit before it, or to the empty tree if the history starts later.
+func resolveBase(since string) (string, error) {
+	if _, err := git("rev-parse", "--is-inside-work-tree"); err != nil {
+		return "", fmt.Errorf("--changed-since requires a git repository: %w", err)
+	}
+
+	if date, ok := parseDate(since); ok {
+		commit, err := git("rev-list", "-1", "--before="+date.Format(time.RFC3339), "HEAD")
+		if err != nil {
+			return "", fmt.Errorf("error finding the last commit before %s: %w", since, err)
+		}
+
+		if commit = strings.TrimSpace(commit); commit == "" {
+			return emptyTree, nil
+		}
+
+		return commit, nil
+	}
+
+	commit, err := git("rev-parse", "--verify", "--quiet", since+"^{commit}")
+	if err != nil {
+		return "", fmt.Errorf("unknown ref or date %q, use a tag, a branch, a commit or a date like 2024-05-01", since)
+	}
+
+	return strings.TrimSpace(commit), nil
+}
+
+func parseDate(value string) (time.Time, bool) {
+	for _, layout := range []string{time.DateOnly, time.RFC3339, "2006-01-02 15:04", "2006-01-02T15:04"} {
+		if date, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return date, true
+		}
+	}
+
+	return time.Time{}, false
+}
+
+func git(args ...string) (string, error) {
+	return gitWithInput(nil, args...)
+}
+
+func gitWithInput(stdin io.Reader, args ...string) (string, error) {
+	return gitWithEnv(nil, stdin, args...)
+}
+
+// gitWithEnv runs git with the variables in env added to the environment,
+// such as GIT_INDEX_FILE.
+func gitWithEnv(env []string, stdin io.Reader, args ...string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), gitTimeout)
+	defer cancel()
+
+	var stderr bytes.Buffer
+
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Stdin = stdin
+	cmd.Stderr = &stderr
+
+	if len(env) > 0 {
+		cmd.Env = append(os.Environ(), env...)
+	}
+
+	output, err := cmd.Output()
+	if err != nil {
+		if message := strings.TrimSpace(stderr.String()); message != "" {
+			return "", fmt.Errorf("%w: %s", err, message)
+		}
+
+		return "", err //nolint:wrapcheck
+	}
+
+	return string(output), nil
+}
+
+func splitNul(output string) []string {
+	var paths []string
+
+	for _, path := range strings.Split(output, "\x00") {
+		if path != "" {
+			paths = append(paths, path)
+		}
+	}
+
+	return paths
+}
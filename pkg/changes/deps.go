@@ -0,0 +1,264 @@
+package changes
+
+import (
+	"bufio"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var (
+	jsImportRegexp = regexp.MustCompile( //nolint:gochecknoglobals
+		`(?:\bfrom|\bimport|\brequire\s*\(|\bimport\s*\()\s*['"](\.{1,2}/[^'"]+)['"]`)
+	pyFromImportRegexp = regexp.MustCompile(`^\s*from\s+([.\w]+)\s+import\s+\(?([\w\s,*]+)`) //nolint:gochecknoglobals
+	pyImportRegexp     = regexp.MustCompile(`^\s*import\s+([\w.]+(?:\s*,\s*[\w.]+)*)`)       //nolint:gochecknoglobals
+)
+
+// jsExtensions are tried in order when a relative import leaves out the
+// extension.
+var jsExtensions = []string{".ts", ".tsx", ".js", ".jsx", ".mjs", ".cjs", ".d.ts"} //nolint:gochecknoglobals
+
+// Dependencies returns the files that the given files import directly and
+// that aren't among them. Go imports are resolved to the packages of the
+// module in go.mod, relative imports in JavaScript and TypeScript to files
+// with the usual extensions or index files, and Python imports to modules
+// below the working directory. The paths are relative to the working
+// directory, and imports of other modules and packages are ignored.
+func Dependencies(paths []string) []string {
+	cwd, _ := os.Getwd()
+	r := &resolver{cwd: cwd, modules: make(map[string]goModule), found: make(map[string]bool)}
+
+	given := make(map[string]bool, len(paths))
+	for _, path := range paths {
+		given[filepath.Clean(path)] = true
+	}
+
+	for _, path := range paths {
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".go":
+			r.goImports(path)
+		case ".js", ".jsx", ".ts", ".tsx", ".mjs", ".cjs", ".vue", ".svelte":
+			r.jsImports(path)
+		case ".py":
+			r.pyImports(path)
+		}
+	}
+
+	var deps []string
+
+	for path := range r.found {
+		if !given[path] {
+			deps = append(deps, path)
+		}
+	}
+
+	sort.Strings(deps)
+
+	return deps
+}
+
+type goModule struct {
+	dir  string
+	path string
+}
+
+type resolver struct {
+	cwd string
+	// modules caches the module of each absolute directory
+	modules map[string]goModule
+	found   map[string]bool
+}
+
+func (r *resolver) add(path string) {
+	if filepath.IsAbs(path) {
+		rel, err := filepath.Rel(r.cwd, path)
+		if err != nil {
+			return
+		}
+
+		path = rel
+	}
+
+	r.found[filepath.Clean(path)] = true
+}
+
+func (r *resolver) goImports(path string) {
+	file, err := parser.ParseFile(token.NewFileSet(), path, nil, parser.ImportsOnly)
+	if err != nil {
+		return
+	}
+
+	dir, err := filepath.Abs(filepath.Dir(path))
+	if err != nil {
+		return
+	}
+
+	module := r.goModule(dir)
+	if module.path == "" {
+		return
+	}
+
+	for _, spec := range file.Imports {
+		importPath, err := strconv.Unquote(spec.Path.Value)
+		if err != nil {
+			continue
+		}
+
+		var dir string
+
+		switch {
+		case importPath == module.path:
+			dir = module.dir
+		case strings.HasPrefix(importPath, module.path+"/"):
+			dir = filepath.Join(module.dir, filepath.FromSlash(strings.TrimPrefix(importPath, module.path+"/")))
+		default:
+			continue
+		}
+
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+
+		for _, entry := range entries {
+			name := entry.Name()
+			if !entry.IsDir() && strings.HasSuffix(name, ".go") && !strings.HasSuffix(name, "_test.go") {
+				r.add(filepath.Join(dir, name))
+			}
+		}
+	}
+}
+
+// goModule finds the go.mod that the absolute dir belongs to and reads its
+// module path.
+func (r *resolver) goModule(dir string) goModule {
+	if module, ok := r.modules[dir]; ok {
+		return module
+	}
+
+	var module goModule
+
+	if data, err := os.ReadFile(filepath.Join(dir, "go.mod")); err == nil { // #nosec
+		module = goModule{dir: dir, path: modulePath(string(data))}
+	} else if parent := filepath.Dir(dir); parent != dir {
+		module = r.goModule(parent)
+	}
+
+	r.modules[dir] = module
+
+	return module
+}
+
+func modulePath(goMod string) string {
+	for _, line := range strings.Split(goMod, "\n") {
+		if fields := strings.Fields(line); len(fields) >= 2 && fields[0] == "module" {
+			return strings.Trim(fields[1], `"`)
+		}
+	}
+
+	return ""
+}
+
+func (r *resolver) jsImports(path string) {
+	data, err := os.ReadFile(path) // #nosec
+	if err != nil {
+		return
+	}
+
+	dir := filepath.Dir(path)
+
+	for _, match := range jsImportRegexp.FindAllStringSubmatch(string(data), -1) {
+		target := filepath.Join(dir, filepath.FromSlash(match[1]))
+
+		candidates := []string{target}
+		for _, ext := range jsExtensions {
+			candidates = append(candidates, target+ext)
+		}
+
+		for _, ext := range jsExtensions {
+			candidates = append(candidates, filepath.Join(target, "index"+ext))
+		}
+
+		if file, ok := firstFile(candidates); ok {
+			r.add(file)
+		}
+	}
+}
+
+func (r *resolver) pyImports(path string) {
+	file, err := os.Open(path) // #nosec
+	if err != nil {
+		return
+	}
+
+	defer file.Close()
+
+	dir := filepath.Dir(path)
+	scanner := bufio.NewScanner(file)
+
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		if match := pyFromImportRegexp.FindStringSubmatch(line); match != nil {
+			module := match[1]
+			base := "."
+
+			if dots := len(module) - len(strings.TrimLeft(module, ".")); dots > 0 {
+				base = dir
+				for i := 1; i < dots; i++ {
+					base = filepath.Dir(base)
+				}
+
+				module = module[dots:]
+			}
+
+			r.pyModule(base, module)
+
+			// from package import module
+			for _, name := range strings.Split(match[2], ",") {
+				if fields := strings.Fields(name); len(fields) > 0 && fields[0] != "*" {
+					r.pyModule(base, strings.Trim(module+"."+fields[0], "."))
+				}
+			}
+
+			continue
+		}
+
+		if match := pyImportRegexp.FindStringSubmatch(line); match != nil {
+			for _, module := range strings.Split(match[1], ",") {
+				// scripts import the modules next to them too
+				r.pyModule(".", strings.TrimSpace(module))
+				r.pyModule(dir, strings.TrimSpace(module))
+			}
+		}
+	}
+}
+
+// pyModule adds the file of the dotted module name below base, if there is
+// one.
+func (r *resolver) pyModule(base, module string) {
+	if module == "" {
+		return
+	}
+
+	target := filepath.Join(base, filepath.FromSlash(strings.ReplaceAll(module, ".", "/")))
+
+	if file, ok := firstFile([]string{target + ".py", filepath.Join(target, "__init__.py")}); ok {
+		r.add(file)
+	}
+}
+
+func firstFile(candidates []string) (string, bool) {
+	for _, candidate := range candidates {
+		if info, err := os.Stat(candidate); err == nil && info.Mode().IsRegular() {
+			return candidate, true
+		}
+	}
+
+	return "", false
+}
@@ -0,0 +1,205 @@
+package changes
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxMergedSubjects bounds the subjects listed for the commits of a merged
+// pull request.
+const maxMergedSubjects = 20
+
+// logFields are the fields of each commit in the log format: the hash, the
+// parents, the author, the subject and the body.
+const logFields = 5
+
+var (
+	// mergeRegexp matches the subject GitHub gives merge commits.
+	mergeRegexp = regexp.MustCompile(`^Merge pull request #(\d+)`) //nolint:gochecknoglobals
+	// squashRegexp matches the pull request number GitHub appends to the
+	// subject of squashed pull requests.
+	squashRegexp = regexp.MustCompile(`\(#(\d+)\)\s*$`) //nolint:gochecknoglobals
+)
+
+// ErrNoTag is returned when the history has no tag to start a changelog from.
+var ErrNoTag = errors.New("no tag found")
+
+// Commit is a commit of the first-parent history, which stands for a whole
+// pull request when it merges or squashes one.
+type Commit struct {
+	Hash    string
+	Subject string
+	Body    string
+	Author  string
+	// PR is the number of the pull request, or zero.
+	PR int
+	// Merged are the subjects of the commits a merge commit brings in.
+	Merged []string
+}
+
+// Title is the subject of the commit, or of the pull request for merge
+// commits, whose subject only names the branch.
+func (c *Commit) Title() string {
+	if mergeRegexp.MatchString(c.Subject) {
+		if title, _, _ := strings.Cut(strings.TrimSpace(c.Body), "\n"); title != "" {
+			return title
+		}
+	}
+
+	return c.Subject
+}
+
+// Log returns the commits reachable from to but not from from, newest
+// first, following only the first parent so that each merged pull request is
+// a single commit.
+func Log(from, to string) ([]Commit, error) {
+	for _, ref := range []string{from, to} {
+		if _, err := git("rev-parse", "--verify", "--quiet", ref+"^{commit}"); err != nil {
+			return nil, fmt.Errorf("unknown ref %q", ref)
+		}
+	}
+
+	output, err := git("log", "--first-parent", "--format=%H%x00%P%x00%an%x00%s%x00%b%x1e", from+".."+to)
+	if err != nil {
+		return nil, fmt.Errorf("error reading the history: %w", err)
+	}
+
+	var commits []Commit
+
+	for _, record := range strings.Split(output, "\x1e") {
+		fields := strings.SplitN(strings.TrimLeft(record, "\n"), "\x00", logFields)
+		if len(fields) < logFields {
+			continue
+		}
+
+		commit := Commit{Hash: fields[0], Author: fields[2], Subject: fields[3], Body: strings.TrimSpace(fields[4])}
+
+		if match := mergeRegexp.FindStringSubmatch(commit.Subject); match != nil {
+			commit.PR, _ = strconv.Atoi(match[1])
+		} else if match := squashRegexp.FindStringSubmatch(commit.Subject); match != nil {
+			commit.PR, _ = strconv.Atoi(match[1])
+		}
+
+		if parents := strings.Fields(fields[1]); len(parents) > 1 {
+			commit.Merged = mergedSubjects(parents[0], parents[1])
+		}
+
+		commits = append(commits, commit)
+	}
+
+	return commits, nil
+}
+
+func mergedSubjects(base, head string) []string {
+	output, err := git("log", "--format=%s", fmt.Sprintf("-%d", maxMergedSubjects), base+".."+head)
+	if err != nil {
+		return nil
+	}
+
+	var subjects []string
+
+	for _, subject := range strings.Split(output, "\n") {
+		if subject = strings.TrimSpace(subject); subject != "" {
+			subjects = append(subjects, subject)
+		}
+	}
+
+	return subjects
+}
+
+// LatestTag returns the most recent tag reachable from the parent of ref, so
+// that the changelog of a tagged release starts at the release before it.
+func LatestTag(ref string) (string, error) {
+	tag, err := git("describe", "--tags", "--abbrev=0", ref+"^")
+	if err != nil {
+		return "", ErrNoTag
+	}
+
+	return strings.TrimSpace(tag), nil
+}
+
+// TagAt returns the tag pointing at ref, or an empty string if there is none.
+func TagAt(ref string) string {
+	tag, err := git("describe", "--tags", "--exact-match", ref)
+	if err != nil {
+		return ""
+	}
+
+	return strings.TrimSpace(tag)
+}
+
+// CommitDate returns the date ref was committed.
+func CommitDate(ref string) (time.Time, error) {
+	output, err := git("log", "-1", "--format=%cI", ref)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("error reading the date of %s: %w", ref, err)
+	}
+
+	date, err := time.Parse(time.RFC3339, strings.TrimSpace(output))
+	if err != nil {
+		return time.Time{}, fmt.Errorf("error parsing the date of %s: %w", ref, err)
+	}
+
+	return date, nil
+}
+
+// FilesAt returns the contents of the files at ref whose paths, relative to
+// the root of the repository, match.
+func FilesAt(ref string, match func(path string) bool) (map[string][]byte, error) {
+	listing, err := git("ls-tree", "-r", "-z", "--full-tree", "--name-only", ref)
+	if err != nil {
+		return nil, fmt.Errorf("error listing the files at %s: %w", ref, err)
+	}
+
+	var (
+		paths []string
+		input strings.Builder
+	)
+
+	for _, path := range splitNul(listing) {
+		if match(path) {
+			paths = append(paths, path)
+			fmt.Fprintf(&input, "%s:%s\n", ref, path)
+		}
+	}
+
+	if len(paths) == 0 {
+		return map[string][]byte{}, nil
+	}
+
+	output, err := gitWithInput(strings.NewReader(input.String()), "cat-file", "--batch")
+	if err != nil {
+		return nil, fmt.Errorf("error reading the files at %s: %w", ref, err)
+	}
+
+	files := make(map[string][]byte, len(paths))
+
+	// each object is "<hash> <type> <size>\n<contents>\n"
+	for _, path := range paths {
+		header, rest, ok := strings.Cut(output, "\n")
+		if !ok {
+			break
+		}
+
+		fields := strings.Fields(header)
+		if len(fields) != 3 { //nolint:gomnd
+			// the object is missing, like a submodule
+			output = rest
+			continue
+		}
+
+		size, err := strconv.Atoi(fields[2])
+		if err != nil || size > len(rest) {
+			return nil, fmt.Errorf("error reading %s at %s: unexpected output of git cat-file", path, ref)
+		}
+
+		files[path] = []byte(rest[:size])
+		output = strings.TrimPrefix(rest[size:], "\n")
+	}
+
+	return files, nil
+}
@@ -0,0 +1,114 @@
+package changes
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// Staged returns the paths of the staged files, relative to the root of the
+// repository, deleted files included.
+func Staged() ([]string, error) {
+	output, err := git("diff", "--cached", "--name-only", "-z")
+	if err != nil {
+		return nil, fmt.Errorf("error listing staged files: %w", err)
+	}
+
+	return splitNul(output), nil
+}
+
+// StagedDiff returns the diff of the staged changes.
+func StagedDiff() (string, error) {
+	diff, err := git("diff", "--cached", "--no-color", "--no-ext-diff")
+	if err != nil {
+		return "", fmt.Errorf("error reading the staged changes: %w", err)
+	}
+
+	return diff, nil
+}
+
+// StagedPatch returns the staged changes as a patch that git apply takes
+// back, binary files included.
+func StagedPatch() (string, error) {
+	patch, err := git("diff", "--cached", "--binary", "--full-index", "--no-color", "--no-ext-diff")
+	if err != nil {
+		return "", fmt.Errorf("error reading the staged changes: %w", err)
+	}
+
+	return patch, nil
+}
+
+// Unstage empties the index of changes, leaving the working tree as it is.
+func Unstage() error {
+	if _, err := git("reset", "--quiet"); err != nil {
+		return fmt.Errorf("error unstaging the changes: %w", err)
+	}
+
+	return nil
+}
+
+// Stage applies the patch to the index, leaving the working tree as it is.
+// The paths of the patch are relative to the root of the repository.
+func Stage(patch string) error {
+	// git apply ignores the paths outside the directory it runs in
+	root, err := git("rev-parse", "--show-toplevel")
+	if err != nil {
+		return fmt.Errorf("error finding the root of the repository: %w", err)
+	}
+
+	args := []string{"-C", strings.TrimSpace(root), "apply", "--cached", "--whitespace=nowarn", "-"}
+	if _, err := gitWithInput(strings.NewReader(patch), args...); err != nil {
+		return fmt.Errorf("error staging the changes: %w", err)
+	}
+
+	return nil
+}
+
+// Subjects returns the subjects of the latest n commits that aren't merges,
+// newest first, or none in a repository without commits.
+func Subjects(n int) []string {
+	output, err := git("log", "--no-merges", "--format=%s", fmt.Sprintf("-%d", n))
+	if err != nil {
+		return nil
+	}
+
+	var subjects []string
+
+	for _, subject := range strings.Split(output, "\n") {
+		if subject = strings.TrimSpace(subject); subject != "" {
+			subjects = append(subjects, subject)
+		}
+	}
+
+	return subjects
+}
+
+// CommitStaged commits the staged changes with the message. The commit hooks
+// of the repository run as usual, with git's output going to the terminal.
+func CommitStaged(message string) error {
+	cmd := exec.CommandContext(context.Background(), "git", "commit", "--file", "-")
+	cmd.Stdin = strings.NewReader(message)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("error committing: %w", err)
+	}
+
+	return nil
+}
+
+// HooksDir returns the directory git runs hooks from, honoring
+// core.hooksPath. The path is relative to the working directory unless
+// configured otherwise.
+func HooksDir() (string, error) {
+	out, err := git("rev-parse", "--git-path", "hooks")
+	if err != nil {
+		return "", fmt.Errorf("error finding the hooks directory: %w", err)
+	}
+
+	return filepath.Clean(strings.TrimSpace(out)), nil
+}
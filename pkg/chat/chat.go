@@ -1,3 +1,6 @@
+// Package chat is the engine behind cwc, usable from other Go programs: a
+// ContextBuilder renders files into a system message and a Session streams
+// the responses to the messages sent to it as events.
 package chat
 
 import (
@@ -5,33 +8,54 @@ import (
 	stderrors "errors"
 	"fmt"
 	"io"
+	"log/slog"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/sashabaranov/go-openai"
+
+	"github.com/emilkje/cwc/pkg/errors"
+	"github.com/emilkje/cwc/pkg/metrics"
+	"github.com/emilkje/cwc/pkg/perf"
+	"github.com/emilkje/cwc/pkg/providers"
 )
 
 type Chat struct {
-	client        *openai.Client
+	provider      providers.Provider
 	systemMessage string
 	chunkHandler  MessageChunkHandler
+	params        Parameters
+	trimmer       ContextTrimmer
+	tools         []Tool
+	prefill       string
 }
 
 type MessageChunkHandler func(chunk *ConversationChunk)
 
-func NewChat(client *openai.Client, systemMessage string, onChunk MessageChunkHandler) *Chat {
+func NewChat(provider providers.Provider, systemMessage string, onChunk MessageChunkHandler) *Chat {
 	return &Chat{
-		client:        client,
+		provider:      provider,
 		systemMessage: systemMessage,
 		chunkHandler:  onChunk,
 	}
 }
 
+// SetParameters pins the sampling parameters of the conversations begun
+// after the call.
+func (c *Chat) SetParameters(params Parameters) {
+	c.params = params
+}
+
 func (c *Chat) BeginConversation(initialMessage string) *Conversation {
 	conversation := &Conversation{
-		client:  c.client,
-		wg:      sync.WaitGroup{},
-		onChunk: c.chunkHandler,
+		provider: c.provider,
+		params:   c.params,
+		trimmer:  c.trimmer,
+		tools:    c.tools,
+		prefill:  c.prefill,
+		wg:       sync.WaitGroup{},
+		onChunk:  c.chunkHandler,
 		messages: []openai.ChatCompletionMessage{
 			{
 				Role:    openai.ChatMessageRoleSystem,
@@ -45,11 +69,92 @@ func (c *Chat) BeginConversation(initialMessage string) *Conversation {
 	return conversation
 }
 
+// Request returns the request that beginning a conversation with the message
+// would send, without sending it, e.g. to inspect how a prompt is built.
+func (c *Chat) Request(initialMessage string) openai.ChatCompletionRequest {
+	conversation := &Conversation{
+		provider: c.provider,
+		params:   c.params,
+		tools:    c.tools,
+		prefill:  c.prefill,
+		messages: []openai.ChatCompletionMessage{
+			{
+				Role:    openai.ChatMessageRoleSystem,
+				Content: c.systemMessage,
+			},
+		},
+	}
+
+	conversation.addMessage(openai.ChatMessageRoleUser, initialMessage)
+
+	return conversation.newRequest(true)
+}
+
 type Conversation struct {
-	client   *openai.Client
+	provider providers.Provider
+	params   Parameters
 	messages []openai.ChatCompletionMessage
 	wg       sync.WaitGroup
 	onChunk  func(chunk *ConversationChunk)
+	// answered and contextChanged tell what changed since the last response,
+	// to point at the likely cause when the content filter blocks a prompt.
+	answered       bool
+	contextChanged bool
+	trimmer        ContextTrimmer
+	tools          []Tool
+	// prefill begins every response, see Chat.SetPrefill.
+	prefill string
+	// summary lists the questions of the turns left out to fit the context
+	// window, summarized is their number.
+	summary    []string
+	summarized int
+	// cancel stops the response being generated, if any.
+	cancel   context.CancelFunc
+	cancelMu sync.Mutex
+}
+
+// SetSystemMessage replaces the system message of the conversation, e.g.
+// when the context changes between turns.
+func (c *Conversation) SetSystemMessage(message string) {
+	if len(c.messages) > 0 && c.messages[0].Role == openai.ChatMessageRoleSystem {
+		c.contextChanged = c.contextChanged || c.messages[0].Content != message
+		c.messages[0].Content = message
+
+		return
+	}
+
+	c.contextChanged = true
+
+	c.messages = append([]openai.ChatCompletionMessage{{
+		Role:    openai.ChatMessageRoleSystem,
+		Content: message,
+	}}, c.messages...)
+}
+
+// SystemMessage returns the current system message of the conversation.
+func (c *Conversation) SystemMessage() string {
+	if len(c.messages) > 0 && c.messages[0].Role == openai.ChatMessageRoleSystem {
+		return c.messages[0].Content
+	}
+
+	return ""
+}
+
+// Parameters returns the sampling parameters pinned for the conversation.
+func (c *Conversation) Parameters() Parameters {
+	return c.params
+}
+
+// LastReply returns the content of the latest response, or "" if there is
+// none yet.
+func (c *Conversation) LastReply() string {
+	for i := len(c.messages) - 1; i >= 0; i-- {
+		if c.messages[i].Role == openai.ChatMessageRoleAssistant {
+			return c.messages[i].Content
+		}
+	}
+
+	return ""
 }
 
 func (c *Conversation) addMessage(role string, message string) {
@@ -65,12 +170,34 @@ type ConversationChunk struct {
 	IsInitialChunk bool
 	IsFinalChunk   bool
 	IsErrorChunk   bool
+	// Stats is set on the final chunk of a successful response.
+	Stats *TurnStats
+	// LogProbs is set on the final chunk of a successful response when they
+	// were asked for with Parameters.LogProbs.
+	LogProbs []openai.LogProb
+	// Err is the error behind an error chunk, typically one of the typed
+	// errors in pkg/errors.
+	Err error
+	// Notice is set on chunks that carry no content but tell the user about
+	// something done on their behalf, such as shrinking the context.
+	Notice string
 }
 
 func (c *Conversation) OnMessageChunk(onChunk func(chunk *ConversationChunk)) {
 	c.onChunk = onChunk
 }
 
+// Cancel stops the response being generated. The response ends with an
+// error chunk whose Err is context.Canceled.
+func (c *Conversation) Cancel() {
+	c.cancelMu.Lock()
+	defer c.cancelMu.Unlock()
+
+	if c.cancel != nil {
+		c.cancel()
+	}
+}
+
 func (c *Conversation) WaitMyTurn() {
 	c.wg.Wait()
 }
@@ -80,15 +207,34 @@ func (c *Conversation) Reply(message string) {
 
 	c.addMessage(openai.ChatMessageRoleUser, message)
 
+	ctx, cancel := context.WithCancel(context.Background())
+
+	c.cancelMu.Lock()
+	c.cancel = cancel
+	c.cancelMu.Unlock()
+
 	go func() {
-		err := c.processMessages(context.Background())
+		defer cancel()
+
+		err := c.processWithRecovery(ctx)
 		if err != nil {
+			content := "Sorry, I'm having trouble processing your request: " + err.Error()
+			if errors.IsContentFilterError(err) {
+				content = "Sorry, " + err.Error()
+			}
+
+			if stderrors.Is(ctx.Err(), context.Canceled) {
+				content = "The response was cancelled."
+				err = context.Canceled
+			}
+
 			c.onChunk(&ConversationChunk{
 				Role:           openai.ChatMessageRoleAssistant,
-				Content:        "Sorry, I'm having trouble processing your request: " + err.Error(),
+				Content:        content,
 				IsInitialChunk: false,
 				IsFinalChunk:   true,
 				IsErrorChunk:   true,
+				Err:            err,
 			})
 		}
 
@@ -96,21 +242,73 @@ func (c *Conversation) Reply(message string) {
 	}()
 }
 
-func (c *Conversation) processMessages(ctx context.Context) error {
+// newRequest builds the request for the messages so far with the parameters,
+// tools and prefill of the conversation, leaving out what the provider
+// doesn't support.
+func (c *Conversation) newRequest(allowTools bool) openai.ChatCompletionRequest {
 	req := openai.ChatCompletionRequest{
 		Model:    openai.GPT4TurboPreview,
 		Messages: c.messages,
 		Stream:   true,
 	}
 
-	stream, err := c.client.CreateChatCompletionStream(ctx, req)
+	capabilities := c.provider.Capabilities()
+
+	if allowTools && len(c.tools) > 0 && capabilities.Tools {
+		req.Tools = c.toolDefinitions()
+	}
+
+	c.params.apply(&req)
+
+	if !capabilities.Seed {
+		req.Seed = nil
+	}
+
+	if !capabilities.LogProbs {
+		req.LogProbs = false
+		req.TopLogProbs = 0
+	}
+
+	c.primeRequest(&req, capabilities.Prefill)
+
+	return req
+}
+
+// processMessages streams the response to the messages. If the model asks
+// for tools to be called instead of answering, the calls are returned and no
+// final chunk is sent.
+func (c *Conversation) processMessages(ctx context.Context, allowTools bool) ([]openai.ToolCall, error) { //nolint:cyclop,funlen
+	req := c.newRequest(allowTools)
+	prefill := newPrefillWriter(c.prefill, c.provider.Capabilities().Prefill)
+
+	started := time.Now()
+
+	stream, err := c.provider.CreateChatStream(ctx, req)
 	if err != nil {
-		return fmt.Errorf("error creating chat completion stream: %w", err)
+		if filterErr := c.contentFilterError(err); filterErr != nil {
+			return nil, filterErr
+		}
+
+		return nil, ClassifyError(fmt.Errorf("error creating chat completion stream: %w", err), req.Model)
 	}
 
 	defer stream.Close()
 
-	var reply strings.Builder
+	perf.Record("open-stream", time.Since(started))
+	slog.Debug("opened chat stream", "model", req.Model, "messages", len(req.Messages),
+		"duration", time.Since(started))
+
+	model := req.Model
+
+	var (
+		firstTokenAt time.Time
+		fingerprint  string
+	)
+
+	var (
+		reply strings.Builder
+		calls []openai.ToolCall
+	)
 
 	c.onChunk(&ConversationChunk{
 		Role:           openai.ChatMessageRoleAssistant,
@@ -124,40 +322,102 @@ answer:
 	for {
 		response, err := stream.Recv()
 		if stderrors.Is(err, io.EOF) {
+			if !firstTokenAt.IsZero() {
+				perf.Record("stream", time.Since(firstTokenAt))
+			}
+
+			if len(calls) > 0 {
+				break answer
+			}
+
+			if rest := prefill.flush(); rest != "" {
+				reply.WriteString(rest)
+				c.onChunk(&ConversationChunk{Role: openai.ChatMessageRoleAssistant, Content: rest})
+			}
+
+			var logProbs []openai.LogProb
+			if s, ok := stream.(providers.LogProbsStream); ok {
+				logProbs = s.LogProbs()
+			}
+
+			// streamed responses carry no usage, so the token counts are estimated
+			stats := &TurnStats{
+				Model:             model,
+				PromptTokens:      c.estimatePromptTokens(),
+				CompletionTokens:  EstimateTokens(reply.String()),
+				Estimated:         true,
+				Latency:           time.Since(started),
+				Turns:             1,
+				SystemFingerprint: fingerprint,
+			}
+
+			metrics.Tokens.Add(float64(stats.PromptTokens), "prompt")
+			metrics.Tokens.Add(float64(stats.CompletionTokens), "completion")
+
 			c.onChunk(&ConversationChunk{
 				Role:           openai.ChatMessageRoleAssistant,
 				Content:        "",
 				IsInitialChunk: false,
 				IsFinalChunk:   true,
 				IsErrorChunk:   false,
+				Stats:          stats,
+				LogProbs:       logProbs,
 			})
 
 			break answer
 		}
 
 		if err != nil {
-			return fmt.Errorf("error receiving chat completion response: %w", err)
+			if filterErr := c.contentFilterError(err); filterErr != nil {
+				return nil, filterErr
+			}
+
+			return nil, ClassifyError(fmt.Errorf("error receiving chat completion response: %w", err), req.Model)
+		}
+
+		if response.Model != "" {
+			model = response.Model
+		}
+
+		if response.SystemFingerprint != "" {
+			fingerprint = response.SystemFingerprint
 		}
 
 		if len(response.Choices) == 0 {
 			continue answer
 		}
 
-		reply.WriteString(response.Choices[0].Delta.Content)
+		if firstTokenAt.IsZero() && response.Choices[0].Delta.Content != "" {
+			firstTokenAt = time.Now()
+			perf.Record("first-token", firstTokenAt.Sub(started))
+		}
+
+		calls = mergeToolCalls(calls, response.Choices[0].Delta.ToolCalls)
+
+		content := prefill.next(response.Choices[0].Delta.Content)
+		if response.Choices[0].FinishReason == openai.FinishReasonContentFilter {
+			content += filteredCompletionNotice(response.Choices[0].ContentFilterResults)
+		}
+
+		reply.WriteString(content)
 
 		c.onChunk(&ConversationChunk{
 			Role:           response.Choices[0].Delta.Role,
-			Content:        response.Choices[0].Delta.Content,
+			Content:        content,
 			IsInitialChunk: false,
 			IsFinalChunk:   false,
 			IsErrorChunk:   false,
 		})
 	}
 
+	c.answered = true
+	c.contextChanged = false
+
 	c.messages = append(c.messages, openai.ChatCompletionMessage{
-		Role:    openai.ChatMessageRoleAssistant,
-		Content: reply.String(),
+		Role:      openai.ChatMessageRoleAssistant,
+		Content:   reply.String(),
+		ToolCalls: calls,
 	})
 
-	return nil
+	return calls, nil
 }
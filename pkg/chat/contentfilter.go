@@ -0,0 +1,92 @@
+package chat
+
+import (
+	stderrors "errors"
+	"fmt"
+	"strings"
+
+	"github.com/sashabaranov/go-openai"
+
+	"github.com/emilkje/cwc/pkg/errors"
+)
+
+const (
+	contentFilterCode      = "content_filter"
+	policyViolationCode    = "ResponsibleAIPolicyViolation"
+	contentFilterExclusion = "If a file is to blame, leave it out with --exclude or /drop."
+)
+
+// contentFilterError turns the error Azure returns for a filtered prompt
+// into an errors.ContentFilterError explaining what was flagged and what
+// likely triggered it. It returns nil for any other error.
+func (c *Conversation) contentFilterError(err error) error {
+	if !c.provider.Capabilities().ContentFilter {
+		return nil
+	}
+
+	var apiErr *openai.APIError
+	if !stderrors.As(err, &apiErr) {
+		return nil
+	}
+
+	code, _ := apiErr.Code.(string)
+	if code != contentFilterCode && (apiErr.InnerError == nil || apiErr.InnerError.Code != policyViolationCode) {
+		return nil
+	}
+
+	var categories []string
+	if apiErr.InnerError != nil {
+		categories = filteredCategories(apiErr.InnerError.ContentFilterResults)
+	}
+
+	return errors.ContentFilterError{Categories: categories, Hint: c.contentFilterHint()}
+}
+
+// filteredCompletionNotice is appended to a response cut off by the content
+// filter, so the user knows the answer is incomplete and why.
+func filteredCompletionNotice(results openai.ContentFilterResults) string {
+	notice := "\n\n[the rest of the response was withheld by the Azure OpenAI content filter"
+	if categories := filteredCategories(results); len(categories) > 0 {
+		notice += " for " + strings.Join(categories, ", ")
+	}
+
+	return notice + "]"
+}
+
+// contentFilterHint guesses the part of the prompt that was flagged from
+// what changed since the last response that made it through the filter.
+func (c *Conversation) contentFilterHint() string {
+	switch {
+	case !c.answered:
+		return "It was triggered by either the files in the context or your message. " + contentFilterExclusion
+	case c.contextChanged:
+		return "The context changed since the last response, so a file added to it is the likely cause. " +
+			contentFilterExclusion
+	default:
+		return "Your latest message is the likely cause, try rephrasing it."
+	}
+}
+
+// filteredCategories lists the flagged categories with their severity.
+func filteredCategories(results openai.ContentFilterResults) []string {
+	var categories []string
+
+	add := func(name string, filtered bool, severity string) {
+		if !filtered {
+			return
+		}
+
+		if severity != "" {
+			name = fmt.Sprintf("%s (%s)", name, severity)
+		}
+
+		categories = append(categories, name)
+	}
+
+	add("hate", results.Hate.Filtered, results.Hate.Severity)
+	add("self-harm", results.SelfHarm.Filtered, results.SelfHarm.Severity)
+	add("sexual", results.Sexual.Filtered, results.Sexual.Severity)
+	add("violence", results.Violence.Filtered, results.Violence.Severity)
+
+	return categories
+}
@@ -0,0 +1,160 @@
+package chat
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/emilkje/cwc/pkg/datasample"
+	"github.com/emilkje/cwc/pkg/document"
+	"github.com/emilkje/cwc/pkg/filetree"
+	"github.com/emilkje/cwc/pkg/languages"
+	"github.com/emilkje/cwc/pkg/notebook"
+	"github.com/emilkje/cwc/pkg/perf"
+)
+
+// ContextBuilder renders files into the system message of a conversation.
+type ContextBuilder struct {
+	// Filter transforms the contents of each file before it is included,
+	// e.g. to redact secrets. Returning false withholds the file.
+	Filter func(path, content string) (string, bool)
+	// OnReadError is called for files that can't be read, which are
+	// included without contents.
+	OnReadError func(path string, err error)
+	// StripNotebookOutputs leaves out the outputs of the cells of Jupyter
+	// notebooks, which are otherwise kept but truncated.
+	StripNotebookOutputs bool
+	// DataSample controls which data files, such as large CSV exports, are
+	// included as a sample of their rows. Nil means the defaults.
+	DataSample *datasample.Options
+	// RepoMap is an overview of the repository, such as the output of cwc
+	// map, included along with the files.
+	RepoMap string
+}
+
+// Build renders the contents of the files and the file tree into a system
+// message. The files are read from disk one at a time and passed through the
+// filter, so only the message itself is held in memory.
+//
+// The message is laid out so that it changes as little as possible between
+// runs and turns: providers such as OpenAI cache prompts by their longest
+// common prefix, so the contents come first in the order the files were
+// given. The repository map and the file tree, which change whenever a file
+// is added or dropped, come last.
+func (b *ContextBuilder) Build(files []filetree.File) string {
+	defer perf.Track("build-context")()
+
+	var contextStr strings.Builder
+
+	contextStr.WriteString("File contents:\n\n")
+
+	for _, file := range files {
+		var content, fenceType string
+
+		if datasample.Applies(file.Path, file.Size, b.DataSample) {
+			content, fenceType = b.sample(&file)
+		} else {
+			data, err := file.ReadContents()
+			if err != nil && b.OnReadError != nil {
+				b.OnReadError(file.Path, err)
+			}
+
+			content, fenceType = b.render(&file, data)
+		}
+
+		fmt.Fprintf(&contextStr, "./%s\n```%s\n", file.Path, fenceType)
+
+		if b.Filter != nil {
+			filtered, ok := b.Filter(file.Path, content)
+			if !ok {
+				filtered = "[contents withheld as the file contains secrets]"
+			}
+
+			content = filtered
+		}
+
+		contextStr.WriteString(content)
+		contextStr.WriteString("\n```\n\n")
+	}
+
+	if b.RepoMap != "" {
+		repoMap := b.RepoMap
+		if b.Filter != nil {
+			repoMap, _ = b.Filter("the repository map", repoMap)
+		}
+
+		contextStr.WriteString("Repository map:\n\n")
+		contextStr.WriteString("```\n" + repoMap + "```\n\n")
+	}
+
+	fileTree := filetree.GenerateFileTree(filetree.NewFileTree(files), "", true)
+
+	contextStr.WriteString("File tree:\n\n")
+	contextStr.WriteString("```\n" + fileTree + "```\n")
+
+	return SystemMessage(contextStr.String())
+}
+
+// render returns the contents of the file as they are included, along with
+// the label of their code fence. Notebooks are rendered as source code, as
+// their JSON is mostly noise to the model, and only the text of PDF and DOCX
+// documents is included.
+func (b *ContextBuilder) render(file *filetree.File, data []byte) (string, string) {
+	if len(data) == 0 {
+		return "", file.Type
+	}
+
+	if document.IsDocument(file.Path) {
+		text, err := document.ExtractText(file.Path, data)
+		if err != nil {
+			return fmt.Sprintf("[the text could not be extracted: %s]", err), file.Type
+		}
+
+		return text, file.Type
+	}
+
+	if !notebook.IsNotebook(file.Path) {
+		return string(data), file.Type
+	}
+
+	nb, err := notebook.Render(data, &notebook.Options{StripOutputs: b.StripNotebookOutputs})
+	if err != nil {
+		return string(data), file.Type
+	}
+
+	fenceType := languages.FenceLabel(nb.Language)
+	if nb.Language == "" {
+		fenceType = ""
+	}
+
+	return nb.Source, fenceType
+}
+
+// sample returns the schema and a sample of the rows of a data file, which
+// is streamed from disk rather than read whole.
+func (b *ContextBuilder) sample(file *filetree.File) (string, string) {
+	sample, err := datasample.SampleFile(file.Path, file.Size, b.DataSample)
+	if err != nil {
+		if b.OnReadError != nil {
+			b.OnReadError(file.Path, err)
+		}
+
+		return fmt.Sprintf("[the data could not be sampled: %s]", err), file.Type
+	}
+
+	return sample, file.Type
+}
+
+// SystemMessage wraps context, such as the output of a command, in the
+// instructions of the system message.
+func SystemMessage(context string) string {
+	var systemMessage strings.Builder
+
+	systemMessage.WriteString("You are a helpful coding assistant. ")
+	systemMessage.WriteString("Below you will find relevant context to answer the user's question.\n\n")
+	systemMessage.WriteString("Context:\n")
+	systemMessage.WriteString(context)
+	systemMessage.WriteString("\n\n")
+	systemMessage.WriteString("Please follow the users instructions, you can do this!")
+
+	return systemMessage.String()
+}
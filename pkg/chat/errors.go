@@ -0,0 +1,64 @@
+package chat
+
+import (
+	"context"
+	stderrors "errors"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/sashabaranov/go-openai"
+
+	"github.com/emilkje/cwc/pkg/errors"
+)
+
+// ClassifyError maps an error from the provider to one of the typed errors
+// in pkg/errors, so callers can give guidance per class of error. Errors
+// that don't fit any class are returned as is.
+func ClassifyError(err error, model string) error { //nolint:cyclop
+	if err == nil {
+		return nil
+	}
+
+	var netErr net.Error
+	if stderrors.Is(err, context.DeadlineExceeded) || (stderrors.As(err, &netErr) && netErr.Timeout()) {
+		return errors.NetworkTimeoutError{Err: err}
+	}
+
+	var (
+		status int
+		code   string
+		msg    string
+	)
+
+	var apiErr *openai.APIError
+
+	var reqErr *openai.RequestError
+
+	switch {
+	case stderrors.As(err, &apiErr):
+		status, msg = apiErr.HTTPStatusCode, strings.ToLower(apiErr.Message)
+		code, _ = apiErr.Code.(string)
+	case stderrors.As(err, &reqErr):
+		status = reqErr.HTTPStatusCode
+	default:
+		return err
+	}
+
+	switch {
+	case code == "context_length_exceeded" || strings.Contains(msg, "maximum context length"):
+		return errors.ContextLengthExceededError{Err: err}
+	case code == "insufficient_quota":
+		return errors.QuotaExceededError{Err: err}
+	case status == http.StatusTooManyRequests:
+		return errors.QuotaExceededError{RateLimited: true, Err: err}
+	case status == http.StatusUnauthorized || status == http.StatusForbidden || code == "invalid_api_key":
+		return errors.AuthError{Err: err}
+	case status == http.StatusNotFound || code == "model_not_found" || code == "DeploymentNotFound":
+		return errors.ModelNotFoundError{Model: model, Err: err}
+	case status == http.StatusGatewayTimeout || status == http.StatusRequestTimeout:
+		return errors.NetworkTimeoutError{Err: err}
+	}
+
+	return err
+}
@@ -0,0 +1,99 @@
+package chat
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// DeterministicSeed is the seed used by the deterministic preset unless
+// another one is given.
+const DeterministicSeed = 0
+
+// Parameters pin the sampling parameters sent with every request of a
+// conversation. Nil fields are left to the provider's defaults.
+type Parameters struct {
+	// Model is the model, or on Azure the deployment, answering instead of
+	// the configured one.
+	Model       string
+	Temperature *float32
+	Seed        *int
+	// Stop lists sequences at which the model stops generating, leaving them
+	// out of the response.
+	Stop []string
+	// LogProbs asks for the log probabilities of the tokens of the response,
+	// with the TopLogProbs most likely alternatives at each position, where
+	// the provider supports it.
+	LogProbs    bool
+	TopLogProbs int
+}
+
+// DeterministicParameters returns the parameters that make responses as
+// reproducible as the provider allows: temperature 0 and a fixed seed.
+func DeterministicParameters() Parameters {
+	temperature := float32(0)
+	seed := DeterministicSeed
+
+	return Parameters{Temperature: &temperature, Seed: &seed}
+}
+
+func (p Parameters) apply(req *openai.ChatCompletionRequest) {
+	if p.Model != "" {
+		req.Model = p.Model
+	}
+
+	if p.Temperature != nil {
+		req.Temperature = *p.Temperature
+		if req.Temperature == 0 {
+			// a temperature of 0 is dropped from the request by omitempty,
+			// and the smallest positive value behaves the same
+			req.Temperature = math.SmallestNonzeroFloat32
+		}
+	}
+
+	req.Seed = p.Seed
+	req.Stop = p.Stop
+
+	if p.LogProbs {
+		req.LogProbs = true
+		req.TopLogProbs = p.TopLogProbs
+	}
+}
+
+// IsZero reports whether no parameters are pinned.
+func (p Parameters) IsZero() bool {
+	return p.Model == "" && p.Temperature == nil && p.Seed == nil && len(p.Stop) == 0 && !p.LogProbs
+}
+
+// String describes the pinned parameters, e.g. "temperature 0, seed 0".
+func (p Parameters) String() string {
+	var parts []string
+
+	if p.Model != "" {
+		parts = append(parts, "model "+p.Model)
+	}
+
+	if p.Temperature != nil {
+		parts = append(parts, fmt.Sprintf("temperature %g", *p.Temperature))
+	}
+
+	if p.Seed != nil {
+		parts = append(parts, fmt.Sprintf("seed %d", *p.Seed))
+	}
+
+	if len(p.Stop) > 0 {
+		parts = append(parts, fmt.Sprintf("stop %q", p.Stop))
+	}
+
+	if p.LogProbs {
+		parts = append(parts, fmt.Sprintf("logprobs with %d alternatives", p.TopLogProbs))
+	}
+
+	if len(parts) == 0 {
+		return "provider defaults"
+	}
+
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,96 @@
+package chat
+
+import (
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// SetPrefill sets the beginning of the responses of the conversations begun
+// after the call, which the model continues from, e.g. "```diff\n" to have it
+// answer with a diff only. Providers that can't be primed with the start of
+// a response are asked to begin with it instead.
+func (c *Chat) SetPrefill(prefill string) {
+	c.prefill = prefill
+}
+
+// primeRequest adds the prefill to the request, as the start of the response
+// where the provider supports it or as an instruction otherwise.
+func (c *Conversation) primeRequest(req *openai.ChatCompletionRequest, supported bool) {
+	if c.prefill == "" {
+		return
+	}
+
+	messages := slices.Clone(req.Messages)
+
+	if supported {
+		req.Messages = append(messages, openai.ChatCompletionMessage{
+			Role:    openai.ChatMessageRoleAssistant,
+			Content: c.prefill,
+		})
+
+		return
+	}
+
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].Role == openai.ChatMessageRoleUser {
+			messages[i].Content += "\n\nBegin your reply with exactly the text between the markers, then continue " +
+				"from it:\n<<<\n" + c.prefill + "\n>>>"
+
+			break
+		}
+	}
+
+	req.Messages = messages
+}
+
+// prefillWriter puts the prefill in front of a streamed response. When the
+// model was asked to begin with the prefill, it is held back until it can be
+// told whether the response repeats it, so it is shown only once.
+type prefillWriter struct {
+	prefill string
+	repeats bool
+	pending strings.Builder
+	done    bool
+}
+
+func newPrefillWriter(prefill string, supported bool) *prefillWriter {
+	return &prefillWriter{prefill: prefill, repeats: !supported, done: prefill == ""}
+}
+
+// next returns the content to pass on for the next part of the response.
+func (w *prefillWriter) next(content string) string {
+	if w.done || content == "" {
+		return content
+	}
+
+	if !w.repeats {
+		w.done = true
+		return w.prefill + content
+	}
+
+	w.pending.WriteString(content)
+
+	received := strings.TrimLeftFunc(w.pending.String(), unicode.IsSpace)
+	if len(received) < len(w.prefill) && strings.HasPrefix(w.prefill, received) {
+		return ""
+	}
+
+	w.done = true
+
+	return w.prefill + strings.TrimPrefix(received, w.prefill)
+}
+
+// flush returns what is held back when the response ends.
+func (w *prefillWriter) flush() string {
+	if w.done || w.pending.Len() == 0 {
+		return ""
+	}
+
+	w.done = true
+
+	// the response stopped within the prefill
+	return w.prefill
+}
@@ -0,0 +1,122 @@
+package chat
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/sashabaranov/go-openai"
+
+	"github.com/emilkje/cwc/pkg/errors"
+)
+
+const (
+	// maxContextRecoveries bounds the retries after a context-length error.
+	maxContextRecoveries = 10
+	// maxSummaryQuestionLength is the number of characters the questions of
+	// left out turns are shortened to in the summary that replaces them.
+	maxSummaryQuestionLength = 120
+)
+
+// ContextTrimmer is called when a request doesn't fit the context window and
+// there are no earlier turns left to leave out. It is given the messages the
+// user sent so far, to keep the files they mention, and returns a smaller
+// system message with a notice saying what was left out, or false if the
+// context can't shrink any further.
+type ContextTrimmer func(userMessages []string) (systemMessage string, notice string, ok bool)
+
+// SetContextTrimmer sets the trimmer of the conversations begun after the call.
+func (c *Chat) SetContextTrimmer(trimmer ContextTrimmer) {
+	c.trimmer = trimmer
+}
+
+// processWithRecovery sends the messages and, if they exceed the context
+// window, retries with a smaller prompt: first the oldest turns are replaced
+// by a summary of what was asked, then the trimmer shrinks the context.
+func (c *Conversation) processWithRecovery(ctx context.Context) error {
+	for attempt := 0; ; attempt++ {
+		err := c.processTurn(ctx)
+		if !errors.IsContextLengthExceededError(err) || attempt == maxContextRecoveries {
+			return err
+		}
+
+		notice, ok := c.shrink()
+		if !ok {
+			return err
+		}
+
+		c.onChunk(&ConversationChunk{
+			Role:   openai.ChatMessageRoleAssistant,
+			Notice: "the request didn't fit the context window, " + notice + ", retrying",
+		})
+	}
+}
+
+func (c *Conversation) shrink() (string, bool) {
+	if c.summarizeOldestTurn() {
+		return "summarized the oldest turn of the conversation", true
+	}
+
+	if c.trimmer == nil {
+		return "", false
+	}
+
+	var userMessages []string
+
+	for _, message := range c.messages {
+		if message.Role == openai.ChatMessageRoleUser {
+			userMessages = append(userMessages, message.Content)
+		}
+	}
+
+	systemMessage, notice, ok := c.trimmer(userMessages)
+	if !ok {
+		return "", false
+	}
+
+	c.SetSystemMessage(systemMessage)
+
+	return notice, true
+}
+
+// summarizeOldestTurn replaces the oldest question, the answer and any tool
+// calls made for it with a line in the summary of earlier turns, which takes
+// the place of the first user message. The latest question is always kept.
+func (c *Conversation) summarizeOldestTurn() bool {
+	first := 1
+	if c.summarized > 0 {
+		first++ // skip the summary itself
+	}
+
+	if len(c.messages) <= first || c.messages[first].Role != openai.ChatMessageRoleUser {
+		return false
+	}
+
+	next := first + 1
+	for next < len(c.messages) && c.messages[next].Role != openai.ChatMessageRoleUser {
+		next++
+	}
+
+	if next == len(c.messages) {
+		return false
+	}
+
+	question, _, _ := strings.Cut(strings.TrimSpace(c.messages[first].Content), "\n")
+	if runes := []rune(question); len(runes) > maxSummaryQuestionLength {
+		question = string(runes[:maxSummaryQuestionLength]) + "..."
+	}
+
+	c.summary = append(c.summary, "- "+question)
+	c.summarized++
+
+	summary := openai.ChatCompletionMessage{
+		Role: openai.ChatMessageRoleUser,
+		Content: fmt.Sprintf("To fit the context window, %d earlier turns of this conversation were left out. "+
+			"In them I asked:\n%s", c.summarized, strings.Join(c.summary, "\n")),
+	}
+
+	rest := c.messages[next:]
+	c.messages = append(append(c.messages[:1:1], summary), rest...)
+
+	return true
+}
@@ -0,0 +1,141 @@
+package chat
+
+import (
+	"github.com/sashabaranov/go-openai"
+
+	"github.com/emilkje/cwc/pkg/providers"
+)
+
+// EventType tells what an Event of a response stream carries.
+type EventType int
+
+const (
+	// EventStart is sent when the model starts answering.
+	EventStart EventType = iota
+	// EventDelta carries the next part of the answer in Content.
+	EventDelta
+	// EventNotice carries a notice in Content about something done on the
+	// caller's behalf, such as shrinking the context to fit the window.
+	EventNotice
+	// EventDone ends a successful response, with its Stats and, if asked
+	// for, its LogProbs.
+	EventDone
+	// EventError ends a failed response, with the error in Err.
+	EventError
+)
+
+// Event is part of the response to a message sent in a Session.
+type Event struct {
+	Type    EventType
+	Content string
+	Stats   *TurnStats
+	Err     error
+	// LogProbs are the log probabilities of the tokens of the response.
+	LogProbs []openai.LogProb
+}
+
+// Session is a conversation for programs embedding cwc. Unlike Chat, which
+// reports responses to a callback, each Send returns the response as a
+// stream of events.
+type Session struct {
+	chat         *Chat
+	conversation *Conversation
+	events       chan Event
+}
+
+// NewSession creates a session with the given system message, typically
+// built with a ContextBuilder.
+func NewSession(provider providers.Provider, systemMessage string) *Session {
+	s := &Session{}
+	s.chat = NewChat(provider, systemMessage, s.handleChunk)
+
+	return s
+}
+
+// SetParameters pins the sampling parameters. It must be called before the
+// first message is sent.
+func (s *Session) SetParameters(params Parameters) {
+	s.chat.SetParameters(params)
+}
+
+// SetContextTrimmer sets how the context shrinks when a request exceeds the
+// context window. It must be called before the first message is sent.
+func (s *Session) SetContextTrimmer(trimmer ContextTrimmer) {
+	s.chat.SetContextTrimmer(trimmer)
+}
+
+// SetTools sets the tools offered to the model. It must be called before the
+// first message is sent.
+func (s *Session) SetTools(tools []Tool) {
+	s.chat.SetTools(tools)
+}
+
+// SetPrefill sets the beginning of every response, see Chat.SetPrefill. It
+// must be called before the first message is sent.
+func (s *Session) SetPrefill(prefill string) {
+	s.chat.SetPrefill(prefill)
+}
+
+// SetSystemMessage replaces the system message for the following messages.
+func (s *Session) SetSystemMessage(message string) {
+	if s.conversation == nil {
+		s.chat.systemMessage = message
+		return
+	}
+
+	s.conversation.SetSystemMessage(message)
+}
+
+// Conversation returns the underlying conversation, or nil if no message has
+// been sent yet.
+func (s *Session) Conversation() *Conversation {
+	return s.conversation
+}
+
+// Request returns the request sending the message would make, without
+// sending it, as the first message of the session.
+func (s *Session) Request(message string) openai.ChatCompletionRequest {
+	return s.chat.Request(message)
+}
+
+// Send sends the message and returns the events of the response. The
+// channel is closed after the EventDone or EventError event, and must be
+// drained before the next message is sent.
+func (s *Session) Send(message string) <-chan Event {
+	events := make(chan Event)
+	s.events = events
+
+	if s.conversation == nil {
+		s.conversation = s.chat.BeginConversation(message)
+	} else {
+		s.conversation.Reply(message)
+	}
+
+	conversation := s.conversation
+
+	go func() {
+		conversation.WaitMyTurn()
+		close(events)
+	}()
+
+	return events
+}
+
+func (s *Session) handleChunk(chunk *ConversationChunk) {
+	s.events <- chunkEvent(chunk)
+}
+
+func chunkEvent(chunk *ConversationChunk) Event {
+	switch {
+	case chunk.Notice != "":
+		return Event{Type: EventNotice, Content: chunk.Notice}
+	case chunk.IsErrorChunk:
+		return Event{Type: EventError, Content: chunk.Content, Err: chunk.Err}
+	case chunk.IsInitialChunk:
+		return Event{Type: EventStart}
+	case chunk.IsFinalChunk:
+		return Event{Type: EventDone, Stats: chunk.Stats, LogProbs: chunk.LogProbs}
+	default:
+		return Event{Type: EventDelta, Content: chunk.Content}
+	}
+}
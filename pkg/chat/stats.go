@@ -0,0 +1,161 @@
+package chat
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/emilkje/cwc/pkg/perf"
+)
+
+// charsPerToken is a rough average for English text and source code, used
+// where the API doesn't report token usage.
+const charsPerToken = 4
+
+const tokensPerKilo = 1000
+
+// EstimateTokens gives a rough token count for a text.
+func EstimateTokens(text string) int {
+	return EstimateTokensForSize(int64(len(text)))
+}
+
+// EstimateTokensForSize gives a rough token count for a text of the given
+// size in bytes.
+func EstimateTokensForSize(size int64) int {
+	return int((size + charsPerToken - 1) / charsPerToken)
+}
+
+// modelPrice is the price in USD per thousand tokens.
+type modelPrice struct {
+	prompt     float64
+	completion float64
+}
+
+// modelPrices are matched by prefix, so more specific names must come first.
+var modelPrices = []struct { //nolint:gochecknoglobals
+	prefix string
+	price  modelPrice
+}{
+	{"gpt-4o", modelPrice{prompt: 0.005, completion: 0.015}},
+	{"gpt-4-turbo", modelPrice{prompt: 0.01, completion: 0.03}},
+	{"gpt-4-1106", modelPrice{prompt: 0.01, completion: 0.03}},
+	{"gpt-4-0125", modelPrice{prompt: 0.01, completion: 0.03}},
+	{"gpt-4-vision", modelPrice{prompt: 0.01, completion: 0.03}},
+	{"gpt-4-32k", modelPrice{prompt: 0.06, completion: 0.12}},
+	{"gpt-4", modelPrice{prompt: 0.03, completion: 0.06}},
+	{"gpt-35-turbo", modelPrice{prompt: 0.0005, completion: 0.0015}},
+	{"gpt-3.5-turbo", modelPrice{prompt: 0.0005, completion: 0.0015}},
+}
+
+// TurnStats describes the cost of a single response, or the sum of several.
+type TurnStats struct {
+	Model            string
+	PromptTokens     int
+	CompletionTokens int
+	// Estimated is set when the token counts are estimated from the length
+	// of the messages rather than reported by the API.
+	Estimated bool
+	Latency   time.Duration
+	Turns     int
+	// SystemFingerprint identifies the backend configuration that answered.
+	// Responses to the same seeded request only reproduce while it stays the
+	// same.
+	SystemFingerprint string
+}
+
+// Add accumulates the stats of another turn.
+func (s *TurnStats) Add(other TurnStats) {
+	if s.Model == "" {
+		s.Model = other.Model
+	}
+
+	if s.SystemFingerprint == "" {
+		s.SystemFingerprint = other.SystemFingerprint
+	}
+
+	s.PromptTokens += other.PromptTokens
+	s.CompletionTokens += other.CompletionTokens
+	s.Estimated = s.Estimated || other.Estimated
+	s.Latency += other.Latency
+	s.Turns += other.Turns
+}
+
+// Cost returns the price of the turn in USD, if the price of the model is known.
+func (s *TurnStats) Cost() (float64, bool) {
+	model := strings.ToLower(s.Model)
+
+	for _, entry := range modelPrices {
+		if strings.HasPrefix(model, entry.prefix) {
+			cost := float64(s.PromptTokens)*entry.price.prompt + float64(s.CompletionTokens)*entry.price.completion
+			return cost / tokensPerKilo, true
+		}
+	}
+
+	return 0, false
+}
+
+// PromptCost returns the price in USD of a prompt of the given number of
+// tokens, if the price of the model is known, e.g. to estimate a request
+// before it is sent.
+func PromptCost(model string, tokens int) (float64, bool) {
+	stats := TurnStats{Model: model, PromptTokens: tokens}
+	return stats.Cost()
+}
+
+// String formats the stats as a one-line summary along the lines of
+// "gpt-4o · 8,214 in / 642 out · $0.04 · 9.8s".
+func (s *TurnStats) String() string {
+	approx := ""
+	if s.Estimated {
+		approx = "~"
+	}
+
+	parts := []string{
+		fmt.Sprintf("%s%s in / %s%s out", approx, GroupThousands(s.PromptTokens), approx, GroupThousands(s.CompletionTokens)),
+	}
+
+	if s.Model != "" {
+		parts = append([]string{s.Model}, parts...)
+	}
+
+	if cost, ok := s.Cost(); ok {
+		parts = append(parts, fmt.Sprintf("%s$%.2f", approx, cost))
+	}
+
+	parts = append(parts, fmt.Sprintf("%.1fs", s.Latency.Seconds()))
+
+	return strings.Join(parts, " · ")
+}
+
+// GroupThousands formats n with commas between the groups of thousands, e.g.
+// "8,214".
+func GroupThousands(n int) string {
+	digits := strconv.Itoa(n)
+
+	var out strings.Builder
+
+	for i, digit := range digits {
+		if i > 0 && (len(digits)-i)%3 == 0 {
+			out.WriteByte(',')
+		}
+
+		out.WriteRune(digit)
+	}
+
+	return out.String()
+}
+
+func (c *Conversation) estimatePromptTokens() int {
+	defer perf.Track("tokenize")()
+
+	// every message carries a few tokens of overhead for the role and separators
+	const overheadPerMessage = 4
+
+	tokens := 0
+	for _, message := range c.messages {
+		tokens += c.provider.CountTokens(message.Content) + overheadPerMessage
+	}
+
+	return tokens
+}
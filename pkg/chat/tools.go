@@ -0,0 +1,111 @@
+package chat
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// maxToolRounds bounds the tool calls the model may make in a row before it
+// has to answer.
+const maxToolRounds = 8
+
+// Tool is a function the model may call while answering.
+type Tool struct {
+	Name        string
+	Description string
+	// Parameters is the JSON Schema of the arguments.
+	Parameters json.RawMessage
+	// Call runs the tool with the arguments chosen by the model, a JSON object.
+	Call func(ctx context.Context, arguments string) (string, error)
+}
+
+// SetTools sets the tools offered to the model in the conversations begun
+// after the call.
+func (c *Chat) SetTools(tools []Tool) {
+	c.tools = tools
+}
+
+func (c *Conversation) toolDefinitions() []openai.Tool {
+	definitions := make([]openai.Tool, 0, len(c.tools))
+
+	for _, tool := range c.tools {
+		definitions = append(definitions, openai.Tool{
+			Type: openai.ToolTypeFunction,
+			Function: &openai.FunctionDefinition{
+				Name:        tool.Name,
+				Description: tool.Description,
+				Parameters:  tool.Parameters,
+			},
+		})
+	}
+
+	return definitions
+}
+
+// processTurn answers the latest message, calling tools for as long as the
+// model asks for them.
+func (c *Conversation) processTurn(ctx context.Context) error {
+	for round := 0; ; round++ {
+		calls, err := c.processMessages(ctx, round < maxToolRounds)
+		if err != nil || len(calls) == 0 {
+			return err
+		}
+
+		for _, call := range calls {
+			c.onChunk(&ConversationChunk{
+				Role:   openai.ChatMessageRoleAssistant,
+				Notice: "calling " + call.Function.Name,
+			})
+
+			c.messages = append(c.messages, openai.ChatCompletionMessage{
+				Role:       openai.ChatMessageRoleTool,
+				Content:    c.callTool(ctx, call),
+				ToolCallID: call.ID,
+			})
+		}
+	}
+}
+
+// callTool returns the result of the call, or the error for the model to see.
+func (c *Conversation) callTool(ctx context.Context, call openai.ToolCall) string {
+	for _, tool := range c.tools {
+		if tool.Name != call.Function.Name {
+			continue
+		}
+
+		result, err := tool.Call(ctx, call.Function.Arguments)
+		if err != nil {
+			return "error: " + err.Error()
+		}
+
+		return result
+	}
+
+	return "error: there is no tool named " + call.Function.Name
+}
+
+// mergeToolCalls adds the parts of tool calls streamed in a delta to calls.
+func mergeToolCalls(calls []openai.ToolCall, deltas []openai.ToolCall) []openai.ToolCall {
+	for _, delta := range deltas {
+		index := len(calls)
+		if delta.Index != nil {
+			index = *delta.Index
+		}
+
+		for len(calls) <= index {
+			calls = append(calls, openai.ToolCall{Type: openai.ToolTypeFunction})
+		}
+
+		call := &calls[index]
+		if delta.ID != "" {
+			call.ID = delta.ID
+		}
+
+		call.Function.Name += delta.Function.Name
+		call.Function.Arguments += delta.Function.Arguments
+	}
+
+	return calls
+}
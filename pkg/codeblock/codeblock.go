@@ -0,0 +1,119 @@
+// Package codeblock extracts the fenced code blocks of markdown, such as the
+// answers of the model.
+package codeblock
+
+import (
+	"slices"
+	"strings"
+)
+
+// minFence is the length of the shortest fence.
+const minFence = 3
+
+// Block is a fenced code block.
+type Block struct {
+	// Info is the text after the opening fence, e.g. "go" or
+	// "go title=main.go".
+	Info string
+	// Content is the code, ending with a newline unless empty.
+	Content string
+}
+
+// Lang returns the language of the block, the first word of its info.
+func (b *Block) Lang() string {
+	if fields := strings.Fields(b.Info); len(fields) > 0 {
+		return fields[0]
+	}
+
+	return ""
+}
+
+// pathAttributes name the file of a block in its info, as in
+// "go title=pkg/foo/foo.go".
+var pathAttributes = []string{"title", "path", "file", "filename"} //nolint:gochecknoglobals
+
+// Path returns the file the block is annotated with, e.g. pkg/foo/foo.go for
+// "go title=pkg/foo/foo.go" or `go title="pkg/foo/foo.go"`, or "".
+func (b *Block) Path() string {
+	for _, field := range strings.Fields(b.Info) {
+		name, value, ok := strings.Cut(field, "=")
+		if !ok || !slices.Contains(pathAttributes, strings.ToLower(name)) {
+			continue
+		}
+
+		return strings.Trim(value, `"'`)
+	}
+
+	return ""
+}
+
+// Parse returns the fenced code blocks of the text in order. Fences are runs
+// of at least three backticks or tildes, closed by a run of the same
+// character at least as long. A block left open runs to the end of the text.
+func Parse(text string) []Block {
+	var (
+		blocks  []Block
+		current *Block
+		content strings.Builder
+		fence   string
+	)
+
+	for _, line := range strings.Split(strings.TrimSuffix(text, "\n"), "\n") {
+		trimmed := strings.TrimSpace(line)
+
+		if current == nil {
+			if marker := fenceOf(trimmed); marker != "" {
+				current = &Block{Info: strings.TrimSpace(trimmed[len(marker):])}
+				fence = marker
+			}
+
+			continue
+		}
+
+		if marker := fenceOf(trimmed); marker != "" && marker == trimmed && marker[0] == fence[0] && len(marker) >= len(fence) {
+			current.Content = content.String()
+			blocks = append(blocks, *current)
+			current = nil
+
+			content.Reset()
+
+			continue
+		}
+
+		content.WriteString(strings.TrimRight(line, "\r\n") + "\n")
+	}
+
+	if current != nil && content.Len() > 0 {
+		current.Content = content.String()
+		blocks = append(blocks, *current)
+	}
+
+	return blocks
+}
+
+// Code returns the content of the blocks of the text, separated by blank
+// lines, or "" if there are none.
+func Code(text string) string {
+	blocks := Parse(text)
+
+	contents := make([]string, 0, len(blocks))
+	for _, block := range blocks {
+		contents = append(contents, block.Content)
+	}
+
+	return strings.Join(contents, "\n")
+}
+
+// fenceOf returns the fence a line begins with, or "".
+func fenceOf(line string) string {
+	if line == "" || line[0] != '`' && line[0] != '~' {
+		return ""
+	}
+
+	n := len(line) - len(strings.TrimLeft(line, line[:1]))
+	if n < minFence {
+		return ""
+	}
+
+	return line[:n]
+}
@@ -0,0 +1,399 @@
+// Package commitmsg helps write commit messages that fit a repository: it
+// detects whether the history follows Conventional Commits, infers the type
+// and scope of a change from the paths it touches, and checks messages
+// against the rules of commitlint's conventional config.
+package commitmsg
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+)
+
+const (
+	// maxHeaderLength and maxBodyLineLength are the limits of commitlint's
+	// conventional config.
+	maxHeaderLength   = 100
+	maxBodyLineLength = 100
+	// minConventionalShare is the share of recent subjects that must be
+	// conventional for the history to count as following the convention.
+	minConventionalShare = 0.6
+	// minSubjects is how many subjects it takes to tell.
+	minSubjects = 3
+)
+
+// DefaultTypes are the types of commitlint's conventional config.
+var DefaultTypes = []string{ //nolint:gochecknoglobals
+	"feat", "fix", "docs", "style", "refactor", "perf", "test", "build", "ci", "chore", "revert",
+}
+
+// headerRegexp matches type(scope)!: subject.
+var headerRegexp = regexp.MustCompile(`^([^\s():!]+)(?:\(([^()]*)\))?(!)?: ?(.*)$`) //nolint:gochecknoglobals
+
+// Header is the first line of a conventional commit message.
+type Header struct {
+	Type     string
+	Scope    string
+	Breaking bool
+	Subject  string
+}
+
+// ParseHeader parses a header like feat(api)!: add streaming.
+func ParseHeader(line string) (Header, bool) {
+	m := headerRegexp.FindStringSubmatch(line)
+	if m == nil {
+		return Header{}, false
+	}
+
+	return Header{Type: m[1], Scope: m[2], Breaking: m[3] != "", Subject: m[4]}, true
+}
+
+// Convention is how the commit messages of a repository are written.
+type Convention struct {
+	// Conventional is whether messages follow Conventional Commits.
+	Conventional bool
+	// Types are the allowed types: the default ones and those the history
+	// uses besides them.
+	Types []string
+	// Scopes are the scopes the history uses, the most frequent first.
+	Scopes []string
+}
+
+// Detect tells from recent subjects whether the repository follows
+// Conventional Commits. A commitlint configuration settles it.
+func Detect(subjects []string, commitlint bool) *Convention {
+	convention := &Convention{Types: slices.Clone(DefaultTypes)}
+
+	conventional := 0
+	types := make(map[string]int)
+	scopes := make(map[string]int)
+
+	for _, subject := range subjects {
+		header, ok := ParseHeader(subject)
+		if !ok || header.Subject == "" || !strings.Contains(subject, ": ") {
+			continue
+		}
+
+		conventional++
+		types[strings.ToLower(header.Type)]++
+
+		if header.Scope != "" {
+			scopes[header.Scope]++
+		}
+	}
+
+	convention.Conventional = commitlint ||
+		(len(subjects) >= minSubjects && float64(conventional) >= minConventionalShare*float64(len(subjects)))
+
+	// types a repository adds are used more than once, unlike typos
+	for name, count := range types {
+		if count > 1 && !slices.Contains(convention.Types, name) {
+			convention.Types = append(convention.Types, name)
+		}
+	}
+
+	for scope := range scopes {
+		convention.Scopes = append(convention.Scopes, scope)
+	}
+
+	sort.Slice(convention.Scopes, func(i, j int) bool {
+		a, b := convention.Scopes[i], convention.Scopes[j]
+		if scopes[a] != scopes[b] {
+			return scopes[a] > scopes[b]
+		}
+
+		return a < b
+	})
+
+	return convention
+}
+
+// commitlintFiles are the files commitlint reads its configuration from.
+var commitlintFiles = []string{ //nolint:gochecknoglobals
+	".commitlintrc", ".commitlintrc.json", ".commitlintrc.yaml", ".commitlintrc.yml", ".commitlintrc.js",
+	".commitlintrc.cjs", ".commitlintrc.mjs", ".commitlintrc.ts", "commitlint.config.js", "commitlint.config.cjs",
+	"commitlint.config.mjs", "commitlint.config.ts",
+}
+
+// UsesCommitlint reports whether the repository at root configures
+// commitlint, in its own file or in package.json.
+func UsesCommitlint(root string) bool {
+	for _, name := range commitlintFiles {
+		if _, err := os.Stat(filepath.Join(root, name)); err == nil {
+			return true
+		}
+	}
+
+	data, err := os.ReadFile(filepath.Join(root, "package.json")) // #nosec
+	if err != nil {
+		return false
+	}
+
+	return strings.Contains(string(data), `"commitlint"`)
+}
+
+// InferType returns the type that all the paths call for, such as docs when
+// only documentation changes, or "" when it takes the diff to tell.
+func InferType(paths []string) string {
+	kinds := []struct {
+		name string
+		is   func(string) bool
+	}{
+		{"docs", isDoc},
+		{"test", isTest},
+		{"ci", isCI},
+		{"build", isBuild},
+	}
+
+	for _, kind := range kinds {
+		if len(paths) > 0 && !slices.ContainsFunc(paths, func(p string) bool { return !kind.is(p) }) {
+			return kind.name
+		}
+	}
+
+	return ""
+}
+
+func isDoc(p string) bool {
+	switch strings.ToLower(path.Ext(p)) {
+	case ".md", ".mdx", ".rst", ".adoc", ".txt":
+		return true
+	}
+
+	return strings.HasPrefix(p, "docs/") || strings.HasPrefix(p, "doc/")
+}
+
+func isTest(p string) bool {
+	base := path.Base(p)
+
+	return strings.HasSuffix(base, "_test.go") || strings.Contains(base, ".test.") ||
+		strings.Contains(base, ".spec.") || strings.HasPrefix(base, "test_") ||
+		strings.Contains("/"+p, "/testdata/") || strings.Contains("/"+p, "/tests/") ||
+		strings.Contains("/"+p, "/__tests__/")
+}
+
+func isCI(p string) bool {
+	return strings.HasPrefix(p, ".github/workflows/") || strings.HasPrefix(p, ".circleci/") ||
+		p == ".gitlab-ci.yml" || p == "azure-pipelines.yml" || p == ".travis.yml" || p == "Jenkinsfile"
+}
+
+func isBuild(p string) bool {
+	switch path.Base(p) {
+	case "go.mod", "go.sum", "package.json", "package-lock.json", "yarn.lock", "pnpm-lock.yaml", "Cargo.toml",
+		"Cargo.lock", "pyproject.toml", "poetry.lock", "requirements.txt", "Makefile", "Dockerfile",
+		".goreleaser.yml", ".goreleaser.yaml", "build.gradle", "pom.xml":
+		return true
+	}
+
+	return false
+}
+
+// containerDirs hold a directory per component, which names the scope.
+var containerDirs = []string{"pkg", "internal", "src", "lib", "packages", "apps", "services", "crates"} //nolint:gochecknoglobals
+
+// InferScope returns the scope of the component all the paths are in, such
+// as config for pkg/config/config.go, preferring the spelling the history
+// uses. It returns "" when the paths span components, or when the history
+// uses no scopes at all.
+func InferScope(paths []string, convention *Convention) string {
+	if len(convention.Scopes) == 0 {
+		return ""
+	}
+
+	var scope string
+
+	for _, p := range paths {
+		component := componentOf(p)
+		if component == "" || (scope != "" && component != scope) {
+			return ""
+		}
+
+		scope = component
+	}
+
+	for _, known := range convention.Scopes {
+		if strings.EqualFold(known, scope) {
+			return known
+		}
+	}
+
+	return scope
+}
+
+func componentOf(p string) string {
+	parts := strings.Split(path.Clean(filepath.ToSlash(p)), "/")
+	if len(parts) < 2 { //nolint:gomnd
+		return ""
+	}
+
+	if slices.Contains(containerDirs, parts[0]) && len(parts) > 2 { //nolint:gomnd
+		return parts[1]
+	}
+
+	return strings.TrimPrefix(parts[0], ".")
+}
+
+// sentenceCaseRegexp matches subjects starting with a capitalized word, like
+// "Add x", but not with an acronym, like "API x".
+var sentenceCaseRegexp = regexp.MustCompile(`^\p{Lu}\p{Ll}`) //nolint:gochecknoglobals
+
+// Lint returns the rules the message breaks. The header rules of
+// Conventional Commits only apply to repositories that follow them.
+func Lint(message string, convention *Convention) []string {
+	lines := strings.Split(strings.TrimRight(message, "\n"), "\n")
+	header := lines[0]
+
+	var problems []string
+
+	if strings.TrimSpace(header) == "" {
+		return []string{"the header is empty"}
+	}
+
+	if len(header) > maxHeaderLength {
+		problems = append(problems, fmt.Sprintf("the header is %d characters, more than %d", len(header), maxHeaderLength))
+	}
+
+	if convention.Conventional {
+		problems = append(problems, lintHeader(header, convention)...)
+	}
+
+	if len(lines) > 1 && strings.TrimSpace(lines[1]) != "" {
+		problems = append(problems, "the body must be separated from the header by a blank line")
+	}
+
+	for i, line := range lines[1:] {
+		if len(line) > maxBodyLineLength && !strings.Contains(line, "://") {
+			problems = append(problems, fmt.Sprintf("line %d of the body is longer than %d characters", i+1, maxBodyLineLength))
+		}
+	}
+
+	return problems
+}
+
+func lintHeader(header string, convention *Convention) []string {
+	parsed, ok := ParseHeader(header)
+	if !ok {
+		return []string{"the header must look like type(scope): subject, such as fix(config): handle empty files"}
+	}
+
+	var problems []string
+
+	if parsed.Type != strings.ToLower(parsed.Type) {
+		problems = append(problems, fmt.Sprintf("the type %q must be lower case", parsed.Type))
+	}
+
+	if !slices.Contains(convention.Types, strings.ToLower(parsed.Type)) {
+		problems = append(problems, fmt.Sprintf("the type %q must be one of %s", parsed.Type, strings.Join(convention.Types, ", ")))
+	}
+
+	if parsed.Scope != strings.ToLower(parsed.Scope) && !slices.Contains(convention.Scopes, parsed.Scope) {
+		problems = append(problems, fmt.Sprintf("the scope %q must be lower case", parsed.Scope))
+	}
+
+	if !strings.Contains(header, ": ") {
+		problems = append(problems, "the colon after the type must be followed by a space")
+	}
+
+	subject := strings.TrimSpace(parsed.Subject)
+
+	if subject == "" {
+		return append(problems, "the subject is empty")
+	}
+
+	if strings.HasSuffix(subject, ".") {
+		problems = append(problems, "the subject must not end with a full stop")
+	}
+
+	if sentenceCaseRegexp.MatchString(subject) {
+		problems = append(problems, "the subject must not start with a capital letter")
+	}
+
+	return problems
+}
+
+// Clean removes what models wrap messages in: code fences, quotes and a
+// label like "Commit message:".
+func Clean(reply string) string {
+	message := strings.TrimSpace(reply)
+
+	if strings.HasPrefix(message, "```") {
+		message = strings.TrimPrefix(message[strings.IndexByte(message+"\n", '\n'):], "\n")
+		message = strings.TrimSuffix(strings.TrimSpace(message), "```")
+	}
+
+	for _, label := range []string{"Commit message:", "commit message:"} {
+		message = strings.TrimPrefix(strings.TrimSpace(message), label)
+	}
+
+	message = strings.TrimSpace(message)
+
+	if len(message) > 1 && (message[0] == '"' || message[0] == '`') && message[len(message)-1] == message[0] {
+		message = message[1 : len(message)-1]
+	}
+
+	return strings.TrimSpace(message) + "\n"
+}
+
+// maxExamples bounds the recent subjects shown as examples of the style.
+const maxExamples = 10
+
+// Prompt asks the model for the message of the staged diff in its context, in
+// the style of the recent subjects.
+func Prompt(convention *Convention, subjects []string, typ, scope string) string {
+	return "Write the commit message for the staged changes in the context: " + style(convention, subjects, typ, scope) +
+		"\n\nReply with the message only, without code fences."
+}
+
+// SummaryPrompt asks for the message of a commit closing a branch whose
+// commits have the given subjects and whose diff is in the context, telling
+// its reviewers what the branch changes as a whole.
+func SummaryPrompt(convention *Convention, subjects, commits []string) string {
+	return "The diff in the context is the sum of the commits of a branch, which are:\n- " +
+		strings.Join(commits, "\n- ") + "\n\nWrite the message of a final commit summarizing what the branch " +
+		"changes and why, for the reviewers of the branch: " + style(convention, subjects, "", "") +
+		"\n\nReply with the message only, without code fences."
+}
+
+// style describes how messages are written in the repository, with the type
+// and scope of the change if they are known.
+func style(convention *Convention, subjects []string, typ, scope string) string {
+	var prompt strings.Builder
+
+	prompt.WriteString("a header of at most 72 characters in the imperative mood, then, if the change needs " +
+		"explaining, a blank line and a body wrapped at 72 characters on what changed and why. ")
+
+	if convention.Conventional {
+		fmt.Fprintf(&prompt, "Follow Conventional Commits: the header is type(scope): subject, with a type of %s, "+
+			"and a lower case subject without a full stop. Mark breaking changes with ! after the scope and a "+
+			"BREAKING CHANGE: footer. ", strings.Join(convention.Types, ", "))
+
+		if typ != "" {
+			fmt.Fprintf(&prompt, "Only %s files change, so the type is likely %s. ", typ, typ)
+		}
+
+		switch {
+		case scope != "":
+			fmt.Fprintf(&prompt, "The changes are in %s, so use the scope %s unless another fits better. ", scope, scope)
+		case len(convention.Scopes) > 0:
+			fmt.Fprintf(&prompt, "Scopes used before include %s; leave the scope out when the changes span "+
+				"several. ", strings.Join(convention.Scopes[:min(len(convention.Scopes), maxExamples)], ", "))
+		default:
+			prompt.WriteString("The repository doesn't use scopes, so leave it out. ")
+		}
+	}
+
+	if len(subjects) > 0 {
+		prompt.WriteString("Match the style of these recent subjects:\n")
+
+		for _, subject := range subjects[:min(len(subjects), maxExamples)] {
+			prompt.WriteString("- " + subject + "\n")
+		}
+	}
+
+	return strings.TrimSpace(prompt.String())
+}
@@ -0,0 +1,206 @@
+package commitmsg
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Hunk is a unit of a staged patch that can go into a commit of its own: a
+// hunk of a file, or the whole change to a file without hunks, such as a
+// binary file, a rename or a change of mode.
+type Hunk struct {
+	// ID numbers the hunks of the patch from 1, in order.
+	ID   int
+	Path string
+	// header is the diff --git header of the file, which every patch of
+	// its hunks starts with.
+	header string
+	// body is the hunk, starting with its @@ line, or "" for changes
+	// without hunks.
+	body   string
+	binary bool
+}
+
+// ParseHunks splits a patch like that of git diff --cached --binary into its
+// hunks.
+func ParseHunks(patch string) []Hunk {
+	var hunks []Hunk
+
+	for _, line := range strings.SplitAfter(patch, "\n") {
+		if strings.HasPrefix(line, "diff --git ") {
+			hunks = append(hunks, Hunk{header: line})
+			continue
+		}
+
+		if len(hunks) == 0 {
+			continue
+		}
+
+		last := &hunks[len(hunks)-1]
+
+		switch {
+		case strings.HasPrefix(line, "@@"):
+			if last.body != "" {
+				hunks = append(hunks, Hunk{header: last.header})
+				last = &hunks[len(hunks)-1]
+			}
+
+			last.body = line
+		case last.body != "":
+			last.body += line
+		default:
+			last.header += line
+		}
+	}
+
+	for i := range hunks {
+		hunk := &hunks[i]
+		hunk.ID = i + 1
+		hunk.Path = headerPath(hunk.header)
+		hunk.binary = strings.Contains(hunk.header, "\nGIT binary patch\n") ||
+			strings.Contains(hunk.header, "\nBinary files ")
+	}
+
+	return hunks
+}
+
+// headerPath returns the path a file header writes to, or deletes.
+func headerPath(header string) string {
+	var path string
+
+	for _, line := range strings.Split(header, "\n") {
+		switch {
+		case strings.HasPrefix(line, "diff --git "):
+			if _, b, ok := strings.Cut(line, " b/"); ok && path == "" {
+				path = b
+			}
+		case strings.HasPrefix(line, "+++ b/"):
+			path = strings.TrimPrefix(line, "+++ b/")
+		case strings.HasPrefix(line, "--- a/") && strings.Contains(header, "\n+++ /dev/null"):
+			path = strings.TrimPrefix(line, "--- a/")
+		}
+	}
+
+	return path
+}
+
+// String describes the hunk for the model, without the contents of binary
+// files.
+func (h *Hunk) String() string {
+	if h.binary {
+		return fmt.Sprintf("[%d] %s (binary)\n", h.ID, h.Path)
+	}
+
+	if h.body == "" {
+		var lines []string
+
+		for _, line := range strings.Split(strings.TrimSpace(h.header), "\n")[1:] {
+			if !strings.HasPrefix(line, "index ") {
+				lines = append(lines, line)
+			}
+		}
+
+		return fmt.Sprintf("[%d] %s\n%s\n", h.ID, h.Path, strings.Join(lines, "\n"))
+	}
+
+	return fmt.Sprintf("[%d] %s\n%s", h.ID, h.Path, h.body)
+}
+
+// Patch joins the hunks, in the order of the original patch, into a patch
+// that git apply takes.
+func Patch(hunks []Hunk) string {
+	sorted := append([]Hunk(nil), hunks...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].ID < sorted[j].ID })
+
+	var (
+		patch  strings.Builder
+		header string
+	)
+
+	for _, hunk := range sorted {
+		if hunk.header != header {
+			header = hunk.header
+			patch.WriteString(header)
+		}
+
+		patch.WriteString(hunk.body)
+	}
+
+	return patch.String()
+}
+
+// SplitCommit is one of the commits staged changes are split into.
+type SplitCommit struct {
+	Message string `json:"message"`
+	// Hunks are the IDs of the hunks of the commit.
+	Hunks []int `json:"hunks"`
+}
+
+// ParseSplit reads the commits the staged hunks are split into from the
+// reply, checking that every hunk is in exactly one commit.
+func ParseSplit(reply string, hunks int) ([]SplitCommit, error) {
+	start, end := strings.IndexByte(reply, '['), strings.LastIndexByte(reply, ']')
+	if start < 0 || end < start {
+		return nil, errors.New("the reply contains no JSON array of commits")
+	}
+
+	var parsed []SplitCommit
+	if err := json.Unmarshal([]byte(reply[start:end+1]), &parsed); err != nil {
+		return nil, fmt.Errorf("error parsing the commits: %w", err)
+	}
+
+	owner := make(map[int]int)
+
+	var commits []SplitCommit
+
+	for i, commit := range parsed {
+		if len(commit.Hunks) == 0 {
+			continue
+		}
+
+		for _, id := range commit.Hunks {
+			if id < 1 || id > hunks {
+				return nil, fmt.Errorf("commit %d has hunk %d, but there are %d hunks", i+1, id, hunks)
+			}
+
+			if first, ok := owner[id]; ok {
+				return nil, fmt.Errorf("hunk %d is in both commit %d and %d", id, first, i+1)
+			}
+
+			owner[id] = i + 1
+		}
+
+		commit.Message = Clean(commit.Message)
+		commits = append(commits, commit)
+	}
+
+	var missing []string
+
+	for id := 1; id <= hunks; id++ {
+		if _, ok := owner[id]; !ok {
+			missing = append(missing, strconv.Itoa(id))
+		}
+	}
+
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("hunks %s are in no commit", strings.Join(missing, ", "))
+	}
+
+	return commits, nil
+}
+
+// SplitPrompt asks the model to split the hunks in its context into commits
+// of a single concern each, with messages in the style of the repository.
+func SplitPrompt(convention *Convention, subjects []string) string {
+	return "The staged changes in the context are split into numbered hunks. Group them into commits that each " +
+		"make a single, self-contained change, such as a fix, a feature or a refactoring, keeping together the " +
+		"hunks that depend on each other so that every commit builds on its own, and order the commits so each " +
+		"builds on the ones before. Use a single commit if the changes are all part of one concern. " +
+		"Write the message of each commit following these rules: " + style(convention, subjects, "", "") +
+		"\n\nReply with a JSON array only, like [{\"message\": \"...\", \"hunks\": [1, 3]}], putting every hunk " +
+		"in exactly one commit."
+}
@@ -2,6 +2,7 @@ package config
 
 import (
 	"encoding/json"
+	stderrors "errors"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -9,14 +10,28 @@ import (
 
 	"github.com/sashabaranov/go-openai"
 
+	"github.com/emilkje/cwc/pkg/cassette"
 	"github.com/emilkje/cwc/pkg/errors"
 )
 
 const (
 	configFileName        = "cwc.json" // The name of the config file we want to save
 	configFilePermissions = 0o600      // The permissions we want to set on the config file
+	auditLogFileName      = "audit.jsonl"
+	sessionsDirName       = "sessions"
+	replayAPIKey          = "replay"  // Stands in for the API key while a cassette is replayed
+	dryRunAPIKey          = "dry-run" // Stands in for the API key in a dry run
 )
 
+// dryRun is set when requests are printed rather than sent, see SetDryRun.
+var dryRun bool //nolint:gochecknoglobals
+
+// SetDryRun lets the config be loaded without an API key in the keyring, as
+// requests are printed rather than sent.
+func SetDryRun() {
+	dryRun = true
+}
+
 func NewFromConfigFile() (openai.ClientConfig, error) {
 	cfg, err := LoadConfig()
 	if err != nil {
@@ -31,7 +46,33 @@ func NewFromConfigFile() (openai.ClientConfig, error) {
 
 	config := openai.DefaultAzureConfig(cfg.APIKey(), cfg.Endpoint)
 	config.APIVersion = cfg.APIVersion
+	config.HTTPClient = sharedHTTPClient()
+
+	// nothing is sent with the token while replaying or in a dry run
+	if cfg.OAuth != nil && !cassette.Replaying() && !dryRun {
+		client, err := oauthHTTPClient(cfg.OAuth, cfg.APIKey())
+		if err != nil {
+			return openai.ClientConfig{}, err
+		}
+
+		// the client adds the access token, as the bearer of the request
+		config = openai.DefaultAzureConfig("", cfg.Endpoint)
+		config.APIType = openai.APITypeAzureAD
+		config.APIVersion = cfg.APIVersion
+		config.HTTPClient = client
+	}
 	config.AzureModelMapperFunc = func(model string) string {
+		switch model {
+		case string(openai.AdaEmbeddingV2):
+			if cfg.EmbeddingDeployment != "" {
+				return cfg.EmbeddingDeployment
+			}
+		case string(openai.GPT4TurboPreview):
+		default:
+			// a deployment asked for by name, see chat.Parameters.Model
+			return model
+		}
+
 		return cfg.ModelDeployment
 	}
 
@@ -47,10 +88,178 @@ type Config struct {
 	Endpoint        string `json:"endpoint"`
 	APIVersion      string `json:"apiVersion"`
 	ModelDeployment string `json:"modelDeployment"`
+	// OAuth is set when signed in in the browser instead of with an API key.
+	OAuth *OAuthConfig `json:"oauth,omitempty"`
+	// EmbeddingDeployment is the deployment of the embedding model used by cwc index.
+	EmbeddingDeployment string `json:"embeddingDeployment,omitempty"`
+	// Embedding sets a provider for the embedding model other than the chat
+	// provider. It takes precedence over EmbeddingDeployment.
+	Embedding *EmbeddingConfig `json:"embedding,omitempty"`
+	Theme     *ThemeConfig     `json:"theme,omitempty"`
+	// ASCII replaces emoji and other unicode glyphs with plain text labels.
+	ASCII bool `json:"ascii,omitempty"`
+	// Language selects the language of the messages, e.g. "nb". It defaults
+	// to the language of the environment.
+	Language     string              `json:"language,omitempty"`
+	Notification *NotificationConfig `json:"notification,omitempty"`
+	KeyBindings  *KeyBindingsConfig  `json:"keyBindings,omitempty"`
+	// Secrets controls what happens to API keys, tokens and other credentials
+	// found in the context: "redact" (the default) masks them, "block"
+	// withholds the files containing them and "off" sends them unchanged.
+	Secrets string     `json:"secrets,omitempty"`
+	PII     *PIIConfig `json:"pii,omitempty"`
+	// PromptInjection controls what happens to text in the context that looks
+	// written to steer the model, such as instructions to ignore the previous
+	// ones or hidden in HTML comments: "warn" (the default) includes it with
+	// a warning, "neutralize" masks it, "block" withholds the files
+	// containing it and "off" doesn't look for it.
+	PromptInjection string `json:"promptInjection,omitempty"`
+	// AllowedEndpoints lists the endpoints cwc may send code to without asking.
+	// Any other endpoint requires confirmation on every run.
+	AllowedEndpoints []string `json:"allowedEndpoints,omitempty"`
+	// TrustedDirectories lists the directories outside the repository, or
+	// sensitive ones such as the home directory, that files may be gathered
+	// from without asking. Each also covers the directories below it.
+	TrustedDirectories []string `json:"trustedDirectories,omitempty"`
+	// TrustedRepoConfigs maps the root of a repository to the digest of the
+	// .cwc/config.yaml whose commands, such as hooks and formatters, the user
+	// agreed to run. A changed config must be trusted again.
+	TrustedRepoConfigs map[string]string `json:"trustedRepoConfigs,omitempty"`
+	// LocalEndpoints lists the hosts besides loopback addresses that may be
+	// used with --offline, such as a machine on the local network running a model.
+	LocalEndpoints []string     `json:"localEndpoints,omitempty"`
+	Audit          *AuditConfig `json:"audit,omitempty"`
+	// Aliases maps a word to the arguments it stands for, e.g. "review" to
+	// "--diff main -t code-review", see cmd.ExpandAlias.
+	Aliases map[string]string `json:"aliases,omitempty"`
+	// Plugins declares plugins in addition to the cwc-<name> executables on
+	// PATH. Only declared plugins can be offered to the model as tools.
+	Plugins []PluginConfig `json:"plugins,omitempty"`
+	// Sandbox restricts the commands run on behalf of the model, such as
+	// /shell and tool plugins. The sandbox settings of a repository can only
+	// make it stricter.
+	Sandbox *SandboxConfig `json:"sandbox,omitempty"`
+	// StripNotebookOutputs leaves the outputs of cells out when Jupyter
+	// notebooks are included in the context.
+	StripNotebookOutputs bool `json:"stripNotebookOutputs,omitempty"`
+	// DataSample controls which data files are included as a sample of their
+	// rows rather than whole.
+	DataSample *DataSampleConfig `json:"dataSample,omitempty"`
+	// RepoMap includes an overview of the repository in the context, see
+	// cwc map.
+	RepoMap bool `json:"repoMap,omitempty"`
+	// ShowStats prints the token usage, cost and latency after each response.
+	ShowStats bool          `json:"showStats,omitempty"`
+	Rerank    *RerankConfig `json:"rerank,omitempty"`
+	// Stop lists sequences at which the model stops generating, unless
+	// --stop is given.
+	Stop []string `json:"stop,omitempty"`
+	// EditFormat is how the model is asked to write edits to files: "diff"
+	// (the default) for unified diffs or "search-replace" for blocks of the
+	// lines to replace and their replacement. EditFormats sets it per model,
+	// or on Azure per deployment, taking precedence.
+	EditFormat  string            `json:"editFormat,omitempty"`
+	EditFormats map[string]string `json:"editFormats,omitempty"`
+	Sessions    *SessionsConfig   `json:"sessions,omitempty"`
+	Telemetry   *TelemetryConfig  `json:"telemetry,omitempty"`
 	// Keep APIKey unexported to avoid accidental exposure
 	apiKey string
 }
 
+// ThemeConfig customizes the colors and glyphs used in the terminal. Name
+// selects one of the built-in themes, the remaining fields override
+// individual parts of it. Colors may be names ("red", "bright-blue"),
+// 256-color palette indices ("208") or hex codes ("#268bd2").
+type ThemeConfig struct {
+	Name           string `json:"name,omitempty"`
+	Info           string `json:"info,omitempty"`
+	Warning        string `json:"warning,omitempty"`
+	Error          string `json:"error,omitempty"`
+	Notice         string `json:"notice,omitempty"`
+	Success        string `json:"success,omitempty"`
+	UserGlyph      string `json:"userGlyph,omitempty"`
+	AssistantGlyph string `json:"assistantGlyph,omitempty"`
+	CodeStyle      string `json:"codeStyle,omitempty"`
+}
+
+// NotificationConfig enables a notification when a response takes longer
+// than After, a duration such as "30s", to complete. Method is either "bell"
+// for the terminal bell or "desktop" for an operating system notification.
+type NotificationConfig struct {
+	After  string `json:"after,omitempty"`
+	Method string `json:"method,omitempty"`
+}
+
+// KeyBindingsConfig remaps the keys of the chat prompt and the full-screen
+// interface. Preset selects the "emacs" (the default) or "vi" bindings, the
+// remaining fields replace the keys of individual actions, e.g.
+// {"submit": ["ctrl+s"]}.
+type KeyBindingsConfig struct {
+	Preset     string   `json:"preset,omitempty"`
+	Submit     []string `json:"submit,omitempty"`
+	Newline    []string `json:"newline,omitempty"`
+	Cancel     []string `json:"cancel,omitempty"`
+	ScrollUp   []string `json:"scrollUp,omitempty"`
+	ScrollDown []string `json:"scrollDown,omitempty"`
+	Editor     []string `json:"editor,omitempty"`
+	Sidebar    []string `json:"sidebar,omitempty"`
+}
+
+// PIIConfig enables masking of personal data such as email addresses, phone
+// numbers and national identity numbers in the context and in prompts.
+// Patterns adds custom regular expressions by name, e.g. an internal
+// customer number format.
+type PIIConfig struct {
+	Enabled  bool              `json:"enabled,omitempty"`
+	Patterns map[string]string `json:"patterns,omitempty"`
+}
+
+// DataSampleConfig sets the size above which CSV, TSV, JSON and JSON Lines
+// files are sampled, and how many rows are taken from their start and end.
+// Parquet files are always sampled.
+type DataSampleConfig struct {
+	ThresholdBytes int64 `json:"thresholdBytes,omitempty"`
+	Rows           int   `json:"rows,omitempty"`
+}
+
+// AuditConfig enables an append-only log of every request sent to the
+// provider. Path defaults to audit.jsonl next to the config file. Only a
+// hash of each request is recorded unless FullContent is set.
+type AuditConfig struct {
+	Enabled     bool   `json:"enabled,omitempty"`
+	Path        string `json:"path,omitempty"`
+	FullContent bool   `json:"fullContent,omitempty"`
+	// Encrypt encrypts the request bodies recorded with FullContent with
+	// the key in the keyring, see EncryptionKey.
+	Encrypt bool `json:"encrypt,omitempty"`
+}
+
+// RerankConfig reorders the chunks retrieved with --rag by a closer reading
+// before the best are kept. Method is "llm", which asks the chat model to
+// rate them, "cross-encoder", which sends them to the rerank endpoint at
+// Endpoint serving Model in the format of Cohere, or "off" (the default). The
+// API key of the endpoint, if it needs one, is read from the environment
+// variable named by APIKeyEnv.
+type RerankConfig struct {
+	Method    string `json:"method,omitempty"`
+	Endpoint  string `json:"endpoint,omitempty"`
+	Model     string `json:"model,omitempty"`
+	APIKeyEnv string `json:"apiKeyEnv,omitempty"`
+}
+
+// PluginConfig declares a plugin. Path defaults to cwc-<name> on PATH, and
+// Tool offers the plugin to the model as a tool it may call while answering.
+// Tools run in the sandbox, where Network allows the tool to use the network
+// and Env lists the environment variables passed on to it, such as the token
+// of an API it calls.
+type PluginConfig struct {
+	Name    string   `json:"name"`
+	Path    string   `json:"path,omitempty"`
+	Tool    bool     `json:"tool,omitempty"`
+	Network bool     `json:"network,omitempty"`
+	Env     []string `json:"env,omitempty"`
+}
+
 // NewConfig creates a new Config object.
 func NewConfig(endpoint, apiVersion, modelDeployment string) *Config {
 	return &Config{
@@ -106,22 +315,26 @@ func SaveConfig(config *Config) error {
 		return err
 	}
 
-	configDir, err := xdgConfigPath()
+	err = storeAPIKeyInKeyring(config.APIKey())
+
 	if err != nil {
 		return err
 	}
 
-	configFilePath := filepath.Join(configDir, configFileName)
+	return writeConfigFile(config)
+}
 
-	data, err := json.Marshal(config)
+func writeConfigFile(config *Config) error {
+	configDir, err := xdgConfigPath()
 	if err != nil {
-		return fmt.Errorf("error marshalling config data: %w", err)
+		return err
 	}
 
-	err = storeAPIKeyInKeyring(config.APIKey())
+	configFilePath := filepath.Join(configDir, configFileName)
 
+	data, err := json.Marshal(config)
 	if err != nil {
-		return err
+		return fmt.Errorf("error marshalling config data: %w", err)
 	}
 
 	err = os.WriteFile(configFilePath, data, configFilePermissions)
@@ -134,7 +347,46 @@ func SaveConfig(config *Config) error {
 
 // LoadConfig reads the configuration from disk and loads the API key from the keyring.
 func LoadConfig() (*Config, error) {
-	// Read data from file or secure store
+	cfg, err := readConfigFile()
+	if err != nil {
+		return nil, err
+	}
+
+	apiKey, err := getAPIKeyFromKeyring()
+	if err != nil {
+		// a replayed cassette needs no key, e.g. in CI without a keyring, and
+		// neither does a dry run
+		switch {
+		case cassette.Replaying():
+			apiKey = replayAPIKey
+		case dryRun:
+			apiKey = dryRunAPIKey
+		default:
+			return nil, err
+		}
+	}
+
+	cfg.SetAPIKey(apiKey)
+
+	return cfg, nil
+}
+
+// LoadConfigOrDefault reads the configuration from disk without touching the
+// keyring. An empty configuration is returned if no configuration file exists yet.
+func LoadConfigOrDefault() (*Config, error) {
+	cfg, err := readConfigFile()
+	if err != nil {
+		if stderrors.Is(err, os.ErrNotExist) {
+			return NewConfig("", "", ""), nil
+		}
+
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+func readConfigFile() (*Config, error) {
 	configDir, err := xdgConfigPath()
 	if err != nil {
 		return nil, err
@@ -152,13 +404,6 @@ func LoadConfig() (*Config, error) {
 		return nil, fmt.Errorf("error unmarshalling config data: %w", err)
 	}
 
-	apiKey, err := getAPIKeyFromKeyring()
-	if err != nil {
-		return nil, err
-	}
-
-	cfg.SetAPIKey(apiKey)
-
 	return &cfg, nil
 }
 
@@ -180,5 +425,53 @@ func ClearConfig() error {
 		return err
 	}
 
-	return nil
+	return clearEmbeddingAPIKeyInKeyring()
+}
+
+// SessionsConfig controls the history of chat sessions, see cwc sessions.
+type SessionsConfig struct {
+	// Disabled stops sessions from being saved.
+	Disabled bool `json:"disabled,omitempty"`
+	// Encrypt encrypts the saved sessions with the key in the keyring, see
+	// EncryptionKey.
+	Encrypt bool `json:"encrypt,omitempty"`
+	// TitleModel is a cheap model, or on Azure a deployment, that names
+	// each session after its first exchange. Without it, sessions are
+	// named after the first words of their first prompt.
+	TitleModel string `json:"titleModel,omitempty"`
+}
+
+// TelemetryConfig exports traces of where the time of each run goes to an
+// OpenTelemetry collector. Endpoint is the base URL of its OTLP/HTTP
+// receiver, e.g. http://localhost:4318, and Headers are sent with every
+// export. Both default to the standard OTEL_EXPORTER_OTLP_* environment
+// variables.
+type TelemetryConfig struct {
+	Endpoint    string            `json:"endpoint,omitempty"`
+	Headers     map[string]string `json:"headers,omitempty"`
+	ServiceName string            `json:"serviceName,omitempty"`
+}
+
+// SessionsDir returns the directory the chat sessions are saved in.
+func SessionsDir() (string, error) {
+	configDir, err := xdgConfigPath()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(configDir, sessionsDirName), nil
+}
+
+// LogPath returns the path of the audit log.
+func (a *AuditConfig) LogPath() (string, error) {
+	if a.Path != "" {
+		return a.Path, nil
+	}
+
+	configDir, err := xdgConfigPath()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(configDir, auditLogFileName), nil
 }
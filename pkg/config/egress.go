@@ -0,0 +1,122 @@
+package config
+
+import (
+	"encoding/json"
+	stderrors "errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+const confirmedEndpointsFileName = "endpoints.json" // The endpoints the user agreed to send data to
+
+// EndpointOrigin returns the scheme and host of endpoint, e.g.
+// "https://myorg.openai.azure.com", which is what allow-list entries and
+// confirmations are matched against.
+func EndpointOrigin(endpoint string) (string, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "", fmt.Errorf("error parsing endpoint: %w", err)
+	}
+
+	if u.Scheme == "" || u.Host == "" {
+		return "", fmt.Errorf("endpoint %q must be an absolute URL such as https://myorg.openai.azure.com", endpoint)
+	}
+
+	return strings.ToLower(u.Scheme + "://" + u.Host), nil
+}
+
+// EndpointAllowed reports whether the origin matches an entry of
+// AllowedEndpoints. Entries are either origins or host names, optionally
+// with a leading wildcard such as "*.openai.azure.com", which only match
+// https endpoints.
+func (c *Config) EndpointAllowed(origin string) bool {
+	host, secure := strings.CutPrefix(origin, "https://")
+
+	for _, entry := range c.AllowedEndpoints {
+		entry = strings.ToLower(strings.TrimSuffix(strings.TrimSpace(entry), "/"))
+
+		switch {
+		case strings.Contains(entry, "://"):
+			if entry == origin {
+				return true
+			}
+		case !secure:
+			continue
+		case strings.HasPrefix(entry, "*."):
+			if strings.HasSuffix(host, entry[1:]) {
+				return true
+			}
+		case entry == host:
+			return true
+		}
+	}
+
+	return false
+}
+
+// EndpointConfirmed reports whether the user has agreed to send data to the
+// origin before.
+func EndpointConfirmed(origin string) (bool, error) {
+	confirmed, err := readConfirmedEndpoints()
+	if err != nil {
+		return false, err
+	}
+
+	return slices.Contains(confirmed, origin), nil
+}
+
+// ConfirmEndpoint remembers that the user agreed to send data to the origin.
+func ConfirmEndpoint(origin string) error {
+	confirmed, err := readConfirmedEndpoints()
+	if err != nil {
+		return err
+	}
+
+	if slices.Contains(confirmed, origin) {
+		return nil
+	}
+
+	configDir, err := xdgConfigPath()
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(append(confirmed, origin))
+	if err != nil {
+		return fmt.Errorf("error marshalling confirmed endpoints: %w", err)
+	}
+
+	err = os.WriteFile(filepath.Join(configDir, confirmedEndpointsFileName), data, configFilePermissions)
+	if err != nil {
+		return fmt.Errorf("error writing confirmed endpoints: %w", err)
+	}
+
+	return nil
+}
+
+func readConfirmedEndpoints() ([]string, error) {
+	configDir, err := xdgConfigPath()
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(filepath.Join(configDir, confirmedEndpointsFileName))
+	if err != nil {
+		if stderrors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+
+		return nil, fmt.Errorf("error reading confirmed endpoints: %w", err)
+	}
+
+	var confirmed []string
+	if err := json.Unmarshal(data, &confirmed); err != nil {
+		return nil, fmt.Errorf("error unmarshalling confirmed endpoints: %w", err)
+	}
+
+	return confirmed, nil
+}
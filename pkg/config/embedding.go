@@ -0,0 +1,144 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/sashabaranov/go-openai"
+
+	"github.com/emilkje/cwc/pkg/errors"
+)
+
+// The providers of embedding models.
+const (
+	EmbeddingProviderAzure  = "azure"
+	EmbeddingProviderOpenAI = "openai"
+	EmbeddingProviderOllama = "ollama"
+)
+
+// defaultOllamaEndpoint is the OpenAI compatible API of a local Ollama server.
+const defaultOllamaEndpoint = "http://localhost:11434/v1"
+
+// EmbeddingConfig sets the provider of the embedding model used by cwc index
+// apart from the chat provider, e.g. a local Ollama server while chatting
+// with Azure OpenAI. Provider is "azure", "openai" or "ollama". Endpoint is
+// the base URL of the API, APIVersion is required by Azure, and Model is the
+// embedding model or, on Azure, its deployment. The API key, if the provider
+// needs one, is kept in the keyring apart from the chat API key.
+type EmbeddingConfig struct {
+	Provider   string `json:"provider"`
+	Endpoint   string `json:"endpoint,omitempty"`
+	APIVersion string `json:"apiVersion,omitempty"`
+	Model      string `json:"model"`
+}
+
+// NewEmbeddingClientConfig returns the client configuration and model used
+// to create embeddings. Without an embedding section in the config file, the
+// chat endpoint is used with the deployment in embeddingDeployment.
+func NewEmbeddingClientConfig() (openai.ClientConfig, string, error) {
+	cfg, err := readConfigFile()
+	if err != nil {
+		return openai.ClientConfig{}, "", err
+	}
+
+	if cfg.Embedding == nil {
+		clientConfig, err := NewFromConfigFile()
+		return clientConfig, string(openai.AdaEmbeddingV2), err
+	}
+
+	embedding := cfg.Embedding
+
+	if err := ValidateEmbeddingConfig(embedding); err != nil {
+		return openai.ClientConfig{}, "", err
+	}
+
+	apiKey, err := getEmbeddingAPIKeyFromKeyring()
+	if err != nil {
+		return openai.ClientConfig{}, "", err
+	}
+
+	var clientConfig openai.ClientConfig
+
+	switch embedding.Provider {
+	case EmbeddingProviderAzure:
+		clientConfig = openai.DefaultAzureConfig(apiKey, embedding.Endpoint)
+		clientConfig.APIVersion = embedding.APIVersion
+		clientConfig.AzureModelMapperFunc = func(model string) string {
+			return model // the model is the name of the deployment
+		}
+	case EmbeddingProviderOpenAI:
+		clientConfig = openai.DefaultConfig(apiKey)
+		if embedding.Endpoint != "" {
+			clientConfig.BaseURL = strings.TrimRight(embedding.Endpoint, "/")
+		}
+	case EmbeddingProviderOllama:
+		clientConfig = openai.DefaultConfig(apiKey)
+		clientConfig.BaseURL = defaultOllamaEndpoint
+
+		if embedding.Endpoint != "" {
+			clientConfig.BaseURL = strings.TrimRight(embedding.Endpoint, "/")
+		}
+	}
+
+	clientConfig.HTTPClient = sharedHTTPClient()
+
+	return clientConfig, embedding.Model, nil
+}
+
+// ValidateEmbeddingConfig checks if an EmbeddingConfig has what its provider
+// needs.
+func ValidateEmbeddingConfig(cfg *EmbeddingConfig) error {
+	var validationErrors []string
+
+	switch cfg.Provider {
+	case EmbeddingProviderAzure:
+		if cfg.Endpoint == "" {
+			validationErrors = append(validationErrors, "embedding.endpoint must be provided for azure")
+		}
+
+		if cfg.APIVersion == "" {
+			validationErrors = append(validationErrors, "embedding.apiVersion must be provided for azure")
+		}
+	case EmbeddingProviderOpenAI, EmbeddingProviderOllama:
+	default:
+		validationErrors = append(validationErrors, fmt.Sprintf("embedding.provider must be %q, %q or %q",
+			EmbeddingProviderAzure, EmbeddingProviderOpenAI, EmbeddingProviderOllama))
+	}
+
+	if cfg.Model == "" {
+		validationErrors = append(validationErrors, "embedding.model must be provided and not be empty")
+	}
+
+	if len(validationErrors) > 0 {
+		return &errors.ConfigValidationError{Errors: validationErrors}
+	}
+
+	return nil
+}
+
+// SaveEmbeddingConfig sets the embedding section of the config file, and
+// stores the API key in the keyring, or removes it if apiKey is empty.
+func SaveEmbeddingConfig(embedding *EmbeddingConfig, apiKey string) error {
+	if err := ValidateEmbeddingConfig(embedding); err != nil {
+		return err
+	}
+
+	cfg, err := LoadConfigOrDefault()
+	if err != nil {
+		return err
+	}
+
+	cfg.Embedding = embedding
+
+	if apiKey == "" {
+		err = clearEmbeddingAPIKeyInKeyring()
+	} else {
+		err = storeEmbeddingAPIKeyInKeyring(apiKey)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return writeConfigFile(cfg)
+}
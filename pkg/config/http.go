@@ -0,0 +1,86 @@
+package config
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/emilkje/cwc/pkg/audit"
+	"github.com/emilkje/cwc/pkg/cassette"
+	"github.com/emilkje/cwc/pkg/metrics"
+	"github.com/emilkje/cwc/pkg/telemetry"
+)
+
+const (
+	dialTimeout         = 10 * time.Second
+	keepAliveInterval   = 30 * time.Second
+	tlsHandshakeTimeout = 10 * time.Second
+	idleConnTimeout     = 90 * time.Second
+	maxIdleConns        = 10
+)
+
+// sharedHTTPClient is used for every request to the API, so that the
+// connection, and with it the TLS session and any proxy tunnel, is reused
+// across the turns of a chat instead of being set up again for each one.
+var sharedHTTPClient = sync.OnceValue(newHTTPClient) //nolint:gochecknoglobals
+
+// HTTPClient returns the client used for requests to the API, for other
+// services cwc talks to, such as a shared index server, to go through the
+// same proxy, offline, audit, cassette, metrics and tracing handling.
+func HTTPClient() *http.Client {
+	return sharedHTTPClient()
+}
+
+func newHTTPClient() *http.Client {
+	dialer := &net.Dialer{
+		Timeout:   dialTimeout,
+		KeepAlive: keepAliveInterval,
+	}
+
+	transport := &http.Transport{
+		Proxy:               proxy,
+		DialContext:         guardedDial(dialer),
+		ForceAttemptHTTP2:   true,
+		TLSHandshakeTimeout: tlsHandshakeTimeout,
+		IdleConnTimeout:     idleConnTimeout,
+		MaxIdleConns:        maxIdleConns,
+		MaxIdleConnsPerHost: maxIdleConns,
+		// responses are streamed for as long as the model generates, so
+		// there is deliberately no overall or response header timeout
+		ExpectContinueTimeout: time.Second,
+	}
+
+	return &http.Client{
+		Transport: telemetry.Transport(metrics.Transport(audit.Transport(cassette.Transport(transport)))),
+	}
+}
+
+// proxy uses the proxy from the environment, unless in offline mode where
+// connections must go straight to the local host.
+func proxy(req *http.Request) (*url.URL, error) {
+	if Offline() {
+		return nil, nil //nolint:nilnil
+	}
+
+	return http.ProxyFromEnvironment(req) //nolint:wrapcheck
+}
+
+// guardedDial refuses connections to remote hosts in offline mode, so that
+// nothing can reach the network regardless of how the request was built.
+func guardedDial(dialer *net.Dialer) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			host = addr
+		}
+
+		if err := checkOfflineHost(host); err != nil {
+			return nil, err
+		}
+
+		return dialer.DialContext(ctx, network, addr) //nolint:wrapcheck
+	}
+}
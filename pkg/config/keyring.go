@@ -1,10 +1,14 @@
 package config
 
 import (
+	"encoding/hex"
+	stderrors "errors"
 	"fmt"
 	"os/user"
 
 	"github.com/zalando/go-keyring"
+
+	"github.com/emilkje/cwc/pkg/encryption"
 )
 
 func getAPIKeyFromKeyring() (string, error) {
@@ -52,3 +56,106 @@ func clearAPIKeyInKeyring() error {
 
 	return nil
 }
+
+// embeddingAccount is the keyring account of the API key of the embedding
+// provider, kept apart from the chat API key.
+func embeddingAccount() (string, error) {
+	usr, err := user.Current()
+	if err != nil {
+		return "", fmt.Errorf("error getting current user: %w", err)
+	}
+
+	return usr.Username + "/embedding", nil
+}
+
+// getEmbeddingAPIKeyFromKeyring returns the API key of the embedding
+// provider, or an empty string if none is stored, as for a local server.
+func getEmbeddingAPIKeyFromKeyring() (string, error) {
+	account, err := embeddingAccount()
+	if err != nil {
+		return "", err
+	}
+
+	apiKey, err := keyring.Get(serviceName, account)
+	if err != nil {
+		if stderrors.Is(err, keyring.ErrNotFound) {
+			return "", nil
+		}
+
+		return "", fmt.Errorf("error getting embedding API key from keyring: %w", err)
+	}
+
+	return apiKey, nil
+}
+
+func storeEmbeddingAPIKeyInKeyring(apiKey string) error {
+	account, err := embeddingAccount()
+	if err != nil {
+		return err
+	}
+
+	if err := keyring.Set(serviceName, account, apiKey); err != nil {
+		return fmt.Errorf("error storing embedding API key in keyring: %w", err)
+	}
+
+	return nil
+}
+
+func clearEmbeddingAPIKeyInKeyring() error {
+	account, err := embeddingAccount()
+	if err != nil {
+		return err
+	}
+
+	if err := keyring.Delete(serviceName, account); err != nil && !stderrors.Is(err, keyring.ErrNotFound) {
+		return fmt.Errorf("error deleting embedding API key from keyring: %w", err)
+	}
+
+	return nil
+}
+
+// encryptionAccount is the keyring account of the key encrypting the saved
+// sessions and the audit log.
+func encryptionAccount() (string, error) {
+	usr, err := user.Current()
+	if err != nil {
+		return "", fmt.Errorf("error getting current user: %w", err)
+	}
+
+	return usr.Username + "/encryption", nil
+}
+
+// EncryptionKey returns the key encrypting the data cwc keeps on disk, which
+// is created and stored in the keyring the first time it is needed. Losing
+// the key, e.g. by clearing the keyring, makes the encrypted data unreadable.
+func EncryptionKey() ([]byte, error) {
+	account, err := encryptionAccount()
+	if err != nil {
+		return nil, err
+	}
+
+	encoded, err := keyring.Get(serviceName, account)
+	if err == nil {
+		key, err := hex.DecodeString(encoded)
+		if err != nil || len(key) != encryption.KeySize {
+			return nil, stderrors.New("the encryption key in the keyring is invalid")
+		}
+
+		return key, nil
+	}
+
+	if !stderrors.Is(err, keyring.ErrNotFound) {
+		return nil, fmt.Errorf("error getting encryption key from keyring: %w", err)
+	}
+
+	key, err := encryption.NewKey()
+	if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+
+	if err := keyring.Set(serviceName, account, hex.EncodeToString(key)); err != nil {
+		return nil, fmt.Errorf("error storing encryption key in keyring: %w", err)
+	}
+
+	return key, nil
+}
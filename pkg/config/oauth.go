@@ -0,0 +1,46 @@
+package config
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/emilkje/cwc/pkg/oauth"
+)
+
+// OAuthConfig is set by cwc login --browser, which signs in with Microsoft
+// Entra ID instead of using an API key. Tenant is the directory signed in to
+// and ClientID the application signing in, defaulting to any work or school
+// account and the Azure CLI. The tokens are kept in the keyring in place of
+// the API key.
+type OAuthConfig struct {
+	Tenant   string `json:"tenant,omitempty"`
+	ClientID string `json:"clientId,omitempty"`
+}
+
+// Endpoint returns the authorization server signed in to.
+func (o *OAuthConfig) Endpoint() oauth.Endpoint {
+	return oauth.EntraID(o.Tenant, o.ClientID)
+}
+
+// oauthHTTPClient returns the shared client with the access token of the
+// saved sign-in added to each request. The token is renewed, and the renewed
+// token saved, when it is about to expire.
+func oauthHTTPClient(settings *OAuthConfig, saved string) (*http.Client, error) {
+	token, err := oauth.ParseToken(saved)
+	if err != nil {
+		return nil, fmt.Errorf("the sign-in in the keyring is invalid, run 'cwc login --browser': %w", err)
+	}
+
+	shared := sharedHTTPClient()
+
+	source := oauth.NewTokenSource(shared, settings.Endpoint(), token, func(renewed *oauth.Token) {
+		// the old token is renewed again next time, as long as its refresh
+		// token is valid
+		_ = storeAPIKeyInKeyring(renewed.Encode())
+	})
+
+	client := *shared
+	client.Transport = &oauth.Transport{Base: shared.Transport, Source: source}
+
+	return &client, nil
+}
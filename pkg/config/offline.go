@@ -0,0 +1,85 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/emilkje/cwc/pkg/errors"
+)
+
+// offline restricts all connections made through the shared HTTP client to
+// local hosts once enabled.
+var offline struct { //nolint:gochecknoglobals
+	sync.Mutex
+	enabled bool
+	hosts   []string
+}
+
+// SetOffline enables offline mode, in which only loopback addresses and the
+// given hosts, such as a machine running Ollama or LM Studio on the local
+// network, may be connected to. Proxies are bypassed.
+func SetOffline(localHosts []string) {
+	offline.Lock()
+	defer offline.Unlock()
+
+	offline.enabled = true
+	offline.hosts = nil
+
+	for _, host := range localHosts {
+		// accept URLs as well as bare host names
+		if u, err := url.Parse(host); err == nil && u.Host != "" {
+			host = u.Hostname()
+		}
+
+		offline.hosts = append(offline.hosts, strings.ToLower(host))
+	}
+}
+
+// Offline reports whether offline mode is enabled.
+func Offline() bool {
+	offline.Lock()
+	defer offline.Unlock()
+
+	return offline.enabled
+}
+
+// CheckOffline fails fast if offline mode is enabled and endpoint is not
+// local, before anything is gathered or sent.
+func CheckOffline(endpoint string) error {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return fmt.Errorf("error parsing endpoint: %w", err)
+	}
+
+	return checkOfflineHost(u.Hostname())
+}
+
+func checkOfflineHost(host string) error {
+	offline.Lock()
+	defer offline.Unlock()
+
+	if !offline.enabled {
+		return nil
+	}
+
+	host = strings.ToLower(host)
+
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return nil
+	}
+
+	if ip := net.ParseIP(host); ip != nil && ip.IsLoopback() {
+		return nil
+	}
+
+	for _, allowed := range offline.hosts {
+		if host == allowed {
+			return nil
+		}
+	}
+
+	return errors.OfflineError{Host: host}
+}
@@ -0,0 +1,154 @@
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	stderrors "errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"gopkg.in/yaml.v3"
+)
+
+// RepoConfigPath is the location of the repository configuration relative to
+// the repository root. Unlike cwc.json it holds no credentials, so it can be
+// committed and shared by everyone working on the repository.
+const RepoConfigPath = ".cwc/config.yaml"
+
+// RepoConfig holds the settings that belong to a repository rather than to
+// a user.
+type RepoConfig struct {
+	Sandbox *SandboxConfig `yaml:"sandbox,omitempty"`
+	Hooks   *HooksConfig   `yaml:"hooks,omitempty"`
+	Index   *IndexConfig   `yaml:"index,omitempty"`
+	// Formatters maps a language, e.g. "go" or "ts", to the command that
+	// formats the files cwc writes in it, replacing the default formatter.
+	// An empty command leaves the files of the language as they are written.
+	Formatters map[string]string `yaml:"formatters,omitempty"`
+	Verify     *VerifyConfig     `yaml:"verify,omitempty"`
+
+	digest string
+}
+
+// Digest identifies the content of the configuration file, so that trusting
+// its commands only lasts until they change. It is empty if there is none.
+func (r *RepoConfig) Digest() string {
+	return r.digest
+}
+
+// Commands describes the shell commands the configuration runs: the hooks,
+// the formatters and the verify command.
+func (r *RepoConfig) Commands() []string {
+	var commands []string
+
+	if r.Hooks != nil {
+		for _, hook := range r.Hooks.PreContext {
+			commands = append(commands, "preContext hook: "+hook)
+		}
+
+		for _, hook := range r.Hooks.PreSend {
+			commands = append(commands, "preSend hook: "+hook)
+		}
+
+		for _, hook := range r.Hooks.PostResponse {
+			commands = append(commands, "postResponse hook: "+hook)
+		}
+	}
+
+	languages := make([]string, 0, len(r.Formatters))
+	for language, command := range r.Formatters {
+		if command != "" {
+			languages = append(languages, language)
+		}
+	}
+
+	sort.Strings(languages)
+
+	for _, language := range languages {
+		commands = append(commands, language+" formatter: "+r.Formatters[language])
+	}
+
+	if r.Verify != nil && r.Verify.Command != "" {
+		commands = append(commands, "verify: "+r.Verify.Command)
+	}
+
+	return commands
+}
+
+// VerifyConfig is the shell command run after edits are applied, such as
+// "go build ./...", unless --verify gives another. When it fails, its output
+// is sent to the model for a fix, at most Attempts times (3 by default).
+// Timeout is a duration such as "5m" and applies to each run.
+type VerifyConfig struct {
+	Command  string `yaml:"command,omitempty"`
+	Attempts int    `yaml:"attempts,omitempty"`
+	Timeout  string `yaml:"timeout,omitempty"`
+}
+
+// SandboxConfig restricts the commands run on behalf of the model. It is
+// read from the config file and from .cwc/config.yaml, which may only make
+// it stricter, see sandbox.New. Mode is
+// "restricted" (the default), which runs allow-listed binaries directly with
+// limits, "container", which runs them in Image with Runtime (docker by
+// default), or "off". WorkDir is "temp" (the default) for an empty temporary
+// directory or "repo" for the repository root. Timeout is a duration such as
+// "30s" and MemoryMB limits the address space of the command.
+type SandboxConfig struct {
+	Mode     string   `json:"mode,omitempty"     yaml:"mode,omitempty"`
+	Allow    []string `json:"allow,omitempty"    yaml:"allow,omitempty"`
+	Network  bool     `json:"network,omitempty"  yaml:"network,omitempty"`
+	WorkDir  string   `json:"workdir,omitempty"  yaml:"workdir,omitempty"`
+	Timeout  string   `json:"timeout,omitempty"  yaml:"timeout,omitempty"`
+	MemoryMB int      `json:"memoryMB,omitempty" yaml:"memoryMB,omitempty"`
+	Image    string   `json:"image,omitempty"    yaml:"image,omitempty"`
+	Runtime  string   `json:"runtime,omitempty"  yaml:"runtime,omitempty"`
+}
+
+// HooksConfig lists the shell commands run at points of a chat. PreContext
+// hooks run once the files are gathered, PreSend hooks before each message is
+// sent and PostResponse hooks after each response. Timeout is a duration
+// such as "30s" and applies to each command.
+type HooksConfig struct {
+	PreContext   []string `yaml:"preContext,omitempty"`
+	PreSend      []string `yaml:"preSend,omitempty"`
+	PostResponse []string `yaml:"postResponse,omitempty"`
+	Timeout      string   `yaml:"timeout,omitempty"`
+}
+
+// IndexConfig selects where cwc index keeps the embeddings. Backend is
+// "local" (the default), which keeps them in .cwc/index.json, or "qdrant",
+// which keeps them in Collection on the Qdrant server at URL so that a team
+// can share one index. Collection defaults to the name of the repository
+// directory. The API key of the server, if it needs one, is read from the
+// environment variable named by APIKeyEnv.
+type IndexConfig struct {
+	Backend    string `yaml:"backend,omitempty"`
+	URL        string `yaml:"url,omitempty"`
+	Collection string `yaml:"collection,omitempty"`
+	APIKeyEnv  string `yaml:"apiKeyEnv,omitempty"`
+}
+
+// LoadRepoConfig reads the repository configuration of the repository at
+// root. An empty configuration is returned if the repository has none.
+func LoadRepoConfig(root string) (*RepoConfig, error) {
+	data, err := os.ReadFile(filepath.Join(root, RepoConfigPath)) // #nosec
+	if err != nil {
+		if stderrors.Is(err, os.ErrNotExist) {
+			return &RepoConfig{}, nil
+		}
+
+		return nil, fmt.Errorf("error reading repository config: %w", err)
+	}
+
+	var cfg RepoConfig
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("error parsing %s: %w", RepoConfigPath, err)
+	}
+
+	sum := sha256.Sum256(data)
+	cfg.digest = hex.EncodeToString(sum[:])
+
+	return &cfg, nil
+}
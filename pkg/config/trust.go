@@ -0,0 +1,91 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// TrustedDirectory returns the entry of TrustedDirectories that dir is, or
+// is below, and whether there is one. Entries are absolute paths, or paths
+// starting with ~/ for the home directory.
+func (c *Config) TrustedDirectory(dir string) (string, bool) {
+	dir = filepath.Clean(dir)
+
+	for _, entry := range c.TrustedDirectories {
+		entry = expandHome(strings.TrimSpace(entry))
+		if !filepath.IsAbs(entry) {
+			continue
+		}
+
+		entry = filepath.Clean(entry)
+
+		if IsWithin(dir, entry) {
+			return entry, true
+		}
+	}
+
+	return "", false
+}
+
+// TrustDirectory remembers in the config file that the user trusts cwc to
+// gather files from dir and the directories below it.
+func TrustDirectory(dir string) error {
+	cfg, err := LoadConfigOrDefault()
+	if err != nil {
+		return err
+	}
+
+	if entry, ok := cfg.TrustedDirectory(dir); ok && entry == filepath.Clean(dir) {
+		return nil
+	}
+
+	cfg.TrustedDirectories = append(cfg.TrustedDirectories, filepath.Clean(dir))
+
+	return writeConfigFile(cfg)
+}
+
+// RepoConfigTrusted reports whether the user agreed to run the commands of
+// the repository configuration at root, as it is now.
+func (c *Config) RepoConfigTrusted(root, digest string) bool {
+	return digest != "" && c.TrustedRepoConfigs[filepath.Clean(root)] == digest
+}
+
+// TrustRepoConfig remembers in the config file that the user agreed to run
+// the commands of the repository configuration at root with the digest.
+func TrustRepoConfig(root, digest string) error {
+	cfg, err := LoadConfigOrDefault()
+	if err != nil {
+		return err
+	}
+
+	if cfg.TrustedRepoConfigs == nil {
+		cfg.TrustedRepoConfigs = make(map[string]string)
+	}
+
+	cfg.TrustedRepoConfigs[filepath.Clean(root)] = digest
+
+	return writeConfigFile(cfg)
+}
+
+// IsWithin reports whether path is dir or below it, for absolute, cleaned
+// paths.
+func IsWithin(path, dir string) bool {
+	rel, err := filepath.Rel(dir, path)
+
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+func expandHome(path string) string {
+	rest, ok := strings.CutPrefix(path, "~"+string(filepath.Separator))
+	if !ok {
+		return path
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+
+	return filepath.Join(home, rest)
+}
@@ -0,0 +1,322 @@
+package config
+
+import (
+	_ "embed"
+	"encoding/json"
+	stderrors "errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// UserConfigSchema is the JSON Schema of cwc.json.
+//
+//go:embed schema/cwc.schema.json
+var UserConfigSchema []byte //nolint:gochecknoglobals
+
+// RepoConfigSchema is the JSON Schema of .cwc/config.yaml.
+//
+//go:embed schema/repo.schema.json
+var RepoConfigSchema []byte //nolint:gochecknoglobals
+
+// yamlErrorLine finds the line in the syntax errors of the YAML parser.
+var yamlErrorLine = regexp.MustCompile(`line (\d+)`) //nolint:gochecknoglobals
+
+// Problem is something wrong with a configuration file, at a 1-based line
+// and column.
+type Problem struct {
+	Line    int
+	Column  int
+	Message string
+}
+
+func (p Problem) String() string {
+	return fmt.Sprintf("%d:%d: %s", p.Line, p.Column, p.Message)
+}
+
+// schema is the subset of JSON Schema the configuration schemas use.
+type schema struct {
+	Type                 string             `json:"type"`
+	Description          string             `json:"description"`
+	Properties           map[string]*schema `json:"properties"`
+	AdditionalProperties json.RawMessage    `json:"additionalProperties"`
+	Required             []string           `json:"required"`
+	Items                *schema            `json:"items"`
+	Enum                 []string           `json:"enum"`
+	Deprecated           bool               `json:"deprecated"`
+}
+
+// ValidateUserConfig checks the contents of cwc.json against its schema.
+func ValidateUserConfig(data []byte) ([]Problem, error) {
+	if err := json.Unmarshal(data, new(any)); err != nil {
+		var syntaxErr *json.SyntaxError
+		if stderrors.As(err, &syntaxErr) {
+			line, column := position(data, syntaxErr.Offset)
+			return []Problem{{Line: line, Column: column, Message: syntaxErr.Error()}}, nil
+		}
+
+		return nil, fmt.Errorf("error parsing config file: %w", err)
+	}
+
+	// JSON is valid YAML, and YAML nodes know where they are
+	return validate(data, UserConfigSchema)
+}
+
+// ValidateRepoConfig checks the contents of .cwc/config.yaml against its
+// schema.
+func ValidateRepoConfig(data []byte) ([]Problem, error) {
+	return validate(data, RepoConfigSchema)
+}
+
+func validate(data, schemaData []byte) ([]Problem, error) {
+	var root schema
+	if err := json.Unmarshal(schemaData, &root); err != nil {
+		return nil, fmt.Errorf("error parsing schema: %w", err)
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		line := 1
+		if match := yamlErrorLine.FindStringSubmatch(err.Error()); match != nil {
+			line, _ = strconv.Atoi(match[1])
+		}
+
+		return []Problem{{Line: line, Column: 1, Message: err.Error()}}, nil
+	}
+
+	if len(doc.Content) == 0 {
+		return nil, nil // an empty file is an empty configuration
+	}
+
+	var problems []Problem
+
+	check(doc.Content[0], &root, "", &problems)
+
+	sort.SliceStable(problems, func(i, j int) bool {
+		if problems[i].Line != problems[j].Line {
+			return problems[i].Line < problems[j].Line
+		}
+
+		return problems[i].Column < problems[j].Column
+	})
+
+	return problems, nil
+}
+
+func check(node *yaml.Node, s *schema, path string, problems *[]Problem) { //nolint:cyclop
+	report := func(n *yaml.Node, format string, args ...any) {
+		*problems = append(*problems, Problem{Line: n.Line, Column: n.Column, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+
+	if actual := nodeType(node); !typeMatches(s.Type, actual) {
+		report(node, "%s must be %s, not %s", describePath(path), article(s.Type), article(actual))
+		return
+	}
+
+	if len(s.Enum) > 0 && !slices.Contains(s.Enum, node.Value) {
+		report(node, "%s must be one of %s, not %q", describePath(path), strings.Join(s.Enum, ", "), node.Value)
+	}
+
+	switch node.Kind {
+	case yaml.MappingNode:
+		checkMapping(node, s, path, problems, report)
+	case yaml.SequenceNode:
+		if s.Items != nil {
+			for i, item := range node.Content {
+				check(item, s.Items, fmt.Sprintf("%s[%d]", path, i), problems)
+			}
+		}
+	case yaml.DocumentNode, yaml.ScalarNode, yaml.AliasNode:
+	}
+}
+
+func checkMapping(node *yaml.Node, s *schema, path string, problems *[]Problem,
+	report func(*yaml.Node, string, ...any),
+) {
+	additional, additionalSchema := additionalProperties(s.AdditionalProperties)
+	seen := map[string]bool{}
+
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := node.Content[i], node.Content[i+1]
+		keyPath := joinPath(path, key.Value)
+		seen[key.Value] = true
+
+		property, known := s.Properties[key.Value]
+
+		switch {
+		case known && property.Deprecated:
+			report(key, "%s is deprecated: %s", describePath(keyPath), property.Description)
+			check(value, property, keyPath, problems)
+		case known:
+			check(value, property, keyPath, problems)
+		case additionalSchema != nil:
+			check(value, additionalSchema, keyPath, problems)
+		case !additional:
+			report(key, "unknown key %q%s%s", key.Value, in(path), suggestion(key.Value, s.Properties))
+		}
+	}
+
+	for _, name := range s.Required {
+		if !seen[name] {
+			report(node, "%s is missing %q", describePath(path), name)
+		}
+	}
+}
+
+// additionalProperties returns whether unknown keys are allowed, and the
+// schema of their values if there is one.
+func additionalProperties(raw json.RawMessage) (bool, *schema) {
+	if len(raw) == 0 {
+		return true, nil
+	}
+
+	var allowed bool
+	if json.Unmarshal(raw, &allowed) == nil {
+		return allowed, nil
+	}
+
+	var s schema
+	if json.Unmarshal(raw, &s) == nil {
+		return true, &s
+	}
+
+	return true, nil
+}
+
+func nodeType(node *yaml.Node) string {
+	switch node.Kind {
+	case yaml.MappingNode:
+		return "object"
+	case yaml.SequenceNode:
+		return "array"
+	case yaml.DocumentNode, yaml.AliasNode:
+		return ""
+	case yaml.ScalarNode:
+	}
+
+	switch node.ShortTag() {
+	case "!!bool":
+		return "boolean"
+	case "!!int":
+		return "integer"
+	case "!!float":
+		return "number"
+	case "!!null":
+		return "null"
+	default:
+		return "string"
+	}
+}
+
+func typeMatches(expected, actual string) bool {
+	return expected == "" || expected == actual || (expected == "number" && actual == "integer")
+}
+
+func article(typ string) string {
+	switch typ {
+	case "object", "array", "integer":
+		return "an " + typ
+	case "null":
+		return "null"
+	default:
+		return "a " + typ
+	}
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+
+	return path + "." + key
+}
+
+func describePath(path string) string {
+	if path == "" {
+		return "the configuration"
+	}
+
+	return path
+}
+
+func in(path string) string {
+	if path == "" {
+		return ""
+	}
+
+	return " in " + path
+}
+
+// suggestion proposes a known key for a misspelled one, differing in case or
+// by a couple of characters.
+func suggestion(key string, properties map[string]*schema) string {
+	best, bestDistance := "", 3 //nolint:gomnd
+
+	for name := range properties {
+		if strings.EqualFold(name, key) {
+			return fmt.Sprintf(", did you mean %q?", name)
+		}
+
+		if d := distance(strings.ToLower(key), strings.ToLower(name)); d < bestDistance ||
+			(d == bestDistance && best != "" && name < best) {
+			best, bestDistance = name, d
+		}
+	}
+
+	if best == "" {
+		return ""
+	}
+
+	return fmt.Sprintf(", did you mean %q?", best)
+}
+
+// distance is the Levenshtein distance between a and b.
+func distance(a, b string) int {
+	previous := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		current := make([]int, len(b)+1)
+		current[0] = i
+
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+
+		previous = current
+	}
+
+	return previous[len(b)]
+}
+
+// position converts a byte offset into a line and column.
+func position(data []byte, offset int64) (int, int) {
+	line, column := 1, 1
+
+	for i := int64(0); i < offset && i < int64(len(data)); i++ {
+		if data[i] == '\n' {
+			line++
+			column = 1
+		} else {
+			column++
+		}
+	}
+
+	return line, column
+}
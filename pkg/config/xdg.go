@@ -8,6 +8,8 @@ import (
 
 const (
 	serviceName = "cwc" // The name of our application
+	logFileName = "cwc.log"
+	backupsDir  = "backups"
 )
 
 // helper function to get the XDG config path.
@@ -33,3 +35,58 @@ func xdgConfigPath() (string, error) {
 
 	return configDir, nil
 }
+
+// UserConfigPath returns the path of cwc.json.
+func UserConfigPath() (string, error) {
+	configDir, err := xdgConfigPath()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(configDir, configFileName), nil
+}
+
+// helper function to get the XDG state path, for data that should persist
+// between runs but isn't worth backing up, such as logs.
+func xdgStatePath() (string, error) {
+	xdgStateHome := os.Getenv("XDG_STATE_HOME")
+	if xdgStateHome == "" {
+		// XDG_STATE_HOME was not set, use the default "~/.local/state"
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("error getting user home directory: %w", err)
+		}
+
+		xdgStateHome = filepath.Join(homeDir, ".local", "state")
+	}
+
+	stateDir := filepath.Join(xdgStateHome, serviceName)
+
+	if err := os.MkdirAll(stateDir, 0o700); err != nil { //nolint:gomnd
+		return "", fmt.Errorf("error creating state directory: %w", err)
+	}
+
+	return stateDir, nil
+}
+
+// LogFilePath returns the path of the log file written with --log-file when
+// no other file is given.
+func LogFilePath() (string, error) {
+	stateDir, err := xdgStatePath()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(stateDir, logFileName), nil
+}
+
+// BackupsDir returns the directory keeping copies of the files changed by
+// applied edits, for cwc undo.
+func BackupsDir() (string, error) {
+	stateDir, err := xdgStatePath()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(stateDir, backupsDir), nil
+}
@@ -0,0 +1,151 @@
+package datasample
+
+import (
+	"bufio"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// sampleCSV renders the header, the inferred type of each column and the
+// first and last rows. Rows are written back with the same delimiter so that
+// quoting survives.
+func sampleCSV(path string, delimiter rune, rows int) (string, error) {
+	file, err := os.Open(path) // #nosec
+	if err != nil {
+		return "", fmt.Errorf("error opening %s: %w", path, err)
+	}
+
+	defer file.Close()
+
+	reader := csv.NewReader(bufio.NewReader(file))
+	reader.Comma = delimiter
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	reader.ReuseRecord = false
+
+	header, err := reader.Read()
+	if errors.Is(err, io.EOF) {
+		return "[empty file]\n", nil
+	}
+
+	if err != nil {
+		return "", fmt.Errorf("error reading %s: %w", path, err)
+	}
+
+	var head [][]string
+
+	last := &tail[[]string]{n: rows}
+	total := 0
+
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		if err != nil {
+			return "", fmt.Errorf("error reading %s: %w", path, err)
+		}
+
+		total++
+
+		if len(head) < rows {
+			head = append(head, record)
+		} else {
+			last.add(record)
+		}
+	}
+
+	var sample strings.Builder
+
+	columns := make([]string, len(header))
+	for i, name := range header {
+		columns[i] = fmt.Sprintf("%s (%s)", name, columnType(i, head, last.items))
+	}
+
+	fmt.Fprintf(&sample, "[%s]\n", describeRows(total, rows, "rows"))
+	fmt.Fprintf(&sample, "[columns: %s]\n", strings.Join(columns, ", "))
+
+	writer := csv.NewWriter(&sample)
+	writer.Comma = delimiter
+
+	_ = writer.Write(header)
+	_ = writer.WriteAll(head)
+
+	if skipped := total - len(head) - len(last.items); skipped > 0 {
+		writer.Flush()
+		fmt.Fprintf(&sample, "[... %d rows omitted ...]\n", skipped)
+	}
+
+	_ = writer.WriteAll(last.list())
+
+	if err := writer.Error(); err != nil {
+		return "", fmt.Errorf("error writing sample: %w", err)
+	}
+
+	return sample.String(), nil
+}
+
+// columnType infers the type of a column from the sampled rows. Empty values
+// don't count, and a column of mixed types is a string.
+func columnType(column int, samples ...[][]string) string {
+	kind := ""
+
+	for _, records := range samples {
+		for _, record := range records {
+			if column >= len(record) || strings.TrimSpace(record[column]) == "" {
+				continue
+			}
+
+			valueKind := valueType(strings.TrimSpace(record[column]))
+
+			switch {
+			case kind == "":
+				kind = valueKind
+			case kind == valueKind:
+			case kind == "integer" && valueKind == "number", kind == "number" && valueKind == "integer":
+				kind = "number"
+			default:
+				return "string"
+			}
+		}
+	}
+
+	if kind == "" {
+		return "empty"
+	}
+
+	return kind
+}
+
+func valueType(value string) string {
+	if _, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return "integer"
+	}
+
+	if _, err := strconv.ParseFloat(value, 64); err == nil {
+		return "number"
+	}
+
+	if _, err := strconv.ParseBool(value); err == nil {
+		return "boolean"
+	}
+
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02 15:04:05", "2006-01-02T15:04:05"} {
+		if _, err := time.Parse(layout, value); err == nil {
+			return "timestamp"
+		}
+	}
+
+	if _, err := time.Parse(time.DateOnly, value); err == nil {
+		return "date"
+	}
+
+	return "string"
+}
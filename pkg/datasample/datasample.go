@@ -0,0 +1,156 @@
+// Package datasample summarizes large data files, such as CSV and JSON
+// exports, as their schema with a sample of the first and last rows, so that
+// questions about data pipelines don't fill the context with raw data.
+package datasample
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/emilkje/cwc/pkg/ui"
+)
+
+const (
+	// DefaultThresholdBytes is the size above which data files are sampled.
+	DefaultThresholdBytes = 64 << 10
+	// DefaultRows is the number of rows taken from the start and the end.
+	DefaultRows = 10
+)
+
+// Options control when and how much data files are sampled. Zero values
+// mean the defaults.
+type Options struct {
+	// ThresholdBytes is the size above which data files are sampled.
+	ThresholdBytes int64
+	// Rows is the number of rows, or array elements, taken from the start
+	// and from the end.
+	Rows int
+}
+
+func (o *Options) threshold() int64 {
+	if o == nil || o.ThresholdBytes <= 0 {
+		return DefaultThresholdBytes
+	}
+
+	return o.ThresholdBytes
+}
+
+func (o *Options) rows() int {
+	if o == nil || o.Rows <= 0 {
+		return DefaultRows
+	}
+
+	return o.Rows
+}
+
+type format int
+
+const (
+	formatUnknown format = iota
+	formatCSV
+	formatTSV
+	formatJSON
+	formatJSONLines
+	formatParquet
+)
+
+func formatOf(path string) format {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+		return formatCSV
+	case ".tsv":
+		return formatTSV
+	case ".json":
+		return formatJSON
+	case ".jsonl", ".ndjson":
+		return formatJSONLines
+	case ".parquet":
+		return formatParquet
+	}
+
+	return formatUnknown
+}
+
+// Supported reports whether the path is a data file that can be sampled.
+// Parquet files are binary, so they can only be included as a sample.
+func Supported(path string) bool {
+	return formatOf(path) != formatUnknown
+}
+
+// Applies reports whether the file is sampled rather than included whole.
+func Applies(path string, size int64, opts *Options) bool {
+	switch formatOf(path) {
+	case formatUnknown:
+		return false
+	case formatParquet:
+		return true
+	case formatCSV, formatTSV, formatJSON, formatJSONLines:
+	}
+
+	return size > opts.threshold()
+}
+
+// SampleFile reads the file and renders its sample. Only the rows that are
+// kept are held in memory, except for JSON documents that aren't arrays,
+// which are decoded whole.
+func SampleFile(path string, size int64, opts *Options) (string, error) {
+	var (
+		sample string
+		err    error
+	)
+
+	rows := opts.rows()
+
+	switch formatOf(path) {
+	case formatCSV:
+		sample, err = sampleCSV(path, ',', rows)
+	case formatTSV:
+		sample, err = sampleCSV(path, '\t', rows)
+	case formatJSON:
+		sample, err = sampleJSON(path, rows)
+	case formatJSONLines:
+		sample, err = sampleJSONLines(path, rows)
+	case formatParquet:
+		sample, err = sampleParquet(path)
+	case formatUnknown:
+		return "", fmt.Errorf("not a data file: %s", path)
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("[sample of a %s file]\n", ui.FormatBytes(size)) + sample, nil
+}
+
+// describeRows is the note on which rows are shown.
+func describeRows(total, rows int, unit string) string {
+	if total <= 2*rows {
+		return fmt.Sprintf("%d %s, all shown", total, unit)
+	}
+
+	return fmt.Sprintf("%d %s, showing the first %d and the last %d", total, unit, rows, rows)
+}
+
+// tail keeps the last n items it is given.
+type tail[T any] struct {
+	n     int
+	items []T
+	next  int
+}
+
+func (t *tail[T]) add(item T) {
+	if len(t.items) < t.n {
+		t.items = append(t.items, item)
+		return
+	}
+
+	t.items[t.next] = item
+	t.next = (t.next + 1) % t.n
+}
+
+// list returns the items in the order they were added.
+func (t *tail[T]) list() []T {
+	return append(append([]T{}, t.items[t.next:]...), t.items[:t.next]...)
+}
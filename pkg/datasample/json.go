@@ -0,0 +1,273 @@
+package datasample
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxStringLength truncates long strings in the samples of JSON documents.
+const maxStringLength = 200
+
+// sampleJSON renders the first and last elements of a top-level array, which
+// is streamed. Other documents are decoded whole and rendered with their
+// arrays cut short.
+func sampleJSON(path string, rows int) (string, error) {
+	file, err := os.Open(path) // #nosec
+	if err != nil {
+		return "", fmt.Errorf("error opening %s: %w", path, err)
+	}
+
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+
+	first, err := firstNonSpace(reader)
+	if errors.Is(err, io.EOF) {
+		return "[empty file]\n", nil
+	}
+
+	if err != nil {
+		return "", fmt.Errorf("error reading %s: %w", path, err)
+	}
+
+	decoder := json.NewDecoder(reader)
+
+	if first != '[' {
+		var document any
+		if err := decoder.Decode(&document); err != nil {
+			return "", fmt.Errorf("error parsing %s: %w", path, err)
+		}
+
+		out, err := json.MarshalIndent(shorten(document, rows), "", "  ")
+		if err != nil {
+			return "", fmt.Errorf("error writing sample: %w", err)
+		}
+
+		return fmt.Sprintf("[arrays cut short to %d elements]\n%s\n", rows, out), nil
+	}
+
+	// the opening bracket
+	if _, err := decoder.Token(); err != nil {
+		return "", fmt.Errorf("error parsing %s: %w", path, err)
+	}
+
+	s := newElementSampler(rows)
+
+	for decoder.More() {
+		var element json.RawMessage
+		if err := decoder.Decode(&element); err != nil {
+			return "", fmt.Errorf("error parsing %s: %w", path, err)
+		}
+
+		s.add(element)
+	}
+
+	return s.render("elements", "[\n", "]\n", ",\n"), nil
+}
+
+// sampleJSONLines renders the first and last lines of a JSON Lines file.
+func sampleJSONLines(path string, rows int) (string, error) {
+	file, err := os.Open(path) // #nosec
+	if err != nil {
+		return "", fmt.Errorf("error opening %s: %w", path, err)
+	}
+
+	defer file.Close()
+
+	s := newElementSampler(rows)
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, 16<<20)
+
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+
+		s.add(json.RawMessage(bytes.Clone(line)))
+	}
+
+	if err := scanner.Err(); err != nil {
+		return "", fmt.Errorf("error reading %s: %w", path, err)
+	}
+
+	return s.render("lines", "", "", "\n"), nil
+}
+
+func firstNonSpace(reader *bufio.Reader) (byte, error) {
+	for {
+		c, err := reader.ReadByte()
+		if err != nil {
+			return 0, err //nolint:wrapcheck
+		}
+
+		if c != ' ' && c != '\t' && c != '\n' && c != '\r' {
+			return c, reader.UnreadByte() //nolint:wrapcheck
+		}
+	}
+}
+
+// elementSampler keeps the first and last elements of a stream of JSON
+// values. The fields of the objects among them make up the schema.
+type elementSampler struct {
+	rows   int
+	total  int
+	head   []json.RawMessage
+	last   *tail[json.RawMessage]
+	fields map[string]map[string]bool
+}
+
+func newElementSampler(rows int) *elementSampler {
+	return &elementSampler{
+		rows:   rows,
+		last:   &tail[json.RawMessage]{n: rows},
+		fields: make(map[string]map[string]bool),
+	}
+}
+
+func (s *elementSampler) add(element json.RawMessage) {
+	s.total++
+
+	if len(s.head) < s.rows {
+		s.head = append(s.head, element)
+	} else {
+		s.last.add(element)
+	}
+}
+
+// addFields records the types of the fields of an object.
+func (s *elementSampler) addFields(element json.RawMessage) {
+	var object map[string]any
+	if json.Unmarshal(element, &object) != nil {
+		return
+	}
+
+	for key, value := range object {
+		if s.fields[key] == nil {
+			s.fields[key] = make(map[string]bool)
+		}
+
+		s.fields[key][jsonType(value)] = true
+	}
+}
+
+func (s *elementSampler) render(unit, open, closing, separator string) string {
+	var sample strings.Builder
+
+	fmt.Fprintf(&sample, "[%s]\n", describeRows(s.total, s.rows, unit))
+
+	for _, element := range append(s.head, s.last.items...) {
+		s.addFields(element)
+	}
+
+	if len(s.fields) > 0 {
+		keys := make([]string, 0, len(s.fields))
+		for key := range s.fields {
+			keys = append(keys, key)
+		}
+
+		sort.Strings(keys)
+
+		for i, key := range keys {
+			types := make([]string, 0, len(s.fields[key]))
+			for t := range s.fields[key] {
+				types = append(types, t)
+			}
+
+			sort.Strings(types)
+			keys[i] = fmt.Sprintf("%s (%s)", key, strings.Join(types, "|"))
+		}
+
+		fmt.Fprintf(&sample, "[fields: %s]\n", strings.Join(keys, ", "))
+	}
+
+	sample.WriteString(open)
+
+	elements := make([]string, 0, len(s.head)+len(s.last.items)+1)
+	for _, element := range s.head {
+		elements = append(elements, compact(element))
+	}
+
+	if skipped := s.total - len(s.head) - len(s.last.items); skipped > 0 {
+		elements = append(elements, fmt.Sprintf("[... %d %s omitted ...]", skipped, unit))
+	}
+
+	for _, element := range s.last.list() {
+		elements = append(elements, compact(element))
+	}
+
+	sample.WriteString(strings.Join(elements, separator))
+	sample.WriteString("\n")
+	sample.WriteString(closing)
+
+	return sample.String()
+}
+
+func compact(element json.RawMessage) string {
+	var out bytes.Buffer
+	if json.Compact(&out, element) != nil {
+		return string(element)
+	}
+
+	return out.String()
+}
+
+func jsonType(value any) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case []any:
+		return "array"
+	}
+
+	return "object"
+}
+
+// shorten cuts the arrays of a decoded document short and truncates long
+// strings.
+func shorten(value any, rows int) any {
+	switch v := value.(type) {
+	case []any:
+		n := len(v)
+		if n > rows {
+			v = append(v[:rows:rows], fmt.Sprintf("[... %d more elements ...]", n-rows))
+		}
+
+		for i := range v {
+			v[i] = shorten(v[i], rows)
+		}
+
+		return v
+	case map[string]any:
+		for key := range v {
+			v[key] = shorten(v[key], rows)
+		}
+
+		return v
+	case string:
+		if len(v) > maxStringLength {
+			cut := maxStringLength
+			for cut > 0 && !utf8.RuneStart(v[cut]) {
+				cut--
+			}
+
+			return v[:cut] + "..."
+		}
+	}
+
+	return value
+}
@@ -0,0 +1,456 @@
+package datasample
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// maxParquetFooterBytes caps the size of the metadata that is read.
+const maxParquetFooterBytes = 16 << 20
+
+var parquetMagic = []byte("PAR1")
+
+// sampleParquet renders the schema and the number of rows in the footer of a
+// Parquet file. Rows aren't decoded: the pages are encoded and compressed in
+// too many ways to be worth it here.
+func sampleParquet(path string) (string, error) {
+	file, err := os.Open(path) // #nosec
+	if err != nil {
+		return "", fmt.Errorf("error opening %s: %w", path, err)
+	}
+
+	defer file.Close()
+
+	footer, err := readParquetFooter(file)
+	if err != nil {
+		return "", fmt.Errorf("error reading %s: %w", path, err)
+	}
+
+	metadata, err := parseFileMetadata(footer)
+	if err != nil {
+		return "", fmt.Errorf("error reading %s: %w", path, err)
+	}
+
+	var sample strings.Builder
+
+	fmt.Fprintf(&sample, "[parquet: %d rows in %d row groups; the rows aren't shown]\n", metadata.numRows, metadata.rowGroups)
+	sample.WriteString("[schema]\n")
+
+	if len(metadata.schema) > 0 {
+		// the first element is the root, whose children are the columns
+		index := 1
+		for i := 0; i < metadata.schema[0].numChildren && index < len(metadata.schema); i++ {
+			index = writeSchemaElement(&sample, metadata.schema, index, 0)
+		}
+	}
+
+	return sample.String(), nil
+}
+
+func readParquetFooter(file *os.File) ([]byte, error) {
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+
+	trailer := make([]byte, 8)
+	if info.Size() < 12 {
+		return nil, errors.New("not a parquet file")
+	}
+
+	if _, err := file.ReadAt(trailer, info.Size()-8); err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+
+	if !bytes.Equal(trailer[4:], parquetMagic) {
+		return nil, errors.New("not a parquet file")
+	}
+
+	length := int64(binary.LittleEndian.Uint32(trailer))
+	if length > maxParquetFooterBytes || length > info.Size()-12 {
+		return nil, errors.New("the metadata is too large")
+	}
+
+	footer := make([]byte, length)
+	if _, err := file.ReadAt(footer, info.Size()-8-length); err != nil && !errors.Is(err, io.EOF) {
+		return nil, err //nolint:wrapcheck
+	}
+
+	return footer, nil
+}
+
+// writeSchemaElement writes the element at index and its children, and
+// returns the index of the element after them.
+func writeSchemaElement(sample *strings.Builder, schema []schemaElement, index, depth int) int {
+	element := schema[index]
+
+	fmt.Fprintf(sample, "%s%s: %s\n", strings.Repeat("  ", depth+1), element.name, element.describe())
+
+	index++
+	for i := 0; i < element.numChildren && index < len(schema); i++ {
+		index = writeSchemaElement(sample, schema, index, depth+1)
+	}
+
+	return index
+}
+
+type fileMetadata struct {
+	schema    []schemaElement
+	numRows   int64
+	rowGroups int
+}
+
+type schemaElement struct {
+	name          string
+	physicalType  int
+	hasType       bool
+	repetition    int
+	convertedType int
+	hasConverted  bool
+	numChildren   int
+}
+
+var physicalTypes = []string{ //nolint:gochecknoglobals
+	"boolean", "int32", "int64", "int96", "float", "double", "binary", "fixed_len_binary",
+}
+
+var convertedTypes = map[int]string{ //nolint:gochecknoglobals
+	0: "string", 1: "map", 2: "map_key_value", 3: "list", 4: "enum", 5: "decimal",
+	6: "date", 7: "time_millis", 8: "time_micros", 9: "timestamp_millis", 10: "timestamp_micros",
+	19: "json", 20: "bson", 21: "interval",
+}
+
+func (e schemaElement) describe() string {
+	var kind string
+
+	switch {
+	case e.hasConverted && convertedTypes[e.convertedType] != "":
+		kind = convertedTypes[e.convertedType]
+	case !e.hasType:
+		kind = "group"
+	case e.physicalType >= 0 && e.physicalType < len(physicalTypes):
+		kind = physicalTypes[e.physicalType]
+	default:
+		kind = "unknown"
+	}
+
+	switch e.repetition {
+	case 1:
+		kind += ", optional"
+	case 2:
+		kind += ", repeated"
+	}
+
+	return kind
+}
+
+// Thrift compact protocol types
+const (
+	thriftStop   = 0
+	thriftTrue   = 1
+	thriftFalse  = 2
+	thriftByte   = 3
+	thriftI16    = 4
+	thriftI32    = 5
+	thriftI64    = 6
+	thriftDouble = 7
+	thriftBinary = 8
+	thriftList   = 9
+	thriftSet    = 10
+	thriftMap    = 11
+	thriftStruct = 12
+)
+
+// maxThriftDepth bounds the nesting of structs and containers.
+const maxThriftDepth = 64
+
+var errMalformed = errors.New("malformed metadata")
+
+// thriftReader reads the Thrift compact protocol the Parquet metadata is
+// encoded with.
+type thriftReader struct {
+	data  []byte
+	pos   int
+	depth int
+}
+
+func (r *thriftReader) byte() (byte, error) {
+	if r.pos >= len(r.data) {
+		return 0, errMalformed
+	}
+
+	r.pos++
+
+	return r.data[r.pos-1], nil
+}
+
+func (r *thriftReader) varint() (uint64, error) {
+	value, n := binary.Uvarint(r.data[r.pos:])
+	if n <= 0 {
+		return 0, errMalformed
+	}
+
+	r.pos += n
+
+	return value, nil
+}
+
+func (r *thriftReader) zigzag() (int64, error) {
+	value, err := r.varint()
+
+	return int64(value>>1) ^ -int64(value&1), err
+}
+
+func (r *thriftReader) binary() ([]byte, error) {
+	length, err := r.varint()
+	if err != nil || length > uint64(len(r.data)-r.pos) {
+		return nil, errMalformed
+	}
+
+	r.pos += int(length)
+
+	return r.data[r.pos-int(length) : r.pos], nil
+}
+
+// fieldHeader returns the id and type of the next field of a struct, where
+// last is the id of the previous one.
+func (r *thriftReader) fieldHeader(last int) (int, int, error) {
+	header, err := r.byte()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	kind := int(header & 0x0f)
+	if kind == thriftStop {
+		return 0, thriftStop, nil
+	}
+
+	if delta := int(header >> 4); delta != 0 {
+		return last + delta, kind, nil
+	}
+
+	id, err := r.zigzag()
+
+	return int(id), kind, err
+}
+
+func (r *thriftReader) listHeader() (int, int, error) {
+	header, err := r.byte()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	size := uint64(header >> 4)
+	if size == 15 {
+		if size, err = r.varint(); err != nil {
+			return 0, 0, err
+		}
+	}
+
+	// every element takes at least a byte
+	if size > uint64(len(r.data)-r.pos) {
+		return 0, 0, errMalformed
+	}
+
+	return int(size), int(header & 0x0f), nil
+}
+
+// structFields calls field for each field of a struct, which must read the
+// value or skip it.
+func (r *thriftReader) structFields(field func(id, kind int) error) error {
+	if r.depth++; r.depth > maxThriftDepth {
+		return errMalformed
+	}
+	defer func() { r.depth-- }()
+
+	last := 0
+
+	for {
+		id, kind, err := r.fieldHeader(last)
+		if err != nil {
+			return err
+		}
+
+		if kind == thriftStop {
+			return nil
+		}
+
+		if err := field(id, kind); err != nil {
+			return err
+		}
+
+		last = id
+	}
+}
+
+func (r *thriftReader) skip(kind int) error { //nolint:cyclop
+	switch kind {
+	case thriftTrue, thriftFalse:
+		return nil
+	case thriftByte:
+		_, err := r.byte()
+		return err
+	case thriftI16, thriftI32, thriftI64:
+		_, err := r.varint()
+		return err
+	case thriftDouble:
+		if r.pos+8 > len(r.data) {
+			return errMalformed
+		}
+
+		r.pos += 8
+
+		return nil
+	case thriftBinary:
+		_, err := r.binary()
+		return err
+	case thriftList, thriftSet:
+		if r.depth++; r.depth > maxThriftDepth {
+			return errMalformed
+		}
+		defer func() { r.depth-- }()
+
+		size, elementKind, err := r.listHeader()
+		if err != nil {
+			return err
+		}
+
+		for i := 0; i < size; i++ {
+			// booleans in lists take a byte each
+			if elementKind == thriftTrue || elementKind == thriftFalse {
+				elementKind = thriftByte
+			}
+
+			if err := r.skip(elementKind); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	case thriftMap:
+		if r.depth++; r.depth > maxThriftDepth {
+			return errMalformed
+		}
+		defer func() { r.depth-- }()
+
+		size, err := r.varint()
+		if err != nil || size == 0 {
+			return err
+		}
+
+		kinds, err := r.byte()
+		if err != nil {
+			return err
+		}
+
+		for i := uint64(0); i < size; i++ {
+			if err := r.skip(int(kinds >> 4)); err != nil {
+				return err
+			}
+
+			if err := r.skip(int(kinds & 0x0f)); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	case thriftStruct:
+		return r.structFields(func(_, kind int) error { return r.skip(kind) })
+	}
+
+	return errMalformed
+}
+
+// parseFileMetadata reads the schema (field 2), the number of rows (3) and
+// the row groups (4) of a FileMetaData struct.
+func parseFileMetadata(footer []byte) (*fileMetadata, error) {
+	r := &thriftReader{data: footer}
+	metadata := &fileMetadata{}
+
+	err := r.structFields(func(id, kind int) error {
+		switch {
+		case id == 2 && kind == thriftList:
+			size, _, err := r.listHeader()
+			if err != nil {
+				return err
+			}
+
+			for i := 0; i < size; i++ {
+				element, err := r.schemaElement()
+				if err != nil {
+					return err
+				}
+
+				metadata.schema = append(metadata.schema, element)
+			}
+
+			return nil
+		case id == 3 && kind == thriftI64:
+			numRows, err := r.zigzag()
+			metadata.numRows = numRows
+
+			return err
+		case id == 4 && kind == thriftList:
+			size, elementKind, err := r.listHeader()
+			if err != nil {
+				return err
+			}
+
+			metadata.rowGroups = size
+
+			for i := 0; i < size; i++ {
+				if err := r.skip(elementKind); err != nil {
+					return err
+				}
+			}
+
+			return nil
+		}
+
+		return r.skip(kind)
+	})
+
+	return metadata, err
+}
+
+func (r *thriftReader) schemaElement() (schemaElement, error) {
+	var element schemaElement
+
+	err := r.structFields(func(id, kind int) error {
+		var err error
+
+		switch {
+		case id == 1 && kind == thriftI32:
+			var value int64
+			value, err = r.zigzag()
+			element.physicalType, element.hasType = int(value), true
+		case id == 3 && kind == thriftI32:
+			var value int64
+			value, err = r.zigzag()
+			element.repetition = int(value)
+		case id == 4 && kind == thriftBinary:
+			var name []byte
+			name, err = r.binary()
+			element.name = string(name)
+		case id == 5 && kind == thriftI32:
+			var value int64
+			value, err = r.zigzag()
+			element.numChildren = int(value)
+		case id == 6 && kind == thriftI32:
+			var value int64
+			value, err = r.zigzag()
+			element.convertedType, element.hasConverted = int(value), true
+		default:
+			err = r.skip(kind)
+		}
+
+		return err
+	})
+
+	return element, err
+}
@@ -0,0 +1,41 @@
+package datasample
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseFileMetadataDeeplyNested(t *testing.T) {
+	// 0x19 is both a field holding a list and the header of a list of one
+	// list, nesting lists until the footer runs out
+	footer := bytes.Repeat([]byte{0x19}, 1<<20)
+
+	_, err := parseFileMetadata(footer)
+
+	assert.ErrorIs(t, err, errMalformed)
+}
+
+func TestSampleParquetDeeplyNested(t *testing.T) {
+	footer := bytes.Repeat([]byte{0x19}, 1<<16)
+
+	var file bytes.Buffer
+
+	file.Write(parquetMagic)
+	file.Write(footer)
+	_ = binary.Write(&file, binary.LittleEndian, uint32(len(footer)))
+	file.Write(parquetMagic)
+
+	path := filepath.Join(t.TempDir(), "nested.parquet")
+	if err := os.WriteFile(path, file.Bytes(), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := sampleParquet(path)
+
+	assert.ErrorIs(t, err, errMalformed)
+}
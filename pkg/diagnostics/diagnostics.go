@@ -0,0 +1,244 @@
+// Package diagnostics finds the source locations in the output of
+// compilers, linters and test runners, such as the file and line of each
+// error in the output of go build, tsc, rustc, gcc or pytest, and of the
+// frames of Go panics and Python tracebacks, and reads the lines around them.
+package diagnostics
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Location is a position in a source file that the output refers to.
+type Location struct {
+	// Path is relative to the working directory.
+	Path string
+	Line int
+	// Message is the line of output the location was found in.
+	Message string
+}
+
+var (
+	// fileLineRegexp matches path:line and path:line:column, as written by
+	// most compilers, and path(line,column), as written by tsc and MSBuild.
+	fileLineRegexp = regexp.MustCompile( //nolint:gochecknoglobals
+		`(?:^|[\s(\["'=])(?:file://)?((?:[A-Za-z]:)?[\w.@~+\-/\\]*\w\.\w+)(?::(\d+)(?::\d+)?|\((\d+),\d+\))`)
+	// pythonFrameRegexp matches the frames of Python tracebacks.
+	pythonFrameRegexp = regexp.MustCompile(`File "([^"]+)", line (\d+)`) //nolint:gochecknoglobals
+)
+
+// Parse returns the locations in the output that point to existing files
+// below the working directory, in the order they first appear, one per file
+// and line. Names without a directory, such as those of go test, are matched
+// against known, the paths of the files in the repository, when only one of
+// them has that name.
+func Parse(output string, known []string) []Location {
+	cwd, _ := os.Getwd()
+	r := &resolver{cwd: cwd, byName: make(map[string][]string)}
+
+	for _, path := range known {
+		name := filepath.Base(path)
+		r.byName[name] = append(r.byName[name], filepath.Clean(path))
+	}
+
+	var locations []Location
+
+	seen := make(map[string]bool)
+
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimRight(line, "\r")
+
+		for _, match := range matches(line) {
+			path, ok := r.resolve(match.path)
+			if !ok {
+				continue
+			}
+
+			key := path + ":" + strconv.Itoa(match.line)
+			if seen[key] {
+				continue
+			}
+
+			seen[key] = true
+			locations = append(locations, Location{Path: path, Line: match.line, Message: strings.TrimSpace(line)})
+		}
+	}
+
+	return locations
+}
+
+// Files returns the distinct files of the locations, in order.
+func Files(locations []Location) []string {
+	var files []string
+
+	seen := make(map[string]bool)
+
+	for _, location := range locations {
+		if !seen[location.Path] {
+			seen[location.Path] = true
+			files = append(files, location.Path)
+		}
+	}
+
+	return files
+}
+
+type match struct {
+	path string
+	line int
+}
+
+func matches(line string) []match {
+	var found []match
+
+	for _, m := range pythonFrameRegexp.FindAllStringSubmatch(line, -1) {
+		n, _ := strconv.Atoi(m[2])
+		found = append(found, match{path: m[1], line: n})
+	}
+
+	for _, m := range fileLineRegexp.FindAllStringSubmatch(line, -1) {
+		lineNumber := m[2]
+		if lineNumber == "" {
+			lineNumber = m[3]
+		}
+
+		n, _ := strconv.Atoi(lineNumber)
+		found = append(found, match{path: m[1], line: n})
+	}
+
+	return found
+}
+
+type resolver struct {
+	cwd    string
+	byName map[string][]string
+}
+
+// resolve returns the path relative to the working directory of the file
+// the output names, if it exists below it.
+func (r *resolver) resolve(path string) (string, bool) {
+	path = filepath.FromSlash(path)
+
+	if filepath.IsAbs(path) {
+		rel, err := filepath.Rel(r.cwd, path)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return "", false
+		}
+
+		path = rel
+	}
+
+	path = filepath.Clean(path)
+	if strings.HasPrefix(path, "..") {
+		return "", false
+	}
+
+	if info, err := os.Stat(path); err == nil && info.Mode().IsRegular() {
+		return path, true
+	}
+
+	// go test and javac name files without their directory
+	if !strings.ContainsRune(path, filepath.Separator) {
+		if candidates := r.byName[path]; len(candidates) == 1 {
+			return candidates[0], true
+		}
+	}
+
+	return "", false
+}
+
+// Region is a range of lines around one or more locations in a file.
+type Region struct {
+	Path string
+	// Start and End are the first and last line, counting from 1.
+	Start, End int
+	// Lines are the lines of the region.
+	Lines []string
+	// Marked are the lines the locations point to.
+	Marked []int
+}
+
+// Regions reads the lines within radius of each location, merging the
+// regions that overlap, in the order the files first appear.
+func Regions(locations []Location, radius int) ([]Region, error) {
+	lines := make(map[string][]int)
+	for _, location := range locations {
+		lines[location.Path] = append(lines[location.Path], max(location.Line, 1))
+	}
+
+	var regions []Region
+
+	for _, path := range Files(locations) {
+		data, err := os.ReadFile(path) // #nosec
+		if err != nil {
+			return nil, fmt.Errorf("error reading %s: %w", path, err)
+		}
+
+		content := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+
+		marked := lines[path]
+		sort.Ints(marked)
+
+		var current *Region
+
+		for _, line := range marked {
+			if line > len(content) {
+				continue
+			}
+
+			start, end := max(line-radius, 1), min(line+radius, len(content))
+
+			if current != nil && start <= current.End+1 {
+				current.End = max(current.End, end)
+				current.Marked = append(current.Marked, line)
+
+				continue
+			}
+
+			if current != nil {
+				regions = append(regions, *current)
+			}
+
+			current = &Region{Path: path, Start: start, End: end, Marked: []int{line}}
+		}
+
+		if current != nil {
+			regions = append(regions, *current)
+		}
+
+		for i := range regions {
+			if regions[i].Path == path {
+				regions[i].Lines = content[regions[i].Start-1 : regions[i].End]
+			}
+		}
+	}
+
+	return regions, nil
+}
+
+// Format renders the region with line numbers, pointing out the marked
+// lines with >.
+func (r *Region) Format() string {
+	var out strings.Builder
+
+	width := len(strconv.Itoa(r.End))
+
+	for i, line := range r.Lines {
+		number := r.Start + i
+
+		marker := " "
+		if slices.Contains(r.Marked, number) {
+			marker = ">"
+		}
+
+		fmt.Fprintf(&out, "%s%*d | %s\n", marker, width, number, line)
+	}
+
+	return out.String()
+}
@@ -0,0 +1,48 @@
+// Package document extracts the text of PDF and DOCX files, such as design
+// docs and specs, so they can be included in the context.
+package document
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// Type is the code fence label of extracted documents.
+const Type = "text"
+
+// IsDocument reports whether the text of the file can be extracted.
+func IsDocument(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".pdf", ".docx":
+		return true
+	}
+
+	return false
+}
+
+// ExtractText extracts the text of a PDF or DOCX document. The start of each
+// page is marked with a line such as "[page 2]"; DOCX files only know about
+// the page breaks Word recorded when they were saved. A damaged or crafted
+// document that trips up the parsers is reported as an error.
+func ExtractText(path string, data []byte) (text string, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			text, err = "", fmt.Errorf("error extracting the text of %s: %v", path, r)
+		}
+	}()
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".pdf":
+		return extractPDF(data)
+	case ".docx":
+		return extractDOCX(data)
+	}
+
+	return "", fmt.Errorf("not a document: %s", path)
+}
+
+// pageMarker marks the start of a page.
+func pageMarker(page int) string {
+	return fmt.Sprintf("[page %d]\n", page)
+}
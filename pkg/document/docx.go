@@ -0,0 +1,117 @@
+package document
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// maxDocumentXMLBytes caps the size of the decompressed document, guarding
+// against zip bombs.
+const maxDocumentXMLBytes = 64 << 20
+
+// extractDOCX extracts the paragraphs of word/document.xml.
+func extractDOCX(data []byte) (string, error) {
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return "", fmt.Errorf("error reading docx: %w", err)
+	}
+
+	for _, file := range archive.File {
+		if file.Name != "word/document.xml" {
+			continue
+		}
+
+		reader, err := file.Open()
+		if err != nil {
+			return "", fmt.Errorf("error reading docx: %w", err)
+		}
+
+		defer reader.Close()
+
+		return extractDocumentXML(io.LimitReader(reader, maxDocumentXMLBytes))
+	}
+
+	return "", fmt.Errorf("error reading docx: no word/document.xml")
+}
+
+func extractDocumentXML(reader io.Reader) (string, error) { //nolint:cyclop
+	var text strings.Builder
+
+	page := 1
+	text.WriteString(pageMarker(page))
+
+	// Word records a rendered page break right after a manual one too
+	atPageStart := false
+
+	newPage := func() {
+		if atPageStart {
+			return
+		}
+
+		page++
+		text.WriteString("\n" + pageMarker(page))
+
+		atPageStart = true
+	}
+
+	decoder := xml.NewDecoder(reader)
+	inText := false
+
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return "", fmt.Errorf("error parsing docx: %w", err)
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "t":
+				inText = true
+			case "tab":
+				text.WriteString("\t")
+			case "br":
+				if attr(t, "type") == "page" {
+					newPage()
+				} else {
+					text.WriteString("\n")
+				}
+			case "lastRenderedPageBreak":
+				newPage()
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "t":
+				inText = false
+			case "p":
+				text.WriteString("\n")
+			}
+		case xml.CharData:
+			if inText {
+				text.Write(t)
+
+				atPageStart = false
+			}
+		}
+	}
+
+	return text.String(), nil
+}
+
+func attr(element xml.StartElement, name string) string {
+	for _, a := range element.Attr {
+		if a.Name.Local == name {
+			return a.Value
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,604 @@
+package document
+
+import (
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode/utf16"
+)
+
+// maxStreamBytes caps the size of each decompressed stream, guarding against
+// zip bombs.
+const maxStreamBytes = 64 << 20
+
+var (
+	errEncrypted = errors.New("encrypted PDFs are not supported")
+	errNoText    = errors.New("no text found, the PDF may only contain scanned images")
+	// objectHeader finds the start of the objects in the file.
+	objectHeader = regexp.MustCompile(`(\d+)\s+(\d+)\s+obj\b`) //nolint:gochecknoglobals
+)
+
+type (
+	pdfName    string
+	pdfString  []byte
+	pdfKeyword string
+	pdfArray   []any
+	pdfDict    map[pdfName]any
+	pdfRef     struct{ num int }
+	pdfStream  struct {
+		dict pdfDict
+		data []byte
+	}
+)
+
+// pdfDocument holds the objects of a PDF by number. Cross-reference tables
+// are not read: the objects are found by scanning the file, which also
+// copes with damaged files.
+type pdfDocument struct {
+	objects map[int]any
+	fonts   map[*pdfStream]*fontDecoder
+}
+
+// extractPDF extracts the text of every page of a PDF.
+func extractPDF(data []byte) (string, error) {
+	doc := &pdfDocument{objects: make(map[int]any), fonts: make(map[*pdfStream]*fontDecoder)}
+	doc.scanObjects(data)
+
+	if doc.encrypted(data) {
+		return "", errEncrypted
+	}
+
+	doc.expandObjectStreams()
+
+	var (
+		text    strings.Builder
+		anyText bool
+	)
+
+	for i, page := range doc.pages() {
+		pageText := doc.pageText(page)
+		if strings.TrimSpace(pageText) != "" {
+			anyText = true
+		}
+
+		if i > 0 {
+			text.WriteString("\n")
+		}
+
+		text.WriteString(pageMarker(i + 1))
+		text.WriteString(pageText)
+	}
+
+	if !anyText {
+		return "", errNoText
+	}
+
+	return text.String(), nil
+}
+
+func (d *pdfDocument) scanObjects(data []byte) {
+	for pos := 0; pos < len(data); {
+		loc := objectHeader.FindSubmatchIndex(data[pos:])
+		if loc == nil {
+			return
+		}
+
+		num := atoi(data[pos+loc[2] : pos+loc[3]])
+		lex := &pdfLexer{data: data, pos: pos + loc[1]}
+
+		value, err := lex.parseObject()
+		if err != nil {
+			pos += loc[1]
+			continue
+		}
+
+		if dict, ok := value.(pdfDict); ok && lex.peekKeyword("stream") {
+			value = &pdfStream{dict: dict, data: lex.readStreamData(dict)}
+		}
+
+		d.objects[num] = value
+		pos = max(lex.pos, pos+loc[1])
+	}
+}
+
+// expandObjectStreams adds the objects stored compressed in object streams.
+func (d *pdfDocument) expandObjectStreams() {
+	for _, object := range d.objects {
+		stream, ok := object.(*pdfStream)
+		if !ok || stream.dict["Type"] != pdfName("ObjStm") {
+			continue
+		}
+
+		data, err := d.decode(stream)
+		if err != nil {
+			continue
+		}
+
+		count, _ := d.resolve(stream.dict["N"]).(float64)
+		first, _ := d.resolve(stream.dict["First"]).(float64)
+		header := &pdfLexer{data: data}
+
+		for i := 0; i < int(count); i++ {
+			num, err1 := header.parseObject()
+			offset, err2 := header.parseObject()
+
+			n, ok1 := num.(float64)
+			o, ok2 := offset.(float64)
+
+			if err1 != nil || err2 != nil || !ok1 || !ok2 {
+				break
+			}
+
+			// the offsets come from the file, so skip the objects they put
+			// outside the stream
+			if _, exists := d.objects[int(n)]; exists || first+o < 0 || first+o > float64(len(data)) {
+				continue
+			}
+
+			lex := &pdfLexer{data: data, pos: int(first + o)}
+			if value, err := lex.parseObject(); err == nil {
+				d.objects[int(n)] = value
+			}
+		}
+	}
+}
+
+// encrypted reports whether the trailer of the file, or the cross-reference
+// stream standing in for it, refers to an encryption dictionary.
+func (d *pdfDocument) encrypted(data []byte) bool {
+	for pos := 0; ; {
+		i := bytes.Index(data[pos:], []byte("trailer"))
+		if i < 0 {
+			break
+		}
+
+		lex := &pdfLexer{data: data, pos: pos + i + len("trailer")}
+
+		value, _ := lex.parseObject()
+		if trailer, ok := value.(pdfDict); ok && trailer["Encrypt"] != nil {
+			return true
+		}
+
+		pos += i + len("trailer")
+	}
+
+	for _, object := range d.objects {
+		if stream, ok := object.(*pdfStream); ok && stream.dict["Type"] == pdfName("XRef") &&
+			stream.dict["Encrypt"] != nil {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (d *pdfDocument) resolve(value any) any {
+	for i := 0; i < 32; i++ {
+		ref, ok := value.(pdfRef)
+		if !ok {
+			return value
+		}
+
+		value = d.objects[ref.num]
+	}
+
+	return nil
+}
+
+func (d *pdfDocument) dict(value any) pdfDict {
+	switch v := d.resolve(value).(type) {
+	case pdfDict:
+		return v
+	case *pdfStream:
+		return v.dict
+	}
+
+	return nil
+}
+
+type pdfPage struct {
+	dict      pdfDict
+	resources pdfDict
+}
+
+// pages returns the pages in order, from the page tree of the catalog or,
+// if there is none, in the order of the object numbers.
+func (d *pdfDocument) pages() []pdfPage {
+	var pages []pdfPage
+
+	visited := make(map[any]bool)
+
+	var walk func(node pdfDict, resources pdfDict, depth int)
+	walk = func(node pdfDict, resources pdfDict, depth int) {
+		if node == nil || depth > 64 {
+			return
+		}
+
+		if own := d.dict(node["Resources"]); own != nil {
+			resources = own
+		}
+
+		if node["Type"] == pdfName("Page") {
+			pages = append(pages, pdfPage{dict: node, resources: resources})
+			return
+		}
+
+		kids, _ := d.resolve(node["Kids"]).(pdfArray)
+		for _, kid := range kids {
+			if ref, ok := kid.(pdfRef); ok {
+				if visited[ref] {
+					continue
+				}
+
+				visited[ref] = true
+			}
+
+			walk(d.dict(kid), resources, depth+1)
+		}
+	}
+
+	for _, num := range d.sortedObjectNumbers() {
+		if catalog, ok := d.objects[num].(pdfDict); ok && catalog["Type"] == pdfName("Catalog") {
+			walk(d.dict(catalog["Pages"]), nil, 0)
+			break
+		}
+	}
+
+	if len(pages) > 0 {
+		return pages
+	}
+
+	for _, num := range d.sortedObjectNumbers() {
+		if page, ok := d.objects[num].(pdfDict); ok && page["Type"] == pdfName("Page") {
+			pages = append(pages, pdfPage{dict: page, resources: d.dict(page["Resources"])})
+		}
+	}
+
+	return pages
+}
+
+func (d *pdfDocument) sortedObjectNumbers() []int {
+	nums := make([]int, 0, len(d.objects))
+	for num := range d.objects {
+		nums = append(nums, num)
+	}
+
+	slices.Sort(nums)
+
+	return nums
+}
+
+func (d *pdfDocument) pageText(page pdfPage) string {
+	var content []byte
+
+	contents := d.resolve(page.dict["Contents"])
+	if stream, ok := contents.(*pdfStream); ok {
+		contents = pdfArray{stream}
+	}
+
+	parts, _ := contents.(pdfArray)
+	for _, part := range parts {
+		if stream, ok := d.resolve(part).(*pdfStream); ok {
+			if data, err := d.decode(stream); err == nil {
+				content = append(content, data...)
+				content = append(content, '\n')
+			}
+		}
+	}
+
+	fonts := d.dict(page.resources["Font"])
+
+	return d.showText(content, func(name pdfName) *fontDecoder {
+		return d.fontDecoder(fonts[name])
+	})
+}
+
+// showText interprets the text operators of a content stream.
+func (d *pdfDocument) showText(content []byte, font func(pdfName) *fontDecoder) string { //nolint:cyclop,funlen
+	var (
+		text     strings.Builder
+		operands []any
+		current  *fontDecoder
+		lastY    = math.NaN()
+	)
+
+	newline := func() {
+		if text.Len() > 0 && !strings.HasSuffix(text.String(), "\n") {
+			text.WriteString("\n")
+		}
+	}
+
+	show := func(value any) {
+		if s, ok := value.(pdfString); ok {
+			text.WriteString(current.decode(s))
+		}
+	}
+
+	lex := &pdfLexer{data: content}
+
+	for {
+		value, err := lex.parseObject()
+		if err != nil {
+			break
+		}
+
+		operator, ok := value.(pdfKeyword)
+		if !ok {
+			operands = append(operands, value)
+			continue
+		}
+
+		switch operator {
+		case "Tf":
+			if len(operands) >= 2 {
+				if name, ok := operands[0].(pdfName); ok {
+					current = font(name)
+				}
+			}
+		case "Tj":
+			if len(operands) >= 1 {
+				show(operands[len(operands)-1])
+			}
+		case "'":
+			newline()
+
+			if len(operands) >= 1 {
+				show(operands[len(operands)-1])
+			}
+		case `"`:
+			newline()
+
+			if len(operands) >= 3 {
+				show(operands[2])
+			}
+		case "TJ":
+			if len(operands) >= 1 {
+				items, _ := operands[len(operands)-1].(pdfArray)
+				for _, item := range items {
+					// a large negative adjustment separates words
+					if n, ok := item.(float64); ok && n < -200 {
+						text.WriteString(" ")
+					}
+
+					show(item)
+				}
+			}
+		case "Td", "TD":
+			if len(operands) >= 2 {
+				if ty, ok := operands[1].(float64); ok && ty != 0 {
+					newline()
+				} else {
+					text.WriteString(" ")
+				}
+			}
+		case "T*":
+			newline()
+		case "Tm":
+			if len(operands) >= 6 {
+				if y, ok := operands[5].(float64); ok {
+					if !math.IsNaN(lastY) && math.Abs(y-lastY) > 1 {
+						newline()
+					}
+
+					lastY = y
+				}
+			}
+		case "ET":
+			text.WriteString(" ")
+		case "ID":
+			lex.skipInlineImage()
+		}
+
+		operands = operands[:0]
+	}
+
+	return collapseSpaces(text.String())
+}
+
+var (
+	spaceRun     = regexp.MustCompile(`[ \t]+`) //nolint:gochecknoglobals
+	spaceNewline = regexp.MustCompile(` *\n *`) //nolint:gochecknoglobals
+	blankLines   = regexp.MustCompile(`\n{3,}`) //nolint:gochecknoglobals
+)
+
+func collapseSpaces(text string) string {
+	text = spaceRun.ReplaceAllString(text, " ")
+	text = spaceNewline.ReplaceAllString(text, "\n")
+	text = blankLines.ReplaceAllString(text, "\n\n")
+
+	return strings.TrimSpace(text) + "\n"
+}
+
+// decode decompresses a stream. Only FlateDecode, by far the most common
+// filter, is supported.
+func (d *pdfDocument) decode(stream *pdfStream) ([]byte, error) {
+	filters := d.resolve(stream.dict["Filter"])
+	if name, ok := filters.(pdfName); ok {
+		filters = pdfArray{name}
+	}
+
+	data := stream.data
+	list, _ := filters.(pdfArray)
+
+	for _, filter := range list {
+		if d.resolve(filter) != pdfName("FlateDecode") {
+			return nil, fmt.Errorf("unsupported filter %v", filter)
+		}
+
+		reader, err := zlib.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("error decompressing stream: %w", err)
+		}
+
+		decoded, err := io.ReadAll(io.LimitReader(reader, maxStreamBytes))
+		if err != nil && len(decoded) == 0 {
+			return nil, fmt.Errorf("error decompressing stream: %w", err)
+		}
+
+		data = decoded
+	}
+
+	return data, nil
+}
+
+// fontDecoder maps the character codes of a font to text, using the
+// ToUnicode map of the font when it has one.
+type fontDecoder struct {
+	codeBytes int
+	toUnicode map[uint32]string
+}
+
+func (d *pdfDocument) fontDecoder(value any) *fontDecoder {
+	font := d.dict(value)
+	if font == nil {
+		return nil
+	}
+
+	decoder := &fontDecoder{codeBytes: 1}
+	if font["Subtype"] == pdfName("Type0") {
+		decoder.codeBytes = 2
+	}
+
+	stream, ok := d.resolve(font["ToUnicode"]).(*pdfStream)
+	if !ok {
+		return decoder
+	}
+
+	if cached, ok := d.fonts[stream]; ok {
+		return cached
+	}
+
+	if data, err := d.decode(stream); err == nil {
+		decoder.toUnicode = parseToUnicode(data)
+	}
+
+	d.fonts[stream] = decoder
+
+	return decoder
+}
+
+func (f *fontDecoder) decode(s pdfString) string {
+	if f == nil || (f.toUnicode == nil && f.codeBytes == 1) {
+		// without a map, assume the codes are Latin-1, as they are for the
+		// standard fonts
+		runes := make([]rune, len(s))
+		for i, b := range s {
+			runes[i] = rune(b)
+		}
+
+		return string(runes)
+	}
+
+	var text strings.Builder
+
+	for i := 0; i+f.codeBytes <= len(s); i += f.codeBytes {
+		var code uint32
+		for _, b := range s[i : i+f.codeBytes] {
+			code = code<<8 | uint32(b)
+		}
+
+		text.WriteString(f.toUnicode[code])
+	}
+
+	return text.String()
+}
+
+// parseToUnicode parses the bfchar and bfrange mappings of a ToUnicode CMap.
+func parseToUnicode(data []byte) map[uint32]string { //nolint:cyclop
+	mapping := make(map[uint32]string)
+	lex := &pdfLexer{data: data}
+
+	var operands []any
+
+	for {
+		value, err := lex.parseObject()
+		if err != nil {
+			break
+		}
+
+		keyword, ok := value.(pdfKeyword)
+		if !ok {
+			operands = append(operands, value)
+			continue
+		}
+
+		switch keyword {
+		case "endbfchar":
+			for i := 0; i+1 < len(operands); i += 2 {
+				src, ok1 := operands[i].(pdfString)
+				dst, ok2 := operands[i+1].(pdfString)
+
+				if ok1 && ok2 {
+					mapping[codeOf(src)] = utf16String(dst)
+				}
+			}
+		case "endbfrange":
+			for i := 0; i+2 < len(operands); i += 3 {
+				lo, ok1 := operands[i].(pdfString)
+				hi, ok2 := operands[i+1].(pdfString)
+
+				if !ok1 || !ok2 || codeOf(hi) < codeOf(lo) || codeOf(hi)-codeOf(lo) > 0xffff {
+					continue
+				}
+
+				switch dst := operands[i+2].(type) {
+				case pdfString:
+					base := []rune(utf16String(dst))
+					if len(base) == 0 {
+						continue
+					}
+
+					for code := codeOf(lo); code <= codeOf(hi); code++ {
+						last := base[len(base)-1] + rune(code-codeOf(lo))
+						mapping[code] = string(base[:len(base)-1]) + string(last)
+					}
+				case pdfArray:
+					for j, item := range dst {
+						if s, ok := item.(pdfString); ok {
+							mapping[codeOf(lo)+uint32(j)] = utf16String(s)
+						}
+					}
+				}
+			}
+		}
+
+		if strings.HasPrefix(string(keyword), "end") || strings.HasPrefix(string(keyword), "begin") {
+			operands = operands[:0]
+		}
+	}
+
+	return mapping
+}
+
+func codeOf(s pdfString) uint32 {
+	var code uint32
+	for _, b := range s {
+		code = code<<8 | uint32(b)
+	}
+
+	return code
+}
+
+func utf16String(s pdfString) string {
+	units := make([]uint16, 0, len(s)/2)
+	for i := 0; i+1 < len(s); i += 2 {
+		units = append(units, uint16(s[i])<<8|uint16(s[i+1]))
+	}
+
+	return string(utf16.Decode(units))
+}
+
+func atoi(b []byte) int {
+	n := 0
+	for _, c := range b {
+		n = n*10 + int(c-'0')
+	}
+
+	return n
+}
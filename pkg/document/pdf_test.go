@@ -0,0 +1,62 @@
+package document
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// minimalPDF returns a one-page PDF showing the text, followed by the extra
+// objects and trailer.
+func minimalPDF(text, extra, trailer string) []byte {
+	content := fmt.Sprintf("BT /F1 12 Tf 72 712 Td (%s) Tj ET", text)
+
+	return []byte("%PDF-1.4\n" +
+		"1 0 obj << /Type /Catalog /Pages 2 0 R >> endobj\n" +
+		"2 0 obj << /Type /Pages /Kids [3 0 R] /Count 1 >> endobj\n" +
+		"3 0 obj << /Type /Page /Parent 2 0 R /Contents 4 0 R >> endobj\n" +
+		fmt.Sprintf("4 0 obj << /Length %d >>\nstream\n%s\nendstream\nendobj\n", len(content), content) +
+		extra +
+		"trailer\n" + trailer + "\n%%EOF\n")
+}
+
+func TestExtractPDF(t *testing.T) {
+	text, err := ExtractText("doc.pdf", minimalPDF("Hello, world", "", "<< /Root 1 0 R >>"))
+
+	require.NoError(t, err)
+	assert.Equal(t, "[page 1]\nHello, world\n", text)
+}
+
+func TestExtractPDFMentioningEncrypt(t *testing.T) {
+	text, err := ExtractText("doc.pdf", minimalPDF("See /Encrypt in the spec", "", "<< /Root 1 0 R >>"))
+
+	require.NoError(t, err)
+	assert.Contains(t, text, "/Encrypt")
+}
+
+func TestExtractPDFEncrypted(t *testing.T) {
+	_, err := ExtractText("doc.pdf", minimalPDF("Secret", "", "<< /Root 1 0 R /Encrypt 9 0 R >>"))
+
+	assert.ErrorIs(t, err, errEncrypted)
+}
+
+func TestExtractPDFObjectStreamOffsetOutOfRange(t *testing.T) {
+	extra := "5 0 obj << /Type /ObjStm /N 1 /First 7 /Length 7 >>\nstream\n6 -100\nendstream\nendobj\n"
+
+	text, err := ExtractText("doc.pdf", minimalPDF("Hello", extra, "<< /Root 1 0 R >>"))
+
+	require.NoError(t, err)
+	assert.Equal(t, "[page 1]\nHello\n", text)
+}
+
+func TestExtractPDFLargeObjectNumber(t *testing.T) {
+	start := time.Now()
+
+	_, err := ExtractText("doc.pdf", minimalPDF("Hello", "900000000 0 obj << >> endobj\n", "<< /Root 1 0 R >>"))
+
+	require.NoError(t, err)
+	assert.Less(t, time.Since(start), time.Second)
+}
@@ -0,0 +1,364 @@
+package document
+
+import (
+	"bytes"
+	"errors"
+	"strconv"
+)
+
+// maxNesting bounds the depth of nested arrays and dictionaries.
+const maxNesting = 64
+
+var errEndOfData = errors.New("end of data")
+
+// pdfLexer parses the objects of a PDF file or content stream.
+type pdfLexer struct {
+	data  []byte
+	pos   int
+	depth int
+}
+
+func isPDFWhitespace(c byte) bool {
+	return c == ' ' || c == '\n' || c == '\r' || c == '\t' || c == '\f' || c == 0
+}
+
+func isPDFDelimiter(c byte) bool {
+	return bytes.IndexByte([]byte("()<>[]{}/%"), c) >= 0
+}
+
+func (l *pdfLexer) skipWhitespace() {
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+
+		switch {
+		case isPDFWhitespace(c):
+			l.pos++
+		case c == '%':
+			for l.pos < len(l.data) && l.data[l.pos] != '\n' && l.data[l.pos] != '\r' {
+				l.pos++
+			}
+		default:
+			return
+		}
+	}
+}
+
+// parseObject parses the next object. Keywords, such as the operators of a
+// content stream, are returned as pdfKeyword.
+func (l *pdfLexer) parseObject() (any, error) { //nolint:cyclop
+	l.skipWhitespace()
+
+	if l.pos >= len(l.data) {
+		return nil, errEndOfData
+	}
+
+	c := l.data[l.pos]
+
+	switch {
+	case c == '<' && l.pos+1 < len(l.data) && l.data[l.pos+1] == '<':
+		l.pos += 2
+		return l.parseDict()
+	case c == '<':
+		l.pos++
+		return l.parseHexString(), nil
+	case c == '(':
+		l.pos++
+		return l.parseLiteralString(), nil
+	case c == '[':
+		l.pos++
+		return l.parseArray()
+	case c == '/':
+		l.pos++
+		return pdfName(l.readRegular()), nil
+	case c == ']' || c == '>' || c == ')' || c == '{' || c == '}':
+		l.pos++
+		return pdfKeyword(c), nil
+	}
+
+	word := l.readRegular()
+	if word == "" {
+		l.pos++
+		return pdfKeyword(c), nil
+	}
+
+	if n, err := strconv.ParseFloat(word, 64); err == nil {
+		return l.maybeRef(n), nil
+	}
+
+	switch word {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	case "null":
+		return nil, nil
+	}
+
+	return pdfKeyword(word), nil
+}
+
+// maybeRef turns "12 0 R" into a reference to object 12.
+func (l *pdfLexer) maybeRef(n float64) any {
+	if n != float64(int(n)) || n < 0 {
+		return n
+	}
+
+	start := l.pos
+
+	l.skipWhitespace()
+
+	gen := l.readRegular()
+	if _, err := strconv.Atoi(gen); err != nil {
+		l.pos = start
+		return n
+	}
+
+	l.skipWhitespace()
+
+	if l.readRegular() != "R" {
+		l.pos = start
+		return n
+	}
+
+	return pdfRef{num: int(n)}
+}
+
+func (l *pdfLexer) readRegular() string {
+	start := l.pos
+	for l.pos < len(l.data) && !isPDFWhitespace(l.data[l.pos]) && !isPDFDelimiter(l.data[l.pos]) {
+		l.pos++
+	}
+
+	return string(l.data[start:l.pos])
+}
+
+func (l *pdfLexer) parseDict() (any, error) {
+	if l.depth++; l.depth > maxNesting {
+		return nil, errors.New("objects nested too deeply")
+	}
+	defer func() { l.depth-- }()
+
+	dict := make(pdfDict)
+
+	for {
+		key, err := l.parseObject()
+		if err != nil {
+			return nil, err
+		}
+
+		if key == pdfKeyword(">") {
+			// the second > of >>
+			if l.pos < len(l.data) && l.data[l.pos] == '>' {
+				l.pos++
+			}
+
+			return dict, nil
+		}
+
+		name, ok := key.(pdfName)
+		if !ok {
+			continue
+		}
+
+		value, err := l.parseObject()
+		if err != nil {
+			return nil, err
+		}
+
+		if value == pdfKeyword(">") {
+			if l.pos < len(l.data) && l.data[l.pos] == '>' {
+				l.pos++
+			}
+
+			return dict, nil
+		}
+
+		dict[name] = value
+	}
+}
+
+func (l *pdfLexer) parseArray() (any, error) {
+	if l.depth++; l.depth > maxNesting {
+		return nil, errors.New("objects nested too deeply")
+	}
+	defer func() { l.depth-- }()
+
+	var array pdfArray
+
+	for {
+		value, err := l.parseObject()
+		if err != nil {
+			return nil, err
+		}
+
+		if value == pdfKeyword("]") {
+			return array, nil
+		}
+
+		array = append(array, value)
+	}
+}
+
+func (l *pdfLexer) parseHexString() pdfString {
+	var digits []byte
+
+	for l.pos < len(l.data) && l.data[l.pos] != '>' {
+		if c := l.data[l.pos]; isHexDigit(c) {
+			digits = append(digits, c)
+		}
+
+		l.pos++
+	}
+
+	l.pos++
+
+	if len(digits)%2 == 1 {
+		digits = append(digits, '0')
+	}
+
+	s := make(pdfString, len(digits)/2)
+	for i := range s {
+		s[i] = hexValue(digits[2*i])<<4 | hexValue(digits[2*i+1])
+	}
+
+	return s
+}
+
+func (l *pdfLexer) parseLiteralString() pdfString { //nolint:cyclop
+	var s pdfString
+
+	depth := 1
+
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		l.pos++
+
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			if depth--; depth == 0 {
+				return s
+			}
+		case '\\':
+			if l.pos >= len(l.data) {
+				return s
+			}
+
+			c = l.data[l.pos]
+			l.pos++
+
+			switch c {
+			case 'n':
+				c = '\n'
+			case 'r':
+				c = '\r'
+			case 't':
+				c = '\t'
+			case 'b':
+				c = '\b'
+			case 'f':
+				c = '\f'
+			case '\r', '\n':
+				// an escaped line break is a continuation
+				if c == '\r' && l.pos < len(l.data) && l.data[l.pos] == '\n' {
+					l.pos++
+				}
+
+				continue
+			default:
+				if c >= '0' && c <= '7' {
+					value := int(c - '0')
+
+					for i := 0; i < 2 && l.pos < len(l.data) && l.data[l.pos] >= '0' && l.data[l.pos] <= '7'; i++ {
+						value = value*8 + int(l.data[l.pos]-'0')
+						l.pos++
+					}
+
+					c = byte(value)
+				}
+			}
+		}
+
+		s = append(s, c)
+	}
+
+	return s
+}
+
+// peekKeyword reports whether the next token is the keyword.
+func (l *pdfLexer) peekKeyword(keyword string) bool {
+	start := l.pos
+	defer func() { l.pos = start }()
+
+	l.skipWhitespace()
+
+	return l.readRegular() == keyword
+}
+
+// readStreamData reads the data following the stream keyword, using the
+// /Length of the dictionary when it is given directly and looks right.
+func (l *pdfLexer) readStreamData(dict pdfDict) []byte {
+	l.skipWhitespace()
+	l.readRegular()
+
+	if l.pos < len(l.data) && l.data[l.pos] == '\r' {
+		l.pos++
+	}
+
+	if l.pos < len(l.data) && l.data[l.pos] == '\n' {
+		l.pos++
+	}
+
+	start := l.pos
+
+	if length, ok := dict["Length"].(float64); ok && length >= 0 && start+int(length) <= len(l.data) {
+		end := start + int(length)
+		rest := l.data[end:min(end+32, len(l.data))]
+
+		if bytes.Contains(rest, []byte("endstream")) {
+			l.pos = end
+			return l.data[start:end]
+		}
+	}
+
+	end := bytes.Index(l.data[start:], []byte("endstream"))
+	if end < 0 {
+		l.pos = len(l.data)
+		return l.data[start:]
+	}
+
+	l.pos = start + end + len("endstream")
+
+	return bytes.TrimRight(l.data[start:start+end], "\r\n")
+}
+
+// skipInlineImage skips the binary data of an inline image, up to EI.
+func (l *pdfLexer) skipInlineImage() {
+	for l.pos+2 < len(l.data) {
+		if isPDFWhitespace(l.data[l.pos]) && l.data[l.pos+1] == 'E' && l.data[l.pos+2] == 'I' &&
+			(l.pos+3 == len(l.data) || isPDFWhitespace(l.data[l.pos+3])) {
+			l.pos += 3
+			return
+		}
+
+		l.pos++
+	}
+
+	l.pos = len(l.data)
+}
+
+func isHexDigit(c byte) bool {
+	return (c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
+
+func hexValue(c byte) byte {
+	switch {
+	case c >= 'a':
+		return c - 'a' + 10
+	case c >= 'A':
+		return c - 'A' + 10
+	}
+
+	return c - '0'
+}
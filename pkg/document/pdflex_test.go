@@ -0,0 +1,50 @@
+package document
+
+import (
+	"testing"
+)
+
+func FuzzPDFLexer(f *testing.F) {
+	f.Add([]byte("<< /Type /Page /Kids [1 0 R 2 0 R] /Name (a\\(b\\)c) /Hex <48656c6c6f> >>"))
+	f.Add([]byte("BT /F1 12 Tf 72 712 Td [(Hel) -300 (lo)] TJ ET"))
+	f.Add([]byte("1 0 obj << /Length 5 >>\nstream\nhello\nendstream\nendobj"))
+	f.Add([]byte("5 -100 [[[[ << << ("))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		lex := &pdfLexer{data: data}
+
+		for i := 0; i <= len(data); i++ {
+			start := lex.pos
+
+			value, err := lex.parseObject()
+			if err != nil {
+				return
+			}
+
+			if dict, ok := value.(pdfDict); ok && lex.peekKeyword("stream") {
+				lex.readStreamData(dict)
+			}
+
+			if lex.pos <= start {
+				t.Fatalf("lexer did not advance at %d", start)
+			}
+		}
+	})
+}
+
+func FuzzExtractPDF(f *testing.F) {
+	f.Add(minimalPDF("Hello", "", "<< /Root 1 0 R >>"))
+	f.Add(minimalPDF("Hello", "5 0 obj << /Type /ObjStm /N 1 /First 7 /Length 7 >>\nstream\n6 -100\nendstream\nendobj\n",
+		"<< /Root 1 0 R >>"))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		doc := &pdfDocument{objects: make(map[int]any), fonts: make(map[*pdfStream]*fontDecoder)}
+		doc.scanObjects(data)
+		doc.encrypted(data)
+		doc.expandObjectStreams()
+
+		for _, page := range doc.pages() {
+			doc.pageText(page)
+		}
+	})
+}
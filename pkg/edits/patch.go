@@ -0,0 +1,290 @@
+package edits
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const devNull = "/dev/null"
+
+// hunkHeader matches "@@ -12,7 +12,9 @@", the counts being optional.
+var hunkHeader = regexp.MustCompile(`^@@ -(\d+)(?:,\d+)? \+(\d+)(?:,\d+)? @@`) //nolint:gochecknoglobals
+
+// FilePatch is the change to a single file in a unified diff.
+type FilePatch struct {
+	// OldPath is empty when the file is created.
+	OldPath string
+	// NewPath is empty when the file is deleted.
+	NewPath string
+	Hunks   []Hunk
+}
+
+// Hunk is a contiguous change. Lines keep their ' ', '-' or '+' prefix.
+type Hunk struct {
+	OldStart int
+	Lines    []string
+}
+
+// Path returns the path the patch writes to, or deletes.
+func (p *FilePatch) Path() string {
+	if p.NewPath != "" {
+		return p.NewPath
+	}
+
+	return p.OldPath
+}
+
+// Stats returns the number of added and removed lines.
+func (p *FilePatch) Stats() (int, int) {
+	added, removed := 0, 0
+
+	for _, hunk := range p.Hunks {
+		for _, line := range hunk.Lines {
+			switch line[0] {
+			case '+':
+				added++
+			case '-':
+				removed++
+			}
+		}
+	}
+
+	return added, removed
+}
+
+// Parse extracts the edits from a response, either SEARCH/REPLACE blocks or
+// unified diffs. Fenced diff or patch blocks are used if there are any,
+// otherwise the whole text is parsed as a diff.
+func Parse(text string) ([]FilePatch, error) {
+	if hasSearchReplace(text) {
+		return parseSearchReplace(text)
+	}
+
+	blocks := fencedDiffs(text)
+	if len(blocks) == 0 {
+		blocks = []string{text}
+	}
+
+	var patches []FilePatch
+
+	for _, block := range blocks {
+		parsed, err := parseUnifiedDiff(block)
+		if err != nil {
+			return nil, err
+		}
+
+		patches = append(patches, parsed...)
+	}
+
+	return patches, nil
+}
+
+func fencedDiffs(text string) []string {
+	var (
+		blocks  []string
+		current strings.Builder
+		inDiff  bool
+		inOther bool
+	)
+
+	for _, line := range strings.Split(text, "\n") {
+		trimmed := strings.TrimSpace(line)
+
+		switch {
+		case (inDiff || inOther) && trimmed == "```":
+			if inDiff {
+				blocks = append(blocks, current.String())
+				current.Reset()
+			}
+
+			inDiff, inOther = false, false
+		case inDiff:
+			current.WriteString(line + "\n")
+		case !inOther && strings.HasPrefix(trimmed, "```"):
+			lang := strings.TrimPrefix(trimmed, "```")
+			if fields := strings.Fields(lang); len(fields) > 0 {
+				lang = fields[0]
+			}
+
+			switch lang {
+			case "diff", "patch", "udiff":
+				inDiff = true
+			default:
+				inOther = true
+			}
+		}
+	}
+
+	return blocks
+}
+
+func parseUnifiedDiff(text string) ([]FilePatch, error) { //nolint:cyclop
+	lines := strings.Split(strings.TrimRight(text, "\n"), "\n")
+
+	var (
+		patches []FilePatch
+		patch   *FilePatch
+		hunk    *Hunk
+	)
+
+	for i := 0; i < len(lines); i++ {
+		line := strings.TrimSuffix(lines[i], "\r")
+
+		if strings.HasPrefix(line, "--- ") && i+1 < len(lines) && strings.HasPrefix(lines[i+1], "+++ ") {
+			patches = append(patches, FilePatch{
+				OldPath: diffPath(line[4:], "a/"),
+				NewPath: diffPath(strings.TrimSuffix(lines[i+1], "\r")[4:], "b/"),
+			})
+			patch, hunk = &patches[len(patches)-1], nil
+			i++
+
+			continue
+		}
+
+		if match := hunkHeader.FindStringSubmatch(line); match != nil {
+			if patch == nil {
+				return nil, fmt.Errorf("hunk %q has no file header", line)
+			}
+
+			start, _ := strconv.Atoi(match[1])
+			patch.Hunks = append(patch.Hunks, Hunk{OldStart: start})
+			hunk = &patch.Hunks[len(patch.Hunks)-1]
+
+			continue
+		}
+
+		if hunk == nil {
+			continue // "diff --git", "index" and other preamble
+		}
+
+		switch {
+		case line == "":
+			// blank context lines often lose their leading space
+			hunk.Lines = append(hunk.Lines, " ")
+		case line[0] == ' ' || line[0] == '+' || line[0] == '-':
+			hunk.Lines = append(hunk.Lines, line)
+		case strings.HasPrefix(line, `\ `):
+			// "\ No newline at end of file"
+		default:
+			hunk = nil
+		}
+	}
+
+	for _, p := range patches {
+		if len(p.Hunks) == 0 && p.NewPath != "" {
+			return nil, fmt.Errorf("the diff for %s has no changes", p.Path())
+		}
+	}
+
+	return patches, nil
+}
+
+// diffPath returns the path from a "---" or "+++" header, without the
+// timestamp some tools append and the a/ or b/ prefix git adds.
+func diffPath(header, prefix string) string {
+	path, _, _ := strings.Cut(header, "\t")
+	path = strings.TrimSpace(path)
+
+	if path == devNull {
+		return ""
+	}
+
+	return strings.TrimPrefix(path, prefix)
+}
+
+// Apply applies the hunks of the patch to content. Hunks are located by
+// their context rather than trusting the line numbers, which models often
+// get wrong, and trailing whitespace is ignored when comparing lines.
+func Apply(content string, patch *FilePatch) (string, error) {
+	if patch.NewPath == "" {
+		return "", nil
+	}
+
+	trailingNewline := content == "" || strings.HasSuffix(content, "\n")
+
+	var lines []string
+	if content != "" {
+		lines = strings.Split(strings.TrimSuffix(content, "\n"), "\n")
+	}
+
+	from := 0
+
+	for n, hunk := range patch.Hunks {
+		var before, after []string
+
+		for _, line := range hunk.Lines {
+			switch line[0] {
+			case ' ':
+				before = append(before, line[1:])
+				after = append(after, line[1:])
+			case '-':
+				before = append(before, line[1:])
+			case '+':
+				after = append(after, line[1:])
+			}
+		}
+
+		at := locate(lines, before, from, hunk.OldStart-1)
+		if at < 0 && hunk.OldStart == 0 {
+			// without a line number, as for SEARCH/REPLACE blocks, the
+			// hunks may come in any order
+			at = locate(lines, before, 0, -1)
+		}
+
+		if at < 0 {
+			return "", fmt.Errorf("hunk %d of %s does not match the file", n+1, patch.Path())
+		}
+
+		lines = append(lines[:at], append(after, lines[at+len(before):]...)...)
+		from = at + len(after)
+	}
+
+	result := strings.Join(lines, "\n")
+	if trailingNewline && len(lines) > 0 {
+		result += "\n"
+	}
+
+	return result, nil
+}
+
+// locate finds the position of block in lines at or after from, preferring
+// the match closest to the position the hunk header suggested.
+func locate(lines, block []string, from, hint int) int {
+	if len(block) == 0 {
+		return max(from, min(max(hint+1, 0), len(lines)))
+	}
+
+	best := -1
+
+	for at := from; at+len(block) <= len(lines); at++ {
+		if !matchesAt(lines, block, at) {
+			continue
+		}
+
+		if best < 0 || abs(at-hint) < abs(best-hint) {
+			best = at
+		}
+	}
+
+	return best
+}
+
+func matchesAt(lines, block []string, at int) bool {
+	for i, line := range block {
+		if strings.TrimRight(lines[at+i], " \t") != strings.TrimRight(line, " \t") {
+			return false
+		}
+	}
+
+	return true
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+
+	return n
+}
@@ -0,0 +1,127 @@
+package edits
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/emilkje/cwc/pkg/errors"
+)
+
+// Scope decides which paths edits may write to: only paths inside the
+// repository root, and without confirmation only the files in the context.
+type Scope struct {
+	cwd   string
+	root  string
+	files map[string]bool
+}
+
+// NewScope creates a scope for the repository at root. Paths, both of the
+// files in the context and of the edits, are relative to the current
+// directory.
+func NewScope(root string, files []string) (*Scope, error) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return nil, fmt.Errorf("error getting current directory: %w", err)
+	}
+
+	realRoot, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return nil, fmt.Errorf("error resolving repository root: %w", err)
+	}
+
+	s := &Scope{cwd: cwd, root: realRoot, files: make(map[string]bool)}
+
+	for _, file := range files {
+		if real, err := resolveExisting(filepath.Join(cwd, file)); err == nil {
+			s.files[real] = true
+		}
+	}
+
+	return s, nil
+}
+
+// Resolve returns the absolute path an edit of path writes to. It returns an
+// errors.UnsafePathError for paths that escape the repository root, directly
+// or through a symlink, or that point into the .git or .hg directory, and an
+// errors.OutOfScopeError along with the path for files that are not in the
+// context.
+func (s *Scope) Resolve(path string) (string, error) {
+	if path == "" {
+		return "", errors.UnsafePathError{Path: path, Reason: "the path is empty"}
+	}
+
+	if filepath.IsAbs(path) || filepath.VolumeName(path) != "" {
+		return "", errors.UnsafePathError{Path: path, Reason: "absolute paths are not allowed"}
+	}
+
+	abs := filepath.Join(s.cwd, path)
+
+	real, err := resolveExisting(abs)
+	if err != nil {
+		return "", fmt.Errorf("error resolving %s: %w", path, err)
+	}
+
+	rel, err := filepath.Rel(s.root, real)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		reason := "it is outside the repository"
+		if lexical, err := filepath.Rel(s.root, abs); err == nil && !strings.HasPrefix(lexical, "..") {
+			reason = "it resolves through a symlink to " + real
+		}
+
+		return "", errors.UnsafePathError{Path: path, Reason: reason}
+	}
+
+	if rel == "." || slices.ContainsFunc(strings.Split(rel, string(filepath.Separator)), isVCSDir) {
+		return "", errors.UnsafePathError{Path: path, Reason: "it is not a file in the working tree"}
+	}
+
+	if !s.files[real] {
+		return abs, errors.OutOfScopeError{Path: path}
+	}
+
+	return abs, nil
+}
+
+// isVCSDir reports whether a path component is the metadata directory of
+// git or Mercurial. Case is ignored, as it is on the file systems of macOS
+// and Windows.
+func isVCSDir(name string) bool {
+	return strings.EqualFold(name, ".git") || strings.EqualFold(name, ".hg")
+}
+
+// resolveExisting resolves the symlinks in the longest existing prefix of an
+// absolute path and appends the remainder, which is yet to be created.
+func resolveExisting(path string) (string, error) {
+	existing := filepath.Clean(path)
+
+	var missing []string
+
+	for {
+		_, err := os.Lstat(existing)
+		if err == nil {
+			break
+		}
+
+		if !os.IsNotExist(err) {
+			return "", fmt.Errorf("error reading %s: %w", existing, err)
+		}
+
+		parent := filepath.Dir(existing)
+		if parent == existing {
+			break
+		}
+
+		missing = append([]string{filepath.Base(existing)}, missing...)
+		existing = parent
+	}
+
+	real, err := filepath.EvalSymlinks(existing)
+	if err != nil {
+		return "", fmt.Errorf("error resolving symlinks: %w", err)
+	}
+
+	return filepath.Join(append([]string{real}, missing...)...), nil
+}
@@ -0,0 +1,164 @@
+package edits
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// The formats the model can be asked to write edits in.
+const (
+	// FormatDiff is a unified diff, the default.
+	FormatDiff = "diff"
+	// FormatSearchReplace is a block of the exact lines to replace and the
+	// lines replacing them, which needs no line numbers.
+	FormatSearchReplace = "search-replace"
+)
+
+//nolint:gochecknoglobals
+var (
+	searchMarker  = regexp.MustCompile(`^<{5,9} ?SEARCH$`)
+	dividerMarker = regexp.MustCompile(`^={5,9}$`)
+	replaceMarker = regexp.MustCompile(`^>{5,9} ?REPLACE$`)
+)
+
+// Formats returns the names of the edit formats.
+func Formats() []string {
+	return []string{FormatDiff, FormatSearchReplace}
+}
+
+// ValidFormat reports whether format names an edit format.
+func ValidFormat(format string) bool {
+	return format == FormatDiff || format == FormatSearchReplace
+}
+
+// Instruction tells the model how to write edits in the format, completing
+// a sentence such as "Reply with the fix ...".
+func Instruction(format string) string {
+	if format == FormatSearchReplace {
+		return "as SEARCH/REPLACE blocks against the files as they are in the context. For each change, write the " +
+			"path of the file on a line of its own, then a fenced block holding a line <<<<<<< SEARCH, the exact " +
+			"lines to replace copied from the file with just enough context to match once, a line =======, the " +
+			"lines replacing them and a line >>>>>>> REPLACE. A new file has an empty SEARCH section"
+	}
+
+	return "as a unified diff against the files as they are in the context, with a/ and b/ paths, in a single " +
+		"```diff block"
+}
+
+func hasSearchReplace(text string) bool {
+	for _, line := range strings.Split(text, "\n") {
+		if searchMarker.MatchString(strings.TrimSpace(line)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// parseSearchReplace reads SEARCH/REPLACE blocks, each following the path of
+// its file or another block for the same file. The blocks of a file become
+// the hunks of a single patch, with the lines to replace removed and the
+// lines replacing them added. A file whose first block has nothing to
+// search for is created.
+func parseSearchReplace(text string) ([]FilePatch, error) { //nolint:cyclop
+	lines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+
+	var (
+		patches []FilePatch
+		path    string
+	)
+
+	index := map[string]int{}
+
+	for i := 0; i < len(lines); i++ {
+		if !searchMarker.MatchString(strings.TrimSpace(lines[i])) {
+			if candidate := blockPath(lines[i]); candidate != "" {
+				path = candidate
+			}
+
+			continue
+		}
+
+		if path == "" {
+			return nil, fmt.Errorf("the SEARCH block on line %d doesn't follow the path of a file", i+1)
+		}
+
+		var search, replace []string
+
+		divided, closed := false, false
+
+		for i++; i < len(lines); i++ {
+			trimmed := strings.TrimSpace(lines[i])
+
+			switch {
+			case !divided && dividerMarker.MatchString(trimmed):
+				divided = true
+			case divided && replaceMarker.MatchString(trimmed):
+				closed = true
+			case divided:
+				replace = append(replace, lines[i])
+			default:
+				search = append(search, lines[i])
+			}
+
+			if closed {
+				break
+			}
+		}
+
+		if !closed {
+			return nil, fmt.Errorf("the SEARCH/REPLACE block for %s has no end", path)
+		}
+
+		n, ok := index[path]
+		if !ok {
+			patches = append(patches, FilePatch{OldPath: path, NewPath: path})
+			n = len(patches) - 1
+			index[path] = n
+		}
+
+		patch := &patches[n]
+
+		if len(search) == 0 {
+			if len(patch.Hunks) > 0 {
+				return nil, fmt.Errorf("a SEARCH/REPLACE block for %s has nothing to search for", path)
+			}
+
+			patch.OldPath = ""
+		}
+
+		hunk := Hunk{Lines: make([]string, 0, len(search)+len(replace))}
+
+		for _, line := range search {
+			hunk.Lines = append(hunk.Lines, "-"+line)
+		}
+
+		for _, line := range replace {
+			hunk.Lines = append(hunk.Lines, "+"+line)
+		}
+
+		patch.Hunks = append(patch.Hunks, hunk)
+	}
+
+	return patches, nil
+}
+
+// blockPath returns the path on a line of its own, as written before a
+// block, without the backticks, asterisks or colon around it. Fences and
+// prose return "".
+func blockPath(line string) string {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "```") {
+		return ""
+	}
+
+	line = strings.TrimLeft(line, "#*` ")
+	line = strings.TrimRight(line, "*`: ")
+
+	if line == "" || strings.ContainsAny(line, " \t") || !strings.ContainsAny(line, "./") {
+		return ""
+	}
+
+	return line
+}
@@ -0,0 +1,115 @@
+// Package encryption seals data kept on disk, such as saved sessions, with
+// AES-256-GCM, so that the code in conversations doesn't sit in plaintext.
+// Sealed data is text: a prefix naming the format followed by the nonce and
+// the ciphertext in base64, so it fits in JSON strings and lines of a log.
+package encryption
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	stderrors "errors"
+	"fmt"
+)
+
+// KeySize is the length of a key in bytes.
+const KeySize = 32
+
+// prefix starts all sealed data, and names the version of the format.
+const prefix = "cwc:sealed:v1:"
+
+var (
+	// ErrInvalidKey is returned for keys that aren't KeySize bytes long.
+	ErrInvalidKey = stderrors.New("the encryption key must be 32 bytes")
+	// ErrNoKey is returned when sealed data is read without a key.
+	ErrNoKey = stderrors.New("the data is encrypted, but encryption is not enabled")
+	// ErrDecrypt is returned when sealed data can't be opened, as with
+	// another key or when the data was modified.
+	ErrDecrypt = stderrors.New("the data could not be decrypted, it was encrypted with another key or modified")
+)
+
+// NewKey creates a random key.
+func NewKey() ([]byte, error) {
+	key := make([]byte, KeySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("error creating encryption key: %w", err)
+	}
+
+	return key, nil
+}
+
+// IsSealed reports whether data was sealed with Seal.
+func IsSealed(data []byte) bool {
+	return bytes.HasPrefix(bytes.TrimSpace(data), []byte(prefix))
+}
+
+// Seal encrypts and authenticates plaintext with the key.
+func Seal(key, plaintext []byte) ([]byte, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("error creating nonce: %w", err)
+	}
+
+	sealed := aead.Seal(nonce, nonce, plaintext, []byte(prefix))
+
+	out := make([]byte, len(prefix)+base64.StdEncoding.EncodedLen(len(sealed)))
+	copy(out, prefix)
+	base64.StdEncoding.Encode(out[len(prefix):], sealed)
+
+	return out, nil
+}
+
+// Open decrypts data sealed with Seal. Data that isn't sealed is returned as
+// is, so that data written before encryption was enabled stays readable.
+func Open(key, data []byte) ([]byte, error) {
+	data = bytes.TrimSpace(data)
+	if !bytes.HasPrefix(data, []byte(prefix)) {
+		return data, nil
+	}
+
+	if key == nil {
+		return nil, ErrNoKey
+	}
+
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(string(data[len(prefix):]))
+	if err != nil || len(sealed) < aead.NonceSize() {
+		return nil, ErrDecrypt
+	}
+
+	plaintext, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], []byte(prefix))
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+
+	return plaintext, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	if len(key) != KeySize {
+		return nil, ErrInvalidKey
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("error creating cipher: %w", err)
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("error creating cipher: %w", err)
+	}
+
+	return aead, nil
+}
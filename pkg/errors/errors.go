@@ -63,23 +63,218 @@ func IsFileNotExistError(err error) bool {
 	return errors.As(err, &fileDoesNotExistError)
 }
 
-type GitNotInstalledError struct {
+type NoPromptProvidedError struct {
 	Message string
 }
 
-func (e GitNotInstalledError) Error() string {
+func (e NoPromptProvidedError) Error() string {
 	return e.Message
 }
 
-func IsGitNotInstalledError(err error) bool {
-	var gitNotInstalledError GitNotInstalledError
-	return errors.As(err, &gitNotInstalledError)
+// OfflineError is returned when a network call to a remote host is attempted
+// in offline mode.
+type OfflineError struct {
+	Host string
 }
 
-type NoPromptProvidedError struct {
-	Message string
+func (e OfflineError) Error() string {
+	return fmt.Sprintf("offline mode: refusing to connect to %s, "+
+		"only loopback addresses and localEndpoints from the config file are allowed", e.Host)
 }
 
-func (e NoPromptProvidedError) Error() string {
-	return e.Message
+func IsOfflineError(err error) bool {
+	var offlineError OfflineError
+	return errors.As(err, &offlineError)
+}
+
+// UnsafePathError is returned when an edit targets a path that must never be
+// written to, such as one outside the repository.
+type UnsafePathError struct {
+	Path   string
+	Reason string
+}
+
+func (e UnsafePathError) Error() string {
+	return fmt.Sprintf("refusing to write %s: %s", e.Path, e.Reason)
+}
+
+func IsUnsafePathError(err error) bool {
+	var unsafePathError UnsafePathError
+	return errors.As(err, &unsafePathError)
+}
+
+// OutOfScopeError is returned when an edit targets a file inside the
+// repository that is not part of the context, which requires confirmation.
+type OutOfScopeError struct {
+	Path string
+}
+
+func (e OutOfScopeError) Error() string {
+	return fmt.Sprintf("%s is not part of the context", e.Path)
+}
+
+func IsOutOfScopeError(err error) bool {
+	var outOfScopeError OutOfScopeError
+	return errors.As(err, &outOfScopeError)
+}
+
+// CommandNotAllowedError is returned when a command is not on the sandbox
+// allow-list.
+type CommandNotAllowedError struct {
+	Command string
+}
+
+func (e CommandNotAllowedError) Error() string {
+	return fmt.Sprintf("%s is not allowed, add it to sandbox.allow in .cwc/config.yaml or the config file to run it", e.Command)
+}
+
+func IsCommandNotAllowedError(err error) bool {
+	var commandNotAllowedError CommandNotAllowedError
+	return errors.As(err, &commandNotAllowedError)
+}
+
+// HookVetoError is returned when a hook exits with an error, which stops what
+// it was run for. Reason is what the hook wrote to stderr.
+type HookVetoError struct {
+	Hook   string
+	Reason string
+}
+
+func (e HookVetoError) Error() string {
+	if e.Reason == "" {
+		return fmt.Sprintf("stopped by the hook %q", e.Hook)
+	}
+
+	return fmt.Sprintf("stopped by the hook %q: %s", e.Hook, e.Reason)
+}
+
+func IsHookVetoError(err error) bool {
+	var hookVetoError HookVetoError
+	return errors.As(err, &hookVetoError)
+}
+
+// ContentFilterError is returned when the Azure OpenAI content filter blocks
+// a prompt. Categories lists what was flagged, e.g. "violence (medium)", and
+// Hint suggests which part of the prompt triggered it.
+type ContentFilterError struct {
+	Categories []string
+	Hint       string
+}
+
+func (e ContentFilterError) Error() string {
+	message := "the prompt was blocked by the Azure OpenAI content filter"
+	if len(e.Categories) > 0 {
+		message += " for " + strings.Join(e.Categories, ", ")
+	}
+
+	if e.Hint != "" {
+		message += ". " + e.Hint
+	}
+
+	return message
+}
+
+func IsContentFilterError(err error) bool {
+	var contentFilterError ContentFilterError
+	return errors.As(err, &contentFilterError)
+}
+
+// AuthError is returned when the provider rejects the credentials.
+type AuthError struct {
+	Err error
+}
+
+func (e AuthError) Error() string {
+	return "authentication failed: " + e.Err.Error()
+}
+
+func (e AuthError) Unwrap() error {
+	return e.Err
+}
+
+func IsAuthError(err error) bool {
+	var authError AuthError
+	return errors.As(err, &authError)
+}
+
+// QuotaExceededError is returned when the provider refuses a request
+// because the quota is used up, or, if RateLimited is set, because too many
+// requests were made in a short time.
+type QuotaExceededError struct {
+	RateLimited bool
+	Err         error
+}
+
+func (e QuotaExceededError) Error() string {
+	if e.RateLimited {
+		return "rate limit exceeded: " + e.Err.Error()
+	}
+
+	return "quota exhausted: " + e.Err.Error()
+}
+
+func (e QuotaExceededError) Unwrap() error {
+	return e.Err
+}
+
+func IsQuotaExceededError(err error) bool {
+	var quotaExceededError QuotaExceededError
+	return errors.As(err, &quotaExceededError)
+}
+
+// ModelNotFoundError is returned when the model or deployment doesn't exist.
+type ModelNotFoundError struct {
+	Model string
+	Err   error
+}
+
+func (e ModelNotFoundError) Error() string {
+	return fmt.Sprintf("model %s not found: %s", e.Model, e.Err)
+}
+
+func (e ModelNotFoundError) Unwrap() error {
+	return e.Err
+}
+
+func IsModelNotFoundError(err error) bool {
+	var modelNotFoundError ModelNotFoundError
+	return errors.As(err, &modelNotFoundError)
+}
+
+// ContextLengthExceededError is returned when the prompt doesn't fit the
+// context window of the model.
+type ContextLengthExceededError struct {
+	Err error
+}
+
+func (e ContextLengthExceededError) Error() string {
+	return "the prompt is too long for the model: " + e.Err.Error()
+}
+
+func (e ContextLengthExceededError) Unwrap() error {
+	return e.Err
+}
+
+func IsContextLengthExceededError(err error) bool {
+	var contextLengthExceededError ContextLengthExceededError
+	return errors.As(err, &contextLengthExceededError)
+}
+
+// NetworkTimeoutError is returned when the provider couldn't be reached or
+// didn't answer in time.
+type NetworkTimeoutError struct {
+	Err error
+}
+
+func (e NetworkTimeoutError) Error() string {
+	return "the request timed out: " + e.Err.Error()
+}
+
+func (e NetworkTimeoutError) Unwrap() error {
+	return e.Err
+}
+
+func IsNetworkTimeoutError(err error) bool {
+	var networkTimeoutError NetworkTimeoutError
+	return errors.As(err, &networkTimeoutError)
 }
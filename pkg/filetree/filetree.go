@@ -2,32 +2,65 @@ package filetree
 
 import (
 	"fmt"
+	"log/slog"
 	"os"
 	"path/filepath"
-	"slices"
 	"sort"
 	"strings"
 
+	"github.com/emilkje/cwc/pkg/datasample"
+	"github.com/emilkje/cwc/pkg/document"
+	"github.com/emilkje/cwc/pkg/languages"
 	pm "github.com/emilkje/cwc/pkg/pathmatcher"
-	"github.com/emilkje/cwc/pkg/ui"
 )
 
 type FileNode struct {
 	Name     string
 	IsDir    bool
 	Children []*FileNode
+	// Owners are the owners of a file according to CODEOWNERS, if known.
+	Owners []string
 }
 
+// File is a file gathered as context. Only its metadata is kept in memory;
+// the contents are read from disk when they are needed.
 type File struct {
 	Path string
-	Data []byte
 	Type string
+	Size int64
+	// Owners are the users and teams that own the file according to
+	// CODEOWNERS, if known. They are shown in the file tree.
+	Owners []string
+}
+
+// ReadContents reads the contents of the file.
+func (f *File) ReadContents() ([]byte, error) {
+	data, err := os.ReadFile(f.Path) // #nosec
+	if err != nil {
+		return nil, fmt.Errorf("error reading file: %w", err)
+	}
+
+	return data, nil
 }
 
 type FileGatherOptions struct {
 	IncludeMatcher pm.PathMatcher
 	ExcludeMatcher pm.PathMatcher
 	PathScopes     []string
+	// Languages limits the files to those detected as one of the given
+	// canonical language names, see languages.Resolve. All languages are
+	// included if it is empty.
+	Languages []string
+	// OnProgress is called every time a file has been considered, if set.
+	OnProgress func(progress GatherProgress)
+}
+
+// GatherProgress describes how far GatherFiles has come.
+type GatherProgress struct {
+	Scanned  int
+	Included int
+	Skipped  int
+	Bytes    int64
 }
 
 func GatherFiles(opts *FileGatherOptions) ([]File, *FileNode, error) { //nolint:funlen,gocognit,cyclop
@@ -37,7 +70,24 @@ func GatherFiles(opts *FileGatherOptions) ([]File, *FileNode, error) { //nolint:
 
 	var files []File
 
-	knownLanguage := cachedLanguageChecker()
+	var progress GatherProgress
+
+	reportProgress := func(included bool, size int64) {
+		progress.Scanned++
+
+		if included {
+			progress.Included++
+			progress.Bytes += size
+		} else {
+			progress.Skipped++
+		}
+
+		if opts.OnProgress != nil {
+			opts.OnProgress(progress)
+		}
+	}
+
+	detector := languages.NewDetector()
 
 	rootNode := &FileNode{Name: "/", IsDir: true, Children: []*FileNode{}}
 
@@ -52,68 +102,57 @@ func GatherFiles(opts *FileGatherOptions) ([]File, *FileNode, error) { //nolint:
 				return nil
 			}
 
-			if !includeMatcher.Match(path) || info.IsDir() || excludeMatcher.Match(path) {
-				return nil
-			}
-
-			fileType, ok := knownLanguage(path)
+			if info.IsDir() {
+				// don't descend into directories that are ignored as a whole
+				if dirMatcher, ok := excludeMatcher.(pm.DirMatcher); ok && dirMatcher.MatchDir(path) {
+					return filepath.SkipDir
+				}
 
-			if !ok {
-				ui.PrintMessage("skipping unknown file type: "+path+"\n", ui.MessageTypeWarning)
 				return nil
 			}
 
-			file := &File{
-				Path: path,
-				Type: fileType,
-				Data: []byte{},
-			}
-
-			codeFile, err := os.OpenFile(path, os.O_RDONLY, 0) // #nosec
-			if err != nil {
-				return fmt.Errorf("error opening codeFile: %w", err)
+			if !includeMatcher.Match(path) || excludeMatcher.Match(path) {
+				reportProgress(false, 0)
+				return nil
 			}
 
-			defer func() {
-				err = codeFile.Close()
-				if err != nil {
-					ui.PrintMessage(fmt.Sprintf("error closing codeFile: %s\n", err), ui.MessageTypeError)
+			var (
+				langName string
+				ok       bool
+			)
+
+			if len(opts.Languages) > 0 {
+				// files of other languages are expected when filtering by
+				// language, so they are skipped without a warning
+				langName, ok = languages.Match(path, opts.Languages)
+				if !ok {
+					reportProgress(false, 0)
+					return nil
 				}
-			}()
-
-			file.Data, err = os.ReadFile(path) // #nosec
-
-			if err != nil {
-				return fmt.Errorf("error reading codeFile: %w", err)
+			} else {
+				langName, ok = detector.Detect(path)
 			}
 
-			files = append(files, *file)
-
-			// Construct the codeFile tree
-			parts := strings.Split(path, string(os.PathSeparator))
-			current := rootNode
+			if !ok && (document.IsDocument(path) || datasample.Supported(path)) {
+				files = append(files, File{Path: path, Type: document.Type, Size: info.Size()})
+				reportProgress(true, info.Size())
+				rootNode.insert(path)
 
-			for _, part := range parts[:len(parts)-1] { // Exclude the last part which is the codeFile itself
-				found := false
-
-				for _, child := range current.Children {
-					if child.Name == part && child.IsDir {
-						current = child
-						found = true
+				return nil
+			}
 
-						break
-					}
-				}
+			if !ok {
+				reportProgress(false, 0)
+				slog.Warn("skipping unknown file type", "path", path)
 
-				if !found {
-					newNode := &FileNode{Name: part, IsDir: true, Children: []*FileNode{}}
-					current.Children = append(current.Children, newNode)
-					current = newNode
-				}
+				return nil
 			}
 
-			current.Children = append(current.Children,
-				&FileNode{Name: parts[len(parts)-1], IsDir: false, Children: []*FileNode{}})
+			files = append(files, File{Path: path, Type: languages.FenceLabel(langName), Size: info.Size()})
+			reportProgress(true, info.Size())
+
+			// Construct the file tree
+			rootNode.insert(path)
 
 			return nil
 		})
@@ -130,58 +169,95 @@ func GatherFiles(opts *FileGatherOptions) ([]File, *FileNode, error) { //nolint:
 	return files, rootNode, nil
 }
 
-type languageCheckerCache struct {
-	cache     map[string]string
-	cacheHits int
-}
+// NewFileTree builds a file tree containing the given files.
+func NewFileTree(files []File) *FileNode {
+	rootNode := &FileNode{Name: "/", IsDir: true, Children: []*FileNode{}}
 
-func (l *languageCheckerCache) Get(ext string) (string, bool) {
-	val, ok := l.cache[ext]
-	return val, ok
-}
+	for _, file := range files {
+		rootNode.insert(file.Path).Owners = file.Owners
+	}
 
-func (l *languageCheckerCache) Set(ext, lang string) {
-	l.cache[ext] = lang
+	return rootNode
 }
 
-func cachedLanguageChecker() func(string) (string, bool) {
-	cache := &languageCheckerCache{cache: make(map[string]string), cacheHits: 0}
+// insert adds the file at path to the tree, creating directory nodes as
+// needed, and returns its node.
+func (n *FileNode) insert(path string) *FileNode {
+	parts := strings.Split(path, string(os.PathSeparator))
+	current := n
+
+	for _, part := range parts[:len(parts)-1] { // Exclude the last part which is the file itself
+		found := false
 
-	return func(path string) (string, bool) {
-		if ext, ok := cache.Get(filepath.Ext(path)); ok {
-			cache.cacheHits++
-			return ext, true
+		for _, child := range current.Children {
+			if child.Name == part && child.IsDir {
+				current = child
+				found = true
+
+				break
+			}
 		}
-		// .md should be interpreted as markdown, not lisp
-		if filepath.Ext(path) == ".md" {
-			cache.Set(filepath.Ext(path), "markdown")
-			return "markdown", true
+
+		if !found {
+			newNode := &FileNode{Name: part, IsDir: true, Children: []*FileNode{}}
+			current.Children = append(current.Children, newNode)
+			current = newNode
 		}
+	}
 
-		for _, lang := range languages {
-			if slices.Contains(lang.Extensions, filepath.Ext(path)) {
-				// cache the extension for faster lookup
-				cache.Set(filepath.Ext(path), lang.AceMode)
-				return lang.AceMode, true
-			}
+	leaf := &FileNode{Name: parts[len(parts)-1], IsDir: false, Children: []*FileNode{}}
+	current.Children = append(current.Children, leaf)
 
-			if slices.Contains(lang.Filenames, filepath.Base(path)) {
-				// cache the filename for faster lookup
-				cache.Set(filepath.Base(path), lang.AceMode)
-				return lang.AceMode, true
-			}
+	return leaf
+}
+
+// LoadFile reads a single file and detects its type.
+func LoadFile(path string) (*File, error) {
+	path = filepath.Clean(path)
+
+	fileType := document.Type
+
+	if !document.IsDocument(path) && !datasample.Supported(path) {
+		langName, ok := languages.Detect(path)
+		if !ok {
+			return nil, fmt.Errorf("unknown file type: %s", path)
 		}
 
-		return "", false
+		fileType = languages.FenceLabel(langName)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading file: %w", err)
 	}
+
+	if !info.Mode().IsRegular() {
+		return nil, fmt.Errorf("not a regular file: %s", path)
+	}
+
+	return &File{Path: path, Type: fileType, Size: info.Size()}, nil
 }
 
+// GenerateFileTree renders the tree. Owners are shown next to the files, or
+// next to a directory when they own everything in it.
 func GenerateFileTree(node *FileNode, indent string, isLast bool) string {
+	return generateFileTree(node, indent, isLast, "")
+}
+
+func generateFileTree(node *FileNode, indent string, isLast bool, inheritedOwners string) string {
+	// owners are only shown where they differ from those of the parent
+	owners, _ := node.commonOwners()
+
+	suffix := ""
+	if owners != "" && owners != inheritedOwners {
+		suffix = " (" + owners + ")"
+	}
+
 	// Handle the case for the root node differently
 	var tree strings.Builder
 
 	if node.Name == "/" && node.IsDir {
-		tree.WriteString(".\n")
+		tree.WriteString("." + suffix + "\n")
 	} else {
 		// Choose the appropriate prefix
 		prefix := "├── "
@@ -190,7 +266,7 @@ func GenerateFileTree(node *FileNode, indent string, isLast bool) string {
 		}
 
 		// Print the name of the current node with the correct indentation
-		tree.WriteString(indent + prefix + node.Name + "\n")
+		tree.WriteString(indent + prefix + node.Name + suffix + "\n")
 
 		if node.IsDir && !isLast {
 			indent += "│   "
@@ -208,9 +284,31 @@ func GenerateFileTree(node *FileNode, indent string, isLast bool) string {
 		for i, child := range node.Children {
 			// Check if the child node is the last in the list
 			isLastChild := i == len(node.Children)-1
-			tree.WriteString(GenerateFileTree(child, indent, isLastChild))
+			tree.WriteString(generateFileTree(child, indent, isLastChild, owners))
 		}
 	}
 
 	return tree.String()
 }
+
+// commonOwners returns the owners of a file, or those shared by all files in
+// a directory. It returns false if the files of a directory have different
+// owners.
+func (n *FileNode) commonOwners() (string, bool) {
+	if !n.IsDir {
+		return strings.Join(n.Owners, " "), true
+	}
+
+	common, first := "", true
+
+	for _, child := range n.Children {
+		owners, ok := child.commonOwners()
+		if !ok || (!first && owners != common) {
+			return "", false
+		}
+
+		common, first = owners, false
+	}
+
+	return common, true
+}
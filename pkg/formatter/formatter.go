@@ -0,0 +1,186 @@
+// Package formatter runs code formatters, such as gofmt, prettier or black,
+// on the files cwc writes, so that edits made by the model land formatted.
+package formatter
+
+import (
+	"bytes"
+	"context"
+	stderrors "errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/emilkje/cwc/pkg/languages"
+)
+
+const defaultTimeout = 30 * time.Second
+
+// defaults are the formatters tried for a language when none is configured,
+// in order of preference. The first one installed is used, either on PATH or
+// relative to the repository root.
+var defaults = map[string][]string{ //nolint:gochecknoglobals
+	"Go":         {"goimports -w", "gofmt -w"},
+	"Python":     {"black -q", "ruff format -q"},
+	"Rust":       {"rustfmt"},
+	"Shell":      {"shfmt -w"},
+	"JavaScript": prettier,
+	"TypeScript": prettier,
+	"TSX":        prettier,
+	"CSS":        prettier,
+	"SCSS":       prettier,
+	"Less":       prettier,
+	"HTML":       prettier,
+	"Vue":        prettier,
+	"JSON":       prettier,
+	"YAML":       prettier,
+	"Markdown":   prettier,
+}
+
+var prettier = []string{"node_modules/.bin/prettier --write", "prettier --write"} //nolint:gochecknoglobals
+
+// Formatter runs the formatter of each language on the files written in it.
+type Formatter struct {
+	commands map[string]string
+	root     string
+	timeout  time.Duration
+}
+
+// New creates a formatter run from the repository root. Commands maps a
+// language name, alias or extension, e.g. "go" or "ts", to the command that
+// formats files in it, replacing the default formatter. The paths of the
+// files are appended to the command. An empty command turns formatting of
+// the language off.
+func New(commands map[string]string, root string) (*Formatter, error) {
+	f := &Formatter{commands: map[string]string{}, root: root, timeout: defaultTimeout}
+
+	for name, command := range commands {
+		langName, _, ok := languages.Lookup(name)
+		if !ok {
+			return nil, fmt.Errorf("unknown language %q in the formatters", name)
+		}
+
+		f.commands[langName] = strings.TrimSpace(command)
+	}
+
+	return f, nil
+}
+
+// Format formats the files in place, running each formatter once for all the
+// files in its language. Files in languages without a formatter, and those
+// whose default formatter isn't installed, are left as they are. It returns
+// the paths of the formatted files.
+func (f *Formatter) Format(paths []string) ([]string, error) {
+	byCommand := map[string][]string{}
+
+	for _, path := range paths {
+		langName, ok := languages.Detect(path)
+		if !ok {
+			continue
+		}
+
+		if command := f.command(langName); command != "" {
+			byCommand[command] = append(byCommand[command], path)
+		}
+	}
+
+	commands := make([]string, 0, len(byCommand))
+	for command := range byCommand {
+		commands = append(commands, command)
+	}
+
+	sort.Strings(commands)
+
+	var (
+		formatted []string
+		errs      []error
+	)
+
+	for _, command := range commands {
+		if err := f.run(command, byCommand[command]); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		formatted = append(formatted, byCommand[command]...)
+	}
+
+	return formatted, stderrors.Join(errs...)
+}
+
+// command returns the formatter of the language, or "" if it has none.
+func (f *Formatter) command(langName string) string {
+	if command, ok := f.commands[langName]; ok {
+		return command
+	}
+
+	for _, command := range defaults[langName] {
+		if f.installed(command) {
+			return command
+		}
+	}
+
+	return ""
+}
+
+func (f *Formatter) installed(command string) bool {
+	program := strings.Fields(command)[0]
+
+	if strings.Contains(program, "/") {
+		info, err := os.Stat(filepath.Join(f.root, program))
+		return err == nil && !info.IsDir()
+	}
+
+	_, err := exec.LookPath(program)
+
+	return err == nil
+}
+
+func (f *Formatter) run(command string, paths []string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), f.timeout)
+	defer cancel()
+
+	var output bytes.Buffer
+
+	cmd := shellCommand(ctx, command, paths)
+	cmd.Dir = f.root
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+
+	err := cmd.Run()
+
+	if stderrors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("the formatter %q did not finish within %s", command, f.timeout)
+	}
+
+	if err != nil {
+		if details := strings.TrimSpace(output.String()); details != "" {
+			return fmt.Errorf("the formatter %q failed: %s", command, details)
+		}
+
+		return fmt.Errorf("error running the formatter %q: %w", command, err)
+	}
+
+	return nil
+}
+
+// shellCommand runs the command with the paths appended as arguments of
+// their own, so that no path is interpreted by the shell.
+func shellCommand(ctx context.Context, command string, paths []string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		quoted := make([]string, 0, len(paths))
+		for _, path := range paths {
+			quoted = append(quoted, `"`+path+`"`)
+		}
+
+		return exec.CommandContext(ctx, "cmd", "/C", command+" "+strings.Join(quoted, " ")) // #nosec
+	}
+
+	args := append([]string{"-c", command + ` "$@"`, "sh"}, paths...)
+
+	return exec.CommandContext(ctx, "sh", args...) // #nosec
+}
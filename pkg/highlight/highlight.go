@@ -0,0 +1,542 @@
+package highlight
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/alecthomas/chroma/v2"
+	"github.com/alecthomas/chroma/v2/formatters"
+	"github.com/alecthomas/chroma/v2/lexers"
+	"github.com/alecthomas/chroma/v2/styles"
+	"github.com/mattn/go-runewidth"
+	"golang.org/x/term"
+
+	"github.com/emilkje/cwc/pkg/languages"
+	"github.com/emilkje/cwc/pkg/ui"
+)
+
+const (
+	fenceBackticks = "```"
+	fenceTildes    = "~~~"
+	tabWidth       = 4
+	// maxCarriedLines is the most lines tokenised again for every line of a
+	// code block. A construct spanning more lines may be highlighted wrongly
+	// after that, rather than slowing the stream down more and more.
+	maxCarriedLines = 200
+)
+
+// Supported reports whether the given file is a terminal capable of
+// rendering highlighted output and colors have not been disabled.
+func Supported(file *os.File) bool {
+	if !ui.ColorsEnabled() {
+		return false
+	}
+
+	return term.IsTerminal(int(file.Fd()))
+}
+
+// Writer detects fenced code blocks in streamed markdown and highlights their
+// contents line by line as they arrive. Prose outside of code blocks is passed
+// through as soon as it is written, or word by word when wrapping is enabled.
+type Writer struct {
+	out       io.Writer
+	enabled   bool
+	style     *chroma.Style
+	formatter chroma.Formatter
+
+	pending     string
+	atLineStart bool
+
+	inCode bool
+	lexer  chroma.Lexer
+	// block holds the lines of the code block since the last one that
+	// started in the initial state of the lexer, see writeCodeLine.
+	block      strings.Builder
+	blockLines int
+
+	// inDiff is set for diff and patch blocks, which are rendered by the ui
+	// diff renderer. Consecutive changed lines are held back in diffRun so
+	// that removals and additions can be compared word by word.
+	inDiff  bool
+	diffRun strings.Builder
+
+	wrap wrapState
+}
+
+// wrapState tracks the position within the current line of prose.
+type wrapState struct {
+	width  int
+	column int
+	// hang is the indentation of continuation lines, so that wrapped list
+	// items and indented paragraphs line up with their first line.
+	hang      int
+	words     int
+	space     string
+	word      strings.Builder
+	unwrapped bool
+}
+
+// NewWriter creates a Writer that writes to out using the code style of the
+// current theme. When enabled is false the input is passed through untouched.
+func NewWriter(out io.Writer, enabled bool) *Writer {
+	return &Writer{
+		out:         out,
+		enabled:     enabled,
+		style:       styles.Get(ui.CurrentTheme().CodeStyle),
+		formatter:   formatters.TTY256,
+		atLineStart: true,
+	}
+}
+
+// Render highlights all fenced code blocks in a complete markdown text and
+// wraps the prose to the given width. A width of zero disables wrapping.
+func Render(markdown string, width int, enabled bool) string {
+	var out strings.Builder
+
+	w := NewWriter(&out, enabled)
+	w.SetWidth(width)
+	_, _ = w.Write([]byte(markdown))
+	_ = w.Flush()
+
+	return out.String()
+}
+
+// SetWidth enables word wrapping of prose at the given number of columns.
+// Code blocks are never wrapped. A width of zero disables wrapping.
+func (w *Writer) SetWidth(width int) {
+	w.wrap.width = max(width, 0)
+}
+
+// Advance informs the writer that columns of text have been written to the
+// same line outside of it, such as a prompt, so wrapping stays accurate.
+func (w *Writer) Advance(columns int) {
+	w.wrap.column += columns
+}
+
+func (w *Writer) Write(p []byte) (int, error) {
+	if !w.enabled && w.wrap.width == 0 {
+		return w.out.Write(p) //nolint:wrapcheck
+	}
+
+	w.pending += string(p)
+
+	for w.pending != "" {
+		consumed, err := w.process()
+		if err != nil {
+			return 0, err
+		}
+
+		if !consumed {
+			break
+		}
+	}
+
+	return len(p), nil
+}
+
+// Flush writes any buffered output, highlighting a trailing partial line if
+// it belongs to a code block. It should be called when the stream ends.
+func (w *Writer) Flush() error {
+	line := w.pending
+	w.pending = ""
+	w.atLineStart = true
+
+	defer w.resetLine()
+
+	if w.inCode {
+		if line == "" {
+			return w.flushDiff()
+		}
+
+		return w.writeCodeLine(line, false)
+	}
+
+	if err := w.writeProse(line); err != nil {
+		return err
+	}
+
+	return w.flushWord()
+}
+
+// process consumes as much of the pending input as can be decided on. It
+// returns false when more input is required.
+func (w *Writer) process() (bool, error) {
+	newline := strings.IndexByte(w.pending, '\n')
+
+	if w.inCode {
+		if newline < 0 {
+			return false, nil
+		}
+
+		line := w.pending[:newline]
+		w.pending = w.pending[newline+1:]
+
+		if isFence(line) {
+			if err := w.flushDiff(); err != nil {
+				return true, err
+			}
+
+			w.inCode = false
+			w.inDiff = false
+			w.lexer = nil
+			w.block.Reset()
+			w.blockLines = 0
+
+			return true, w.write(line + "\n")
+		}
+
+		return true, w.writeCodeLine(line, true)
+	}
+
+	if w.atLineStart && couldBeFence(w.pending) {
+		if newline < 0 {
+			return false, nil
+		}
+
+		line := w.pending[:newline]
+		w.pending = w.pending[newline+1:]
+
+		if !isFence(line) {
+			return true, w.writeProse(line + "\n")
+		}
+
+		w.inCode = true
+
+		if w.enabled {
+			label := fenceLabel(line)
+			w.inDiff = isDiffLabel(label)
+
+			if !w.inDiff {
+				w.lexer = lexerFor(label)
+			}
+		}
+
+		return true, w.write(line + "\n")
+	}
+
+	if newline < 0 {
+		text := w.pending
+		w.pending = ""
+		w.atLineStart = false
+
+		return true, w.writeProse(text)
+	}
+
+	text := w.pending[:newline+1]
+	w.pending = w.pending[newline+1:]
+	w.atLineStart = true
+
+	return true, w.writeProse(text)
+}
+
+// writeProse writes text outside of code blocks. When wrapping is enabled
+// words are held back until they are complete so that a line break can be
+// inserted before a word that doesn't fit.
+func (w *Writer) writeProse(text string) error {
+	if w.wrap.width == 0 {
+		return w.write(text)
+	}
+
+	for _, r := range text {
+		switch r {
+		case '\n':
+			if err := w.flushWord(); err != nil {
+				return err
+			}
+
+			w.resetLine()
+
+			if err := w.write("\n"); err != nil {
+				return err
+			}
+		case ' ', '\t':
+			if err := w.flushWord(); err != nil {
+				return err
+			}
+
+			if w.wrap.words > 0 {
+				w.wrap.space += string(r)
+				continue
+			}
+
+			// leading indentation is kept and carried over to wrapped lines
+			w.wrap.column += displayWidth(string(r))
+			w.wrap.hang = w.wrap.column
+
+			if err := w.write(string(r)); err != nil {
+				return err
+			}
+		default:
+			w.wrap.word.WriteRune(r)
+		}
+	}
+
+	return nil
+}
+
+// flushWord writes the word held back by writeProse, breaking the line first
+// if it would not fit.
+func (w *Writer) flushWord() error {
+	state := &w.wrap
+	if state.word.Len() == 0 {
+		return nil
+	}
+
+	word := state.word.String()
+	state.word.Reset()
+
+	if state.words == 0 && strings.HasPrefix(word, "|") {
+		state.unwrapped = true // tables can't be wrapped without breaking them
+	}
+
+	wordWidth := displayWidth(word)
+	spaceWidth := displayWidth(state.space)
+
+	prefix := state.space
+	if state.words > 0 && !state.unwrapped && state.column+spaceWidth+wordWidth > state.width {
+		prefix = "\n" + strings.Repeat(" ", state.hang)
+		state.column = state.hang
+	} else {
+		state.column += spaceWidth
+	}
+
+	state.column += wordWidth
+	state.space = ""
+
+	if state.words == 0 && isListMarker(word) {
+		state.hang = state.column + 1
+	}
+
+	state.words++
+
+	return w.write(prefix + word)
+}
+
+func (w *Writer) resetLine() {
+	w.wrap.column = 0
+	w.wrap.hang = 0
+	w.wrap.words = 0
+	w.wrap.space = ""
+	w.wrap.unwrapped = false
+}
+
+func (w *Writer) writeCodeLine(line string, terminated bool) error {
+	if w.inDiff {
+		return w.writeDiffLine(line, terminated)
+	}
+
+	if w.lexer == nil {
+		if terminated {
+			line += "\n"
+		}
+
+		return w.write(line)
+	}
+
+	// Tokenise the lines since the last one that started in the initial
+	// state so that multi-line constructs such as block comments and raw
+	// strings keep their state across lines, without tokenising the whole
+	// block again for every line.
+	w.block.WriteString(line + "\n")
+	w.blockLines++
+
+	last, ok := w.lastLineTokens(w.block.String())
+	if !ok {
+		return w.write(line + "\n")
+	}
+
+	if w.blockLines > 1 && (w.blockLines > maxCarriedLines || w.startsInitial(line, last)) {
+		w.block.Reset()
+		w.block.WriteString(line + "\n")
+		w.blockLines = 1
+	}
+
+	if !terminated {
+		last = trimTrailingNewline(last)
+	}
+
+	var formatted strings.Builder
+
+	err := w.formatter.Format(&formatted, w.style, chroma.Literator(last...))
+	if err != nil {
+		return w.write(line + "\n")
+	}
+
+	return w.write(formatted.String())
+}
+
+// lastLineTokens tokenises the text and returns the tokens of its last line.
+func (w *Writer) lastLineTokens(text string) ([]chroma.Token, bool) {
+	iterator, err := w.lexer.Tokenise(nil, text)
+	if err != nil {
+		return nil, false
+	}
+
+	lines := chroma.SplitTokensIntoLines(iterator.Tokens())
+	if len(lines) == 0 {
+		return nil, false
+	}
+
+	return lines[len(lines)-1], true
+}
+
+// startsInitial reports whether the line was tokenised the same after the
+// lines before it as on its own, meaning that the lexer was in its initial
+// state when the line started and the lines before it can be forgotten.
+func (w *Writer) startsInitial(line string, tokens []chroma.Token) bool {
+	alone, ok := w.lastLineTokens(line + "\n")
+	if !ok || len(alone) != len(tokens) {
+		return false
+	}
+
+	for i := range alone {
+		if alone[i] != tokens[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (w *Writer) writeDiffLine(line string, terminated bool) error {
+	if terminated {
+		line += "\n"
+	}
+
+	if strings.HasPrefix(line, "-") || strings.HasPrefix(line, "+") {
+		w.diffRun.WriteString(line)
+
+		if terminated {
+			return nil
+		}
+	}
+
+	if err := w.flushDiff(); err != nil {
+		return err
+	}
+
+	if strings.HasPrefix(line, "-") || strings.HasPrefix(line, "+") {
+		return nil
+	}
+
+	return w.write(ui.RenderDiff(line, true))
+}
+
+func (w *Writer) flushDiff() error {
+	if w.diffRun.Len() == 0 {
+		return nil
+	}
+
+	run := w.diffRun.String()
+	w.diffRun.Reset()
+
+	return w.write(ui.RenderDiff(run, true))
+}
+
+func (w *Writer) write(s string) error {
+	_, err := io.WriteString(w.out, s)
+	if err != nil {
+		return fmt.Errorf("error writing highlighted output: %w", err)
+	}
+
+	return nil
+}
+
+func trimTrailingNewline(tokens []chroma.Token) []chroma.Token {
+	if len(tokens) == 0 {
+		return tokens
+	}
+
+	last := tokens[len(tokens)-1]
+	last.Value = strings.TrimSuffix(last.Value, "\n")
+
+	return append(tokens[:len(tokens)-1:len(tokens)-1], last)
+}
+
+func isDiffLabel(label string) bool {
+	switch strings.ToLower(label) {
+	case "diff", "patch", "udiff":
+		return true
+	}
+
+	return false
+}
+
+// isListMarker reports whether a word is a markdown bullet or list number.
+func isListMarker(word string) bool {
+	switch word {
+	case "-", "*", "+", ">":
+		return true
+	}
+
+	number := strings.TrimRight(word, ".)")
+	if number == word || number == "" {
+		return false
+	}
+
+	return strings.Trim(number, "0123456789") == ""
+}
+
+func displayWidth(s string) int {
+	return runewidth.StringWidth(s) + strings.Count(s, "\t")*tabWidth
+}
+
+func isFence(line string) bool {
+	trimmed := strings.TrimSpace(line)
+	return strings.HasPrefix(trimmed, fenceBackticks) || strings.HasPrefix(trimmed, fenceTildes)
+}
+
+// couldBeFence reports whether a partial line may still turn out to be a
+// code fence once the rest of the line arrives.
+func couldBeFence(partial string) bool {
+	trimmed := strings.TrimLeft(partial, " \t")
+	if trimmed == "" {
+		return true
+	}
+
+	for _, fence := range []string{fenceBackticks, fenceTildes} {
+		if strings.HasPrefix(trimmed, fence) || strings.HasPrefix(fence, trimmed) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func fenceLabel(line string) string {
+	label := strings.TrimLeft(strings.TrimSpace(line), "`~")
+
+	fields := strings.Fields(label)
+	if len(fields) == 0 {
+		return ""
+	}
+
+	return fields[0]
+}
+
+// lexerFor resolves a fence label such as "go" or "ts" to a lexer, using the
+// generated language map to translate aliases and extensions into language
+// names chroma knows about.
+func lexerFor(label string) chroma.Lexer {
+	if label == "" {
+		return nil
+	}
+
+	var lexer chroma.Lexer
+
+	if name, _, ok := languages.Lookup(label); ok {
+		lexer = lexers.Get(name)
+	}
+
+	if lexer == nil {
+		lexer = lexers.Get(label)
+	}
+
+	if lexer == nil {
+		return nil
+	}
+
+	return chroma.Coalesce(lexer)
+}
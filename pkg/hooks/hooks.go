@@ -0,0 +1,187 @@
+package hooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	stderrors "errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/emilkje/cwc/pkg/config"
+	"github.com/emilkje/cwc/pkg/errors"
+	"github.com/emilkje/cwc/pkg/filetree"
+)
+
+const defaultTimeout = 30 * time.Second
+
+// The events hooks run for, passed in the payload and in CWC_HOOK.
+const (
+	EventPreContext   = "pre-context"
+	EventPreSend      = "pre-send"
+	EventPostResponse = "post-response"
+)
+
+// Payload is written to the stdin of a hook as JSON. A hook may write a
+// payload back to stdout to change it: pre-context hooks can remove files and
+// pre-send hooks can rewrite the prompt.
+type Payload struct {
+	Event    string   `json:"event"`
+	Files    []string `json:"files,omitempty"`
+	Prompt   string   `json:"prompt,omitempty"`
+	Response string   `json:"response,omitempty"`
+}
+
+// Runner runs the hooks configured for a repository. A Runner without hooks
+// changes nothing, nor does a nil Runner, so it can be used whether or not
+// any are configured.
+type Runner struct {
+	hooks   config.HooksConfig
+	root    string
+	timeout time.Duration
+}
+
+// New creates a runner for the hooks in cfg, run from the repository root.
+func New(cfg *config.HooksConfig, root string) (*Runner, error) {
+	runner := &Runner{root: root, timeout: defaultTimeout}
+
+	if cfg == nil {
+		return runner, nil
+	}
+
+	runner.hooks = *cfg
+
+	if cfg.Timeout != "" {
+		timeout, err := time.ParseDuration(cfg.Timeout)
+		if err != nil || timeout <= 0 {
+			return nil, fmt.Errorf("invalid hook timeout %q", cfg.Timeout)
+		}
+
+		runner.timeout = timeout
+	}
+
+	return runner, nil
+}
+
+// PreContext runs the pre-context hooks with the gathered files and returns
+// the files they kept.
+func (r *Runner) PreContext(files []filetree.File) ([]filetree.File, error) {
+	if r == nil || len(r.hooks.PreContext) == 0 {
+		return files, nil
+	}
+
+	paths := make([]string, 0, len(files))
+	for _, file := range files {
+		paths = append(paths, file.Path)
+	}
+
+	payload, err := r.run(r.hooks.PreContext, Payload{Event: EventPreContext, Files: paths})
+	if err != nil {
+		return nil, err
+	}
+
+	// hooks may only remove files, anything else would bypass the filters
+	// the files were gathered with
+	return slices.DeleteFunc(slices.Clone(files), func(file filetree.File) bool {
+		return !slices.Contains(payload.Files, file.Path)
+	}), nil
+}
+
+// PreSend runs the pre-send hooks with the prompt and returns the prompt to
+// send.
+func (r *Runner) PreSend(prompt string) (string, error) {
+	if r == nil || len(r.hooks.PreSend) == 0 {
+		return prompt, nil
+	}
+
+	payload, err := r.run(r.hooks.PreSend, Payload{Event: EventPreSend, Prompt: prompt})
+	if err != nil {
+		return "", err
+	}
+
+	return payload.Prompt, nil
+}
+
+// PostResponse runs the post-response hooks with the prompt and the response.
+func (r *Runner) PostResponse(prompt, response string) error {
+	if r == nil || len(r.hooks.PostResponse) == 0 {
+		return nil
+	}
+
+	_, err := r.run(r.hooks.PostResponse, Payload{Event: EventPostResponse, Prompt: prompt, Response: response})
+
+	return err
+}
+
+// run runs the commands in order, each receiving the payload as left by the
+// previous one.
+func (r *Runner) run(commands []string, payload Payload) (Payload, error) {
+	for _, command := range commands {
+		output, err := r.exec(command, payload)
+		if err != nil {
+			return Payload{}, err
+		}
+
+		if len(bytes.TrimSpace(output)) == 0 {
+			continue // unchanged
+		}
+
+		event := payload.Event
+		if err := json.Unmarshal(output, &payload); err != nil {
+			return Payload{}, fmt.Errorf("error parsing the output of the hook %q: %w", command, err)
+		}
+
+		payload.Event = event
+	}
+
+	return payload, nil
+}
+
+func (r *Runner) exec(command string, payload Payload) ([]byte, error) {
+	input, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding the hook payload: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+
+	cmd := shellCommand(ctx, command)
+	cmd.Dir = r.root
+	cmd.Env = append(os.Environ(), "CWC_HOOK="+payload.Event)
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	err = cmd.Run()
+
+	if stderrors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return nil, fmt.Errorf("the hook %q did not finish within %s", command, r.timeout)
+	}
+
+	var exitErr *exec.ExitError
+	if stderrors.As(err, &exitErr) {
+		return nil, errors.HookVetoError{Hook: command, Reason: strings.TrimSpace(stderr.String())}
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("error running the hook %q: %w", command, err)
+	}
+
+	return stdout.Bytes(), nil
+}
+
+func shellCommand(ctx context.Context, command string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return exec.CommandContext(ctx, "cmd", "/C", command)
+	}
+
+	return exec.CommandContext(ctx, "sh", "-c", command)
+}
@@ -0,0 +1,72 @@
+package index
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/sashabaranov/go-openai"
+
+	"github.com/emilkje/cwc/pkg/metrics"
+)
+
+// embeddingBatchSize is the number of inputs sent per request; Azure OpenAI
+// accepts at most 16.
+const embeddingBatchSize = 16
+
+// Embedder turns texts into embedding vectors.
+type Embedder interface {
+	Embed(ctx context.Context, texts []string) ([][]float32, error)
+	// Model names the embedding model, so that an index built with a
+	// different model is rebuilt rather than mixed.
+	Model() string
+}
+
+// OpenAIEmbedder embeds texts using the OpenAI embeddings API, as served by
+// OpenAI, Azure OpenAI and compatible servers such as Ollama.
+type OpenAIEmbedder struct {
+	client *openai.Client
+	model  openai.EmbeddingModel
+}
+
+func NewOpenAIEmbedder(client *openai.Client, model string) *OpenAIEmbedder {
+	return &OpenAIEmbedder{client: client, model: openai.EmbeddingModel(model)}
+}
+
+func (e *OpenAIEmbedder) Model() string {
+	return string(e.model)
+}
+
+func (e *OpenAIEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	embeddings := make([][]float32, 0, len(texts))
+
+	for start := 0; start < len(texts); start += embeddingBatchSize {
+		batch := texts[start:min(start+embeddingBatchSize, len(texts))]
+
+		resp, err := e.client.CreateEmbeddings(ctx, openai.EmbeddingRequest{
+			Input: batch,
+			Model: e.model,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error creating embeddings: %w", err)
+		}
+
+		metrics.Tokens.Add(float64(resp.Usage.TotalTokens), "embedding")
+
+		if len(resp.Data) != len(batch) {
+			return nil, fmt.Errorf("expected %d embeddings, got %d", len(batch), len(resp.Data))
+		}
+
+		ordered := make([][]float32, len(batch))
+		for _, data := range resp.Data {
+			if data.Index < 0 || data.Index >= len(batch) {
+				return nil, fmt.Errorf("unexpected embedding index %d", data.Index)
+			}
+
+			ordered[data.Index] = data.Embedding
+		}
+
+		embeddings = append(embeddings, ordered...)
+	}
+
+	return embeddings, nil
+}
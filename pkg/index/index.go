@@ -0,0 +1,307 @@
+package index
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	stderrors "errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/emilkje/cwc/pkg/datasample"
+	"github.com/emilkje/cwc/pkg/document"
+	"github.com/emilkje/cwc/pkg/filetree"
+)
+
+const (
+	indexVersion = 1
+	// chunkLines is the number of lines embedded together. Chunks of this
+	// size stay well below the input limit of the embedding models.
+	chunkLines = 60
+	// DefaultPath is where the index is stored, relative to the repository.
+	DefaultPath = ".cwc/index.json"
+)
+
+// Index holds the embeddings of the chunks of every indexed file, along with
+// what is needed to tell whether a file has changed since it was indexed. It
+// is the format of the local index file, see LocalStore.
+type Index struct {
+	Version int                   `json:"version"`
+	Model   string                `json:"model"`
+	Files   map[string]*FileEntry `json:"files"`
+}
+
+// FileEntry is the indexed state of a single file.
+type FileEntry struct {
+	Hash    string    `json:"hash"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"modTime"`
+	Chunks  []Chunk   `json:"chunks"`
+}
+
+// Chunk is a range of lines of a file and its embedding. The text itself is
+// not stored; it is read from the file when needed.
+type Chunk struct {
+	StartLine int       `json:"startLine"`
+	EndLine   int       `json:"endLine"`
+	Embedding []float32 `json:"embedding"`
+}
+
+// UpdateStats summarizes the changes made by Update.
+type UpdateStats struct {
+	Added     int
+	Modified  int
+	Deleted   int
+	Unchanged int
+	Chunks    int
+}
+
+// New creates an empty index.
+func New() *Index {
+	return &Index{Version: indexVersion, Files: make(map[string]*FileEntry)}
+}
+
+// Load reads the index from path. A missing index yields an empty one, as do
+// indexes written by an incompatible version.
+func Load(path string) (*Index, error) {
+	data, err := os.ReadFile(path) // #nosec
+	if err != nil {
+		if stderrors.Is(err, os.ErrNotExist) {
+			return New(), nil
+		}
+
+		return nil, fmt.Errorf("error reading index: %w", err)
+	}
+
+	idx := New()
+
+	if err := json.Unmarshal(data, idx); err != nil {
+		return nil, fmt.Errorf("error parsing index: %w", err)
+	}
+
+	if idx.Version != indexVersion || idx.Files == nil {
+		return New(), nil
+	}
+
+	return idx, nil
+}
+
+// Save writes the index to path, creating its directory if needed. A
+// .gitignore is placed next to a new index so that it is neither committed
+// nor gathered as context.
+func (idx *Index) Save(path string) error {
+	dir := filepath.Dir(path)
+
+	if err := os.MkdirAll(dir, 0o755); err != nil { //nolint:gomnd
+		return fmt.Errorf("error creating index directory: %w", err)
+	}
+
+	ignoreFile := filepath.Join(dir, ".gitignore")
+	if _, err := os.Stat(ignoreFile); stderrors.Is(err, os.ErrNotExist) {
+		ignored := filepath.Base(path) + "\n" + filepath.Base(path) + ".tmp\n"
+
+		if err := os.WriteFile(ignoreFile, []byte(ignored), 0o644); err != nil { //nolint:gomnd,gosec
+			return fmt.Errorf("error writing index .gitignore: %w", err)
+		}
+	}
+
+	data, err := json.Marshal(idx)
+	if err != nil {
+		return fmt.Errorf("error encoding index: %w", err)
+	}
+
+	// write to a temporary file first so an interrupted save can't corrupt the index
+	tmp := path + ".tmp"
+
+	if err := os.WriteFile(tmp, data, 0o600); err != nil { //nolint:gomnd
+		return fmt.Errorf("error writing index: %w", err)
+	}
+
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("error writing index: %w", err)
+	}
+
+	return nil
+}
+
+// Update brings the store in line with the given files, gathered from the
+// paths in scope. Only files that were added or changed since the last update
+// are embedded again, and files in scope that no longer exist are dropped;
+// the rest of the index is left alone, so updating part of a repository
+// keeps the other parts. An empty scope is the whole index. A file is
+// considered unchanged when its size and modification time match, or failing
+// that, its content hash does.
+//
+// The store is updated file by file, so on error it still holds the progress
+// made so far and can be flushed.
+func Update(ctx context.Context, store Store, embedder Embedder, files []filetree.File, scope []string,
+	onProgress func(done, total int),
+) (*UpdateStats, error) {
+	stats := &UpdateStats{}
+
+	model, err := store.Model(ctx)
+	if err != nil {
+		return stats, err //nolint:wrapcheck
+	}
+
+	if model != embedder.Model() {
+		// embeddings of different models can't be compared, start over
+		if err := store.Reset(ctx, embedder.Model()); err != nil {
+			return stats, err //nolint:wrapcheck
+		}
+	}
+
+	entries, err := store.Files(ctx)
+	if err != nil {
+		return stats, err //nolint:wrapcheck
+	}
+
+	seen := make(map[string]bool, len(files))
+
+	for i, file := range files {
+		seen[file.Path] = true
+
+		if onProgress != nil {
+			onProgress(i, len(files))
+		}
+
+		changed, err := updateFile(ctx, store, entries[file.Path], embedder, file, stats)
+		if err != nil {
+			return stats, fmt.Errorf("error indexing %s: %w", file.Path, err)
+		}
+
+		if !changed {
+			stats.Unchanged++
+		}
+	}
+
+	for path := range entries {
+		if !seen[path] && inScope(path, scope) {
+			if err := store.Delete(ctx, path); err != nil {
+				return stats, err //nolint:wrapcheck
+			}
+
+			stats.Deleted++
+		}
+	}
+
+	return stats, nil
+}
+
+// inScope reports whether path is one of the paths in scope or below one.
+func inScope(path string, scope []string) bool {
+	if len(scope) == 0 {
+		return true
+	}
+
+	path = filepath.Clean(path)
+
+	for _, dir := range scope {
+		dir = filepath.Clean(dir)
+		if dir == "." || path == dir || strings.HasPrefix(path, dir+string(filepath.Separator)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func updateFile(ctx context.Context, store Store, entry *FileEntry, embedder Embedder, file filetree.File,
+	stats *UpdateStats,
+) (bool, error) {
+	info, err := os.Stat(file.Path)
+	if err != nil {
+		return false, fmt.Errorf("error reading file: %w", err)
+	}
+
+	exists := entry != nil
+	if exists && entry.Size == info.Size() && entry.ModTime.Equal(info.ModTime()) {
+		return false, nil
+	}
+
+	data, err := file.ReadContents()
+	if err != nil {
+		return false, err //nolint:wrapcheck
+	}
+
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:])
+
+	if exists && entry.Hash == hash {
+		// touched but not changed
+		return false, store.Touch(ctx, file.Path, info.Size(), info.ModTime()) //nolint:wrapcheck
+	}
+
+	text := string(data)
+
+	if datasample.Applies(file.Path, info.Size(), nil) {
+		// only the schema and a sample of the rows of large data files are
+		// worth embedding
+		if text, err = datasample.SampleFile(file.Path, info.Size(), nil); err != nil {
+			return false, nil //nolint:nilerr
+		}
+	} else if document.IsDocument(file.Path) {
+		// documents without extractable text, like scanned PDFs, are left out
+		if text, err = document.ExtractText(file.Path, data); err != nil {
+			return false, nil //nolint:nilerr
+		}
+	}
+
+	chunks, texts := splitChunks(file.Path, text)
+
+	embeddings, err := embedder.Embed(ctx, texts)
+	if err != nil {
+		return false, err //nolint:wrapcheck
+	}
+
+	for i := range chunks {
+		chunks[i].Embedding = embeddings[i]
+	}
+
+	newEntry := &FileEntry{Hash: hash, Size: info.Size(), ModTime: info.ModTime(), Chunks: chunks}
+	if err := store.Put(ctx, file.Path, newEntry); err != nil {
+		return false, err //nolint:wrapcheck
+	}
+
+	stats.Chunks += len(chunks)
+
+	if exists {
+		stats.Modified++
+	} else {
+		stats.Added++
+	}
+
+	return true, nil
+}
+
+// splitChunks splits a file into chunks of lines. Each chunk's text starts
+// with the path so that the embedding captures where the code lives.
+func splitChunks(path, content string) ([]Chunk, []string) {
+	lines := strings.SplitAfter(content, "\n")
+	if len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	var (
+		chunks []Chunk
+		texts  []string
+	)
+
+	for start := 0; start < len(lines); start += chunkLines {
+		end := min(start+chunkLines, len(lines))
+
+		chunks = append(chunks, Chunk{StartLine: start + 1, EndLine: end})
+		texts = append(texts, path+"\n"+strings.Join(lines[start:end], ""))
+	}
+
+	if len(chunks) == 0 {
+		chunks = append(chunks, Chunk{StartLine: 1, EndLine: 1})
+		texts = append(texts, path)
+	}
+
+	return chunks, texts
+}
@@ -0,0 +1,113 @@
+package index
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/emilkje/cwc/pkg/filetree"
+)
+
+type fakeEmbedder struct{}
+
+func (fakeEmbedder) Embed(_ context.Context, texts []string) ([][]float32, error) {
+	embeddings := make([][]float32, len(texts))
+	for i := range texts {
+		embeddings[i] = []float32{1, 0}
+	}
+
+	return embeddings, nil
+}
+
+func (fakeEmbedder) Model() string {
+	return "fake"
+}
+
+func writeFiles(t *testing.T, dir string, paths ...string) []filetree.File {
+	t.Helper()
+
+	files := make([]filetree.File, 0, len(paths))
+
+	for _, path := range paths {
+		path = filepath.Join(dir, path)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o700))
+		require.NoError(t, os.WriteFile(path, []byte("package x\n"), 0o600))
+
+		files = append(files, filetree.File{Path: path, Type: "go"})
+	}
+
+	return files
+}
+
+func indexedPaths(t *testing.T, store Store, dir string) []string {
+	t.Helper()
+
+	entries, err := store.Files(context.Background())
+	require.NoError(t, err)
+
+	paths := make([]string, 0, len(entries))
+	for path := range entries {
+		rel, err := filepath.Rel(dir, path)
+		require.NoError(t, err)
+
+		paths = append(paths, filepath.ToSlash(rel))
+	}
+
+	sort.Strings(paths)
+
+	return paths
+}
+
+func TestUpdateScoped(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	store, err := OpenLocalStore(filepath.Join(dir, "index.json"))
+	require.NoError(t, err)
+
+	all := writeFiles(t, dir, "pkg/a.go", "pkg/b.go", "cmd/main.go")
+
+	_, err = Update(ctx, store, fakeEmbedder{}, all, []string{dir}, nil)
+	require.NoError(t, err)
+
+	// pkg/b.go is gone, and only pkg is scanned
+	require.NoError(t, os.Remove(all[1].Path))
+
+	stats, err := Update(ctx, store, fakeEmbedder{}, all[:1], []string{filepath.Join(dir, "pkg")}, nil)
+	require.NoError(t, err)
+
+	assert.Equal(t, 1, stats.Deleted)
+	assert.Equal(t, []string{"cmd/main.go", "pkg/a.go"}, indexedPaths(t, store, dir))
+}
+
+func TestUpdateWholeIndex(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	store, err := OpenLocalStore(filepath.Join(dir, "index.json"))
+	require.NoError(t, err)
+
+	all := writeFiles(t, dir, "pkg/a.go", "cmd/main.go")
+
+	_, err = Update(ctx, store, fakeEmbedder{}, all, nil, nil)
+	require.NoError(t, err)
+
+	stats, err := Update(ctx, store, fakeEmbedder{}, all[:1], nil, nil)
+	require.NoError(t, err)
+
+	assert.Equal(t, 1, stats.Deleted)
+	assert.Equal(t, []string{"pkg/a.go"}, indexedPaths(t, store, dir))
+}
+
+func TestInScope(t *testing.T) {
+	assert.True(t, inScope("pkg/a.go", []string{"."}))
+	assert.True(t, inScope("pkg/a.go", []string{"./pkg"}))
+	assert.True(t, inScope("pkg", []string{"pkg/"}))
+	assert.False(t, inScope("pkgs/a.go", []string{"pkg"}))
+	assert.False(t, inScope("cmd/main.go", []string{"pkg"}))
+}
@@ -0,0 +1,172 @@
+package index
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// BM25 parameters, the usual defaults.
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+// KeywordIndex is a BM25 full-text index of chunks. It finds exact
+// identifiers and error messages, which embeddings capture poorly. It is
+// cheap to build, so it is built from the files when needed rather than
+// stored.
+type KeywordIndex struct {
+	docs        []keywordDoc
+	docFreq     map[string]int
+	totalLength int
+}
+
+type keywordDoc struct {
+	match  Match
+	terms  map[string]int
+	length int
+}
+
+func NewKeywordIndex() *KeywordIndex {
+	return &KeywordIndex{docFreq: make(map[string]int)}
+}
+
+// Add indexes the text of a chunk.
+func (k *KeywordIndex) Add(path string, startLine, endLine int, text string) {
+	terms := make(map[string]int)
+	length := 0
+
+	for _, term := range tokenize(text) {
+		terms[term]++
+		length++
+	}
+
+	for term := range terms {
+		k.docFreq[term]++
+	}
+
+	k.docs = append(k.docs, keywordDoc{
+		match:  Match{Path: path, StartLine: startLine, EndLine: endLine},
+		terms:  terms,
+		length: length,
+	})
+	k.totalLength += length
+}
+
+// Search returns at most limit chunks containing terms of the query, best
+// match first. Chunks matching none of the terms are left out.
+func (k *KeywordIndex) Search(query string, limit int) []Match {
+	if len(k.docs) == 0 {
+		return nil
+	}
+
+	queryTerms := make(map[string]bool)
+	for _, term := range tokenize(query) {
+		queryTerms[term] = true
+	}
+
+	avgLength := float64(k.totalLength) / float64(len(k.docs))
+	total := float64(len(k.docs))
+
+	var matches []Match
+
+	for _, doc := range k.docs {
+		var score float64
+
+		for term := range queryTerms {
+			freq := float64(doc.terms[term])
+			if freq == 0 {
+				continue
+			}
+
+			df := float64(k.docFreq[term])
+			idf := math.Log(1 + (total-df+0.5)/(df+0.5))
+			score += idf * freq * (bm25K1 + 1) / (freq + bm25K1*(1-bm25B+bm25B*float64(doc.length)/avgLength))
+		}
+
+		if score > 0 {
+			match := doc.match
+			match.Score = float32(score)
+			matches = append(matches, match)
+		}
+	}
+
+	sortMatches(matches)
+
+	return matches[:min(limit, len(matches))]
+}
+
+// tokenize splits text into lowercase terms. Identifiers are kept whole, so
+// that searching for one finds it exactly, and are also split into their
+// words, so that "parseConfig" is found by "config".
+func tokenize(text string) []string {
+	words := strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_'
+	})
+
+	terms := make([]string, 0, len(words))
+
+	for _, word := range words {
+		lower := strings.ToLower(word)
+		terms = append(terms, lower)
+
+		parts := splitIdentifier(word)
+		if len(parts) > 1 {
+			for _, part := range parts {
+				terms = append(terms, strings.ToLower(part))
+			}
+		}
+	}
+
+	return terms
+}
+
+// splitIdentifier splits camelCase, PascalCase and snake_case identifiers
+// into their words.
+func splitIdentifier(word string) []string {
+	var (
+		parts []string
+		start int
+	)
+
+	runes := []rune(word)
+
+	for i := 0; i < len(runes); i++ {
+		switch {
+		case runes[i] == '_':
+			if i > start {
+				parts = append(parts, string(runes[start:i]))
+			}
+
+			start = i + 1
+		case i > start && unicode.IsUpper(runes[i]) &&
+			(unicode.IsLower(runes[i-1]) || (i+1 < len(runes) && unicode.IsLower(runes[i+1]))):
+			parts = append(parts, string(runes[start:i]))
+			start = i
+		}
+	}
+
+	if start < len(runes) {
+		parts = append(parts, string(runes[start:]))
+	}
+
+	return parts
+}
+
+// sortMatches orders matches by score, best first, and otherwise by
+// location so that the order is stable.
+func sortMatches(matches []Match) {
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].Score != matches[j].Score {
+			return matches[i].Score > matches[j].Score
+		}
+
+		if matches[i].Path != matches[j].Path {
+			return matches[i].Path < matches[j].Path
+		}
+
+		return matches[i].StartLine < matches[j].StartLine
+	})
+}
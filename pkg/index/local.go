@@ -0,0 +1,129 @@
+package index
+
+import (
+	"context"
+	stderrors "errors"
+	"fmt"
+	"math"
+	"os"
+	"time"
+)
+
+// LocalStore keeps the index in a JSON file, by default DefaultPath in the
+// repository. The whole index is held in memory and written back by Flush.
+type LocalStore struct {
+	path string
+	idx  *Index
+}
+
+// OpenLocalStore reads the index file at path, see Load.
+func OpenLocalStore(path string) (*LocalStore, error) {
+	idx, err := Load(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return &LocalStore{path: path, idx: idx}, nil
+}
+
+func (s *LocalStore) Model(context.Context) (string, error) {
+	return s.idx.Model, nil
+}
+
+func (s *LocalStore) Files(context.Context) (map[string]*FileEntry, error) {
+	files := make(map[string]*FileEntry, len(s.idx.Files))
+	for path, entry := range s.idx.Files {
+		files[path] = entry
+	}
+
+	return files, nil
+}
+
+func (s *LocalStore) Put(_ context.Context, path string, entry *FileEntry) error {
+	s.idx.Files[path] = entry
+	return nil
+}
+
+func (s *LocalStore) Touch(_ context.Context, path string, size int64, modTime time.Time) error {
+	if entry, ok := s.idx.Files[path]; ok {
+		entry.Size = size
+		entry.ModTime = modTime
+	}
+
+	return nil
+}
+
+func (s *LocalStore) Delete(_ context.Context, path string) error {
+	delete(s.idx.Files, path)
+	return nil
+}
+
+func (s *LocalStore) Reset(_ context.Context, model string) error {
+	s.idx = New()
+	s.idx.Model = model
+
+	return nil
+}
+
+// Search compares the embedding with every chunk in the index, which is fast
+// enough for the size of a repository.
+func (s *LocalStore) Search(_ context.Context, embedding []float32, limit int) ([]Match, error) {
+	var matches []Match
+
+	for path, entry := range s.idx.Files {
+		for _, chunk := range entry.Chunks {
+			matches = append(matches, Match{
+				Path:      path,
+				StartLine: chunk.StartLine,
+				EndLine:   chunk.EndLine,
+				Score:     cosineSimilarity(embedding, chunk.Embedding),
+			})
+		}
+	}
+
+	sortMatches(matches)
+
+	return matches[:min(limit, len(matches))], nil
+}
+
+// Size returns the size of the index file as last flushed.
+func (s *LocalStore) Size(context.Context) (int64, error) {
+	info, err := os.Stat(s.path)
+	if err != nil {
+		if stderrors.Is(err, os.ErrNotExist) {
+			return 0, nil
+		}
+
+		return 0, fmt.Errorf("error reading index: %w", err)
+	}
+
+	return info.Size(), nil
+}
+
+func (s *LocalStore) Flush(context.Context) error {
+	return s.idx.Save(s.path)
+}
+
+func (s *LocalStore) Location() string {
+	return s.path
+}
+
+func cosineSimilarity(a, b []float32) float32 {
+	if len(a) != len(b) {
+		return 0
+	}
+
+	var dot, normA, normB float64
+
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		normA += float64(a[i]) * float64(a[i])
+		normB += float64(b[i]) * float64(b[i])
+	}
+
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+
+	return float32(dot / (math.Sqrt(normA) * math.Sqrt(normB)))
+}
@@ -0,0 +1,359 @@
+package index
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	stderrors "errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// qdrantPageSize is the number of points fetched per scroll request.
+	qdrantPageSize = 256
+	// qdrantMaxErrorBody caps how much of an error response is reported.
+	qdrantMaxErrorBody = 512
+	// bytesPerFloat32 is the storage of each dimension of a vector.
+	bytesPerFloat32 = 4
+)
+
+// errCollectionNotFound is returned by requests to a collection that doesn't
+// exist yet.
+var errCollectionNotFound = stderrors.New("collection not found")
+
+// QdrantStore keeps the index in a collection on a Qdrant server, so that a
+// team can share one index instead of everyone embedding the repository.
+// Every chunk is a point whose payload holds the path, the line range and
+// what is needed to tell whether the file has changed.
+type QdrantStore struct {
+	client     *http.Client
+	baseURL    string
+	collection string
+	apiKey     string
+	// model is set by Reset, for the collection created by the next Put.
+	model string
+}
+
+// qdrantPayload is the payload of a point.
+type qdrantPayload struct {
+	Path      string    `json:"path"`
+	Model     string    `json:"model"`
+	Hash      string    `json:"hash"`
+	Size      int64     `json:"size"`
+	ModTime   time.Time `json:"modTime"`
+	StartLine int       `json:"startLine"`
+	EndLine   int       `json:"endLine"`
+}
+
+type qdrantPoint struct {
+	ID      any           `json:"id"`
+	Vector  []float32     `json:"vector,omitempty"`
+	Payload qdrantPayload `json:"payload"`
+	Score   float32       `json:"score,omitempty"`
+}
+
+// NewQdrantStore creates a store for the collection on the server at
+// baseURL. The apiKey may be empty for servers without authentication.
+func NewQdrantStore(client *http.Client, baseURL, collection, apiKey string) *QdrantStore {
+	return &QdrantStore{
+		client:     client,
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		collection: collection,
+		apiKey:     apiKey,
+	}
+}
+
+func (s *QdrantStore) Model(ctx context.Context) (string, error) {
+	points, _, err := s.scroll(ctx, nil, 1)
+	if err != nil {
+		if stderrors.Is(err, errCollectionNotFound) {
+			return "", nil
+		}
+
+		return "", err
+	}
+
+	if len(points) == 0 {
+		return s.model, nil
+	}
+
+	return points[0].Payload.Model, nil
+}
+
+func (s *QdrantStore) Files(ctx context.Context) (map[string]*FileEntry, error) {
+	files := make(map[string]*FileEntry)
+
+	var offset any
+
+	for {
+		points, next, err := s.scroll(ctx, offset, qdrantPageSize)
+		if err != nil {
+			if stderrors.Is(err, errCollectionNotFound) {
+				return files, nil
+			}
+
+			return nil, err
+		}
+
+		for _, point := range points {
+			p := point.Payload
+
+			entry, ok := files[p.Path]
+			if !ok {
+				entry = &FileEntry{Hash: p.Hash, Size: p.Size, ModTime: p.ModTime}
+				files[p.Path] = entry
+			}
+
+			entry.Chunks = append(entry.Chunks, Chunk{StartLine: p.StartLine, EndLine: p.EndLine})
+		}
+
+		if next == nil {
+			return files, nil
+		}
+
+		offset = next
+	}
+}
+
+func (s *QdrantStore) Put(ctx context.Context, path string, entry *FileEntry) error {
+	if len(entry.Chunks) == 0 {
+		return s.Delete(ctx, path)
+	}
+
+	if err := s.ensureCollection(ctx, len(entry.Chunks[0].Embedding)); err != nil {
+		return err
+	}
+
+	// a file may have fewer chunks than before, so drop the old ones first
+	if err := s.Delete(ctx, path); err != nil {
+		return err
+	}
+
+	points := make([]qdrantPoint, 0, len(entry.Chunks))
+
+	for _, chunk := range entry.Chunks {
+		points = append(points, qdrantPoint{
+			ID:     pointID(path, chunk.StartLine),
+			Vector: chunk.Embedding,
+			Payload: qdrantPayload{
+				Path:      path,
+				Model:     s.model,
+				Hash:      entry.Hash,
+				Size:      entry.Size,
+				ModTime:   entry.ModTime,
+				StartLine: chunk.StartLine,
+				EndLine:   chunk.EndLine,
+			},
+		})
+	}
+
+	return s.do(ctx, http.MethodPut, s.collectionPath()+"/points?wait=true", map[string]any{"points": points}, nil)
+}
+
+func (s *QdrantStore) Touch(ctx context.Context, path string, size int64, modTime time.Time) error {
+	body := map[string]any{
+		"payload": map[string]any{"size": size, "modTime": modTime},
+		"filter":  pathFilter(path),
+	}
+
+	return s.do(ctx, http.MethodPost, s.collectionPath()+"/points/payload?wait=true", body, nil)
+}
+
+func (s *QdrantStore) Delete(ctx context.Context, path string) error {
+	err := s.do(ctx, http.MethodPost, s.collectionPath()+"/points/delete?wait=true",
+		map[string]any{"filter": pathFilter(path)}, nil)
+	if stderrors.Is(err, errCollectionNotFound) {
+		return nil
+	}
+
+	return err
+}
+
+// Reset drops the collection. It is created again, with the vector size of
+// the new model, when the first file is put.
+func (s *QdrantStore) Reset(ctx context.Context, model string) error {
+	s.model = model
+
+	err := s.do(ctx, http.MethodDelete, s.collectionPath(), nil, nil)
+	if stderrors.Is(err, errCollectionNotFound) {
+		return nil
+	}
+
+	return err
+}
+
+func (s *QdrantStore) Search(ctx context.Context, embedding []float32, limit int) ([]Match, error) {
+	var points []qdrantPoint
+
+	body := map[string]any{"vector": embedding, "limit": limit, "with_payload": true}
+
+	err := s.do(ctx, http.MethodPost, s.collectionPath()+"/points/search", body, &points)
+	if err != nil {
+		if stderrors.Is(err, errCollectionNotFound) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	matches := make([]Match, 0, len(points))
+	for _, point := range points {
+		matches = append(matches, Match{
+			Path:      point.Payload.Path,
+			StartLine: point.Payload.StartLine,
+			EndLine:   point.Payload.EndLine,
+			Score:     point.Score,
+		})
+	}
+
+	return matches, nil
+}
+
+// Size estimates the storage used by the vectors of the collection, as
+// Qdrant doesn't report it.
+func (s *QdrantStore) Size(ctx context.Context) (int64, error) {
+	var info struct {
+		PointsCount int64 `json:"points_count"`
+		Config      struct {
+			Params struct {
+				Vectors struct {
+					Size int64 `json:"size"`
+				} `json:"vectors"`
+			} `json:"params"`
+		} `json:"config"`
+	}
+
+	if err := s.do(ctx, http.MethodGet, s.collectionPath(), nil, &info); err != nil {
+		if stderrors.Is(err, errCollectionNotFound) {
+			return 0, nil
+		}
+
+		return 0, err
+	}
+
+	return info.PointsCount * info.Config.Params.Vectors.Size * bytesPerFloat32, nil
+}
+
+// Flush does nothing, as every change is written to the server right away.
+func (s *QdrantStore) Flush(context.Context) error {
+	return nil
+}
+
+func (s *QdrantStore) Location() string {
+	return s.baseURL + s.collectionPath()
+}
+
+func (s *QdrantStore) collectionPath() string {
+	return "/collections/" + url.PathEscape(s.collection)
+}
+
+func (s *QdrantStore) ensureCollection(ctx context.Context, size int) error {
+	err := s.do(ctx, http.MethodGet, s.collectionPath(), nil, nil)
+	if !stderrors.Is(err, errCollectionNotFound) {
+		return err
+	}
+
+	body := map[string]any{"vectors": map[string]any{"size": size, "distance": "Cosine"}}
+
+	return s.do(ctx, http.MethodPut, s.collectionPath(), body, nil)
+}
+
+func (s *QdrantStore) scroll(ctx context.Context, offset any, limit int) ([]qdrantPoint, any, error) {
+	var result struct {
+		Points         []qdrantPoint `json:"points"`
+		NextPageOffset any           `json:"next_page_offset"`
+	}
+
+	body := map[string]any{"limit": limit, "with_payload": true, "with_vector": false}
+	if offset != nil {
+		body["offset"] = offset
+	}
+
+	if err := s.do(ctx, http.MethodPost, s.collectionPath()+"/points/scroll", body, &result); err != nil {
+		return nil, nil, err
+	}
+
+	return result.Points, result.NextPageOffset, nil
+}
+
+// do sends a request to the server and decodes the result field of the
+// response into result, if given.
+func (s *QdrantStore) do(ctx context.Context, method, path string, body, result any) error {
+	var reader io.Reader
+
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("error encoding request: %w", err)
+		}
+
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, s.baseURL+path, reader)
+	if err != nil {
+		return fmt.Errorf("error creating request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	if s.apiKey != "" {
+		req.Header.Set("api-key", s.apiKey)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error contacting qdrant: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return errCollectionNotFound
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, qdrantMaxErrorBody))
+		return fmt.Errorf("qdrant responded with %s: %s", resp.Status, strings.TrimSpace(string(detail)))
+	}
+
+	if result == nil {
+		return nil
+	}
+
+	var envelope struct {
+		Result json.RawMessage `json:"result"`
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(&envelope); err != nil {
+		return fmt.Errorf("error decoding qdrant response: %w", err)
+	}
+
+	if err := json.Unmarshal(envelope.Result, result); err != nil {
+		return fmt.Errorf("error decoding qdrant response: %w", err)
+	}
+
+	return nil
+}
+
+func pathFilter(path string) map[string]any {
+	return map[string]any{
+		"must": []map[string]any{{"key": "path", "match": map[string]any{"value": path}}},
+	}
+}
+
+// pointID derives a stable UUID for a chunk, as Qdrant only accepts integers
+// and UUIDs as point IDs.
+func pointID(path string, startLine int) string {
+	sum := sha256.Sum256([]byte(path + ":" + strconv.Itoa(startLine)))
+	h := hex.EncodeToString(sum[:16])
+
+	return h[0:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:32]
+}
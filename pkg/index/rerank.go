@@ -0,0 +1,187 @@
+package index
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	stderrors "errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/emilkje/cwc/pkg/document"
+)
+
+// maxRerankErrorBody caps how much of an error response is reported.
+const maxRerankErrorBody = 512
+
+// Reranker scores how relevant each text is to the query, higher being more
+// relevant. Rerankers read the query and the text together, which makes them
+// better judges than the similarity of embeddings, but too slow to apply to
+// more than the candidates of a search.
+type Reranker interface {
+	Rerank(ctx context.Context, query string, texts []string) ([]float32, error)
+}
+
+// LLMReranker asks a chat model to rate the relevance of the texts.
+type LLMReranker struct {
+	// Ask sends the request for ratings to the model, with the excerpts as
+	// the system message, and returns the ratings it replies with.
+	Ask func(systemMessage, prompt string) (string, error)
+}
+
+func (r *LLMReranker) Rerank(_ context.Context, query string, texts []string) ([]float32, error) {
+	var excerpts strings.Builder
+
+	for i, text := range texts {
+		fmt.Fprintf(&excerpts, "Excerpt %d:\n```\n%s\n```\n\n", i+1, text)
+	}
+
+	prompt := "Rate how useful each of the " + strconv.Itoa(len(texts)) + " excerpts above is for answering " +
+		"the question below, from 0 for irrelevant to 10 for essential. Reply with only a JSON array of the " +
+		"ratings, one number per excerpt in order, and nothing else.\n\nQuestion: " + query
+
+	reply, err := r.Ask("Excerpts of the code of a repository:\n\n"+excerpts.String(), prompt)
+	if err != nil {
+		return nil, err
+	}
+
+	start, end := strings.Index(reply, "["), strings.LastIndex(reply, "]")
+	if start < 0 || end < start {
+		return nil, fmt.Errorf("the ratings are not a JSON array: %q", reply)
+	}
+
+	var scores []float32
+	if err := json.Unmarshal([]byte(reply[start:end+1]), &scores); err != nil {
+		return nil, fmt.Errorf("error parsing the ratings: %w", err)
+	}
+
+	if len(scores) != len(texts) {
+		return nil, fmt.Errorf("expected %d ratings, got %d", len(texts), len(scores))
+	}
+
+	return scores, nil
+}
+
+// CrossEncoderReranker scores the texts with a cross-encoder served behind a
+// rerank endpoint in the format of Cohere, which Jina, Voyage, vLLM and
+// Infinity serve as well.
+type CrossEncoderReranker struct {
+	client   *http.Client
+	endpoint string
+	model    string
+	apiKey   string
+}
+
+// NewCrossEncoderReranker creates a reranker sending requests to endpoint,
+// the full URL of the rerank route. The apiKey may be empty.
+func NewCrossEncoderReranker(client *http.Client, endpoint, model, apiKey string) *CrossEncoderReranker {
+	return &CrossEncoderReranker{client: client, endpoint: endpoint, model: model, apiKey: apiKey}
+}
+
+func (r *CrossEncoderReranker) Rerank(ctx context.Context, query string, texts []string) ([]float32, error) {
+	body, err := json.Marshal(map[string]any{"model": r.model, "query": query, "documents": texts})
+	if err != nil {
+		return nil, fmt.Errorf("error encoding request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	if r.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+r.apiKey)
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error contacting the reranker: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, maxRerankErrorBody))
+		return nil, fmt.Errorf("the reranker responded with %s: %s", resp.Status, strings.TrimSpace(string(detail)))
+	}
+
+	var result struct {
+		Results []struct {
+			Index          int     `json:"index"`
+			RelevanceScore float32 `json:"relevance_score"`
+		} `json:"results"`
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("error decoding the reranker response: %w", err)
+	}
+
+	scores := make([]float32, len(texts))
+	for _, res := range result.Results {
+		if res.Index < 0 || res.Index >= len(texts) {
+			return nil, fmt.Errorf("unexpected rerank index %d", res.Index)
+		}
+
+		scores[res.Index] = res.RelevanceScore
+	}
+
+	return scores, nil
+}
+
+// rerank orders the candidates by the scores of the reranker and keeps the
+// best limit of them.
+func rerank(ctx context.Context, reranker Reranker, query string, candidates []Match, limit int) ([]Match, error) {
+	texts := make([]string, len(candidates))
+
+	for i, match := range candidates {
+		text, err := chunkText(match)
+		if err != nil {
+			return nil, err
+		}
+
+		texts[i] = text
+	}
+
+	scores, err := reranker.Rerank(ctx, query, texts)
+	if err != nil {
+		return nil, fmt.Errorf("error reranking: %w", err)
+	}
+
+	reranked := make([]Match, len(candidates))
+	for i, match := range candidates {
+		match.Score = scores[i]
+		reranked[i] = match
+	}
+
+	sortMatches(reranked)
+
+	return reranked[:min(limit, len(reranked))], nil
+}
+
+// chunkText reads the lines of a chunk from its file, preceded by the path
+// like the text that was embedded.
+func chunkText(match Match) (string, error) {
+	if document.IsDocument(match.Path) {
+		return match.Path, nil // only the extracted text was embedded
+	}
+
+	data, err := os.ReadFile(match.Path) // #nosec
+	if err != nil {
+		if stderrors.Is(err, os.ErrNotExist) {
+			return match.Path, nil // deleted since it was indexed
+		}
+
+		return "", fmt.Errorf("error reading %s: %w", match.Path, err)
+	}
+
+	lines := strings.SplitAfter(string(data), "\n")
+	start := min(max(match.StartLine-1, 0), len(lines))
+	end := min(max(match.EndLine, start), len(lines))
+
+	return match.Path + "\n" + strings.Join(lines[start:end], ""), nil
+}
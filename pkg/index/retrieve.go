@@ -0,0 +1,135 @@
+package index
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/emilkje/cwc/pkg/datasample"
+	"github.com/emilkje/cwc/pkg/document"
+)
+
+const (
+	// rrfK dampens the weight of the top ranks in reciprocal rank fusion.
+	rrfK = 60
+	// candidateFactor is how many more candidates than requested each
+	// search returns, so that the fused ranking has enough to choose from.
+	candidateFactor = 3
+)
+
+// Retrieve finds the chunks most relevant to the query. Vector search finds
+// chunks about the same thing as the query, while keyword search finds the
+// exact identifiers and error messages that embeddings tend to miss. The two
+// rankings are merged with reciprocal rank fusion, so that chunks found by
+// both rank highest, and each chunk appears once. Given a reranker, the
+// best candidates of the merged ranking are ordered by it instead.
+func Retrieve(ctx context.Context, store Store, embedder Embedder, reranker Reranker, query string,
+	limit int,
+) ([]Match, error) {
+	model, err := store.Model(ctx)
+	if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+
+	if model == "" {
+		return nil, fmt.Errorf("the index at %s is empty, run cwc index first", store.Location())
+	}
+
+	if model != embedder.Model() {
+		return nil, fmt.Errorf("the index was built with %s rather than %s, run cwc index to rebuild it",
+			model, embedder.Model())
+	}
+
+	embeddings, err := embedder.Embed(ctx, []string{query})
+	if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+
+	semantic, err := store.Search(ctx, embeddings[0], limit*candidateFactor)
+	if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+
+	keywords, err := BuildKeywordIndex(ctx, store)
+	if err != nil {
+		return nil, err
+	}
+
+	keyword := keywords.Search(query, limit*candidateFactor)
+
+	if reranker == nil {
+		return fuse(limit, semantic, keyword), nil
+	}
+
+	return rerank(ctx, reranker, query, fuse(limit*candidateFactor, semantic, keyword), limit)
+}
+
+// BuildKeywordIndex indexes the text of the chunks in the store, read from
+// the files on disk. Documents and sampled data files, whose text differs
+// from the file itself, are left to vector search.
+func BuildKeywordIndex(ctx context.Context, store Store) (*KeywordIndex, error) {
+	files, err := store.Files(ctx)
+	if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+
+	keywords := NewKeywordIndex()
+
+	for path := range files {
+		if document.IsDocument(path) {
+			continue
+		}
+
+		info, err := os.Stat(path)
+		if err != nil || datasample.Applies(path, info.Size(), nil) {
+			continue
+		}
+
+		data, err := os.ReadFile(path) // #nosec
+		if err != nil {
+			continue
+		}
+
+		chunks, texts := splitChunks(path, string(data))
+		for i, chunk := range chunks {
+			keywords.Add(path, chunk.StartLine, chunk.EndLine, texts[i])
+		}
+	}
+
+	return keywords, nil
+}
+
+// fuse merges rankings with reciprocal rank fusion, keeping the best limit
+// chunks. Chunks are the same when they start at the same line of the same
+// file.
+func fuse(limit int, rankings ...[]Match) []Match {
+	type key struct {
+		path string
+		line int
+	}
+
+	merged := make(map[key]*Match)
+
+	for _, ranking := range rankings {
+		for rank, match := range ranking {
+			k := key{match.Path, match.StartLine}
+
+			m, ok := merged[k]
+			if !ok {
+				m = &Match{Path: match.Path, StartLine: match.StartLine, EndLine: match.EndLine}
+				merged[k] = m
+			}
+
+			m.Score += 1 / float32(rrfK+rank+1)
+		}
+	}
+
+	matches := make([]Match, 0, len(merged))
+	for _, m := range merged {
+		matches = append(matches, *m)
+	}
+
+	sortMatches(matches)
+
+	return matches[:min(limit, len(matches))]
+}
@@ -0,0 +1,114 @@
+package index
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	stderrors "errors"
+	"fmt"
+	"os"
+	"sort"
+)
+
+// Status describes the contents of a store and how far it has fallen behind
+// the files in the working tree.
+type Status struct {
+	Location string
+	Model    string
+	Files    int
+	Chunks   int
+	Size     int64
+	// Changed lists the indexed files whose content changed since they
+	// were indexed, and Deleted those that no longer exist.
+	Changed []string
+	Deleted []string
+}
+
+// Inspect reports the status of the store. Files whose size or modification
+// time changed are hashed to tell whether their content did.
+func Inspect(ctx context.Context, store Store) (*Status, error) {
+	model, err := store.Model(ctx)
+	if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+
+	files, err := store.Files(ctx)
+	if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+
+	size, err := store.Size(ctx)
+	if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+
+	status := &Status{Location: store.Location(), Model: model, Files: len(files), Size: size}
+
+	for path, entry := range files {
+		status.Chunks += len(entry.Chunks)
+
+		changed, err := fileChanged(path, entry)
+		if err != nil {
+			if stderrors.Is(err, os.ErrNotExist) {
+				status.Deleted = append(status.Deleted, path)
+				continue
+			}
+
+			return nil, err
+		}
+
+		if changed {
+			status.Changed = append(status.Changed, path)
+		}
+	}
+
+	sort.Strings(status.Changed)
+	sort.Strings(status.Deleted)
+
+	return status, nil
+}
+
+// Prune drops the files that no longer exist from the store, without
+// embedding anything, and returns how many were dropped.
+func Prune(ctx context.Context, store Store) (int, error) {
+	files, err := store.Files(ctx)
+	if err != nil {
+		return 0, err //nolint:wrapcheck
+	}
+
+	pruned := 0
+
+	for path := range files {
+		if _, err := os.Stat(path); !stderrors.Is(err, os.ErrNotExist) {
+			continue
+		}
+
+		if err := store.Delete(ctx, path); err != nil {
+			return pruned, err //nolint:wrapcheck
+		}
+
+		pruned++
+	}
+
+	return pruned, nil
+}
+
+func fileChanged(path string, entry *FileEntry) (bool, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return false, err //nolint:wrapcheck
+	}
+
+	if entry.Size == info.Size() && entry.ModTime.Equal(info.ModTime()) {
+		return false, nil
+	}
+
+	data, err := os.ReadFile(path) // #nosec
+	if err != nil {
+		return false, fmt.Errorf("error reading %s: %w", path, err)
+	}
+
+	sum := sha256.Sum256(data)
+
+	return hex.EncodeToString(sum[:]) != entry.Hash, nil
+}
@@ -0,0 +1,45 @@
+package index
+
+import (
+	"context"
+	"time"
+)
+
+// Store keeps the indexed files and their embeddings and finds the chunks
+// closest to a query. The local store keeps them in a file in the
+// repository, while an external store lets a team share one index.
+type Store interface {
+	// Model returns the embedding model of the stored chunks, or an empty
+	// string if the store is empty.
+	Model(ctx context.Context) (string, error)
+	// Files returns the indexed state of every file, keyed by path. The
+	// embeddings of the chunks may be left out.
+	Files(ctx context.Context) (map[string]*FileEntry, error)
+	// Put stores the entry of a file, replacing any previous one.
+	Put(ctx context.Context, path string, entry *FileEntry) error
+	// Touch records a new size and modification time of a file whose content
+	// is unchanged.
+	Touch(ctx context.Context, path string, size int64, modTime time.Time) error
+	// Delete drops a file from the store.
+	Delete(ctx context.Context, path string) error
+	// Reset empties the store, which holds embeddings of model from then on.
+	Reset(ctx context.Context, model string) error
+	// Search returns at most limit chunks, most similar to the embedding
+	// first.
+	Search(ctx context.Context, embedding []float32, limit int) ([]Match, error)
+	// Size returns the storage used by the index in bytes, or an estimate
+	// of it for external stores.
+	Size(ctx context.Context) (int64, error)
+	// Flush persists the changes made so far.
+	Flush(ctx context.Context) error
+	// Location tells where the index is stored, for display.
+	Location() string
+}
+
+// Match is a chunk found by a search, with its similarity to the query.
+type Match struct {
+	Path      string
+	StartLine int
+	EndLine   int
+	Score     float32
+}
@@ -0,0 +1,120 @@
+package interpolate
+
+import (
+	"bytes"
+	"context"
+	stderrors "errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"text/template"
+	"time"
+)
+
+const execTimeout = 30 * time.Second
+
+// Options provides what the template functions need from the caller.
+type Options struct {
+	// FileTree renders the files in the context. Without it {{fileTree}}
+	// fails.
+	FileTree func() string
+	// Confirm asks whether a command may run for {{exec}}. Without it, or if
+	// it returns false, {{exec}} fails.
+	Confirm func(command string) bool
+}
+
+// Expand evaluates the Go template expressions in text:
+//
+//	{{gitBranch}}        the current git branch
+//	{{date}}             today's date, or {{date "Jan 2"}} in another layout
+//	{{fileTree}}         the tree of the files in the context
+//	{{env "TICKET"}}     an environment variable
+//	{{exec "go version"}} the output of a shell command, once confirmed
+//
+// Text without "{{" is returned as is. Templates can't refer to data, so
+// text such as a Go template quoted in a question fails to execute rather
+// than silently turning into something else.
+func Expand(text string, opts *Options) (string, error) {
+	if !strings.Contains(text, "{{") {
+		return text, nil
+	}
+
+	funcs := template.FuncMap{
+		"gitBranch": gitBranch,
+		"date":      date,
+		"env":       os.Getenv,
+		"fileTree": func() (string, error) {
+			if opts.FileTree == nil {
+				return "", stderrors.New("there are no files in the context")
+			}
+
+			return opts.FileTree(), nil
+		},
+		"exec": func(command string) (string, error) {
+			if opts.Confirm == nil || !opts.Confirm(command) {
+				return "", fmt.Errorf("not running %q", command)
+			}
+
+			return run(command)
+		},
+	}
+
+	tmpl, err := template.New("prompt").Funcs(funcs).Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("error parsing the template: %w", err)
+	}
+
+	var expanded bytes.Buffer
+	if err := tmpl.Execute(&expanded, struct{}{}); err != nil {
+		return "", fmt.Errorf("error expanding the template: %w", err)
+	}
+
+	return expanded.String(), nil
+}
+
+func gitBranch() (string, error) {
+	output, err := run("git rev-parse --abbrev-ref HEAD")
+	if err != nil {
+		return "", fmt.Errorf("error getting the git branch: %w", err)
+	}
+
+	return output, nil
+}
+
+func date(layout ...string) string {
+	if len(layout) > 0 {
+		return time.Now().Format(layout[0])
+	}
+
+	return time.Now().Format(time.DateOnly)
+}
+
+// run runs the command in a shell and returns its output without the
+// trailing newline.
+func run(command string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), execTimeout)
+	defer cancel()
+
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", command)
+	} else {
+		cmd = exec.CommandContext(ctx, "sh", "-c", command)
+	}
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	output, err := cmd.Output()
+	if err != nil {
+		if message := strings.TrimSpace(stderr.String()); message != "" {
+			return "", fmt.Errorf("%q failed: %w: %s", command, err, message)
+		}
+
+		return "", fmt.Errorf("%q failed: %w", command, err)
+	}
+
+	return strings.TrimRight(string(output), "\r\n"), nil
+}
@@ -0,0 +1,99 @@
+package languages
+
+// Comment describes how comments are written in a language. Either form may be
+// missing, e.g. JSON has neither and Python has no block comments.
+type Comment struct {
+	// Line starts a comment that runs to the end of the line, e.g. "//".
+	Line string
+	// BlockStart and BlockEnd enclose a comment, e.g. "/*" and "*/".
+	BlockStart string
+	BlockEnd   string
+}
+
+var (
+	cStyle     = Comment{Line: "//", BlockStart: "/*", BlockEnd: "*/"} //nolint:gochecknoglobals
+	hashStyle  = Comment{Line: "#"}                                    //nolint:gochecknoglobals
+	dashStyle  = Comment{Line: "--"}                                   //nolint:gochecknoglobals
+	xmlStyle   = Comment{BlockStart: "<!--", BlockEnd: "-->"}          //nolint:gochecknoglobals
+	lispStyle  = Comment{Line: ";"}                                    //nolint:gochecknoglobals
+	slashStyle = Comment{Line: "//"}                                   //nolint:gochecknoglobals
+)
+
+// comments holds the comment syntax of the languages it is known for. The
+// Linguist data doesn't include it, so it is maintained by hand.
+var comments = map[string]Comment{ //nolint:gochecknoglobals
+	"Ada":             dashStyle,
+	"Assembly":        lispStyle,
+	"Batchfile":       {Line: "REM"},
+	"C":               cStyle,
+	"C#":              cStyle,
+	"C++":             cStyle,
+	"CMake":           hashStyle,
+	"CSS":             {BlockStart: "/*", BlockEnd: "*/"},
+	"Clojure":         lispStyle,
+	"CoffeeScript":    {Line: "#", BlockStart: "###", BlockEnd: "###"},
+	"Common Lisp":     {Line: ";", BlockStart: "#|", BlockEnd: "|#"},
+	"Dart":            cStyle,
+	"Dockerfile":      hashStyle,
+	"Elixir":          hashStyle,
+	"Elm":             {Line: "--", BlockStart: "{-", BlockEnd: "-}"},
+	"Emacs Lisp":      lispStyle,
+	"Erlang":          {Line: "%"},
+	"F#":              {Line: "//", BlockStart: "(*", BlockEnd: "*)"},
+	"Fortran":         {Line: "!"},
+	"GraphQL":         hashStyle,
+	"Go":              cStyle,
+	"Groovy":          cStyle,
+	"HCL":             {Line: "#", BlockStart: "/*", BlockEnd: "*/"},
+	"HTML":            xmlStyle,
+	"Haskell":         {Line: "--", BlockStart: "{-", BlockEnd: "-}"},
+	"INI":             lispStyle,
+	"Java":            cStyle,
+	"JavaScript":      cStyle,
+	"Julia":           {Line: "#", BlockStart: "#=", BlockEnd: "=#"},
+	"Kotlin":          cStyle,
+	"Less":            cStyle,
+	"Lua":             {Line: "--", BlockStart: "--[[", BlockEnd: "]]"},
+	"MATLAB":          {Line: "%", BlockStart: "%{", BlockEnd: "%}"},
+	"Makefile":        hashStyle,
+	"Markdown":        xmlStyle,
+	"Nix":             {Line: "#", BlockStart: "/*", BlockEnd: "*/"},
+	"OCaml":           {BlockStart: "(*", BlockEnd: "*)"},
+	"Objective-C":     cStyle,
+	"PHP":             cStyle,
+	"Perl":            hashStyle,
+	"PowerShell":      {Line: "#", BlockStart: "<#", BlockEnd: "#>"},
+	"Prolog":          {Line: "%", BlockStart: "/*", BlockEnd: "*/"},
+	"Protocol Buffer": cStyle,
+	"Python":          hashStyle,
+	"R":               hashStyle,
+	"Racket":          lispStyle,
+	"Raku":            hashStyle,
+	"Ruby":            {Line: "#", BlockStart: "=begin", BlockEnd: "=end"},
+	"Rust":            cStyle,
+	"SCSS":            cStyle,
+	"SQL":             {Line: "--", BlockStart: "/*", BlockEnd: "*/"},
+	"Scala":           cStyle,
+	"Scheme":          lispStyle,
+	"Shell":           hashStyle,
+	"Solidity":        cStyle,
+	"Swift":           cStyle,
+	"TOML":            hashStyle,
+	"TSX":             cStyle,
+	"TeX":             {Line: "%"},
+	"TypeScript":      cStyle,
+	"V":               cStyle,
+	"Verilog":         cStyle,
+	"Vim Script":      {Line: `"`},
+	"Vue":             xmlStyle,
+	"XML":             xmlStyle,
+	"YAML":            hashStyle,
+	"Zig":             slashStyle,
+}
+
+// CommentSyntax returns how comments are written in the language with the
+// given canonical name, if it is known.
+func CommentSyntax(name string) (Comment, bool) {
+	comment, ok := comments[name]
+	return comment, ok
+}
@@ -0,0 +1,332 @@
+package languages
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// contentSniffBytes is how much of a file is read to detect its language
+// from the contents.
+const contentSniffBytes = 4096
+
+// defaultLanguages picks the language of an ambiguous extension when the
+// contents give no hint, so that e.g. .h is C rather than whichever of C,
+// C++ and Objective-C happens to come first.
+var defaultLanguages = map[string]string{ //nolint:gochecknoglobals
+	".asm":  "Assembly",
+	".cgi":  "Shell",
+	".cs":   "C#",
+	".d":    "D",
+	".ex":   "Elixir",
+	".fs":   "F#",
+	".h":    "C",
+	".hh":   "C++",
+	".html": "HTML",
+	".inc":  "PHP",
+	".json": "JSON",
+	".l":    "Lex",
+	".m":    "Objective-C",
+	".md":   "Markdown",
+	".ml":   "OCaml",
+	".php":  "PHP",
+	".pl":   "Perl",
+	".pm":   "Perl",
+	".pp":   "Puppet",
+	".r":    "R",
+	".rs":   "Rust",
+	".s":    "Unix Assembly",
+	".sql":  "SQL",
+	".t":    "Perl",
+	".ts":   "TypeScript",
+	".tsx":  "TSX",
+	".txt":  "Text",
+	".v":    "Verilog",
+	".yaml": "YAML",
+	".yml":  "YAML",
+}
+
+// heuristic picks language for a file of an ambiguous extension if its
+// contents match pattern.
+type heuristic struct {
+	language string
+	pattern  *regexp.Regexp
+}
+
+// heuristics are tried in order for the extensions they are listed under.
+// They are loosely based on the ones used by GitHub Linguist.
+var heuristics = map[string][]heuristic{ //nolint:gochecknoglobals
+	".cs": {
+		{"Smalltalk", regexp.MustCompile(`![\w\s]+methodsFor: `)},
+	},
+	".d": {
+		{"DTrace", regexp.MustCompile(`(?m)^\s*(syscall|fbt|pid\d*|proc|profile|dtrace):`)},
+		{"Makefile", regexp.MustCompile(`(?m)^[\w./-]+\.o\s*:`)},
+	},
+	".h": {
+		{"Objective-C", regexp.MustCompile(`(?m)^\s*(@interface|@implementation|@protocol|@end|#import)\b`)},
+		{"C++", regexp.MustCompile(`(?m)^\s*(class\s+\w+\s*[:{]|namespace\s+\w*\s*\{|template\s*<)|std::|` +
+			`#include\s*<(iostream|string|vector|memory|map|algorithm|cstdint)>`)},
+	},
+	".inc": {
+		{"PHP", regexp.MustCompile(`<\?(php|=)`)},
+		{"HTML", regexp.MustCompile(`(?m)^\s*<(!DOCTYPE|html|div|p|span|table|script)\b`)},
+	},
+	".m": {
+		{"Objective-C", regexp.MustCompile(`(?m)^\s*(@interface|@implementation|@protocol|@end|#import|#include)\b`)},
+		{"Mercury", regexp.MustCompile(`(?m)^:- module`)},
+		{"Mathematica", regexp.MustCompile(`\(\*[\s\S]*?\*\)`)},
+		{"MATLAB", regexp.MustCompile(`(?m)^\s*(function\b|%|end\s*$)`)},
+	},
+	".md": {
+		{"GCC Machine Description", regexp.MustCompile(`(?m)^\(define_`)},
+	},
+	".pl": {
+		{"Prolog", regexp.MustCompile(`(?m)^\s*:-|^\w+(\(.*\))?\s*:-`)},
+		{"Raku", regexp.MustCompile(`(?m)^\s*(use\s+v6|unit\s+(module|class)|my\s+class)\b`)},
+	},
+	".rs": {
+		{"RenderScript", regexp.MustCompile(`(?m)^#pragma\s+rs\b`)},
+	},
+	".t": {
+		{"Raku", regexp.MustCompile(`(?m)^\s*(use\s+v6|unit\s+(module|class)|my\s+class)\b`)},
+	},
+	".v": {
+		{"Coq", regexp.MustCompile(`(?m)^\s*(Require|Theorem|Lemma|Proof|Inductive|Definition)\b`)},
+		{"V", regexp.MustCompile(`(?m)^\s*(fn\s+\w+\s*\(|module\s+main\s*$)`)},
+	},
+}
+
+var (
+	xmlPattern = regexp.MustCompile(`^\s*<\?xml`) //nolint:gochecknoglobals
+	// vim: set ft=ruby: / vi: filetype=python / ex: syntax=sh
+	vimModeline = regexp.MustCompile(`(?m)(?:^|\s)(?:vim?|ex):.*?\b(?:ft|filetype|syntax)=([\w+#.-]+)`) //nolint:gochecknoglobals,lll
+	// -*- mode: ruby -*- / -*- ruby -*-
+	emacsModeline = regexp.MustCompile(`-\*-\s*(?:[^\n]*?;\s*)?(?:mode:\s*([\w+#.-]+)|([\w+#.-]+)\s*-\*-)`) //nolint:gochecknoglobals,lll
+)
+
+// Detector detects the languages of files, caching what it learns from
+// extensions. It is not safe for concurrent use.
+type Detector struct {
+	// cache holds the language of extensions claimed by a single language
+	cache map[string]string
+	// ambiguous holds the languages of extensions claimed by several of them
+	ambiguous map[string][]string
+}
+
+// NewDetector creates a Detector with an empty cache.
+func NewDetector() *Detector {
+	return &Detector{cache: make(map[string]string), ambiguous: make(map[string][]string)}
+}
+
+// Detect detects the language of a file from its name, like Makefile and
+// Dockerfile, or its extension. Files without an extension, or with one
+// claimed by several languages, are detected from the start of their
+// contents, see DetectContent. The canonical language name is returned.
+func (d *Detector) Detect(path string) (string, bool) {
+	base, ext := filepath.Base(path), filepath.Ext(path)
+
+	if name, ok := ByFilename(base); ok {
+		return name, true
+	}
+
+	if name, ok := d.cache[ext]; ok {
+		return name, true
+	}
+
+	candidates, ok := d.ambiguous[ext]
+	if !ok {
+		if ext != "" {
+			candidates = ByExtension(ext)
+		}
+
+		switch len(candidates) {
+		case 0:
+			if ext != "" {
+				return "", false
+			}
+		case 1:
+			// cache the extension for faster lookup
+			d.cache[ext] = candidates[0]
+			return candidates[0], true
+		default:
+			d.ambiguous[ext] = candidates
+		}
+	}
+
+	head, err := readHead(path)
+	if err != nil {
+		head = ""
+	}
+
+	return detectFromContent(ext, head, candidates)
+}
+
+// Detect detects the language of a file, see Detector.Detect.
+func Detect(path string) (string, bool) {
+	return NewDetector().Detect(path)
+}
+
+// DetectContent detects the language of a file from its name and contents,
+// without reading it from disk. The shebang line and vim or emacs modelines
+// are honored when the name doesn't settle it, and heuristics on the content
+// tell apart the languages that share an extension, like C, C++ and
+// Objective-C for .h.
+func DetectContent(path, content string) (string, bool) {
+	base, ext := filepath.Base(path), filepath.Ext(path)
+
+	if name, ok := ByFilename(base); ok {
+		return name, true
+	}
+
+	var candidates []string
+	if ext != "" {
+		candidates = ByExtension(ext)
+	}
+
+	switch {
+	case len(candidates) == 1:
+		return candidates[0], true
+	case len(candidates) == 0 && ext != "":
+		return "", false
+	}
+
+	return detectFromContent(ext, content[:min(len(content), contentSniffBytes)], candidates)
+}
+
+// detectFromContent detects the language of a file from its shebang line, a
+// vim or emacs modeline or, for extensions claimed by several languages,
+// heuristics on its contents. Only the given candidates, sorted by name, are
+// considered unless there are none.
+func detectFromContent(ext, head string, candidates []string) (string, bool) {
+	allowed := func(name string) bool {
+		return len(candidates) == 0 || slices.Contains(candidates, name)
+	}
+
+	if name, ok := languageFromModeline(head); ok && allowed(name) {
+		return name, true
+	}
+
+	if name, ok := languageFromShebang(head, candidates); ok {
+		return name, true
+	}
+
+	if len(candidates) == 0 {
+		return "", false
+	}
+
+	if slices.Contains(candidates, "XML") && xmlPattern.MatchString(head) {
+		return "XML", true
+	}
+
+	for _, h := range heuristics[ext] {
+		if slices.Contains(candidates, h.language) && h.pattern.MatchString(head) {
+			return h.language, true
+		}
+	}
+
+	if name, ok := defaultLanguages[ext]; ok && slices.Contains(candidates, name) {
+		return name, true
+	}
+
+	return preferredCandidate(ext, candidates), true
+}
+
+// preferredCandidate picks the language for which ext is the primary
+// extension, or the first one by name, so the choice is at least stable. The
+// candidates are sorted by name.
+func preferredCandidate(ext string, candidates []string) string {
+	for _, name := range candidates {
+		if exts := languages[name].Extensions; len(exts) > 0 && exts[0] == ext {
+			return name
+		}
+	}
+
+	return candidates[0]
+}
+
+func readHead(path string) (string, error) {
+	file, err := os.Open(path) // #nosec
+	if err != nil {
+		return "", err //nolint:wrapcheck
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, contentSniffBytes))
+	if err != nil {
+		return "", err //nolint:wrapcheck
+	}
+
+	return string(data), nil
+}
+
+func languageFromModeline(head string) (string, bool) {
+	var mode string
+
+	if match := vimModeline.FindStringSubmatch(head); match != nil {
+		mode = match[1]
+	} else if match := emacsModeline.FindStringSubmatch(head); match != nil {
+		mode = match[1] + match[2]
+	}
+
+	if mode == "" {
+		return "", false
+	}
+
+	name, _, ok := Lookup(mode)
+
+	return name, ok
+}
+
+// languageFromShebang finds the language whose interpreters include the one
+// in the shebang line, e.g. python3 in "#!/usr/bin/env python3".
+func languageFromShebang(head string, candidates []string) (string, bool) {
+	line, _, _ := strings.Cut(head, "\n")
+	if !strings.HasPrefix(line, "#!") {
+		return "", false
+	}
+
+	fields := strings.Fields(strings.TrimPrefix(line, "#!"))
+	if len(fields) == 0 {
+		return "", false
+	}
+
+	interpreter := filepath.Base(fields[0])
+
+	if interpreter == "env" {
+		interpreter = ""
+
+		// skip options like -S and variable assignments
+		for _, field := range fields[1:] {
+			if !strings.HasPrefix(field, "-") && !strings.Contains(field, "=") {
+				interpreter = filepath.Base(field)
+				break
+			}
+		}
+	}
+
+	if interpreter == "" {
+		return "", false
+	}
+
+	names := candidates
+	if len(names) == 0 {
+		names = Names()
+	}
+
+	// python3.11 is listed as python3 or python
+	major, _, _ := strings.Cut(interpreter, ".")
+
+	for _, candidate := range []string{interpreter, major, strings.TrimRight(major, "0123456789")} {
+		for _, name := range names {
+			if slices.Contains(languages[name].Interpreters, candidate) {
+				return name, true
+			}
+		}
+	}
+
+	return "", false
+}
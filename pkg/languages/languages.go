@@ -1,6 +1,6 @@
 // Code generated with lang-gen. DO NOT EDIT.
 
-package filetree
+package languages
 
 type Language struct {
 	Type               string   `yaml:"type"`
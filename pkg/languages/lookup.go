@@ -0,0 +1,170 @@
+// Package languages exposes the language definitions of GitHub Linguist,
+// generated into languages.go with lang-gen. Languages are identified by their
+// canonical Linguist name, such as "Go" or "TypeScript".
+package languages
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+)
+
+var (
+	indexOnce sync.Once //nolint:gochecknoglobals
+	// byExtension and byFilename index the languages for the lookups done
+	// for every gathered file.
+	byExtension map[string][]string //nolint:gochecknoglobals
+	byFilename  map[string]string   //nolint:gochecknoglobals
+)
+
+func buildIndexes() {
+	byExtension = make(map[string][]string)
+	byFilename = make(map[string]string)
+
+	for _, name := range Names() {
+		lang := languages[name]
+
+		for _, ext := range lang.Extensions {
+			byExtension[ext] = append(byExtension[ext], name)
+		}
+
+		for _, base := range lang.Filenames {
+			if _, ok := byFilename[base]; !ok {
+				byFilename[base] = name
+			}
+		}
+	}
+}
+
+// Get returns the language with the given canonical name.
+func Get(name string) (Language, bool) {
+	lang, ok := languages[name]
+	return lang, ok
+}
+
+// Names returns the canonical names of all languages, sorted.
+func Names() []string {
+	names := make([]string, 0, len(languages))
+	for name := range languages {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+// Lookup finds a language by its name, one of its aliases or one of its
+// extensions, ignoring case. The canonical language name is returned
+// alongside the language definition. Names take precedence over aliases, and
+// an extension claimed by several languages resolves as it does for files,
+// e.g. "h" to C, so the result is the same on every run.
+func Lookup(name string) (string, Language, bool) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "" {
+		return "", Language{}, false
+	}
+
+	names := Names()
+
+	for _, langName := range names {
+		if strings.ToLower(langName) == name {
+			return langName, languages[langName], true
+		}
+	}
+
+	for _, langName := range names {
+		if slices.Contains(languages[langName].Aliases, name) {
+			return langName, languages[langName], true
+		}
+	}
+
+	ext := name
+	if !strings.HasPrefix(ext, ".") {
+		ext = "." + ext
+	}
+
+	candidates := ByExtension(ext)
+	if len(candidates) == 0 {
+		return "", Language{}, false
+	}
+
+	langName, ok := defaultLanguages[ext]
+	if !ok || !slices.Contains(candidates, langName) {
+		langName = preferredCandidate(ext, candidates)
+	}
+
+	return langName, languages[langName], true
+}
+
+// Resolve maps language names and aliases, such as "go" or "ts", to their
+// canonical names, failing on the first one that is unknown.
+func Resolve(names []string) ([]string, error) {
+	resolved := make([]string, 0, len(names))
+
+	for _, name := range names {
+		langName, _, ok := Lookup(name)
+		if !ok {
+			return nil, fmt.Errorf("unknown language: %s", name)
+		}
+
+		resolved = append(resolved, langName)
+	}
+
+	return resolved, nil
+}
+
+// ByExtension returns the names of the languages that claim the extension,
+// e.g. ".h", sorted. Several languages may claim the same extension.
+func ByExtension(ext string) []string {
+	indexOnce.Do(buildIndexes)
+
+	return slices.Clone(byExtension[ext])
+}
+
+// ByFilename returns the language of files with the given base name, like
+// Makefile or Dockerfile.
+func ByFilename(base string) (string, bool) {
+	indexOnce.Do(buildIndexes)
+
+	name, ok := byFilename[base]
+
+	return name, ok
+}
+
+// Match returns the first of the given languages that claims the extension or
+// name of the file. Unlike Detect, asking for one of the languages sharing an
+// extension, e.g. the .ts of TypeScript and XML, doesn't depend on which of
+// them the file would be detected as.
+func Match(path string, names []string) (string, bool) {
+	ext, base := filepath.Ext(path), filepath.Base(path)
+
+	for _, name := range names {
+		lang := languages[name]
+		if slices.Contains(lang.Extensions, ext) || slices.Contains(lang.Filenames, base) {
+			return name, true
+		}
+	}
+
+	return "", false
+}
+
+// FenceLabel is the label of code fences for the language. The ace mode is
+// used where it names the language, but it is c_cpp for C, C++ and friends and
+// text for many others.
+func FenceLabel(name string) string {
+	lang := languages[name]
+
+	if lang.AceMode != "text" && lang.AceMode != "c_cpp" {
+		return lang.AceMode
+	}
+
+	if len(lang.Aliases) > 0 {
+		return lang.Aliases[0]
+	}
+
+	return strings.ReplaceAll(strings.ToLower(name), " ", "-")
+}
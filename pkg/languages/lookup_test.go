@@ -0,0 +1,34 @@
+package languages
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLookupAmbiguous(t *testing.T) {
+	tests := map[string]string{
+		"h":   "C",
+		".h":  "C",
+		"hh":  "C++",
+		"go":  "Go",
+		"ts":  "TypeScript",
+		"C++": "C++",
+	}
+
+	for name, want := range tests {
+		for i := 0; i < 100; i++ {
+			got, _, ok := Lookup(name)
+
+			if !assert.True(t, ok, name) || !assert.Equal(t, want, got, name) {
+				break
+			}
+		}
+	}
+}
+
+func TestLookupUnknown(t *testing.T) {
+	_, _, ok := Lookup("not-a-language")
+
+	assert.False(t, ok)
+}
@@ -0,0 +1,221 @@
+// Package linttriage reads the findings of golangci-lint, groups them for the
+// model to triage, and reads back its verdict and fix for each finding.
+package linttriage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Finding is an issue reported by a linter.
+type Finding struct {
+	Linter   string
+	Text     string
+	Severity string
+	Path     string
+	Line     int
+	Column   int
+}
+
+// report is the part of the JSON output of golangci-lint that is used, the
+// same in the --out-format json of v1 and the --output.json.path of v2.
+type report struct {
+	Issues []struct {
+		FromLinter string
+		Text       string
+		Severity   string
+		Pos        struct {
+			Filename string
+			Line     int
+			Column   int
+		}
+	}
+}
+
+// Parse reads the JSON output of golangci-lint. Text before the JSON, such
+// as the log lines some versions write to the same stream, is skipped.
+func Parse(data []byte) ([]Finding, error) {
+	start := strings.IndexByte(string(data), '{')
+	if start < 0 {
+		return nil, errors.New("no JSON in the input, run golangci-lint with --out-format json")
+	}
+
+	var r report
+
+	decoder := json.NewDecoder(strings.NewReader(string(data[start:])))
+	if err := decoder.Decode(&r); err != nil {
+		return nil, fmt.Errorf("error parsing the golangci-lint output: %w", err)
+	}
+
+	findings := make([]Finding, 0, len(r.Issues))
+
+	for _, issue := range r.Issues {
+		findings = append(findings, Finding{
+			Linter:   issue.FromLinter,
+			Text:     issue.Text,
+			Severity: issue.Severity,
+			Path:     filepath.Clean(filepath.FromSlash(issue.Pos.Filename)),
+			Line:     issue.Pos.Line,
+			Column:   issue.Pos.Column,
+		})
+	}
+
+	return findings, nil
+}
+
+// Group is the findings of a linter, triaged together as they tend to share
+// their cause and their fix.
+type Group struct {
+	Linter   string
+	Findings []Finding
+}
+
+// Paths returns the distinct files of the findings, in order.
+func (g *Group) Paths() []string {
+	var paths []string
+
+	seen := make(map[string]bool)
+
+	for _, finding := range g.Findings {
+		if !seen[finding.Path] {
+			seen[finding.Path] = true
+			paths = append(paths, finding.Path)
+		}
+	}
+
+	return paths
+}
+
+// GroupFindings groups the findings by linter, the linters with the most
+// findings first, splitting groups with more than size findings.
+func GroupFindings(findings []Finding, size int) []Group {
+	byLinter := make(map[string][]Finding)
+
+	var linters []string
+
+	for _, finding := range findings {
+		if _, ok := byLinter[finding.Linter]; !ok {
+			linters = append(linters, finding.Linter)
+		}
+
+		byLinter[finding.Linter] = append(byLinter[finding.Linter], finding)
+	}
+
+	sort.SliceStable(linters, func(i, j int) bool {
+		return len(byLinter[linters[i]]) > len(byLinter[linters[j]])
+	})
+
+	var groups []Group
+
+	for _, linter := range linters {
+		group := byLinter[linter]
+
+		for size > 0 && len(group) > size {
+			groups = append(groups, Group{Linter: linter, Findings: group[:size]})
+			group = group[size:]
+		}
+
+		groups = append(groups, Group{Linter: linter, Findings: group})
+	}
+
+	return groups
+}
+
+// Verdicts of the model on a finding.
+const (
+	// Fix means the finding is real and comes with a diff fixing it.
+	Fix = "fix"
+	// FalsePositive means the code is correct as it is.
+	FalsePositive = "false positive"
+	// Ignore means the finding is real but not worth fixing.
+	Ignore = "ignore"
+)
+
+// Prompt asks the model to triage the findings of the group, whose files are
+// in its context.
+func Prompt(group *Group) string {
+	var out strings.Builder
+
+	fmt.Fprintf(&out, "Triage these findings of the %s linter in the files in the context. For each finding, "+
+		"decide whether it is a real problem to fix, a false positive where the code is correct as it is, or "+
+		"real but not worth fixing. Reply with a section per finding, in order, starting with a line like "+
+		"\"### Finding 1\", followed by a line \"Verdict: %s\", \"Verdict: %s\" or \"Verdict: %s\", a sentence or "+
+		"two on why, and for fixes a unified diff against the file in the context with a/ and b/ paths, in a "+
+		"```diff block. Fix the cause instead of silencing the linter with a nolint comment.\n\n",
+		group.Linter, Fix, FalsePositive, Ignore)
+
+	for i, finding := range group.Findings {
+		fmt.Fprintf(&out, "%d. %s:%d:%d: %s\n", i+1, finding.Path, finding.Line, finding.Column, finding.Text)
+	}
+
+	return out.String()
+}
+
+// Triage is the verdict of the model on a finding.
+type Triage struct {
+	Finding Finding
+	// Verdict is Fix, FalsePositive or Ignore, or what the model wrote if
+	// it is none of them.
+	Verdict string
+	// Reply is the section of the reply on the finding, with the reason and
+	// the diff of a fix.
+	Reply string
+}
+
+var (
+	sectionRegexp = regexp.MustCompile(`(?m)^#+\s*Finding\s+(\d+)\b.*$`)       //nolint:gochecknoglobals
+	verdictRegexp = regexp.MustCompile(`(?im)^\**verdict\**:?\**\s*(.+?)\s*$`) //nolint:gochecknoglobals
+)
+
+// ParseReply splits the reply into the triage of each finding of the group.
+// Findings the reply leaves out are not returned.
+func ParseReply(group *Group, reply string) []Triage {
+	headings := sectionRegexp.FindAllStringSubmatchIndex(reply, -1)
+
+	var triages []Triage
+
+	seen := make(map[int]bool)
+
+	for i, heading := range headings {
+		n, _ := strconv.Atoi(reply[heading[2]:heading[3]])
+		if n < 1 || n > len(group.Findings) || seen[n] {
+			continue
+		}
+
+		seen[n] = true
+
+		end := len(reply)
+		if i+1 < len(headings) {
+			end = headings[i+1][0]
+		}
+
+		section := strings.TrimSpace(reply[heading[1]:end])
+
+		var verdict string
+		if m := verdictRegexp.FindStringSubmatch(section); m != nil {
+			verdict = strings.ToLower(strings.Trim(m[1], "*_`. "))
+
+			for _, known := range []string{FalsePositive, Fix, Ignore} {
+				if strings.HasPrefix(verdict, known) {
+					verdict = known
+					break
+				}
+			}
+		}
+
+		triages = append(triages, Triage{Finding: group.Findings[n-1], Verdict: verdict, Reply: section})
+	}
+
+	return triages
+}
+
+// Explanation returns the section of the reply without its verdict line.
+func Explanation(section string) string {
+	return strings.TrimSpace(verdictRegexp.ReplaceAllString(section, ""))
+}
@@ -0,0 +1,123 @@
+package logging
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+
+	"github.com/emilkje/cwc/pkg/ui"
+)
+
+// consoleHandler prints records the way cwc has always printed its
+// diagnostics, e.g. "warning: could not read file path=main.go", in the
+// color of the theme for the level.
+type consoleHandler struct {
+	level  slog.Level
+	attrs  []slog.Attr
+	groups []string
+}
+
+func (h *consoleHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level
+}
+
+func (h *consoleHandler) Handle(_ context.Context, record slog.Record) error {
+	var line strings.Builder
+
+	line.WriteString(levelLabel(record.Level))
+	line.WriteString(": ")
+	line.WriteString(record.Message)
+
+	for _, attr := range h.attrs {
+		writeAttr(&line, "", attr)
+	}
+
+	prefix := ""
+	if len(h.groups) > 0 {
+		prefix = strings.Join(h.groups, ".") + "."
+	}
+
+	record.Attrs(func(attr slog.Attr) bool {
+		writeAttr(&line, prefix, attr)
+		return true
+	})
+
+	line.WriteString("\n")
+
+	ui.PrintDiagnostic(line.String(), messageType(record.Level))
+
+	return nil
+}
+
+func (h *consoleHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	prefix := ""
+	if len(h.groups) > 0 {
+		prefix = strings.Join(h.groups, ".") + "."
+	}
+
+	clone := *h
+	clone.attrs = append([]slog.Attr(nil), h.attrs...)
+
+	for _, attr := range attrs {
+		clone.attrs = append(clone.attrs, slog.Attr{Key: prefix + attr.Key, Value: attr.Value})
+	}
+
+	return &clone
+}
+
+func (h *consoleHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+
+	clone := *h
+	clone.groups = append(append([]string(nil), h.groups...), name)
+
+	return &clone
+}
+
+func writeAttr(line *strings.Builder, prefix string, attr slog.Attr) {
+	attr.Value = attr.Value.Resolve()
+	if attr.Equal(slog.Attr{}) {
+		return
+	}
+
+	if attr.Value.Kind() == slog.KindGroup {
+		for _, member := range attr.Value.Group() {
+			writeAttr(line, prefix+attr.Key+".", member)
+		}
+
+		return
+	}
+
+	line.WriteString(" ")
+	line.WriteString(prefix + attr.Key)
+	line.WriteString("=")
+	line.WriteString(quoteIfNeeded(attr.Value.String()))
+}
+
+func levelLabel(level slog.Level) string {
+	switch {
+	case level >= slog.LevelError:
+		return "error"
+	case level >= slog.LevelWarn:
+		return "warning"
+	case level >= slog.LevelInfo:
+		return "info"
+	default:
+		return "debug"
+	}
+}
+
+func messageType(level slog.Level) ui.MessageType {
+	switch {
+	case level >= slog.LevelError:
+		return ui.MessageTypeError
+	case level >= slog.LevelWarn:
+		return ui.MessageTypeWarning
+	case level >= slog.LevelInfo:
+		return ui.MessageTypeInfo
+	default:
+		return ui.MessageTypeDim
+	}
+}
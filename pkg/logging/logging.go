@@ -0,0 +1,148 @@
+// Package logging sets up the structured logger cwc reports operational
+// messages with, such as a file that couldn't be read or a trace that
+// couldn't be exported. Log records go to stderr and optionally to a log
+// file, so they stay apart from the chat output on stdout. Use the log/slog
+// functions, e.g. slog.Warn, to log.
+package logging
+
+import (
+	"context"
+	stderrors "errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// FormatText is readable by humans, a line per record.
+	FormatText = "text"
+	// FormatJSON is a JSON object per record, for other programs.
+	FormatJSON = "json"
+)
+
+// Options controls what is logged and where.
+type Options struct {
+	// Level is the least severe level logged, e.g. slog.LevelWarn.
+	Level slog.Level
+	// Format is FormatText or FormatJSON.
+	Format string
+	// File is a file the records are appended to besides stderr, if set.
+	File string
+}
+
+// ParseLevel parses a level such as debug, info, warn or error.
+func ParseLevel(name string) (slog.Level, error) {
+	var level slog.Level
+
+	if err := level.UnmarshalText([]byte(name)); err != nil {
+		return 0, fmt.Errorf("unknown log level %q, expected debug, info, warn or error", name)
+	}
+
+	return level, nil
+}
+
+// Setup makes the logger described by opts the default of log/slog. The log
+// file is left open until the process exits, so that messages logged while
+// the command completes are written too. Its writes aren't buffered, so
+// nothing is lost by not closing it.
+func Setup(opts Options) error {
+	var console slog.Handler
+
+	switch opts.Format {
+	case FormatText, "":
+		console = &consoleHandler{level: opts.Level}
+	case FormatJSON:
+		console = slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{Level: opts.Level})
+	default:
+		return fmt.Errorf("unknown log format %q, expected %s or %s", opts.Format, FormatText, FormatJSON)
+	}
+
+	if opts.File == "" {
+		slog.SetDefault(slog.New(console))
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(opts.File), 0o700); err != nil { //nolint:gomnd
+		return fmt.Errorf("error creating log directory: %w", err)
+	}
+
+	file, err := os.OpenFile(opts.File, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600) //nolint:gomnd
+	if err != nil {
+		return fmt.Errorf("error opening log file: %w", err)
+	}
+
+	slog.SetDefault(slog.New(&fanoutHandler{handlers: []slog.Handler{console, fileHandler(file, opts)}}))
+
+	return nil
+}
+
+// fileHandler writes the records to the log file in the chosen format. The
+// text format of the file is logfmt rather than the console format, so that
+// the records of many runs can be searched by their attributes.
+func fileHandler(w io.Writer, opts Options) slog.Handler {
+	handlerOpts := &slog.HandlerOptions{Level: opts.Level}
+
+	if opts.Format == FormatJSON {
+		return slog.NewJSONHandler(w, handlerOpts)
+	}
+
+	return slog.NewTextHandler(w, handlerOpts)
+}
+
+// fanoutHandler passes the records to every handler enabled for their level.
+type fanoutHandler struct {
+	handlers []slog.Handler
+}
+
+func (h *fanoutHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	for _, handler := range h.handlers {
+		if handler.Enabled(ctx, level) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (h *fanoutHandler) Handle(ctx context.Context, record slog.Record) error {
+	var errs []error
+
+	for _, handler := range h.handlers {
+		if handler.Enabled(ctx, record.Level) {
+			errs = append(errs, handler.Handle(ctx, record.Clone()))
+		}
+	}
+
+	return stderrors.Join(errs...)
+}
+
+func (h *fanoutHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	handlers := make([]slog.Handler, 0, len(h.handlers))
+	for _, handler := range h.handlers {
+		handlers = append(handlers, handler.WithAttrs(attrs))
+	}
+
+	return &fanoutHandler{handlers: handlers}
+}
+
+func (h *fanoutHandler) WithGroup(name string) slog.Handler {
+	handlers := make([]slog.Handler, 0, len(h.handlers))
+	for _, handler := range h.handlers {
+		handlers = append(handlers, handler.WithGroup(name))
+	}
+
+	return &fanoutHandler{handlers: handlers}
+}
+
+// quoteIfNeeded quotes values that would otherwise be ambiguous in a
+// key=value list.
+func quoteIfNeeded(value string) string {
+	if value == "" || strings.ContainsAny(value, " \t\n\"=") {
+		return fmt.Sprintf("%q", value)
+	}
+
+	return value
+}
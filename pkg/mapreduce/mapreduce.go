@@ -0,0 +1,142 @@
+// Package mapreduce answers a question about more files than fit in the
+// context window at once. The files are split into parts, the question is
+// asked about each part, and the partial answers are combined, in several
+// rounds if need be, until they fit in the request that writes the final
+// answer.
+package mapreduce
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/emilkje/cwc/pkg/chat"
+	"github.com/emilkje/cwc/pkg/filetree"
+	"github.com/emilkje/cwc/pkg/summarize"
+)
+
+// nothingRelevant is the reply asked for when a part has nothing to do with
+// the question, so that it can be left out of the final answer.
+const nothingRelevant = "NOTHING RELEVANT"
+
+// Options configures how the question is asked.
+type Options struct {
+	// Ask sends the question about a part to the model, with the files of
+	// the part as the system message, and returns its partial answer.
+	Ask func(systemMessage, prompt string) (string, error)
+	// Render turns the files of a part into the system message, typically
+	// with a chat.ContextBuilder.
+	Render func(files []filetree.File) string
+	// PartTokens is the size of the parts. Zero means
+	// summarize.DefaultPartTokens.
+	PartTokens int
+	// OnProgress is called before each request with the number of requests
+	// done and the number known so far.
+	OnProgress func(done, total int)
+	// OnSkip is called for files too large to fit in a part.
+	OnSkip func(file filetree.File)
+}
+
+// Collect asks the question about each part of the files and returns the
+// partial answers as the context of the final request, which is sent with
+// SynthesisPrompt. Parts with nothing relevant to the question are left out.
+func Collect(files []filetree.File, question string, opts *Options) (string, error) {
+	partTokens := opts.PartTokens
+	if partTokens <= 0 {
+		partTokens = summarize.DefaultPartTokens
+	}
+
+	parts, skipped := summarize.Split(files, partTokens)
+	if opts.OnSkip != nil {
+		for _, file := range skipped {
+			opts.OnSkip(file)
+		}
+	}
+
+	if len(parts) == 0 {
+		return "", errors.New("no files to answer the question from")
+	}
+
+	done, total := 0, len(parts)
+
+	ask := func(systemMessage, prompt string) (string, error) {
+		if opts.OnProgress != nil {
+			opts.OnProgress(done, total)
+		}
+
+		reply, err := opts.Ask(systemMessage, prompt)
+		done++
+
+		return strings.TrimSpace(reply), err
+	}
+
+	var partials []string
+
+	for i := range parts {
+		name := strings.Join(parts[i].Dirs, ", ")
+
+		reply, err := ask(opts.Render(parts[i].Files), mapPrompt(name, question))
+		if err != nil {
+			return "", fmt.Errorf("error asking about %s: %w", name, err)
+		}
+
+		if !isNothingRelevant(reply) {
+			partials = append(partials, "## "+name+"\n\n"+reply)
+		}
+	}
+
+	if len(partials) == 0 {
+		return "None of the parts of the repository hold anything relevant to the question.", nil
+	}
+
+	// combine the partial answers in batches until they fit in a single request
+	for chat.EstimateTokens(strings.Join(partials, "\n\n")) > partTokens && len(partials) > 1 {
+		batches := summarize.Batch(partials, partTokens)
+		if len(batches) == len(partials) {
+			break
+		}
+
+		total += len(batches)
+		partials = nil
+
+		for _, batch := range batches {
+			combined, err := ask(chat.SystemMessage(strings.Join(batch, "\n\n")), combinePrompt(question))
+			if err != nil {
+				return "", fmt.Errorf("error combining partial answers: %w", err)
+			}
+
+			partials = append(partials, combined)
+		}
+	}
+
+	return "Partial answers to the question, each from a part of the repository:\n\n" +
+		strings.Join(partials, "\n\n"), nil
+}
+
+// SynthesisPrompt asks for the final answer from the partial answers
+// returned by Collect.
+func SynthesisPrompt(question string) string {
+	return "The context holds answers to the question below, each written from a part of the repository only. " +
+		"Write one answer to the question from them, as if you had read the whole repository: merge what " +
+		"they agree on, reconcile what they disagree on, and keep the names of files and symbols exactly as " +
+		"they appear.\n\nQuestion: " + question
+}
+
+// isNothingRelevant reports whether the reply is the marker for a part with
+// nothing relevant, allowing for the punctuation and formatting models tend
+// to put around it. A partial answer that merely mentions the marker is kept.
+func isNothingRelevant(reply string) bool {
+	return strings.Trim(reply, " \t\n.!*_`\"'") == nothingRelevant
+}
+
+func mapPrompt(part, question string) string {
+	return "The files in the context are the part of a larger repository in " + part + ". Answer the question " +
+		"below as far as these files allow, citing files and symbols by name, so that your answer can be " +
+		"combined with answers from the other parts. Don't speculate about code you can't see. If the files " +
+		"have nothing to do with the question, reply with only " + nothingRelevant + ".\n\nQuestion: " + question
+}
+
+func combinePrompt(question string) string {
+	return "Combine the partial answers above into one partial answer to the question below, keeping every " +
+		"relevant finding and the names of files and symbols.\n\nQuestion: " + question
+}
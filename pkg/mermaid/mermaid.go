@@ -0,0 +1,433 @@
+// Package mermaid extracts Mermaid diagrams from model responses and checks
+// their syntax, so that a broken diagram is caught before it is saved rather
+// than when it fails to render.
+package mermaid
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Diagram types, as named by the first line of a diagram.
+const (
+	Flowchart = "flowchart"
+	Sequence  = "sequenceDiagram"
+	Class     = "classDiagram"
+)
+
+// ErrNoDiagram is returned when a response contains no diagram.
+var ErrNoDiagram = errors.New("no mermaid diagram found")
+
+// otherTypes are the diagram types only checked for balanced brackets and
+// quotes.
+var otherTypes = map[string]bool{ //nolint:gochecknoglobals
+	"stateDiagram": true, "stateDiagram-v2": true, "erDiagram": true, "gantt": true, "pie": true,
+	"journey": true, "gitGraph": true, "mindmap": true, "timeline": true, "quadrantChart": true,
+	"C4Context": true, "C4Container": true, "C4Component": true, "C4Dynamic": true, "C4Deployment": true,
+	"requirementDiagram": true, "block-beta": true, "architecture-beta": true,
+}
+
+var (
+	directionRegexp = regexp.MustCompile(`^(TB|TD|BT|RL|LR)$`) //nolint:gochecknoglobals
+	// participantRegexp matches participant and actor declarations.
+	participantRegexp = regexp.MustCompile( //nolint:gochecknoglobals
+		`^(?:create\s+)?(participant|actor)\s+("[^"]+"|[^\s:]+)(?:\s+as\s+.+)?$`)
+	messageRegexp = regexp.MustCompile( //nolint:gochecknoglobals
+		`^("[^"]+"|[^\s:+-][^:]*?)\s*(-->>|->>|-->|->|--x|-x|--\)|-\))\s*[+-]?\s*("[^"]+"|[^\s:][^:]*?)\s*:(.*)$`)
+	noteRegexp          = regexp.MustCompile(`(?i)^note\s+(left of|right of|over)\s+[^:]+:.*$`) //nolint:gochecknoglobals
+	classRelationRegexp = regexp.MustCompile(                                                   //nolint:gochecknoglobals
+		`(<\|--|--\|>|\*--|--\*|o--|--o|<--|-->|<\.\.|\.\.>|\.\.\|>|<\|\.\.|--|\.\.)`)
+	classMemberRegexp = regexp.MustCompile(`^[\w~<>,]+\s*:\s*.+$`) //nolint:gochecknoglobals
+	// asymmetricRegexp matches the opening of an asymmetric node, A>label].
+	asymmetricRegexp = regexp.MustCompile(`(\w)>`) //nolint:gochecknoglobals
+)
+
+// sequenceBlocks open blocks of a sequence diagram closed by end.
+var sequenceBlocks = map[string]bool{ //nolint:gochecknoglobals
+	"loop": true, "alt": true, "opt": true, "par": true, "critical": true, "break": true, "rect": true, "box": true,
+}
+
+// Extract returns the first mermaid block of a response. A response that is
+// nothing but a diagram, without a fence, is returned as is.
+func Extract(text string) (string, error) {
+	var (
+		block   strings.Builder
+		inBlock bool
+	)
+
+	for _, line := range strings.Split(text, "\n") {
+		trimmed := strings.TrimSpace(line)
+
+		switch {
+		case inBlock && trimmed == "```":
+			return block.String(), nil
+		case inBlock:
+			block.WriteString(strings.TrimRight(line, "\r") + "\n")
+		case trimmed == "```mermaid":
+			inBlock = true
+		}
+	}
+
+	if inBlock {
+		return "", errors.New("the mermaid block is not closed, the response may have been cut off")
+	}
+
+	if _, err := diagramType(text); err == nil {
+		return strings.TrimSpace(text) + "\n", nil
+	}
+
+	return "", ErrNoDiagram
+}
+
+// Type returns the type of a diagram, such as flowchart or sequenceDiagram.
+// graph is reported as flowchart.
+func Type(src string) string {
+	kind, _ := diagramType(src)
+	return kind
+}
+
+func diagramType(src string) (string, error) {
+	for _, line := range lines(src) {
+		fields := strings.Fields(line.text)
+
+		switch kind := fields[0]; {
+		case kind == "graph" || kind == Flowchart:
+			if len(fields) > 1 && !directionRegexp.MatchString(fields[1]) {
+				return "", fmt.Errorf("line %d: unknown direction %q, use TB, TD, BT, RL or LR", line.number, fields[1])
+			}
+
+			return Flowchart, nil
+		case kind == Sequence || kind == Class || otherTypes[kind]:
+			return kind, nil
+		default:
+			return "", fmt.Errorf("line %d: unknown diagram type %q", line.number, kind)
+		}
+	}
+
+	return "", errors.New("the diagram is empty")
+}
+
+// SyntaxError lists the problems found in a diagram.
+type SyntaxError struct {
+	Problems []string
+}
+
+func (e *SyntaxError) Error() string {
+	return "invalid mermaid syntax:\n" + strings.Join(e.Problems, "\n")
+}
+
+// Validate checks the syntax of a diagram. Flowcharts, sequence and class
+// diagrams are checked statement by statement, other types for balanced
+// brackets and quotes only. The problems, with their line numbers, are
+// returned as a *SyntaxError.
+func Validate(src string) error {
+	kind, err := diagramType(src)
+	if err != nil {
+		return &SyntaxError{Problems: []string{err.Error()}}
+	}
+
+	body := lines(src)[1:]
+
+	var problems []string
+
+	switch kind {
+	case Flowchart:
+		problems = validateFlowchart(body)
+	case Sequence:
+		problems = validateSequence(body)
+	case Class:
+		problems = validateClass(body)
+	default:
+		for _, line := range body {
+			if problem := checkBalance(line.text); problem != "" {
+				problems = append(problems, line.problem(problem))
+			}
+		}
+	}
+
+	if len(problems) > 0 {
+		return &SyntaxError{Problems: problems}
+	}
+
+	return nil
+}
+
+type line struct {
+	number int
+	text   string
+}
+
+func (l line) problem(format string, args ...any) string {
+	return fmt.Sprintf("line %d: %s: %s", l.number, fmt.Sprintf(format, args...), l.text)
+}
+
+// lines returns the statements of a diagram, leaving out blank lines,
+// comments and front matter.
+func lines(src string) []line {
+	var (
+		result      []line
+		frontMatter bool
+	)
+
+	for i, text := range strings.Split(src, "\n") {
+		text = strings.TrimSpace(text)
+
+		switch {
+		case text == "---" && (frontMatter || len(result) == 0):
+			frontMatter = !frontMatter
+			continue
+		case frontMatter, text == "", strings.HasPrefix(text, "%%"):
+			continue
+		}
+
+		// statements may end with a semicolon, which is optional
+		if text = strings.TrimSpace(strings.TrimSuffix(text, ";")); text != "" {
+			result = append(result, line{number: i + 1, text: text})
+		}
+	}
+
+	return result
+}
+
+func validateFlowchart(body []line) []string {
+	var (
+		problems []string
+		depth    int
+	)
+
+	for _, line := range body {
+		keyword := strings.Fields(line.text)[0]
+
+		switch keyword {
+		case "subgraph":
+			depth++
+			continue
+		case "end":
+			if depth == 0 {
+				problems = append(problems, line.problem("end without subgraph"))
+			}
+
+			depth = max(depth-1, 0)
+
+			continue
+		case "direction":
+			if fields := strings.Fields(line.text); len(fields) != 2 || !directionRegexp.MatchString(fields[1]) {
+				problems = append(problems, line.problem("invalid direction"))
+			}
+
+			continue
+		case "classDef", "class", "style", "linkStyle", "click":
+			continue
+		}
+
+		if problem := checkBalance(asymmetricRegexp.ReplaceAllString(line.text, "$1[")); problem != "" {
+			problems = append(problems, line.problem(problem))
+			continue
+		}
+
+		if problem := checkLabels(line.text); problem != "" {
+			problems = append(problems, line.problem(problem))
+		}
+	}
+
+	if depth > 0 {
+		problems = append(problems, "subgraph not closed with end")
+	}
+
+	return problems
+}
+
+func validateSequence(body []line) []string { //nolint:cyclop
+	var (
+		problems []string
+		blocks   []string
+	)
+
+	for _, line := range body {
+		keyword := strings.Fields(line.text)[0]
+
+		switch {
+		case sequenceBlocks[keyword]:
+			blocks = append(blocks, keyword)
+		case keyword == "else" || keyword == "and" || keyword == "option":
+			if len(blocks) == 0 || !allowedIn(keyword, blocks[len(blocks)-1]) {
+				problems = append(problems, line.problem("%s outside of a block that allows it", keyword))
+			}
+		case keyword == "end":
+			if len(blocks) == 0 {
+				problems = append(problems, line.problem("end without a block"))
+			} else {
+				blocks = blocks[:len(blocks)-1]
+			}
+		case keyword == "autonumber", keyword == "title", keyword == "activate", keyword == "deactivate",
+			keyword == "destroy", keyword == "link", keyword == "links":
+		case strings.EqualFold(keyword, "note"):
+			if !noteRegexp.MatchString(line.text) {
+				problems = append(problems, line.problem("invalid note, use note left of|right of|over A: text"))
+			}
+		case participantRegexp.MatchString(line.text):
+		case messageRegexp.MatchString(line.text):
+		default:
+			problems = append(problems, line.problem("not a message, participant, note or block"))
+		}
+	}
+
+	for _, block := range blocks {
+		problems = append(problems, fmt.Sprintf("%s not closed with end", block))
+	}
+
+	return problems
+}
+
+func allowedIn(keyword, block string) bool {
+	switch keyword {
+	case "else":
+		return block == "alt"
+	case "and":
+		return block == "par"
+	default:
+		return block == "critical"
+	}
+}
+
+func validateClass(body []line) []string { //nolint:cyclop
+	var (
+		problems   []string
+		inClass    bool
+		namespaces int
+	)
+
+	for _, line := range body {
+		keyword := strings.Fields(line.text)[0]
+
+		switch {
+		case inClass:
+			if line.text == "}" {
+				inClass = false
+			}
+		case keyword == "namespace":
+			if !strings.HasSuffix(line.text, "{") {
+				problems = append(problems, line.problem("namespace without {"))
+			}
+
+			namespaces++
+		case line.text == "}" && namespaces > 0:
+			namespaces--
+		case keyword == "class":
+			if problem := checkBalance(strings.TrimSuffix(line.text, "{")); problem != "" {
+				problems = append(problems, line.problem(problem))
+			}
+
+			inClass = strings.HasSuffix(line.text, "{")
+		case line.text == "}":
+			problems = append(problems, line.problem("} without a class"))
+		case keyword == "direction", keyword == "note", keyword == "classDef", keyword == "style",
+			keyword == "cssClass", keyword == "link", keyword == "click", keyword == "callback",
+			strings.HasPrefix(keyword, "<<"):
+		case classRelationRegexp.MatchString(line.text), classMemberRegexp.MatchString(line.text):
+			if problem := checkBalance(line.text); problem != "" {
+				problems = append(problems, line.problem(problem))
+			}
+		default:
+			problems = append(problems, line.problem("not a class, member or relationship"))
+		}
+	}
+
+	if inClass {
+		problems = append(problems, "class body not closed with }")
+	}
+
+	if namespaces > 0 {
+		problems = append(problems, "namespace not closed with }")
+	}
+
+	return problems
+}
+
+// checkBalance reports unbalanced brackets and quotes outside of quoted
+// text.
+func checkBalance(text string) string {
+	var (
+		stack  []rune
+		quoted bool
+	)
+
+	closers := map[rune]rune{')': '(', ']': '[', '}': '{'}
+
+	for _, r := range text {
+		switch {
+		case r == '"':
+			quoted = !quoted
+		case quoted:
+		case r == '(' || r == '[' || r == '{':
+			stack = append(stack, r)
+		case closers[r] != 0:
+			if len(stack) == 0 || stack[len(stack)-1] != closers[r] {
+				return fmt.Sprintf("unexpected %q", r)
+			}
+
+			stack = stack[:len(stack)-1]
+		}
+	}
+
+	switch {
+	case quoted:
+		return "unterminated quote"
+	case len(stack) > 0:
+		return fmt.Sprintf("unclosed %q", stack[len(stack)-1])
+	}
+
+	return ""
+}
+
+// shapes are the delimiters of flowchart nodes, the longest first.
+var shapes = [][2]string{ //nolint:gochecknoglobals
+	{"(((", ")))"}, {"([", "])"}, {"[[", "]]"}, {"[(", ")]"}, {"((", "))"}, {"{{", "}}"},
+	{"[/", "/]"}, {"[\\", "\\]"}, {"[/", "\\]"}, {"[\\", "/]"}, {">", "]"},
+	{"[", "]"}, {"(", ")"}, {"{", "}"},
+}
+
+// checkLabels reports node labels that contain brackets without being
+// quoted, such as A[parse(input)], which Mermaid can't parse.
+func checkLabels(text string) string {
+	for i := 0; i < len(text); i++ {
+		if !strings.ContainsRune("([{>", rune(text[i])) || i == 0 || !isIDByte(text[i-1]) {
+			continue
+		}
+
+		// > only opens a node right after its id, not in arrows like -->
+		if text[i] == '>' && strings.ContainsRune("-=.", rune(text[i-1])) {
+			continue
+		}
+
+		for _, shape := range shapes {
+			if !strings.HasPrefix(text[i:], shape[0]) {
+				continue
+			}
+
+			rest := text[i+len(shape[0]):]
+
+			end := strings.Index(rest, shape[1])
+			if end < 0 {
+				continue
+			}
+
+			label := strings.TrimSpace(rest[:end])
+			if !strings.HasPrefix(label, "\"") && strings.ContainsAny(label, "()[]{}") {
+				return fmt.Sprintf("label %q has brackets, quote it like \"%s\"", label, label)
+			}
+
+			i += len(shape[0]) + end + len(shape[1]) - 1
+
+			break
+		}
+	}
+
+	return ""
+}
+
+func isIDByte(b byte) bool {
+	return b == '_' || b == '-' || b >= '0' && b <= '9' || b >= 'a' && b <= 'z' || b >= 'A' && b <= 'Z'
+}
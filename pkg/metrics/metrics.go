@@ -0,0 +1,276 @@
+// Package metrics counts what a long running cwc, such as cwc index --watch,
+// does: its requests and their latencies, the tokens they used, how many
+// files the index could reuse and how large it is. Handler serves the
+// metrics in the Prometheus text format, which is simple enough not to need
+// the Prometheus client library.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// durationBuckets are the upper bounds in seconds of the latency histograms,
+// from a quick embedding request to a long generation.
+var durationBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120} //nolint:gochecknoglobals
+
+// The metrics exposed by Handler.
+var (
+	// Requests counts the HTTP requests to providers and index servers by
+	// host, method and status code, which is empty for failed requests.
+	Requests = newCounter("cwc_http_requests_total", //nolint:gochecknoglobals
+		"HTTP requests sent to providers and index servers.", "host", "method", "code")
+	// RequestDuration is the time until the response headers arrived.
+	RequestDuration = newHistogram("cwc_http_request_duration_seconds", //nolint:gochecknoglobals
+		"Time until the response headers of HTTP requests arrived.", durationBuckets, "host")
+	// Tokens counts the tokens sent and received by kind: prompt,
+	// completion or embedding. Prompt and completion tokens are estimated
+	// when the provider doesn't report them.
+	Tokens = newCounter("cwc_tokens_total", //nolint:gochecknoglobals
+		"Tokens sent to and received from the models.", "kind")
+	// IndexCacheHits counts the files whose embeddings were reused by an
+	// update of the index, and IndexCacheMisses those that were embedded.
+	IndexCacheHits = newCounter("cwc_index_cache_hits_total", //nolint:gochecknoglobals
+		"Files whose embeddings were reused by an update of the index.")
+	IndexCacheMisses = newCounter("cwc_index_cache_misses_total", //nolint:gochecknoglobals
+		"Files embedded by an update of the index.")
+	// IndexUpdates counts the updates of the index by result: ok or error.
+	IndexUpdates = newCounter("cwc_index_updates_total", //nolint:gochecknoglobals
+		"Updates of the index.", "result")
+	IndexUpdateDuration = newHistogram("cwc_index_update_duration_seconds", //nolint:gochecknoglobals
+		"Time taken by updates of the index.", durationBuckets)
+	IndexFiles = newGauge("cwc_index_files", //nolint:gochecknoglobals
+		"Files in the index.")
+	IndexChunks = newGauge("cwc_index_chunks", //nolint:gochecknoglobals
+		"Chunks in the index.")
+	IndexSize = newGauge("cwc_index_size_bytes", //nolint:gochecknoglobals
+		"Storage used by the index, estimated for external stores.")
+)
+
+// metric is implemented by the counters, gauges and histograms.
+type metric interface {
+	write(w io.Writer)
+}
+
+var registry []metric //nolint:gochecknoglobals
+
+// Handler serves the metrics in the Prometheus text exposition format.
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+
+		for _, m := range registry {
+			m.write(w)
+		}
+	})
+}
+
+// series holds the values of a metric per combination of label values.
+type series[T any] struct {
+	mu     sync.Mutex
+	name   string
+	help   string
+	kind   string
+	labels []string
+	values map[string]T
+	keys   map[string][]string
+}
+
+func (s *series[T]) get(labelValues []string, create func() T) T {
+	if len(labelValues) != len(s.labels) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", s.name, len(s.labels), len(labelValues)))
+	}
+
+	key := strings.Join(labelValues, "\xff")
+
+	value, ok := s.values[key]
+	if !ok {
+		value = create()
+		s.values[key] = value
+		s.keys[key] = append([]string(nil), labelValues...)
+	}
+
+	return value
+}
+
+func (s *series[T]) writeHeader(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", s.name, s.help, s.name, s.kind)
+}
+
+// sortedKeys returns the series in a stable order, for readable output.
+func (s *series[T]) sortedKeys() []string {
+	keys := make([]string, 0, len(s.values))
+	for key := range s.values {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
+
+// labelString formats label pairs as {a="1",b="2"}, with extra pairs last.
+func (s *series[T]) labelString(key string, extra ...string) string {
+	pairs := make([]string, 0, len(s.labels)+len(extra)/2)
+
+	for i, value := range s.keys[key] {
+		pairs = append(pairs, s.labels[i]+"="+strconv.Quote(value))
+	}
+
+	for i := 0; i+1 < len(extra); i += 2 {
+		pairs = append(pairs, extra[i]+"="+strconv.Quote(extra[i+1]))
+	}
+
+	if len(pairs) == 0 {
+		return ""
+	}
+
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// Counter is a value that only goes up.
+type Counter struct {
+	series[*float64]
+}
+
+func newCounter(name, help string, labels ...string) *Counter {
+	c := &Counter{series[*float64]{
+		name: name, help: help, kind: "counter", labels: labels,
+		values: make(map[string]*float64), keys: make(map[string][]string),
+	}}
+	registry = append(registry, c)
+
+	return c
+}
+
+// Add adds delta to the counter with the given label values.
+func (c *Counter) Add(delta float64, labelValues ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	*c.get(labelValues, func() *float64 { return new(float64) }) += delta
+}
+
+// Inc adds one to the counter with the given label values.
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+func (c *Counter) write(w io.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.writeHeader(w)
+
+	for _, key := range c.sortedKeys() {
+		fmt.Fprintf(w, "%s%s %s\n", c.name, c.labelString(key), formatFloat(*c.values[key]))
+	}
+}
+
+// Gauge is a value that can go up and down.
+type Gauge struct {
+	series[*float64]
+}
+
+func newGauge(name, help string, labels ...string) *Gauge {
+	g := &Gauge{series[*float64]{
+		name: name, help: help, kind: "gauge", labels: labels,
+		values: make(map[string]*float64), keys: make(map[string][]string),
+	}}
+	registry = append(registry, g)
+
+	return g
+}
+
+// Set sets the gauge with the given label values.
+func (g *Gauge) Set(value float64, labelValues ...string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	*g.get(labelValues, func() *float64 { return new(float64) }) = value
+}
+
+func (g *Gauge) write(w io.Writer) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.writeHeader(w)
+
+	for _, key := range g.sortedKeys() {
+		fmt.Fprintf(w, "%s%s %s\n", g.name, g.labelString(key), formatFloat(*g.values[key]))
+	}
+}
+
+// Histogram counts observations, such as durations, in buckets.
+type Histogram struct {
+	series[*histogramValue]
+	buckets []float64
+}
+
+type histogramValue struct {
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+func newHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	h := &Histogram{series: series[*histogramValue]{
+		name: name, help: help, kind: "histogram", labels: labels,
+		values: make(map[string]*histogramValue), keys: make(map[string][]string),
+	}, buckets: buckets}
+	registry = append(registry, h)
+
+	return h
+}
+
+// Observe records a value in the histogram with the given label values.
+func (h *Histogram) Observe(value float64, labelValues ...string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	v := h.get(labelValues, func() *histogramValue {
+		return &histogramValue{counts: make([]uint64, len(h.buckets))}
+	})
+
+	for i, bound := range h.buckets {
+		if value <= bound {
+			v.counts[i]++
+		}
+	}
+
+	v.count++
+	v.sum += value
+}
+
+func (h *Histogram) write(w io.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.writeHeader(w)
+
+	for _, key := range h.sortedKeys() {
+		v := h.values[key]
+
+		for i, bound := range h.buckets {
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, h.labelString(key, "le", formatFloat(bound)), v.counts[i])
+		}
+
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, h.labelString(key, "le", "+Inf"), v.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.name, h.labelString(key), formatFloat(v.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, h.labelString(key), v.count)
+	}
+}
+
+func formatFloat(value float64) string {
+	if math.IsInf(value, 1) {
+		return "+Inf"
+	}
+
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
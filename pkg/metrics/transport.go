@@ -0,0 +1,40 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Transport counts every request made through base, which is
+// http.DefaultTransport if nil, and records how long it took until the
+// response headers arrived.
+func Transport(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	return &transport{base: base}
+}
+
+type transport struct {
+	base http.RoundTripper
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	started := time.Now()
+
+	resp, err := t.base.RoundTrip(req)
+
+	host := req.URL.Hostname()
+	RequestDuration.Observe(time.Since(started).Seconds(), host)
+
+	if err != nil {
+		Requests.Inc(host, req.Method, "")
+		return nil, err //nolint:wrapcheck
+	}
+
+	Requests.Inc(host, req.Method, strconv.Itoa(resp.StatusCode))
+
+	return resp, nil
+}
@@ -0,0 +1,199 @@
+// Package notebook renders Jupyter notebooks as readable source code, so they
+// can be given to the model without the bulk of their JSON.
+package notebook
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/emilkje/cwc/pkg/languages"
+)
+
+// maxOutputBytes truncates each kept output, as a single cell may print
+// megabytes of data.
+const maxOutputBytes = 2000
+
+// Options control how a notebook is rendered.
+type Options struct {
+	// StripOutputs leaves out the outputs of code cells.
+	StripOutputs bool
+}
+
+// Notebook is a rendered notebook.
+type Notebook struct {
+	// Language is the canonical name of the language of the kernel, e.g.
+	// "Python", or "" if the notebook doesn't say.
+	Language string
+	// Source holds the cells in the percent format used by jupytext and
+	// most editors: each cell starts with a "# %%" line, and markdown
+	// cells and outputs are commented out.
+	Source string
+}
+
+// IsNotebook reports whether the path is a Jupyter notebook.
+func IsNotebook(path string) bool {
+	return strings.EqualFold(filepath.Ext(path), ".ipynb")
+}
+
+type notebookJSON struct {
+	Metadata struct {
+		Kernelspec struct {
+			Language string `json:"language"`
+		} `json:"kernelspec"`
+		LanguageInfo struct {
+			Name string `json:"name"`
+		} `json:"language_info"` //nolint:tagliatelle
+	} `json:"metadata"`
+	Cells []cellJSON `json:"cells"`
+}
+
+type cellJSON struct {
+	CellType string       `json:"cell_type"` //nolint:tagliatelle
+	Source   multiline    `json:"source"`
+	Outputs  []outputJSON `json:"outputs"`
+}
+
+type outputJSON struct {
+	OutputType string               `json:"output_type"` //nolint:tagliatelle
+	Text       multiline            `json:"text"`
+	Data       map[string]multiline `json:"data"`
+	Ename      string               `json:"ename"`
+	Evalue     string               `json:"evalue"`
+}
+
+// multiline is text stored either as a string or as a list of lines.
+type multiline string
+
+func (m *multiline) UnmarshalJSON(data []byte) error {
+	var lines []string
+	if err := json.Unmarshal(data, &lines); err == nil {
+		*m = multiline(strings.Join(lines, ""))
+		return nil
+	}
+
+	var text string
+	if err := json.Unmarshal(data, &text); err != nil {
+		// other data, such as the JSON of widgets, is not rendered
+		return nil //nolint:nilerr
+	}
+
+	*m = multiline(text)
+
+	return nil
+}
+
+// Render parses a notebook and renders its cells.
+func Render(data []byte, opts *Options) (*Notebook, error) {
+	var nb notebookJSON
+	if err := json.Unmarshal(data, &nb); err != nil {
+		return nil, fmt.Errorf("error parsing notebook: %w", err)
+	}
+
+	if opts == nil {
+		opts = &Options{}
+	}
+
+	languageName := nb.Metadata.Kernelspec.Language
+	if languageName == "" {
+		languageName = nb.Metadata.LanguageInfo.Name
+	}
+
+	name, _, _ := languages.Lookup(languageName)
+
+	comment := "#"
+	if syntax, ok := languages.CommentSyntax(name); ok && syntax.Line != "" {
+		comment = syntax.Line
+	}
+
+	var source strings.Builder
+
+	for i, cell := range nb.Cells {
+		if i > 0 {
+			source.WriteString("\n")
+		}
+
+		text := strings.TrimRight(string(cell.Source), "\n")
+
+		switch cell.CellType {
+		case "markdown":
+			source.WriteString(comment + " %% [markdown]\n")
+			writeCommented(&source, comment, text)
+		case "raw":
+			source.WriteString(comment + " %% [raw]\n")
+			writeCommented(&source, comment, text)
+		default:
+			source.WriteString(comment + " %%\n")
+
+			if text != "" {
+				source.WriteString(text + "\n")
+			}
+
+			if !opts.StripOutputs {
+				writeOutputs(&source, comment, cell.Outputs)
+			}
+		}
+	}
+
+	return &Notebook{Language: name, Source: source.String()}, nil
+}
+
+func writeOutputs(source *strings.Builder, comment string, outputs []outputJSON) {
+	for _, output := range outputs {
+		text := outputText(output)
+		if text == "" {
+			continue
+		}
+
+		if len(text) > maxOutputBytes {
+			text = text[:maxOutputBytes] + "\n[output truncated]"
+		}
+
+		source.WriteString(comment + " Output:\n")
+		writeCommented(source, comment, strings.TrimRight(text, "\n"))
+	}
+}
+
+// outputText returns the text of an output. Images and other binary data
+// are only named, as their base64 would be meaningless to the model.
+func outputText(output outputJSON) string {
+	switch output.OutputType {
+	case "stream":
+		return string(output.Text)
+	case "error":
+		return output.Ename + ": " + output.Evalue
+	}
+
+	if text, ok := output.Data["text/plain"]; ok {
+		return string(text)
+	}
+
+	mimeTypes := make([]string, 0, len(output.Data))
+	for mimeType := range output.Data {
+		mimeTypes = append(mimeTypes, mimeType)
+	}
+
+	if len(mimeTypes) == 0 {
+		return ""
+	}
+
+	sort.Strings(mimeTypes)
+
+	return "[" + mimeTypes[0] + " output omitted]"
+}
+
+func writeCommented(source *strings.Builder, comment, text string) {
+	if text == "" {
+		return
+	}
+
+	for _, line := range strings.Split(text, "\n") {
+		if line == "" {
+			source.WriteString(comment + "\n")
+		} else {
+			source.WriteString(comment + " " + line + "\n")
+		}
+	}
+}
@@ -0,0 +1,299 @@
+// Package oauth signs in to a provider in the browser with the OAuth 2.0
+// authorization code flow and PKCE, receiving the code on a loopback port as
+// native apps do (RFC 8252), and keeps the access token it gets fresh.
+package oauth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	stderrors "errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// AzureCLIClientID is the public client of the Azure CLI, which may sign
+	// in to Azure OpenAI with a loopback redirect without an application of
+	// its own being registered.
+	AzureCLIClientID = "04b07795-8ddb-461a-bbee-02f9e1bf7b46"
+	// DefaultTenant signs in with any work or school account.
+	DefaultTenant = "organizations"
+
+	cognitiveServicesScope = "https://cognitiveservices.azure.com/.default"
+	// offlineAccessScope asks for a refresh token.
+	offlineAccessScope = "offline_access"
+	// maxTokenErrorBody caps how much of an error response is reported.
+	maxTokenErrorBody = 512
+	// readHeaderTimeout bounds the wait for the browser's request.
+	readHeaderTimeout = 10 * time.Second
+)
+
+// callbackPage is shown in the browser once the code is received.
+const callbackPage = `<!doctype html><title>cwc</title><p>%s You can close this window and return to the terminal.</p>`
+
+// Endpoint is an authorization server and the public client signing in to it.
+type Endpoint struct {
+	AuthURL  string
+	TokenURL string
+	ClientID string
+	Scopes   []string
+}
+
+// EntraID returns the endpoint of Microsoft Entra ID for Azure OpenAI in the
+// tenant, such as a tenant ID, a domain or DefaultTenant.
+func EntraID(tenant, clientID string) Endpoint {
+	if tenant == "" {
+		tenant = DefaultTenant
+	}
+
+	if clientID == "" {
+		clientID = AzureCLIClientID
+	}
+
+	base := "https://login.microsoftonline.com/" + url.PathEscape(tenant) + "/oauth2/v2.0/"
+
+	return Endpoint{
+		AuthURL:  base + "authorize",
+		TokenURL: base + "token",
+		ClientID: clientID,
+		Scopes:   []string{cognitiveServicesScope, offlineAccessScope},
+	}
+}
+
+// Token is an access token and the refresh token replacing it once expired.
+type Token struct {
+	AccessToken  string    `json:"accessToken"`
+	RefreshToken string    `json:"refreshToken,omitempty"`
+	Expiry       time.Time `json:"expiry"`
+}
+
+// ParseToken reads a token saved as JSON.
+func ParseToken(data string) (*Token, error) {
+	var token Token
+
+	if err := json.Unmarshal([]byte(data), &token); err != nil {
+		return nil, fmt.Errorf("error reading the token: %w", err)
+	}
+
+	return &token, nil
+}
+
+// Encode returns the token as JSON, for saving it.
+func (t *Token) Encode() string {
+	data, _ := json.Marshal(t)
+	return string(data)
+}
+
+// Login has the user sign in in the browser, which open is asked to show the
+// page of, and returns the token the authorization server issues. The code
+// is received on a loopback port until ctx is done.
+func Login(ctx context.Context, client *http.Client, endpoint Endpoint, open func(string)) (*Token, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, fmt.Errorf("error listening for the sign-in callback: %w", err)
+	}
+	defer listener.Close()
+
+	port := listener.Addr().(*net.TCPAddr).Port //nolint:forcetypeassert
+	redirect := fmt.Sprintf("http://127.0.0.1:%d/", port)
+
+	verifier, err := randomString()
+	if err != nil {
+		return nil, err
+	}
+
+	state, err := randomString()
+	if err != nil {
+		return nil, err
+	}
+
+	challenge := sha256.Sum256([]byte(verifier))
+
+	query := url.Values{
+		"client_id":             {endpoint.ClientID},
+		"response_type":         {"code"},
+		"redirect_uri":          {redirect},
+		"scope":                 {strings.Join(endpoint.Scopes, " ")},
+		"state":                 {state},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+		"prompt":                {"select_account"},
+	}
+
+	codes := make(chan callbackResult, 1)
+	server := &http.Server{Handler: callbackHandler(state, codes), ReadHeaderTimeout: readHeaderTimeout}
+
+	go func() {
+		_ = server.Serve(listener)
+	}()
+	defer server.Close()
+
+	open(endpoint.AuthURL + "?" + query.Encode())
+
+	var result callbackResult
+
+	select {
+	case result = <-codes:
+	case <-ctx.Done():
+		return nil, fmt.Errorf("error waiting for the sign-in: %w", ctx.Err())
+	}
+
+	if result.err != nil {
+		return nil, result.err
+	}
+
+	return requestToken(ctx, client, endpoint, url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {result.code},
+		"redirect_uri":  {redirect},
+		"code_verifier": {verifier},
+	})
+}
+
+// Refresh exchanges the refresh token of the token for a new token.
+func Refresh(ctx context.Context, client *http.Client, endpoint Endpoint, token *Token) (*Token, error) {
+	if token.RefreshToken == "" {
+		return nil, stderrors.New("the sign-in has expired and can't be renewed")
+	}
+
+	refreshed, err := requestToken(ctx, client, endpoint, url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {token.RefreshToken},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// the refresh token is only replaced when the server rotates it
+	if refreshed.RefreshToken == "" {
+		refreshed.RefreshToken = token.RefreshToken
+	}
+
+	return refreshed, nil
+}
+
+type callbackResult struct {
+	code string
+	err  error
+}
+
+// callbackHandler receives the code the browser is redirected back with,
+// once. Requests that don't carry the state of the request made are refused
+// and the handler keeps waiting, so that another process connecting to the
+// port can't end the sign-in.
+func callbackHandler(state string, codes chan<- callbackResult) http.Handler {
+	var (
+		mu       sync.Mutex
+		received bool
+	)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		query := r.URL.Query()
+		if received || (query.Get("code") == "" && query.Get("error") == "") {
+			http.NotFound(w, r)
+			return
+		}
+
+		if query.Get("state") != state {
+			http.Error(w, "the sign-in was answered for another request", http.StatusBadRequest)
+			return
+		}
+
+		var result callbackResult
+
+		switch {
+		case query.Get("error") != "":
+			result.err = fmt.Errorf("the sign-in failed: %s %s", query.Get("error"), query.Get("error_description"))
+		default:
+			result.code = query.Get("code")
+		}
+
+		received = true
+		message := "Signed in to cwc."
+
+		if result.err != nil {
+			message = "The sign-in failed."
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_, _ = fmt.Fprintf(w, callbackPage, message)
+
+		codes <- result
+	})
+}
+
+// requestToken posts the grant to the token endpoint of the server.
+func requestToken(ctx context.Context, client *http.Client, endpoint Endpoint, grant url.Values) (*Token, error) {
+	grant.Set("client_id", endpoint.ClientID)
+	grant.Set("scope", strings.Join(endpoint.Scopes, " "))
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint.TokenURL, strings.NewReader(grant.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	issued := time.Now()
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error requesting a token: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("error reading the token: %w", err)
+	}
+
+	var result struct {
+		AccessToken      string `json:"access_token"`
+		RefreshToken     string `json:"refresh_token"`
+		ExpiresIn        int    `json:"expires_in"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+
+	if err := json.Unmarshal(body, &result); err != nil || resp.StatusCode < 200 || resp.StatusCode > 299 {
+		if result.Error != "" {
+			return nil, fmt.Errorf("the token was refused: %s %s", result.Error, result.ErrorDescription)
+		}
+
+		if len(body) > maxTokenErrorBody {
+			body = body[:maxTokenErrorBody]
+		}
+
+		return nil, fmt.Errorf("the token endpoint responded with %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	return &Token{
+		AccessToken:  result.AccessToken,
+		RefreshToken: result.RefreshToken,
+		Expiry:       issued.Add(time.Duration(result.ExpiresIn) * time.Second),
+	}, nil
+}
+
+// randomString returns 32 random bytes, URL-safe encoded, for the PKCE
+// verifier and the state.
+func randomString() (string, error) {
+	data := make([]byte, 32) //nolint:mnd
+
+	if _, err := rand.Read(data); err != nil {
+		return "", fmt.Errorf("error generating random data: %w", err)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
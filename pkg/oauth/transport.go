@@ -0,0 +1,81 @@
+package oauth
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// expiryMargin renews a token this long before it expires, so it doesn't
+// expire on its way to the server.
+const expiryMargin = 2 * time.Minute
+
+// TokenSource hands out a valid access token, refreshing the token when it
+// is about to expire.
+type TokenSource struct {
+	mu       sync.Mutex
+	client   *http.Client
+	endpoint Endpoint
+	token    *Token
+	// onRefresh is called with each refreshed token, e.g. to save it.
+	onRefresh func(*Token)
+}
+
+// NewTokenSource creates a source starting from the token. Refreshing uses
+// the client, and onRefresh, if not nil, is called with each new token.
+func NewTokenSource(client *http.Client, endpoint Endpoint, token *Token, onRefresh func(*Token)) *TokenSource {
+	return &TokenSource{client: client, endpoint: endpoint, token: token, onRefresh: onRefresh}
+}
+
+// AccessToken returns an access token valid for a while yet.
+func (s *TokenSource) AccessToken(ctx context.Context) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.token.AccessToken != "" && time.Until(s.token.Expiry) > expiryMargin {
+		return s.token.AccessToken, nil
+	}
+
+	token, err := Refresh(ctx, s.client, s.endpoint, s.token)
+	if err != nil {
+		return "", err
+	}
+
+	s.token = token
+
+	if s.onRefresh != nil {
+		s.onRefresh(token)
+	}
+
+	return token.AccessToken, nil
+}
+
+// Transport adds the access token of Source to the requests sent through
+// Base, which is http.DefaultTransport if nil.
+type Transport struct {
+	Base   http.RoundTripper
+	Source *TokenSource
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	token, err := t.Source.AccessToken(req.Context())
+	if err != nil {
+		if req.Body != nil {
+			_ = req.Body.Close()
+		}
+
+		return nil, err
+	}
+
+	// a round tripper must not modify the request it is given
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	return base.RoundTrip(req) //nolint:wrapcheck
+}
@@ -0,0 +1,186 @@
+package pathmatcher
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// codeownersLocations are the places a CODEOWNERS file is looked for,
+// relative to the repository root, in the order GitHub and GitLab use.
+var codeownersLocations = []string{ //nolint:gochecknoglobals
+	".github/CODEOWNERS", "CODEOWNERS", "docs/CODEOWNERS", ".gitlab/CODEOWNERS",
+}
+
+// Codeowners maps paths to the users and teams that own them, as declared in
+// a CODEOWNERS file.
+type Codeowners struct {
+	// File is the path of the CODEOWNERS file relative to the repository
+	// root.
+	File string
+
+	// matcher only resolves paths relative to the repository root.
+	matcher *IgnoreFilePathMatcher
+	rules   []ownerRule
+}
+
+// ownerRule is a single line of a CODEOWNERS file. A rule without owners
+// leaves the paths it matches unowned.
+type ownerRule struct {
+	pattern ignorePattern
+	// filesOnly is set for patterns like docs/*, which match the files
+	// directly in the directory but not those below it.
+	filesOnly bool
+	owners    []string
+}
+
+// LoadCodeowners reads the CODEOWNERS file of the repository of the working
+// directory. It returns nil if the repository doesn't have one.
+func LoadCodeowners() (*Codeowners, error) {
+	matcher, err := newIgnoreFilePathMatcher("")
+	if err != nil {
+		return nil, err
+	}
+
+	for _, location := range codeownersLocations {
+		file := filepath.Join(matcher.root, filepath.FromSlash(location))
+
+		rules, err := parseCodeowners(file)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		return &Codeowners{File: location, matcher: matcher, rules: rules}, nil
+	}
+
+	return nil, nil
+}
+
+// Owners returns the owners of the path, taken from the last rule that
+// matches it like CODEOWNERS files are evaluated.
+func (c *Codeowners) Owners(p string) []string {
+	if c == nil {
+		return nil
+	}
+
+	rel, ok := c.matcher.relative(p)
+	if !ok {
+		return nil
+	}
+
+	for i := len(c.rules) - 1; i >= 0; i-- {
+		if c.rules[i].matches(rel) {
+			return c.rules[i].owners
+		}
+	}
+
+	return nil
+}
+
+// OwnedBy reports whether the path is owned by one of the owners. Owners are
+// compared case-insensitively and the leading @ is optional, so team/backend
+// and @Team/Backend are the same team.
+func (c *Codeowners) OwnedBy(p string, owners []string) bool {
+	for _, owner := range c.Owners(p) {
+		for _, wanted := range owners {
+			if normalizeOwner(owner) == normalizeOwner(wanted) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func normalizeOwner(owner string) string {
+	return strings.ToLower(strings.TrimPrefix(strings.TrimSpace(owner), "@"))
+}
+
+func (r *ownerRule) matches(rel string) bool {
+	if r.pattern.matches(rel, false) {
+		return true
+	}
+
+	if r.filesOnly {
+		return false
+	}
+
+	// a pattern matching a directory owns everything below it
+	for dir := path.Dir(rel); dir != "."; dir = path.Dir(dir) {
+		if r.pattern.matches(dir, true) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// parseCodeowners parses the rules of a CODEOWNERS file. The patterns are
+// written like .gitignore, except that they can't be negated. GitLab section
+// headers such as [Backend] are skipped along with their default owners.
+func parseCodeowners(file string) ([]ownerRule, error) {
+	f, err := os.Open(file) // #nosec
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %w", file, err)
+	}
+
+	defer f.Close()
+
+	var rules []ownerRule
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "[") || strings.HasPrefix(fields[0], "^[") {
+			continue
+		}
+
+		pattern, ok := parseIgnoreLine(fields[0], "", false)
+		if !ok || pattern.negate {
+			continue
+		}
+
+		rule := ownerRule{pattern: pattern, filesOnly: strings.HasSuffix(fields[0], "/*")}
+
+		for _, owner := range fields[1:] {
+			if strings.HasPrefix(owner, "#") {
+				break
+			}
+
+			rule.owners = append(rule.owners, owner)
+		}
+
+		rules = append(rules, rule)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading %s: %w", file, err)
+	}
+
+	return rules, nil
+}
+
+// OwnerPathMatcher matches the paths that are owned by none of the given
+// owners, so that excluding them limits the files to those the owners own.
+type OwnerPathMatcher struct {
+	codeowners *Codeowners
+	owners     []string
+}
+
+// NewOwnerPathMatcher creates a matcher for the paths not owned by any of the
+// owners.
+func NewOwnerPathMatcher(codeowners *Codeowners, owners ...string) *OwnerPathMatcher {
+	return &OwnerPathMatcher{codeowners: codeowners, owners: owners}
+}
+
+func (o *OwnerPathMatcher) Match(p string) bool {
+	return !o.codeowners.OwnedBy(p, o.owners)
+}
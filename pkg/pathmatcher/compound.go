@@ -20,6 +20,18 @@ func (c *CompoundPathMatcher) Match(path string) bool {
 	return false
 }
 
+// MatchDir reports whether any of the matchers that can decide on whole
+// directories matches the directory.
+func (c *CompoundPathMatcher) MatchDir(path string) bool {
+	for _, matcher := range c.matchers {
+		if dirMatcher, ok := matcher.(DirMatcher); ok && dirMatcher.MatchDir(path) {
+			return true
+		}
+	}
+
+	return false
+}
+
 func (c *CompoundPathMatcher) Add(matcher PathMatcher) {
 	c.matchers = append(c.matchers, matcher)
 }
@@ -1,59 +1,107 @@
 package pathmatcher
 
 import (
-	"bytes"
-	"fmt"
+	"bufio"
 	"os"
-	"os/exec"
-	"slices"
+	"path/filepath"
 	"strings"
-
-	"github.com/emilkje/cwc/pkg/errors"
 )
 
-type GitignorePathMatcher struct {
-	ignoredPaths []string
-}
+const gitignoreFile = ".gitignore"
 
-func NewGitignorePathMatcher() (*GitignorePathMatcher, error) {
-	matcher := &GitignorePathMatcher{
-		ignoredPaths: make([]string, 0),
+// NewGitignorePathMatcher creates a matcher for the paths git would ignore:
+// the global excludes file, .git/info/exclude and every .gitignore between
+// the repository root and the path.
+func NewGitignorePathMatcher() (*IgnoreFilePathMatcher, error) {
+	matcher, err := newIgnoreFilePathMatcher(gitignoreFile)
+	if err != nil {
+		return nil, err
 	}
 
-	err := matcher.gitLsFiles()
+	root := matcher.root
 
-	return matcher, err
-}
+	for _, file := range []string{globalExcludesFile(root), filepath.Join(root, ".git", "info", "exclude")} {
+		if file == "" {
+			continue
+		}
 
-func (g *GitignorePathMatcher) Match(path string) bool {
-	return slices.Contains(g.ignoredPaths, path)
-}
+		patterns, err := parseIgnoreFile(file, "", false)
+		if err != nil {
+			return nil, err
+		}
 
-func (g *GitignorePathMatcher) Any() bool {
-	return len(g.ignoredPaths) > 0
+		matcher.base = append(matcher.base, patterns...)
+	}
+
+	return matcher, nil
 }
 
-func (g *GitignorePathMatcher) gitLsFiles() error {
-	// git ls-files -o --exclude-standard
-	buf := new(bytes.Buffer)
-	cmd := exec.Command("git", "ls-files", "-o", "--ignored", "--exclude-standard")
-	cmd.Stdout = buf
-	cmd.Stderr = os.Stderr
+// globalExcludesFile returns the path of the user's global ignore file, as
+// configured by core.excludesFile or the default location. The config files
+// are read in the order git gives precedence to them: the repository, then
+// ~/.gitconfig, then git/config in the XDG config directory.
+func globalExcludesFile(root string) string {
+	home, _ := os.UserHomeDir()
 
-	err := cmd.Run()
-	if err != nil {
-		if strings.Contains(err.Error(), "executable file not found in") {
-			return errors.GitNotInstalledError{Message: "git not found in PATH"}
+	configHome := os.Getenv("XDG_CONFIG_HOME")
+	if configHome == "" && home != "" {
+		configHome = filepath.Join(home, ".config")
+	}
+
+	configs := []string{filepath.Join(root, ".git", "config")}
+
+	if home != "" {
+		configs = append(configs, filepath.Join(home, ".gitconfig"))
+	}
+
+	if configHome != "" {
+		configs = append(configs, filepath.Join(configHome, "git", "config"))
+	}
+
+	for _, config := range configs {
+		if file := readExcludesFileSetting(config); file != "" {
+			if strings.HasPrefix(file, "~/") {
+				file = filepath.Join(home, file[2:])
+			}
+
+			return file
 		}
+	}
 
-		return fmt.Errorf("error running git ls-files: %w", err)
+	if configHome == "" {
+		return ""
 	}
 
-	// create a slice of ignored paths and remove the last empty string
-	ignored := strings.Split(buf.String(), "\n")
-	ignored = ignored[:len(ignored)-1]
+	return filepath.Join(configHome, "git", "ignore")
+}
+
+// readExcludesFileSetting reads core.excludesFile from a git config file.
+func readExcludesFileSetting(config string) string {
+	f, err := os.Open(config)
+	if err != nil {
+		return ""
+	}
 
-	g.ignoredPaths = append(g.ignoredPaths, ignored...)
+	defer func() {
+		_ = f.Close()
+	}()
+
+	inCore := false
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		if strings.HasPrefix(line, "[") {
+			inCore = strings.EqualFold(strings.Trim(line, "[] \t"), "core")
+			continue
+		}
+
+		key, value, ok := strings.Cut(line, "=")
+		if inCore && ok && strings.EqualFold(strings.TrimSpace(key), "excludesfile") {
+			return strings.Trim(strings.TrimSpace(value), `"`)
+		}
+	}
 
-	return nil
+	return ""
 }
@@ -0,0 +1,147 @@
+package pathmatcher
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+const hgignoreFile = ".hgignore"
+
+// NewHgignorePathMatcher creates a matcher for the paths Mercurial would
+// ignore, from the .hgignore at the repository root. The .hg directory is
+// always ignored.
+func NewHgignorePathMatcher() (*IgnoreFilePathMatcher, error) {
+	matcher, err := newIgnoreFilePathMatcher("")
+	if err != nil {
+		return nil, err
+	}
+
+	patterns, err := parseHgignoreFile(filepath.Join(matcher.root, hgignoreFile))
+	if err != nil {
+		return nil, err
+	}
+
+	metadata, _ := parseIgnoreLine(".hg/", "", true)
+	matcher.base = append([]ignorePattern{metadata}, patterns...)
+
+	return matcher, nil
+}
+
+// parseHgignoreFile parses an .hgignore. Patterns are regular expressions
+// unless a "syntax: glob" line switches the syntax, or the pattern has a
+// prefix such as "glob:". Regular expressions match anywhere in the path,
+// globs match at any depth and root globs only from the root. Lines that
+// can't be compiled are skipped.
+func parseHgignoreFile(file string) ([]ignorePattern, error) {
+	f, err := os.Open(file) // #nosec
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+
+		return nil, fmt.Errorf("error opening %s: %w", file, err)
+	}
+
+	defer func() {
+		_ = f.Close()
+	}()
+
+	var patterns []ignorePattern
+
+	syntax := "regexp"
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := stripHgComment(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		if value, ok := strings.CutPrefix(line, "syntax:"); ok {
+			syntax = normalizeHgSyntax(strings.TrimSpace(value))
+			continue
+		}
+
+		lineSyntax := syntax
+
+		if prefix, rest, ok := strings.Cut(line, ":"); ok {
+			if normalized := normalizeHgSyntax(prefix); normalized != "" {
+				lineSyntax, line = normalized, rest
+			}
+		}
+
+		if pattern, ok := parseHgPattern(line, lineSyntax); ok {
+			patterns = append(patterns, pattern)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading %s: %w", file, err)
+	}
+
+	return patterns, nil
+}
+
+// normalizeHgSyntax maps the names of the supported syntaxes to regexp, glob
+// or rootglob, or "" for an unknown one.
+func normalizeHgSyntax(name string) string {
+	switch name {
+	case "re", "regexp":
+		return "regexp"
+	case "glob", "relglob":
+		return "glob"
+	case "rootglob":
+		return "rootglob"
+	}
+
+	return ""
+}
+
+// stripHgComment removes a comment, started by an unescaped #, and trailing
+// whitespace.
+func stripHgComment(line string) string {
+	var stripped strings.Builder
+
+	for i := 0; i < len(line); i++ {
+		if line[i] == '\\' && i+1 < len(line) && line[i+1] == '#' {
+			stripped.WriteByte('#')
+			i++
+
+			continue
+		}
+
+		if line[i] == '#' {
+			break
+		}
+
+		stripped.WriteByte(line[i])
+	}
+
+	return strings.TrimRight(stripped.String(), " \t\r")
+}
+
+func parseHgPattern(line, syntax string) (ignorePattern, bool) {
+	var expr string
+
+	switch syntax {
+	case "regexp":
+		expr = line
+	case "glob":
+		expr = "(?:^|/)" + globToRegexp(strings.TrimSuffix(line, "/")) + "$"
+	case "rootglob":
+		expr = "^" + globToRegexp(strings.Trim(line, "/")) + "$"
+	default:
+		return ignorePattern{}, false
+	}
+
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return ignorePattern{}, false
+	}
+
+	return ignorePattern{re: re}, true
+}
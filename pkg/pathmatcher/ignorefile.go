@@ -0,0 +1,413 @@
+package pathmatcher
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+const dockerignoreFile = ".dockerignore"
+
+// IgnoreFilePathMatcher matches the paths excluded by ignore files written in
+// the gitignore syntax. The files are parsed into compiled patterns and
+// evaluated in-process. Patterns of files given up front apply to their own
+// directory and below; when a per-directory file name such as .gitignore is
+// set, every such file between the repository root and the path applies too,
+// with deeper files taking precedence. Those are loaded the first time a path
+// below them is matched.
+type IgnoreFilePathMatcher struct {
+	// root is the repository root and prefix the working directory
+	// relative to it, so that relative paths can be resolved.
+	root   string
+	prefix string
+
+	// name is the ignore file looked for in every directory, or "" for
+	// none.
+	name string
+
+	// base holds the patterns of the ignore files given up front.
+	base []ignorePattern
+
+	mu      sync.Mutex
+	dirs    map[string][]ignorePattern
+	results map[string]bool
+}
+
+// ignorePattern is a single compiled line of an ignore file.
+type ignorePattern struct {
+	// dir is the directory of the ignore file relative to the repository
+	// root, or "" for patterns that apply to the whole repository.
+	dir     string
+	re      *regexp.Regexp
+	negate  bool
+	dirOnly bool
+}
+
+// NewIgnoreFilePathMatcher creates a matcher for the given ignore files. Their
+// patterns apply relative to the directory they are in, which must be inside
+// the repository. Files named .dockerignore are read like Docker does, with
+// every pattern relative to the directory of the file.
+func NewIgnoreFilePathMatcher(files ...string) (*IgnoreFilePathMatcher, error) {
+	matcher, err := newIgnoreFilePathMatcher("")
+	if err != nil {
+		return nil, err
+	}
+
+	for _, file := range files {
+		abs, err := filepath.Abs(file)
+		if err != nil {
+			return nil, fmt.Errorf("error resolving %s: %w", file, err)
+		}
+
+		if _, err := os.Stat(abs); err != nil {
+			return nil, fmt.Errorf("error reading ignore file: %w", err)
+		}
+
+		dir, ok := matcher.relative(filepath.Dir(abs))
+		if !ok {
+			return nil, fmt.Errorf("ignore file %s is outside the repository", file)
+		}
+
+		if dir == "." {
+			dir = ""
+		}
+
+		patterns, err := parseIgnoreFile(abs, dir, filepath.Base(abs) == dockerignoreFile)
+		if err != nil {
+			return nil, err
+		}
+
+		matcher.base = append(matcher.base, patterns...)
+	}
+
+	return matcher, nil
+}
+
+// newIgnoreFilePathMatcher creates a matcher without patterns for the
+// repository of the working directory, looking for the named ignore file in
+// every directory unless name is "".
+func newIgnoreFilePathMatcher(name string) (*IgnoreFilePathMatcher, error) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return nil, fmt.Errorf("error getting working directory: %w", err)
+	}
+
+	root := FindRepositoryRoot(cwd)
+
+	prefix, err := filepath.Rel(root, cwd)
+	if err != nil {
+		return nil, fmt.Errorf("error resolving working directory: %w", err)
+	}
+
+	return &IgnoreFilePathMatcher{
+		root:    root,
+		prefix:  filepath.ToSlash(prefix),
+		name:    name,
+		dirs:    make(map[string][]ignorePattern),
+		results: make(map[string]bool),
+	}, nil
+}
+
+// Match reports whether the path is ignored. A path is also ignored when one
+// of its parent directories is, as git does not descend into ignored
+// directories.
+func (g *IgnoreFilePathMatcher) Match(path string) bool {
+	rel, ok := g.relative(path)
+	if !ok {
+		return false
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	return g.ignored(rel, false)
+}
+
+// MatchDir reports whether the directory, and with it everything below it,
+// is ignored.
+func (g *IgnoreFilePathMatcher) MatchDir(path string) bool {
+	rel, ok := g.relative(path)
+	if !ok || rel == "." {
+		return false
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	return g.ignored(rel, true)
+}
+
+// Any reports whether any ignore patterns were found.
+func (g *IgnoreFilePathMatcher) Any() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if len(g.base) > 0 {
+		return true
+	}
+
+	return len(g.patternsIn(".")) > 0
+}
+
+// relative resolves a path to a slash separated path relative to the
+// repository root.
+func (g *IgnoreFilePathMatcher) relative(p string) (string, bool) {
+	if filepath.IsAbs(p) {
+		rel, err := filepath.Rel(g.root, p)
+		if err != nil {
+			return "", false
+		}
+
+		p = rel
+	} else {
+		p = filepath.Join(filepath.FromSlash(g.prefix), p)
+	}
+
+	p = filepath.ToSlash(p)
+	if p == ".." || strings.HasPrefix(p, "../") {
+		return "", false // outside the repository
+	}
+
+	return p, true
+}
+
+func (g *IgnoreFilePathMatcher) ignored(rel string, isDir bool) bool {
+	key := rel
+	if isDir {
+		key += "/"
+	}
+
+	if result, ok := g.results[key]; ok {
+		return result
+	}
+
+	result := false
+
+	if parent := path.Dir(rel); parent != "." && g.ignored(parent, true) {
+		result = true
+	} else {
+		result = g.matchPatterns(rel, isDir)
+	}
+
+	g.results[key] = result
+
+	return result
+}
+
+// matchPatterns evaluates all patterns that apply to the path. The last
+// matching pattern decides, and patterns from deeper ignore files come last.
+func (g *IgnoreFilePathMatcher) matchPatterns(rel string, isDir bool) bool {
+	ignored := false
+
+	evaluate := func(patterns []ignorePattern) {
+		for _, pattern := range patterns {
+			if pattern.matches(rel, isDir) {
+				ignored = !pattern.negate
+			}
+		}
+	}
+
+	evaluate(g.base)
+
+	dir := "."
+	evaluate(g.patternsIn(dir))
+
+	for _, segment := range strings.Split(path.Dir(rel), "/") {
+		if segment == "." {
+			break
+		}
+
+		dir = path.Join(dir, segment)
+		evaluate(g.patternsIn(dir))
+	}
+
+	return ignored
+}
+
+// patternsIn returns the patterns of the per-directory ignore file in the
+// directory, loading it on first use. Unreadable files are treated as empty,
+// like git does.
+func (g *IgnoreFilePathMatcher) patternsIn(dir string) []ignorePattern {
+	if g.name == "" {
+		return nil
+	}
+
+	if patterns, ok := g.dirs[dir]; ok {
+		return patterns
+	}
+
+	base := dir
+	if base == "." {
+		base = ""
+	}
+
+	patterns, _ := parseIgnoreFile(filepath.Join(g.root, filepath.FromSlash(dir), g.name), base, false)
+	g.dirs[dir] = patterns
+
+	return patterns
+}
+
+func (p *ignorePattern) matches(rel string, isDir bool) bool {
+	if p.dirOnly && !isDir {
+		return false
+	}
+
+	if p.dir != "" {
+		if !strings.HasPrefix(rel, p.dir+"/") {
+			return false
+		}
+
+		rel = rel[len(p.dir)+1:]
+	}
+
+	return p.re.MatchString(rel)
+}
+
+// parseIgnoreFile parses the patterns of an ignore file in dir. Patterns
+// without a slash match at any depth, unless anchored is set, as it is for
+// .dockerignore.
+func parseIgnoreFile(file, dir string, anchored bool) ([]ignorePattern, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+
+		return nil, fmt.Errorf("error opening %s: %w", file, err)
+	}
+
+	defer func() {
+		_ = f.Close()
+	}()
+
+	var patterns []ignorePattern
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if pattern, ok := parseIgnoreLine(scanner.Text(), dir, anchored); ok {
+			patterns = append(patterns, pattern)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading %s: %w", file, err)
+	}
+
+	return patterns, nil
+}
+
+func parseIgnoreLine(line, dir string, anchored bool) (ignorePattern, bool) {
+	line = strings.TrimSuffix(line, "\r")
+	line = trimUnescapedTrailingSpaces(line)
+
+	if line == "" || strings.HasPrefix(line, "#") {
+		return ignorePattern{}, false
+	}
+
+	pattern := ignorePattern{dir: dir}
+
+	switch {
+	case strings.HasPrefix(line, "!"):
+		pattern.negate = true
+		line = line[1:]
+	case strings.HasPrefix(line, `\!`), strings.HasPrefix(line, `\#`):
+		line = line[1:]
+	}
+
+	if strings.HasSuffix(line, "/") {
+		pattern.dirOnly = true
+		line = strings.TrimSuffix(line, "/")
+	}
+
+	if line == "" {
+		return ignorePattern{}, false
+	}
+
+	// a slash anywhere but at the end anchors the pattern to the directory
+	// of the ignore file, otherwise it matches at any depth
+	anchored = anchored || strings.Contains(line, "/")
+	line = strings.TrimPrefix(line, "/")
+
+	expr := globToRegexp(line)
+	if !anchored {
+		expr = "(?:.*/)?" + expr
+	}
+
+	re, err := regexp.Compile("^" + expr + "$")
+	if err != nil {
+		return ignorePattern{}, false
+	}
+
+	pattern.re = re
+
+	return pattern, true
+}
+
+// globToRegexp translates a gitignore glob into a regular expression.
+func globToRegexp(glob string) string { //nolint:cyclop
+	var expr strings.Builder
+
+	for i := 0; i < len(glob); i++ {
+		c := glob[i]
+
+		switch c {
+		case '*':
+			if strings.HasPrefix(glob[i:], "**") && (i == 0 || glob[i-1] == '/') {
+				rest := glob[i+2:]
+
+				switch {
+				case rest == "":
+					expr.WriteString(".*")
+					i++
+
+					continue
+				case strings.HasPrefix(rest, "/"):
+					expr.WriteString("(?:.*/)?")
+					i += 2
+
+					continue
+				}
+			}
+
+			expr.WriteString("[^/]*")
+		case '?':
+			expr.WriteString("[^/]")
+		case '[':
+			end := strings.IndexByte(glob[i+1:], ']')
+			if end < 0 {
+				expr.WriteString(`\[`)
+				continue
+			}
+
+			class := glob[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+
+			expr.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+			i += end + 1
+		case '\\':
+			if i+1 < len(glob) {
+				i++
+				expr.WriteString(regexp.QuoteMeta(string(glob[i])))
+			}
+		default:
+			expr.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+
+	return expr.String()
+}
+
+func trimUnescapedTrailingSpaces(line string) string {
+	for strings.HasSuffix(line, " ") && !strings.HasSuffix(line, `\ `) {
+		line = line[:len(line)-1]
+	}
+
+	return line
+}
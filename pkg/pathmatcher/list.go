@@ -0,0 +1,37 @@
+package pathmatcher
+
+import "path/filepath"
+
+// UnlistedPathMatcher matches the paths that aren't in a list, so that
+// excluding them limits the files to those in the list.
+type UnlistedPathMatcher struct {
+	paths map[string]bool
+	// dirs holds the directories containing listed paths
+	dirs map[string]bool
+}
+
+// NewUnlistedPathMatcher creates a matcher for the paths not in the list. The
+// paths are relative to the working directory, like the paths matched.
+func NewUnlistedPathMatcher(paths []string) *UnlistedPathMatcher {
+	matcher := &UnlistedPathMatcher{paths: make(map[string]bool), dirs: make(map[string]bool)}
+
+	for _, path := range paths {
+		path = filepath.Clean(path)
+		matcher.paths[path] = true
+
+		for dir := filepath.Dir(path); !matcher.dirs[dir]; dir = filepath.Dir(dir) {
+			matcher.dirs[dir] = true
+		}
+	}
+
+	return matcher
+}
+
+func (u *UnlistedPathMatcher) Match(path string) bool {
+	return !u.paths[filepath.Clean(path)]
+}
+
+// MatchDir reports whether the directory contains none of the listed paths.
+func (u *UnlistedPathMatcher) MatchDir(path string) bool {
+	return !u.dirs[filepath.Clean(path)]
+}
@@ -3,3 +3,9 @@ package pathmatcher
 type PathMatcher interface {
 	Match(path string) bool
 }
+
+// DirMatcher is implemented by matchers that can decide on a whole
+// directory, allowing callers to skip walking it.
+type DirMatcher interface {
+	MatchDir(path string) bool
+}
@@ -0,0 +1,202 @@
+package pathmatcher
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// thirdPartyDirs are the names of directories that hold the code of others
+// by convention, such as Go's vendor directory.
+var thirdPartyDirs = []string{ //nolint:gochecknoglobals
+	"vendor",
+	"third_party",
+	"third-party",
+	"thirdparty",
+	"3rdparty",
+	"3rd_party",
+	"node_modules",
+	"bower_components",
+	"jspm_packages",
+	"Pods",
+	"Carthage",
+	"site-packages",
+}
+
+// manifests are the package manifests that, next to a license file, mark a
+// copied package.
+var manifests = []string{ //nolint:gochecknoglobals
+	"package.json",
+	"bower.json",
+	"composer.json",
+	"go.mod",
+	"Cargo.toml",
+	"pyproject.toml",
+	"setup.py",
+	"setup.cfg",
+	"pom.xml",
+	"build.gradle",
+	"*.gemspec",
+	"*.podspec",
+	"*.nuspec",
+}
+
+// copyrightLine matches the lines of a license that differ between projects
+// under the same license.
+var copyrightLine = regexp.MustCompile(`(?im)^.*copyright.*$`) //nolint:gochecknoglobals
+
+// ThirdPartyPathMatcher matches the files in directories holding code of
+// others: directories named like vendor or third_party, git submodules, and
+// directories with a license file other than the one of the repository,
+// which for a repository without one must come with a package manifest.
+type ThirdPartyPathMatcher struct {
+	// rootLicense is the license of the repository without its copyright
+	// lines, or "" if it has none.
+	rootLicense string
+	// scopes are the directories searched, which are never matched, as the
+	// user asked for them.
+	scopes []string
+	dirs   map[string]bool
+}
+
+// NewThirdPartyPathMatcher creates a matcher for the third-party directories
+// below the scopes, paths relative to the working directory like the paths
+// matched.
+func NewThirdPartyPathMatcher(scopes []string) (*ThirdPartyPathMatcher, error) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return nil, fmt.Errorf("error getting working directory: %w", err)
+	}
+
+	matcher := &ThirdPartyPathMatcher{dirs: map[string]bool{}}
+
+	for _, scope := range scopes {
+		matcher.scopes = append(matcher.scopes, filepath.Clean(scope))
+	}
+
+	if license := licenseFile(FindRepositoryRoot(cwd)); license != "" {
+		matcher.rootLicense = readLicense(license)
+	}
+
+	return matcher, nil
+}
+
+// Match reports whether the file is in a third-party directory.
+func (t *ThirdPartyPathMatcher) Match(path string) bool {
+	for dir := filepath.Dir(filepath.Clean(path)); !t.isScope(dir); dir = filepath.Dir(dir) {
+		if t.MatchDir(dir) {
+			return true
+		}
+
+		if parent := filepath.Dir(dir); parent == dir {
+			break
+		}
+	}
+
+	return false
+}
+
+// MatchDir reports whether the directory itself holds third-party code.
+func (t *ThirdPartyPathMatcher) MatchDir(path string) bool {
+	path = filepath.Clean(path)
+	if t.isScope(path) {
+		return false
+	}
+
+	if matched, ok := t.dirs[path]; ok {
+		return matched
+	}
+
+	matched := t.isThirdParty(path)
+	t.dirs[path] = matched
+
+	return matched
+}
+
+// Dirs returns the third-party directories found so far, sorted.
+func (t *ThirdPartyPathMatcher) Dirs() []string {
+	var dirs []string
+
+	for dir, matched := range t.dirs {
+		if matched {
+			dirs = append(dirs, dir)
+		}
+	}
+
+	sort.Strings(dirs)
+
+	return dirs
+}
+
+func (t *ThirdPartyPathMatcher) isScope(dir string) bool {
+	return dir == "." || slices.Contains(t.scopes, dir)
+}
+
+func (t *ThirdPartyPathMatcher) isThirdParty(dir string) bool {
+	if slices.Contains(thirdPartyDirs, filepath.Base(dir)) {
+		return true
+	}
+
+	// a submodule has a .git file pointing at the repository it was cloned
+	// into, rather than a .git directory
+	if info, err := os.Stat(filepath.Join(dir, ".git")); err == nil && !info.IsDir() {
+		return true
+	}
+
+	license := licenseFile(dir)
+	if license == "" {
+		return false
+	}
+
+	if t.rootLicense != "" {
+		return readLicense(license) != t.rootLicense
+	}
+
+	return hasManifest(dir)
+}
+
+// licenseFile returns the license file of the directory, such as LICENSE,
+// LICENCE.md or COPYING, or "" if it has none.
+func licenseFile(dir string) string {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return ""
+	}
+
+	for _, entry := range entries {
+		name := strings.ToLower(entry.Name())
+		stem := strings.TrimSuffix(name, filepath.Ext(name))
+
+		if !entry.IsDir() && (stem == "license" || stem == "licence" || stem == "copying" ||
+			strings.HasPrefix(stem, "license-") || strings.HasPrefix(stem, "licence-")) {
+			return filepath.Join(dir, entry.Name())
+		}
+	}
+
+	return ""
+}
+
+// readLicense returns the text of the license without its copyright lines
+// and with its whitespace normalized, for comparing licenses.
+func readLicense(path string) string {
+	data, err := os.ReadFile(path) // #nosec
+	if err != nil {
+		return ""
+	}
+
+	return strings.Join(strings.Fields(copyrightLine.ReplaceAllString(string(data), "")), " ")
+}
+
+func hasManifest(dir string) bool {
+	for _, manifest := range manifests {
+		if matches, _ := filepath.Glob(filepath.Join(dir, manifest)); len(matches) > 0 {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,105 @@
+package pathmatcher
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// VCS names the version control system of a repository.
+type VCS string
+
+const (
+	// VCSNone is a plain folder.
+	VCSNone      VCS = ""
+	VCSGit       VCS = "git"
+	VCSMercurial VCS = "hg"
+)
+
+// vcsDirs are the metadata directories that mark the root of a repository.
+var vcsDirs = []struct { //nolint:gochecknoglobals
+	dir string
+	vcs VCS
+}{
+	{".git", VCSGit},
+	{".hg", VCSMercurial},
+}
+
+// plainFolderPatterns are excluded in folders that are not under version
+// control, where there are usually no ignore files to leave out dependencies
+// and build output.
+var plainFolderPatterns = []string{ //nolint:gochecknoglobals
+	"node_modules/",
+	"bower_components/",
+	"vendor/",
+	".venv/",
+	"venv/",
+	"__pycache__/",
+	"*.pyc",
+	"target/",
+	"dist/",
+	"build/",
+	".svn/",
+	".DS_Store",
+}
+
+// DetectRepository returns the closest directory holding the metadata of a
+// supported version control system, along with which one it is. dir itself
+// and VCSNone are returned when it is not inside a repository.
+func DetectRepository(dir string) (string, VCS) {
+	for current := dir; ; {
+		for _, candidate := range vcsDirs {
+			if _, err := os.Stat(filepath.Join(current, candidate.dir)); err == nil {
+				return current, candidate.vcs
+			}
+		}
+
+		parent := filepath.Dir(current)
+		if parent == current {
+			return dir, VCSNone
+		}
+
+		current = parent
+	}
+}
+
+// FindRepositoryRoot returns the closest directory containing .git or .hg, or
+// dir itself when it is not inside a repository.
+func FindRepositoryRoot(dir string) string {
+	root, _ := DetectRepository(dir)
+	return root
+}
+
+// NewVCSIgnorePathMatcher creates a matcher for the paths the version control
+// system of the working directory ignores, see NewGitignorePathMatcher and
+// NewHgignorePathMatcher. In plain folders .gitignore files are honored, and
+// common dependency and build directories such as node_modules are excluded.
+func NewVCSIgnorePathMatcher() (*IgnoreFilePathMatcher, error) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return nil, fmt.Errorf("error getting working directory: %w", err)
+	}
+
+	_, vcs := DetectRepository(cwd)
+
+	switch vcs {
+	case VCSGit:
+		return NewGitignorePathMatcher()
+	case VCSMercurial:
+		return NewHgignorePathMatcher()
+	case VCSNone:
+	}
+
+	matcher, err := newIgnoreFilePathMatcher(gitignoreFile)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, line := range plainFolderPatterns {
+		if pattern, ok := parseIgnoreLine(line, "", false); ok {
+			matcher.base = append(matcher.base, pattern)
+		}
+	}
+
+	return matcher, nil
+}
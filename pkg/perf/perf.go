@@ -0,0 +1,202 @@
+package perf
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/pprof"
+	"runtime/trace"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/emilkje/cwc/pkg/telemetry"
+)
+
+const (
+	cpuProfileFile  = "cpu.pprof"
+	heapProfileFile = "heap.pprof"
+	traceFile       = "trace.out"
+	timingsFile     = "timings.txt"
+)
+
+// Timing is the duration of a single phase, such as gathering files or
+// waiting for the first token of a response.
+type Timing struct {
+	Phase    string
+	Duration time.Duration
+}
+
+type recorder struct {
+	sync.Mutex
+	dir     string
+	started time.Time
+	cpu     *os.File
+	trace   *os.File
+	timings []Timing
+}
+
+var active struct { //nolint:gochecknoglobals
+	sync.Mutex
+	recorder *recorder
+}
+
+// Start begins recording a CPU profile, an execution trace and the timings of
+// the phases passed to Track and Record into dir, which is created if
+// needed. Until Start is called, Track and Record do nothing.
+func Start(dir string) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil { //nolint:gomnd
+		return fmt.Errorf("error creating profile directory: %w", err)
+	}
+
+	r := &recorder{dir: dir, started: time.Now()}
+
+	cpu, err := os.Create(filepath.Join(dir, cpuProfileFile))
+	if err != nil {
+		return fmt.Errorf("error creating cpu profile: %w", err)
+	}
+
+	if err := pprof.StartCPUProfile(cpu); err != nil {
+		_ = cpu.Close()
+		return fmt.Errorf("error starting cpu profile: %w", err)
+	}
+
+	r.cpu = cpu
+
+	traceOut, err := os.Create(filepath.Join(dir, traceFile))
+	if err != nil {
+		r.stopCPU()
+		return fmt.Errorf("error creating trace: %w", err)
+	}
+
+	if err := trace.Start(traceOut); err != nil {
+		_ = traceOut.Close()
+		r.stopCPU()
+
+		return fmt.Errorf("error starting trace: %w", err)
+	}
+
+	r.trace = traceOut
+
+	active.Lock()
+	active.recorder = r
+	active.Unlock()
+
+	return nil
+}
+
+// Stop ends the recording and writes the heap profile and the timings. It
+// returns the directory the files were written to.
+func Stop() (string, error) {
+	active.Lock()
+	r := active.recorder
+	active.recorder = nil
+	active.Unlock()
+
+	if r == nil {
+		return "", nil
+	}
+
+	trace.Stop()
+	_ = r.trace.Close()
+
+	r.stopCPU()
+	r.Record("total", time.Since(r.started))
+
+	if err := r.writeHeapProfile(); err != nil {
+		return r.dir, err
+	}
+
+	return r.dir, r.writeTimings()
+}
+
+// Track starts timing a phase and returns the function that ends it, so it
+// can be used as defer perf.Track("phase")(). The phase is also traced as a
+// span if telemetry is enabled.
+func Track(phase string) func() {
+	span := telemetry.StartSpan(phase)
+
+	if current() == nil {
+		return span.End
+	}
+
+	started := time.Now()
+
+	return func() {
+		span.End()
+
+		if r := current(); r != nil {
+			r.Record(phase, time.Since(started))
+		}
+	}
+}
+
+// Record adds the duration of a phase measured elsewhere and ending now.
+func Record(phase string, duration time.Duration) {
+	telemetry.RecordSpan(phase, duration)
+
+	if r := current(); r != nil {
+		r.Record(phase, duration)
+	}
+}
+
+func current() *recorder {
+	active.Lock()
+	defer active.Unlock()
+
+	return active.recorder
+}
+
+func (r *recorder) Record(phase string, duration time.Duration) {
+	r.Lock()
+	defer r.Unlock()
+
+	r.timings = append(r.timings, Timing{Phase: phase, Duration: duration})
+}
+
+func (r *recorder) stopCPU() {
+	pprof.StopCPUProfile()
+	_ = r.cpu.Close()
+}
+
+func (r *recorder) writeHeapProfile() error {
+	heap, err := os.Create(filepath.Join(r.dir, heapProfileFile))
+	if err != nil {
+		return fmt.Errorf("error creating heap profile: %w", err)
+	}
+
+	defer func() {
+		_ = heap.Close()
+	}()
+
+	runtime.GC() // get up-to-date statistics
+
+	if err := pprof.WriteHeapProfile(heap); err != nil {
+		return fmt.Errorf("error writing heap profile: %w", err)
+	}
+
+	return nil
+}
+
+func (r *recorder) writeTimings() error {
+	r.Lock()
+	defer r.Unlock()
+
+	var out strings.Builder
+
+	for _, timing := range r.timings {
+		fmt.Fprintf(&out, "%-20s %s\n", timing.Phase, timing.Duration.Round(time.Microsecond))
+	}
+
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	fmt.Fprintf(&out, "%-20s %d\n", "heap-alloc-bytes", mem.HeapAlloc)
+	fmt.Fprintf(&out, "%-20s %d\n", "total-alloc-bytes", mem.TotalAlloc)
+
+	if err := os.WriteFile(filepath.Join(r.dir, timingsFile), []byte(out.String()), 0o600); err != nil { //nolint:gomnd
+		return fmt.Errorf("error writing timings: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,281 @@
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	stderrors "errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/emilkje/cwc/pkg/config"
+	"github.com/emilkje/cwc/pkg/sandbox"
+)
+
+const (
+	// Prefix is the prefix of plugin executables on PATH.
+	Prefix = "cwc-"
+	// ProtocolVersion is passed to plugins in CWC_PLUGIN_PROTOCOL.
+	ProtocolVersion = "1"
+
+	describeFlag    = "--cwc-describe"
+	callFlag        = "--cwc-call"
+	describeTimeout = 5 * time.Second
+	callTimeout     = 60 * time.Second
+	maxOutputBytes  = 1 << 20
+)
+
+// validName restricts plugin names to what the API accepts as a tool name.
+var validName = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,64}$`) //nolint:gochecknoglobals
+
+// Plugin is an executable extending cwc with a subcommand and, if declared in
+// the config file as such, a tool the model may call.
+type Plugin struct {
+	Name string
+	Path string
+	Tool bool
+	// Network and Env loosen the sandbox the tool runs in, see
+	// config.PluginConfig.
+	Network bool
+	Env     []string
+}
+
+// Description is what a tool plugin tells about itself in response to
+// --cwc-describe.
+type Description struct {
+	Description string `json:"description"`
+	// Parameters is the JSON Schema of the arguments of the tool.
+	Parameters json.RawMessage `json:"parameters"`
+}
+
+type callRequest struct {
+	Arguments json.RawMessage `json:"arguments"`
+}
+
+type callResponse struct {
+	Content string `json:"content"`
+	Error   string `json:"error,omitempty"`
+}
+
+// Discover returns the plugins declared in the config file and the cwc-<name>
+// executables on PATH, sorted by name. A declared plugin takes precedence
+// over an executable of the same name.
+func Discover(declared []config.PluginConfig) []Plugin {
+	plugins := map[string]Plugin{}
+
+	for _, dir := range filepath.SplitList(os.Getenv("PATH")) {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+
+		for _, entry := range entries {
+			name, ok := executableName(entry.Name())
+			if !ok || !validName.MatchString(name) {
+				continue
+			}
+
+			path := filepath.Join(dir, entry.Name())
+			if _, seen := plugins[name]; seen || !isExecutable(path) {
+				continue // earlier directories on PATH win, as in the shell
+			}
+
+			plugins[name] = Plugin{Name: name, Path: path}
+		}
+	}
+
+	for _, decl := range declared {
+		if !validName.MatchString(decl.Name) {
+			continue
+		}
+
+		path := decl.Path
+		if path == "" {
+			found, err := exec.LookPath(Prefix + decl.Name)
+			if err != nil {
+				continue
+			}
+
+			path = found
+		}
+
+		plugins[decl.Name] = Plugin{Name: decl.Name, Path: path, Tool: decl.Tool, Network: decl.Network, Env: decl.Env}
+	}
+
+	result := make([]Plugin, 0, len(plugins))
+	for _, p := range plugins {
+		result = append(result, p)
+	}
+
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+
+	return result
+}
+
+func executableName(file string) (string, bool) {
+	name, ok := strings.CutPrefix(file, Prefix)
+	if !ok {
+		return "", false
+	}
+
+	if runtime.GOOS == "windows" {
+		return strings.CutSuffix(name, ".exe")
+	}
+
+	return name, true
+}
+
+func isExecutable(path string) bool {
+	info, err := os.Stat(path)
+	if err != nil || info.IsDir() {
+		return false
+	}
+
+	return runtime.GOOS == "windows" || info.Mode()&0o111 != 0
+}
+
+// Run runs the plugin as a subcommand with the given arguments, connected to
+// the terminal.
+func (p Plugin) Run(ctx context.Context, args []string) error {
+	cmd := exec.CommandContext(ctx, p.Path, args...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Env = p.environ()
+
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("error running plugin %s: %w", p.Name, err)
+	}
+
+	return nil
+}
+
+// Describe asks a tool plugin for its description and parameters.
+func (p Plugin) Describe(ctx context.Context) (*Description, error) {
+	ctx, cancel := context.WithTimeout(ctx, describeTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, p.Path, describeFlag)
+	cmd.Env = p.environ()
+
+	output, err := p.exchange(ctx, cmd, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var desc Description
+	if err := json.Unmarshal(output, &desc); err != nil {
+		return nil, fmt.Errorf("error parsing the description of plugin %s: %w", p.Name, err)
+	}
+
+	if len(desc.Parameters) == 0 {
+		desc.Parameters = json.RawMessage(`{"type":"object","properties":{}}`)
+	}
+
+	return &desc, nil
+}
+
+// Call calls a tool plugin with the arguments chosen by the model, a JSON
+// object, and returns its result. The plugin runs in the sandbox, as any
+// other command the model runs.
+func (p Plugin) Call(ctx context.Context, box *sandbox.Sandbox, arguments string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, callTimeout)
+	defer cancel()
+
+	if strings.TrimSpace(arguments) == "" {
+		arguments = "{}"
+	}
+
+	request, err := json.Marshal(callRequest{Arguments: json.RawMessage(arguments)})
+	if err != nil {
+		return "", fmt.Errorf("error encoding the arguments for plugin %s: %w", p.Name, err)
+	}
+
+	cmd, done, err := box.Command(ctx, []string{p.Path, callFlag}, p.sandboxEnv(), p.Network && !config.Offline())
+	if err != nil {
+		return "", fmt.Errorf("error running plugin %s in the sandbox: %w", p.Name, err)
+	}
+
+	defer done()
+
+	output, err := p.exchange(ctx, cmd, request)
+	if err != nil {
+		return "", err
+	}
+
+	var response callResponse
+	if err := json.Unmarshal(output, &response); err != nil {
+		return "", fmt.Errorf("error parsing the response of plugin %s: %w", p.Name, err)
+	}
+
+	if response.Error != "" {
+		return "", fmt.Errorf("plugin %s failed: %s", p.Name, response.Error)
+	}
+
+	return response.Content, nil
+}
+
+// exchange runs the plugin command, writes input to its stdin and returns
+// what it writes to stdout.
+func (p Plugin) exchange(ctx context.Context, cmd *exec.Cmd, input []byte) ([]byte, error) {
+	var stdout, stderr bytes.Buffer
+
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	err := cmd.Run()
+
+	if stderrors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return nil, fmt.Errorf("plugin %s did not respond in time", p.Name)
+	}
+
+	if err != nil {
+		if message := strings.TrimSpace(stderr.String()); message != "" {
+			return nil, fmt.Errorf("error running plugin %s: %w: %s", p.Name, err, message)
+		}
+
+		return nil, fmt.Errorf("error running plugin %s: %w", p.Name, err)
+	}
+
+	if stdout.Len() > maxOutputBytes {
+		return nil, fmt.Errorf("the response of plugin %s exceeds %d bytes", p.Name, maxOutputBytes)
+	}
+
+	return stdout.Bytes(), nil
+}
+
+func (p Plugin) environ() []string {
+	return append(os.Environ(), p.protocolEnv()...)
+}
+
+// sandboxEnv is what the plugin gets of the environment in the sandbox: the
+// variables of the protocol and those declared in the config file.
+func (p Plugin) sandboxEnv() []string {
+	env := p.protocolEnv()
+
+	for _, name := range p.Env {
+		if value, ok := os.LookupEnv(name); ok {
+			env = append(env, name+"="+value)
+		}
+	}
+
+	return env
+}
+
+func (p Plugin) protocolEnv() []string {
+	env := []string{"CWC_PLUGIN_PROTOCOL=" + ProtocolVersion}
+
+	if config.Offline() {
+		env = append(env, "CWC_OFFLINE=1")
+	}
+
+	return env
+}
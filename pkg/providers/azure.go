@@ -0,0 +1,117 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// deploymentsAPIVersion is the last API version listing the deployments of
+// an Azure OpenAI resource with its API key, later versions leave it to the
+// management API.
+const deploymentsAPIVersion = "2022-12-01"
+
+// maxDeploymentsErrorBody caps how much of an error response is reported.
+const maxDeploymentsErrorBody = 512
+
+// nonChatModels are parts of the names of models deployed for other uses
+// than chat, such as embeddings for cwc index.
+var nonChatModels = []string{"embedding", "whisper", "dall-e", "tts"} //nolint:gochecknoglobals
+
+// Deployment is a model deployed to an Azure OpenAI resource.
+type Deployment struct {
+	// Name is what requests ask for, the model deployment of the config.
+	Name string
+	// Model is the model deployed, e.g. "gpt-4o".
+	Model string
+}
+
+// AzureCredential authenticates requests to Azure OpenAI with an API key or,
+// if set instead, an access token of Microsoft Entra ID.
+type AzureCredential struct {
+	APIKey      string
+	AccessToken string
+}
+
+func (c AzureCredential) authenticate(req *http.Request) {
+	if c.AccessToken != "" {
+		req.Header.Set("Authorization", "Bearer "+c.AccessToken)
+		return
+	}
+
+	req.Header.Set(openai.AzureAPIKeyHeader, c.APIKey)
+}
+
+// ListAzureDeployments lists the deployments of chat models that are ready
+// to use on the Azure OpenAI resource at the endpoint, sorted by name.
+func ListAzureDeployments(ctx context.Context, client *http.Client, endpoint string,
+	credential AzureCredential,
+) ([]Deployment, error) {
+	address, err := url.JoinPath(endpoint, "openai", "deployments")
+	if err != nil {
+		return nil, fmt.Errorf("error parsing the endpoint: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, address+"?api-version="+deploymentsAPIVersion, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %w", err)
+	}
+
+	credential.authenticate(req)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error listing the deployments: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, maxDeploymentsErrorBody))
+		return nil, fmt.Errorf("the endpoint responded with %s: %s", resp.Status, strings.TrimSpace(string(detail)))
+	}
+
+	var result struct {
+		Data []struct {
+			ID     string `json:"id"`
+			Model  string `json:"model"`
+			Status string `json:"status"`
+		} `json:"data"`
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("error decoding the deployments: %w", err)
+	}
+
+	deployments := make([]Deployment, 0, len(result.Data))
+
+	for _, deployment := range result.Data {
+		if deployment.Status != "" && deployment.Status != "succeeded" || !isChatModel(deployment.Model) {
+			continue
+		}
+
+		deployments = append(deployments, Deployment{Name: deployment.ID, Model: deployment.Model})
+	}
+
+	sort.Slice(deployments, func(i, j int) bool { return deployments[i].Name < deployments[j].Name })
+
+	return deployments, nil
+}
+
+func isChatModel(model string) bool {
+	model = strings.ToLower(model)
+
+	for _, part := range nonChatModels {
+		if strings.Contains(model, part) {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,137 @@
+package providers
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// OpenAI serves the OpenAI API and Azure OpenAI, which share a client.
+type OpenAI struct {
+	client *openai.Client
+	azure  bool
+}
+
+// NewOpenAI creates a provider for the client configuration, which is for
+// Azure OpenAI when its APIType says so.
+func NewOpenAI(cfg openai.ClientConfig) *OpenAI {
+	return &OpenAI{
+		client: openai.NewClientWithConfig(cfg),
+		azure:  cfg.APIType == openai.APITypeAzure || cfg.APIType == openai.APITypeAzureAD,
+	}
+}
+
+// Client returns the underlying client, e.g. for embeddings.
+func (p *OpenAI) Client() *openai.Client {
+	return p.client
+}
+
+func (p *OpenAI) Name() string {
+	if p.azure {
+		return "Azure OpenAI"
+	}
+
+	return "OpenAI"
+}
+
+func (p *OpenAI) CreateChatStream(ctx context.Context, req openai.ChatCompletionRequest) (Stream, error) { //nolint:ireturn
+	if req.LogProbs {
+		// the streamed responses of the client in use carry no log
+		// probabilities, so the response is received in full instead
+		req.Stream = false
+
+		response, err := p.client.CreateChatCompletion(ctx, req)
+		if err != nil {
+			return nil, err //nolint:wrapcheck
+		}
+
+		return &completionStream{response: response}, nil
+	}
+
+	stream, err := p.client.CreateChatCompletionStream(ctx, req)
+	if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+
+	return stream, nil
+}
+
+func (p *OpenAI) CountTokens(text string) int {
+	return estimateTokens(text)
+}
+
+func (p *OpenAI) ListModels(ctx context.Context) ([]string, error) {
+	list, err := p.client.ListModels(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error listing models: %w", err)
+	}
+
+	models := make([]string, 0, len(list.Models))
+	for _, model := range list.Models {
+		models = append(models, model.ID)
+	}
+
+	return models, nil
+}
+
+func (p *OpenAI) Capabilities() Capabilities {
+	return Capabilities{
+		Tools:         true,
+		Seed:          true,
+		ContentFilter: p.azure,
+		// the version of the client in use doesn't ask for usage in streams
+		StreamUsage: false,
+		LogProbs:    true,
+		// a trailing assistant message is answered rather than continued
+		Prefill: false,
+	}
+}
+
+// completionStream replays a response received in full as a stream of a
+// single chunk.
+type completionStream struct {
+	response openai.ChatCompletionResponse
+	sent     bool
+}
+
+func (s *completionStream) Recv() (openai.ChatCompletionStreamResponse, error) {
+	if s.sent || len(s.response.Choices) == 0 {
+		return openai.ChatCompletionStreamResponse{}, io.EOF
+	}
+
+	s.sent = true
+	choice := s.response.Choices[0]
+
+	calls := make([]openai.ToolCall, len(choice.Message.ToolCalls))
+	for i, call := range choice.Message.ToolCalls {
+		call.Index = &i
+		calls[i] = call
+	}
+
+	return openai.ChatCompletionStreamResponse{
+		ID:      s.response.ID,
+		Object:  s.response.Object,
+		Created: s.response.Created,
+		Model:   s.response.Model,
+		Choices: []openai.ChatCompletionStreamChoice{{
+			Delta: openai.ChatCompletionStreamChoiceDelta{
+				Role:      choice.Message.Role,
+				Content:   choice.Message.Content,
+				ToolCalls: calls,
+			},
+			FinishReason: choice.FinishReason,
+		}},
+	}, nil
+}
+
+func (s *completionStream) Close() error { return nil }
+
+func (s *completionStream) LogProbs() []openai.LogProb {
+	if len(s.response.Choices) == 0 || s.response.Choices[0].LogProbs == nil {
+		return nil
+	}
+
+	return s.response.Choices[0].LogProbs.Content
+}
@@ -0,0 +1,68 @@
+package providers
+
+import (
+	"context"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// charsPerToken is a rough average for English text and code.
+const charsPerToken = 4
+
+// Provider is a backend serving chat models. Requests and responses use the
+// OpenAI wire types, which other backends translate to and from, so that
+// the quirks of each backend stay behind this interface.
+type Provider interface {
+	// Name is shown to the user, e.g. "Azure OpenAI".
+	Name() string
+	// CreateChatStream starts streaming the response to the request.
+	CreateChatStream(ctx context.Context, req openai.ChatCompletionRequest) (Stream, error)
+	// CountTokens counts, or estimates, the tokens in text.
+	CountTokens(text string) int
+	// ListModels returns the models, or deployments, available to the user.
+	ListModels(ctx context.Context) ([]string, error)
+	// Capabilities tells which optional features the backend supports.
+	Capabilities() Capabilities
+}
+
+// Stream is a streamed chat response. Recv returns io.EOF at the end.
+type Stream interface {
+	Recv() (openai.ChatCompletionStreamResponse, error)
+	Close() error
+}
+
+// Capabilities are the optional features of a backend. Requests using a
+// feature the backend lacks have the feature removed before they are sent.
+type Capabilities struct {
+	// Tools is support for calling tools while answering.
+	Tools bool
+	// Seed is support for deterministic sampling with a seed.
+	Seed bool
+	// ContentFilter tells that prompts and responses pass through a content
+	// filter that may block them, as on Azure OpenAI.
+	ContentFilter bool
+	// StreamUsage tells that streamed responses report their token usage.
+	StreamUsage bool
+	// LogProbs is support for returning the log probabilities of the tokens
+	// of the response, see LogProbsStream.
+	LogProbs bool
+	// Prefill is support for continuing a response from a partial assistant
+	// message at the end of the request.
+	Prefill bool
+}
+
+// LogProbsStream is implemented by streams that carry the log probabilities
+// of the tokens of the response, available once Recv has returned io.EOF.
+type LogProbsStream interface {
+	LogProbs() []openai.LogProb
+}
+
+// New returns the provider for the client configuration.
+func New(cfg openai.ClientConfig) Provider { //nolint:ireturn
+	return NewOpenAI(cfg)
+}
+
+// estimateTokens gives a rough token count for backends without a tokenizer.
+func estimateTokens(text string) int {
+	return (len(text) + charsPerToken - 1) / charsPerToken
+}
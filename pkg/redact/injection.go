@@ -0,0 +1,57 @@
+package redact
+
+import "regexp"
+
+// injectionRules detect text written to steer a model reading it rather than
+// the people reading the repository, such as a line in a README telling the
+// model to drop what it was told before. As with secrets they favour
+// precision, since code and documentation often talk about instructions and
+// prompts.
+var injectionRules = []Rule{ //nolint:gochecknoglobals
+	{
+		Name: "ignore-instructions",
+		Pattern: regexp.MustCompile(`(?i)\b(?:ignore|disregard|forget|override)\s+(?:all\s+|any\s+)?` +
+			`(?:of\s+)?(?:the\s+|your\s+|these\s+)?(?:previous|prior|above|earlier|preceding|system|original)\s+` +
+			`(?:instructions?|prompts?|rules|directions|directives|messages?|context)\b`),
+	},
+	{
+		Name:    "new-instructions",
+		Pattern: regexp.MustCompile(`(?i)\b(?:new|updated|real|actual)\s+(?:system\s+)?instructions\s*:`),
+	},
+	{
+		Name: "system-prompt-request",
+		Pattern: regexp.MustCompile(`(?i)\b(?:reveal|print|repeat|output|leak|show)\s+(?:me\s+)?(?:your|the)\s+` +
+			`(?:system\s+prompt|system\s+message|hidden\s+instructions)\b`),
+	},
+	{
+		Name: "message-addressed-to-the-model",
+		Pattern: regexp.MustCompile(`(?i)\b(?:note|message|instructions?|attention)\s+(?:to|for)\s+(?:the\s+|any\s+|all\s+)?` +
+			`(?:AI|LLM|assistant|language\s+model|coding\s+agent|agent|chatbot)s?\b`),
+	},
+	{
+		// the special tokens of chat templates, which have no business in
+		// source files
+		Name:    "chat-role-marker",
+		Pattern: regexp.MustCompile(`<\|(?:im_start|im_end|system|user|assistant|endoftext)\|>|\[/?INST\]|<</?SYS>>`),
+	},
+	{
+		// comments don't show in rendered Markdown, so instructions in them
+		// are read by the model but not by the reader of the page
+		Name: "hidden-html-comment",
+		Pattern: regexp.MustCompile(`(?is)<!--[^>]*?\b(?:instructions?|ignore|disregard|assistant|AI|LLM|` +
+			`language\s+model|system\s+prompt|execute|run\s+the\s+command)\b.*?-->`),
+	},
+	{
+		// Unicode tag characters spell out ASCII that most terminals and
+		// editors don't show
+		Name:    "invisible-text",
+		Pattern: regexp.MustCompile(`[\x{E0000}-\x{E007F}]+`),
+	},
+}
+
+// NewInjectionRedactor creates a redactor for prompt injection: instructions
+// aimed at the model, chat template tokens, instructions in HTML comments
+// and invisible text.
+func NewInjectionRedactor() *Redactor {
+	return NewRedactor(injectionRules...)
+}
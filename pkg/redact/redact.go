@@ -0,0 +1,146 @@
+package redact
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// secretGroup is the name of the capture group holding the sensitive part of
+// a match. Rules without it redact the whole match.
+const secretGroup = "secret"
+
+// Rule detects one kind of sensitive value.
+type Rule struct {
+	Name    string
+	Pattern *regexp.Regexp
+	// MinEntropy skips matches that look too regular to be secrets, such as
+	// "changeme" or "xxxxxxxx", if set.
+	MinEntropy float64
+	// Validate rejects matches that fail a check such as a checksum, if set.
+	Validate func(string) bool
+}
+
+// Finding is a single redacted value.
+type Finding struct {
+	Rule string
+	Line int
+}
+
+// Redactor replaces the values matched by its rules with placeholders.
+type Redactor struct {
+	rules []Rule
+}
+
+func NewRedactor(rules ...Rule) *Redactor {
+	return &Redactor{rules: rules}
+}
+
+// Add appends rules to the redactor.
+func (r *Redactor) Add(rules ...Rule) {
+	r.rules = append(r.rules, rules...)
+}
+
+// Empty reports whether the redactor has no rules.
+func (r *Redactor) Empty() bool {
+	return r == nil || len(r.rules) == 0
+}
+
+// Redact replaces every match of the rules in text with a placeholder naming
+// the rule, such as [REDACTED aws-access-key], and reports what was replaced.
+func (r *Redactor) Redact(text string) (string, []Finding) {
+	if r.Empty() {
+		return text, nil
+	}
+
+	var findings []Finding
+
+	for _, rule := range r.rules {
+		group := rule.Pattern.SubexpIndex(secretGroup)
+		placeholder := fmt.Sprintf("[REDACTED %s]", rule.Name)
+
+		matches := rule.Pattern.FindAllStringSubmatchIndex(text, -1)
+		if len(matches) == 0 {
+			continue
+		}
+
+		var out strings.Builder
+
+		last := 0
+
+		for _, match := range matches {
+			start, end := match[0], match[1]
+			if group > 0 && match[2*group] >= 0 {
+				start, end = match[2*group], match[2*group+1]
+			}
+
+			if start == end || (rule.MinEntropy > 0 && entropy(text[start:end]) < rule.MinEntropy) {
+				continue
+			}
+
+			if rule.Validate != nil && !rule.Validate(text[start:end]) {
+				continue
+			}
+
+			findings = append(findings, Finding{Rule: rule.Name, Line: strings.Count(text[:start], "\n") + 1})
+
+			out.WriteString(text[last:start])
+			out.WriteString(placeholder)
+			last = end
+		}
+
+		out.WriteString(text[last:])
+		text = out.String()
+	}
+
+	sort.SliceStable(findings, func(i, j int) bool {
+		return findings[i].Line < findings[j].Line
+	})
+
+	return text, findings
+}
+
+// Summarize describes the findings in a few words, e.g.
+// "2 secrets (aws-access-key, jwt)".
+func Summarize(findings []Finding, noun string) string {
+	seen := make(map[string]bool)
+
+	var names []string
+
+	for _, finding := range findings {
+		if !seen[finding.Rule] {
+			seen[finding.Rule] = true
+			names = append(names, finding.Rule)
+		}
+	}
+
+	sort.Strings(names)
+
+	if len(findings) != 1 {
+		noun += "s"
+	}
+
+	return fmt.Sprintf("%d %s (%s)", len(findings), noun, strings.Join(names, ", "))
+}
+
+// entropy returns the Shannon entropy of s in bits per character.
+func entropy(s string) float64 {
+	counts := make(map[rune]int)
+	total := 0
+
+	for _, r := range s {
+		counts[r]++
+		total++
+	}
+
+	var bits float64
+
+	for _, count := range counts {
+		p := float64(count) / float64(total)
+		bits -= p * math.Log2(p)
+	}
+
+	return bits
+}
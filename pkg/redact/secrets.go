@@ -0,0 +1,57 @@
+package redact
+
+import "regexp"
+
+// minCredentialEntropy is the Shannon entropy in bits per character below
+// which a value assigned to a credential-like name is considered a
+// placeholder or an identifier rather than a secret.
+const minCredentialEntropy = 3.0
+
+// secretRules detect credentials along the lines of the gitleaks default
+// rules. They favour precision over recall, as redacting ordinary code would
+// make the context less useful.
+var secretRules = []Rule{ //nolint:gochecknoglobals
+	{
+		Name: "private-key",
+		Pattern: regexp.MustCompile(
+			`-----BEGIN[ A-Z0-9_-]*PRIVATE KEY( BLOCK)?-----[\s\S]*?-----END[ A-Z0-9_-]*PRIVATE KEY( BLOCK)?-----`),
+	},
+	{Name: "aws-access-key", Pattern: regexp.MustCompile(`\b(?:AKIA|ASIA|ABIA|ACCA)[0-9A-Z]{16}\b`)},
+	{Name: "github-token", Pattern: regexp.MustCompile(`\b(?:gh[pousr]_[A-Za-z0-9]{36,255}|github_pat_[A-Za-z0-9_]{82})\b`)},
+	{Name: "gitlab-token", Pattern: regexp.MustCompile(`\bglpat-[A-Za-z0-9_-]{20}\b`)},
+	{Name: "slack-token", Pattern: regexp.MustCompile(`\bxox[abposr]-[A-Za-z0-9-]{10,}\b`)},
+	{Name: "slack-webhook", Pattern: regexp.MustCompile(`https://hooks\.slack\.com/services/[A-Za-z0-9+/]{40,}`)},
+	{Name: "stripe-key", Pattern: regexp.MustCompile(`\b(?:sk|rk)_(?:live|test)_[A-Za-z0-9]{20,}\b`)},
+	{Name: "google-api-key", Pattern: regexp.MustCompile(`\bAIza[0-9A-Za-z_-]{35}\b`)},
+	{Name: "openai-key", Pattern: regexp.MustCompile(`\bsk-(?:proj-)?[A-Za-z0-9_-]{20,}T3BlbkFJ[A-Za-z0-9_-]{20,}\b`)},
+	{Name: "anthropic-key", Pattern: regexp.MustCompile(`\bsk-ant-[A-Za-z0-9_-]{32,}\b`)},
+	{Name: "npm-token", Pattern: regexp.MustCompile(`\bnpm_[A-Za-z0-9]{36}\b`)},
+	{Name: "jwt", Pattern: regexp.MustCompile(`\beyJ[A-Za-z0-9_-]{10,}\.eyJ[A-Za-z0-9_-]{10,}\.[A-Za-z0-9_-]{10,}\b`)},
+	{
+		Name:    "connection-string-password",
+		Pattern: regexp.MustCompile(`\b[a-z][a-z0-9+.-]*://[^\s:/@]+:(?P<secret>[^\s@/]{3,})@`),
+	},
+	{
+		// .env style assignments such as DB_PASSWORD=hunter2, but not ones
+		// reading the value from elsewhere like TOKEN=os.getenv("TOKEN")
+		Name: "credential",
+		Pattern: regexp.MustCompile(`(?m)^[ \t]*(?:export[ \t]+)?[A-Z0-9_]*` +
+			`(?:PASSWORD|PASSWD|SECRET|TOKEN|API_?KEY|ACCESS_?KEY|PRIVATE_?KEY)[A-Z0-9_]*[ \t]*=[ \t]*` +
+			`["']?(?P<secret>[^\s"'#()$]{6,})["']?[ \t]*(?:#.*)?$`),
+		MinEntropy: minCredentialEntropy,
+	},
+	{
+		// quoted values in configuration and code, e.g. "apiKey": "..."
+		Name: "credential",
+		Pattern: regexp.MustCompile(`(?i)["']?[a-z0-9_.-]*` +
+			`(?:password|passwd|secret|token|api[_-]?key|access[_-]?key|client[_-]?secret)` +
+			`["']?[ \t]*(?::|=|:=)[ \t]*["'](?P<secret>[^\s"']{8,})["']`),
+		MinEntropy: minCredentialEntropy,
+	},
+}
+
+// NewSecretRedactor creates a redactor for API keys, tokens, private keys
+// and credentials in configuration files.
+func NewSecretRedactor() *Redactor {
+	return NewRedactor(secretRules...)
+}
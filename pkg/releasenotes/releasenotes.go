@@ -0,0 +1,117 @@
+// Package releasenotes prompts the model for the notes of a release written
+// for a given audience, and lays them out with a template.
+package releasenotes
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+
+	"github.com/emilkje/cwc/pkg/changes"
+)
+
+// Audience is who the notes are written for.
+type Audience string
+
+const (
+	// Users get the changes that affect them, in plain language.
+	Users Audience = "users"
+	// Devs get engineering notes, including internal changes.
+	Devs Audience = "devs"
+)
+
+// Audiences lists the audiences, for help texts and errors.
+var Audiences = []Audience{Users, Devs} //nolint:gochecknoglobals
+
+// ParseAudience returns the audience of the given name.
+func ParseAudience(name string) (Audience, error) {
+	for _, audience := range Audiences {
+		if string(audience) == name {
+			return audience, nil
+		}
+	}
+
+	return "", fmt.Errorf("unknown audience %q, use %s or %s", name, Users, Devs)
+}
+
+// Data is what a template lays out.
+type Data struct {
+	Version string
+	// Date is the date of the release, empty for unreleased changes.
+	Date string
+	From string
+	To   string
+	// Notes are the notes written by the model, in markdown.
+	Notes   string
+	Commits []changes.Commit
+	// Contributors are the authors of the commits, in order of appearance.
+	Contributors []string
+}
+
+// NewData returns the data of a release with the notes of its commits.
+func NewData(version, date, from, to, notes string, commits []changes.Commit) *Data {
+	data := &Data{Version: version, Date: date, From: from, To: to, Notes: strings.TrimSpace(notes), Commits: commits}
+
+	seen := make(map[string]bool)
+
+	for _, commit := range commits {
+		if !seen[commit.Author] {
+			seen[commit.Author] = true
+			data.Contributors = append(data.Contributors, commit.Author)
+		}
+	}
+
+	return data
+}
+
+var templates = map[Audience]string{ //nolint:gochecknoglobals
+	Users: "# {{.Version}}{{with .Date}} ({{.}}){{end}}\n\n{{.Notes}}\n",
+	Devs: "# {{.Version}} engineering notes\n\n" +
+		"`{{.From}}..{{.To}}`: {{len .Commits}} commits by {{join .Contributors \", \"}}\n\n{{.Notes}}\n",
+}
+
+// DefaultTemplate returns the template used for the audience when none is
+// given.
+func DefaultTemplate(audience Audience) string {
+	return templates[audience]
+}
+
+// Parse parses a template, which can use the fields of Data and the join
+// function.
+func Parse(text string) (*template.Template, error) {
+	tmpl, err := template.New("release-notes").Funcs(template.FuncMap{"join": strings.Join}).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing the template: %w", err)
+	}
+
+	return tmpl, nil
+}
+
+// Render lays out the data with the template.
+func Render(tmpl *template.Template, data *Data) (string, error) {
+	var out strings.Builder
+
+	if err := tmpl.Execute(&out, data); err != nil {
+		return "", fmt.Errorf("error rendering the template: %w", err)
+	}
+
+	return out.String(), nil
+}
+
+// Prompt asks the model for the notes of the commits in its context, for
+// the audience.
+func Prompt(audience Audience) string {
+	if audience == Devs {
+		return "Write internal engineering notes for these commits, for the developers of the project. Cover the " +
+			"changes to the architecture, packages and APIs naming the files and symbols involved, refactoring, " +
+			"dependency and configuration changes, migrations, changes to tests, tooling and CI, and risks or " +
+			"follow-up work worth knowing about. Group them under ### headings of your choice, refer to commits by " +
+			"their short hash and to pull requests like (#123), and reply with the groups only, without a title."
+	}
+
+	return "Write release notes for these commits, for the users of the project. Lead with the highlights and " +
+		"explain what is new and how it helps, in plain language and the present tense. Leave out internal " +
+		"changes such as refactoring, tests, CI and file names. Group the notes under ### Highlights, " +
+		"### Improvements and ### Fixes, leaving out empty groups, and put any breaking changes with the steps " +
+		"to upgrade under ### Breaking changes first. Reply with the groups only, without a title."
+}
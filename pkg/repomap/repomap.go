@@ -0,0 +1,383 @@
+// Package repomap builds a compact overview of a repository: its
+// directories, and its files ranked by how much the rest of the code refers
+// to them, with their exported symbols and the files they use. It is cheap
+// enough to give the model a global orientation before the file contents.
+package repomap
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/emilkje/cwc/pkg/chat"
+)
+
+const (
+	// maxFileBytes skips files too large to be hand-written source.
+	maxFileBytes = 512 << 10
+	// maxDefinitions leaves out names declared in more files than this, such
+	// as String or New, as they say little about which file is meant.
+	maxDefinitions = 5
+	// maxSymbols and maxUses bound what is listed for each file.
+	maxSymbols = 8
+	maxUses    = 3
+	maxDirs    = 40
+
+	damping    = 0.85
+	iterations = 30
+)
+
+// DefaultTokens is the size of the map prepended to the context.
+const DefaultTokens = 1024
+
+// File is a file of the map.
+type File struct {
+	Path    string
+	Symbols []Symbol
+	// Rank is the importance of the file, higher the more the files that
+	// matter refer to it.
+	Rank float64
+	// Uses are the files whose symbols it refers to, most used first.
+	Uses []string
+	// UsedBy is the number of files referring to its symbols.
+	UsedBy int
+
+	ids       map[string]bool
+	goPackage string
+	refs      map[string]int
+	users     map[int]bool
+	// edges are weighted by the references to each file, in the order of
+	// the files so that ranking is deterministic.
+	edges []edge
+}
+
+type edge struct {
+	to     int
+	weight float64
+}
+
+// Map is the overview of a set of files.
+type Map struct {
+	// Files are ordered by rank, the most important first.
+	Files []*File
+	dirs  map[string]int
+}
+
+// Build reads the files and ranks them. Files that can't be read, are too
+// large or look binary are only counted in their directory.
+func Build(paths []string) *Map {
+	m := &Map{dirs: make(map[string]int)}
+
+	for _, path := range paths {
+		m.dirs[filepath.ToSlash(filepath.Dir(path))]++
+
+		info, err := os.Stat(path)
+		if err != nil || info.Size() > maxFileBytes {
+			continue
+		}
+
+		src, err := os.ReadFile(path) // #nosec
+		if err != nil || bytes.IndexByte(src[:min(len(src), 8000)], 0) >= 0 {
+			continue
+		}
+
+		source := analyze(path, src)
+
+		m.Files = append(m.Files, &File{
+			Path:      filepath.ToSlash(path),
+			Symbols:   source.symbols,
+			ids:       source.ids,
+			goPackage: source.goPackage,
+			refs:      make(map[string]int),
+			users:     make(map[int]bool),
+		})
+	}
+
+	m.link()
+	m.rank()
+
+	return m
+}
+
+// link connects each file to the files declaring the identifiers it uses.
+// Methods are left out, as their names are too often shared to tell which
+// type is meant; the file declaring the type gets the reference instead. Go
+// files refer to the files of their own package by plain names and to other
+// packages by qualified ones, and other languages only to each other.
+func (m *Map) link() {
+	definers := make(map[string][]int)
+
+	for i, file := range m.Files {
+		seen := make(map[string]bool)
+
+		for _, symbol := range file.Symbols {
+			if symbol.Receiver == "" && !seen[symbol.Name] {
+				seen[symbol.Name] = true
+				definers[symbol.Name] = append(definers[symbol.Name], i)
+			}
+		}
+	}
+
+	for i, file := range m.Files {
+		weights := make(map[int]float64)
+
+		for id := range file.ids {
+			defs := m.definersOf(file, id, definers)
+			if len(defs) == 0 || len(defs) > maxDefinitions {
+				continue
+			}
+
+			for _, j := range defs {
+				if j == i {
+					continue
+				}
+
+				weights[j] += 1 / float64(len(defs))
+				m.Files[j].refs[id]++
+				m.Files[j].users[i] = true
+			}
+		}
+
+		for j, weight := range weights {
+			file.edges = append(file.edges, edge{to: j, weight: weight})
+		}
+
+		sort.Slice(file.edges, func(a, b int) bool { return file.edges[a].to < file.edges[b].to })
+	}
+
+	for _, file := range m.Files {
+		file.UsedBy = len(file.users)
+
+		uses := append([]edge{}, file.edges...)
+		sort.SliceStable(uses, func(a, b int) bool { return uses[a].weight > uses[b].weight })
+
+		for _, use := range uses {
+			file.Uses = append(file.Uses, m.Files[use.to].Path)
+		}
+
+		// the symbols the most files refer to first
+		sort.SliceStable(file.Symbols, func(a, b int) bool {
+			return file.refs[file.Symbols[a].Name] > file.refs[file.Symbols[b].Name]
+		})
+
+		file.ids = nil
+	}
+}
+
+// definersOf returns the files declaring the identifier used in file.
+func (m *Map) definersOf(file *File, id string, definers map[string][]int) []int {
+	name, pkg := id, ""
+	if i := strings.LastIndexByte(id, '.'); i >= 0 && file.goPackage != "" {
+		pkg, name = id[:i], id[i+1:]
+	}
+
+	var defs []int
+
+	for _, j := range definers[name] {
+		definer := m.Files[j]
+
+		switch {
+		case file.goPackage == "":
+			if definer.goPackage == "" {
+				defs = append(defs, j)
+			}
+		case pkg == "":
+			if definer.goPackage == file.goPackage && path.Dir(definer.Path) == path.Dir(file.Path) {
+				defs = append(defs, j)
+			}
+		case definer.goPackage == pkg && path.Dir(definer.Path) != path.Dir(file.Path):
+			defs = append(defs, j)
+		}
+	}
+
+	return defs
+}
+
+// rank runs PageRank over the references between files, so that files used
+// by important files are important too.
+func (m *Map) rank() {
+	n := len(m.Files)
+	if n == 0 {
+		return
+	}
+
+	ranks := make([]float64, n)
+	for i := range ranks {
+		ranks[i] = 1 / float64(n)
+	}
+
+	for iteration := 0; iteration < iterations; iteration++ {
+		next := make([]float64, n)
+		dangling := 0.0
+
+		for i, file := range m.Files {
+			total := 0.0
+			for _, e := range file.edges {
+				total += e.weight
+			}
+
+			if total == 0 {
+				dangling += ranks[i]
+				continue
+			}
+
+			for _, e := range file.edges {
+				next[e.to] += damping * ranks[i] * e.weight / total
+			}
+		}
+
+		for i := range next {
+			next[i] += (1-damping)/float64(n) + damping*dangling/float64(n)
+		}
+
+		ranks = next
+	}
+
+	for i, file := range m.Files {
+		file.Rank = ranks[i]
+	}
+
+	sort.SliceStable(m.Files, func(a, b int) bool {
+		if m.Files[a].Rank != m.Files[b].Rank {
+			return m.Files[a].Rank > m.Files[b].Rank
+		}
+
+		return m.Files[a].Path < m.Files[b].Path
+	})
+}
+
+// Render writes the map in about maxTokens tokens: the directories with
+// their number of files, then as many files as fit, the most important
+// first.
+func (m *Map) Render(maxTokens int) string {
+	var out strings.Builder
+
+	dirs := make([]string, 0, len(m.dirs))
+	for dir := range m.dirs {
+		dirs = append(dirs, dir)
+	}
+
+	sort.Strings(dirs)
+
+	out.WriteString("Directories:\n")
+
+	for i, dir := range dirs {
+		if i == maxDirs {
+			fmt.Fprintf(&out, "  ... and %d more\n", len(dirs)-maxDirs)
+			break
+		}
+
+		fmt.Fprintf(&out, "  %s/ (%s)\n", dir, plural(m.dirs[dir], "file"))
+	}
+
+	out.WriteString("\nFiles, the most referenced first:\n")
+
+	return renderFiles(&out, m.Files, maxSymbols, maxUses, maxTokens)
+}
+
+// Outline writes the files below the focus paths, or all files without any,
+// with all their symbols and the files they use, in about maxTokens tokens.
+// It gives the structure of a subsystem in more detail than Render.
+func (m *Map) Outline(focus []string, maxTokens int) string {
+	var files []*File
+
+	for _, file := range m.Files {
+		if len(focus) == 0 || slices.ContainsFunc(focus, func(dir string) bool { return isBelow(file.Path, dir) }) {
+			files = append(files, file)
+		}
+	}
+
+	var out strings.Builder
+
+	return renderFiles(&out, files, -1, -1, maxTokens)
+}
+
+// isBelow reports whether the slash separated path is dir or inside it.
+func isBelow(path, dir string) bool {
+	dir = strings.TrimSuffix(filepath.ToSlash(filepath.Clean(dir)), "/")
+
+	return dir == "." || path == dir || strings.HasPrefix(path, dir+"/")
+}
+
+// renderFiles adds as many of the files as fit in maxTokens to out, with at
+// most symbolLimit symbols and useLimit uses each, or all of them if negative.
+func renderFiles(out *strings.Builder, files []*File, symbolLimit, useLimit, maxTokens int) string {
+	for i, file := range files {
+		entry := file.render(symbolLimit, useLimit)
+
+		if chat.EstimateTokensForSize(int64(out.Len()+len(entry))) > maxTokens {
+			fmt.Fprintf(out, "... and %d more files\n", len(files)-i)
+			break
+		}
+
+		out.WriteString(entry)
+	}
+
+	return out.String()
+}
+
+func (f *File) render(symbolLimit, useLimit int) string {
+	if symbolLimit < 0 {
+		symbolLimit = len(f.Symbols)
+	}
+
+	if useLimit < 0 {
+		useLimit = len(f.Uses)
+	}
+
+	var entry strings.Builder
+
+	entry.WriteString(f.Path)
+
+	var notes []string
+
+	if f.UsedBy > 0 {
+		notes = append(notes, "used by "+plural(f.UsedBy, "file"))
+	}
+
+	if len(f.Uses) > 0 {
+		uses := f.Uses[:min(len(f.Uses), useLimit)]
+		note := "uses " + strings.Join(uses, ", ")
+
+		if len(f.Uses) > useLimit {
+			note += fmt.Sprintf(" and %d more", len(f.Uses)-useLimit)
+		}
+
+		notes = append(notes, note)
+	}
+
+	if len(notes) > 0 {
+		entry.WriteString(" (" + strings.Join(notes, "; ") + ")")
+	}
+
+	entry.WriteString("\n")
+
+	if len(f.Symbols) > 0 {
+		symbols := make([]string, 0, symbolLimit)
+		for _, symbol := range f.Symbols[:min(len(f.Symbols), symbolLimit)] {
+			symbols = append(symbols, symbol.String())
+		}
+
+		line := "  " + strings.Join(symbols, ", ")
+		if len(f.Symbols) > symbolLimit {
+			line += fmt.Sprintf(", +%d more", len(f.Symbols)-symbolLimit)
+		}
+
+		entry.WriteString(line + "\n")
+	}
+
+	return entry.String()
+}
+
+func plural(n int, noun string) string {
+	if n == 1 {
+		return "1 " + noun
+	}
+
+	return fmt.Sprintf("%d %ss", n, noun)
+}
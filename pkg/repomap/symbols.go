@@ -0,0 +1,236 @@
+package repomap
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// Symbol is a declaration other files can refer to.
+type Symbol struct {
+	Name string
+	// Kind is the kind of declaration, such as func or class.
+	Kind string
+	// Receiver is the type of a method, if it is one.
+	Receiver string
+}
+
+func (s Symbol) String() string {
+	if s.Receiver != "" {
+		return s.Kind + " (" + s.Receiver + ") " + s.Name
+	}
+
+	return s.Kind + " " + s.Name
+}
+
+// symbolPattern finds declarations in a language without a parser at hand.
+// The kind and the name are the first and second group.
+type symbolPattern struct {
+	re *regexp.Regexp
+	// private reports whether a name is private by convention.
+	private func(name string) bool
+}
+
+func underscorePrivate(name string) bool { return strings.HasPrefix(name, "_") }
+
+func nonePrivate(string) bool { return false }
+
+var symbolPatterns = map[string][]symbolPattern{ //nolint:gochecknoglobals
+	".py": {
+		{regexp.MustCompile(`(?m)^(class|def|async def)\s+(\w+)`), underscorePrivate},
+	},
+	".js": jsPatterns, ".jsx": jsPatterns, ".mjs": jsPatterns, ".cjs": jsPatterns,
+	".ts": jsPatterns, ".tsx": jsPatterns,
+	".rs": {
+		{regexp.MustCompile(`(?m)^\s*pub(?:\([^)]*\))?\s+(?:async\s+|unsafe\s+|const\s+)*(fn|struct|enum|trait|type|mod|const|static)\s+(\w+)`),
+			nonePrivate},
+	},
+	".java": jvmPatterns, ".kt": jvmPatterns, ".cs": jvmPatterns, ".scala": jvmPatterns,
+	".rb": {
+		{regexp.MustCompile(`(?m)^\s*(class|module|def)\s+(?:self\.)?([\w:]+[?!]?)`), underscorePrivate},
+	},
+	".php": {
+		{regexp.MustCompile(`(?m)^\s*(?:abstract\s+|final\s+)?(class|interface|trait|function|enum)\s+(\w+)`), nonePrivate},
+	},
+	".swift": {
+		{regexp.MustCompile(`(?m)^\s*(?:public\s+|open\s+)(?:final\s+)?(class|struct|enum|protocol|func)\s+(\w+)`),
+			nonePrivate},
+	},
+}
+
+var jsPatterns = []symbolPattern{ //nolint:gochecknoglobals
+	{regexp.MustCompile(`(?m)^export\s+(?:default\s+)?(?:declare\s+)?(?:abstract\s+)?(?:async\s+)?` +
+		`(function\*?|class|const|let|var|interface|type|enum)\s+(\w+)`), nonePrivate},
+}
+
+var jvmPatterns = []symbolPattern{ //nolint:gochecknoglobals
+	{regexp.MustCompile(`(?m)^\s*(?:public|internal)\s+(?:static\s+|final\s+|abstract\s+|sealed\s+|data\s+|partial\s+)*` +
+		`(class|interface|enum|record|object|struct)\s+(\w+)`), nonePrivate},
+}
+
+// source is what a file declares and refers to.
+type source struct {
+	symbols []Symbol
+	ids     map[string]bool
+	// goPackage is the package name of a Go file, whose identifiers are
+	// qualified with the package they come from, such as chat.NewSession.
+	goPackage string
+}
+
+// analyze returns the exported declarations of a source file and the
+// identifiers it uses, or nothing for unsupported languages.
+func analyze(path string, src []byte) source {
+	ext := strings.ToLower(filepath.Ext(path))
+
+	if ext == ".go" {
+		return analyzeGo(path, src)
+	}
+
+	patterns, ok := symbolPatterns[ext]
+	if !ok {
+		return source{}
+	}
+
+	var symbols []Symbol
+
+	for _, pattern := range patterns {
+		for _, match := range pattern.re.FindAllSubmatch(src, -1) {
+			name := string(match[2])
+			if pattern.private(name) {
+				continue
+			}
+
+			// async def is a def and function* a function
+			words := strings.Fields(string(match[1]))
+			symbols = append(symbols, Symbol{Name: name, Kind: strings.TrimSuffix(words[len(words)-1], "*")})
+		}
+	}
+
+	return source{symbols: symbols, ids: identifiers(src)}
+}
+
+// analyzeGo returns the exported functions, methods, types, constants and
+// variables of a Go file, which test files have none worth listing of, and
+// the identifiers in its code rather than its comments. Identifiers selected
+// from another package are qualified with its name.
+func analyzeGo(path string, src []byte) source {
+	file, err := parser.ParseFile(token.NewFileSet(), path, src, parser.SkipObjectResolution)
+	if err != nil {
+		return source{}
+	}
+
+	ids := make(map[string]bool)
+
+	ast.Inspect(file, func(node ast.Node) bool {
+		switch n := node.(type) {
+		case *ast.SelectorExpr:
+			if x, ok := n.X.(*ast.Ident); ok {
+				ids[x.Name+"."+n.Sel.Name] = true
+				return false
+			}
+		case *ast.Ident:
+			ids[n.Name] = true
+		}
+
+		return true
+	})
+
+	if strings.HasSuffix(path, "_test.go") {
+		return source{ids: ids, goPackage: file.Name.Name}
+	}
+
+	var symbols []Symbol
+
+	for _, decl := range file.Decls {
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			if !ast.IsExported(d.Name.Name) {
+				continue
+			}
+
+			symbol := Symbol{Name: d.Name.Name, Kind: "func"}
+
+			if d.Recv != nil && len(d.Recv.List) > 0 {
+				symbol.Receiver = receiverName(d.Recv.List[0].Type)
+				if !ast.IsExported(symbol.Receiver) {
+					continue
+				}
+			}
+
+			symbols = append(symbols, symbol)
+		case *ast.GenDecl:
+			for _, spec := range d.Specs {
+				switch s := spec.(type) {
+				case *ast.TypeSpec:
+					if ast.IsExported(s.Name.Name) {
+						symbols = append(symbols, Symbol{Name: s.Name.Name, Kind: typeKind(s.Type)})
+					}
+				case *ast.ValueSpec:
+					for _, name := range s.Names {
+						if ast.IsExported(name.Name) {
+							symbols = append(symbols, Symbol{Name: name.Name, Kind: d.Tok.String()})
+						}
+					}
+				}
+			}
+		}
+	}
+
+	return source{symbols: symbols, ids: ids, goPackage: file.Name.Name}
+}
+
+func receiverName(expr ast.Expr) string {
+	switch e := expr.(type) {
+	case *ast.StarExpr:
+		return receiverName(e.X)
+	case *ast.IndexExpr:
+		return receiverName(e.X)
+	case *ast.IndexListExpr:
+		return receiverName(e.X)
+	case *ast.Ident:
+		return e.Name
+	}
+
+	return ""
+}
+
+func typeKind(expr ast.Expr) string {
+	switch expr.(type) {
+	case *ast.StructType:
+		return "struct"
+	case *ast.InterfaceType:
+		return "interface"
+	}
+
+	return "type"
+}
+
+// identifiers returns the distinct identifiers in a source file, which is
+// enough to tell which symbols of other files it refers to.
+func identifiers(src []byte) map[string]bool {
+	ids := make(map[string]bool)
+
+	start := -1
+
+	for i, r := range string(src) {
+		isIdent := r == '_' || unicode.IsLetter(r) || (start >= 0 && unicode.IsDigit(r))
+
+		switch {
+		case isIdent && start < 0:
+			start = i
+		case !isIdent && start >= 0:
+			ids[string(src[start:i])] = true
+			start = -1
+		}
+	}
+
+	if start >= 0 {
+		ids[string(src[start:])] = true
+	}
+
+	return ids
+}
@@ -0,0 +1,424 @@
+package sandbox
+
+import (
+	"bytes"
+	"context"
+	stderrors "errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/emilkje/cwc/pkg/config"
+	"github.com/emilkje/cwc/pkg/errors"
+)
+
+const (
+	ModeRestricted = "restricted"
+	ModeContainer  = "container"
+	ModeOff        = "off"
+
+	WorkDirTemp = "temp"
+	WorkDirRepo = "repo"
+
+	defaultTimeout = 30 * time.Second
+	defaultRuntime = "docker"
+	containerDir   = "/work"
+	maxOutputBytes = 64 * 1024
+	killWaitDelay  = time.Second
+	bytesPerMB     = 1024 * 1024
+)
+
+// Sandbox runs commands on behalf of the model within the limits of the
+// repository's sandbox configuration.
+type Sandbox struct {
+	mode     string
+	allow    map[string]bool
+	network  bool
+	workDir  string
+	root     string
+	timeout  time.Duration
+	memoryMB int
+	image    string
+	runtime  string
+}
+
+// Result is the outcome of a command. A non-zero exit code is not an error.
+type Result struct {
+	// Output is the combined standard output and error, cut off after
+	// maxOutputBytes.
+	Output    string
+	Truncated bool
+	ExitCode  int
+	TimedOut  bool
+}
+
+// New creates a sandbox for the repository at root from the settings of the
+// user's config file, made stricter by those of the repository. The
+// repository can't loosen the sandbox, such as turn it off, allow the network
+// or pick the container image or runtime, as cloning it would then be enough
+// to defeat the sandbox; such settings are ignored with a warning. Without any
+// settings, no command is allowed.
+func New(user, repo *config.SandboxConfig, root string) (*Sandbox, error) {
+	s, err := parse(user, root)
+	if err != nil {
+		return nil, err
+	}
+
+	if repo != nil {
+		restricted, err := parse(repo, root)
+		if err != nil {
+			return nil, fmt.Errorf("error in the sandbox settings of the repository: %w", err)
+		}
+
+		if ignored := s.restrict(restricted, repo); len(ignored) > 0 {
+			slog.Warn("ignoring sandbox settings of the repository that would loosen the sandbox, "+
+				"set them in the config file instead", "settings", strings.Join(ignored, ", "))
+		}
+	}
+
+	if s.mode == ModeContainer && s.image == "" {
+		return nil, stderrors.New("sandbox.image must be set in the config file in container mode")
+	}
+
+	return s, nil
+}
+
+func parse(cfg *config.SandboxConfig, root string) (*Sandbox, error) {
+	if cfg == nil {
+		cfg = &config.SandboxConfig{}
+	}
+
+	s := &Sandbox{
+		mode:     cfg.Mode,
+		allow:    make(map[string]bool),
+		network:  cfg.Network,
+		workDir:  cfg.WorkDir,
+		root:     root,
+		timeout:  defaultTimeout,
+		memoryMB: cfg.MemoryMB,
+		image:    cfg.Image,
+		runtime:  cfg.Runtime,
+	}
+
+	for _, name := range cfg.Allow {
+		s.allow[name] = true
+	}
+
+	switch s.mode {
+	case "":
+		s.mode = ModeRestricted
+	case ModeRestricted, ModeOff, ModeContainer:
+	default:
+		return nil, fmt.Errorf("unknown sandbox mode %q, use %q, %q or %q", s.mode, ModeRestricted, ModeContainer, ModeOff)
+	}
+
+	switch s.workDir {
+	case "":
+		s.workDir = WorkDirTemp
+	case WorkDirTemp, WorkDirRepo:
+	default:
+		return nil, fmt.Errorf("unknown sandbox workdir %q, use %q or %q", s.workDir, WorkDirTemp, WorkDirRepo)
+	}
+
+	if cfg.Timeout != "" {
+		timeout, err := time.ParseDuration(cfg.Timeout)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing sandbox timeout: %w", err)
+		}
+
+		s.timeout = timeout
+	}
+
+	if s.runtime == "" {
+		s.runtime = defaultRuntime
+	}
+
+	return s, nil
+}
+
+// restrict applies the settings of the repository, parsed as repo from cfg,
+// that make the sandbox stricter, and returns the others.
+func (s *Sandbox) restrict(repo *Sandbox, cfg *config.SandboxConfig) []string { //nolint:cyclop
+	var ignored []string
+
+	switch {
+	case cfg.Mode == "" || cfg.Mode == s.mode:
+	case s.mode == ModeOff, s.mode == ModeRestricted && repo.mode == ModeContainer:
+		s.mode = repo.mode
+	default:
+		ignored = append(ignored, "mode "+cfg.Mode)
+	}
+
+	if cfg.Image != "" && repo.image != s.image {
+		ignored = append(ignored, "image "+cfg.Image)
+	}
+
+	if cfg.Runtime != "" && repo.runtime != s.runtime {
+		ignored = append(ignored, "runtime "+cfg.Runtime)
+	}
+
+	if len(repo.allow) > 0 {
+		if len(s.allow) == 0 {
+			s.allow = repo.allow
+		} else {
+			for name := range s.allow {
+				if !repo.allow[name] {
+					delete(s.allow, name)
+				}
+			}
+		}
+	}
+
+	if repo.network && !s.network {
+		ignored = append(ignored, "network")
+	}
+
+	switch {
+	case cfg.WorkDir == "":
+	case repo.workDir == WorkDirTemp:
+		s.workDir = WorkDirTemp
+	case s.workDir != repo.workDir:
+		ignored = append(ignored, "workdir "+cfg.WorkDir)
+	}
+
+	switch {
+	case cfg.Timeout == "":
+	case repo.timeout < s.timeout:
+		s.timeout = repo.timeout
+	case repo.timeout > s.timeout:
+		ignored = append(ignored, "timeout "+cfg.Timeout)
+	}
+
+	switch {
+	case repo.memoryMB <= 0:
+	case s.memoryMB <= 0 || repo.memoryMB < s.memoryMB:
+		s.memoryMB = repo.memoryMB
+	case repo.memoryMB > s.memoryMB:
+		ignored = append(ignored, fmt.Sprintf("memoryMB %d", repo.memoryMB))
+	}
+
+	return ignored
+}
+
+// Describe summarizes the restrictions, e.g. to show before a command runs.
+func (s *Sandbox) Describe() string {
+	if s.mode == ModeOff {
+		return "no sandbox"
+	}
+
+	parts := []string{s.mode}
+
+	if s.mode == ModeContainer {
+		parts = append(parts, "image "+s.image)
+	}
+
+	if s.network {
+		parts = append(parts, "network allowed")
+	} else {
+		parts = append(parts, "no network")
+	}
+
+	if s.workDir == WorkDirTemp {
+		parts = append(parts, "temporary directory")
+	} else {
+		parts = append(parts, "repository directory")
+	}
+
+	parts = append(parts, "timeout "+s.timeout.String())
+
+	if s.memoryMB > 0 {
+		parts = append(parts, fmt.Sprintf("memory %dMB", s.memoryMB))
+	}
+
+	return strings.Join(parts, ", ")
+}
+
+// Run executes argv without a shell, so the arguments can't chain further
+// commands.
+func (s *Sandbox) Run(ctx context.Context, argv []string) (*Result, error) {
+	if len(argv) == 0 {
+		return nil, stderrors.New("no command given")
+	}
+
+	if s.mode != ModeOff {
+		if strings.ContainsAny(argv[0], `/\`) || !s.allow[argv[0]] {
+			return nil, errors.CommandNotAllowedError{Command: argv[0]}
+		}
+	}
+
+	cmd, ctx, done, err := s.prepare(ctx, argv, nil, s.network)
+	if err != nil {
+		return nil, err
+	}
+
+	defer done()
+
+	output := &limitedBuffer{limit: maxOutputBytes}
+	cmd.Stdout = output
+	cmd.Stderr = output
+
+	if err = cmd.Start(); err != nil {
+		return nil, fmt.Errorf("error starting command: %w", err)
+	}
+
+	err = cmd.Wait()
+
+	result := &Result{Output: output.String(), Truncated: output.truncated}
+
+	var exitErr *exec.ExitError
+
+	switch {
+	case stderrors.Is(ctx.Err(), context.DeadlineExceeded):
+		result.TimedOut = true
+		result.ExitCode = -1
+	case stderrors.As(err, &exitErr):
+		result.ExitCode = exitErr.ExitCode()
+	case err != nil:
+		return nil, fmt.Errorf("error running %s: %w", argv[0], err)
+	}
+
+	return result, nil
+}
+
+// Command prepares an executable the user chose, such as a tool plugin, to
+// run within the limits of the sandbox, with the variables in env added to
+// its environment. Unlike Run, it doesn't check the allow-list, and the
+// network is allowed if network is set. The caller connects the input and
+// output of the command, and calls done once it has finished.
+func (s *Sandbox) Command(ctx context.Context, argv, env []string, network bool) (*exec.Cmd, func(), error) {
+	if len(argv) == 0 {
+		return nil, nil, stderrors.New("no command given")
+	}
+
+	cmd, _, done, err := s.prepare(ctx, argv, env, s.network || network)
+
+	return cmd, done, err
+}
+
+// prepare creates the command in its working directory and returns it with
+// the context that times it out and the function that cleans up after it.
+func (s *Sandbox) prepare(ctx context.Context, argv, env []string, network bool,
+) (*exec.Cmd, context.Context, func(), error) {
+	dir := s.root
+	cleanup := func() {}
+
+	if s.workDir == WorkDirTemp {
+		temp, err := os.MkdirTemp("", "cwc-sandbox-")
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("error creating sandbox directory: %w", err)
+		}
+
+		dir = temp
+		cleanup = func() { _ = os.RemoveAll(temp) }
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	done := func() {
+		cancel()
+		cleanup()
+	}
+
+	cmd, err := s.command(ctx, argv, env, dir, network)
+	if err != nil {
+		done()
+		return nil, nil, nil, err
+	}
+
+	cmd.WaitDelay = killWaitDelay
+
+	return cmd, ctx, done, nil
+}
+
+func (s *Sandbox) command(ctx context.Context, argv, env []string, dir string, network bool,
+) (*exec.Cmd, error) {
+	switch s.mode {
+	case ModeContainer:
+		args := []string{"run", "--rm", "--interactive", "--workdir", containerDir, "--volume", dir + ":" + containerDir}
+
+		if filepath.IsAbs(argv[0]) {
+			// an executable of the host, such as a plugin, is mounted into
+			// the container
+			inside := "/usr/local/bin/" + filepath.Base(argv[0])
+			args = append(args, "--volume", argv[0]+":"+inside+":ro")
+			argv = append([]string{inside}, argv[1:]...)
+		}
+
+		if !network {
+			args = append(args, "--network", "none")
+		}
+
+		if s.memoryMB > 0 {
+			args = append(args, "--memory", fmt.Sprintf("%dm", s.memoryMB))
+		}
+
+		for _, variable := range env {
+			args = append(args, "--env", variable)
+		}
+
+		args = append(append(args, s.image), argv...)
+
+		cmd := exec.CommandContext(ctx, s.runtime, args...) // #nosec
+		cmd.Dir = dir
+
+		return cmd, nil
+	case ModeOff:
+		cmd := exec.CommandContext(ctx, argv[0], argv[1:]...) // #nosec
+		cmd.Dir = dir
+
+		if len(env) > 0 {
+			cmd.Env = append(os.Environ(), env...)
+		}
+
+		return cmd, nil
+	}
+
+	path, err := exec.LookPath(argv[0])
+	if err != nil {
+		return nil, fmt.Errorf("error finding %s: %w", argv[0], err)
+	}
+
+	cmd := exec.CommandContext(ctx, path, argv[1:]...) // #nosec
+	cmd.Dir = dir
+	// only pass on what commands commonly need, keeping API keys and other
+	// credentials in the environment away from them
+	cmd.Env = append([]string{
+		"PATH=" + os.Getenv("PATH"),
+		"HOME=" + dir,
+		"TMPDIR=" + dir,
+		"LANG=" + os.Getenv("LANG"),
+	}, env...)
+
+	if s.memoryMB > 0 {
+		if err := limitMemory(cmd, uint64(s.memoryMB)*bytesPerMB); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := isolate(cmd, network); err != nil {
+		return nil, err
+	}
+
+	return cmd, nil
+}
+
+// limitedBuffer keeps the first limit bytes written to it.
+type limitedBuffer struct {
+	bytes.Buffer
+	limit     int
+	truncated bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if room := b.limit - b.Len(); room < len(p) {
+		b.truncated = true
+		_, _ = b.Buffer.Write(p[:max(room, 0)])
+
+		return len(p), nil
+	}
+
+	return b.Buffer.Write(p) //nolint:wrapcheck
+}
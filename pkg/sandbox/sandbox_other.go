@@ -0,0 +1,24 @@
+//go:build !linux
+
+package sandbox
+
+import (
+	stderrors "errors"
+	"os/exec"
+)
+
+// isolate fails outside of Linux, where cwc has no way to cut a command off
+// from the network short of running it in a container.
+func isolate(_ *exec.Cmd, network bool) error {
+	if network {
+		return nil
+	}
+
+	return stderrors.New("commands can only be cut off from the network on Linux, " +
+		"use sandbox.mode container or set sandbox.network")
+}
+
+// limitMemory fails outside of Linux for the same reason.
+func limitMemory(_ *exec.Cmd, _ uint64) error {
+	return stderrors.New("memory limits are only supported on Linux, use sandbox.mode container")
+}
@@ -0,0 +1,345 @@
+package semver
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"path"
+	"sort"
+	"strings"
+)
+
+// API maps the exported identifiers of a module, like pkg/config.Load or
+// pkg/config.Config.Name for fields and methods, to their declarations.
+type API map[string]string
+
+// IsAPIFile reports whether the file at the path, relative to the root of
+// the repository, can contribute to the exported API: Go files that aren't
+// tests, outside internal, testdata and vendor directories.
+func IsAPIFile(p string) bool {
+	if path.Ext(p) != ".go" || strings.HasSuffix(p, "_test.go") {
+		return false
+	}
+
+	for _, dir := range strings.Split(path.Dir(p), "/") {
+		if dir == "internal" || dir == "testdata" || dir == "vendor" || (strings.HasPrefix(dir, ".") && dir != ".") {
+			return false
+		}
+	}
+
+	return true
+}
+
+// interfaceMethod marks the declarations of interface methods, which break
+// the implementations of the interface when added.
+const interfaceMethod = "interface method "
+
+// ParseAPI returns the exported API of the Go files, by their paths. Files
+// that don't parse and main packages are left out.
+func ParseAPI(files map[string][]byte) API {
+	api := make(API)
+	fset := token.NewFileSet()
+
+	for name, src := range files {
+		file, err := parser.ParseFile(fset, name, src, parser.SkipObjectResolution)
+		if err != nil || file.Name.Name == "main" {
+			continue
+		}
+
+		pkg := path.Dir(name)
+		if pkg == "." {
+			pkg = file.Name.Name
+		}
+
+		p := &apiParser{api: api, fset: fset, pkg: pkg}
+
+		for _, decl := range file.Decls {
+			switch decl := decl.(type) {
+			case *ast.FuncDecl:
+				p.function(decl)
+			case *ast.GenDecl:
+				p.genDecl(decl)
+			}
+		}
+	}
+
+	return api
+}
+
+type apiParser struct {
+	api  API
+	fset *token.FileSet
+	pkg  string
+}
+
+func (p *apiParser) print(node ast.Node) string {
+	var out bytes.Buffer
+
+	_ = printer.Fprint(&out, p.fset, node)
+
+	return out.String()
+}
+
+// signature prints the function type without parameter names, which callers
+// don't depend on.
+func (p *apiParser) signature(fn *ast.FuncType) string {
+	list := func(fields *ast.FieldList) string {
+		if fields == nil {
+			return ""
+		}
+
+		var types []string
+
+		for _, field := range fields.List {
+			for range max(len(field.Names), 1) {
+				types = append(types, p.print(field.Type))
+			}
+		}
+
+		return strings.Join(types, ", ")
+	}
+
+	results := list(fn.Results)
+	if fn.Results != nil && (len(fn.Results.List) > 1 || len(fn.Results.List[0].Names) > 1) {
+		results = "(" + results + ")"
+	}
+
+	return strings.TrimSpace(fmt.Sprintf("func%s(%s) %s", p.typeParams(fn.TypeParams), list(fn.Params), results))
+}
+
+// typeParams prints type parameters like [K comparable, V any].
+func (p *apiParser) typeParams(fields *ast.FieldList) string {
+	if fields == nil {
+		return ""
+	}
+
+	var params []string
+
+	for _, field := range fields.List {
+		for _, name := range field.Names {
+			params = append(params, name.Name+" "+p.print(field.Type))
+		}
+	}
+
+	return "[" + strings.Join(params, ", ") + "]"
+}
+
+func (p *apiParser) function(decl *ast.FuncDecl) {
+	if !decl.Name.IsExported() {
+		return
+	}
+
+	if decl.Recv == nil || len(decl.Recv.List) == 0 {
+		p.api[p.pkg+"."+decl.Name.Name] = p.signature(decl.Type)
+		return
+	}
+
+	receiver := decl.Recv.List[0].Type
+	if star, ok := receiver.(*ast.StarExpr); ok {
+		receiver = star.X
+	}
+
+	switch expr := receiver.(type) {
+	case *ast.IndexExpr:
+		receiver = expr.X
+	case *ast.IndexListExpr:
+		receiver = expr.X
+	}
+
+	if ident, ok := receiver.(*ast.Ident); ok && ident.IsExported() {
+		p.api[p.pkg+"."+ident.Name+"."+decl.Name.Name] = "method " + p.signature(decl.Type)
+	}
+}
+
+func (p *apiParser) genDecl(decl *ast.GenDecl) {
+	for _, spec := range decl.Specs {
+		switch spec := spec.(type) {
+		case *ast.TypeSpec:
+			p.typeSpec(spec)
+		case *ast.ValueSpec:
+			for _, name := range spec.Names {
+				if !name.IsExported() {
+					continue
+				}
+
+				declaration := decl.Tok.String()
+				if spec.Type != nil {
+					declaration += " " + p.print(spec.Type)
+				}
+
+				p.api[p.pkg+"."+name.Name] = declaration
+			}
+		}
+	}
+}
+
+func (p *apiParser) typeSpec(spec *ast.TypeSpec) {
+	if !spec.Name.IsExported() {
+		return
+	}
+
+	key := p.pkg + "." + spec.Name.Name
+
+	declaration := "type" + p.typeParams(spec.TypeParams)
+
+	if spec.Assign.IsValid() {
+		declaration += " ="
+	}
+
+	switch typ := spec.Type.(type) {
+	case *ast.StructType:
+		p.api[key] = declaration + " struct"
+
+		for _, field := range typ.Fields.List {
+			names := field.Names
+			if len(names) == 0 {
+				names = []*ast.Ident{embeddedName(field.Type)}
+			}
+
+			for _, name := range names {
+				if name != nil && name.IsExported() {
+					p.api[key+"."+name.Name] = "field " + p.print(field.Type)
+				}
+			}
+		}
+	case *ast.InterfaceType:
+		p.api[key] = declaration + " interface"
+
+		for _, method := range typ.Methods.List {
+			for _, name := range method.Names {
+				if fn, ok := method.Type.(*ast.FuncType); ok && name.IsExported() {
+					p.api[key+"."+name.Name] = interfaceMethod + p.signature(fn)
+				}
+			}
+
+			// embedded interfaces and type sets change what implements it
+			if len(method.Names) == 0 {
+				p.api[key+".embeds "+p.print(method.Type)] = interfaceMethod + p.print(method.Type)
+			}
+		}
+	default:
+		p.api[key] = declaration + " " + p.print(spec.Type)
+	}
+}
+
+func embeddedName(expr ast.Expr) *ast.Ident {
+	switch expr := expr.(type) {
+	case *ast.Ident:
+		return expr
+	case *ast.StarExpr:
+		return embeddedName(expr.X)
+	case *ast.SelectorExpr:
+		return expr.Sel
+	case *ast.IndexExpr:
+		return embeddedName(expr.X)
+	case *ast.IndexListExpr:
+		return embeddedName(expr.X)
+	}
+
+	return nil
+}
+
+// Change is a change to an exported identifier.
+type Change struct {
+	Symbol string
+	// Old and New are the declarations before and after, "" when the
+	// identifier is added or removed.
+	Old, New string
+	Breaking bool
+}
+
+func (c *Change) String() string {
+	switch {
+	case c.Old == "":
+		return fmt.Sprintf("added %s: %s", c.Symbol, c.New)
+	case c.New == "":
+		return fmt.Sprintf("removed %s: %s", c.Symbol, c.Old)
+	default:
+		return fmt.Sprintf("changed %s: %s -> %s", c.Symbol, c.Old, c.New)
+	}
+}
+
+// Compare returns the changes from the old API to the new, breaking ones
+// first. Removing or changing an identifier breaks its users, and so does
+// adding a method to an interface that existed before; other additions
+// don't. The members of a removed type are folded into its removal.
+func Compare(old, new API) []Change {
+	var changes []Change
+
+	for symbol, before := range old {
+		after, ok := new[symbol]
+
+		switch {
+		case !ok:
+			if p := parent(symbol); p != "" {
+				if _, kept := new[p]; !kept {
+					continue
+				}
+			}
+
+			changes = append(changes, Change{Symbol: symbol, Old: before, Breaking: true})
+		case after != before:
+			changes = append(changes, Change{Symbol: symbol, Old: before, New: after, Breaking: true})
+		}
+	}
+
+	for symbol, after := range new {
+		if _, ok := old[symbol]; ok {
+			continue
+		}
+
+		breaking := false
+
+		if p := parent(symbol); p != "" {
+			if _, existed := old[p]; !existed {
+				continue
+			}
+
+			breaking = strings.HasPrefix(after, interfaceMethod)
+		}
+
+		changes = append(changes, Change{Symbol: symbol, New: after, Breaking: breaking})
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		if changes[i].Breaking != changes[j].Breaking {
+			return changes[i].Breaking
+		}
+
+		return changes[i].Symbol < changes[j].Symbol
+	})
+
+	return changes
+}
+
+// parent returns the type of a field or method, like pkg/x.T for pkg/x.T.M,
+// or "" for package-level identifiers.
+func parent(symbol string) string {
+	dir, name := path.Split(symbol)
+
+	parts := strings.SplitN(name, ".", 3) //nolint:gomnd
+	if len(parts) < 3 {                   //nolint:gomnd
+		return ""
+	}
+
+	return dir + parts[0] + "." + parts[1]
+}
+
+// FromAPI returns the bump the API changes call for: major when any breaks
+// its users, minor when identifiers are added, and none otherwise.
+func FromAPI(changes []Change) Bump {
+	bump := None
+
+	for _, change := range changes {
+		if change.Breaking {
+			return Major
+		}
+
+		bump = Minor
+	}
+
+	return bump
+}
@@ -0,0 +1,144 @@
+// Package semver recommends the next semantic version of a release from the
+// changes to its exported Go API and from the types of its commits.
+package semver
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/emilkje/cwc/pkg/changes"
+	"github.com/emilkje/cwc/pkg/commitmsg"
+)
+
+// Bump is the part of the version a release increments.
+type Bump int
+
+const (
+	None Bump = iota
+	Patch
+	Minor
+	Major
+)
+
+func (b Bump) String() string {
+	switch b {
+	case Patch:
+		return "patch"
+	case Minor:
+		return "minor"
+	case Major:
+		return "major"
+	case None:
+	}
+
+	return "none"
+}
+
+// ParseBump returns the bump of the given name.
+func ParseBump(name string) (Bump, bool) {
+	for _, bump := range []Bump{None, Patch, Minor, Major} {
+		if strings.EqualFold(strings.TrimSpace(name), bump.String()) {
+			return bump, true
+		}
+	}
+
+	return None, false
+}
+
+// Version is a semantic version, like v1.2.3.
+type Version struct {
+	Major, Minor, Patch int
+	// Prefix is "v" when the version is written with it, as Go tags are.
+	Prefix string
+}
+
+var versionRegexp = regexp.MustCompile(`^(v?)(\d+)\.(\d+)\.(\d+)(?:[-+].*)?$`) //nolint:gochecknoglobals
+
+// ParseVersion parses a version like v1.2.3 or 1.2.3, ignoring pre-release
+// and build suffixes.
+func ParseVersion(s string) (Version, bool) {
+	m := versionRegexp.FindStringSubmatch(strings.TrimSpace(s))
+	if m == nil {
+		return Version{}, false
+	}
+
+	major, _ := strconv.Atoi(m[2])
+	minor, _ := strconv.Atoi(m[3])
+	patch, _ := strconv.Atoi(m[4])
+
+	return Version{Major: major, Minor: minor, Patch: patch, Prefix: m[1]}, true
+}
+
+func (v Version) String() string {
+	return fmt.Sprintf("%s%d.%d.%d", v.Prefix, v.Major, v.Minor, v.Patch)
+}
+
+// Next returns the version after the bump.
+func (v Version) Next(bump Bump) Version {
+	switch bump {
+	case Major:
+		return Version{Major: v.Major + 1, Prefix: v.Prefix}
+	case Minor:
+		return Version{Major: v.Major, Minor: v.Minor + 1, Prefix: v.Prefix}
+	case Patch:
+		return Version{Major: v.Major, Minor: v.Minor, Patch: v.Patch + 1, Prefix: v.Prefix}
+	case None:
+	}
+
+	return v
+}
+
+// Effective returns the bump to make from the version. Before 1.0.0 breaking
+// changes bump the minor version and the rest the patch version, as Go
+// modules and Cargo do, so that v0 releases don't become v1 by accident.
+func (v Version) Effective(bump Bump) Bump {
+	if v.Major == 0 && bump > Patch {
+		return bump - 1
+	}
+
+	return bump
+}
+
+// FromCommits returns the bump the commits call for by Conventional Commits:
+// major for breaking changes, minor for features and patch for the rest. The
+// reasons list the commits that decide it.
+func FromCommits(commits []changes.Commit) (Bump, []string) {
+	bump := None
+
+	var breaking, features []string
+
+	for i := range commits {
+		commit := &commits[i]
+
+		title := commit.Title()
+		short := commit.Hash[:min(len(commit.Hash), 7)] //nolint:gomnd
+		header, conventional := commitmsg.ParseHeader(title)
+
+		switch {
+		case conventional && header.Breaking, strings.Contains(commit.Body, "BREAKING CHANGE"):
+			bump = max(bump, Major)
+			breaking = append(breaking, fmt.Sprintf("%s %s", short, title))
+		case conventional && header.Type == "feat":
+			bump = max(bump, Minor)
+			features = append(features, fmt.Sprintf("%s %s", short, title))
+		default:
+			bump = max(bump, Patch)
+		}
+	}
+
+	var reasons []string
+
+	for _, commit := range breaking {
+		reasons = append(reasons, "breaking change in "+commit)
+	}
+
+	if bump == Minor {
+		for _, commit := range features {
+			reasons = append(reasons, "feature in "+commit)
+		}
+	}
+
+	return bump, reasons
+}
@@ -0,0 +1,353 @@
+package sessions
+
+import (
+	"archive/zip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	stderrors "errors"
+	"fmt"
+	"io"
+	"math"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// conversationsFile is the file holding the conversations in the data
+// exports of ChatGPT and Claude.
+const conversationsFile = "conversations.json"
+
+// The roles of the messages of imported conversations.
+const (
+	roleSystem    = "system"
+	roleUser      = "user"
+	roleAssistant = "assistant"
+)
+
+// message is a message of a conversation imported from another chat tool.
+type message struct {
+	role  string
+	text  string
+	model string
+}
+
+// ImportArchive reads the sessions in a zip file, such as the data export of
+// ChatGPT or Claude, from the conversations.json in it.
+func ImportArchive(r io.ReaderAt, size int64) ([]*Session, error) {
+	archive, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, fmt.Errorf("error opening archive: %w", err)
+	}
+
+	for _, file := range archive.File {
+		if path.Base(file.Name) != conversationsFile {
+			continue
+		}
+
+		rc, err := file.Open()
+		if err != nil {
+			return nil, fmt.Errorf("error opening %s: %w", file.Name, err)
+		}
+		defer rc.Close()
+
+		return Import(rc)
+	}
+
+	return nil, fmt.Errorf("the archive holds no %s", conversationsFile)
+}
+
+// importConversations tells apart the arrays of conversations written by
+// ChatGPT, Claude and ShareGPT by the fields of their first conversation.
+func importConversations(data []byte) ([]*Session, error) {
+	var probe []map[string]json.RawMessage
+	if err := json.Unmarshal(data, &probe); err != nil {
+		return nil, fmt.Errorf("error decoding conversations: %w", err)
+	}
+
+	if len(probe) == 0 {
+		return nil, nil
+	}
+
+	switch first := probe[0]; {
+	case first["mapping"] != nil:
+		return importChatGPT(data)
+	case first["chat_messages"] != nil:
+		return importClaude(data)
+	case first["conversations"] != nil:
+		return importShareGPT(data)
+	default:
+		return nil, ErrUnknownFormat
+	}
+}
+
+type chatGPTConversation struct {
+	ID          string                 `json:"id"`
+	Title       string                 `json:"title"`
+	CreateTime  float64                `json:"create_time"`
+	UpdateTime  float64                `json:"update_time"`
+	Mapping     map[string]chatGPTNode `json:"mapping"`
+	CurrentNode string                 `json:"current_node"`
+}
+
+type chatGPTNode struct {
+	Parent  string          `json:"parent"`
+	Message *chatGPTMessage `json:"message"`
+}
+
+type chatGPTMessage struct {
+	Author struct {
+		Role string `json:"role"`
+	} `json:"author"`
+	Content struct {
+		ContentType string            `json:"content_type"`
+		Parts       []json.RawMessage `json:"parts"`
+		Text        string            `json:"text"`
+	} `json:"content"`
+	Metadata struct {
+		ModelSlug string `json:"model_slug"`
+		Hidden    bool   `json:"is_visually_hidden_from_conversation"`
+	} `json:"metadata"`
+}
+
+// importChatGPT converts the conversations.json of a ChatGPT data export.
+// A conversation is a tree of messages, as responses can be regenerated and
+// prompts edited, of which the branch shown last is imported.
+func importChatGPT(data []byte) ([]*Session, error) {
+	var conversations []chatGPTConversation
+	if err := json.Unmarshal(data, &conversations); err != nil {
+		return nil, fmt.Errorf("error decoding ChatGPT conversations: %w", err)
+	}
+
+	list := make([]*Session, 0, len(conversations))
+
+	for _, conversation := range conversations {
+		var messages []message
+
+		for id := conversation.CurrentNode; id != ""; id = conversation.Mapping[id].Parent {
+			node, ok := conversation.Mapping[id]
+			if !ok {
+				break
+			}
+
+			if m, ok := node.Message.convert(); ok {
+				messages = append(messages, m)
+			}
+		}
+
+		// walked from the last message to the first
+		for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
+			messages[i], messages[j] = messages[j], messages[i]
+		}
+
+		s := importedSession(conversation.ID, conversation.Title,
+			unixTime(conversation.CreateTime), unixTime(conversation.UpdateTime))
+		if err := addMessages(s, messages); err != nil {
+			continue // conversations with nothing but hidden messages
+		}
+
+		list = append(list, s)
+	}
+
+	return list, nil
+}
+
+func (m *chatGPTMessage) convert() (message, bool) {
+	if m == nil || m.Metadata.Hidden {
+		return message{}, false
+	}
+
+	var texts []string
+
+	if m.Content.Text != "" {
+		texts = append(texts, m.Content.Text)
+	}
+
+	for _, part := range m.Content.Parts {
+		// parts that aren't text, such as images, are left out
+		var text string
+		if err := json.Unmarshal(part, &text); err == nil && text != "" {
+			texts = append(texts, text)
+		}
+	}
+
+	text := strings.Join(texts, "\n\n")
+	if strings.TrimSpace(text) == "" {
+		return message{}, false
+	}
+
+	switch m.Author.Role {
+	case roleSystem:
+		return message{role: roleSystem, text: text}, true
+	case roleUser:
+		return message{role: roleUser, text: text}, true
+	case roleAssistant:
+		return message{role: roleAssistant, text: text, model: m.Metadata.ModelSlug}, true
+	default:
+		// the output of tools, such as browsing, is part of the response
+		return message{role: roleAssistant, text: text}, true
+	}
+}
+
+type claudeConversation struct {
+	UUID         string          `json:"uuid"`
+	Name         string          `json:"name"`
+	CreatedAt    time.Time       `json:"created_at"`
+	UpdatedAt    time.Time       `json:"updated_at"`
+	ChatMessages []claudeMessage `json:"chat_messages"`
+}
+
+type claudeMessage struct {
+	Sender    string    `json:"sender"`
+	Text      string    `json:"text"`
+	CreatedAt time.Time `json:"created_at"`
+	Content   []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	} `json:"content"`
+}
+
+// importClaude converts the conversations.json of a Claude data export.
+func importClaude(data []byte) ([]*Session, error) {
+	var conversations []claudeConversation
+	if err := json.Unmarshal(data, &conversations); err != nil {
+		return nil, fmt.Errorf("error decoding Claude conversations: %w", err)
+	}
+
+	list := make([]*Session, 0, len(conversations))
+
+	for _, conversation := range conversations {
+		chatMessages := conversation.ChatMessages
+		sort.SliceStable(chatMessages, func(i, j int) bool {
+			return chatMessages[i].CreatedAt.Before(chatMessages[j].CreatedAt)
+		})
+
+		messages := make([]message, 0, len(chatMessages))
+
+		for _, m := range chatMessages {
+			text := m.Text
+			if text == "" {
+				var texts []string
+
+				for _, content := range m.Content {
+					if content.Type == "text" && content.Text != "" {
+						texts = append(texts, content.Text)
+					}
+				}
+
+				text = strings.Join(texts, "\n\n")
+			}
+
+			role := roleAssistant
+			if m.Sender == "human" {
+				role = roleUser
+			}
+
+			messages = append(messages, message{role: role, text: text})
+		}
+
+		s := importedSession(conversation.UUID, conversation.Name, conversation.CreatedAt, conversation.UpdatedAt)
+		if err := addMessages(s, messages); err != nil {
+			continue // conversations that were never sent
+		}
+
+		list = append(list, s)
+	}
+
+	return list, nil
+}
+
+// importedSession creates a session for a conversation of another chat tool.
+// Its ID is derived from the ID of the conversation, so that importing the
+// same export again finds the sessions already saved.
+func importedSession(externalID, name string, created, updated time.Time) *Session {
+	if created.IsZero() {
+		created = time.Now()
+	}
+
+	if updated.Before(created) {
+		updated = created
+	}
+
+	hash := sha256.Sum256([]byte(externalID))
+
+	return &Session{
+		ID:      created.Local().Format("20060102-150405") + "-" + hex.EncodeToString(hash[:idSuffixBytes]),
+		Name:    name,
+		Created: created,
+		Updated: updated,
+	}
+}
+
+func unixTime(seconds float64) time.Time {
+	if seconds <= 0 {
+		return time.Time{}
+	}
+
+	whole, fraction := math.Modf(seconds)
+
+	return time.Unix(int64(whole), int64(fraction*float64(time.Second)))
+}
+
+// addMessages adds the messages to the session as turns. Consecutive
+// messages from the same side are joined, a system message sets the context
+// of the prompts after it and a prompt left without a response gets an empty
+// one. The session keeps the times it was given rather than the time of the
+// import.
+func addMessages(s *Session, messages []message) error {
+	var (
+		context, prompt, response, model string
+		pending                          bool
+	)
+
+	flush := func() {
+		if pending {
+			s.Add(context, Turn{Prompt: prompt, Response: response, Model: model})
+		}
+
+		prompt, response, model, pending = "", "", "", false
+	}
+
+	updated := s.Updated
+
+	for _, m := range messages {
+		switch m.role {
+		case roleSystem:
+			flush()
+			context = m.text
+		case roleUser:
+			if response != "" {
+				flush()
+			}
+
+			prompt = joinMessage(prompt, m.text)
+			pending = true
+		case roleAssistant:
+			response = joinMessage(response, m.text)
+			if m.model != "" {
+				model = m.model
+			}
+
+			pending = true
+		}
+	}
+
+	flush()
+
+	s.Updated = updated
+
+	if len(s.Turns) == 0 {
+		return stderrors.New("no messages")
+	}
+
+	return nil
+}
+
+func joinMessage(text, message string) string {
+	if text == "" {
+		return message
+	}
+
+	return text + "\n\n" + message
+}
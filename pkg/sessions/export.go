@@ -0,0 +1,193 @@
+package sessions
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	stderrors "errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+const (
+	// FormatJSON is the format of cwc, described by Schema.
+	FormatJSON = "json"
+	// FormatShareGPT is the format of the ShareGPT datasets, read by many
+	// chat tools and fine-tuning frameworks.
+	FormatShareGPT = "sharegpt"
+
+	exportVersion = 1
+)
+
+// The roles of the messages in the ShareGPT format.
+const (
+	shareGPTSystem = "system"
+	shareGPTHuman  = "human"
+	shareGPTModel  = "gpt"
+)
+
+// Schema is the JSON Schema of the sessions exported in FormatJSON.
+//
+//go:embed schema/sessions.schema.json
+var Schema []byte //nolint:gochecknoglobals
+
+// ErrUnknownFormat is returned when a file to import is in neither format.
+var ErrUnknownFormat = stderrors.New("not a cwc sessions export, ShareGPT file or ChatGPT or Claude data export")
+
+// export is the document written in FormatJSON.
+type export struct {
+	Version  int        `json:"version"`
+	Sessions []*Session `json:"sessions"`
+}
+
+type shareGPTConversation struct {
+	ID            string            `json:"id"`
+	Conversations []shareGPTMessage `json:"conversations"`
+}
+
+type shareGPTMessage struct {
+	From  string `json:"from"`
+	Value string `json:"value"`
+}
+
+// Export writes the sessions in the given format.
+func Export(w io.Writer, list []*Session, format string) error {
+	var doc any
+
+	switch format {
+	case FormatJSON:
+		doc = export{Version: exportVersion, Sessions: list}
+	case FormatShareGPT:
+		conversations := make([]shareGPTConversation, 0, len(list))
+		for _, s := range list {
+			conversations = append(conversations, toShareGPT(s))
+		}
+
+		doc = conversations
+	default:
+		return fmt.Errorf("unknown format %q, expected %s or %s", format, FormatJSON, FormatShareGPT)
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+
+	if err := encoder.Encode(doc); err != nil {
+		return fmt.Errorf("error writing sessions: %w", err)
+	}
+
+	return nil
+}
+
+// toShareGPT converts a session to a conversation, where a system message
+// precedes every prompt sent with another context than the one before.
+func toShareGPT(s *Session) shareGPTConversation {
+	conversation := shareGPTConversation{ID: s.ID}
+
+	for _, turn := range s.Turns {
+		if turn.Context != "" {
+			conversation.Conversations = append(conversation.Conversations,
+				shareGPTMessage{From: shareGPTSystem, Value: turn.Context})
+		}
+
+		conversation.Conversations = append(conversation.Conversations,
+			shareGPTMessage{From: shareGPTHuman, Value: turn.Prompt},
+			shareGPTMessage{From: shareGPTModel, Value: turn.Response})
+	}
+
+	return conversation
+}
+
+// Import reads sessions exported in either format, or the conversations.json
+// of a ChatGPT or Claude data export, telling them apart by their content.
+// Conversations in the ShareGPT format get new IDs.
+func Import(r io.Reader) ([]*Session, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("error reading sessions: %w", err)
+	}
+
+	data = bytes.TrimSpace(data)
+
+	switch {
+	case bytes.HasPrefix(data, []byte("{")):
+		var doc export
+		if err := json.Unmarshal(data, &doc); err != nil {
+			return nil, fmt.Errorf("error decoding sessions: %w", err)
+		}
+
+		if doc.Version != exportVersion || doc.Sessions == nil {
+			return nil, ErrUnknownFormat
+		}
+
+		for i, s := range doc.Sessions {
+			if s == nil || s.ID == "" {
+				return nil, fmt.Errorf("session %d has no id", i+1)
+			}
+
+			if strings.ContainsAny(s.ID, `/\`) || strings.HasPrefix(s.ID, ".") {
+				return nil, fmt.Errorf("session %d has an invalid id %q", i+1, s.ID)
+			}
+		}
+
+		return doc.Sessions, nil
+	case bytes.HasPrefix(data, []byte("[")):
+		return importConversations(data)
+	default:
+		return nil, ErrUnknownFormat
+	}
+}
+
+// importShareGPT converts the conversations of a ShareGPT file to sessions
+// with new IDs.
+func importShareGPT(data []byte) ([]*Session, error) {
+	var conversations []shareGPTConversation
+	if err := json.Unmarshal(data, &conversations); err != nil {
+		return nil, fmt.Errorf("error decoding conversations: %w", err)
+	}
+
+	list := make([]*Session, 0, len(conversations))
+	ids := make(map[string]bool, len(conversations))
+
+	for i, conversation := range conversations {
+		s, err := fromShareGPT(conversation)
+		if err != nil {
+			return nil, fmt.Errorf("conversation %d: %w", i+1, err)
+		}
+
+		// the IDs of sessions created in the same second only differ by a
+		// few random bytes
+		for ids[s.ID] {
+			s.ID = New().ID
+		}
+
+		ids[s.ID] = true
+		list = append(list, s)
+	}
+
+	return list, nil
+}
+
+func fromShareGPT(conversation shareGPTConversation) (*Session, error) {
+	messages := make([]message, 0, len(conversation.Conversations))
+
+	for _, m := range conversation.Conversations {
+		switch m.From {
+		case shareGPTSystem, "system_prompt":
+			messages = append(messages, message{role: roleSystem, text: m.Value})
+		case shareGPTHuman, "user":
+			messages = append(messages, message{role: roleUser, text: m.Value})
+		case shareGPTModel, "assistant", "bing", "chatgpt", "bard":
+			messages = append(messages, message{role: roleAssistant, text: m.Value})
+		default:
+			return nil, fmt.Errorf("unknown role %q", m.From)
+		}
+	}
+
+	s := New()
+	if err := addMessages(s, messages); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
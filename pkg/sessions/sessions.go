@@ -0,0 +1,275 @@
+// Package sessions keeps a history of chat sessions: the prompts, the
+// responses and the context they were sent with, so that a session can be
+// looked at or replayed later.
+package sessions
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	stderrors "errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/emilkje/cwc/pkg/encryption"
+)
+
+const (
+	// fileExt is the extension of the session files.
+	fileExt = ".json"
+	// idSuffixBytes is the number of random bytes in an ID, after the time.
+	idSuffixBytes = 2
+	// filePermissions keeps the sessions private, as they hold code.
+	filePermissions = 0o600
+	dirPermissions  = 0o700
+)
+
+// ErrNotFound is returned when no session matches an ID.
+var ErrNotFound = stderrors.New("session not found")
+
+// Turn is a prompt and its response.
+type Turn struct {
+	Prompt   string `json:"prompt"`
+	Response string `json:"response"`
+	// Context is the system message the prompt was sent with, when it differs
+	// from the one of the turn before.
+	Context string `json:"context,omitempty"`
+	// Model is the model that responded, if known.
+	Model string `json:"model,omitempty"`
+	// SystemFingerprint identifies the backend configuration that responded,
+	// if the provider tells, so that a deterministic run can be checked for
+	// having run on the same configuration.
+	SystemFingerprint string `json:"systemFingerprint,omitempty"`
+}
+
+// Session is a recorded conversation.
+type Session struct {
+	ID      string    `json:"id"`
+	Created time.Time `json:"created"`
+	Updated time.Time `json:"updated"`
+	// Name is the title of a conversation imported from another chat tool.
+	Name string `json:"name,omitempty"`
+	// ReplayOf is the ID of the session this one replays, if any.
+	ReplayOf string `json:"replayOf,omitempty"`
+	Turns    []Turn `json:"turns"`
+}
+
+// New creates an empty session with a new ID, which sorts by time.
+func New() *Session {
+	now := time.Now()
+
+	suffix := make([]byte, idSuffixBytes)
+	_, _ = rand.Read(suffix)
+
+	return &Session{
+		ID:      now.Format("20060102-150405") + "-" + hex.EncodeToString(suffix),
+		Created: now,
+		Updated: now,
+	}
+}
+
+// Add appends a turn sent with the given context.
+func (s *Session) Add(context string, turn Turn) {
+	turn.Context = ""
+	if context != s.Context(len(s.Turns)) {
+		turn.Context = context
+	}
+
+	s.Turns = append(s.Turns, turn)
+	s.Updated = time.Now()
+}
+
+// Context returns the context the turn at index i was sent with. An index
+// past the last turn gives the context of the last turn.
+func (s *Session) Context(i int) string {
+	for i = min(i, len(s.Turns)-1); i >= 0; i-- {
+		if s.Turns[i].Context != "" {
+			return s.Turns[i].Context
+		}
+	}
+
+	return ""
+}
+
+// Model returns the model of the latest turn that names one.
+func (s *Session) Model() string {
+	for i := len(s.Turns) - 1; i >= 0; i-- {
+		if s.Turns[i].Model != "" {
+			return s.Turns[i].Model
+		}
+	}
+
+	return ""
+}
+
+// Title returns the name of the session or else its first prompt, shortened
+// to a line, to tell the session apart in lists.
+func (s *Session) Title(maxLength int) string {
+	title := s.Name
+	if title == "" && len(s.Turns) > 0 {
+		title = s.Turns[0].Prompt
+	}
+
+	title = strings.Join(strings.Fields(title), " ")
+	if runes := []rune(title); len(runes) > maxLength {
+		title = string(runes[:maxLength-1]) + "…"
+	}
+
+	return title
+}
+
+// Store keeps the sessions as files in a directory.
+type Store struct {
+	dir string
+	// key encrypts the sessions when they are saved, if set.
+	key []byte
+}
+
+// NewStore creates a store keeping the sessions in dir, which is created
+// when the first session is saved.
+func NewStore(dir string) *Store {
+	return &Store{dir: dir}
+}
+
+// NewEncryptedStore creates a store that encrypts the sessions it saves with
+// key. Sessions saved before encryption was enabled can still be read, and
+// are encrypted the next time they are saved.
+func NewEncryptedStore(dir string, key []byte) *Store {
+	return &Store{dir: dir, key: key}
+}
+
+// Save writes the session, replacing an earlier version of it. Named
+// sessions are saved as <id>-<slug of the name>.json, so that the files tell
+// what they hold, and the file is renamed along with the session.
+func (st *Store) Save(s *Session) error {
+	if err := os.MkdirAll(st.dir, dirPermissions); err != nil {
+		return fmt.Errorf("error creating sessions directory: %w", err)
+	}
+
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding session: %w", err)
+	}
+
+	if st.key != nil {
+		if data, err = encryption.Seal(st.key, data); err != nil {
+			return fmt.Errorf("error encrypting session: %w", err)
+		}
+	}
+
+	name := s.ID
+	if slug := Slug(s.Name); slug != "" {
+		name += "-" + slug
+	}
+
+	// written to a temporary file first, so a session is never left half written
+	path := filepath.Join(st.dir, name+fileExt)
+	tmp := path + ".tmp"
+
+	if err := os.WriteFile(tmp, data, filePermissions); err != nil {
+		return fmt.Errorf("error writing session: %w", err)
+	}
+
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("error writing session: %w", err)
+	}
+
+	for _, previous := range st.files(s.ID) {
+		if previous != path {
+			_ = os.Remove(previous)
+		}
+	}
+
+	return nil
+}
+
+// files returns the files of the session with exactly the given ID, which
+// are more than one only while it is renamed.
+func (st *Store) files(id string) []string {
+	if strings.ContainsAny(id, `/\`) || id == "" {
+		return nil
+	}
+
+	var files []string
+
+	if _, err := os.Stat(filepath.Join(st.dir, id+fileExt)); err == nil {
+		files = append(files, filepath.Join(st.dir, id+fileExt))
+	}
+
+	named, _ := filepath.Glob(filepath.Join(st.dir, id+"-*"+fileExt))
+
+	return append(files, named...)
+}
+
+// Exists reports whether a session with exactly the given ID is saved.
+func (st *Store) Exists(id string) bool {
+	return len(st.files(id)) > 0
+}
+
+// Load reads the session with the given ID, or the only one whose ID starts
+// with it.
+func (st *Store) Load(id string) (*Session, error) {
+	if strings.ContainsAny(id, `/\`) || id == "" {
+		return nil, fmt.Errorf("%w: %q", ErrNotFound, id)
+	}
+
+	if files := st.files(id); len(files) > 0 {
+		return st.readSession(files[0])
+	}
+
+	matches, _ := filepath.Glob(filepath.Join(st.dir, id+"*"+fileExt))
+
+	switch len(matches) {
+	case 0:
+		return nil, fmt.Errorf("%w: %q", ErrNotFound, id)
+	case 1:
+		return st.readSession(matches[0])
+	default:
+		return nil, fmt.Errorf("%d sessions start with %q, give more of the ID", len(matches), id)
+	}
+}
+
+// List returns the sessions, the most recent first.
+func (st *Store) List() ([]*Session, error) {
+	paths, err := filepath.Glob(filepath.Join(st.dir, "*"+fileExt))
+	if err != nil {
+		return nil, fmt.Errorf("error listing sessions: %w", err)
+	}
+
+	list := make([]*Session, 0, len(paths))
+
+	for _, path := range paths {
+		s, err := st.readSession(path)
+		if err != nil {
+			return nil, err
+		}
+
+		list = append(list, s)
+	}
+
+	sort.Slice(list, func(i, j int) bool { return list[i].Created.After(list[j].Created) })
+
+	return list, nil
+}
+
+func (st *Store) readSession(path string) (*Session, error) {
+	data, err := os.ReadFile(path) // #nosec
+	if err != nil {
+		return nil, fmt.Errorf("error reading session: %w", err)
+	}
+
+	if data, err = encryption.Open(st.key, data); err != nil {
+		return nil, fmt.Errorf("error reading %s: %w", filepath.Base(path), err)
+	}
+
+	var s Session
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("error decoding %s: %w", filepath.Base(path), err)
+	}
+
+	return &s, nil
+}
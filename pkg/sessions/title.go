@@ -0,0 +1,86 @@
+package sessions
+
+import (
+	"strings"
+	"unicode"
+)
+
+const (
+	// titleWords is the number of words of the first prompt a heuristic
+	// title keeps.
+	titleWords = 8
+	// slugLength is the longest slug of a title in a file name.
+	slugLength = 40
+)
+
+// HeuristicTitle names a session after its first prompt: the first words of
+// its first line of prose, skipping code blocks and template expressions.
+func HeuristicTitle(prompt string) string {
+	inFence := false
+
+	for _, line := range strings.Split(prompt, "\n") {
+		line = strings.TrimSpace(line)
+
+		if strings.HasPrefix(line, "```") {
+			inFence = !inFence
+			continue
+		}
+
+		if inFence {
+			continue
+		}
+
+		line = strings.TrimLeft(line, "#>-*0123456789. ")
+
+		words := strings.Fields(line)
+		if len(words) == 0 {
+			continue
+		}
+
+		if len(words) > titleWords {
+			words = words[:titleWords]
+		}
+
+		return strings.TrimRight(strings.Join(words, " "), ".,;:!?")
+	}
+
+	return ""
+}
+
+// CleanTitle tidies a title written by a model, which tends to quote it or
+// end it with a period.
+func CleanTitle(title string) string {
+	title = strings.TrimSpace(strings.SplitN(strings.TrimSpace(title), "\n", 2)[0]) //nolint:gomnd
+	title = strings.TrimPrefix(title, "Title:")
+	title = strings.Trim(strings.TrimSpace(title), "\"'`*")
+
+	return strings.TrimRight(title, ".")
+}
+
+// Slug turns a title into lowercase words of letters and digits joined by
+// dashes, for file names.
+func Slug(title string) string {
+	var slug []rune
+
+	dash := false
+
+	for _, r := range strings.ToLower(title) {
+		if len(slug) >= slugLength {
+			break
+		}
+
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			dash = true
+			continue
+		}
+
+		if dash && len(slug) > 0 {
+			slug = append(slug, '-')
+		}
+
+		slug = append(slug, r)
+		dash = false
+	}
+
+	return string(slug)
+}
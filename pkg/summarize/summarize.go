@@ -0,0 +1,274 @@
+// Package summarize writes an overview of a repository too large to send to
+// the model at once. The files are split into parts that fit the context
+// window, keeping directories together, each part is summarized, and the
+// summaries are combined into the overview, in several rounds if need be.
+package summarize
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/emilkje/cwc/pkg/chat"
+	"github.com/emilkje/cwc/pkg/filetree"
+)
+
+// DefaultPartTokens fits a part and its summary in the context window of
+// most models.
+const DefaultPartTokens = 24000
+
+// sections are the headings of the overview, in order.
+var sections = []string{ //nolint:gochecknoglobals
+	"Purpose", "Entry points", "Key packages", "Build and test", "Notable patterns",
+}
+
+// Options configures a summary.
+type Options struct {
+	// Ask sends the request for a summary of a part to the model, with the
+	// files of the part as the system message, and returns the summary. The
+	// summaries are combined into the overview the same way, with them as
+	// the system message.
+	Ask func(systemMessage, prompt string) (string, error)
+	// Render turns the files of a part into the system message, typically
+	// with a chat.ContextBuilder.
+	Render func(files []filetree.File) string
+	// PartTokens is the size of the parts. Zero means DefaultPartTokens.
+	PartTokens int
+	// Map is an overview of the structure of the repository, such as the
+	// output of cwc map, given when the summaries are combined.
+	Map string
+	// OnProgress is called before each request with the number of requests
+	// done and the number known so far.
+	OnProgress func(done, total int)
+	// OnSkip is called for files too large to fit in a part.
+	OnSkip func(file filetree.File)
+}
+
+// Part is a set of files summarized together.
+type Part struct {
+	Files []filetree.File
+	// Dirs are the directories of the files, in order.
+	Dirs []string
+}
+
+func (p *Part) name() string {
+	return strings.Join(p.Dirs, ", ")
+}
+
+// Split groups the files by directory into parts of about maxTokens tokens.
+// Files are kept in order, and a directory is only split when it doesn't fit
+// in a part by itself. Files larger than a part are returned separately.
+func Split(files []filetree.File, maxTokens int) ([]Part, []filetree.File) {
+	var (
+		parts   []Part
+		skipped []filetree.File
+		current Part
+		tokens  int
+	)
+
+	flush := func() {
+		if len(current.Files) > 0 {
+			parts = append(parts, current)
+		}
+
+		current, tokens = Part{}, 0
+	}
+
+	for _, group := range byDir(files) {
+		size := 0
+		for _, file := range group {
+			size += chat.EstimateTokensForSize(file.Size)
+		}
+
+		// start a new part rather than split a directory that fits in one
+		if tokens > 0 && tokens+size > maxTokens && size <= maxTokens {
+			flush()
+		}
+
+		for _, file := range group {
+			fileTokens := chat.EstimateTokensForSize(file.Size)
+
+			if fileTokens > maxTokens {
+				skipped = append(skipped, file)
+				continue
+			}
+
+			if tokens+fileTokens > maxTokens {
+				flush()
+			}
+
+			dir := path.Dir(file.Path)
+			if len(current.Dirs) == 0 || current.Dirs[len(current.Dirs)-1] != dir {
+				current.Dirs = append(current.Dirs, dir)
+			}
+
+			current.Files = append(current.Files, file)
+			tokens += fileTokens
+		}
+	}
+
+	flush()
+
+	return parts, skipped
+}
+
+// byDir groups the files by directory, in the order the directories first
+// appear.
+func byDir(files []filetree.File) [][]filetree.File {
+	index := make(map[string]int)
+
+	var groups [][]filetree.File
+
+	for _, file := range files {
+		dir := path.Dir(file.Path)
+
+		i, ok := index[dir]
+		if !ok {
+			i = len(groups)
+			index[dir] = i
+			groups = append(groups, nil)
+		}
+
+		groups[i] = append(groups[i], file)
+	}
+
+	return groups
+}
+
+// Summarize returns the overview of the files as markdown, with sections on
+// the purpose, entry points, key packages, build and test commands and
+// notable patterns of the repository.
+func Summarize(files []filetree.File, opts *Options) (string, error) {
+	partTokens := opts.PartTokens
+	if partTokens <= 0 {
+		partTokens = DefaultPartTokens
+	}
+
+	parts, skipped := Split(files, partTokens)
+	if opts.OnSkip != nil {
+		for _, file := range skipped {
+			opts.OnSkip(file)
+		}
+	}
+
+	if len(parts) == 0 {
+		return "", errors.New("no files to summarize")
+	}
+
+	s := &summarizer{opts: opts, total: len(parts) + 1}
+
+	summaries := make([]string, 0, len(parts))
+
+	for i := range parts {
+		summary, err := s.ask(opts.Render(parts[i].Files), partPrompt(&parts[i]))
+		if err != nil {
+			return "", fmt.Errorf("error summarizing %s: %w", parts[i].name(), err)
+		}
+
+		summaries = append(summaries, "## "+parts[i].name()+"\n\n"+strings.TrimSpace(summary))
+	}
+
+	// combine the summaries in batches until they fit in a single request
+	for chat.EstimateTokens(strings.Join(summaries, "\n\n")+opts.Map) > partTokens && len(summaries) > 1 {
+		batches := Batch(summaries, partTokens)
+		if len(batches) == len(summaries) {
+			break
+		}
+
+		s.total += len(batches)
+		summaries = nil
+
+		for _, b := range batches {
+			combined, err := s.ask(chat.SystemMessage(strings.Join(b, "\n\n")), combinePrompt)
+			if err != nil {
+				return "", fmt.Errorf("error combining summaries: %w", err)
+			}
+
+			summaries = append(summaries, strings.TrimSpace(combined))
+		}
+	}
+
+	var context strings.Builder
+
+	if opts.Map != "" {
+		context.WriteString("Repository map:\n\n```\n" + opts.Map + "```\n\n")
+	}
+
+	context.WriteString("Summaries of the parts of the repository:\n\n" + strings.Join(summaries, "\n\n"))
+
+	overview, err := s.ask(chat.SystemMessage(context.String()), overviewPrompt())
+	if err != nil {
+		return "", fmt.Errorf("error writing the overview: %w", err)
+	}
+
+	return strings.TrimSpace(overview) + "\n", nil
+}
+
+type summarizer struct {
+	opts  *Options
+	done  int
+	total int
+}
+
+func (s *summarizer) ask(systemMessage, prompt string) (string, error) {
+	if s.opts.OnProgress != nil {
+		s.opts.OnProgress(s.done, s.total)
+	}
+
+	reply, err := s.opts.Ask(systemMessage, prompt)
+	s.done++
+
+	return reply, err
+}
+
+// Batch groups the summaries into batches of about maxTokens tokens.
+func Batch(summaries []string, maxTokens int) [][]string {
+	var (
+		batches [][]string
+		tokens  int
+	)
+
+	for _, summary := range summaries {
+		size := chat.EstimateTokens(summary)
+
+		if len(batches) == 0 || tokens+size > maxTokens {
+			batches = append(batches, nil)
+			tokens = 0
+		}
+
+		batches[len(batches)-1] = append(batches[len(batches)-1], summary)
+		tokens += size
+	}
+
+	return batches
+}
+
+func partPrompt(part *Part) string {
+	return "Summarize the files in " + part.name() + " for a developer new to the repository, in at most 300 " +
+		"words of markdown without headings. Cover what the code is for, its main types and functions, " +
+		"any entry points such as main packages, commands or servers, any build, test or deployment " +
+		"commands found in scripts, manifests or CI files, and conventions worth following. " +
+		"Name files and symbols exactly as they appear."
+}
+
+const combinePrompt = "Combine the summaries above into one summary of at most 500 words of markdown. " +
+	"Keep the headings naming the directories, the entry points, the build and test commands, and the names " +
+	"of files and symbols."
+
+func overviewPrompt() string {
+	headings := make([]string, len(sections))
+	for i, section := range sections {
+		headings[i] = "## " + section
+	}
+
+	return "Write an architecture overview of the repository for onboarding new team members, in markdown. " +
+		"Start with the heading \"# Architecture\", followed by these sections, in order: " +
+		strings.Join(headings, ", ") + ". " +
+		"Under Purpose, say what the project does and for whom. Under Entry points, list the commands, main " +
+		"packages or servers and the files they start in. Under Key packages, list the most important " +
+		"directories with a sentence each. Under Build and test, give the commands as code blocks, but only " +
+		"those found in the summaries. Under Notable patterns, describe the conventions and design decisions " +
+		"a contributor should follow. Refer to files and symbols by their exact names, and don't make up " +
+		"anything the summaries don't support."
+}
@@ -0,0 +1,166 @@
+package telemetry
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	exportTimeout  = 5 * time.Second
+	maxErrorBody   = 512
+	statusCodeErr  = 2
+	instrumentName = "github.com/emilkje/cwc"
+)
+
+// exporter posts spans to a collector in the JSON encoding of OTLP/HTTP,
+// which every collector accepts, so no protobuf or gRPC dependency is needed.
+type exporter struct {
+	client *http.Client
+	config Config
+}
+
+func newExporter(cfg Config) *exporter {
+	// deliberately not the shared client of the API, so that exports are
+	// neither traced, audited nor recorded to a cassette themselves
+	return &exporter{client: &http.Client{Timeout: exportTimeout}, config: cfg}
+}
+
+type otlpValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	IntValue    *string  `json:"intValue,omitempty"`
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+}
+
+type otlpAttribute struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpSpan struct {
+	TraceID           string          `json:"traceId"`
+	SpanID            string          `json:"spanId"`
+	ParentSpanID      string          `json:"parentSpanId,omitempty"`
+	Name              string          `json:"name"`
+	Kind              spanKind        `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	Status            otlpStatus      `json:"status"`
+}
+
+func (e *exporter) export(ctx context.Context, spans []*Span) error {
+	if len(spans) == 0 {
+		return nil
+	}
+
+	body, err := json.Marshal(e.payload(spans))
+	if err != nil {
+		return fmt.Errorf("error encoding spans: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.config.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("error creating trace export request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	for key, value := range e.config.Headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error exporting traces: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+		return fmt.Errorf("trace collector responded with %s: %s", resp.Status, strings.TrimSpace(string(detail)))
+	}
+
+	return nil
+}
+
+func (e *exporter) payload(spans []*Span) map[string]any {
+	converted := make([]otlpSpan, 0, len(spans))
+
+	for _, span := range spans {
+		span.mu.Lock()
+
+		s := otlpSpan{
+			TraceID:           span.traceID,
+			SpanID:            span.spanID,
+			ParentSpanID:      span.parentID,
+			Name:              span.name,
+			Kind:              span.kind,
+			StartTimeUnixNano: strconv.FormatInt(span.start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(span.end.UnixNano(), 10),
+			Attributes:        convertAttributes(span.attrs),
+		}
+
+		if span.err != nil {
+			s.Status = otlpStatus{Code: statusCodeErr, Message: span.err.Error()}
+		}
+
+		span.mu.Unlock()
+
+		converted = append(converted, s)
+	}
+
+	resource := []Attribute{String("service.name", e.config.ServiceName)}
+
+	return map[string]any{
+		"resourceSpans": []map[string]any{{
+			"resource": map[string]any{"attributes": convertAttributes(resource)},
+			"scopeSpans": []map[string]any{{
+				"scope": map[string]any{"name": instrumentName},
+				"spans": converted,
+			}},
+		}},
+	}
+}
+
+func convertAttributes(attrs []Attribute) []otlpAttribute {
+	converted := make([]otlpAttribute, 0, len(attrs))
+
+	for _, attr := range attrs {
+		var value otlpValue
+
+		switch v := attr.Value.(type) {
+		case string:
+			value.StringValue = &v
+		case int:
+			s := strconv.Itoa(v)
+			value.IntValue = &s
+		case int64:
+			s := strconv.FormatInt(v, 10)
+			value.IntValue = &s
+		case float64:
+			value.DoubleValue = &v
+		case bool:
+			value.BoolValue = &v
+		default:
+			s := fmt.Sprint(v)
+			value.StringValue = &s
+		}
+
+		converted = append(converted, otlpAttribute{Key: attr.Key, Value: value})
+	}
+
+	return converted
+}
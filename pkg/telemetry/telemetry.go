@@ -0,0 +1,270 @@
+// Package telemetry traces where the time of a run of cwc goes, such as
+// gathering files, counting tokens and each request to a provider, and
+// exports the spans to an OpenTelemetry collector over OTLP/HTTP. The spans
+// of a run share a root span named after the command, which continues the
+// trace in the TRACEPARENT environment variable if set, so that cwc shows up
+// inside the traces of the automation running it.
+package telemetry
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxBufferedSpans is the number of ended spans after which they are
+// exported without waiting for Stop, as in long chat sessions.
+const maxBufferedSpans = 256
+
+// Config tells where the spans are exported to.
+type Config struct {
+	// Endpoint is the URL spans are posted to, e.g.
+	// http://localhost:4318/v1/traces.
+	Endpoint string
+	// Headers are sent with every export, e.g. for authentication.
+	Headers     map[string]string
+	ServiceName string
+}
+
+// Attribute is a key and a string, integer, float or boolean value.
+type Attribute struct {
+	Key   string
+	Value any
+}
+
+// String creates a string attribute.
+func String(key, value string) Attribute {
+	return Attribute{Key: key, Value: value}
+}
+
+// Int creates an integer attribute.
+func Int(key string, value int) Attribute {
+	return Attribute{Key: key, Value: value}
+}
+
+type spanKind int
+
+const (
+	kindInternal spanKind = 1
+	kindClient   spanKind = 3
+)
+
+// Span is an operation with a start and an end. The methods of a nil span do
+// nothing, which is what StartSpan returns while tracing is off.
+type Span struct {
+	mu       sync.Mutex
+	tracer   *tracer
+	name     string
+	kind     spanKind
+	traceID  string
+	spanID   string
+	parentID string
+	start    time.Time
+	end      time.Time
+	attrs    []Attribute
+	err      error
+}
+
+type tracer struct {
+	sync.Mutex
+	exporter *exporter
+	root     *Span
+	ended    []*Span
+	exports  sync.WaitGroup
+	// exportErr is the first error of the exports made before Stop.
+	exportErr error
+}
+
+var active struct { //nolint:gochecknoglobals
+	sync.Mutex
+	tracer *tracer
+}
+
+// Start begins tracing a run of the command with the given name. Until Start
+// is called, StartSpan returns nil spans and nothing is recorded.
+func Start(cfg Config, command string) {
+	t := &tracer{exporter: newExporter(cfg)}
+
+	traceID, parentID := parseTraceparent(os.Getenv("TRACEPARENT"))
+	if traceID == "" {
+		traceID = randomID(16) //nolint:gomnd
+	}
+
+	t.root = &Span{
+		tracer:   t,
+		name:     command,
+		kind:     kindInternal,
+		traceID:  traceID,
+		spanID:   randomID(8), //nolint:gomnd
+		parentID: parentID,
+		start:    time.Now(),
+	}
+
+	active.Lock()
+	active.tracer = t
+	active.Unlock()
+}
+
+// Stop ends the root span and exports the spans not exported yet.
+func Stop(ctx context.Context) error {
+	active.Lock()
+	t := active.tracer
+	active.tracer = nil
+	active.Unlock()
+
+	if t == nil {
+		return nil
+	}
+
+	t.root.End()
+	t.exports.Wait()
+
+	t.Lock()
+	spans, exportErr := t.ended, t.exportErr
+	t.ended = nil
+	t.Unlock()
+
+	if err := t.exporter.export(ctx, spans); err != nil {
+		return err
+	}
+
+	return exportErr
+}
+
+func current() *tracer {
+	active.Lock()
+	defer active.Unlock()
+
+	return active.tracer
+}
+
+// StartSpan starts a span under the root span of the run.
+func StartSpan(name string, attrs ...Attribute) *Span {
+	return startSpan(name, kindInternal, attrs)
+}
+
+// RecordSpan adds a span for an operation that was timed elsewhere and ended
+// just now.
+func RecordSpan(name string, duration time.Duration) {
+	if span := StartSpan(name); span != nil {
+		span.start = time.Now().Add(-duration)
+		span.End()
+	}
+}
+
+func startSpan(name string, kind spanKind, attrs []Attribute) *Span {
+	t := current()
+	if t == nil {
+		return nil
+	}
+
+	return &Span{
+		tracer:   t,
+		name:     name,
+		kind:     kind,
+		traceID:  t.root.traceID,
+		spanID:   randomID(8), //nolint:gomnd
+		parentID: t.root.spanID,
+		start:    time.Now(),
+		attrs:    attrs,
+	}
+}
+
+// SetAttributes adds attributes to the span.
+func (s *Span) SetAttributes(attrs ...Attribute) {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	s.attrs = append(s.attrs, attrs...)
+	s.mu.Unlock()
+}
+
+// SetError marks the span as failed.
+func (s *Span) SetError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+
+	s.mu.Lock()
+	s.err = err
+	s.mu.Unlock()
+}
+
+// End ends the span. Only the first call has an effect.
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	if !s.end.IsZero() {
+		s.mu.Unlock()
+		return
+	}
+
+	s.end = time.Now()
+	s.mu.Unlock()
+
+	s.tracer.add(s)
+}
+
+// traceparent formats the span as a W3C traceparent header.
+func (s *Span) traceparent() string {
+	return "00-" + s.traceID + "-" + s.spanID + "-01"
+}
+
+func (t *tracer) add(span *Span) {
+	t.Lock()
+	t.ended = append(t.ended, span)
+
+	if len(t.ended) < maxBufferedSpans || span == t.root {
+		t.Unlock()
+		return
+	}
+
+	spans := t.ended
+	t.ended = nil
+	t.Unlock()
+
+	t.exports.Add(1)
+
+	go func() {
+		defer t.exports.Done()
+
+		if err := t.exporter.export(context.Background(), spans); err != nil {
+			t.Lock()
+			if t.exportErr == nil {
+				t.exportErr = err
+			}
+			t.Unlock()
+		}
+	}()
+}
+
+// parseTraceparent returns the trace and parent span IDs of a W3C
+// traceparent header, or empty strings if it isn't valid.
+func parseTraceparent(header string) (string, string) {
+	parts := strings.Split(strings.TrimSpace(header), "-")
+	if len(parts) != 4 || len(parts[1]) != 32 || len(parts[2]) != 16 { //nolint:gomnd
+		return "", ""
+	}
+
+	if _, err := hex.DecodeString(parts[1] + parts[2]); err != nil {
+		return "", ""
+	}
+
+	return strings.ToLower(parts[1]), strings.ToLower(parts[2])
+}
+
+func randomID(bytes int) string {
+	id := make([]byte, bytes)
+	_, _ = rand.Read(id)
+
+	return hex.EncodeToString(id)
+}
@@ -0,0 +1,81 @@
+package telemetry
+
+import (
+	"io"
+	"net/http"
+	"sync"
+)
+
+// Transport adds a span for every request made through base, which is
+// http.DefaultTransport if nil, and passes the trace on to the server in the
+// traceparent header. The span of a streamed response ends once its body is
+// read and closed, so it covers the whole of the generation.
+func Transport(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	return &transport{base: base}
+}
+
+type transport struct {
+	base http.RoundTripper
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	span := startSpan(req.Method+" "+req.URL.Path, kindClient, []Attribute{
+		String("http.request.method", req.Method),
+		String("server.address", req.URL.Hostname()),
+		String("url.path", req.URL.Path),
+	})
+	if span == nil {
+		return t.base.RoundTrip(req) //nolint:wrapcheck
+	}
+
+	if req.ContentLength > 0 {
+		span.SetAttributes(Int("http.request.body.size", int(req.ContentLength)))
+	}
+
+	// the request must not be modified, see http.RoundTripper
+	req = req.Clone(req.Context())
+	req.Header.Set("traceparent", span.traceparent())
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		span.SetError(err)
+		span.End()
+
+		return nil, err //nolint:wrapcheck
+	}
+
+	span.SetAttributes(Int("http.response.status_code", resp.StatusCode))
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		span.SetError(&statusError{status: resp.Status})
+	}
+
+	resp.Body = &spanBody{ReadCloser: resp.Body, span: span}
+
+	return resp, nil
+}
+
+type statusError struct {
+	status string
+}
+
+func (e *statusError) Error() string {
+	return e.status
+}
+
+// spanBody ends the span of a request when its response is closed.
+type spanBody struct {
+	io.ReadCloser
+	span *Span
+	once sync.Once
+}
+
+func (b *spanBody) Close() error {
+	b.once.Do(b.span.End)
+
+	return b.ReadCloser.Close() //nolint:wrapcheck
+}
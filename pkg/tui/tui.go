@@ -0,0 +1,700 @@
+package tui
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/spinner"
+	"github.com/charmbracelet/bubbles/textarea"
+	"github.com/charmbracelet/bubbles/viewport"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/muesli/termenv"
+	"github.com/sashabaranov/go-openai"
+
+	"github.com/emilkje/cwc/pkg/chat"
+	"github.com/emilkje/cwc/pkg/filetree"
+	"github.com/emilkje/cwc/pkg/highlight"
+	"github.com/emilkje/cwc/pkg/providers"
+	"github.com/emilkje/cwc/pkg/ui"
+)
+
+const (
+	inputHeight     = 3
+	sidebarMaxWidth = 40
+)
+
+// Options configures a TUI chat session.
+type Options struct {
+	Provider       providers.Provider
+	SystemMessage  string
+	Files          []filetree.File
+	InitialMessage string
+	// ShowStats shows the token usage, cost and latency below each response.
+	ShowStats bool
+	// RedactPrompt masks sensitive data in messages before they are sent. The
+	// transcript shows the masked message, so the user sees what was sent.
+	RedactPrompt func(string) string
+	// Parameters pins the sampling parameters of the requests.
+	Parameters chat.Parameters
+	// Prefill begins every response, see chat.Chat.SetPrefill.
+	Prefill string
+	// ErrorGuidance suggests what to do about a failed request, if anything.
+	ErrorGuidance func(error) string
+	// ContextTrimmer shrinks the context when a request exceeds the context
+	// window.
+	ContextTrimmer chat.ContextTrimmer
+	// Tools are offered to the model.
+	Tools []chat.Tool
+	// PreSend may rewrite a message before it is redacted and sent, or stop
+	// it from being sent by returning an error.
+	PreSend func(string) (string, error)
+	// PostResponse is called with each message and its complete response.
+	PostResponse func(prompt, response string) error
+}
+
+// Run starts the full-screen chat interface and blocks until the user exits.
+func Run(opts *Options) error {
+	if !ui.VirtualTerminalSupported() {
+		return errors.New("the full-screen interface requires a terminal with support for ANSI escape sequences")
+	}
+
+	m := newModel(opts)
+
+	if !m.colors {
+		lipgloss.SetColorProfile(termenv.Ascii)
+	}
+
+	program := tea.NewProgram(m, tea.WithAltScreen(), tea.WithMouseCellMotion())
+
+	m.chat = chat.NewChat(opts.Provider, opts.SystemMessage, func(chunk *chat.ConversationChunk) {
+		program.Send(chunkMsg{chunk: chunk})
+	})
+	m.chat.SetParameters(opts.Parameters)
+	m.chat.SetPrefill(opts.Prefill)
+	m.chat.SetContextTrimmer(opts.ContextTrimmer)
+	m.chat.SetTools(opts.Tools)
+
+	_, err := program.Run()
+	if err != nil {
+		return fmt.Errorf("error running tui: %w", err)
+	}
+
+	return nil
+}
+
+type chunkMsg struct {
+	chunk *chat.ConversationChunk
+}
+
+type entry struct {
+	role    string
+	content strings.Builder
+	isError bool
+	// isNotice entries tell about something done on the user's behalf and
+	// are shown dim without a label.
+	isNotice bool
+	stats    *chat.TurnStats
+}
+
+type sidebarFile struct {
+	path   string
+	tokens int
+}
+
+type model struct {
+	chat         *chat.Chat
+	conversation *chat.Conversation
+
+	viewport viewport.Model
+	input    textarea.Model
+	spinner  spinner.Model
+
+	transcript []*entry
+	files      []sidebarFile
+	totalToken int
+	totals     chat.TurnStats
+	showStats  bool
+
+	redactPrompt  func(string) string
+	errorGuidance func(error) string
+	preSend       func(string) (string, error)
+	postResponse  func(prompt, response string) error
+
+	// prompt and reply are the latest message and its response.
+	prompt string
+	reply  strings.Builder
+
+	history    []string
+	historyIdx int
+
+	initialMessage string
+	theme          ui.Theme
+	styles         styles
+	keys           ui.KeyMap
+	colors         bool
+	showSidebar    bool
+	busy           bool
+	waiting        bool
+	sentAt         time.Time
+	ready          bool
+	width          int
+	height         int
+}
+
+var (
+	dimStyle     = lipgloss.NewStyle().Foreground(lipgloss.Color("8"))
+	sidebarStyle = lipgloss.NewStyle().
+			Border(lipgloss.NormalBorder(), false, true, false, false).
+			BorderForeground(lipgloss.Color("8")).
+			PaddingRight(1)
+)
+
+// styles are the styles of the transcript in the colors of the theme.
+type styles struct {
+	user      lipgloss.Style
+	assistant lipgloss.Style
+	error     lipgloss.Style
+}
+
+func newStyles(theme ui.Theme) styles {
+	return styles{
+		user:      themeStyle(theme.Notice).Bold(true),
+		assistant: themeStyle(theme.Success).Bold(true),
+		error:     themeStyle(theme.Error),
+	}
+}
+
+// themeStyle returns a style in a color of the theme, or without a color if
+// the theme leaves it empty.
+func themeStyle(sequence string) lipgloss.Style {
+	style := lipgloss.NewStyle()
+
+	if color, ok := lipglossColor(sequence); ok {
+		style = style.Foreground(color)
+	}
+
+	return style
+}
+
+// lipglossColor converts a color of the theme, an ANSI escape sequence as
+// returned by ui.ParseColor, into a lipgloss color.
+func lipglossColor(sequence string) (lipgloss.Color, bool) { //nolint:gomnd,cyclop
+	params, ok := strings.CutPrefix(sequence, "\033[")
+	if !ok {
+		return "", false
+	}
+
+	params, ok = strings.CutSuffix(params, "m")
+	if !ok {
+		return "", false
+	}
+
+	fields := strings.Split(params, ";")
+	codes := make([]int, 0, len(fields))
+
+	for _, field := range fields {
+		code, err := strconv.Atoi(field)
+		if err != nil {
+			return "", false
+		}
+
+		codes = append(codes, code)
+	}
+
+	switch {
+	case len(codes) == 1 && codes[0] >= 30 && codes[0] <= 37:
+		return lipgloss.Color(strconv.Itoa(codes[0] - 30)), true
+	case len(codes) == 1 && codes[0] >= 90 && codes[0] <= 97:
+		return lipgloss.Color(strconv.Itoa(codes[0] - 90 + 8)), true
+	case len(codes) == 3 && codes[0] == 38 && codes[1] == 5:
+		return lipgloss.Color(strconv.Itoa(codes[2])), true
+	case len(codes) == 5 && codes[0] == 38 && codes[1] == 2:
+		return lipgloss.Color(fmt.Sprintf("#%02x%02x%02x", codes[2], codes[3], codes[4])), true
+	}
+
+	return "", false
+}
+
+func newModel(opts *Options) *model {
+	input := textarea.New()
+	input.Placeholder = ui.T("tui.placeholder")
+	input.ShowLineNumbers = false
+	input.Prompt = ui.ToASCII("┃ ")
+	input.SetHeight(inputHeight)
+	input.CharLimit = 0
+	keys := ui.CurrentKeyMap()
+	input.KeyMap.InsertNewline = key.NewBinding(key.WithKeys(keys.Newline...))
+	input.Focus()
+
+	files := make([]sidebarFile, 0, len(opts.Files))
+	total := 0
+
+	for _, file := range opts.Files {
+		tokens := chat.EstimateTokensForSize(file.Size)
+		total += tokens
+		files = append(files, sidebarFile{path: file.Path, tokens: tokens})
+	}
+
+	theme := ui.CurrentTheme()
+
+	return &model{
+		input:          input,
+		keys:           keys,
+		spinner:        newSpinner(),
+		files:          files,
+		totalToken:     total,
+		initialMessage: opts.InitialMessage,
+		theme:          theme,
+		styles:         newStyles(theme),
+		colors:         ui.ColorsEnabled(),
+		showSidebar:    true,
+		showStats:      opts.ShowStats,
+		redactPrompt:   opts.RedactPrompt,
+		errorGuidance:  opts.ErrorGuidance,
+		preSend:        opts.PreSend,
+		postResponse:   opts.PostResponse,
+	}
+}
+
+func (m *model) Init() tea.Cmd {
+	cmds := []tea.Cmd{textarea.Blink}
+
+	if m.initialMessage != "" {
+		msg := m.initialMessage
+		cmds = append(cmds, func() tea.Msg { return submitMsg{text: msg} })
+	}
+
+	return tea.Batch(cmds...)
+}
+
+type submitMsg struct {
+	text string
+}
+
+// editedMsg carries the message written in the editor of the user.
+type editedMsg struct {
+	text string
+	err  error
+}
+
+// hookErrMsg reports a failed post-response hook.
+type hookErrMsg struct {
+	err error
+}
+
+func (m *model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	var cmds []tea.Cmd
+
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.width, m.height = msg.Width, msg.Height
+		m.layout()
+	case tea.KeyMsg:
+		pressed := msg.String()
+
+		switch {
+		case ui.Matches(pressed, m.keys.Cancel):
+			if m.busy {
+				m.conversation.Cancel()
+				return m, nil
+			}
+
+			return m, tea.Quit
+		case ui.Matches(pressed, m.keys.Sidebar):
+			m.showSidebar = !m.showSidebar
+			m.layout()
+
+			return m, nil
+		case ui.Matches(pressed, m.keys.Submit):
+			text := strings.TrimSpace(m.input.Value())
+			if text == "" {
+				return m, nil
+			}
+
+			return m, func() tea.Msg { return submitMsg{text: text} }
+		case ui.Matches(pressed, m.keys.Editor):
+			return m, m.openEditor()
+		case ui.Matches(pressed, m.keys.ScrollUp):
+			m.viewport.ViewUp()
+			return m, nil
+		case ui.Matches(pressed, m.keys.ScrollDown):
+			m.viewport.ViewDown()
+			return m, nil
+		case pressed == "up":
+			if m.input.Line() == 0 && m.recallHistory(-1) {
+				return m, nil
+			}
+		case pressed == "down":
+			if m.input.Line() == m.input.LineCount()-1 && m.recallHistory(1) {
+				return m, nil
+			}
+		}
+	case tea.MouseMsg:
+		var cmd tea.Cmd
+		m.viewport, cmd = m.viewport.Update(msg)
+
+		return m, cmd
+	case spinner.TickMsg:
+		if !m.waiting {
+			return m, nil
+		}
+
+		var cmd tea.Cmd
+		m.spinner, cmd = m.spinner.Update(msg)
+
+		return m, cmd
+	case submitMsg:
+		return m, m.submit(msg.text)
+	case chunkMsg:
+		return m, m.handleChunk(msg.chunk)
+	case hookErrMsg:
+		m.addNotice(msg.err.Error())
+		return m, nil
+	case editedMsg:
+		if msg.err != nil {
+			m.addNotice(msg.err.Error())
+			return m, nil
+		}
+
+		m.input.SetValue(msg.text)
+
+		return m, nil
+	}
+
+	var cmd tea.Cmd
+	m.input, cmd = m.input.Update(msg)
+	cmds = append(cmds, cmd)
+
+	return m, tea.Batch(cmds...)
+}
+
+// openEditor suspends the interface while the message is edited in the
+// editor of the user. The edited message replaces the input, to be sent with
+// the submit key.
+func (m *model) openEditor() tea.Cmd {
+	cmd, path, err := ui.EditorFile(m.input.Value())
+	if err != nil {
+		return func() tea.Msg { return editedMsg{err: err} }
+	}
+
+	return tea.ExecProcess(cmd, func(err error) tea.Msg {
+		if err != nil {
+			_ = os.Remove(path)
+			return editedMsg{err: fmt.Errorf("error running editor: %w", err)}
+		}
+
+		text, err := ui.ReadEditorFile(path)
+
+		return editedMsg{text: text, err: err}
+	})
+}
+
+func (m *model) submit(text string) tea.Cmd {
+	if text == "/exit" {
+		return tea.Quit
+	}
+
+	if text == "/stats" {
+		m.input.Reset()
+		m.showStats = !m.showStats
+		m.refresh()
+
+		return nil
+	}
+
+	if m.busy {
+		return nil
+	}
+
+	m.input.Reset()
+	m.history = append(m.history, text)
+	m.historyIdx = len(m.history)
+
+	if m.preSend != nil {
+		rewritten, err := m.preSend(text)
+		if err != nil {
+			m.addNotice("not sending the message: " + err.Error())
+			return nil
+		}
+
+		text = rewritten
+	}
+
+	if m.redactPrompt != nil {
+		text = m.redactPrompt(text)
+	}
+
+	m.prompt = text
+	m.reply.Reset()
+
+	user := &entry{role: openai.ChatMessageRoleUser}
+	user.content.WriteString(text)
+	m.transcript = append(m.transcript, user)
+	m.busy = true
+	m.waiting = true
+	m.sentAt = time.Now()
+
+	if m.conversation == nil {
+		m.conversation = m.chat.BeginConversation(text)
+	} else {
+		m.conversation.Reply(text)
+	}
+
+	m.refresh()
+
+	return m.spinner.Tick
+}
+
+func (m *model) handleChunk(chunk *chat.ConversationChunk) tea.Cmd {
+	if chunk.IsInitialChunk {
+		m.transcript = append(m.transcript, &entry{role: openai.ChatMessageRoleAssistant})
+		m.refresh()
+
+		return nil
+	}
+
+	if chunk.Notice != "" {
+		m.addNotice(chunk.Notice)
+		return nil
+	}
+
+	m.waiting = false
+
+	if chunk.IsErrorChunk {
+		m.transcript = append(m.transcript, &entry{role: openai.ChatMessageRoleAssistant, isError: true})
+	}
+
+	if len(m.transcript) > 0 {
+		m.transcript[len(m.transcript)-1].content.WriteString(chunk.Content)
+
+		if chunk.IsErrorChunk && m.errorGuidance != nil {
+			if guidance := m.errorGuidance(chunk.Err); guidance != "" {
+				m.transcript[len(m.transcript)-1].content.WriteString("\n\n" + guidance)
+			}
+		}
+	}
+
+	if chunk.Stats != nil && len(m.transcript) > 0 {
+		m.transcript[len(m.transcript)-1].stats = chunk.Stats
+		m.totals.Add(*chunk.Stats)
+	}
+
+	if !chunk.IsErrorChunk {
+		m.reply.WriteString(chunk.Content)
+	}
+
+	m.refresh()
+
+	if !chunk.IsFinalChunk {
+		return nil
+	}
+
+	m.busy = false
+	ui.NotifyIfSlow(m.sentAt, "the response is ready")
+
+	if chunk.IsErrorChunk || m.postResponse == nil {
+		return nil
+	}
+
+	prompt, response, postResponse := m.prompt, m.reply.String(), m.postResponse
+
+	return func() tea.Msg {
+		if err := postResponse(prompt, response); err != nil {
+			return hookErrMsg{err: err}
+		}
+
+		return nil
+	}
+}
+
+// addNotice adds a dim line to the transcript.
+func (m *model) addNotice(text string) {
+	notice := &entry{role: openai.ChatMessageRoleAssistant, isNotice: true}
+	notice.content.WriteString(text)
+	m.transcript = append(m.transcript, notice)
+	m.refresh()
+}
+
+// recallHistory moves through previously submitted prompts. It returns false
+// when there is nothing to recall in the given direction.
+func (m *model) recallHistory(direction int) bool {
+	next := m.historyIdx + direction
+	if next < 0 || next > len(m.history) || len(m.history) == 0 {
+		return false
+	}
+
+	m.historyIdx = next
+
+	if next == len(m.history) {
+		m.input.Reset()
+		return true
+	}
+
+	m.input.SetValue(m.history[next])
+
+	return true
+}
+
+func (m *model) layout() {
+	sidebarWidth := m.sidebarWidth()
+	contentWidth := m.width - sidebarWidth
+	contentHeight := m.height - inputHeight - 2 // leave room for the status line and input padding
+
+	if !m.ready {
+		m.viewport = viewport.New(contentWidth, contentHeight)
+		m.ready = true
+	} else {
+		m.viewport.Width = contentWidth
+		m.viewport.Height = contentHeight
+	}
+
+	m.input.SetWidth(m.width)
+	m.refresh()
+}
+
+func (m *model) sidebarWidth() int {
+	if !m.showSidebar {
+		return 0
+	}
+
+	return min(m.width/3, sidebarMaxWidth)
+}
+
+// refresh re-renders the transcript into the viewport, following the output
+// if the user has not scrolled away from the bottom.
+func (m *model) refresh() {
+	if !m.ready {
+		return
+	}
+
+	follow := m.viewport.AtBottom()
+
+	wrap := lipgloss.NewStyle().Width(m.viewport.Width)
+
+	var content strings.Builder
+
+	for _, e := range m.transcript {
+		if e.isNotice {
+			content.WriteString(wrap.Render(dimStyle.Render(ui.ToASCII(e.content.String()))) + "\n\n")
+			continue
+		}
+
+		label := m.label(e.role)
+
+		body := e.content.String()
+
+		switch {
+		case e.isError:
+			body = m.styles.error.Render(body)
+		case e.role == openai.ChatMessageRoleAssistant:
+			body = highlight.Render(body, m.viewport.Width, m.colors)
+		}
+
+		content.WriteString(label + "\n")
+		content.WriteString(wrap.Render(body) + "\n")
+
+		if m.showStats && e.stats != nil {
+			content.WriteString(dimStyle.Render(ui.ToASCII(e.stats.String())) + "\n")
+		}
+
+		content.WriteString("\n")
+	}
+
+	m.viewport.SetContent(content.String())
+
+	if follow {
+		m.viewport.GotoBottom()
+	}
+}
+
+func (m *model) renderSidebar() string {
+	width := m.sidebarWidth() - 2 // account for border and padding
+
+	var sidebar strings.Builder
+
+	sidebar.WriteString(lipgloss.NewStyle().Bold(true).Render("Context") + "\n")
+	sidebar.WriteString(dimStyle.Render(ui.ToASCII(fmt.Sprintf("%d files · ~%d tokens", len(m.files), m.totalToken))) + "\n")
+
+	if m.showStats && m.totals.Turns > 0 {
+		sidebar.WriteString(dimStyle.Render(ui.ToASCII(fmt.Sprintf("%d turns · %s", m.totals.Turns, m.totals.String()))) + "\n")
+	}
+
+	sidebar.WriteString("\n")
+
+	for _, file := range m.files {
+		tokens := fmt.Sprintf(" %d", file.tokens)
+		name := truncateLeft(file.path, width-len(tokens))
+		sidebar.WriteString(name + dimStyle.Render(tokens) + "\n")
+	}
+
+	return sidebarStyle.
+		Width(width).
+		Height(m.viewport.Height).
+		MaxHeight(m.viewport.Height).
+		Render(sidebar.String())
+}
+
+func (m *model) View() string {
+	if !m.ready {
+		return "initializing..."
+	}
+
+	main := m.viewport.View()
+	if m.showSidebar {
+		main = lipgloss.JoinHorizontal(lipgloss.Top, m.renderSidebar(), main)
+	}
+
+	status := ui.ToASCII(ui.T("tui.keys"))
+	if m.waiting {
+		elapsed := time.Since(m.sentAt).Seconds()
+		status = fmt.Sprintf("%s %s %.1fs %s %s", m.spinner.View(), ui.T("chat.thinking"), elapsed, ui.ToASCII("·"), status)
+	}
+
+	return lipgloss.JoinVertical(lipgloss.Left,
+		main,
+		dimStyle.Render(status),
+		m.input.View(),
+	)
+}
+
+func (m *model) label(role string) string {
+	if role == openai.ChatMessageRoleUser {
+		if ui.ASCIIMode() {
+			return m.styles.user.Render(m.theme.UserGlyph + ":")
+		}
+
+		return m.styles.user.Render(m.theme.UserGlyph + " you")
+	}
+
+	if ui.ASCIIMode() {
+		return m.styles.assistant.Render(m.theme.AssistantGlyph + ":")
+	}
+
+	return m.styles.assistant.Render(m.theme.AssistantGlyph + " assistant")
+}
+
+func newSpinner() spinner.Model {
+	if ui.ASCIIMode() {
+		return spinner.New(spinner.WithSpinner(spinner.Line))
+	}
+
+	return spinner.New(spinner.WithSpinner(spinner.Dot))
+}
+
+// truncateLeft shortens a path from the left so the most specific part stays visible.
+func truncateLeft(s string, width int) string {
+	runes := []rune(s)
+	ellipsis := []rune(ui.ToASCII("…"))
+
+	if width <= len(ellipsis) || len(runes) <= width {
+		return s
+	}
+
+	return string(ellipsis) + string(runes[len(runes)-width+len(ellipsis):])
+}
@@ -0,0 +1,57 @@
+package ui
+
+import (
+	"strings"
+	"sync/atomic"
+)
+
+const (
+	asciiUserGlyph      = "You"
+	asciiAssistantGlyph = "AI"
+)
+
+var asciiMode atomic.Bool //nolint:gochecknoglobals
+
+// asciiReplacer maps the unicode glyphs cwc prints itself to ASCII
+// equivalents. Content produced by the model is not affected.
+var asciiReplacer = strings.NewReplacer( //nolint:gochecknoglobals
+	"├── ", "|-- ",
+	"└── ", "`-- ",
+	"│   ", "|   ",
+	"┃", "|",
+	"…", "...",
+	"·", "-",
+	"↑", "up",
+	"↓", "down",
+	"👤", asciiUserGlyph,
+	"🤖", asciiAssistantGlyph,
+)
+
+// SetASCIIMode enables or disables ASCII-only output. In ASCII mode emoji and
+// box drawing characters are replaced by plain text, for terminals, fonts and
+// screen readers that don't render them well.
+func SetASCIIMode(enabled bool) {
+	asciiMode.Store(enabled)
+
+	if enabled {
+		theme := CurrentTheme()
+		theme.UserGlyph = asciiUserGlyph
+		theme.AssistantGlyph = asciiAssistantGlyph
+		SetTheme(theme)
+	}
+}
+
+// ASCIIMode reports whether ASCII-only output is enabled.
+func ASCIIMode() bool {
+	return asciiMode.Load()
+}
+
+// ToASCII replaces the glyphs used by cwc with ASCII equivalents if ASCII
+// mode is enabled.
+func ToASCII(s string) string {
+	if !ASCIIMode() {
+		return s
+	}
+
+	return asciiReplacer.Replace(s)
+}
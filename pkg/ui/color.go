@@ -0,0 +1,50 @@
+package ui
+
+import (
+	"os"
+	"regexp"
+	"sync/atomic"
+
+	"golang.org/x/term"
+)
+
+// ansiPattern matches CSI and OSC escape sequences.
+var ansiPattern = regexp.MustCompile(`\x1b\[[0-9;?]*[ -/]*[@-~]|\x1b\][^\x07\x1b]*(\x07|\x1b\\)`) //nolint:gochecknoglobals
+
+var colorsDisabled atomic.Bool //nolint:gochecknoglobals
+
+// DisableColors turns off colored output for the rest of the process,
+// typically in response to the --no-color flag.
+func DisableColors() {
+	colorsDisabled.Store(true)
+}
+
+// ColorsEnabled reports whether colored output should be produced. Colors are
+// disabled when requested explicitly, when NO_COLOR is set (see
+// https://no-color.org), for dumb terminals, when stdout is not a terminal
+// and when the terminal can't interpret ANSI escape sequences.
+func ColorsEnabled() bool {
+	if colorsDisabled.Load() {
+		return false
+	}
+
+	if os.Getenv("NO_COLOR") != "" || os.Getenv("TERM") == "dumb" {
+		return false
+	}
+
+	return term.IsTerminal(int(os.Stdout.Fd())) && VirtualTerminalSupported()
+}
+
+// StripANSI removes all ANSI escape sequences from a string.
+func StripANSI(s string) string {
+	return ansiPattern.ReplaceAllString(s, "")
+}
+
+// colorize wraps the message in the given color if colors are enabled.
+func colorize(color, message string) string {
+	if color == "" || !ColorsEnabled() {
+		return message
+	}
+
+	return color + message + colorReset
+}
@@ -0,0 +1,237 @@
+package ui
+
+import (
+	"slices"
+	"strings"
+	"unicode"
+)
+
+const (
+	styleBold      = "\033[1m"
+	styleReverse   = "\033[7m"
+	styleNoReverse = "\033[27m"
+)
+
+// RenderDiff colors a unified diff using the current theme: additions in the
+// success color, removals in the error color and hunk headers in the notice
+// color. With wordLevel set, the changed words of a removed line and the
+// added line replacing it are emphasized as well. Lines are only paired when
+// a run of removals is followed by the same number of additions.
+//
+// The output always contains escape sequences; callers decide whether the
+// terminal should receive colors.
+func RenderDiff(diff string, wordLevel bool) string {
+	theme := CurrentTheme()
+	lines := strings.SplitAfter(diff, "\n")
+
+	var out strings.Builder
+
+	for i := 0; i < len(lines); {
+		line := lines[i]
+
+		if !isChangeLine(line, '-') {
+			out.WriteString(renderDiffLine(theme, line))
+			i++
+
+			continue
+		}
+
+		removed := changeRun(lines[i:], '-')
+		added := changeRun(lines[i+len(removed):], '+')
+		i += len(removed) + len(added)
+
+		if !wordLevel || len(removed) != len(added) {
+			for _, line := range append(removed, added...) {
+				out.WriteString(renderDiffLine(theme, line))
+			}
+
+			continue
+		}
+
+		emphasized := make([]string, len(added))
+
+		for j := range removed {
+			var old string
+
+			old, emphasized[j] = emphasizeChanges(theme, removed[j], added[j])
+			out.WriteString(old)
+		}
+
+		for _, line := range emphasized {
+			out.WriteString(line)
+		}
+	}
+
+	return out.String()
+}
+
+func renderDiffLine(theme Theme, line string) string {
+	switch {
+	case line == "" || line == "\n":
+		return line
+	case strings.HasPrefix(line, "diff "), strings.HasPrefix(line, "index "),
+		strings.HasPrefix(line, "--- "), strings.HasPrefix(line, "+++ "):
+		return styleLine(styleBold, line)
+	case strings.HasPrefix(line, "@@"):
+		return styleLine(theme.Notice, line)
+	case line[0] == '+':
+		return styleLine(theme.Success, line)
+	case line[0] == '-':
+		return styleLine(theme.Error, line)
+	default:
+		return line
+	}
+}
+
+// styleLine applies the style to a line, keeping its newline outside of
+// the escape sequences.
+func styleLine(style, line string) string {
+	text, newline := strings.CutSuffix(line, "\n")
+	if style == "" || text == "" {
+		return line
+	}
+
+	result := style + text + colorReset
+	if newline {
+		result += "\n"
+	}
+
+	return result
+}
+
+func isChangeLine(line string, side byte) bool {
+	if line == "" || line[0] != side {
+		return false
+	}
+
+	// file headers look like changes but must not be paired
+	return !strings.HasPrefix(line, string([]byte{side, side, side, ' '}))
+}
+
+func changeRun(lines []string, side byte) []string {
+	n := 0
+	for n < len(lines) && isChangeLine(lines[n], side) {
+		n++
+	}
+
+	return lines[:n]
+}
+
+// emphasizeChanges renders a removed line and the added line that replaces
+// it, emphasizing the words that differ between them.
+func emphasizeChanges(theme Theme, removed, added string) (string, string) {
+	oldText, oldNewline := strings.CutSuffix(removed[1:], "\n")
+	newText, newNewline := strings.CutSuffix(added[1:], "\n")
+
+	oldWords := splitWords(oldText)
+	newWords := splitWords(newText)
+	oldKeep, newKeep := commonWords(oldWords, newWords)
+
+	// lines without anything in common are rewrites, emphasizing them
+	// entirely would only add noise
+	if !slices.Contains(oldKeep, true) {
+		return renderDiffLine(theme, removed), renderDiffLine(theme, added)
+	}
+
+	render := func(color, sign string, words []string, keep []bool, newline bool) string {
+		var line strings.Builder
+
+		line.WriteString(color + sign)
+
+		emphasized := false
+
+		for i, word := range words {
+			if keep[i] == emphasized {
+				emphasized = !keep[i]
+
+				if emphasized {
+					line.WriteString(styleReverse)
+				} else {
+					line.WriteString(styleNoReverse)
+				}
+			}
+
+			line.WriteString(word)
+		}
+
+		line.WriteString(colorReset)
+
+		if newline {
+			line.WriteString("\n")
+		}
+
+		return line.String()
+	}
+
+	return render(theme.Error, "-", oldWords, oldKeep, oldNewline),
+		render(theme.Success, "+", newWords, newKeep, newNewline)
+}
+
+// splitWords splits a line into runs of letters and digits, runs of
+// whitespace and single punctuation characters.
+func splitWords(line string) []string {
+	var words []string
+
+	runes := []rune(line)
+
+	for start := 0; start < len(runes); {
+		end := start + 1
+
+		switch {
+		case isWordRune(runes[start]):
+			for end < len(runes) && isWordRune(runes[end]) {
+				end++
+			}
+		case unicode.IsSpace(runes[start]):
+			for end < len(runes) && unicode.IsSpace(runes[end]) {
+				end++
+			}
+		}
+
+		words = append(words, string(runes[start:end]))
+		start = end
+	}
+
+	return words
+}
+
+func isWordRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// commonWords marks the words that are part of the longest common
+// subsequence of both lines.
+func commonWords(a, b []string) ([]bool, []bool) {
+	lengths := make([][]int, len(a)+1)
+	for i := range lengths {
+		lengths[i] = make([]int, len(b)+1)
+	}
+
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lengths[i][j] = lengths[i+1][j+1] + 1
+			} else {
+				lengths[i][j] = max(lengths[i+1][j], lengths[i][j+1])
+			}
+		}
+	}
+
+	keepA := make([]bool, len(a))
+	keepB := make([]bool, len(b))
+
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		switch {
+		case a[i] == b[j]:
+			keepA[i], keepB[j] = true, true
+			i++
+			j++
+		case lengths[i+1][j] >= lengths[i][j+1]:
+			i++
+		default:
+			j++
+		}
+	}
+
+	return keepA, keepB
+}
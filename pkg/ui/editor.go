@@ -0,0 +1,73 @@
+package ui
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// EditorFile writes text to a temporary file and returns the command that
+// opens it in the editor of the user, $VISUAL or $EDITOR, falling back to vi
+// or notepad. ReadEditorFile reads the text back once the command has exited.
+func EditorFile(text string) (*exec.Cmd, string, error) {
+	file, err := os.CreateTemp("", "cwc-message-*.md")
+	if err != nil {
+		return nil, "", fmt.Errorf("error creating message file: %w", err)
+	}
+
+	defer file.Close()
+
+	if _, err := file.WriteString(text); err != nil {
+		_ = os.Remove(file.Name())
+		return nil, "", fmt.Errorf("error writing message file: %w", err)
+	}
+
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+
+	if editor == "" {
+		editor = "vi"
+		if runtime.GOOS == "windows" {
+			editor = "notepad"
+		}
+	}
+
+	// the editor may be given with arguments, e.g. "code --wait"
+	args := append(strings.Fields(editor), file.Name())
+
+	cmd := exec.Command(args[0], args[1:]...) // #nosec
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+
+	return cmd, file.Name(), nil
+}
+
+// ReadEditorFile reads and removes the file written by EditorFile.
+func ReadEditorFile(path string) (string, error) {
+	defer os.Remove(path)
+
+	data, err := os.ReadFile(path) // #nosec
+	if err != nil {
+		return "", fmt.Errorf("error reading message file: %w", err)
+	}
+
+	return strings.TrimSpace(string(data)), nil
+}
+
+// EditText opens text in the editor of the user and returns the edited text.
+func EditText(text string) (string, error) {
+	cmd, path, err := EditorFile(text)
+	if err != nil {
+		return "", err
+	}
+
+	if err := cmd.Run(); err != nil {
+		_ = os.Remove(path)
+		return "", fmt.Errorf("error running editor: %w", err)
+	}
+
+	return ReadEditorFile(path)
+}
@@ -0,0 +1,137 @@
+package ui
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+const defaultLanguage = "en"
+
+// locales holds a message catalog per language, mapping message ids to
+// format strings.
+//
+//go:embed locales/*.json
+var locales embed.FS //nolint:gochecknoglobals
+
+var (
+	// catalog is the catalog of the selected language.
+	catalog atomic.Pointer[map[string]string] //nolint:gochecknoglobals
+	// englishCatalog is the fallback for messages missing in a translation.
+	englishCatalog = sync.OnceValue(func() map[string]string { //nolint:gochecknoglobals
+		messages, _ := loadCatalog(defaultLanguage)
+		return messages
+	})
+)
+
+// languageAliases maps language codes to the catalog that serves them.
+var languageAliases = map[string]string{ //nolint:gochecknoglobals
+	"no": "nb",
+	"nn": "nb",
+}
+
+// Languages returns the languages there are catalogs for.
+func Languages() []string {
+	entries, _ := locales.ReadDir("locales")
+
+	languages := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		languages = append(languages, strings.TrimSuffix(entry.Name(), ".json"))
+	}
+
+	sort.Strings(languages)
+
+	return languages
+}
+
+// SetLanguage selects the language of the messages, e.g. "nb" or "de_DE".
+// An empty language is taken from LC_ALL, LC_MESSAGES or LANG, falling back
+// to English.
+func SetLanguage(language string) error {
+	explicit := language != ""
+	if !explicit {
+		language = environmentLanguage()
+	}
+
+	messages, err := loadCatalog(normalizeLanguage(language))
+	if err != nil {
+		if explicit {
+			return fmt.Errorf("unsupported language %q, use one of %s", language, strings.Join(Languages(), ", "))
+		}
+
+		messages = englishCatalog()
+	}
+
+	catalog.Store(&messages)
+
+	return nil
+}
+
+// T returns the message with the given id in the selected language,
+// formatted with args. Messages missing in a translation are in English.
+func T(id string, args ...any) string {
+	format, ok := "", false
+
+	if messages := catalog.Load(); messages != nil {
+		format, ok = (*messages)[id]
+	}
+
+	if !ok {
+		format, ok = englishCatalog()[id]
+	}
+
+	if !ok {
+		format = id
+	}
+
+	if len(args) == 0 {
+		return format
+	}
+
+	return fmt.Sprintf(format, args...)
+}
+
+func loadCatalog(language string) (map[string]string, error) {
+	data, err := locales.ReadFile(path.Join("locales", language+".json"))
+	if err != nil {
+		return nil, fmt.Errorf("error reading catalog: %w", err)
+	}
+
+	var messages map[string]string
+	if err := json.Unmarshal(data, &messages); err != nil {
+		return nil, fmt.Errorf("error parsing catalog: %w", err)
+	}
+
+	return messages, nil
+}
+
+// normalizeLanguage turns a locale such as "nb_NO.UTF-8" into a language code.
+func normalizeLanguage(language string) string {
+	language = strings.ToLower(language)
+
+	if i := strings.IndexAny(language, "_-.@"); i >= 0 {
+		language = language[:i]
+	}
+
+	if alias, ok := languageAliases[language]; ok {
+		return alias
+	}
+
+	return language
+}
+
+func environmentLanguage() string {
+	for _, name := range []string{"LC_ALL", "LC_MESSAGES", "LANG"} {
+		if value := os.Getenv(name); value != "" && value != "C" && value != "POSIX" {
+			return value
+		}
+	}
+
+	return defaultLanguage
+}
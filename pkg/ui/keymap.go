@@ -0,0 +1,179 @@
+package ui
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+const defaultKeyMapName = "emacs"
+
+// KeyMap binds the actions of the chat prompt and the full-screen interface
+// to keys. Keys are named the way the terminal reports them, e.g. "enter",
+// "ctrl+j", "alt+enter" or "pgup". A key bound to an action takes precedence
+// over the editing keys of the prompt.
+type KeyMap struct {
+	// Submit sends the message.
+	Submit []string
+	// Newline inserts a line break in the full-screen interface. The prompt
+	// holds a single line, use Editor to write longer messages there.
+	Newline []string
+	// Cancel stops the response being generated, or exits when there is none.
+	Cancel []string
+	// ScrollUp and ScrollDown scroll the transcript of the full-screen
+	// interface.
+	ScrollUp   []string
+	ScrollDown []string
+	// Editor opens the message in $VISUAL or $EDITOR.
+	Editor []string
+	// Sidebar shows or hides the context files in the full-screen interface.
+	Sidebar []string
+}
+
+var builtinKeyMaps = map[string]KeyMap{ //nolint:gochecknoglobals
+	"emacs": {
+		Submit:     []string{"enter"},
+		Newline:    []string{"alt+enter", "ctrl+j"},
+		Cancel:     []string{"ctrl+c", "esc"},
+		ScrollUp:   []string{"pgup"},
+		ScrollDown: []string{"pgdown"},
+		Editor:     []string{"ctrl+x"},
+		Sidebar:    []string{"ctrl+b"},
+	},
+	"vi": {
+		Submit:     []string{"enter"},
+		Newline:    []string{"alt+enter", "ctrl+j"},
+		Cancel:     []string{"ctrl+c"},
+		ScrollUp:   []string{"pgup", "ctrl+u"},
+		ScrollDown: []string{"pgdown", "ctrl+d"},
+		Editor:     []string{"ctrl+o"},
+		Sidebar:    []string{"ctrl+t"},
+	},
+}
+
+var currentKeyMap = struct { //nolint:gochecknoglobals
+	sync.RWMutex
+	keys KeyMap
+}{keys: builtinKeyMaps[defaultKeyMapName]}
+
+// BuiltinKeyMap returns one of the built-in key maps by name.
+func BuiltinKeyMap(name string) (KeyMap, bool) {
+	keys, ok := builtinKeyMaps[strings.ToLower(name)]
+	return keys, ok
+}
+
+// BuiltinKeyMapNames returns the names of all built-in key maps.
+func BuiltinKeyMapNames() []string {
+	names := make([]string, 0, len(builtinKeyMaps))
+	for name := range builtinKeyMaps {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+// SetKeyMap changes the key bindings of the prompt and the full-screen
+// interface.
+func SetKeyMap(keys KeyMap) {
+	currentKeyMap.Lock()
+	defer currentKeyMap.Unlock()
+
+	currentKeyMap.keys = keys
+}
+
+// CurrentKeyMap returns the key bindings currently in use.
+func CurrentKeyMap() KeyMap {
+	currentKeyMap.RLock()
+	defer currentKeyMap.RUnlock()
+
+	return currentKeyMap.keys
+}
+
+// ParseKeys normalizes a list of key names, such as "Ctrl+J" or "alt-enter",
+// and rejects names that no terminal reports.
+func ParseKeys(names []string) ([]string, error) {
+	keys := make([]string, 0, len(names))
+
+	for _, name := range names {
+		key := strings.ToLower(strings.TrimSpace(name))
+		key = strings.ReplaceAll(key, "-", "+")
+
+		if !validKey(key) {
+			return nil, fmt.Errorf("unknown key %q", name)
+		}
+
+		keys = append(keys, key)
+	}
+
+	return keys, nil
+}
+
+var namedKeys = map[string]bool{ //nolint:gochecknoglobals
+	"enter": true, "tab": true, "esc": true, "backspace": true, "delete": true,
+	"up": true, "down": true, "left": true, "right": true, "home": true, "end": true,
+	"pgup": true, "pgdown": true, "insert": true, " ": true,
+}
+
+func validKey(key string) bool {
+	base := strings.TrimPrefix(key, "alt+")
+
+	if letter, ok := strings.CutPrefix(base, "ctrl+"); ok {
+		return namedKeys[letter] || (len(letter) == 1 && letter[0] >= 'a' && letter[0] <= 'z')
+	}
+
+	if strings.HasPrefix(base, "f") && len(base) > 1 && strings.Trim(base[1:], "0123456789") == "" {
+		return true
+	}
+
+	return namedKeys[base] || utf8.RuneCountInString(base) == 1
+}
+
+// Matches reports whether key is one of the keys bound to an action.
+func Matches(key string, bound []string) bool {
+	for _, b := range bound {
+		if b == key {
+			return true
+		}
+	}
+
+	return false
+}
+
+// keyAt names the key at the start of raw terminal input, for the keys the
+// prompt binds to actions: control characters and Alt with another key. It
+// returns the number of bytes the key takes up, or 0 if the input doesn't
+// start with such a key.
+func keyAt(seq []byte) (string, int) {
+	if len(seq) == 0 {
+		return "", 0
+	}
+
+	c := seq[0]
+
+	switch {
+	case c == keyEnter:
+		return "enter", 1
+	case c == keyTab:
+		return "tab", 1
+	case c >= keyCtrlA && c <= 0x1a:
+		return "ctrl+" + string(rune('a'+c-keyCtrlA)), 1
+	case c == keyEscape && len(seq) > 1 && seq[1] != '[' && seq[1] != 'O':
+		name, size := keyAt(seq[1:])
+		if size == 0 {
+			if !utf8.FullRune(seq[1:]) {
+				return "", 0
+			}
+
+			r, n := utf8.DecodeRune(seq[1:])
+			name, size = string(r), n
+		}
+
+		return "alt+" + name, size + 1
+	}
+
+	return "", 0
+}
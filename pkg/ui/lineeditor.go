@@ -0,0 +1,591 @@
+package ui
+
+import (
+	"bufio"
+	stderrors "errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/mattn/go-runewidth"
+	"golang.org/x/term"
+)
+
+// ErrInterrupted is returned by LineEditor.ReadLine when the user presses a
+// key bound to KeyMap.Cancel, Ctrl-C by default.
+var ErrInterrupted = stderrors.New("interrupted")
+
+// defaultTerminalWidth is the width input wraps at when the width of the
+// terminal is unknown.
+const defaultTerminalWidth = 80
+
+const (
+	keyCtrlA     = 0x01
+	keyCtrlB     = 0x02
+	keyCtrlD     = 0x04
+	keyCtrlE     = 0x05
+	keyCtrlF     = 0x06
+	keyCtrlH     = 0x08
+	keyTab       = 0x09
+	keyCtrlK     = 0x0b
+	keyCtrlL     = 0x0c
+	keyEnter     = 0x0d
+	keyCtrlN     = 0x0e
+	keyCtrlP     = 0x10
+	keyCtrlU     = 0x15
+	keyCtrlW     = 0x17
+	keyEscape    = 0x1b
+	keyBackspace = 0x7f
+)
+
+// Completer returns completion candidates for the text before the cursor.
+// Each candidate replaces the text starting at rune index start.
+type Completer func(text string) (candidates []string, start int)
+
+// LineEditor reads lines from the terminal with support for cursor movement,
+// word operations, tab completion and recall of earlier input within the
+// session. When stdin is not a terminal, or the terminal can't interpret ANSI
+// escape sequences, it falls back to reading plain lines.
+type LineEditor struct {
+	history   []string
+	in        *os.File
+	reader    *bufio.Reader
+	completer Completer
+	// pending holds the input read past a submitted line, such as the rest
+	// of a multi-line paste, for the next call to ReadLine.
+	pending []byte
+}
+
+// NewLineEditor creates a line editor reading from stdin.
+func NewLineEditor() *LineEditor {
+	return &LineEditor{in: os.Stdin}
+}
+
+// SetCompleter installs the function used to complete input when Tab is pressed.
+func (e *LineEditor) SetCompleter(completer Completer) {
+	e.completer = completer
+}
+
+// ReadLine prints the prompt and reads a single line of input. Submitted
+// non-empty lines are added to the history.
+func (e *LineEditor) ReadLine(prompt string) (string, error) {
+	PrintMessage(prompt, MessageTypeInfo)
+
+	fd := int(e.in.Fd())
+
+	if !term.IsTerminal(fd) || !VirtualTerminalSupported() {
+		return e.readPlainLine()
+	}
+
+	state, err := term.MakeRaw(fd)
+	if err != nil {
+		return e.readPlainLine()
+	}
+
+	defer func() {
+		_ = term.Restore(fd, state)
+	}()
+
+	buf := &lineBuffer{}
+	session := &editSession{editor: e, buf: buf, prompt: prompt, historyIdx: len(e.history), fd: fd, state: state}
+	session.pending, e.pending = e.pending, nil
+
+	line, err := session.run()
+	if err != nil {
+		return "", err
+	}
+
+	line = strings.TrimSpace(line)
+	if line != "" && (len(e.history) == 0 || e.history[len(e.history)-1] != line) {
+		e.history = append(e.history, line)
+	}
+
+	return line, nil
+}
+
+func (e *LineEditor) readPlainLine() (string, error) {
+	if e.reader == nil {
+		e.reader = bufio.NewReader(e.in)
+	}
+
+	line, err := e.reader.ReadString('\n')
+	if err != nil && (line == "" || !stderrors.Is(err, io.EOF)) {
+		return "", fmt.Errorf("error reading input: %w", err)
+	}
+
+	return strings.TrimSpace(line), nil
+}
+
+// lineBuffer holds the runes being edited and the cursor position.
+type lineBuffer struct {
+	runes []rune
+	pos   int
+}
+
+func (b *lineBuffer) insert(r ...rune) {
+	tail := append([]rune{}, b.runes[b.pos:]...)
+	b.runes = append(append(b.runes[:b.pos], r...), tail...)
+	b.pos += len(r)
+}
+
+func (b *lineBuffer) set(s string) {
+	b.runes = []rune(s)
+	b.pos = len(b.runes)
+}
+
+func (b *lineBuffer) deleteRange(from, to int) {
+	b.runes = append(b.runes[:from], b.runes[to:]...)
+	b.pos = from
+}
+
+func (b *lineBuffer) wordStartBefore() int {
+	i := b.pos
+	for i > 0 && unicode.IsSpace(b.runes[i-1]) {
+		i--
+	}
+
+	for i > 0 && !unicode.IsSpace(b.runes[i-1]) {
+		i--
+	}
+
+	return i
+}
+
+func (b *lineBuffer) wordEndAfter() int {
+	i := b.pos
+	for i < len(b.runes) && unicode.IsSpace(b.runes[i]) {
+		i++
+	}
+
+	for i < len(b.runes) && !unicode.IsSpace(b.runes[i]) {
+		i++
+	}
+
+	return i
+}
+
+type editSession struct {
+	editor     *LineEditor
+	buf        *lineBuffer
+	prompt     string
+	historyIdx int
+	draft      string
+	// shownRow is the row of the cursor as currently drawn on the terminal,
+	// counted from the row the input starts on.
+	shownRow int
+	pending  []byte
+	// fd and state restore the terminal while an editor runs.
+	fd    int
+	state *term.State
+}
+
+func (s *editSession) run() (string, error) {
+	readBuf := make([]byte, 256) //nolint:gomnd
+
+	for {
+		done, err := s.process()
+		if err != nil {
+			return "", err
+		}
+
+		if done {
+			s.write("\r\n")
+			s.editor.pending = s.pending
+
+			return string(s.buf.runes), nil
+		}
+
+		s.redraw()
+
+		n, err := s.editor.in.Read(readBuf)
+		if err != nil {
+			return "", fmt.Errorf("error reading input: %w", err)
+		}
+
+		s.pending = append(s.pending, readBuf[:n]...)
+	}
+}
+
+// process handles all complete key sequences in the pending input. It
+// returns true once the line has been submitted, leaving the input after it
+// pending. The keys bound in the current KeyMap come first, then the editing
+// keys.
+func (s *editSession) process() (bool, error) { //nolint:gocognit,cyclop,funlen
+	for len(s.pending) > 0 {
+		if name, size := keyAt(s.pending); size > 0 {
+			keys := CurrentKeyMap()
+
+			switch {
+			case Matches(name, keys.Submit):
+				s.pending = s.pending[size:]
+				s.redraw()
+
+				return true, nil
+			case Matches(name, keys.Cancel):
+				s.write("^C\r\n")
+				return false, ErrInterrupted
+			case Matches(name, keys.Editor):
+				s.pending = s.pending[size:]
+				return s.edit(), nil
+			}
+		}
+
+		c := s.pending[0]
+
+		switch c {
+		case keyCtrlD:
+			if len(s.buf.runes) == 0 {
+				s.write("\r\n")
+				return false, io.EOF
+			}
+
+			if s.buf.pos < len(s.buf.runes) {
+				s.buf.deleteRange(s.buf.pos, s.buf.pos+1)
+			}
+		case keyBackspace, keyCtrlH:
+			if s.buf.pos > 0 {
+				s.buf.deleteRange(s.buf.pos-1, s.buf.pos)
+			}
+		case keyCtrlA:
+			s.buf.pos = 0
+		case keyCtrlE:
+			s.buf.pos = len(s.buf.runes)
+		case keyCtrlB:
+			s.moveLeft()
+		case keyCtrlF:
+			s.moveRight()
+		case keyCtrlK:
+			s.buf.runes = s.buf.runes[:s.buf.pos]
+		case keyCtrlU:
+			s.buf.deleteRange(0, s.buf.pos)
+		case keyCtrlW:
+			s.buf.deleteRange(s.buf.wordStartBefore(), s.buf.pos)
+		case keyCtrlP:
+			s.recall(-1)
+		case keyCtrlN:
+			s.recall(1)
+		case keyCtrlL:
+			s.write("\033[H\033[2J")
+			s.reprint()
+		case keyTab:
+			s.complete()
+		case keyEscape:
+			consumed, complete := s.handleEscape()
+			if !complete {
+				return false, nil
+			}
+
+			s.pending = s.pending[consumed:]
+
+			continue
+		default:
+			if c < 0x20 {
+				break // ignore other control characters
+			}
+
+			if !utf8.FullRune(s.pending) {
+				return false, nil // wait for the rest of a multi-byte character
+			}
+
+			r, size := utf8.DecodeRune(s.pending)
+			s.pending = s.pending[size:]
+
+			if r != utf8.RuneError {
+				s.buf.insert(r)
+			}
+
+			continue
+		}
+
+		s.pending = s.pending[1:]
+	}
+
+	return false, nil
+}
+
+// handleEscape interprets an escape sequence at the start of the pending
+// input. It returns the number of bytes consumed and whether the sequence was
+// complete.
+func (s *editSession) handleEscape() (int, bool) { //nolint:cyclop
+	seq := s.pending
+	if len(seq) < 2 { //nolint:gomnd
+		return 0, false
+	}
+
+	switch seq[1] {
+	case 'b':
+		s.buf.pos = s.buf.wordStartBefore()
+		return 2, true //nolint:gomnd
+	case 'f':
+		s.buf.pos = s.buf.wordEndAfter()
+		return 2, true //nolint:gomnd
+	case '[', 'O':
+	default:
+		return 1, true
+	}
+
+	// find the final byte of the CSI sequence
+	end := 2
+	for end < len(seq) && (seq[end] < 0x40 || seq[end] > 0x7e) {
+		end++
+	}
+
+	if end >= len(seq) {
+		return 0, false
+	}
+
+	params := string(seq[2:end])
+
+	switch seq[end] {
+	case 'A':
+		s.recall(-1)
+	case 'B':
+		s.recall(1)
+	case 'C':
+		if strings.HasSuffix(params, ";5") {
+			s.buf.pos = s.buf.wordEndAfter()
+		} else {
+			s.moveRight()
+		}
+	case 'D':
+		if strings.HasSuffix(params, ";5") {
+			s.buf.pos = s.buf.wordStartBefore()
+		} else {
+			s.moveLeft()
+		}
+	case 'H':
+		s.buf.pos = 0
+	case 'F':
+		s.buf.pos = len(s.buf.runes)
+	case '~':
+		switch params {
+		case "1", "7":
+			s.buf.pos = 0
+		case "4", "8":
+			s.buf.pos = len(s.buf.runes)
+		case "3":
+			if s.buf.pos < len(s.buf.runes) {
+				s.buf.deleteRange(s.buf.pos, s.buf.pos+1)
+			}
+		}
+	}
+
+	return end + 1, true
+}
+
+// edit opens the input in the editor of the user and submits the edited
+// text, unless it was left empty. The terminal leaves raw mode while the
+// editor runs.
+func (s *editSession) edit() bool {
+	s.write("\r\n")
+	_ = term.Restore(s.fd, s.state)
+
+	text, err := EditText(string(s.buf.runes))
+
+	_, _ = term.MakeRaw(s.fd)
+
+	if err != nil {
+		s.write(err.Error() + "\r\n")
+		s.reprint()
+
+		return false
+	}
+
+	s.buf.set(text)
+	s.reprint()
+
+	if text == "" {
+		return false
+	}
+
+	s.write(strings.ReplaceAll(text, "\n", "\r\n"))
+
+	return true
+}
+
+func (s *editSession) moveLeft() {
+	if s.buf.pos > 0 {
+		s.buf.pos--
+	}
+}
+
+func (s *editSession) moveRight() {
+	if s.buf.pos < len(s.buf.runes) {
+		s.buf.pos++
+	}
+}
+
+// recall replaces the buffer with an earlier or later history entry,
+// remembering what was being typed so it can be restored.
+func (s *editSession) recall(direction int) {
+	history := s.editor.history
+
+	next := s.historyIdx + direction
+	if next < 0 || next > len(history) {
+		return
+	}
+
+	if s.historyIdx == len(history) {
+		s.draft = string(s.buf.runes)
+	}
+
+	s.historyIdx = next
+
+	if next == len(history) {
+		s.buf.set(s.draft)
+		return
+	}
+
+	s.buf.set(history[next])
+}
+
+// complete replaces the text before the cursor with the longest common
+// prefix of the completion candidates and lists them if that is ambiguous.
+func (s *editSession) complete() {
+	if s.editor.completer == nil {
+		return
+	}
+
+	before := string(s.buf.runes[:s.buf.pos])
+
+	candidates, start := s.editor.completer(before)
+	if len(candidates) == 0 || start < 0 || start > s.buf.pos {
+		return
+	}
+
+	prefix := commonPrefix(candidates)
+	current := string(s.buf.runes[start:s.buf.pos])
+
+	if len([]rune(prefix)) > len([]rune(current)) {
+		completion := []rune(prefix)
+		if len(candidates) == 1 && !strings.HasSuffix(prefix, "/") {
+			completion = append(completion, ' ')
+		}
+
+		s.buf.deleteRange(start, s.buf.pos)
+		s.buf.insert(completion...)
+
+		return
+	}
+
+	if len(candidates) > 1 {
+		s.write("\r\n" + strings.Join(candidates, "  ") + "\r\n")
+		s.reprint()
+	}
+}
+
+// reprint draws the prompt and the input again on a fresh line.
+func (s *editSession) reprint() {
+	s.write(s.prompt)
+	s.shownRow = 0
+}
+
+func commonPrefix(candidates []string) string {
+	prefix := []rune(candidates[0])
+
+	for _, candidate := range candidates[1:] {
+		runes := []rune(candidate)
+
+		n := 0
+		for n < len(prefix) && n < len(runes) && prefix[n] == runes[n] {
+			n++
+		}
+
+		prefix = prefix[:n]
+	}
+
+	return string(prefix)
+}
+
+// redraw rewrites the input after the prompt and places the cursor. The
+// input wraps at the width of the terminal, so the rows and columns are
+// computed from the start of the input rather than moved relative to the
+// cursor.
+func (s *editSession) redraw() {
+	width := TerminalWidth()
+	if width <= 0 {
+		width = defaultTerminalWidth
+	}
+
+	start := s.promptWidth() % width
+
+	var out strings.Builder
+
+	if s.shownRow > 0 {
+		fmt.Fprintf(&out, "\033[%dA", s.shownRow)
+	}
+
+	out.WriteString("\r")
+
+	if start > 0 {
+		fmt.Fprintf(&out, "\033[%dC", start)
+	}
+
+	out.WriteString(string(s.buf.runes))
+	out.WriteString("\033[J")
+
+	endRow, endCol := wrappedPosition(s.buf.runes, start, width)
+	if endCol == 0 && len(s.buf.runes) > 0 {
+		// the terminal holds the cursor in the last column until the next
+		// character is written, so move it to the next row explicitly
+		out.WriteString("\r\n")
+	}
+
+	row, col := wrappedPosition(s.buf.runes[:s.buf.pos], start, width)
+
+	if endRow > row {
+		fmt.Fprintf(&out, "\033[%dA", endRow-row)
+	}
+
+	out.WriteString("\r")
+
+	if col > 0 {
+		fmt.Fprintf(&out, "\033[%dC", col)
+	}
+
+	s.shownRow = row
+
+	s.write(out.String())
+}
+
+// promptWidth returns the display width of the last line of the prompt.
+func (s *editSession) promptWidth() int {
+	prompt := s.prompt
+	if i := strings.LastIndex(prompt, "\n"); i >= 0 {
+		prompt = prompt[i+1:]
+	}
+
+	return runewidth.StringWidth(prompt)
+}
+
+// wrappedPosition returns the row and column the cursor ends up in after
+// writing runes from column start of a terminal width columns wide. A wide
+// character that doesn't fit on a row moves to the next one, as it does in
+// the terminal.
+func wrappedPosition(runes []rune, start, width int) (int, int) {
+	row, col := 0, start
+
+	for _, r := range runes {
+		w := runewidth.RuneWidth(r)
+		if col+w > width {
+			row++
+			col = 0
+		}
+
+		col += w
+	}
+
+	if col >= width {
+		row++
+		col = 0
+	}
+
+	return row, col
+}
+
+func (s *editSession) write(text string) {
+	fmt.Print(text) //nolint:forbidigo
+}
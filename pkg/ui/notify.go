@@ -0,0 +1,93 @@
+package ui
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// NotifyBell rings the terminal bell.
+	NotifyBell = "bell"
+	// NotifyDesktop shows a notification through the operating system and
+	// falls back to the terminal bell where that isn't available.
+	NotifyDesktop = "desktop"
+)
+
+var notification = struct { //nolint:gochecknoglobals
+	sync.RWMutex
+	method string
+	after  time.Duration
+}{method: NotifyBell}
+
+// SetNotification enables notifications for responses that take longer than
+// after to complete. A zero duration disables notifications.
+func SetNotification(method string, after time.Duration) error {
+	if method == "" {
+		method = NotifyBell
+	}
+
+	if method != NotifyBell && method != NotifyDesktop {
+		return fmt.Errorf("unknown notification method %q, use %q or %q", method, NotifyBell, NotifyDesktop)
+	}
+
+	notification.Lock()
+	defer notification.Unlock()
+
+	notification.method = method
+	notification.after = after
+
+	return nil
+}
+
+// NotifyIfSlow notifies the user that a response is complete if it was
+// started longer ago than the configured threshold.
+func NotifyIfSlow(started time.Time, message string) {
+	notification.RLock()
+	method, after := notification.method, notification.after
+	notification.RUnlock()
+
+	if after <= 0 || time.Since(started) < after {
+		return
+	}
+
+	if method == NotifyDesktop && notifyDesktop(message) == nil {
+		return
+	}
+
+	ringBell()
+}
+
+func ringBell() {
+	fmt.Fprint(os.Stdout, "\a")
+}
+
+// notifyDesktop shows a desktop notification without waiting for it to be
+// dismissed.
+func notifyDesktop(message string) error {
+	var cmd *exec.Cmd
+
+	switch runtime.GOOS {
+	case "linux", "freebsd", "openbsd", "netbsd":
+		cmd = exec.Command("notify-send", "cwc", message)
+	case "darwin":
+		script := fmt.Sprintf("display notification %s with title %q", strconv.Quote(message), "cwc")
+		cmd = exec.Command("osascript", "-e", script)
+	default:
+		return fmt.Errorf("desktop notifications are not supported on %s", runtime.GOOS)
+	}
+
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("error showing notification: %w", err)
+	}
+
+	go func() {
+		_ = cmd.Wait()
+	}()
+
+	return nil
+}
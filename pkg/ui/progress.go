@@ -0,0 +1,105 @@
+package ui
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"golang.org/x/term"
+)
+
+const progressInterval = 100 * time.Millisecond
+
+// activeProgress is the progress line currently drawn, if any. PrintMessage
+// clears it so that regular output doesn't end up glued to the status line.
+var activeProgress struct { //nolint:gochecknoglobals
+	sync.Mutex
+	line *ProgressLine
+}
+
+// ProgressLine repeatedly redraws a single status line, throttled so that
+// frequent updates don't flood the terminal. It does nothing when stdout is
+// not a terminal capable of ANSI escape sequences.
+type ProgressLine struct {
+	mu      sync.Mutex
+	enabled bool
+	drawn   bool
+	last    time.Time
+}
+
+// NewProgressLine creates a new progress line.
+func NewProgressLine() *ProgressLine {
+	return &ProgressLine{enabled: term.IsTerminal(int(os.Stdout.Fd())) && VirtualTerminalSupported()}
+}
+
+// Update replaces the current status line with the given message.
+func (p *ProgressLine) Update(message string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if !p.enabled || time.Since(p.last) < progressInterval {
+		return
+	}
+
+	p.last = time.Now()
+	p.drawn = true
+
+	activeProgress.Lock()
+	activeProgress.line = p
+	activeProgress.Unlock()
+
+	fmt.Print("\r\033[K" + colorize(CurrentTheme().Notice, message)) //nolint:forbidigo
+}
+
+// Done clears the status line.
+func (p *ProgressLine) Done() {
+	p.clear()
+
+	activeProgress.Lock()
+	if activeProgress.line == p {
+		activeProgress.line = nil
+	}
+	activeProgress.Unlock()
+}
+
+func (p *ProgressLine) clear() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if !p.drawn {
+		return
+	}
+
+	p.drawn = false
+	// allow the line to be redrawn right away by the next update
+	p.last = time.Time{}
+
+	fmt.Print("\r\033[K") //nolint:forbidigo
+}
+
+func clearActiveProgress() {
+	activeProgress.Lock()
+	line := activeProgress.line
+	activeProgress.Unlock()
+
+	if line != nil {
+		line.clear()
+	}
+}
+
+// FormatBytes formats a byte count in a human-readable form.
+func FormatBytes(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+
+	return fmt.Sprintf("%.1f %cB", float64(size)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,90 @@
+package ui
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"golang.org/x/term"
+)
+
+const spinnerInterval = 100 * time.Millisecond
+
+var (
+	spinnerFrames      = []string{"⠋", "⠙", "⠹", "⠸", "⠼", "⠴", "⠦", "⠧", "⠇", "⠏"} //nolint:gochecknoglobals
+	asciiSpinnerFrames = []string{"|", "/", "-", "\\"}                              //nolint:gochecknoglobals
+)
+
+// Spinner renders an animated indicator with the elapsed time on the current
+// line until it is stopped. It does nothing when stdout is not a terminal
+// capable of ANSI escape sequences.
+type Spinner struct {
+	message string
+	mu      sync.Mutex
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+// NewSpinner creates a spinner that displays the given message.
+func NewSpinner(message string) *Spinner {
+	return &Spinner{message: message}
+}
+
+// Start begins animating the spinner. Calling Start on a running spinner has no effect.
+func (s *Spinner) Start() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.stop != nil || !term.IsTerminal(int(os.Stdout.Fd())) || !VirtualTerminalSupported() {
+		return
+	}
+
+	s.stop = make(chan struct{})
+	s.done = make(chan struct{})
+
+	go s.run(s.stop, s.done)
+}
+
+// Stop halts the animation and clears the spinner from the line.
+func (s *Spinner) Stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.stop == nil {
+		return
+	}
+
+	close(s.stop)
+	<-s.done
+
+	s.stop = nil
+	s.done = nil
+}
+
+func (s *Spinner) run(stop <-chan struct{}, done chan<- struct{}) {
+	defer close(done)
+
+	started := time.Now()
+	ticker := time.NewTicker(spinnerInterval)
+
+	frames := spinnerFrames
+	if ASCIIMode() {
+		frames = asciiSpinnerFrames
+	}
+
+	defer ticker.Stop()
+
+	for frame := 0; ; frame++ {
+		elapsed := time.Since(started).Seconds()
+		fmt.Print("\r" + colorize(CurrentTheme().Notice, //nolint:forbidigo
+			fmt.Sprintf("%s %s %.1fs", frames[frame%len(frames)], s.message, elapsed)))
+
+		select {
+		case <-stop:
+			fmt.Print("\r\033[K") //nolint:forbidigo
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,29 @@
+package ui
+
+import (
+	"os"
+	"sync"
+
+	"golang.org/x/term"
+)
+
+var virtualTerminal = sync.OnceValue(enableVirtualTerminal) //nolint:gochecknoglobals
+
+// VirtualTerminalSupported reports whether the terminal interprets ANSI
+// escape sequences. On Windows this enables VT processing the first time it
+// is called. Features relying on cursor movement, such as the spinner, the
+// line editor and the full-screen interface, degrade gracefully without it.
+func VirtualTerminalSupported() bool {
+	return virtualTerminal()
+}
+
+// TerminalWidth returns the number of columns of the terminal attached to
+// stdout, or zero if stdout is not a terminal.
+func TerminalWidth() int {
+	width, _, err := term.GetSize(int(os.Stdout.Fd()))
+	if err != nil {
+		return 0
+	}
+
+	return width
+}
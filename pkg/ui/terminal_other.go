@@ -0,0 +1,9 @@
+//go:build !windows
+
+package ui
+
+// enableVirtualTerminal is a no-op outside of Windows, where terminals
+// interpret ANSI escape codes natively.
+func enableVirtualTerminal() bool {
+	return true
+}
@@ -0,0 +1,30 @@
+//go:build windows
+
+package ui
+
+import (
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+// enableVirtualTerminal turns on VT sequence processing for stdout so that
+// conhost interprets ANSI escape codes instead of printing them verbatim. It
+// reports false if the console doesn't support it, e.g. on older Windows versions.
+func enableVirtualTerminal() bool {
+	handle := windows.Handle(os.Stdout.Fd())
+
+	var mode uint32
+	if err := windows.GetConsoleMode(handle, &mode); err != nil {
+		// not a console, output is redirected and colors are disabled anyway
+		return false
+	}
+
+	if mode&windows.ENABLE_VIRTUAL_TERMINAL_PROCESSING != 0 {
+		return true
+	}
+
+	err := windows.SetConsoleMode(handle, mode|windows.ENABLE_VIRTUAL_TERMINAL_PROCESSING)
+
+	return err == nil
+}
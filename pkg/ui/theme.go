@@ -0,0 +1,179 @@
+package ui
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const defaultThemeName = "dark"
+
+// Theme describes the colors and glyphs used when printing to the terminal.
+// Colors are ANSI escape sequences; an empty color prints without styling.
+type Theme struct {
+	Info           string
+	Warning        string
+	Error          string
+	Notice         string
+	Success        string
+	UserGlyph      string
+	AssistantGlyph string
+	// CodeStyle is the name of the chroma style used for code blocks.
+	CodeStyle string
+}
+
+var builtinThemes = map[string]Theme{ //nolint:gochecknoglobals
+	"dark": {
+		Info:           "",
+		Warning:        colorYellow,
+		Error:          colorRed,
+		Notice:         colorCyan,
+		Success:        colorGreen,
+		UserGlyph:      "👤",
+		AssistantGlyph: "🤖",
+		CodeStyle:      "monokai",
+	},
+	"light": {
+		Info:           "",
+		Warning:        "\033[38;5;130m",
+		Error:          "\033[38;5;124m",
+		Notice:         "\033[34m",
+		Success:        "\033[38;5;28m",
+		UserGlyph:      "👤",
+		AssistantGlyph: "🤖",
+		CodeStyle:      "github",
+	},
+	"solarized": {
+		Info:           "",
+		Warning:        "\033[38;5;136m",
+		Error:          "\033[38;5;160m",
+		Notice:         "\033[38;5;33m",
+		Success:        "\033[38;5;64m",
+		UserGlyph:      "👤",
+		AssistantGlyph: "🤖",
+		CodeStyle:      "solarized-dark",
+	},
+}
+
+var currentTheme = struct { //nolint:gochecknoglobals
+	sync.RWMutex
+	theme Theme
+}{theme: builtinThemes[defaultThemeName]}
+
+// BuiltinTheme returns one of the built-in themes by name.
+func BuiltinTheme(name string) (Theme, bool) {
+	theme, ok := builtinThemes[strings.ToLower(name)]
+	return theme, ok
+}
+
+// BuiltinThemeNames returns the names of all built-in themes.
+func BuiltinThemeNames() []string {
+	names := make([]string, 0, len(builtinThemes))
+	for name := range builtinThemes {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+// SetTheme changes the theme used for all subsequent output.
+func SetTheme(theme Theme) {
+	currentTheme.Lock()
+	defer currentTheme.Unlock()
+
+	currentTheme.theme = theme
+}
+
+// CurrentTheme returns the theme currently in use.
+func CurrentTheme() Theme {
+	currentTheme.RLock()
+	defer currentTheme.RUnlock()
+
+	return currentTheme.theme
+}
+
+func (t Theme) colorFor(messageType MessageType) string {
+	switch messageType {
+	case MessageTypeInfo:
+		return t.Info
+	case MessageTypeWarning:
+		return t.Warning
+	case MessageTypeError:
+		return t.Error
+	case MessageTypeNotice:
+		return t.Notice
+	case MessageTypeSuccess:
+		return t.Success
+	case MessageTypeDim:
+		return colorDim
+	default:
+		return ""
+	}
+}
+
+var namedColors = map[string]int{ //nolint:gochecknoglobals
+	"black":   30,
+	"red":     31,
+	"green":   32,
+	"yellow":  33,
+	"blue":    34,
+	"magenta": 35,
+	"cyan":    36,
+	"white":   37,
+}
+
+// brightOffset turns a standard ANSI color code into its bright variant.
+const brightOffset = 60
+
+// ParseColor converts a color specification into an ANSI escape sequence.
+// Supported forms are color names ("red", "bright-blue"), 256-color palette
+// indices ("208") and hex codes ("#268bd2"). The empty string and "default"
+// yield no color.
+func ParseColor(spec string) (string, error) {
+	spec = strings.ToLower(strings.TrimSpace(spec))
+
+	switch {
+	case spec == "" || spec == "default":
+		return "", nil
+	case strings.HasPrefix(spec, "#"):
+		return parseHexColor(spec)
+	case strings.HasPrefix(spec, "bright-"):
+		code, ok := namedColors[strings.TrimPrefix(spec, "bright-")]
+		if !ok {
+			return "", fmt.Errorf("unknown color %q", spec)
+		}
+
+		return fmt.Sprintf("\033[%dm", code+brightOffset), nil
+	}
+
+	if code, ok := namedColors[spec]; ok {
+		return fmt.Sprintf("\033[%dm", code), nil
+	}
+
+	index, err := strconv.Atoi(spec)
+	if err != nil || index < 0 || index > 255 {
+		return "", fmt.Errorf("unknown color %q", spec)
+	}
+
+	return fmt.Sprintf("\033[38;5;%dm", index), nil
+}
+
+func parseHexColor(spec string) (string, error) {
+	hex := strings.TrimPrefix(spec, "#")
+	if len(hex) != 6 { //nolint:gomnd
+		return "", fmt.Errorf("invalid hex color %q", spec)
+	}
+
+	value, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil {
+		return "", fmt.Errorf("invalid hex color %q", spec)
+	}
+
+	r, g, b := (value>>16)&0xff, (value>>8)&0xff, value&0xff
+
+	return fmt.Sprintf("\033[38;2;%d;%d;%dm", r, g, b), nil
+}
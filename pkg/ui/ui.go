@@ -6,6 +6,8 @@ import (
 	"os"
 	"slices"
 	"strings"
+
+	"golang.org/x/term"
 )
 
 type MessageType int
@@ -16,6 +18,8 @@ const (
 	MessageTypeError
 	MessageTypeNotice
 	MessageTypeSuccess
+	// MessageTypeDim is used for secondary information such as usage stats.
+	MessageTypeDim
 )
 
 // Define ANSI color codes.
@@ -25,14 +29,15 @@ const (
 	colorYellow = "\033[33m"
 	colorCyan   = "\033[36m"
 	colorGreen  = "\033[32m"
+	colorDim    = "\033[2m"
 )
 
 func AskYesNo(prompt string, defaultYes bool) bool {
 	// default answer should add the correct uppercase to the (Y/n) prompt
 	if defaultYes {
-		prompt += " (Y/n)"
+		prompt += " " + T("yes-no.default-yes")
 	} else {
-		prompt += " (y/N)"
+		prompt += " " + T("yes-no.default-no")
 	}
 
 	fmt.Println(prompt) //nolint:forbidigo
@@ -40,7 +45,7 @@ func AskYesNo(prompt string, defaultYes bool) bool {
 	proceed := ""
 
 	_, _ = fmt.Scanln(&proceed) // ignore errors as we only care about the user input
-	yesStrings := []string{"Y", "YES", "YEAH", "YEP", "YEA", "YEAH", "YUP"}
+	yesStrings := strings.Split(T("yes-no.answers"), ",")
 
 	if defaultYes {
 		yesStrings = append(yesStrings, "")
@@ -61,21 +66,17 @@ func ReadUserInput() string {
 
 // PrintMessage prints a message to the user.
 func PrintMessage(message string, messageType MessageType) {
-	if messageType == MessageTypeInfo {
-		fmt.Print(message) //nolint:forbidigo
-		return
-	}
+	clearActiveProgress()
 
-	messageColors := map[MessageType]string{
-		MessageTypeWarning: colorYellow,
-		MessageTypeError:   colorRed,
-		MessageTypeNotice:  colorCyan,
-		MessageTypeSuccess: colorGreen,
+	message = ToASCII(message)
+
+	if !ColorsEnabled() {
+		fmt.Print(StripANSI(message)) //nolint:forbidigo
+		return
 	}
 
-	color, ok := messageColors[messageType]
-	if !ok {
-		// If the messageType is not found in the map, use a default color or no color.
+	color := CurrentTheme().colorFor(messageType)
+	if color == "" {
 		fmt.Print(message) //nolint:forbidigo
 		return
 	}
@@ -83,3 +84,20 @@ func PrintMessage(message string, messageType MessageType) {
 	// Print the message with color.
 	fmt.Printf("%s%s%s", color, message, colorReset) //nolint:forbidigo
 }
+
+// PrintDiagnostic prints an operational message, such as a log line, to
+// stderr, keeping it apart from the chat output on stdout. It is colored like
+// PrintMessage if stderr is a terminal too.
+func PrintDiagnostic(message string, messageType MessageType) {
+	clearActiveProgress()
+
+	message = ToASCII(message)
+
+	color := CurrentTheme().colorFor(messageType)
+	if color == "" || !ColorsEnabled() || !term.IsTerminal(int(os.Stderr.Fd())) {
+		fmt.Fprint(os.Stderr, StripANSI(message))
+		return
+	}
+
+	fmt.Fprintf(os.Stderr, "%s%s%s", color, message, colorReset)
+}
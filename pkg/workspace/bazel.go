@@ -0,0 +1,79 @@
+package workspace
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// bazelLabelRegexp matches labels of the main repository such as
+// "//pkg/util:lib", capturing the package.
+var bazelLabelRegexp = regexp.MustCompile(`"@{0,2}//([^":]*)(?::[^"]*)?"`) //nolint:gochecknoglobals
+
+// bazelWorkspaceFiles mark the root of a Bazel workspace.
+var bazelWorkspaceFiles = []string{"MODULE.bazel", "WORKSPACE", "WORKSPACE.bazel"} //nolint:gochecknoglobals
+
+// detectBazel finds the packages of a Bazel workspace, the directories with
+// a BUILD file, and the packages their labels refer to.
+func detectBazel(dir string) (*Workspace, error) {
+	manifest := ""
+
+	for _, name := range bazelWorkspaceFiles {
+		if _, err := os.Stat(filepath.Join(dir, name)); err == nil {
+			manifest = filepath.Join(dir, name)
+			break
+		}
+	}
+
+	if manifest == "" {
+		return nil, nil
+	}
+
+	ws := &Workspace{Kind: KindBazel, Manifest: manifest}
+
+	var walk func(current string)
+	walk = func(current string) {
+		for _, build := range []string{"BUILD.bazel", "BUILD"} {
+			data, err := os.ReadFile(filepath.Join(current, build)) // #nosec
+			if err != nil {
+				continue
+			}
+
+			ws.Packages = append(ws.Packages, bazelPackage(dir, current, string(data)))
+
+			break
+		}
+
+		for _, sub := range subdirs(current) {
+			// bazel-out, bazel-bin and friends are symlinks to build output
+			if !strings.HasPrefix(filepath.Base(sub), "bazel-") {
+				walk(sub)
+			}
+		}
+	}
+
+	walk(dir)
+
+	return ws, nil
+}
+
+func bazelPackage(root, dir, build string) Package {
+	rel, _ := filepath.Rel(root, dir)
+	if rel == "." {
+		rel = ""
+	}
+
+	pkg := Package{Name: "//" + filepath.ToSlash(rel), Dir: dir}
+
+	seen := map[string]bool{pkg.Name: true}
+
+	for _, match := range bazelLabelRegexp.FindAllStringSubmatch(build, -1) {
+		if name := "//" + match[1]; !seen[name] {
+			seen[name] = true
+			pkg.Deps = append(pkg.Deps, name)
+		}
+	}
+
+	return pkg
+}
@@ -0,0 +1,156 @@
+package workspace
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+var (
+	tomlStringRegexp = regexp.MustCompile(`"([^"]*)"`)                       //nolint:gochecknoglobals
+	tomlKeyRegexp    = regexp.MustCompile(`^\s*([A-Za-z0-9_-]+)\s*(?:\.|=)`) //nolint:gochecknoglobals
+)
+
+// cargoManifest holds what is read from a Cargo.toml: the members of its
+// workspace, the name of its package and the names of its dependencies.
+type cargoManifest struct {
+	isWorkspace bool
+	members     []string
+	exclude     []string
+	name        string
+	deps        []string
+}
+
+// detectCargo reads the members of the workspace of a Cargo.toml.
+func detectCargo(dir string) (*Workspace, error) {
+	manifest := filepath.Join(dir, "Cargo.toml")
+
+	root, err := readCargoManifest(manifest)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %w", manifest, err)
+	}
+
+	if !root.isWorkspace {
+		return nil, nil
+	}
+
+	patterns := root.members
+	for _, exclude := range root.exclude {
+		patterns = append(patterns, "!"+exclude)
+	}
+
+	ws := &Workspace{Kind: KindCargo, Manifest: manifest}
+
+	for _, memberDir := range expandMembers(dir, patterns, "Cargo.toml") {
+		member, err := readCargoManifest(filepath.Join(memberDir, "Cargo.toml"))
+		if err != nil || member.name == "" {
+			continue
+		}
+
+		ws.Packages = append(ws.Packages, Package{Name: member.name, Dir: memberDir, Deps: member.deps})
+	}
+
+	return ws, nil
+}
+
+// readCargoManifest reads the parts of a Cargo.toml it needs line by line,
+// which covers the way manifests are written in practice without a full TOML
+// parser.
+func readCargoManifest(file string) (*cargoManifest, error) {
+	data, err := os.ReadFile(file) // #nosec
+	if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+
+	manifest := &cargoManifest{}
+	section := ""
+
+	// the key of an array spanning several lines
+	var arrayKey *[]string
+
+	for _, line := range strings.Split(string(data), "\n") {
+		if i := strings.Index(line, "#"); i >= 0 && !strings.Contains(line[:i], `"`) {
+			line = line[:i]
+		}
+
+		trimmed := strings.TrimSpace(line)
+
+		if arrayKey != nil {
+			for _, match := range tomlStringRegexp.FindAllStringSubmatch(trimmed, -1) {
+				*arrayKey = append(*arrayKey, match[1])
+			}
+
+			if strings.Contains(trimmed, "]") {
+				arrayKey = nil
+			}
+
+			continue
+		}
+
+		if strings.HasPrefix(trimmed, "[") && !strings.Contains(trimmed, "=") {
+			section = strings.Trim(trimmed, "[] ")
+
+			if section == "workspace" {
+				manifest.isWorkspace = true
+			}
+
+			// [dependencies.name] declares a dependency in a table of its own
+			if name, ok := dependencyTable(section); ok {
+				manifest.deps = append(manifest.deps, name)
+			}
+
+			continue
+		}
+
+		key := tomlKeyRegexp.FindStringSubmatch(trimmed)
+		if key == nil {
+			continue
+		}
+
+		switch {
+		case section == "workspace" && (key[1] == "members" || key[1] == "exclude"):
+			target := &manifest.members
+			if key[1] == "exclude" {
+				target = &manifest.exclude
+			}
+
+			value := trimmed[strings.Index(trimmed, "=")+1:]
+			for _, match := range tomlStringRegexp.FindAllStringSubmatch(value, -1) {
+				*target = append(*target, match[1])
+			}
+
+			if strings.Contains(value, "[") && !strings.Contains(value, "]") {
+				arrayKey = target
+			}
+		case section == "package" && key[1] == "name":
+			if match := tomlStringRegexp.FindStringSubmatch(trimmed); match != nil {
+				manifest.name = match[1]
+			}
+		case isDependencySection(section):
+			manifest.deps = append(manifest.deps, key[1])
+		}
+	}
+
+	return manifest, nil
+}
+
+func isDependencySection(section string) bool {
+	last := section[strings.LastIndex(section, ".")+1:]
+
+	return last == "dependencies" || last == "dev-dependencies" || last == "build-dependencies"
+}
+
+func dependencyTable(section string) (string, bool) {
+	i := strings.LastIndex(section, ".")
+	if i < 0 || !isDependencySection(section[:i]) {
+		return "", false
+	}
+
+	return strings.Trim(section[i+1:], `"`), true
+}
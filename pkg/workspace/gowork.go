@@ -0,0 +1,80 @@
+package workspace
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// detectGoWork reads the modules used by a go.work file, and the modules of
+// the workspace each of them requires.
+func detectGoWork(dir string) (*Workspace, error) {
+	manifest := filepath.Join(dir, "go.work")
+
+	data, err := os.ReadFile(manifest) // #nosec
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %w", manifest, err)
+	}
+
+	ws := &Workspace{Kind: KindGo, Manifest: manifest}
+
+	for _, use := range goModDirective(string(data), "use") {
+		moduleDir := filepath.Join(dir, filepath.FromSlash(use))
+
+		goMod, err := os.ReadFile(filepath.Join(moduleDir, "go.mod")) // #nosec
+		if err != nil {
+			continue
+		}
+
+		pkg := Package{Dir: moduleDir}
+
+		if module := goModDirective(string(goMod), "module"); len(module) > 0 {
+			pkg.Name = module[0]
+		} else {
+			continue
+		}
+
+		pkg.Deps = goModDirective(string(goMod), "require")
+		ws.Packages = append(ws.Packages, pkg)
+	}
+
+	return ws, nil
+}
+
+// goModDirective returns the first argument of each occurrence of the
+// directive in a go.mod or go.work file, in both its single line and its
+// block form.
+func goModDirective(content, directive string) []string {
+	var values []string
+
+	inBlock := false
+
+	for _, line := range strings.Split(content, "\n") {
+		if i := strings.Index(line, "//"); i >= 0 {
+			line = line[:i]
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		switch {
+		case inBlock && fields[0] == ")":
+			inBlock = false
+		case inBlock:
+			values = append(values, strings.Trim(fields[0], `"`))
+		case fields[0] == directive && len(fields) > 1 && fields[1] == "(":
+			inBlock = true
+		case fields[0] == directive && len(fields) > 1:
+			values = append(values, strings.Trim(fields[1], `"`))
+		}
+	}
+
+	return values
+}
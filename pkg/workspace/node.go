@@ -0,0 +1,115 @@
+package workspace
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v3"
+)
+
+// packageJSON holds the fields of package.json describing workspaces and
+// dependencies.
+type packageJSON struct {
+	Name                 string            `json:"name"`
+	Workspaces           json.RawMessage   `json:"workspaces"`
+	Dependencies         map[string]string `json:"dependencies"`
+	DevDependencies      map[string]string `json:"devDependencies"`
+	PeerDependencies     map[string]string `json:"peerDependencies"`
+	OptionalDependencies map[string]string `json:"optionalDependencies"`
+}
+
+// detectPnpm reads the packages listed in pnpm-workspace.yaml.
+func detectPnpm(dir string) (*Workspace, error) {
+	manifest := filepath.Join(dir, "pnpm-workspace.yaml")
+
+	data, err := os.ReadFile(manifest) // #nosec
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %w", manifest, err)
+	}
+
+	var config struct {
+		Packages []string `yaml:"packages"`
+	}
+
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("error parsing %s: %w", manifest, err)
+	}
+
+	return &Workspace{Kind: KindPnpm, Manifest: manifest, Packages: nodePackages(dir, config.Packages)}, nil
+}
+
+// detectNpm reads the workspaces of a package.json, as used by npm and Yarn.
+func detectNpm(dir string) (*Workspace, error) {
+	manifest := filepath.Join(dir, "package.json")
+
+	pkg, err := readPackageJSON(manifest)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+
+	if err != nil || len(pkg.Workspaces) == 0 {
+		return nil, err
+	}
+
+	// either a list of patterns or an object with a list of packages
+	var patterns []string
+	if json.Unmarshal(pkg.Workspaces, &patterns) != nil {
+		var workspaces struct {
+			Packages []string `json:"packages"`
+		}
+
+		_ = json.Unmarshal(pkg.Workspaces, &workspaces)
+		patterns = workspaces.Packages
+	}
+
+	if len(patterns) == 0 {
+		return nil, nil
+	}
+
+	return &Workspace{Kind: KindNpm, Manifest: manifest, Packages: nodePackages(dir, patterns)}, nil
+}
+
+func nodePackages(root string, patterns []string) []Package {
+	var packages []Package
+
+	for _, dir := range expandMembers(root, patterns, "package.json") {
+		pkg, err := readPackageJSON(filepath.Join(dir, "package.json"))
+		if err != nil || pkg.Name == "" {
+			continue
+		}
+
+		var deps []string
+
+		for _, group := range []map[string]string{
+			pkg.Dependencies, pkg.DevDependencies, pkg.PeerDependencies, pkg.OptionalDependencies,
+		} {
+			for name := range group {
+				deps = append(deps, name)
+			}
+		}
+
+		packages = append(packages, Package{Name: pkg.Name, Dir: dir, Deps: deps})
+	}
+
+	return packages
+}
+
+func readPackageJSON(file string) (*packageJSON, error) {
+	data, err := os.ReadFile(file) // #nosec
+	if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+
+	var pkg packageJSON
+	if err := json.Unmarshal(data, &pkg); err != nil {
+		return nil, fmt.Errorf("error parsing %s: %w", file, err)
+	}
+
+	return &pkg, nil
+}
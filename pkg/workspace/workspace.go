@@ -0,0 +1,313 @@
+// Package workspace detects the packages of monorepos from their workspace
+// manifests, such as go.work, pnpm-workspace.yaml, Cargo workspaces and
+// Bazel, so the context can be scoped to a single package and the packages
+// it depends on.
+package workspace
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Kind names the tool a workspace is defined by.
+type Kind string
+
+const (
+	KindGo    Kind = "go"
+	KindPnpm  Kind = "pnpm"
+	KindNpm   Kind = "npm"
+	KindCargo Kind = "cargo"
+	KindBazel Kind = "bazel"
+)
+
+// ErrNoWorkspace is returned when no workspace manifest is found.
+var ErrNoWorkspace = errors.New("no workspace manifest found, such as go.work, pnpm-workspace.yaml, " +
+	"a package.json with workspaces, a Cargo.toml with [workspace] or a Bazel WORKSPACE")
+
+// Workspace is a monorepo made up of packages.
+type Workspace struct {
+	Kind Kind
+	// Manifest is the path of the file the workspace is defined in.
+	Manifest string
+	Packages []Package
+}
+
+// Package is a package, module or crate of a workspace.
+type Package struct {
+	// Name is the name the package is known by in the workspace, such as
+	// the module path of a Go module or the name in package.json.
+	Name string
+	// Dir is the directory of the package relative to the working
+	// directory.
+	Dir string
+	// Deps are the names of the packages of the workspace it depends on.
+	Deps []string
+}
+
+// detectors are tried in order in each directory.
+var detectors = []func(dir string) (*Workspace, error){ //nolint:gochecknoglobals
+	detectGoWork, detectPnpm, detectNpm, detectCargo, detectBazel,
+}
+
+// Detect finds the workspace the working directory belongs to, looking for a
+// manifest in it and in its parents up to the repository root.
+func Detect(repoRoot string) (*Workspace, error) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return nil, fmt.Errorf("error getting working directory: %w", err)
+	}
+
+	for dir := cwd; ; dir = filepath.Dir(dir) {
+		for _, detect := range detectors {
+			ws, err := detect(dir)
+			if err != nil {
+				return nil, err
+			}
+
+			if ws != nil {
+				ws.relativize(cwd)
+				return ws, nil
+			}
+		}
+
+		if dir == repoRoot || filepath.Dir(dir) == dir {
+			return nil, ErrNoWorkspace
+		}
+	}
+}
+
+// relativize makes the directories of the packages relative to cwd.
+func (w *Workspace) relativize(cwd string) {
+	for i := range w.Packages {
+		if rel, err := filepath.Rel(cwd, w.Packages[i].Dir); err == nil {
+			w.Packages[i].Dir = rel
+		}
+	}
+
+	if rel, err := filepath.Rel(cwd, w.Manifest); err == nil {
+		w.Manifest = rel
+	}
+
+	sort.Slice(w.Packages, func(i, j int) bool { return w.Packages[i].Name < w.Packages[j].Name })
+}
+
+// Find returns the package with the given name. The directory of a package,
+// or the last element of its name when that is unambiguous, such as backend
+// for @acme/backend, works too.
+func (w *Workspace) Find(name string) (*Package, error) {
+	var candidates []*Package
+
+	for i := range w.Packages {
+		pkg := &w.Packages[i]
+
+		if pkg.Name == name || filepath.Clean(pkg.Dir) == filepath.Clean(name) {
+			return pkg, nil
+		}
+
+		if shortName(pkg.Name) == name {
+			candidates = append(candidates, pkg)
+		}
+	}
+
+	switch len(candidates) {
+	case 0:
+		return nil, fmt.Errorf("no package %q in the %s workspace, use one of: %s", name, w.Kind, w.names())
+	case 1:
+		return candidates[0], nil
+	}
+
+	names := make([]string, len(candidates))
+	for i, pkg := range candidates {
+		names[i] = pkg.Name
+	}
+
+	return nil, fmt.Errorf("%q is ambiguous, use one of: %s", name, strings.Join(names, ", "))
+}
+
+func (w *Workspace) names() string {
+	names := make([]string, len(w.Packages))
+	for i, pkg := range w.Packages {
+		names[i] = pkg.Name
+	}
+
+	return strings.Join(names, ", ")
+}
+
+func shortName(name string) string {
+	name = strings.TrimRight(name, "/")
+	if i := strings.LastIndexAny(name, "/:"); i >= 0 {
+		return name[i+1:]
+	}
+
+	return name
+}
+
+// Scope returns the directories of the named package and of all the
+// packages of the workspace it depends on, directly or not, along with the
+// directories of other packages nested inside them, which are not part of
+// the scope.
+func (w *Workspace) Scope(name string) ([]string, []string, error) {
+	pkg, err := w.Find(name)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	byName := make(map[string]*Package, len(w.Packages))
+	for i := range w.Packages {
+		byName[w.Packages[i].Name] = &w.Packages[i]
+	}
+
+	selected := map[string]bool{pkg.Name: true}
+	queue := []*Package{pkg}
+
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+
+		for _, dep := range current.Deps {
+			if depPkg, ok := byName[dep]; ok && !selected[dep] {
+				selected[dep] = true
+				queue = append(queue, depPkg)
+			}
+		}
+	}
+
+	var dirs, nested []string
+
+	for _, p := range w.Packages {
+		if selected[p.Name] {
+			dirs = append(dirs, p.Dir)
+		}
+	}
+
+	for _, p := range w.Packages {
+		if selected[p.Name] {
+			continue
+		}
+
+		for _, dir := range dirs {
+			if isBelow(p.Dir, dir) {
+				nested = append(nested, p.Dir)
+				break
+			}
+		}
+	}
+
+	return dirs, nested, nil
+}
+
+// isBelow reports whether dir is inside parent.
+func isBelow(dir, parent string) bool {
+	rel, err := filepath.Rel(parent, dir)
+
+	return err == nil && rel != "." && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// expandMembers returns the directories below root that match the patterns,
+// such as packages/* or apps/**, and contain the manifest file. Patterns
+// starting with ! exclude directories again.
+func expandMembers(root string, patterns []string, manifest string) []string {
+	include := make(map[string]bool)
+
+	var dirs []string
+
+	for _, pattern := range patterns {
+		if strings.HasPrefix(pattern, "!") {
+			continue
+		}
+
+		for _, dir := range matchDirs(root, strings.Split(path.Clean(pattern), "/")) {
+			if _, err := os.Stat(filepath.Join(dir, manifest)); err == nil && !include[dir] {
+				include[dir] = true
+				dirs = append(dirs, dir)
+			}
+		}
+	}
+
+	for _, pattern := range patterns {
+		if !strings.HasPrefix(pattern, "!") {
+			continue
+		}
+
+		for _, dir := range matchDirs(root, strings.Split(path.Clean(pattern[1:]), "/")) {
+			delete(include, dir)
+		}
+	}
+
+	kept := dirs[:0]
+
+	for _, dir := range dirs {
+		if include[dir] {
+			kept = append(kept, dir)
+		}
+	}
+
+	sort.Strings(kept)
+
+	return kept
+}
+
+// matchDirs returns the directories below dir matching the segments of a
+// glob, where ** matches any number of directories.
+func matchDirs(dir string, segments []string) []string {
+	if len(segments) == 0 {
+		return []string{dir}
+	}
+
+	segment := segments[0]
+
+	switch segment {
+	case ".", "":
+		return matchDirs(dir, segments[1:])
+	case "**":
+		matches := matchDirs(dir, segments[1:])
+		for _, sub := range subdirs(dir) {
+			matches = append(matches, matchDirs(sub, segments)...)
+		}
+
+		return matches
+	}
+
+	if !strings.ContainsAny(segment, "*?[") {
+		if info, err := os.Stat(filepath.Join(dir, segment)); err == nil && info.IsDir() {
+			return matchDirs(filepath.Join(dir, segment), segments[1:])
+		}
+
+		return nil
+	}
+
+	var matches []string
+
+	for _, sub := range subdirs(dir) {
+		if ok, _ := path.Match(segment, filepath.Base(sub)); ok {
+			matches = append(matches, matchDirs(sub, segments[1:])...)
+		}
+	}
+
+	return matches
+}
+
+// subdirs lists the directories in dir, leaving out hidden ones and
+// dependency directories.
+func subdirs(dir string) []string {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+
+	var dirs []string
+
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() && !strings.HasPrefix(name, ".") && name != "node_modules" && name != "target" {
+			dirs = append(dirs, filepath.Join(dir, name))
+		}
+	}
+
+	return dirs
+}